@@ -0,0 +1,132 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"photo-library-server/config"
+)
+
+// Alert is a notification about a condition that needs attention
+type Alert struct {
+	Event   string                 `json:"event"` // e.g. "storage_capacity"
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Time    time.Time              `json:"time"`
+}
+
+// Notifier delivers alerts to someone
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// FromConfig returns the notifiers enabled in cfg
+func FromConfig(cfg *config.Config) []Notifier {
+	var notifiers []Notifier
+	if cfg.AlertWebhookURL != "" {
+		notifiers = append(notifiers, &Webhook{URL: cfg.AlertWebhookURL})
+	}
+	if cfg.AlertEmailTo != "" && cfg.SMTPAddr != "" {
+		email := &Email{Addr: cfg.SMTPAddr, From: cfg.AlertEmailFrom}
+		for _, to := range strings.Split(cfg.AlertEmailTo, ",") {
+			if to = strings.TrimSpace(to); to != "" {
+				email.To = append(email.To, to)
+			}
+		}
+		if cfg.SMTPUsername != "" {
+			host, _, _ := net.SplitHostPort(cfg.SMTPAddr)
+			email.Auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)
+		}
+		notifiers = append(notifiers, email)
+	}
+	return notifiers
+}
+
+// Send delivers alert through every notifier, returning the first failure
+// after trying them all
+func Send(ctx context.Context, notifiers []Notifier, alert Alert) error {
+	var first error
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, alert); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Webhook posts alerts as JSON to a URL
+type Webhook struct {
+	URL    string
+	Client *http.Client // http.DefaultClient with a 10s timeout when nil
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Email sends alerts as plain text mail through an SMTP server
+type Email struct {
+	Addr string // host:port of the SMTP server
+	From string
+	To   []string
+	Auth smtp.Auth // nil for servers without authentication
+}
+
+// Notify implements Notifier
+func (e *Email) Notify(ctx context.Context, alert Alert) error {
+	return smtp.SendMail(e.Addr, e.Auth, e.From, e.To, e.message(alert))
+}
+
+// message formats alert as an RFC 5322 message
+func (e *Email) message(alert Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&b, "Subject: [Photo Library] %s\r\n", alert.Message)
+	fmt.Fprintf(&b, "Date: %s\r\n", alert.Time.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", alert.Message)
+	keys := make([]string, 0, len(alert.Details))
+	for key := range alert.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %v\r\n", key, alert.Details[key])
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,69 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"photo-library-server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	var received Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	alert := Alert{Event: "storage_capacity", Message: "Volume is 91% full", Details: map[string]interface{}{"threshold": 90.0}, Time: time.Now()}
+	require.NoError(t, (&Webhook{URL: server.URL}).Notify(context.Background(), alert))
+	assert.Equal(t, "storage_capacity", received.Event)
+	assert.Equal(t, "Volume is 91% full", received.Message)
+	assert.Equal(t, 90.0, received.Details["threshold"])
+}
+
+func TestWebhookFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := Send(context.Background(), []Notifier{&Webhook{URL: server.URL}}, Alert{Event: "test"})
+	assert.Error(t, err)
+}
+
+func TestEmailMessage(t *testing.T) {
+	email := &Email{From: "server@example.com", To: []string{"a@example.com", "b@example.com"}}
+	message := string(email.message(Alert{
+		Message: "Volume is 91% full",
+		Details: map[string]interface{}{"used_percent": 91, "free_bytes": 1024},
+		Time:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}))
+
+	assert.Contains(t, message, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, message, "Subject: [Photo Library] Volume is 91% full\r\n")
+	assert.Contains(t, message, "\r\n\r\nVolume is 91% full\r\n\r\nfree_bytes: 1024\r\nused_percent: 91\r\n")
+}
+
+func TestFromConfig(t *testing.T) {
+	assert.Empty(t, FromConfig(&config.Config{}))
+
+	notifiers := FromConfig(&config.Config{
+		AlertWebhookURL: "http://hooks.example.com/alerts",
+		AlertEmailTo:    "a@example.com, b@example.com",
+		SMTPAddr:        "smtp.example.com:587",
+		SMTPUsername:    "user",
+	})
+	require.Len(t, notifiers, 2)
+	email := notifiers[1].(*Email)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, email.To)
+	assert.NotNil(t, email.Auth)
+}
@@ -0,0 +1,46 @@
+package apierror
+
+import "github.com/gin-gonic/gin"
+
+// Codes shared by many endpoints. Most others name the failure after its
+// resource, like library_not_found or duplicate_tag.
+const (
+	CodeValidation   = "validation_failed" // A parameter or body field is missing or invalid
+	CodeInternal     = "internal_error"    // The server failed, retrying may help
+	CodeJobQueueFull = "job_queue_full"    // A background job couldn't be scheduled, try again later
+)
+
+// Body returns the JSON body of an error response. The message stays in
+// error, as v1 clients read it there, and code is the stable identifier to
+// branch on. Under /api/v2 the envelope turns it into {status, code, message,
+// details}.
+func Body(code, message string) gin.H {
+	return gin.H{"error": message, "code": code}
+}
+
+// BodyWithDetails returns the JSON body of an error response with details,
+// such as the IDs that caused it. In v1 bodies the details are fields next to
+// error, in v2 they are its details.
+func BodyWithDetails(code, message string, details gin.H) gin.H {
+	body := Body(code, message)
+	for key, value := range details {
+		body[key] = value
+	}
+	return body
+}
+
+// Respond writes an error response
+func Respond(c *gin.Context, status int, code, message string) {
+	c.JSON(status, Body(code, message))
+}
+
+// RespondWithDetails writes an error response with details
+func RespondWithDetails(c *gin.Context, status int, code, message string, details gin.H) {
+	c.JSON(status, BodyWithDetails(code, message, details))
+}
+
+// Abort writes an error response and stops the handlers after the current
+// one, for middleware
+func Abort(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, Body(code, message))
+}
@@ -0,0 +1,120 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Header is the request header carrying an API key
+const Header = "X-API-Key"
+
+// KeyPrefix starts every generated key, so leaked keys are easy to search for
+const KeyPrefix = "plk_"
+
+// MethodPropfind lists WebDAV folders, it only reads
+const MethodPropfind = "PROPFIND"
+
+// Scopes a key can be issued with
+const (
+	ScopeRead   = "read"   // GET requests, exports, download and signed URLs and WebDAV browsing
+	ScopeUpload = "upload" // Read plus photo uploads
+	ScopeFull   = "full"   // Everything, including managing API keys and database backups
+)
+
+// Scopes lists the valid scopes from least to most privileged
+var Scopes = []string{ScopeRead, ScopeUpload, ScopeFull}
+
+// uploadRoutes are the routes the upload scope adds to read
+var uploadRoutes = []string{"/photos/upload", "/photos/upload/batch"}
+
+// readPostRoutes are POST routes that only read. Batch sub-requests are
+// checked one by one, so any key may send a batch, and the GraphQL API has
+// no mutations.
+var readPostRoutes = []string{"/batch", "/photos/export", "/photos/download", "/photos/:id/download-url", "/photos/:id/signed-url", "/graphql"}
+
+type contextKey struct{}
+
+// Generate returns a new random key
+func Generate() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + hex.EncodeToString(b), nil
+}
+
+// Hash returns the form a key is stored and looked up in
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Prefix returns the start of a key, enough to tell keys apart in listings
+func Prefix(key string) string {
+	if len(key) > len(KeyPrefix)+8 {
+		return key[:len(KeyPrefix)+8]
+	}
+	return key
+}
+
+// Allows reports whether a key with scope may make a request with method to
+// route, a gin route path such as /api/v1/photos/:id
+func Allows(scope, method, route string) bool {
+	route = apiRoute(route)
+	switch scope {
+	case ScopeFull:
+		return true
+	case ScopeUpload:
+		if method == http.MethodPost && containsRoute(uploadRoutes, route) {
+			return true
+		}
+		return Allows(ScopeRead, method, route)
+	case ScopeRead:
+		// Keys and backups would hand out more than the key itself allows
+		if strings.HasPrefix(route, "/apikeys") || strings.HasPrefix(route, "/admin") {
+			return false
+		}
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, MethodPropfind:
+			return true
+		case http.MethodPost:
+			return containsRoute(readPostRoutes, route)
+		}
+	}
+	return false
+}
+
+// apiRoute strips the /api/vN prefix from a route path
+func apiRoute(route string) string {
+	parts := strings.SplitN(route, "/", 4) // "", "api", "vN", rest
+	if len(parts) == 4 && parts[0] == "" && parts[1] == "api" {
+		return "/" + parts[3]
+	}
+	return route
+}
+
+// containsRoute reports whether route is one of routes
+func containsRoute(routes []string, route string) bool {
+	for _, r := range routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// WithScope returns a context authenticated with a key of scope. Batch
+// sub-requests inherit it from their batch.
+func WithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, contextKey{}, scope)
+}
+
+// ScopeFromContext returns the scope of the key a context was authenticated with
+func ScopeFromContext(ctx context.Context) (string, bool) {
+	scope, ok := ctx.Value(contextKey{}).(string)
+	return scope, ok
+}
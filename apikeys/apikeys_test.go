@@ -0,0 +1,69 @@
+package apikeys
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	key, err := Generate()
+	require.NoError(t, err)
+	other, err := Generate()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(key, KeyPrefix))
+	assert.NotEqual(t, key, other)
+	assert.Len(t, Prefix(key), len(KeyPrefix)+8)
+	assert.True(t, strings.HasPrefix(key, Prefix(key)))
+
+	assert.Len(t, Hash(key), 64)
+	assert.Equal(t, Hash(key), Hash(key))
+	assert.NotEqual(t, Hash(key), Hash(other))
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		method, route string
+		read, upload  bool
+	}{
+		{"GET", "/api/v1/photos", true, true},
+		{"GET", "/api/v2/photos/:id/file", true, true},
+		{"POST", "/api/v1/photos/export", true, true},
+		{"POST", "/api/v1/photos/download", true, true},
+		{"POST", "/api/v1/photos/:id/download-url", true, true},
+		{"POST", "/api/v1/photos/:id/signed-url", true, true},
+		{"POST", "/api/v1/batch", true, true},
+		{"POST", "/graphql", true, true},
+		{"PROPFIND", "/webdav/*path", true, true},
+		{"OPTIONS", "/webdav/*path", true, true},
+		{"POST", "/api/v1/photos/upload", false, true},
+		{"POST", "/api/v1/photos/upload/batch", false, true},
+		{"POST", "/api/v1/albums", false, false},
+		{"PUT", "/api/v1/photos/:id", false, false},
+		{"DELETE", "/api/v1/photos/:id", false, false},
+		{"GET", "/api/v1/apikeys", false, false},
+		{"POST", "/api/v1/apikeys", false, false},
+		{"GET", "/api/v1/admin/backups", false, false},
+		{"GET", "/api/v1/admin/backups/:name", false, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.read, Allows(ScopeRead, tt.method, tt.route), "read %s %s", tt.method, tt.route)
+		assert.Equal(t, tt.upload, Allows(ScopeUpload, tt.method, tt.route), "upload %s %s", tt.method, tt.route)
+		assert.True(t, Allows(ScopeFull, tt.method, tt.route), "full %s %s", tt.method, tt.route)
+		assert.False(t, Allows("admin", tt.method, tt.route), "unknown scope %s %s", tt.method, tt.route)
+	}
+}
+
+func TestScopeContext(t *testing.T) {
+	_, ok := ScopeFromContext(context.Background())
+	assert.False(t, ok)
+
+	scope, ok := ScopeFromContext(WithScope(context.Background(), ScopeUpload))
+	assert.True(t, ok)
+	assert.Equal(t, ScopeUpload, scope)
+}
@@ -0,0 +1,70 @@
+package cdn
+
+import (
+	"net/url"
+	"strings"
+
+	"photo-library-server/config"
+	"photo-library-server/signing"
+)
+
+// VersionParam is the query parameter that carries a file's content version,
+// so CDN cache keys change whenever the file does
+const VersionParam = "v"
+
+// URLBuilder turns file paths into the URLs handed to clients, pointing at a
+// CDN when one is configured
+type URLBuilder struct {
+	baseURL string
+	signer  *signing.Signer
+}
+
+// NewURLBuilder creates a URL builder. An empty baseURL keeps URLs relative to
+// this server; signer signs paths when it is enabled.
+func NewURLBuilder(baseURL string, signer *signing.Signer) *URLBuilder {
+	return &URLBuilder{baseURL: strings.TrimSuffix(baseURL, "/"), signer: signer}
+}
+
+// FromConfig creates the URL builder described by cfg. Without a CDN, URLs are
+// signed by origin, the signer for this server's own file URLs.
+func FromConfig(cfg *config.Config, origin *signing.Signer) *URLBuilder {
+	if cfg.CDNBaseURL == "" {
+		return NewURLBuilder("", origin)
+	}
+
+	secret := cfg.CDNSigningSecret
+	if secret == "" {
+		secret = cfg.URLSigningSecret
+	}
+	return NewURLBuilder(cfg.CDNBaseURL, signing.NewSigner(secret, cfg.CDNURLTTL))
+}
+
+// Signer returns the signer of the builder's URLs, which the origin must also
+// accept for CDN cache misses
+func (b *URLBuilder) Signer() *signing.Signer {
+	return b.signer
+}
+
+// Enabled reports whether URLs point at a CDN
+func (b *URLBuilder) Enabled() bool {
+	return b.baseURL != ""
+}
+
+// URL returns the client URL for path. On a CDN the content version is added
+// as a cache key; the signature covers only the path, so the CDN can validate
+// it at the edge and origin fetches verify the same way.
+func (b *URLBuilder) URL(path, version string) string {
+	signed := b.signer.SignPath(path)
+	if !b.Enabled() {
+		return signed
+	}
+
+	if version != "" {
+		separator := "?"
+		if strings.Contains(signed, "?") {
+			separator = "&"
+		}
+		signed += separator + VersionParam + "=" + url.QueryEscape(version)
+	}
+	return b.baseURL + signed
+}
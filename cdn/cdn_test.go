@@ -0,0 +1,43 @@
+package cdn
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"photo-library-server/signing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLWithoutCDN(t *testing.T) {
+	builder := NewURLBuilder("", signing.NewSigner("", time.Hour))
+	assert.False(t, builder.Enabled())
+	assert.Equal(t, "/api/v1/photos/1/file", builder.URL("/api/v1/photos/1/file", "abc"))
+}
+
+func TestURLWithCDN(t *testing.T) {
+	builder := NewURLBuilder("https://cdn.example.com/", signing.NewSigner("", time.Hour))
+	assert.True(t, builder.Enabled())
+	assert.Equal(t, "https://cdn.example.com/api/v1/photos/1/file?v=abc", builder.URL("/api/v1/photos/1/file", "abc"))
+	assert.Equal(t, "https://cdn.example.com/api/v1/photos/1/file", builder.URL("/api/v1/photos/1/file", ""))
+}
+
+func TestSignedURLWithCDN(t *testing.T) {
+	signer := signing.NewSigner("cdn-secret", time.Hour)
+	builder := NewURLBuilder("https://cdn.example.com", signer)
+
+	first := builder.URL("/api/v1/photos/1/file", "abc")
+	require.True(t, strings.HasPrefix(first, "https://cdn.example.com/api/v1/photos/1/file?"))
+
+	// Repeated URLs are identical so the CDN caches them under one key
+	assert.Equal(t, first, builder.URL("/api/v1/photos/1/file", "abc"))
+	assert.NotEqual(t, first, builder.URL("/api/v1/photos/1/file", "def"))
+
+	parsed, err := url.Parse(first)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", parsed.Query().Get(VersionParam))
+	assert.NoError(t, signer.Verify(parsed.Path, parsed.Query()))
+}
@@ -0,0 +1,41 @@
+// Package classify suggests tags for photos with an image classification
+// model, served by an inference service over HTTP
+package classify
+
+import (
+	"context"
+	"fmt"
+
+	"photo-library-server/config"
+)
+
+// InputSize is the largest width or height of the images sent to classifiers
+const InputSize = 512
+
+// Label is a tag suggested for an image
+type Label struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"` // From 0 to 1
+}
+
+// Classifier suggests labels for an image, given as a JPEG at most
+// InputSize pixels wide and high
+type Classifier interface {
+	Classify(ctx context.Context, image []byte) ([]Label, error)
+}
+
+// FromConfig returns the classifier selected in cfg, or nil when
+// classification is off
+func FromConfig(cfg *config.Config) (Classifier, error) {
+	switch cfg.Classifier {
+	case "", "off":
+		return nil, nil
+	case "http":
+		if cfg.ClassifierURL == "" {
+			return nil, fmt.Errorf("CLASSIFIER_URL is required for the http classifier")
+		}
+		return &HTTP{URL: cfg.ClassifierURL, Token: cfg.ClassifierToken}, nil
+	default:
+		return nil, fmt.Errorf("unknown classifier %q", cfg.Classifier)
+	}
+}
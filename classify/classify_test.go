@@ -0,0 +1,72 @@
+package classify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"photo-library-server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClassify(t *testing.T) {
+	var gotType, gotAuth string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType, gotAuth = r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"labels": [
+			{"name": "sky", "confidence": 0.4},
+			{"name": " beach ", "confidence": 0.92},
+			{"name": "", "confidence": 0.99},
+			{"name": "bogus", "confidence": 7}
+		]}`))
+	}))
+	defer server.Close()
+
+	classifier := &HTTP{URL: server.URL, Token: "secret"}
+	labels, err := classifier.Classify(context.Background(), []byte("jpeg"))
+	require.NoError(t, err)
+	assert.Equal(t, []Label{{Name: "beach", Confidence: 0.92}, {Name: "sky", Confidence: 0.4}}, labels)
+	assert.Equal(t, "image/jpeg", gotType)
+	assert.Equal(t, "Bearer secret", gotAuth)
+	assert.Equal(t, []byte("jpeg"), gotBody)
+}
+
+func TestHTTPClassifyErrors(t *testing.T) {
+	status := http.StatusInternalServerError
+	body := "oops"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	classifier := &HTTP{URL: server.URL}
+	_, err := classifier.Classify(context.Background(), []byte("jpeg"))
+	assert.ErrorContains(t, err, "500")
+
+	status = http.StatusOK
+	_, err = classifier.Classify(context.Background(), []byte("jpeg"))
+	assert.ErrorContains(t, err, "invalid classifier response")
+}
+
+func TestFromConfig(t *testing.T) {
+	classifier, err := FromConfig(&config.Config{Classifier: "off"})
+	assert.NoError(t, err)
+	assert.Nil(t, classifier)
+
+	_, err = FromConfig(&config.Config{Classifier: "http"})
+	assert.Error(t, err)
+
+	classifier, err = FromConfig(&config.Config{Classifier: "http", ClassifierURL: "http://localhost:9000/classify"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9000/classify", classifier.(*HTTP).URL)
+
+	_, err = FromConfig(&config.Config{Classifier: "onnx"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package classify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HTTP classifies images with an inference service. The image is POSTed as
+// image/jpeg, and the service answers with
+// {"labels": [{"name": "beach", "confidence": 0.92}, ...]}.
+type HTTP struct {
+	URL    string
+	Token  string       // Sent as a bearer token when set
+	Client *http.Client // http.DefaultClient with a 30s timeout when nil
+}
+
+// httpResponse is the body of an inference service's answer
+type httpResponse struct {
+	Labels []Label `json:"labels"`
+}
+
+// Classify implements Classifier. Labels without a name or with a confidence
+// outside 0-1 are dropped, the rest are returned most confident first.
+func (h *HTTP) Classify(ctx context.Context, image []byte) ([]Label, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(image))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set("Accept", "application/json")
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("classifier returned %s", resp.Status)
+	}
+
+	var result httpResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid classifier response: %w", err)
+	}
+
+	labels := make([]Label, 0, len(result.Labels))
+	for _, label := range result.Labels {
+		label.Name = strings.TrimSpace(label.Name)
+		if label.Name == "" || label.Confidence < 0 || label.Confidence > 1 {
+			continue
+		}
+		labels = append(labels, label)
+	}
+	sort.SliceStable(labels, func(i, j int) bool { return labels[i].Confidence > labels[j].Confidence })
+	return labels, nil
+}
@@ -2,57 +2,478 @@ package config
 
 import (
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the application configuration
 type Config struct {
 	// Server configuration
-	Port string
-	Host string
+	Port     string
+	Host     string
+	LogLevel string // "debug", "info", "warn" or "error", logs are JSON lines on stdout
+
+	// Native TLS, with a certificate and key from files or certificates from
+	// Let's Encrypt for TLSAutocertDomains. Plain HTTP is served when neither
+	// is set.
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSAutocertDomains  []string
+	TLSAutocertEmail    string // Let's Encrypt account contact, optional
+	TLSAutocertCacheDir string // Where obtained certificates are kept
+	HTTPRedirectPort    string // Plain HTTP port that redirects to HTTPS and answers ACME challenges, empty disables it
+	GRPCPort            string // Port of the gRPC API, served with the same TLS as HTTP, empty disables it
 
 	// Database configuration
-	DatabasePath string
+	DatabaseDriver string // "sqlite" or "postgres"
+	DatabasePath   string // SQLite database file
+	DatabaseURL    string // PostgreSQL connection URL
+
+	// Database connection pool, 0 keeps database/sql's defaults, and how
+	// long a statement may run before it is cancelled, 0 for no limit
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBQueryTimeout    time.Duration
+
+	// SQLite connection settings. WAL lets uploads write while others read,
+	// and the busy timeout makes writers wait for each other instead of
+	// failing with "database is locked".
+	SQLiteJournalMode string
+	SQLiteSynchronous string
+	SQLiteBusyTimeout time.Duration
+	SQLiteForeignKeys bool
+
+	// Where online database backups are written, SQLite only
+	BackupDir string
 
 	// File upload limits
-	MaxFileSize  int64 // in bytes
-	AllowedTypes []string
+	MaxFileSize      int64 // in bytes
+	AllowedTypes     []string
+	DiskSpaceReserve int64 // Bytes that must stay free after an upload or copy
+
+	// Uploads whose bytes are already in the target library: "off", "link"
+	// (the existing photo is returned) or "reject" (409 Conflict). The dedupe
+	// form field overrides it per upload.
+	DedupeUploads string
+
+	// Request limits, 0 disables a limit. Requests over a concurrency limit
+	// are turned away with 503 Service Unavailable
+	RequestTimeout          time.Duration // Most API routes
+	UploadTimeout           time.Duration // Photo uploads, including receiving the file
+	MaxConcurrentUploads    int
+	MaxConcurrentProcessing int // Thumbnail renders
+
+	// Graceful shutdown on SIGTERM or SIGINT: how long in-flight requests,
+	// then running and queued background jobs, get to finish before they are
+	// cut off
+	ShutdownTimeout    time.Duration
+	JobShutdownTimeout time.Duration
+
+	// Storage capacity alerts: fire when a volume's used space, or the total
+	// size of all photos against StorageUsageLimit, crosses a threshold
+	StorageAlertThresholds []int         // Percentages, ascending
+	StorageUsageLimit      int64         // Bytes, 0 disables the overall usage alert
+	StorageCheckInterval   time.Duration // How often capacity is checked, 0 disables checks
+
+	// Where alerts go
+	AlertWebhookURL string // Receives alerts as JSON POSTs
+	AlertEmailTo    string // Comma-separated recipients, needs SMTPAddr
+	AlertEmailFrom  string
+	SMTPAddr        string // host:port
+	SMTPUsername    string // PLAIN authentication is used when set
+	SMTPPassword    string
+
+	// Metadata write-back: "off", "sidecar" or "embed" (JPEG only, other formats use a sidecar)
+	XMPWriteback string
+
+	// ffmpeg binary for video poster frames, videos have no thumbnails without it
+	FFmpegPath string
+
+	// Thumbnail rendition names and their largest side in pixels, replacing
+	// the built-in small and medium sizes when set. Must include "small".
+	ThumbnailSizes map[string]int
+
+	// Least recently used images resized on request are evicted once
+	// ResizeCacheDir holds more than ResizeCacheSize bytes, 0 disables caching
+	ResizeCacheDir  string
+	ResizeCacheSize int64
+
+	// Signed file URLs
+	URLSigningSecret  string        // HMAC secret, signing is disabled when empty
+	SignedURLTTL      time.Duration // How long issued URLs stay valid
+	RequireSignedURLs bool          // Reject unsigned file requests
+
+	// CDN for file URLs, files are linked from this server when CDNBaseURL is empty
+	CDNBaseURL       string
+	CDNSigningSecret string        // HMAC secret shared with the CDN, falls back to URLSigningSecret when empty
+	CDNURLTTL        time.Duration // How long CDN URLs stay valid, longer TTLs keep cache keys stable longer
+
+	// Master secret that per-library encryption keys are derived from,
+	// encrypted libraries can't be created or read when empty
+	EncryptionSecret string
+
+	// API keys for automation, sent in the X-API-Key header
+	RequireAPIKey bool   // Reject requests without a key, signed file URLs excepted
+	AdminAPIKey   string // Full-scope key for every tenant, for creating the first stored keys
+
+	// Multi-tenant mode: "off", "header" (tenant ID in TenantHeader) or
+	// "subdomain" (first label of the host under TenantDomain)
+	TenantMode   string
+	TenantHeader string
+	TenantDomain string
+
+	// Tag name normalization steps, see tagnorm.ParsePolicy
+	TagNormalization string
+
+	// Background jobs
+	JobWorkers   int
+	JobQueueSize int
+
+	// Tiered storage: originals older than ColdStorageAfterMonths move to ColdStoragePath
+	ColdStoragePath        string
+	ColdStorageAfterMonths int           // 0 disables automatic tiering
+	TieringInterval        time.Duration // How often the automatic tiering pass runs
+
+	// Deleted photos stay in the trash for TrashRetentionDays before they are purged
+	TrashRetentionDays int           // 0 keeps them until the trash is emptied
+	TrashPurgeInterval time.Duration // How often the automatic purge runs
+
+	// Reverse geocoding of photo positions to place names: "off", "offline"
+	// (GeoNames cities file at GeocoderDataset) or "nominatim" (server at
+	// GeocoderURL)
+	Geocoder          string
+	GeocoderDataset   string
+	GeocoderURL       string
+	GeocoderUserAgent string
+	GeocodeInterval   time.Duration // How often new positions are looked up, 0 disables the automatic pass
+
+	// Tag suggestions from an image classifier: "off" or "http" (inference
+	// service at ClassifierURL). Suggestions wait for review before they
+	// become tags.
+	Classifier              string
+	ClassifierURL           string
+	ClassifierToken         string        // Sent to the service as a bearer token
+	ClassifierMinConfidence float64       // Labels less confident than this are not suggested
+	ClassifyOnUpload        bool          // Classify photos as they are uploaded, besides the backfill pass
+	ClassifyInterval        time.Duration // How often unclassified photos are classified, 0 disables the automatic pass
+
+	// Face detection: "off" or "http" (inference service at FaceDetectorURL
+	// returning boxes and embeddings). Faces whose embeddings are at least
+	// FaceMatchThreshold similar to a person's are clustered together.
+	FaceDetector          string
+	FaceDetectorURL       string
+	FaceDetectorToken     string        // Sent to the service as a bearer token
+	FaceMinConfidence     float64       // Detections less confident than this are dropped
+	FaceMatchThreshold    float64       // Cosine similarity from 0 to 1 for a face to join a person
+	DetectFacesOnUpload   bool          // Detect faces as photos are uploaded, besides the backfill pass
+	FaceDetectionInterval time.Duration // How often photos without detection are scanned, 0 disables the automatic pass
+
+	// Watch folders: files dropped into a watched library's images directory
+	// are imported once they have been left alone for WatchDebounce
+	WatchLibraries    bool          // Watch every library, not just those with watch set
+	WatchDebounce     time.Duration // Quiet period before a new file is imported
+	WatchSyncInterval time.Duration // How often the set of watched libraries is refreshed
+
+	// Download bandwidth limits in bytes per second, 0 means unlimited
+	DownloadRateLimit       int64 // Per connection
+	GlobalDownloadRateLimit int64 // Shared by all downloads
+
+	// Hand file downloads to a front-end server: "off", "x-accel-redirect"
+	// (nginx) or "x-sendfile" (Apache, lighttpd)
+	FileOffload string
+	// Comma-separated dir=location pairs mapping directories to nginx
+	// internal locations, used with x-accel-redirect
+	FileOffloadMap string
+
+	// Cross-origin requests from browsers. Origins are exact, such as
+	// https://photos.example.com, may start with a wildcard subdomain
+	// (https://*.example.com) or be "*" for any; none disables CORS.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string // "*" allows whatever a preflight asks for
+	CORSExposedHeaders   []string // Response headers scripts may read
+	CORSAllowCredentials bool     // Cookies and HTTP auth, the origin is echoed instead of "*"
+	CORSMaxAge           time.Duration
 }
 
-// LoadConfig loads configuration from environment variables with defaults
-func LoadConfig() *Config {
+// LoadConfig loads configuration from an optional config file, with
+// environment variables overriding its settings and defaults for anything
+// neither sets. path is the file given with --config; if empty, CONFIG_FILE
+// names it, and without either only the environment is read. Unlike
+// environment variables, file settings that don't parse are errors, as are
+// unknown settings.
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	l := &loader{used: map[string]bool{}}
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		l.file = values
+	}
+
 	config := &Config{
-		Port:         getEnv("PORT", "8080"),
-		Host:         getEnv("HOST", "localhost"),
-		DatabasePath: getEnv("DATABASE_PATH", "./photo_library.db"),
-		MaxFileSize:  getEnvAsInt64("MAX_FILE_SIZE", 50*1024*1024), // 50MB default
-		AllowedTypes: []string{
+		Port:             l.getEnv("PORT", "8080"),
+		Host:             l.getEnv("HOST", "localhost"),
+		LogLevel:         l.getEnv("LOG_LEVEL", "info"),
+		DatabaseDriver:   l.getEnv("DB_DRIVER", "sqlite"),
+		DatabasePath:     l.getEnv("DATABASE_PATH", "./photo_library.db"),
+		DatabaseURL:      l.getEnv("DATABASE_URL", ""),
+		MaxFileSize:      l.getEnvAsInt64("MAX_FILE_SIZE", 50*1024*1024),       // 50MB default
+		DiskSpaceReserve: l.getEnvAsInt64("DISK_SPACE_RESERVE", 100*1024*1024), // 100MB default
+		DedupeUploads:    l.getEnv("DEDUPE_UPLOADS", "off"),
+
+		DBMaxOpenConns:    l.getEnvAsInt("DB_MAX_OPEN_CONNS", 0),
+		DBMaxIdleConns:    l.getEnvAsInt("DB_MAX_IDLE_CONNS", 0),
+		DBConnMaxLifetime: l.getEnvAsDuration("DB_CONN_MAX_LIFETIME", 0),
+		DBQueryTimeout:    l.getEnvAsDuration("DB_QUERY_TIMEOUT", 30*time.Second),
+		SQLiteJournalMode: l.getEnv("SQLITE_JOURNAL_MODE", "WAL"),
+		SQLiteSynchronous: l.getEnv("SQLITE_SYNCHRONOUS", "NORMAL"),
+		SQLiteBusyTimeout: l.getEnvAsDuration("SQLITE_BUSY_TIMEOUT", 5*time.Second),
+		SQLiteForeignKeys: l.getEnvAsBool("SQLITE_FOREIGN_KEYS", true),
+		BackupDir:         l.getEnv("BACKUP_DIR", "./backups"),
+
+		TLSCertFile:         l.getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:          l.getEnv("TLS_KEY_FILE", ""),
+		TLSAutocertDomains:  l.getEnvAsList("TLS_AUTOCERT_DOMAINS", nil),
+		TLSAutocertEmail:    l.getEnv("TLS_AUTOCERT_EMAIL", ""),
+		TLSAutocertCacheDir: l.getEnv("TLS_AUTOCERT_CACHE_DIR", "./autocert_cache"),
+		HTTPRedirectPort:    l.getEnv("HTTP_REDIRECT_PORT", ""),
+		GRPCPort:            l.getEnv("GRPC_PORT", ""),
+
+		RequestTimeout:          l.getEnvAsDuration("REQUEST_TIMEOUT", 30*time.Second),
+		UploadTimeout:           l.getEnvAsDuration("UPLOAD_TIMEOUT", 10*time.Minute),
+		ShutdownTimeout:         l.getEnvAsDuration("SHUTDOWN_TIMEOUT", time.Minute),
+		JobShutdownTimeout:      l.getEnvAsDuration("JOB_SHUTDOWN_TIMEOUT", 30*time.Second),
+		MaxConcurrentUploads:    l.getEnvAsInt("MAX_CONCURRENT_UPLOADS", 4),
+		MaxConcurrentProcessing: l.getEnvAsInt("MAX_CONCURRENT_PROCESSING", 4),
+
+		StorageAlertThresholds: l.getEnvAsIntList("STORAGE_ALERT_THRESHOLDS", []int{80, 90, 95}),
+		StorageUsageLimit:      l.getEnvAsInt64("STORAGE_USAGE_LIMIT", 0),
+		StorageCheckInterval:   l.getEnvAsDuration("STORAGE_CHECK_INTERVAL", 10*time.Minute),
+		AlertWebhookURL:        l.getEnv("ALERT_WEBHOOK_URL", ""),
+		AlertEmailTo:           l.getEnv("ALERT_EMAIL_TO", ""),
+		AlertEmailFrom:         l.getEnv("ALERT_EMAIL_FROM", "photo-library@localhost"),
+		SMTPAddr:               l.getEnv("SMTP_ADDR", ""),
+		SMTPUsername:           l.getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:           l.getEnv("SMTP_PASSWORD", ""),
+
+		AllowedTypes: l.getEnvAsList("ALLOWED_TYPES", []string{
 			"image/jpeg",
 			"image/png",
 			"image/gif",
 			"image/webp",
 			"image/tiff",
 			"image/bmp",
-		},
+			"image/x-canon-cr2",
+			"image/x-nikon-nef",
+			"image/x-sony-arw",
+			"image/x-adobe-dng",
+			"video/mp4",
+			"video/quicktime",
+		}),
+		ThumbnailSizes:    l.getEnvAsIntMap("THUMBNAIL_SIZES", nil),
+		XMPWriteback:      l.getEnv("XMP_WRITEBACK", "off"),
+		FFmpegPath:        l.getEnv("FFMPEG_PATH", "ffmpeg"),
+		ResizeCacheDir:    l.getEnv("RESIZE_CACHE_DIR", "./resize_cache"),
+		ResizeCacheSize:   l.getEnvAsInt64("RESIZE_CACHE_SIZE", 512*1024*1024),
+		URLSigningSecret:  l.getEnv("URL_SIGNING_SECRET", ""),
+		SignedURLTTL:      l.getEnvAsDuration("SIGNED_URL_TTL", time.Hour),
+		RequireSignedURLs: l.getEnvAsBool("REQUIRE_SIGNED_URLS", false),
+		CDNBaseURL:        l.getEnv("CDN_BASE_URL", ""),
+		CDNSigningSecret:  l.getEnv("CDN_SIGNING_SECRET", ""),
+		CDNURLTTL:         l.getEnvAsDuration("CDN_URL_TTL", 24*time.Hour),
+		EncryptionSecret:  l.getEnv("ENCRYPTION_SECRET", ""),
+		RequireAPIKey:     l.getEnvAsBool("REQUIRE_API_KEY", false),
+		AdminAPIKey:       l.getEnv("ADMIN_API_KEY", ""),
+		TenantMode:        l.getEnv("TENANT_MODE", "off"),
+		TenantHeader:      l.getEnv("TENANT_HEADER", "X-Tenant-ID"),
+		TenantDomain:      l.getEnv("TENANT_DOMAIN", ""),
+		TagNormalization:  l.getEnv("TAG_NORMALIZATION", "trim,nfc,casefold"),
+		JobWorkers:        l.getEnvAsInt("JOB_WORKERS", 2),
+		JobQueueSize:      l.getEnvAsInt("JOB_QUEUE_SIZE", 100),
+
+		ColdStoragePath:        l.getEnv("COLD_STORAGE_PATH", ""),
+		ColdStorageAfterMonths: l.getEnvAsInt("COLD_STORAGE_AFTER_MONTHS", 0),
+		TieringInterval:        l.getEnvAsDuration("TIERING_INTERVAL", 24*time.Hour),
+
+		TrashRetentionDays: l.getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+		TrashPurgeInterval: l.getEnvAsDuration("TRASH_PURGE_INTERVAL", 24*time.Hour),
+
+		Geocoder:          l.getEnv("GEOCODER", "off"),
+		GeocoderDataset:   l.getEnv("GEOCODER_DATASET", ""),
+		GeocoderURL:       l.getEnv("GEOCODER_URL", "https://nominatim.openstreetmap.org"),
+		GeocoderUserAgent: l.getEnv("GEOCODER_USER_AGENT", "photo-library-server"),
+		GeocodeInterval:   l.getEnvAsDuration("GEOCODE_INTERVAL", time.Hour),
+
+		Classifier:              l.getEnv("CLASSIFIER", "off"),
+		ClassifierURL:           l.getEnv("CLASSIFIER_URL", ""),
+		ClassifierToken:         l.getEnv("CLASSIFIER_TOKEN", ""),
+		ClassifierMinConfidence: l.getEnvAsFloat("CLASSIFIER_MIN_CONFIDENCE", 0.5),
+		ClassifyOnUpload:        l.getEnvAsBool("CLASSIFY_ON_UPLOAD", true),
+		ClassifyInterval:        l.getEnvAsDuration("CLASSIFY_INTERVAL", time.Hour),
+
+		FaceDetector:          l.getEnv("FACE_DETECTOR", "off"),
+		FaceDetectorURL:       l.getEnv("FACE_DETECTOR_URL", ""),
+		FaceDetectorToken:     l.getEnv("FACE_DETECTOR_TOKEN", ""),
+		FaceMinConfidence:     l.getEnvAsFloat("FACE_MIN_CONFIDENCE", 0.8),
+		FaceMatchThreshold:    l.getEnvAsFloat("FACE_MATCH_THRESHOLD", 0.6),
+		DetectFacesOnUpload:   l.getEnvAsBool("DETECT_FACES_ON_UPLOAD", true),
+		FaceDetectionInterval: l.getEnvAsDuration("FACE_DETECTION_INTERVAL", time.Hour),
+
+		WatchLibraries:    l.getEnvAsBool("WATCH_LIBRARIES", false),
+		WatchDebounce:     l.getEnvAsDuration("WATCH_DEBOUNCE", 2*time.Second),
+		WatchSyncInterval: l.getEnvAsDuration("WATCH_SYNC_INTERVAL", time.Minute),
+
+		DownloadRateLimit:       l.getEnvAsInt64("DOWNLOAD_RATE_LIMIT", 0),
+		GlobalDownloadRateLimit: l.getEnvAsInt64("GLOBAL_DOWNLOAD_RATE_LIMIT", 0),
+
+		FileOffload:    l.getEnv("FILE_OFFLOAD", "off"),
+		FileOffloadMap: l.getEnv("FILE_OFFLOAD_MAP", ""),
+
+		CORSAllowedOrigins: l.getEnvAsList("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		CORSAllowedMethods: l.getEnvAsList("CORS_ALLOWED_METHODS", []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}),
+		CORSAllowedHeaders: l.getEnvAsList("CORS_ALLOWED_HEADERS", []string{
+			"Accept", "Authorization", "Cache-Control", "Content-Type", "X-API-Key", "X-Request-ID", "X-Requested-With",
+		}),
+		CORSExposedHeaders:   l.getEnvAsList("CORS_EXPOSED_HEADERS", []string{"Content-Disposition", "Location", "Retry-After", "X-Request-ID"}),
+		CORSAllowCredentials: l.getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           l.getEnvAsDuration("CORS_MAX_AGE", 10*time.Minute),
 	}
 
-	return config
+	return config, l.err()
 }
 
-// getEnv gets an environment variable with a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+// getEnv gets a setting with a default value
+func (l *loader) getEnv(key, defaultValue string) string {
+	if value, _ := l.lookup(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
-// getEnvAsInt64 gets an environment variable as int64 with a default value
-func getEnvAsInt64(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
+// getEnvAsInt64 gets a setting as int64 with a default value
+func (l *loader) getEnvAsInt64(key string, defaultValue int64) int64 {
+	if value, fromFile := l.lookup(key); value != "" {
 		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
 			return intValue
 		}
+		l.invalid(key, value, fromFile)
+	}
+	return defaultValue
+}
+
+// getEnvAsInt gets a setting as int with a default value
+func (l *loader) getEnvAsInt(key string, defaultValue int) int {
+	if value, fromFile := l.lookup(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+		l.invalid(key, value, fromFile)
+	}
+	return defaultValue
+}
+
+// getEnvAsFloat gets a setting as float64 with a default value
+func (l *loader) getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, fromFile := l.lookup(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+		l.invalid(key, value, fromFile)
+	}
+	return defaultValue
+}
+
+// getEnvAsIntList gets a comma-separated setting as sorted ints with a
+// default value, skipping entries that aren't numbers
+func (l *loader) getEnvAsIntList(key string, defaultValue []int) []int {
+	value, fromFile := l.lookup(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []int
+	for _, part := range strings.Split(value, ",") {
+		if intValue, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			list = append(list, intValue)
+		} else {
+			l.invalid(key, value, fromFile)
+		}
+	}
+	sort.Ints(list)
+	return list
+}
+
+// getEnvAsList gets a comma-separated setting as trimmed strings with a
+// default value. "none" gives an empty list.
+func (l *loader) getEnvAsList(key string, defaultValue []string) []string {
+	value, _ := l.lookup(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	list := []string{}
+	if strings.TrimSpace(value) == "none" {
+		return list
+	}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// getEnvAsIntMap gets a setting of comma-separated name=number pairs, such
+// as "small=256,medium=1024", with a default value. In a config file it can
+// also be a table of names to numbers.
+func (l *loader) getEnvAsIntMap(key string, defaultValue map[string]int) map[string]int {
+	value, fromFile := l.lookup(key)
+	if table, ok := l.lookupTable(key); ok && value == "" {
+		value, fromFile = table, true
+	}
+	if value == "" {
+		return defaultValue
+	}
+
+	values := map[string]int{}
+	for _, part := range strings.Split(value, ",") {
+		name, number, _ := strings.Cut(part, "=")
+		intValue, err := strconv.Atoi(strings.TrimSpace(number))
+		if name = strings.TrimSpace(name); name == "" || err != nil {
+			l.invalid(key, value, fromFile)
+			return defaultValue
+		}
+		values[name] = intValue
+	}
+	return values
+}
+
+// getEnvAsBool gets a setting as bool with a default value
+func (l *loader) getEnvAsBool(key string, defaultValue bool) bool {
+	if value, fromFile := l.lookup(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+		l.invalid(key, value, fromFile)
+	}
+	return defaultValue
+}
+
+// getEnvAsDuration gets a setting as a duration (e.g. "90s", "1h") with a default value
+func (l *loader) getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, fromFile := l.lookup(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+		l.invalid(key, value, fromFile)
 	}
 	return defaultValue
 }
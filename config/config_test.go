@@ -0,0 +1,166 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes a config file with the given name into a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	cfg, err := LoadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, "8080", cfg.Port)
+	assert.Equal(t, int64(50*1024*1024), cfg.MaxFileSize)
+	assert.Contains(t, cfg.AllowedTypes, "image/jpeg")
+	assert.Nil(t, cfg.ThumbnailSizes)
+	assert.Equal(t, []string{"*"}, cfg.CORSAllowedOrigins)
+	assert.Equal(t, 30*time.Second, cfg.DBQueryTimeout)
+	assert.Equal(t, "WAL", cfg.SQLiteJournalMode)
+	assert.True(t, cfg.SQLiteForeignKeys)
+	assert.Equal(t, "trim,nfc,casefold", cfg.TagNormalization)
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+port: 9090
+log_level: debug
+max_file_size: 1048576
+allowed_types: [image/jpeg, image/png]
+db:
+  driver: postgres
+  max_open_conns: 20
+  query_timeout: 5s
+database:
+  url: postgres://photos@localhost/photos
+storage_alert_thresholds: [95, 80]
+thumbnail_sizes:
+  small: 200
+  large: 2048
+cors:
+  allowed_origins:
+    - https://photos.example.com
+    - https://*.example.com
+  allow_credentials: true
+  max_age: 1h
+require_api_key: true
+`)
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "9090", cfg.Port)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, int64(1048576), cfg.MaxFileSize)
+	assert.Equal(t, []string{"image/jpeg", "image/png"}, cfg.AllowedTypes)
+	assert.Equal(t, "postgres", cfg.DatabaseDriver)
+	assert.Equal(t, "postgres://photos@localhost/photos", cfg.DatabaseURL)
+	assert.Equal(t, 20, cfg.DBMaxOpenConns)
+	assert.Equal(t, 5*time.Second, cfg.DBQueryTimeout)
+	assert.Equal(t, []int{80, 95}, cfg.StorageAlertThresholds)
+	assert.Equal(t, map[string]int{"small": 200, "large": 2048}, cfg.ThumbnailSizes)
+	assert.Equal(t, []string{"https://photos.example.com", "https://*.example.com"}, cfg.CORSAllowedOrigins)
+	assert.True(t, cfg.CORSAllowCredentials)
+	assert.Equal(t, time.Hour, cfg.CORSMaxAge)
+	assert.True(t, cfg.RequireAPIKey)
+
+	// Settings the file leaves out keep their defaults
+	assert.Equal(t, "localhost", cfg.Host)
+	assert.Equal(t, "off", cfg.Geocoder)
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+port = "9091"
+cold_storage_path = "/mnt/cold"
+cold_storage_after_months = 12
+
+[thumbnail_sizes]
+small = 128
+medium = 800
+
+[cors]
+allowed_origins = []
+
+[geocoder]
+url = "https://geocode.example.com"
+`)
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "9091", cfg.Port)
+	assert.Equal(t, "/mnt/cold", cfg.ColdStoragePath)
+	assert.Equal(t, 12, cfg.ColdStorageAfterMonths)
+	assert.Equal(t, map[string]int{"small": 128, "medium": 800}, cfg.ThumbnailSizes)
+	assert.Empty(t, cfg.CORSAllowedOrigins)
+	assert.Equal(t, "https://geocode.example.com", cfg.GeocoderURL)
+	assert.Equal(t, "off", cfg.Geocoder)
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, "config.yml", `
+port: 9090
+thumbnail_sizes:
+  small: 200
+job_workers: 8
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "7070")
+	t.Setenv("THUMBNAIL_SIZES", "small=300,medium=900")
+
+	cfg, err := LoadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, "7070", cfg.Port)
+	assert.Equal(t, map[string]int{"small": 300, "medium": 900}, cfg.ThumbnailSizes)
+	assert.Equal(t, 8, cfg.JobWorkers)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	t.Run("Unknown settings", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", "port: 9090\nprot: 9091\n")
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown setting prot")
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", "job_workers: many\nthumbnail_sizes:\n  small: tiny\n")
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "job_workers")
+		assert.Contains(t, err.Error(), "thumbnail_sizes")
+	})
+
+	t.Run("Invalid environment values fall back to defaults", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", "")
+		t.Setenv("JOB_WORKERS", "many")
+		cfg, err := LoadConfig("")
+		require.NoError(t, err)
+		assert.Equal(t, 2, cfg.JobWorkers)
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		path := writeConfigFile(t, "config.json", `{"port": 9090}`)
+		_, err := LoadConfig(path)
+		assert.ErrorContains(t, err, "unsupported format")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Malformed file", func(t *testing.T) {
+		path := writeConfigFile(t, "config.toml", "port = \n")
+		_, err := LoadConfig(path)
+		assert.Error(t, err)
+	})
+}
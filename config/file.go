@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// loader reads settings from the environment, falling back to a config file
+type loader struct {
+	file map[string]string // Flattened file settings, keyed like environment variables
+	used map[string]bool   // File settings that were read
+	errs []error
+}
+
+// lookup returns the value of a setting and whether it came from the config
+// file. Environment variables win over the file.
+func (l *loader) lookup(key string) (string, bool) {
+	fileValue, inFile := l.file[key]
+	if inFile {
+		l.used[key] = true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value, false
+	}
+	return fileValue, inFile
+}
+
+// lookupTable joins the file settings under key, such as THUMBNAIL_SIZES_SMALL
+// from a thumbnail_sizes table, into name=value pairs
+func (l *loader) lookupTable(key string) (string, bool) {
+	var pairs []string
+	for name, value := range l.file {
+		if rest, ok := strings.CutPrefix(name, key+"_"); ok && !strings.Contains(rest, "_") {
+			l.used[name] = true
+			pairs = append(pairs, strings.ToLower(rest)+"="+value)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ","), len(pairs) > 0
+}
+
+// invalid records a setting that doesn't parse. Environment variables that
+// don't parse fall back to their defaults, as they always have.
+func (l *loader) invalid(key, value string, fromFile bool) {
+	if fromFile {
+		l.errs = append(l.errs, fmt.Errorf("config file: invalid value %q for %s", value, strings.ToLower(key)))
+	}
+}
+
+// err reports invalid and unknown file settings
+func (l *loader) err() error {
+	var unknown []string
+	for key := range l.file {
+		if !l.used[key] {
+			unknown = append(unknown, strings.ToLower(key))
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		l.errs = append(l.errs, fmt.Errorf("config file: unknown setting %s", key))
+	}
+	return errors.Join(l.errs...)
+}
+
+// readConfigFile parses a YAML or TOML config file, picked by extension, into
+// settings keyed like the environment variables that override them. Nested
+// tables join their keys with underscores, so cors.allowed_origins is
+// CORS_ALLOWED_ORIGINS, and lists join their items with commas.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten("", tree, values); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flatten adds the settings of a parsed table to values
+func flatten(prefix string, table map[string]interface{}, values map[string]string) error {
+	for name, value := range table {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(key, v, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				text, err := scalar(item)
+				if err != nil {
+					return fmt.Errorf("%s: %w", strings.ToLower(key), err)
+				}
+				items = append(items, text)
+			}
+			if len(items) == 0 {
+				items = append(items, "none")
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			text, err := scalar(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", strings.ToLower(key), err)
+			}
+			values[key] = text
+		}
+	}
+	return nil
+}
+
+// scalar formats a single parsed value as an environment variable would hold it
+func scalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Duration:
+		return v.String(), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
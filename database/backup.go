@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrBackupUnsupported is returned by Backup for databases other than SQLite
+var ErrBackupUnsupported = errors.New("online backups are only supported for SQLite")
+
+// Backup copies the SQLite database behind db to path with SQLite's online
+// backup API. The copy is a consistent snapshot: writes made while it runs
+// are left out, and in WAL mode they aren't held up either. path only
+// appears once the copy is complete.
+func Backup(ctx context.Context, db *gorm.DB, path string) error {
+	if db.Dialector.Name() != DriverSQLite {
+		return ErrBackupUnsupported
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	src, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %w", err)
+	}
+	defer src.Close()
+
+	tmpPath := path + ".tmp"
+	if err := copySQLite(ctx, src, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	return nil
+}
+
+// copySQLite copies the main database of src into a new database at path
+func copySQLite(ctx context.Context, src *sql.Conn, path string) error {
+	dst, err := OpenSnapshot(path)
+	if err != nil {
+		return err
+	}
+	defer closeDB(dst)
+
+	dstDB, err := dst.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	dstConn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstDriver interface{}) error {
+		return src.Raw(func(srcDriver interface{}) error {
+			to, ok := dstDriver.(*sqlite3.SQLiteConn)
+			from, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return ErrBackupUnsupported
+			}
+
+			backup, err := to.Backup("main", from, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			// All pages in one step, so the copy can't restart over and
+			// over on a busy database
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to copy database: %w", err)
+			}
+			if err := backup.Finish(); err != nil {
+				return fmt.Errorf("failed to finish backup: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// OpenSnapshot opens a backup made by Backup, without the tenant scoping,
+// timeouts or logging of the server's own connection. Close it with
+// CloseSnapshot.
+func OpenSnapshot(path string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	return db, nil
+}
+
+// CloseSnapshot closes a database opened with OpenSnapshot
+func CloseSnapshot(db *gorm.DB) error {
+	return closeDB(db)
+}
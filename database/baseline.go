@@ -0,0 +1,263 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// The types below are the schema of migration 1, copied from the models at
+// the time so the baseline creates the same tables whatever the models look
+// like today. They are never changed: a model change goes in as a new
+// migration instead. Comments and JSON tags are left out, only what shapes
+// the tables is kept.
+
+type baselineLibrary struct {
+	ID              uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID        string    `gorm:"uniqueIndex:idx_libraries_tenant_name,priority:1;not null;default:''"`
+	Name            string    `gorm:"uniqueIndex:idx_libraries_tenant_name,priority:2;not null"`
+	Description     string    `gorm:"not null;default:''"`
+	Images          string    `gorm:"uniqueIndex;not null"`
+	ImportKeywords  bool      `gorm:"default:false"`
+	ThumbnailMode   string    `gorm:"default:lazy"`
+	AcceptDocuments bool      `gorm:"default:false"`
+	Encrypted       bool      `gorm:"default:false"`
+	Watch           bool      `gorm:"default:false"`
+	ReadOnly        bool      `gorm:"default:false"`
+	QuotaBytes      int64     `gorm:"default:0"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Albums          []baselineAlbum `gorm:"foreignKey:LibraryID"`
+	Photos          []baselinePhoto `gorm:"foreignKey:LibraryID"`
+}
+
+func (baselineLibrary) TableName() string { return "libraries" }
+
+type baselineAlbum struct {
+	ID           uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID     string    `gorm:"not null;default:'';index"`
+	Name         string    `gorm:"not null"`
+	Description  string
+	LibraryID    uuid.UUID       `gorm:"type:char(36);not null;index"`
+	Library      baselineLibrary `gorm:"foreignKey:LibraryID"`
+	StartDate    *time.Time
+	EndDate      *time.Time
+	CoverPhotoID *uuid.UUID `gorm:"type:char(36)"`
+	SortMode     string     `gorm:"not null;default:'manual'"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Photos       []baselinePhoto `gorm:"many2many:album_photos;"`
+	Tags         []baselineTag   `gorm:"many2many:album_tags;"`
+}
+
+func (baselineAlbum) TableName() string { return "albums" }
+
+type baselinePhoto struct {
+	ID             uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID       string    `gorm:"not null;default:'';index"`
+	Filename       string    `gorm:"not null"`
+	OriginalName   string    `gorm:"not null"`
+	FilePath       string    `gorm:"not null"`
+	MimeType       string    `gorm:"not null"`
+	FileSize       int64     `gorm:"not null"`
+	Checksum       string
+	PerceptualHash string `gorm:"not null;default:''"`
+	Width          int
+	Height         int
+	Rating         *int   `gorm:"check:rating >= 0 AND rating <= 5"`
+	Title          string `gorm:"not null;default:''"`
+	Caption        string `gorm:"not null;default:''"`
+	Description    string `gorm:"not null;default:''"`
+	Favorite       bool   `gorm:"default:false;index"`
+	StorageTier    string `gorm:"default:hot;index"`
+	Missing        bool   `gorm:"default:false;index"`
+	Corrupt        bool   `gorm:"default:false;index"`
+	VerifiedAt     *time.Time
+	LibraryID      uuid.UUID       `gorm:"type:char(36);not null;index"`
+	Library        baselineLibrary `gorm:"foreignKey:LibraryID"`
+	TakenAt        *time.Time      `gorm:"index"`
+	Latitude       *float64        `gorm:"index:idx_photos_location,priority:1"`
+	Longitude      *float64        `gorm:"index:idx_photos_location,priority:2"`
+	Country        string          `gorm:"not null;default:'';index"`
+	City           string          `gorm:"not null;default:'';index"`
+	Place          string          `gorm:"not null;default:''"`
+	GeocodedAt     *time.Time
+	ClassifiedAt   *time.Time
+	FacesFoundAt   *time.Time
+	HasMotion      bool
+	PageCount      int
+	RawFormat      string
+	Duration       float64
+	Encrypted      bool
+	EditVersion    int `gorm:"default:0"`
+	UploadedAt     time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt  `gorm:"index"`
+	Tags           []baselineTag   `gorm:"many2many:photo_tags;"`
+	Albums         []baselineAlbum `gorm:"many2many:album_photos;"`
+}
+
+func (baselinePhoto) TableName() string { return "photos" }
+
+type baselineTag struct {
+	ID          uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID    string    `gorm:"uniqueIndex:idx_tags_tenant_name,priority:1;not null;default:''"`
+	Name        string    `gorm:"uniqueIndex:idx_tags_tenant_name,priority:2;not null"`
+	Description string
+	Color       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Photos      []baselinePhoto `gorm:"many2many:photo_tags;"`
+	Albums      []baselineAlbum `gorm:"many2many:album_tags;"`
+}
+
+func (baselineTag) TableName() string { return "tags" }
+
+type baselineTagAlias struct {
+	ID        uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID  string    `gorm:"uniqueIndex:idx_tag_aliases_tenant_name,priority:1;not null;default:''"`
+	TagID     uuid.UUID `gorm:"type:char(36);not null;index"`
+	Name      string    `gorm:"uniqueIndex:idx_tag_aliases_tenant_name,priority:2;not null"`
+	CreatedAt time.Time
+}
+
+func (baselineTagAlias) TableName() string { return "tag_aliases" }
+
+type baselinePhotoTag struct {
+	PhotoID   uuid.UUID     `gorm:"type:char(36);primaryKey"`
+	TagID     uuid.UUID     `gorm:"type:char(36);primaryKey"`
+	Photo     baselinePhoto `gorm:"foreignKey:PhotoID"`
+	Tag       baselineTag   `gorm:"foreignKey:TagID"`
+	CreatedAt time.Time     `gorm:"index"`
+}
+
+func (baselinePhotoTag) TableName() string { return "photo_tags" }
+
+type baselineAlbumPhoto struct {
+	AlbumID uuid.UUID     `gorm:"type:char(36);primaryKey"`
+	PhotoID uuid.UUID     `gorm:"type:char(36);primaryKey"`
+	Album   baselineAlbum `gorm:"foreignKey:AlbumID"`
+	Photo   baselinePhoto `gorm:"foreignKey:PhotoID"`
+	Order   int           `gorm:"default:0"`
+}
+
+func (baselineAlbumPhoto) TableName() string { return "album_photos" }
+
+type baselineAlbumTag struct {
+	AlbumID uuid.UUID     `gorm:"type:char(36);primaryKey"`
+	TagID   uuid.UUID     `gorm:"type:char(36);primaryKey"`
+	Album   baselineAlbum `gorm:"foreignKey:AlbumID"`
+	Tag     baselineTag   `gorm:"foreignKey:TagID"`
+}
+
+func (baselineAlbumTag) TableName() string { return "album_tags" }
+
+type baselinePhotoMetadata struct {
+	PhotoID   uuid.UUID     `gorm:"type:char(36);primaryKey"`
+	Key       string        `gorm:"primaryKey;size:64;index:idx_photo_metadata_key_value,priority:1"`
+	Value     string        `gorm:"not null;index:idx_photo_metadata_key_value,priority:2"`
+	Photo     baselinePhoto `gorm:"foreignKey:PhotoID"`
+	UpdatedAt time.Time
+}
+
+func (baselinePhotoMetadata) TableName() string { return "photo_metadata" }
+
+type baselineTagSuggestion struct {
+	ID         uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID   string    `gorm:"not null;default:'';index"`
+	PhotoID    uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_tag_suggestions_photo_name,priority:1;not null"`
+	Name       string    `gorm:"uniqueIndex:idx_tag_suggestions_photo_name,priority:2;not null"`
+	Confidence float64   `gorm:"not null"`
+	Status     string    `gorm:"not null;default:pending;index"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (baselineTagSuggestion) TableName() string { return "tag_suggestions" }
+
+type baselinePerson struct {
+	ID            uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID      string    `gorm:"not null;default:'';index"`
+	Name          string    `gorm:"not null;default:'';index"`
+	Centroid      []byte
+	CentroidFaces int `gorm:"not null;default:0"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (baselinePerson) TableName() string { return "people" }
+
+type baselineFace struct {
+	ID         uuid.UUID       `gorm:"type:char(36);primaryKey"`
+	TenantID   string          `gorm:"not null;default:'';index"`
+	PhotoID    uuid.UUID       `gorm:"type:char(36);not null;index"`
+	PersonID   *uuid.UUID      `gorm:"type:char(36);index"`
+	Person     *baselinePerson `gorm:"foreignKey:PersonID"`
+	X          float64
+	Y          float64
+	Width      float64
+	Height     float64
+	Confidence float64
+	Embedding  []byte `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+func (baselineFace) TableName() string { return "faces" }
+
+type baselineAPIKey struct {
+	ID         uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID   string    `gorm:"not null;default:'';index"`
+	Name       string    `gorm:"not null"`
+	Scope      string    `gorm:"not null"`
+	Prefix     string    `gorm:"not null"`
+	KeyHash    string    `gorm:"uniqueIndex;not null"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (baselineAPIKey) TableName() string { return "api_keys" }
+
+type baselineAlbumShare struct {
+	ID           uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID     string    `gorm:"not null;default:'';index"`
+	AlbumID      uuid.UUID `gorm:"type:char(36);not null;index"`
+	Token        string    `gorm:"uniqueIndex;not null"`
+	PasswordHash string    `gorm:"not null;default:''"`
+	ExpiresAt    *time.Time
+	CreatedAt    time.Time
+}
+
+func (baselineAlbumShare) TableName() string { return "album_shares" }
+
+type baselinePhotoVersion struct {
+	ID         uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TenantID   string    `gorm:"not null;default:'';index"`
+	PhotoID    uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_photo_versions_number,priority:1"`
+	Number     int       `gorm:"not null;uniqueIndex:idx_photo_versions_number,priority:2"`
+	Operations string    `gorm:"not null"` // JSON, as the serializer stores it
+	CreatedAt  time.Time
+}
+
+func (baselinePhotoVersion) TableName() string { return "photo_versions" }
+
+// baselineModels are the tables of migration 1, in the order they are
+// created
+var baselineModels = []interface{}{
+	&baselineLibrary{},
+	&baselineAlbum{},
+	&baselinePhoto{},
+	&baselineTag{},
+	&baselineTagAlias{},
+	&baselinePhotoTag{},
+	&baselineAlbumPhoto{},
+	&baselineAlbumTag{},
+	&baselinePhotoMetadata{},
+	&baselineTagSuggestion{},
+	&baselinePerson{},
+	&baselineFace{},
+	&baselineAPIKey{},
+	&baselineAlbumShare{},
+	&baselinePhotoVersion{},
+}
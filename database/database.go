@@ -1,10 +1,16 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"photo-library-server/models"
+	"photo-library-server/tenant"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -15,26 +21,88 @@ import (
 type Database interface {
 	GetDB() *gorm.DB
 	Migrate() error
+	MigrateTo(version int) error
+	CreateIndexes() error
 	Close() error
 }
 
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Options tune the connection pool and bound how long statements may run.
+// Zero values keep database/sql's defaults: unlimited open connections, 2
+// idle ones, connections kept forever and no timeout.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	QueryTimeout    time.Duration // Per statement, on top of any deadline of its context
+
+	// SQLite settings applied to every connection, ignored by PostgreSQL.
+	// Empty values keep SQLite's defaults.
+	SQLiteJournalMode string // DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF
+	SQLiteSynchronous string // OFF, NORMAL, FULL or EXTRA
+	SQLiteBusyTimeout time.Duration
+	SQLiteForeignKeys bool
+}
+
+// Open connects to the database of the given driver. dsn is a file path for
+// SQLite and a connection URL or keyword/value string for PostgreSQL.
+func Open(driver, dsn string, opts Options) (Database, error) {
+	switch driver {
+	case DriverSQLite:
+		return NewSQLiteDB(dsn, opts)
+	case DriverPostgres:
+		return NewPostgresDB(dsn, opts)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
 // SQLiteDB implements the Database interface for SQLite
 type SQLiteDB struct {
 	db *gorm.DB
 }
 
 // NewSQLiteDB creates a new SQLite database connection
-func NewSQLiteDB(dbPath string) (*SQLiteDB, error) {
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+func NewSQLiteDB(dbPath string, opts Options) (*SQLiteDB, error) {
+	db, err := open(sqlite.Open(sqliteDSN(dbPath, opts)), opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, err
 	}
-
 	return &SQLiteDB{db: db}, nil
 }
 
+// sqliteDSN adds the SQLite settings of opts to dbPath as connection
+// parameters, so that every connection in the pool gets them
+func sqliteDSN(dbPath string, opts Options) string {
+	params := url.Values{}
+	if opts.SQLiteJournalMode != "" {
+		params.Set("_journal_mode", opts.SQLiteJournalMode)
+	}
+	if opts.SQLiteSynchronous != "" {
+		params.Set("_synchronous", opts.SQLiteSynchronous)
+	}
+	if opts.SQLiteBusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(opts.SQLiteBusyTimeout.Milliseconds(), 10))
+	}
+	if opts.SQLiteForeignKeys {
+		params.Set("_foreign_keys", "1")
+	}
+	if len(params) == 0 {
+		return dbPath
+	}
+
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return dbPath + separator + params.Encode()
+}
+
 // GetDB returns the underlying GORM database instance
 func (s *SQLiteDB) GetDB() *gorm.DB {
 	return s.db
@@ -42,43 +110,139 @@ func (s *SQLiteDB) GetDB() *gorm.DB {
 
 // Migrate runs database migrations for all models
 func (s *SQLiteDB) Migrate() error {
-	err := s.db.AutoMigrate(
-		&models.Library{},
-		&models.Album{},
-		&models.Photo{},
-		&models.Tag{},
-		&models.PhotoTag{},
-		&models.AlbumPhoto{},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
-	}
+	return migrate(s.db)
+}
 
-	log.Println("Database migration completed successfully")
-	return nil
+// MigrateTo migrates the schema up or down to version
+func (s *SQLiteDB) MigrateTo(version int) error {
+	return MigrateTo(s.db, version)
 }
 
 // Close closes the database connection
 func (s *SQLiteDB) Close() error {
-	sqlDB, err := s.db.DB()
-	if err != nil {
-		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
-	}
-	return sqlDB.Close()
+	return closeDB(s.db)
 }
 
 // CreateIndexes creates additional indexes for better performance
 func (s *SQLiteDB) CreateIndexes() error {
+	return createIndexes(s.db)
+}
+
+// open connects through dialector and sets up what every driver needs
+func open(dialector gorm.Dialector, opts Options) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Limit queries to the request's tenant in multi-tenant mode
+	if err := tenant.Register(db, "libraries", "albums", "photos", "tags", "tag_aliases", "tag_suggestions", "people", "faces", "api_keys", "album_shares", "photo_versions"); err != nil {
+		return nil, fmt.Errorf("failed to register tenant scoping: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	if opts.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	if opts.QueryTimeout > 0 {
+		if err := registerQueryTimeout(db, opts.QueryTimeout); err != nil {
+			return nil, fmt.Errorf("failed to register query timeout: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+// schemaModels are the models whose tables and columns migrations must
+// create, checked by PendingMigrations
+var schemaModels = []interface{}{
+	&models.Library{},
+	&models.Album{},
+	&models.Photo{},
+	&models.Tag{},
+	&models.TagAlias{},
+	&models.PhotoTag{},
+	&models.AlbumPhoto{},
+	&models.AlbumTag{},
+	&models.PhotoMetadata{},
+	&models.TagSuggestion{},
+	&models.Person{},
+	&models.Face{},
+	&models.APIKey{},
+	&models.AlbumShare{},
+	&models.PhotoVersion{},
+}
+
+// PendingMigrations returns the migrations not applied yet (as
+// migration.<version>) and the tables and columns (as table.column) the
+// models need that the database lacks, empty once migrations have run
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, fmt.Sprintf("migration.%d", m.Version))
+		}
+	}
+
+	migrator := db.Migrator()
+	for _, model := range schemaModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model: %w", err)
+		}
+		table := stmt.Schema.Table
+		if !migrator.HasTable(table) {
+			pending = append(pending, table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue // Not a column, or selected rather than stored
+			}
+			if !migrator.HasColumn(model, field.DBName) {
+				pending = append(pending, table+"."+field.DBName)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// createIndexes creates the indexes AutoMigrate can't express. The statements
+// are understood by SQLite and PostgreSQL alike, with reserved words quoted
+// by the dialect.
+func createIndexes(db *gorm.DB) error {
+	db = db.WithContext(withoutQueryTimeout(context.Background()))
+
 	// Create composite indexes for better query performance
-	if err := s.db.Exec("CREATE INDEX IF NOT EXISTS idx_photos_library_uploaded ON photos(library_id, uploaded_at DESC)").Error; err != nil {
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_photos_library_uploaded ON photos(library_id, uploaded_at DESC)").Error; err != nil {
 		return fmt.Errorf("failed to create photos library-uploaded index: %w", err)
 	}
 
-	if err := s.db.Exec("CREATE INDEX IF NOT EXISTS idx_photos_rating ON photos(rating) WHERE rating IS NOT NULL").Error; err != nil {
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_photos_rating ON photos(rating) WHERE rating IS NOT NULL").Error; err != nil {
 		return fmt.Errorf("failed to create photos rating index: %w", err)
 	}
 
-	if err := s.db.Exec("CREATE INDEX IF NOT EXISTS idx_album_photos_order ON album_photos(album_id, \"order\")").Error; err != nil {
+	// Tag autocomplete looks up names by lowercase prefix
+	for _, table := range []string{"tags", "tag_aliases"} {
+		if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_" + table + "_tenant_lower_name ON " + table + "(tenant_id, LOWER(name))").Error; err != nil {
+			return fmt.Errorf("failed to create %s lowercase name index: %w", table, err)
+		}
+	}
+
+	order := db.Statement.Quote("order")
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_album_photos_order ON album_photos(album_id, " + order + ")").Error; err != nil {
 		return fmt.Errorf("failed to create album photos order index: %w", err)
 	}
 
@@ -86,11 +250,11 @@ func (s *SQLiteDB) CreateIndexes() error {
 	return nil
 }
 
-// PostgresDB would be implemented here for future PostgreSQL support
-// type PostgresDB struct {
-//     db *gorm.DB
-// }
-//
-// func NewPostgresDB(dsn string) (*PostgresDB, error) {
-//     // Implementation for PostgreSQL
-// }
+// closeDB closes the connection pool behind db
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	return sqlDB.Close()
+}
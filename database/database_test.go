@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"photo-library-server/models"
+
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMigrations runs migrations and index creation twice, as restarts do
+func testMigrations(t *testing.T, db Database) {
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.Migrate())
+		require.NoError(t, db.CreateIndexes())
+	}
+
+	migrator := db.GetDB().Migrator()
+	assert.True(t, migrator.HasIndex("photos", "idx_photos_rating"))
+	assert.True(t, migrator.HasIndex("album_photos", "idx_album_photos_order"))
+}
+
+func TestOpenSQLite(t *testing.T) {
+	db, err := Open(DriverSQLite, ":memory:", Options{})
+	require.NoError(t, err)
+	testMigrations(t, db)
+}
+
+// TestOpenPostgres needs a scratch database in TEST_DATABASE_URL
+func TestOpenPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := Open(DriverPostgres, dsn, Options{})
+	require.NoError(t, err)
+	testMigrations(t, db)
+}
+
+func TestPendingMigrations(t *testing.T) {
+	db, err := Open(DriverSQLite, ":memory:", Options{})
+	require.NoError(t, err)
+	defer db.Close()
+
+	pending, err := PendingMigrations(db.GetDB())
+	require.NoError(t, err)
+	assert.Contains(t, pending, "migration.1")
+	assert.Contains(t, pending, "photos")
+
+	require.NoError(t, db.Migrate())
+	pending, err = PendingMigrations(db.GetDB())
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// Columns added by newer versions show up until the next migration
+	require.NoError(t, db.GetDB().Exec("ALTER TABLE photos DROP COLUMN verified_at").Error)
+	pending, err = PendingMigrations(db.GetDB())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"photos.verified_at"}, pending)
+}
+
+func TestMigrateTo(t *testing.T) {
+	db, err := Open(DriverSQLite, ":memory:", Options{SQLiteForeignKeys: true})
+	require.NoError(t, err)
+	defer db.Close()
+	gdb := db.GetDB()
+
+	version, err := SchemaVersion(gdb)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	require.NoError(t, db.Migrate())
+	version, err = SchemaVersion(gdb)
+	require.NoError(t, err)
+	assert.Equal(t, LatestVersion(), version)
+	var applied SchemaMigration
+	require.NoError(t, gdb.First(&applied, 1).Error)
+	assert.Equal(t, "baseline", applied.Name)
+
+	// Down to nothing and back up again
+	require.NoError(t, db.MigrateTo(0))
+	assert.False(t, gdb.Migrator().HasTable("photos"))
+	version, err = SchemaVersion(gdb)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+	require.NoError(t, db.MigrateTo(LatestVersion()))
+	assert.True(t, gdb.Migrator().HasTable("photos"))
+	require.NoError(t, gdb.Create(&models.Library{Name: "Migrated", Images: "/tmp/migrated"}).Error)
+
+	// Reverting one migration only undoes that one
+	require.NoError(t, db.MigrateTo(1))
+	assert.False(t, gdb.Migrator().HasColumn(&models.Library{}, "TrashRetentionDays"))
+	assert.True(t, gdb.Migrator().HasTable("photos"))
+	require.NoError(t, db.MigrateTo(LatestVersion()))
+	assert.True(t, gdb.Migrator().HasColumn(&models.Library{}, "TrashRetentionDays"))
+
+	assert.Error(t, db.MigrateTo(-1))
+	assert.Error(t, db.MigrateTo(LatestVersion()+1))
+
+	// A database from a newer release is left alone
+	require.NoError(t, gdb.Create(&SchemaMigration{Version: LatestVersion() + 1, Name: "future"}).Error)
+	assert.Error(t, db.Migrate())
+}
+
+func TestOpenUnsupportedDriver(t *testing.T) {
+	_, err := Open("mysql", "", Options{})
+	assert.Error(t, err)
+}
+
+func TestOptions(t *testing.T) {
+	db, err := Open(DriverSQLite, ":memory:", Options{MaxOpenConns: 3, QueryTimeout: time.Nanosecond})
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlDB, err := db.GetDB().DB()
+	require.NoError(t, err)
+	assert.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+
+	// Migrations aren't cut off, statements past the timeout are
+	require.NoError(t, db.Migrate())
+	require.NoError(t, db.CreateIndexes())
+	var count int64
+	err = db.GetDB().Model(&models.Library{}).Count(&count).Error
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	err = db.GetDB().Create(&models.Library{Name: "Slow", Images: "/tmp/slow"}).Error
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Statements that do finish in time aren't affected
+	db, err = Open(DriverSQLite, ":memory:", Options{QueryTimeout: time.Minute})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Migrate())
+	require.NoError(t, db.GetDB().Create(&models.Library{Name: "Fast", Images: "/tmp/fast"}).Error)
+	require.NoError(t, db.GetDB().Model(&models.Library{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestSQLiteSettings(t *testing.T) {
+	opts := Options{
+		SQLiteJournalMode: "WAL",
+		SQLiteSynchronous: "NORMAL",
+		SQLiteBusyTimeout: 2 * time.Second,
+		SQLiteForeignKeys: true,
+	}
+	assert.Equal(t, "photos.db?_busy_timeout=2000&_foreign_keys=1&_journal_mode=WAL&_synchronous=NORMAL", sqliteDSN("photos.db", opts))
+	assert.Equal(t, "photos.db?cache=shared&_foreign_keys=1", sqliteDSN("photos.db?cache=shared", Options{SQLiteForeignKeys: true}))
+	assert.Equal(t, "photos.db", sqliteDSN("photos.db", Options{}))
+
+	db, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "photos.db"), opts)
+	require.NoError(t, err)
+	defer db.Close()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.Migrate())
+	}
+
+	// Every connection in the pool gets the settings
+	gdb := db.GetDB()
+	sqlDB, err := gdb.DB()
+	require.NoError(t, err)
+	conns := make([]*sql.Conn, 3)
+	for i := range conns {
+		conns[i], err = sqlDB.Conn(context.Background())
+		require.NoError(t, err)
+		defer conns[i].Close()
+
+		var journalMode string
+		var synchronous, busyTimeout, foreignKeys int
+		require.NoError(t, conns[i].QueryRowContext(context.Background(), "PRAGMA journal_mode").Scan(&journalMode))
+		require.NoError(t, conns[i].QueryRowContext(context.Background(), "PRAGMA synchronous").Scan(&synchronous))
+		require.NoError(t, conns[i].QueryRowContext(context.Background(), "PRAGMA busy_timeout").Scan(&busyTimeout))
+		require.NoError(t, conns[i].QueryRowContext(context.Background(), "PRAGMA foreign_keys").Scan(&foreignKeys))
+		assert.Equal(t, "wal", journalMode)
+		assert.Equal(t, 1, synchronous)
+		assert.Equal(t, 2000, busyTimeout)
+		assert.Equal(t, 1, foreignKeys)
+	}
+
+	// Rows pointing at missing parents are refused
+	err = gdb.Create(&models.Album{Name: "Orphan", LibraryID: uuid.New()}).Error
+	assert.ErrorContains(t, err, "FOREIGN KEY constraint failed")
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(DriverSQLite, filepath.Join(dir, "photos.db"), Options{SQLiteJournalMode: "WAL", SQLiteForeignKeys: true})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Migrate())
+	require.NoError(t, db.GetDB().Create(&models.Library{Name: "Backed up", Images: "/tmp/backed-up"}).Error)
+
+	path := filepath.Join(dir, "backup.db")
+	require.NoError(t, Backup(context.Background(), db.GetDB(), path))
+	assert.NoFileExists(t, path+".tmp")
+
+	// The snapshot has the data, including changes still in the WAL file,
+	// and later changes stay out of it
+	require.NoError(t, db.GetDB().Create(&models.Library{Name: "Later", Images: "/tmp/later"}).Error)
+	snapshot, err := OpenSnapshot(path)
+	require.NoError(t, err)
+	defer CloseSnapshot(snapshot)
+	var names []string
+	require.NoError(t, snapshot.Model(&models.Library{}).Pluck("name", &names).Error)
+	assert.Equal(t, []string{"Backed up"}, names)
+	pending, err := PendingMigrations(snapshot)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned change to the schema. Up and Down each run in
+// a transaction together with recording or removing the version, so a
+// failed migration leaves nothing behind.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil when the change can't be reverted
+}
+
+// migrations is the schema's history, oldest first. Released versions are
+// never changed or reordered: a schema change is a new migration at the end,
+// shipped with the model change it goes with. The baseline creates the
+// tables frozen in baseline.go, so every later migration starts from the
+// same schema on fresh and upgraded databases alike.
+var migrations = []Migration{
+	{Version: 1, Name: "baseline", Up: baselineUp, Down: baselineDown},
+	{Version: 2, Name: "library_trash_retention", Up: libraryTrashRetentionUp, Down: libraryTrashRetentionDown},
+}
+
+// SchemaMigration records a migration that has been applied
+type SchemaMigration struct {
+	Version   int       `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name" gorm:"not null"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// LatestVersion returns the version of the newest migration
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// baselineUp brings a database created by any earlier release, or an empty
+// one, to the schema of version 1
+func baselineUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(baselineModels...); err != nil {
+		return err
+	}
+
+	// Library and tag names used to be unique across the whole server, they
+	// are now unique per tenant
+	migrator := tx.Migrator()
+	for table, index := range map[string]string{"libraries": "idx_libraries_name", "tags": "idx_tags_name"} {
+		if migrator.HasIndex(table, index) {
+			if err := migrator.DropIndex(table, index); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// baselineDown drops every table, dependent tables first
+func baselineDown(tx *gorm.DB) error {
+	for i := len(baselineModels) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(baselineModels[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// libraryTrashRetention is the column migration 2 adds to libraries: days
+// deleted photos stay in the trash, NULL for the server's default
+type libraryTrashRetention struct {
+	TrashRetentionDays *int
+}
+
+func (libraryTrashRetention) TableName() string { return "libraries" }
+
+// libraryTrashRetentionUp adds the per-library trash retention period
+func libraryTrashRetentionUp(tx *gorm.DB) error {
+	return tx.Migrator().AddColumn(&libraryTrashRetention{}, "TrashRetentionDays")
+}
+
+// libraryTrashRetentionDown drops the per-library trash retention period
+func libraryTrashRetentionDown(tx *gorm.DB) error {
+	return tx.Migrator().DropColumn(&libraryTrashRetention{}, "TrashRetentionDays")
+}
+
+// migrate applies every migration not applied yet
+func migrate(db *gorm.DB) error {
+	if err := MigrateTo(db, LatestVersion()); err != nil {
+		return err
+	}
+	log.Println("Database migration completed successfully")
+	return nil
+}
+
+// MigrateTo applies migrations up to version, or reverts those after it,
+// one at a time in order. Version 0 reverts everything. Databases already
+// migrated past the newest known version are refused, they belong to a
+// newer release.
+func MigrateTo(db *gorm.DB, version int) error {
+	if version < 0 || version > LatestVersion() {
+		return fmt.Errorf("unknown schema version %d, the newest is %d", version, LatestVersion())
+	}
+
+	// Migrations on large tables can run well past the query timeout
+	db = db.WithContext(withoutQueryTimeout(context.Background()))
+
+	return db.Connection(func(conn *gorm.DB) error {
+		// Connection's instance shares one statement between calls
+		conn = conn.Session(&gorm.Session{})
+
+		// SQLite changes columns by copying a table and dropping the old
+		// one, which foreign key checks would stop
+		if conn.Dialector.Name() == DriverSQLite {
+			var foreignKeys bool
+			if err := conn.Raw("PRAGMA foreign_keys").Scan(&foreignKeys).Error; err != nil {
+				return err
+			}
+			if foreignKeys {
+				if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+					return err
+				}
+				defer conn.Exec("PRAGMA foreign_keys = ON")
+			}
+		}
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return fmt.Errorf("failed to create schema_migrations table: %w", err)
+		}
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for v := range applied {
+			if v > LatestVersion() {
+				return fmt.Errorf("database schema is at version %d, newer than this server's %d", v, LatestVersion())
+			}
+		}
+
+		for _, m := range migrations {
+			if m.Version > version || applied[m.Version] {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s): %w", m.Version, m.Name, err)
+			}
+			log.Printf("Applied migration %d (%s)", m.Version, m.Name)
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.Version <= version || !applied[m.Version] {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("migration %d (%s) can't be reverted", m.Version, m.Name)
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to revert migration %d (%s): %w", m.Version, m.Name, err)
+			}
+			log.Printf("Reverted migration %d (%s)", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// SchemaVersion returns the newest applied migration, 0 when none are
+func SchemaVersion(db *gorm.DB) (int, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// appliedVersions returns the versions recorded in schema_migrations, none
+// when the table doesn't exist yet
+func appliedVersions(db *gorm.DB) (map[int]bool, error) {
+	applied := map[int]bool{}
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+	var versions []int
+	if err := db.Model(&SchemaMigration{}).Pluck("version", &versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
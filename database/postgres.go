@@ -0,0 +1,47 @@
+package database
+
+import (
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// PostgresDB implements the Database interface for PostgreSQL, for
+// deployments with many concurrent users
+type PostgresDB struct {
+	db *gorm.DB
+}
+
+// NewPostgresDB creates a new PostgreSQL database connection. dsn is a
+// postgres:// URL or a keyword/value string such as "host=db dbname=photos".
+func NewPostgresDB(dsn string, opts Options) (*PostgresDB, error) {
+	db, err := open(postgres.Open(dsn), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresDB{db: db}, nil
+}
+
+// GetDB returns the underlying GORM database instance
+func (p *PostgresDB) GetDB() *gorm.DB {
+	return p.db
+}
+
+// Migrate runs database migrations for all models
+func (p *PostgresDB) Migrate() error {
+	return migrate(p.db)
+}
+
+// MigrateTo migrates the schema up or down to version
+func (p *PostgresDB) MigrateTo(version int) error {
+	return MigrateTo(p.db, version)
+}
+
+// Close closes the database connection
+func (p *PostgresDB) Close() error {
+	return closeDB(p.db)
+}
+
+// CreateIndexes creates additional indexes for better performance
+func (p *PostgresDB) CreateIndexes() error {
+	return createIndexes(p.db)
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// noQueryTimeoutKey marks contexts whose statements run without the query
+// timeout
+type noQueryTimeoutKey struct{}
+
+// withoutQueryTimeout returns a context whose statements may run as long as
+// ctx allows, for migrations and other maintenance
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryTimeoutKey{}, true)
+}
+
+// cancelTimeoutKey is where a statement keeps the cancel function of its
+// timeout until it has finished
+const cancelTimeoutKey = "database:cancel_timeout"
+
+// registerQueryTimeout installs callbacks that cancel creates, queries,
+// updates, deletes and raw statements running longer than timeout. The
+// timeout starts before the default transaction of a create, update or
+// delete, and ends after it commits. Row and Rows are left to their
+// context, the result sets they return are read after the callbacks end.
+func registerQueryTimeout(db *gorm.DB, timeout time.Duration) error {
+	start := func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if ctx.Value(noQueryTimeoutKey{}) != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		db.Statement.Context = ctx
+		db.InstanceSet(cancelTimeoutKey, cancel)
+	}
+	finish := func(db *gorm.DB) {
+		if cancel, ok := db.InstanceGet(cancelTimeoutKey); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("*").Register("timeout:create_start", start); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("*").Register("timeout:create_finish", finish); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("*").Register("timeout:query_start", start); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("*").Register("timeout:query_finish", finish); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("*").Register("timeout:update_start", start); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("*").Register("timeout:update_finish", finish); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("*").Register("timeout:delete_start", start); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("*").Register("timeout:delete_finish", finish); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("*").Register("timeout:raw_start", start); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("*").Register("timeout:raw_finish", finish)
+}
@@ -0,0 +1,170 @@
+package diskcache
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tmpPrefix marks files still being written, they aren't cache entries
+const tmpPrefix = ".tmp-"
+
+// Cache keeps files in a directory up to a total size, evicting the least
+// recently used first. Use is recorded in modification times, so recency
+// survives restarts. Keys are used as file names.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	once    sync.Once
+	mu      sync.Mutex
+	entries map[string]*list.Element // Key -> element of order
+	order   *list.List               // *entry values, most recently used first
+	size    int64
+}
+
+// entry is a cached file
+type entry struct {
+	key  string
+	size int64
+}
+
+// New returns a cache in dir holding at most maxBytes. The directory is read
+// on first use. An empty dir or a maxBytes of 0 disables caching.
+func New(dir string, maxBytes int64) *Cache {
+	return &Cache{dir: dir, maxBytes: maxBytes}
+}
+
+// Enabled reports whether files are cached at all
+func (c *Cache) Enabled() bool {
+	return c.dir != "" && c.maxBytes > 0
+}
+
+// Get returns the path of the file cached under key and marks it as used
+func (c *Cache) Get(key string) (string, bool) {
+	if !c.Enabled() {
+		return "", false
+	}
+	c.once.Do(c.load)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	path := filepath.Join(c.dir, key)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		// Removed behind the cache's back
+		c.remove(elem)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return path, true
+}
+
+// Put stores data under key and returns the file's path, evicting the least
+// recently used files to stay within the size limit
+func (c *Cache) Put(key string, data []byte) (string, error) {
+	if !c.Enabled() {
+		return "", os.ErrInvalid
+	}
+	c.once.Do(c.load)
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", err
+	}
+
+	// Readers must never see a partial file
+	tmp, err := os.CreateTemp(c.dir, tmpPrefix+key+"-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	os.Chmod(tmp.Name(), 0644)
+
+	path := filepath.Join(c.dir, key)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, size: int64(len(data))})
+	c.size += int64(len(data))
+
+	// The new file stays even if it alone is over the limit
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		oldest := c.order.Back()
+		os.Remove(filepath.Join(c.dir, oldest.Value.(*entry).key))
+		c.remove(oldest)
+	}
+	return path, nil
+}
+
+// load indexes the files already in the directory, oldest use last
+func (c *Cache) load() {
+	c.entries = make(map[string]*list.Element)
+	c.order = list.New()
+
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type found struct {
+		entry
+		used time.Time
+	}
+	var existing []found
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(file.Name(), tmpPrefix) {
+			// Left behind by an interrupted write
+			os.Remove(filepath.Join(c.dir, file.Name()))
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		existing = append(existing, found{entry{file.Name(), info.Size()}, info.ModTime()})
+	}
+
+	sort.Slice(existing, func(i, j int) bool { return existing[i].used.After(existing[j].used) })
+	for _, f := range existing {
+		e := f.entry
+		c.entries[e.key] = c.order.PushBack(&e)
+		c.size += e.size
+	}
+}
+
+// remove drops an entry from the index, the caller holds mu
+func (c *Cache) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	delete(c.entries, e.key)
+	c.order.Remove(elem)
+	c.size -= e.size
+}
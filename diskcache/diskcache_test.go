@@ -0,0 +1,104 @@
+package diskcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("Put and Get", func(t *testing.T) {
+		cache := New(t.TempDir(), 1024)
+
+		_, ok := cache.Get("a.jpg")
+		assert.False(t, ok)
+
+		path, err := cache.Put("a.jpg", []byte("first"))
+		require.NoError(t, err)
+
+		got, ok := cache.Get("a.jpg")
+		assert.True(t, ok)
+		assert.Equal(t, path, got)
+		data, err := os.ReadFile(got)
+		require.NoError(t, err)
+		assert.Equal(t, "first", string(data))
+	})
+
+	t.Run("Least recently used files are evicted", func(t *testing.T) {
+		dir := t.TempDir()
+		cache := New(dir, 30)
+		for _, key := range []string{"a", "b", "c"} {
+			_, err := cache.Put(key, []byte(strings.Repeat(key, 10)))
+			require.NoError(t, err)
+		}
+
+		// Using a makes b the least recently used
+		_, ok := cache.Get("a")
+		require.True(t, ok)
+		_, err := cache.Put("d", []byte(strings.Repeat("d", 10)))
+		require.NoError(t, err)
+
+		_, ok = cache.Get("b")
+		assert.False(t, ok)
+		assert.NoFileExists(t, filepath.Join(dir, "b"))
+		for _, key := range []string{"a", "c", "d"} {
+			_, ok := cache.Get(key)
+			assert.True(t, ok, key)
+		}
+	})
+
+	t.Run("Files over the limit are still kept", func(t *testing.T) {
+		cache := New(t.TempDir(), 4)
+		_, err := cache.Put("big", []byte("too large"))
+		require.NoError(t, err)
+		_, ok := cache.Get("big")
+		assert.True(t, ok)
+	})
+
+	t.Run("Recency survives restarts", func(t *testing.T) {
+		dir := t.TempDir()
+		old := time.Now().Add(-time.Hour)
+		for i, key := range []string{"old", "new"} {
+			path := filepath.Join(dir, key)
+			require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0644))
+			used := old.Add(time.Duration(i) * time.Minute)
+			require.NoError(t, os.Chtimes(path, used, used))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tmpPrefix+"partial"), []byte("x"), 0644))
+
+		cache := New(dir, 20)
+		_, err := cache.Put("newest", []byte("0123456789"))
+		require.NoError(t, err)
+
+		_, ok := cache.Get("old")
+		assert.False(t, ok)
+		_, ok = cache.Get("new")
+		assert.True(t, ok)
+		assert.NoFileExists(t, filepath.Join(dir, tmpPrefix+"partial"))
+	})
+
+	t.Run("Files removed behind the cache's back", func(t *testing.T) {
+		cache := New(t.TempDir(), 1024)
+		path, err := cache.Put("gone", []byte("data"))
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(path))
+
+		_, ok := cache.Get("gone")
+		assert.False(t, ok)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		for _, cache := range []*Cache{New("", 1024), New(t.TempDir(), 0)} {
+			assert.False(t, cache.Enabled())
+			_, err := cache.Put("a", []byte("data"))
+			assert.Error(t, err)
+			_, ok := cache.Get("a")
+			assert.False(t, ok)
+		}
+	})
+}
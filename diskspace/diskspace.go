@@ -0,0 +1,45 @@
+package diskspace
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ErrUnsupported is returned on platforms where free space can't be queried
+var ErrUnsupported = errors.New("free disk space is not available on this platform")
+
+// Volume describes the filesystem holding a path
+type Volume struct {
+	ID    string // Identifies the filesystem, paths on the same one share it
+	Total int64  // Size in bytes
+	Free  int64  // Bytes available to unprivileged users
+}
+
+// UsedPercent returns how full the volume is, from an unprivileged user's
+// point of view
+func (v Volume) UsedPercent() float64 {
+	if v.Total <= 0 {
+		return 0
+	}
+	return float64(v.Total-v.Free) / float64(v.Total) * 100
+}
+
+// Check reports whether the filesystem holding dir can take size more bytes
+// while keeping reserve bytes free. Platforms that can't report free space
+// always pass.
+func Check(dir string, size, reserve int64) (bool, error) {
+	free, err := Available(dir)
+	if err == ErrUnsupported {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return free >= size+reserve, nil
+}
+
+// IsFull reports whether err came from writing to a full filesystem, which
+// can still happen when concurrent writes race past Check
+func IsFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
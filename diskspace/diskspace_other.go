@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package diskspace
+
+// Available returns ErrUnsupported on this platform
+func Available(path string) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// Usage returns ErrUnsupported on this platform
+func Usage(path string) (Volume, error) {
+	return Volume{}, ErrUnsupported
+}
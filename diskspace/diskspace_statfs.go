@@ -0,0 +1,50 @@
+//go:build linux || darwin || freebsd
+
+package diskspace
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// Available returns the bytes available to unprivileged users on the
+// filesystem holding path
+func Available(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return clamp(uint64(stat.Bavail) * uint64(stat.Bsize)), nil
+}
+
+// Usage describes the filesystem holding path
+func Usage(path string) (Volume, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Volume{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Volume{}, err
+	}
+
+	volume := Volume{
+		Total: clamp(uint64(stat.Blocks) * uint64(stat.Bsize)),
+		Free:  clamp(uint64(stat.Bavail) * uint64(stat.Bsize)),
+	}
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		volume.ID = strconv.FormatUint(uint64(sys.Dev), 10)
+	} else {
+		volume.ID = path
+	}
+	return volume, nil
+}
+
+func clamp(n uint64) int64 {
+	if n > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n)
+}
@@ -0,0 +1,54 @@
+package diskspace
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailable(t *testing.T) {
+	free, err := Available(t.TempDir())
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	assert.Greater(t, free, int64(0))
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Available(dir); err == ErrUnsupported {
+		t.Skip(err)
+	}
+
+	ok, err := Check(dir, 1, 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = Check(dir, 1, math.MaxInt64/2)
+	require.NoError(t, err)
+	assert.False(t, ok, "the reserve must stay free")
+
+	_, err = Check(dir+"/missing", 1, 0)
+	assert.Error(t, err)
+}
+
+func TestUsage(t *testing.T) {
+	dir := t.TempDir()
+	volume, err := Usage(dir)
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	assert.NotEmpty(t, volume.ID)
+	assert.Greater(t, volume.Total, int64(0))
+	assert.LessOrEqual(t, volume.Free, volume.Total)
+	assert.InDelta(t, 50, Volume{Total: 200, Free: 100}.UsedPercent(), 0.001)
+
+	// Paths on the same filesystem share a volume
+	other, err := Usage(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, volume.ID, other.ID)
+}
@@ -0,0 +1,229 @@
+package documents
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// MimeType is the content type of documents libraries can opt in to
+const MimeType = "application/pdf"
+
+// maxInflatedSize caps how much of a compressed object stream is inflated
+const maxInflatedSize = 16 << 20
+
+var (
+	pdfHeader = []byte("%PDF-")
+
+	pagesTypePattern   = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pageTypePattern    = regexp.MustCompile(`/Type\s*/Page\b`)
+	countPattern       = regexp.MustCompile(`/Count\s+(\d+)`)
+	lengthPattern      = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	imagePattern       = regexp.MustCompile(`/Subtype\s*/Image\b`)
+	dctFilterPattern   = regexp.MustCompile(`/Filter\s*(\[\s*)?/DCTDecode\b\s*\]?`)
+	objStmPattern      = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	flateFilterPattern = regexp.MustCompile(`/Filter\s*(\[\s*)?/FlateDecode\b\s*\]?`)
+)
+
+// Info is what the server records about a document
+type Info struct {
+	PageCount int
+	Cover     []byte // JPEG of the first page for scanned documents, nil otherwise
+}
+
+// stream is a PDF stream object: its dictionary and raw (still encoded) data
+type stream struct {
+	dict []byte
+	data []byte
+}
+
+// IsPDF reports whether data starts with a PDF header
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(data, pdfHeader)
+}
+
+// ReadInfo reads a document from disk and returns its page count and cover image
+func ReadInfo(path string) (*Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Inspect(data), nil
+}
+
+// Inspect returns the page count and cover image of a PDF, or nil if data
+// isn't one
+func Inspect(data []byte) *Info {
+	if !IsPDF(data) {
+		return nil
+	}
+
+	streams := pdfStreams(data)
+	return &Info{
+		PageCount: pageCount(data, streams),
+		Cover:     firstJPEGImage(streams),
+	}
+}
+
+// pageCount reads the /Count of the page tree root, which is the largest
+// count of any /Pages node. Files whose page tree can't be found fall back
+// to counting /Page leaves.
+func pageCount(data []byte, streams []stream) int {
+	// PDF 1.5+ files may keep the page tree in compressed object streams
+	sources := [][]byte{data}
+	for _, s := range streams {
+		if objStmPattern.Match(s.dict) && flateFilterPattern.Match(s.dict) {
+			if inflated := inflate(s.data); inflated != nil {
+				sources = append(sources, inflated)
+			}
+		}
+	}
+
+	count := 0
+	for _, source := range sources {
+		for _, loc := range pagesTypePattern.FindAllIndex(source, -1) {
+			dict := enclosingDict(source, loc[0])
+			if match := countPattern.FindSubmatch(dict); match != nil {
+				if n, err := strconv.Atoi(string(match[1])); err == nil && n > count {
+					count = n
+				}
+			}
+		}
+	}
+	if count > 0 {
+		return count
+	}
+
+	for _, source := range sources {
+		count += len(pageTypePattern.FindAllIndex(source, -1))
+	}
+	return count
+}
+
+// firstJPEGImage returns the first JPEG-encoded image in the file. Scanners
+// write one such image per page, in page order.
+func firstJPEGImage(streams []stream) []byte {
+	for _, s := range streams {
+		if imagePattern.Match(s.dict) && dctFilterPattern.Match(s.dict) &&
+			len(s.data) >= 2 && s.data[0] == 0xFF && s.data[1] == 0xD8 {
+			return s.data
+		}
+	}
+	return nil
+}
+
+// pdfStreams finds every stream object in the file
+func pdfStreams(data []byte) []stream {
+	var streams []stream
+
+	keyword := []byte("stream")
+	pos := 0
+	for {
+		i := bytes.Index(data[pos:], keyword)
+		if i < 0 {
+			break
+		}
+		i += pos
+		pos = i + len(keyword)
+
+		// Skip "endstream" and anything not directly preceded by a dictionary
+		dictEnd := bytes.TrimRight(data[:i], " \t\r\n")
+		if !bytes.HasSuffix(dictEnd, []byte(">>")) {
+			continue
+		}
+		dict := enclosingDict(data, len(dictEnd)-2)
+		if dict == nil {
+			continue
+		}
+
+		// Stream data starts after the end of line following the keyword
+		start := pos
+		if start < len(data) && data[start] == '\r' {
+			start++
+		}
+		if start < len(data) && data[start] == '\n' {
+			start++
+		}
+
+		end := -1
+		if match := lengthPattern.FindSubmatch(dict); match != nil && match[2] == nil {
+			if n, err := strconv.Atoi(string(match[1])); err == nil && start+n <= len(data) &&
+				bytes.HasPrefix(bytes.TrimLeft(data[start+n:], " \t\r\n"), []byte("endstream")) {
+				end = start + n
+			}
+		}
+		if end < 0 {
+			// Indirect or wrong lengths: the data runs up to "endstream"
+			j := bytes.Index(data[start:], []byte("endstream"))
+			if j < 0 {
+				break
+			}
+			end = start + j
+			for end > start && (data[end-1] == '\n' || data[end-1] == '\r') {
+				end--
+			}
+		}
+
+		streams = append(streams, stream{dict: dict, data: data[start:end]})
+		pos = end
+	}
+
+	return streams
+}
+
+// enclosingDict returns the innermost dictionary containing the byte at pos,
+// or nil if there is none
+func enclosingDict(data []byte, pos int) []byte {
+	start := -1
+	depth := 0
+	for i := pos - 1; i > 0; i-- {
+		if data[i-1] == '>' && data[i] == '>' {
+			depth++
+			i--
+		} else if data[i-1] == '<' && data[i] == '<' {
+			if depth == 0 {
+				start = i - 1
+				break
+			}
+			depth--
+			i--
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	depth = 0
+	for i := start; i+1 < len(data); i++ {
+		switch {
+		case data[i] == '<' && data[i+1] == '<':
+			depth++
+			i++
+		case data[i] == '>' && data[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return data[start : i+1]
+			}
+		}
+	}
+	return nil
+}
+
+// inflate decompresses a FlateDecode stream, returning nil on failure
+func inflate(data []byte) []byte {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	inflated, err := io.ReadAll(io.LimitReader(r, maxInflatedSize))
+	if err != nil && len(inflated) == 0 {
+		return nil
+	}
+	return inflated
+}
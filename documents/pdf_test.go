@@ -0,0 +1,131 @@
+package documents
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJPEG encodes a blank w x h JPEG
+func testJPEG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil))
+	return buf.Bytes()
+}
+
+// buildPDF assembles a PDF with the given number of pages. If cover is set,
+// the first page draws it as a JPEG image XObject.
+func buildPDF(pages int, cover []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	var kids []string
+	for i := 0; i < pages; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 10+i))
+	}
+	fmt.Fprintf(&b, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), pages)
+
+	for i := 0; i < pages; i++ {
+		resources := "<< >>"
+		if i == 0 && cover != nil {
+			resources = "<< /XObject << /Im0 3 0 R >> >>"
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources %s >>\nendobj\n", 10+i, resources)
+	}
+
+	if cover != nil {
+		fmt.Fprintf(&b, "3 0 obj\n<< /Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n", len(cover))
+		b.Write(cover)
+		b.WriteString("\nendstream\nendobj\n")
+	}
+
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	t.Run("Page count and cover", func(t *testing.T) {
+		cover := testJPEG(t, 40, 30)
+		info := Inspect(buildPDF(3, cover))
+
+		require.NotNil(t, info)
+		assert.Equal(t, 3, info.PageCount)
+		assert.Equal(t, cover, info.Cover)
+	})
+
+	t.Run("No scanned image", func(t *testing.T) {
+		info := Inspect(buildPDF(2, nil))
+
+		require.NotNil(t, info)
+		assert.Equal(t, 2, info.PageCount)
+		assert.Nil(t, info.Cover)
+	})
+
+	t.Run("Page tree in an object stream", func(t *testing.T) {
+		var objects bytes.Buffer
+		zw := zlib.NewWriter(&objects)
+		zw.Write([]byte("<< /Type /Pages /Kids [10 0 R 11 0 R 12 0 R 13 0 R] /Count 4 >> << /Type /Page /Parent 2 0 R >>"))
+		zw.Close()
+
+		var b bytes.Buffer
+		b.WriteString("%PDF-1.5\n")
+		fmt.Fprintf(&b, "5 0 obj\n<< /Type /ObjStm /N 2 /First 10 /Filter /FlateDecode /Length %d >>\nstream\n", objects.Len())
+		b.Write(objects.Bytes())
+		b.WriteString("\nendstream\nendobj\n%%EOF\n")
+
+		info := Inspect(b.Bytes())
+		require.NotNil(t, info)
+		assert.Equal(t, 4, info.PageCount)
+	})
+
+	t.Run("Nested dictionaries and indirect lengths", func(t *testing.T) {
+		cover := testJPEG(t, 8, 8)
+		var b bytes.Buffer
+		b.WriteString("%PDF-1.4\n")
+		b.WriteString("2 0 obj\n<< /Type /Pages /Resources << /Font << >> >> /Kids [10 0 R] /Count 1 >>\nendobj\n")
+		b.WriteString("3 0 obj\n<< /Subtype /Image /DecodeParms << /Quality 80 >> /Filter [/DCTDecode] /Length 4 0 R >>\nstream\r\n")
+		b.Write(cover)
+		b.WriteString("\r\nendstream\nendobj\n")
+
+		info := Inspect(b.Bytes())
+		require.NotNil(t, info)
+		assert.Equal(t, 1, info.PageCount)
+		assert.Equal(t, cover, info.Cover)
+	})
+
+	t.Run("Page leaves without a page tree count", func(t *testing.T) {
+		data := []byte("%PDF-1.4\n1 0 obj\n<< /Type /Page >>\nendobj\n2 0 obj\n<< /Type/Page >>\nendobj\n")
+
+		info := Inspect(data)
+		require.NotNil(t, info)
+		assert.Equal(t, 2, info.PageCount)
+	})
+
+	t.Run("Not a PDF", func(t *testing.T) {
+		assert.Nil(t, Inspect(testJPEG(t, 1, 1)))
+		assert.False(t, IsPDF([]byte("%PD")))
+	})
+}
+
+func TestReadInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letter.pdf")
+	require.NoError(t, os.WriteFile(path, buildPDF(2, nil), 0644))
+
+	info, err := ReadInfo(path)
+	require.NoError(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, 2, info.PageCount)
+
+	_, err = ReadInfo(filepath.Join(t.TempDir(), "missing.pdf"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+package edits
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"photo-library-server/thumbnails"
+)
+
+// Operation types
+const (
+	TypeCrop     = "crop"     // Keep a box of the image
+	TypeRotate   = "rotate"   // Turn clockwise and/or mirror
+	TypeExposure = "exposure" // Brighten or darken by a number of stops
+	TypeFilter   = "filter"   // Apply a color filter
+)
+
+// Filters lists the color filters a filter operation can apply
+var Filters = []string{"grayscale", "sepia", "warm", "cool"}
+
+// MaxExposure is the most stops an exposure operation may brighten or darken
+const MaxExposure = 3
+
+// MaxOperations caps the length of an edit stack
+const MaxOperations = 50
+
+// Operation is one step of an edit stack. Which fields apply depends on Type.
+// Crop boxes are given as fractions of the image, as it is at that point of
+// the stack, from the top left corner.
+type Operation struct {
+	Type    string  `json:"type"`
+	X       float64 `json:"x,omitempty"`       // crop
+	Y       float64 `json:"y,omitempty"`       // crop
+	Width   float64 `json:"width,omitempty"`   // crop
+	Height  float64 `json:"height,omitempty"`  // crop
+	Degrees int     `json:"degrees,omitempty"` // rotate: 0, 90, 180 or 270 clockwise
+	Flip    string  `json:"flip,omitempty"`    // rotate: horizontal or vertical, after turning
+	Stops   float64 `json:"stops,omitempty"`   // exposure: positive brightens, negative darkens
+	Filter  string  `json:"filter,omitempty"`  // filter: one of Filters
+}
+
+// Validate reports what, if anything, is wrong with op
+func (op Operation) Validate() error {
+	switch op.Type {
+	case TypeCrop:
+		if op.X < 0 || op.Y < 0 || op.Width <= 0 || op.Height <= 0 || op.X+op.Width > 1 || op.Y+op.Height > 1 {
+			return errors.New("crop box must lie within the image, with x, y, width and height as fractions from 0 to 1")
+		}
+	case TypeRotate:
+		if op.Degrees != 0 && op.Degrees != 90 && op.Degrees != 180 && op.Degrees != 270 {
+			return errors.New("rotate degrees must be 0, 90, 180 or 270")
+		}
+		if op.Flip != "" && op.Flip != thumbnails.FlipHorizontal && op.Flip != thumbnails.FlipVertical {
+			return errors.New("rotate flip must be horizontal or vertical")
+		}
+		if op.Degrees == 0 && op.Flip == "" {
+			return errors.New("rotate needs degrees or flip")
+		}
+	case TypeExposure:
+		if op.Stops == 0 || math.Abs(op.Stops) > MaxExposure {
+			return fmt.Errorf("exposure stops must be non-zero and between -%d and %d", MaxExposure, MaxExposure)
+		}
+	case TypeFilter:
+		if !isFilter(op.Filter) {
+			return fmt.Errorf("filter must be one of %v", Filters)
+		}
+	default:
+		return fmt.Errorf("unknown operation type %q, must be crop, rotate, exposure or filter", op.Type)
+	}
+	return nil
+}
+
+// Validate checks a whole edit stack, naming the first bad operation
+func Validate(ops []Operation) error {
+	if len(ops) > MaxOperations {
+		return fmt.Errorf("at most %d operations are allowed", MaxOperations)
+	}
+	for i, op := range ops {
+		if err := op.Validate(); err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Apply returns img with ops applied in order. img is not modified.
+func Apply(img image.Image, ops []Operation) image.Image {
+	for _, op := range ops {
+		switch op.Type {
+		case TypeCrop:
+			img = crop(img, op)
+		case TypeRotate:
+			img = thumbnails.Rotate(img, op.Degrees, op.Flip)
+		case TypeExposure:
+			factor := math.Pow(2, op.Stops)
+			img = mapColors(img, func(r, g, b float64) (float64, float64, float64) {
+				return r * factor, g * factor, b * factor
+			})
+		case TypeFilter:
+			img = mapColors(img, filters[op.Filter])
+		}
+	}
+	return img
+}
+
+// filters maps filter names to their per-pixel color transforms
+var filters = map[string]func(r, g, b float64) (float64, float64, float64){
+	"grayscale": func(r, g, b float64) (float64, float64, float64) {
+		y := 0.299*r + 0.587*g + 0.114*b
+		return y, y, y
+	},
+	"sepia": func(r, g, b float64) (float64, float64, float64) {
+		return 0.393*r + 0.769*g + 0.189*b, 0.349*r + 0.686*g + 0.168*b, 0.272*r + 0.534*g + 0.131*b
+	},
+	"warm": func(r, g, b float64) (float64, float64, float64) {
+		return r * 1.1, g, b * 0.9
+	},
+	"cool": func(r, g, b float64) (float64, float64, float64) {
+		return r * 0.9, g, b * 1.1
+	},
+}
+
+func isFilter(name string) bool {
+	_, ok := filters[name]
+	return ok
+}
+
+// crop copies the op's box out of img, at least one pixel in each direction
+func crop(img image.Image, op Operation) image.Image {
+	bounds := img.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+
+	x0 := bounds.Min.X + int(math.Round(op.X*w))
+	y0 := bounds.Min.Y + int(math.Round(op.Y*h))
+	x1 := min(bounds.Max.X, max(x0+1, bounds.Min.X+int(math.Round((op.X+op.Width)*w))))
+	y1 := min(bounds.Max.Y, max(y0+1, bounds.Min.Y+int(math.Round((op.Y+op.Height)*h))))
+	box := image.Rect(x0, y0, x1, y1)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, box.Dx(), box.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, box.Min, draw.Src)
+	return dst
+}
+
+// mapColors returns a copy of img with transform applied to the color of
+// every pixel, on values from 0 to 255 that are clamped afterwards.
+// Transparency is kept.
+func mapColors(img image.Image, transform func(r, g, b float64) (float64, float64, float64)) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	for i := 0; i < len(dst.Pix); i += 4 {
+		p := dst.Pix[i : i+3 : i+3]
+		r, g, b := transform(float64(p[0]), float64(p[1]), float64(p[2]))
+		p[0], p[1], p[2] = clamp(r), clamp(g), clamp(b)
+	}
+	return dst
+}
+
+func clamp(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -0,0 +1,91 @@
+package edits
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// solid returns a w x h image of a single color
+func solid(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestValidate(t *testing.T) {
+	valid := []Operation{
+		{Type: TypeCrop, X: 0.1, Y: 0.2, Width: 0.5, Height: 0.8},
+		{Type: TypeRotate, Degrees: 90},
+		{Type: TypeRotate, Flip: "horizontal"},
+		{Type: TypeExposure, Stops: -1.5},
+		{Type: TypeFilter, Filter: "sepia"},
+	}
+	assert.NoError(t, Validate(valid))
+
+	for _, op := range []Operation{
+		{Type: "blur"},
+		{Type: TypeCrop, X: 0.6, Width: 0.5, Height: 1},
+		{Type: TypeCrop, Width: 0, Height: 1},
+		{Type: TypeRotate, Degrees: 45},
+		{Type: TypeRotate},
+		{Type: TypeRotate, Degrees: 90, Flip: "diagonal"},
+		{Type: TypeExposure},
+		{Type: TypeExposure, Stops: 4},
+		{Type: TypeFilter, Filter: "neon"},
+	} {
+		assert.Error(t, Validate([]Operation{op}), "%+v", op)
+	}
+
+	assert.Error(t, Validate(make([]Operation, MaxOperations+1)))
+}
+
+func TestApply(t *testing.T) {
+	t.Run("Crop and rotate change the size", func(t *testing.T) {
+		src := solid(200, 100, color.NRGBA{10, 20, 30, 255})
+		out := Apply(src, []Operation{
+			{Type: TypeCrop, X: 0.25, Y: 0, Width: 0.5, Height: 0.5},
+			{Type: TypeRotate, Degrees: 90},
+		})
+		assert.Equal(t, image.Rect(0, 0, 50, 100), out.Bounds())
+		assert.Equal(t, image.Rect(0, 0, 200, 100), src.Bounds())
+	})
+
+	t.Run("Crop keeps the chosen region", func(t *testing.T) {
+		src := solid(100, 100, color.NRGBA{0, 0, 0, 255})
+		for y := 0; y < 100; y++ {
+			for x := 50; x < 100; x++ {
+				src.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			}
+		}
+		out := Apply(src, []Operation{{Type: TypeCrop, X: 0.5, Width: 0.5, Height: 1}})
+		r, _, _, _ := out.At(0, 0).RGBA()
+		assert.Equal(t, uint32(0xffff), r)
+	})
+
+	t.Run("Exposure scales by stops", func(t *testing.T) {
+		out := Apply(solid(4, 4, color.NRGBA{50, 100, 200, 255}), []Operation{{Type: TypeExposure, Stops: 1}})
+		assert.Equal(t, color.NRGBA{100, 200, 255, 255}, color.NRGBAModel.Convert(out.At(1, 1)))
+		out = Apply(solid(4, 4, color.NRGBA{50, 100, 200, 255}), []Operation{{Type: TypeExposure, Stops: -1}})
+		assert.Equal(t, color.NRGBA{25, 50, 100, 255}, color.NRGBAModel.Convert(out.At(1, 1)))
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		out := Apply(solid(4, 4, color.NRGBA{255, 0, 0, 128}), []Operation{{Type: TypeFilter, Filter: "grayscale"}})
+		c := color.NRGBAModel.Convert(out.At(0, 0)).(color.NRGBA)
+		assert.Equal(t, c.R, c.G)
+		assert.Equal(t, c.G, c.B)
+		assert.Equal(t, uint8(128), c.A, "transparency is kept")
+
+		out = Apply(solid(4, 4, color.NRGBA{100, 100, 100, 255}), []Operation{{Type: TypeFilter, Filter: "sepia"}})
+		c = color.NRGBAModel.Convert(out.At(0, 0)).(color.NRGBA)
+		assert.Greater(t, c.R, c.G)
+		assert.Greater(t, c.G, c.B)
+	})
+}
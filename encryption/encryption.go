@@ -0,0 +1,266 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Encrypted files start with a header followed by the plaintext split into
+// chunks, each sealed separately with AES-GCM so any byte range can be
+// decrypted without reading the whole file:
+//
+//	magic (8) | chunk size (4) | plaintext size (8) | nonce prefix (8) | chunks...
+//
+// A chunk's nonce is the file's random prefix followed by the chunk index, and
+// the header is authenticated with every chunk so truncated, reordered or
+// spliced files fail to decrypt.
+const (
+	chunkSize    = 64 << 10
+	maxChunkSize = 16 << 20
+	headerSize   = 8 + 4 + 8 + 8
+	gcmOverhead  = 16 // Tag appended to every sealed chunk
+)
+
+var magic = []byte("PLSENC01")
+
+// ErrInvalid is returned for files that aren't encrypted, are corrupt, or
+// were encrypted with a different key
+var ErrInvalid = errors.New("encrypted file is corrupt or the key is wrong")
+
+// DeriveKey returns the AES-256 key for a library, derived from the server's
+// master secret so keys never have to be stored
+func DeriveKey(masterSecret, libraryID string) []byte {
+	mac := hmac.New(sha256.New, []byte(masterSecret))
+	mac.Write([]byte("photo-library-server/library-key/" + libraryID))
+	return mac.Sum(nil)
+}
+
+// Encrypt reads size bytes of plaintext from src and writes them to dst in
+// encrypted form
+func Encrypt(dst io.Writer, src io.Reader, key []byte, size int64) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[8:], chunkSize)
+	binary.BigEndian.PutUint64(header[12:], uint64(size))
+	if _, err := rand.Read(header[20:]); err != nil {
+		return err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+aead.Overhead())
+	remaining := size
+	for index := uint32(0); remaining > 0; index++ {
+		n := int(min(remaining, chunkSize))
+		if _, err := io.ReadFull(src, buf[:n]); err != nil {
+			return fmt.Errorf("failed to read plaintext: %w", err)
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(header, index), buf[:n], header)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		remaining -= int64(n)
+	}
+	return nil
+}
+
+// EncryptedSize returns the size of the encrypted form of size bytes of plaintext
+func EncryptedSize(size int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	return headerSize + size + chunks*gcmOverhead
+}
+
+// EncryptFile replaces a plaintext file with its encrypted form
+func EncryptFile(path string, key []byte) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".encrypt-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := Encrypt(tmp, src, key, info.Size()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Reader decrypts an encrypted file on demand. It implements io.ReadSeeker
+// over the plaintext, so it can be served with range requests.
+type Reader struct {
+	file   *os.File
+	aead   cipher.AEAD
+	header []byte
+	size   int64
+	pos    int64
+
+	chunk     []byte // Decrypted contents of the chunk at chunkIdx
+	chunkIdx  int64
+	chunkSize int64
+}
+
+// Open opens an encrypted file for reading
+func Open(path string, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(file, header); err != nil || !bytes.HasPrefix(header, magic) {
+		file.Close()
+		return nil, ErrInvalid
+	}
+
+	size := int64(binary.BigEndian.Uint64(header[12:]))
+	cs := int64(binary.BigEndian.Uint32(header[8:]))
+	if cs == 0 || cs > maxChunkSize || size < 0 {
+		file.Close()
+		return nil, ErrInvalid
+	}
+
+	// The stored size must match the header before anything is allocated for it
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	chunks := (size + cs - 1) / cs
+	if info.Size() != headerSize+size+chunks*int64(aead.Overhead()) {
+		file.Close()
+		return nil, ErrInvalid
+	}
+
+	return &Reader{file: file, aead: aead, header: header, size: size, chunkIdx: -1, chunkSize: cs}, nil
+}
+
+// ReadFile decrypts a whole encrypted file
+func ReadFile(path string, key []byte) ([]byte, error) {
+	r, err := Open(path, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data := make([]byte, r.Size())
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Size returns the plaintext size
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Read implements io.Reader
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	index := r.pos / r.chunkSize
+	if index != r.chunkIdx {
+		if err := r.loadChunk(index); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.chunk[r.pos-index*r.chunkSize:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+// Close closes the underlying file
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+func (r *Reader) loadChunk(index int64) error {
+	plainLen := min(r.chunkSize, r.size-index*r.chunkSize)
+	sealed := make([]byte, plainLen+int64(r.aead.Overhead()))
+	offset := headerSize + index*(r.chunkSize+int64(r.aead.Overhead()))
+	if _, err := r.file.ReadAt(sealed, offset); err != nil {
+		return ErrInvalid
+	}
+
+	chunk, err := r.aead.Open(r.chunk[:0], chunkNonce(r.header, uint32(index)), sealed, r.header)
+	if err != nil {
+		return ErrInvalid
+	}
+	r.chunk, r.chunkIdx = chunk, index
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce combines the file's nonce prefix with a chunk index
+func chunkNonce(header []byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[20:28])
+	binary.BigEndian.PutUint32(nonce[8:], index)
+	return nonce
+}
@@ -0,0 +1,131 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encryptToFile writes plaintext to a new encrypted file and returns its path
+func encryptToFile(t *testing.T, plaintext, key []byte) string {
+	path := filepath.Join(t.TempDir(), "photo.enc")
+	var buf bytes.Buffer
+	require.NoError(t, Encrypt(&buf, bytes.NewReader(plaintext), key, int64(len(plaintext))))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func TestDeriveKey(t *testing.T) {
+	key := DeriveKey("secret", "library-1")
+
+	assert.Len(t, key, 32)
+	assert.Equal(t, key, DeriveKey("secret", "library-1"))
+	assert.NotEqual(t, key, DeriveKey("secret", "library-2"))
+	assert.NotEqual(t, key, DeriveKey("other", "library-1"))
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := DeriveKey("secret", "library")
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, 2*chunkSize + 17} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+		path := encryptToFile(t, plaintext, key)
+
+		stored, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, EncryptedSize(int64(size)), int64(len(stored)), "size %d", size)
+		if size >= 16 { // Shorter runs can turn up in ciphertext by chance
+			assert.False(t, bytes.Contains(stored, plaintext[:min(size, 64)]), "plaintext must not be stored")
+		}
+
+		decrypted, err := ReadFile(path, key)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, plaintext, decrypted, "size %d", size)
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	key := DeriveKey("secret", "library")
+	plaintext := make([]byte, 3*chunkSize)
+	rand.Read(plaintext)
+
+	r, err := Open(encryptToFile(t, plaintext, key), key)
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, int64(len(plaintext)), r.Size())
+
+	// A range spanning a chunk boundary
+	_, err = r.Seek(chunkSize-10, io.SeekStart)
+	require.NoError(t, err)
+	got := make([]byte, 20)
+	_, err = io.ReadFull(r, got)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext[chunkSize-10:chunkSize+10], got)
+
+	// The tail, via SeekEnd
+	_, err = r.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	tail, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext[len(plaintext)-5:], tail)
+}
+
+func TestTamperingDetected(t *testing.T) {
+	key := DeriveKey("secret", "library")
+	plaintext := bytes.Repeat([]byte("photo"), chunkSize)
+	path := encryptToFile(t, plaintext, key)
+
+	t.Run("Wrong key", func(t *testing.T) {
+		_, err := ReadFile(path, DeriveKey("secret", "other-library"))
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Modified chunk", func(t *testing.T) {
+		stored, _ := os.ReadFile(path)
+		stored[headerSize+100] ^= 0xFF
+		tampered := filepath.Join(t.TempDir(), "tampered.enc")
+		require.NoError(t, os.WriteFile(tampered, stored, 0644))
+
+		_, err := ReadFile(tampered, key)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		stored, _ := os.ReadFile(path)
+		truncated := filepath.Join(t.TempDir(), "truncated.enc")
+		require.NoError(t, os.WriteFile(truncated, stored[:len(stored)-100], 0644))
+
+		_, err := ReadFile(truncated, key)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Not encrypted", func(t *testing.T) {
+		plain := filepath.Join(t.TempDir(), "plain.jpg")
+		require.NoError(t, os.WriteFile(plain, []byte("plain file contents that are long enough"), 0644))
+
+		_, err := Open(plain, key)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+}
+
+func TestEncryptFile(t *testing.T) {
+	key := DeriveKey("secret", "library")
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	require.NoError(t, os.WriteFile(path, []byte("original photo bytes"), 0644))
+
+	require.NoError(t, EncryptFile(path, key))
+
+	decrypted, err := ReadFile(path, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("original photo bytes"), decrypted)
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+}
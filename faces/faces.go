@@ -0,0 +1,104 @@
+// Package faces finds faces in photos with a face detection model, served by
+// an inference service over HTTP, and compares them by their embeddings
+package faces
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"photo-library-server/config"
+)
+
+// InputSize is the largest width or height of the images sent to detectors
+const InputSize = 1024
+
+// Box is where a face is in an image, as fractions of its width and height
+// from the top left corner
+type Box struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Face is a face found in an image
+type Face struct {
+	Box        Box       `json:"box"`
+	Confidence float64   `json:"confidence"` // From 0 to 1
+	Embedding  []float32 `json:"embedding"`  // Faces of the same person have similar embeddings
+}
+
+// Detector finds the faces in an image, given as a JPEG at most InputSize
+// pixels wide and high
+type Detector interface {
+	Detect(ctx context.Context, image []byte) ([]Face, error)
+}
+
+// FromConfig returns the detector selected in cfg, or nil when face
+// detection is off
+func FromConfig(cfg *config.Config) (Detector, error) {
+	switch cfg.FaceDetector {
+	case "", "off":
+		return nil, nil
+	case "http":
+		if cfg.FaceDetectorURL == "" {
+			return nil, fmt.Errorf("FACE_DETECTOR_URL is required for the http face detector")
+		}
+		return &HTTP{URL: cfg.FaceDetectorURL, Token: cfg.FaceDetectorToken}, nil
+	default:
+		return nil, fmt.Errorf("unknown face detector %q", cfg.FaceDetector)
+	}
+}
+
+// Similarity returns the cosine similarity of two embeddings, from -1 to 1.
+// Embeddings of different lengths, from different models, are never similar.
+func Similarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return -1
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return -1
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// Mean adds embedding to centroid, the mean of n embeddings, and returns the
+// mean of all n+1
+func Mean(centroid []float32, n int, embedding []float32) []float32 {
+	if n <= 0 || len(centroid) != len(embedding) {
+		return append([]float32(nil), embedding...)
+	}
+
+	mean := make([]float32, len(centroid))
+	for i := range centroid {
+		mean[i] = (centroid[i]*float32(n) + embedding[i]) / float32(n+1)
+	}
+	return mean
+}
+
+// EncodeEmbedding packs an embedding into bytes for storage
+func EncodeEmbedding(embedding []float32) []byte {
+	data := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+	}
+	return data
+}
+
+// DecodeEmbedding unpacks an embedding stored with EncodeEmbedding
+func DecodeEmbedding(data []byte) []float32 {
+	embedding := make([]float32, len(data)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return embedding
+}
@@ -0,0 +1,96 @@
+package faces
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"photo-library-server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPDetect(t *testing.T) {
+	var gotType, gotAuth string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType, gotAuth = r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"faces": [
+			{"box": {"x": 0.1, "y": 0.1, "width": 0.2, "height": 0.3}, "confidence": 0.85, "embedding": [1, 0]},
+			{"box": {"x": 0.5, "y": 0.2, "width": 0.2, "height": 0.3}, "confidence": 0.99, "embedding": [0, 1]},
+			{"box": {"x": 0.9, "y": 0.2, "width": 0.5, "height": 0.3}, "confidence": 0.9, "embedding": [1, 1]},
+			{"box": {"x": 0.1, "y": 0.1, "width": 0.2, "height": 0.3}, "confidence": 0.9, "embedding": []}
+		]}`))
+	}))
+	defer server.Close()
+
+	detector := &HTTP{URL: server.URL, Token: "secret"}
+	found, err := detector.Detect(context.Background(), []byte("jpeg"))
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, 0.99, found[0].Confidence)
+	assert.Equal(t, Box{X: 0.5, Y: 0.2, Width: 0.2, Height: 0.3}, found[0].Box)
+	assert.Equal(t, []float32{0, 1}, found[0].Embedding)
+	assert.Equal(t, 0.85, found[1].Confidence)
+	assert.Equal(t, "image/jpeg", gotType)
+	assert.Equal(t, "Bearer secret", gotAuth)
+	assert.Equal(t, []byte("jpeg"), gotBody)
+}
+
+func TestHTTPDetectErrors(t *testing.T) {
+	status := http.StatusBadGateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("oops"))
+	}))
+	defer server.Close()
+
+	detector := &HTTP{URL: server.URL}
+	_, err := detector.Detect(context.Background(), []byte("jpeg"))
+	assert.ErrorContains(t, err, "502")
+
+	status = http.StatusOK
+	_, err = detector.Detect(context.Background(), []byte("jpeg"))
+	assert.ErrorContains(t, err, "invalid face detector response")
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.InDelta(t, 1, Similarity([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0, Similarity([]float32{1, 0}, []float32{0, 3}), 1e-9)
+	assert.InDelta(t, -1, Similarity([]float32{1, 0}, []float32{-1, 0}), 1e-9)
+	assert.Equal(t, -1.0, Similarity([]float32{1, 0}, []float32{1, 0, 0}))
+	assert.Equal(t, -1.0, Similarity([]float32{0, 0}, []float32{1, 0}))
+}
+
+func TestMean(t *testing.T) {
+	assert.Equal(t, []float32{1, 2}, Mean(nil, 0, []float32{1, 2}))
+	assert.Equal(t, []float32{2, 3}, Mean([]float32{1, 2}, 1, []float32{3, 4}))
+	assert.Equal(t, []float32{2, 2}, Mean([]float32{1, 1}, 2, []float32{4, 4}))
+}
+
+func TestEmbeddingEncoding(t *testing.T) {
+	embedding := []float32{0.5, -1.25, 3e-7, 0}
+	data := EncodeEmbedding(embedding)
+	assert.Len(t, data, 16)
+	assert.Equal(t, embedding, DecodeEmbedding(data))
+}
+
+func TestFromConfig(t *testing.T) {
+	detector, err := FromConfig(&config.Config{FaceDetector: "off"})
+	assert.NoError(t, err)
+	assert.Nil(t, detector)
+
+	_, err = FromConfig(&config.Config{FaceDetector: "http"})
+	assert.Error(t, err)
+
+	detector, err = FromConfig(&config.Config{FaceDetector: "http", FaceDetectorURL: "http://localhost:9000/faces"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9000/faces", detector.(*HTTP).URL)
+
+	_, err = FromConfig(&config.Config{FaceDetector: "dlib"})
+	assert.Error(t, err)
+}
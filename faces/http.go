@@ -0,0 +1,76 @@
+package faces
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// HTTP detects faces with an inference service. The image is POSTed as
+// image/jpeg, and the service answers with
+// {"faces": [{"box": {"x": 0.1, "y": 0.2, "width": 0.3, "height": 0.4},
+// "confidence": 0.98, "embedding": [0.12, ...]}, ...]}.
+type HTTP struct {
+	URL    string
+	Token  string       // Sent as a bearer token when set
+	Client *http.Client // http.DefaultClient with a 30s timeout when nil
+}
+
+// httpResponse is the body of an inference service's answer
+type httpResponse struct {
+	Faces []Face `json:"faces"`
+}
+
+// Detect implements Detector. Faces without an embedding, with a confidence
+// outside 0-1 or with a box outside the image are dropped, the rest are
+// returned most confident first.
+func (h *HTTP) Detect(ctx context.Context, image []byte) ([]Face, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(image))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set("Accept", "application/json")
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("face detector returned %s", resp.Status)
+	}
+
+	var result httpResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid face detector response: %w", err)
+	}
+
+	found := make([]Face, 0, len(result.Faces))
+	for _, face := range result.Faces {
+		if len(face.Embedding) == 0 || face.Confidence < 0 || face.Confidence > 1 || !face.Box.valid() {
+			continue
+		}
+		found = append(found, face)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Confidence > found[j].Confidence })
+	return found, nil
+}
+
+// valid reports whether a box has an area and lies within the image
+func (b Box) valid() bool {
+	return b.X >= 0 && b.Y >= 0 && b.Width > 0 && b.Height > 0 &&
+		b.X+b.Width <= 1.0001 && b.Y+b.Height <= 1.0001
+}
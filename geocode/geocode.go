@@ -0,0 +1,55 @@
+// Package geocode turns GPS positions into the names of the places they are
+// in, using either an offline dataset or a Nominatim server
+package geocode
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"photo-library-server/config"
+)
+
+// earthRadiusKm is the mean radius used for distances
+const earthRadiusKm = 6371.0
+
+// Place is where a position is
+type Place struct {
+	CountryCode string // ISO 3166-1 alpha-2, upper case
+	City        string // City, town or village
+	Name        string // Most specific named place, the city when there's nothing finer
+}
+
+// Provider looks up the place at a position. It returns nil without an error
+// when there is nothing there, such as out at sea.
+type Provider interface {
+	Reverse(ctx context.Context, lat, lon float64) (*Place, error)
+}
+
+// FromConfig returns the provider selected in cfg, or nil when reverse
+// geocoding is off
+func FromConfig(cfg *config.Config) (Provider, error) {
+	switch cfg.Geocoder {
+	case "", "off":
+		return nil, nil
+	case "offline":
+		if cfg.GeocoderDataset == "" {
+			return nil, fmt.Errorf("GEOCODER_DATASET is required for the offline geocoder")
+		}
+		return LoadDataset(cfg.GeocoderDataset)
+	case "nominatim":
+		return &Nominatim{URL: cfg.GeocoderURL, UserAgent: cfg.GeocoderUserAgent}, nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", cfg.Geocoder)
+	}
+}
+
+// distanceKm returns the great-circle distance between two positions
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
@@ -0,0 +1,112 @@
+package geocode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// geonamesLine builds a dataset line with only the columns the reader uses
+func geonamesLine(name, lat, lon, countryCode string) string {
+	columns := make([]string, geonamesColumns)
+	columns[geonamesName], columns[geonamesLatitude], columns[geonamesLongitude], columns[geonamesCountryCode] = name, lat, lon, countryCode
+	return strings.Join(columns, "\t") + "\n"
+}
+
+func TestDistanceKm(t *testing.T) {
+	// Paris to London is about 344km
+	assert.InDelta(t, 344, distanceKm(48.8566, 2.3522, 51.5074, -0.1278), 1)
+	assert.InDelta(t, 0, distanceKm(10, 20, 10, 20), 1e-9)
+}
+
+func TestOfflineReverse(t *testing.T) {
+	dataset := geonamesLine("Paris", "48.85341", "2.3488", "fr") +
+		geonamesLine("Boulogne-Billancourt", "48.83545", "2.24128", "FR") +
+		geonamesLine("Suva", "-18.14161", "178.44149", "FJ") +
+		geonamesLine("Taveuni", "-16.8", "-179.95", "FJ")
+	offline, err := ReadDataset(strings.NewReader("# cities\n" + dataset))
+	require.NoError(t, err)
+
+	place, err := offline.Reverse(context.Background(), 48.84, 2.25)
+	require.NoError(t, err)
+	require.NotNil(t, place)
+	assert.Equal(t, Place{CountryCode: "FR", City: "Boulogne-Billancourt", Name: "Boulogne-Billancourt"}, *place)
+
+	place, err = offline.Reverse(context.Background(), 48.87, 2.36)
+	require.NoError(t, err)
+	require.NotNil(t, place)
+	assert.Equal(t, "Paris", place.City)
+
+	// Across the antimeridian
+	place, err = offline.Reverse(context.Background(), -16.85, 179.95)
+	require.NoError(t, err)
+	require.NotNil(t, place)
+	assert.Equal(t, "Taveuni", place.City)
+
+	// Too far from anything
+	place, err = offline.Reverse(context.Background(), 40, -30)
+	require.NoError(t, err)
+	assert.Nil(t, place)
+
+	offline.MaxDistanceKm = 5
+	place, err = offline.Reverse(context.Background(), 48.9, 2.5)
+	require.NoError(t, err)
+	assert.Nil(t, place)
+}
+
+func TestReadDatasetErrors(t *testing.T) {
+	_, err := ReadDataset(strings.NewReader("Paris\t48.8\t2.3\n"))
+	assert.Error(t, err)
+
+	_, err = ReadDataset(strings.NewReader(geonamesLine("Paris", "north", "2.3", "FR")))
+	assert.Error(t, err)
+}
+
+func TestNominatimReverse(t *testing.T) {
+	var query, userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, userAgent = r.URL.RawQuery, r.UserAgent()
+		if r.URL.Query().Get("lat") == "0" {
+			w.Write([]byte(`{"error":"Unable to geocode"}`))
+			return
+		}
+		w.Write([]byte(`{"name":"Tour Eiffel","address":{"country_code":"fr","city":"Paris","suburb":"Gros-Caillou"}}`))
+	}))
+	defer server.Close()
+
+	nominatim := &Nominatim{URL: server.URL + "/", UserAgent: "test-agent", Interval: time.Millisecond}
+	place, err := nominatim.Reverse(context.Background(), 48.8584, 2.2945)
+	require.NoError(t, err)
+	require.NotNil(t, place)
+	assert.Equal(t, Place{CountryCode: "FR", City: "Paris", Name: "Tour Eiffel"}, *place)
+	assert.Contains(t, query, "lat=48.8584")
+	assert.Contains(t, query, "format=jsonv2")
+	assert.Equal(t, "test-agent", userAgent)
+
+	place, err = nominatim.Reverse(context.Background(), 0, 0)
+	require.NoError(t, err)
+	assert.Nil(t, place)
+}
+
+func TestNominatimErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	nominatim := &Nominatim{URL: server.URL, Interval: time.Hour}
+	_, err := nominatim.Reverse(context.Background(), 48.8584, 2.2945)
+	assert.ErrorContains(t, err, "429")
+
+	// The next request waits out the interval unless cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = nominatim.Reverse(ctx, 48.8584, 2.2945)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
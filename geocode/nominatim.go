@@ -0,0 +1,118 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultNominatimURL is the public OpenStreetMap Nominatim server
+const DefaultNominatimURL = "https://nominatim.openstreetmap.org"
+
+// Nominatim looks places up on a Nominatim server. Requests are spaced at
+// least Interval apart, as the public server's usage policy asks.
+type Nominatim struct {
+	URL       string        // DefaultNominatimURL when empty
+	UserAgent string        // Identifies the application, required by the public server
+	Interval  time.Duration // 1s when 0
+	Client    *http.Client  // http.DefaultClient with a 10s timeout when nil
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// nominatimResponse is the part of a jsonv2 reverse lookup used here
+type nominatimResponse struct {
+	Error   string            `json:"error"`
+	Name    string            `json:"name"`
+	Address map[string]string `json:"address"`
+}
+
+// Reverse implements Provider
+func (n *Nominatim) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	if err := n.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	base := n.URL
+	if base == "" {
+		base = DefaultNominatimURL
+	}
+	query := url.Values{
+		"format":         {"jsonv2"},
+		"lat":            {strconv.FormatFloat(lat, 'f', -1, 64)},
+		"lon":            {strconv.FormatFloat(lon, 'f', -1, 64)},
+		"addressdetails": {"1"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/reverse?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if n.UserAgent != "" {
+		req.Header.Set("User-Agent", n.UserAgent)
+	}
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim returned %s", resp.Status)
+	}
+
+	var result nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid nominatim response: %w", err)
+	}
+	// Positions with nothing there come back as an error message
+	if result.Error != "" || result.Address == nil {
+		return nil, nil
+	}
+
+	place := &Place{CountryCode: strings.ToUpper(result.Address["country_code"])}
+	for _, key := range []string{"city", "town", "village", "hamlet", "municipality"} {
+		if place.City = result.Address[key]; place.City != "" {
+			break
+		}
+	}
+	for _, name := range []string{result.Name, result.Address["neighbourhood"], result.Address["suburb"], place.City} {
+		if place.Name = name; name != "" {
+			break
+		}
+	}
+	return place, nil
+}
+
+// wait blocks until Interval has passed since the previous request
+func (n *Nominatim) wait(ctx context.Context) error {
+	interval := n.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if delay := time.Until(n.last.Add(interval)); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	n.last = time.Now()
+	return nil
+}
@@ -0,0 +1,140 @@
+package geocode
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDistanceKm is how far a position may be from the nearest
+// populated place in the dataset and still be named after it
+const DefaultMaxDistanceKm = 30.0
+
+// GeoNames table columns used by the offline dataset
+const (
+	geonamesName        = 1
+	geonamesLatitude    = 4
+	geonamesLongitude   = 5
+	geonamesCountryCode = 8
+	geonamesColumns     = 19
+)
+
+// Offline looks up the nearest populated place in a GeoNames cities dataset
+// (cities500.txt, cities1000.txt, cities15000.txt and so on from
+// https://download.geonames.org/export/dump/) held in memory
+type Offline struct {
+	MaxDistanceKm float64 // DefaultMaxDistanceKm when 0
+
+	cells map[[2]int][]datasetPlace // Places bucketed by whole degrees
+}
+
+// datasetPlace is a populated place from the dataset
+type datasetPlace struct {
+	name        string
+	countryCode string
+	lat, lon    float64
+}
+
+// LoadDataset reads a GeoNames cities file
+func LoadDataset(path string) (*Offline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	o, err := ReadDataset(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return o, nil
+}
+
+// ReadDataset reads a GeoNames cities table: tab-separated, one place per
+// line, with the name, latitude, longitude and country code in the
+// standard columns
+func ReadDataset(r io.Reader) (*Offline, error) {
+	o := &Offline{cells: map[[2]int][]datasetPlace{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Alternate names make for long lines
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" || strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < geonamesColumns {
+			return nil, fmt.Errorf("line %d: expected %d columns, got %d", line, geonamesColumns, len(fields))
+		}
+
+		lat, latErr := strconv.ParseFloat(fields[geonamesLatitude], 64)
+		lon, lonErr := strconv.ParseFloat(fields[geonamesLongitude], 64)
+		if latErr != nil || lonErr != nil {
+			return nil, fmt.Errorf("line %d: invalid coordinates", line)
+		}
+
+		place := datasetPlace{
+			name:        fields[geonamesName],
+			countryCode: strings.ToUpper(fields[geonamesCountryCode]),
+			lat:         lat,
+			lon:         lon,
+		}
+		cell := cellOf(lat, lon)
+		o.cells[cell] = append(o.cells[cell], place)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Reverse implements Provider. Populated places are all the dataset knows,
+// so the city and the place name are the same.
+func (o *Offline) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	maxDistance := o.MaxDistanceKm
+	if maxDistance <= 0 {
+		maxDistance = DefaultMaxDistanceKm
+	}
+
+	// Enough cells around the position's own to cover maxDistance, which
+	// takes more cells of longitude away from the equator
+	latCells := int(math.Ceil(maxDistance / 111.0))
+	lonCells := 180
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+		lonCells = int(math.Min(180, math.Ceil(maxDistance/(111.0*cos))))
+	}
+
+	var nearest *datasetPlace
+	nearestDistance := maxDistance
+	center := cellOf(lat, lon)
+	for dLat := -latCells; dLat <= latCells; dLat++ {
+		for dLon := -lonCells; dLon <= lonCells; dLon++ {
+			cell := [2]int{center[0] + dLat, wrapCell(center[1] + dLon)}
+			for i, place := range o.cells[cell] {
+				if d := distanceKm(lat, lon, place.lat, place.lon); d <= nearestDistance {
+					nearest, nearestDistance = &o.cells[cell][i], d
+				}
+			}
+		}
+	}
+
+	if nearest == nil {
+		return nil, nil
+	}
+	return &Place{CountryCode: nearest.countryCode, City: nearest.name, Name: nearest.name}, nil
+}
+
+// cellOf returns the whole-degree cell holding a position
+func cellOf(lat, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat)), wrapCell(int(math.Floor(lon)))}
+}
+
+// wrapCell keeps a longitude cell within -180..179
+func wrapCell(lon int) int {
+	return ((lon+180)%360+360)%360 - 180
+}
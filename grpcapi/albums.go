@@ -0,0 +1,97 @@
+package grpcapi
+
+import (
+	"context"
+	"net/http"
+	photosv1 "photo-library-server/proto/photos/v1"
+	"strconv"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// albumService serves AlbumService from /api/v1/albums
+type albumService struct {
+	photosv1.UnimplementedAlbumServiceServer
+	api *api
+}
+
+func (s *albumService) CreateAlbum(ctx context.Context, req *photosv1.CreateAlbumRequest) (*photosv1.Album, error) {
+	body := map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+		"library_id":  req.LibraryId,
+	}
+	album := &photosv1.Album{}
+	return album, s.api.call(ctx, http.MethodPost, "/albums", body, album)
+}
+
+func (s *albumService) ListAlbums(ctx context.Context, req *photosv1.ListAlbumsRequest) (*photosv1.ListAlbumsResponse, error) {
+	path := "/albums" + query(map[string]string{"library_id": req.LibraryId, "tag": req.Tag})
+	response := &photosv1.ListAlbumsResponse{}
+	return response, s.api.list(ctx, path, response, "albums")
+}
+
+func (s *albumService) GetAlbum(ctx context.Context, req *photosv1.GetAlbumRequest) (*photosv1.Album, error) {
+	path := "/albums" + segment(req.Id) + query(map[string]string{
+		"include_photos": flag(req.IncludePhotos),
+		"include_tags":   flag(req.IncludeTags),
+	})
+	album := &photosv1.Album{}
+	return album, s.api.call(ctx, http.MethodGet, path, nil, album)
+}
+
+func (s *albumService) UpdateAlbum(ctx context.Context, req *photosv1.UpdateAlbumRequest) (*photosv1.Album, error) {
+	body := map[string]interface{}{}
+	if req.Name != nil {
+		body["name"] = *req.Name
+	}
+	if req.Description != nil {
+		body["description"] = *req.Description
+	}
+	album := &photosv1.Album{}
+	return album, s.api.call(ctx, http.MethodPut, "/albums"+segment(req.Id), body, album)
+}
+
+func (s *albumService) DeleteAlbum(ctx context.Context, req *photosv1.DeleteAlbumRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, s.api.call(ctx, http.MethodDelete, "/albums"+segment(req.Id), nil, nil)
+}
+
+func (s *albumService) ListAlbumPhotos(ctx context.Context, req *photosv1.ListAlbumPhotosRequest) (*photosv1.ListPhotosResponse, error) {
+	path := "/albums" + segment(req.AlbumId) + "/photos" + query(map[string]string{
+		"page":  number(req.Page),
+		"limit": number(req.Limit),
+	})
+	response := &photosv1.ListPhotosResponse{}
+	return response, s.api.call(ctx, http.MethodGet, path, nil, response)
+}
+
+func (s *albumService) AddAlbumPhotos(ctx context.Context, req *photosv1.AddAlbumPhotosRequest) (*photosv1.AddAlbumPhotosResponse, error) {
+	body := map[string]interface{}{"photo_ids": req.PhotoIds}
+	if req.StartPosition != nil {
+		body["start_position"] = *req.StartPosition
+	}
+	response := &photosv1.AddAlbumPhotosResponse{}
+	return response, s.api.call(ctx, http.MethodPost, "/albums"+segment(req.AlbumId)+"/photos", body, response)
+}
+
+func (s *albumService) RemoveAlbumPhotos(ctx context.Context, req *photosv1.RemoveAlbumPhotosRequest) (*photosv1.RemoveAlbumPhotosResponse, error) {
+	body := map[string]interface{}{"photo_ids": req.PhotoIds}
+	response := &photosv1.RemoveAlbumPhotosResponse{}
+	return response, s.api.call(ctx, http.MethodPost, "/albums"+segment(req.AlbumId)+"/photos/remove", body, response)
+}
+
+// flag encodes a boolean query parameter, left out when false
+func flag(value bool) string {
+	if !value {
+		return ""
+	}
+	return "true"
+}
+
+// number encodes a numeric query parameter, left out when 0
+func number(value int32) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(value))
+}
@@ -0,0 +1,96 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	photosv1 "photo-library-server/proto/photos/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// libraryService serves LibraryService from /api/v1/libraries
+type libraryService struct {
+	photosv1.UnimplementedLibraryServiceServer
+	api *api
+}
+
+func (s *libraryService) CreateLibrary(ctx context.Context, req *photosv1.CreateLibraryRequest) (*photosv1.Library, error) {
+	body := map[string]interface{}{
+		"name":             req.Name,
+		"description":      req.Description,
+		"images":           req.Images,
+		"import_keywords":  req.ImportKeywords,
+		"thumbnail_mode":   req.ThumbnailMode,
+		"accept_documents": req.AcceptDocuments,
+		"encrypted":        req.Encrypted,
+		"watch":            req.Watch,
+		"read_only":        req.ReadOnly,
+		"quota_bytes":      req.QuotaBytes,
+	}
+	library := &photosv1.Library{}
+	return library, s.api.call(ctx, http.MethodPost, "/libraries", body, library)
+}
+
+func (s *libraryService) ListLibraries(ctx context.Context, req *photosv1.ListLibrariesRequest) (*photosv1.ListLibrariesResponse, error) {
+	response := &photosv1.ListLibrariesResponse{}
+	return response, s.api.list(ctx, "/libraries", response, "libraries")
+}
+
+func (s *libraryService) GetLibrary(ctx context.Context, req *photosv1.GetLibraryRequest) (*photosv1.Library, error) {
+	library := &photosv1.Library{}
+	return library, s.api.call(ctx, http.MethodGet, "/libraries"+segment(req.Id), nil, library)
+}
+
+func (s *libraryService) UpdateLibrary(ctx context.Context, req *photosv1.UpdateLibraryRequest) (*photosv1.Library, error) {
+	body := map[string]interface{}{}
+	if req.Name != nil {
+		body["name"] = *req.Name
+	}
+	if req.Description != nil {
+		body["description"] = *req.Description
+	}
+	if req.Images != nil {
+		body["images"] = *req.Images
+	}
+	if req.ImportKeywords != nil {
+		body["import_keywords"] = *req.ImportKeywords
+	}
+	if req.ThumbnailMode != nil {
+		body["thumbnail_mode"] = *req.ThumbnailMode
+	}
+	if req.AcceptDocuments != nil {
+		body["accept_documents"] = *req.AcceptDocuments
+	}
+	if req.Watch != nil {
+		body["watch"] = *req.Watch
+	}
+	if req.ReadOnly != nil {
+		body["read_only"] = *req.ReadOnly
+	}
+	if req.QuotaBytes != nil {
+		body["quota_bytes"] = *req.QuotaBytes
+	}
+	data, code, err := s.api.do(ctx, http.MethodPut, "/libraries"+segment(req.Id), body)
+	if err != nil {
+		return nil, err
+	}
+	if code == http.StatusAccepted {
+		// Moving the files runs as a job, the response has the library and the job
+		var response struct {
+			Library json.RawMessage `json:"library"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to decode response: %v", err)
+		}
+		data = response.Library
+	}
+	library := &photosv1.Library{}
+	return library, decode(data, library)
+}
+
+func (s *libraryService) DeleteLibrary(ctx context.Context, req *photosv1.DeleteLibraryRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, s.api.call(ctx, http.MethodDelete, "/libraries"+segment(req.Id), nil, nil)
+}
@@ -0,0 +1,190 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	photosv1 "photo-library-server/proto/photos/v1"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// photoService serves PhotoService from /api/v1/photos
+type photoService struct {
+	photosv1.UnimplementedPhotoServiceServer
+	api *api
+}
+
+// UploadPhoto streams the file into an upload request as its chunks arrive,
+// so it's never held in memory whole
+func (s *photoService) UploadPhoto(stream photosv1.PhotoService_UploadPhotoServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "upload has no info message")
+	}
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return status.Error(codes.InvalidArgument, "the first message of an upload must be its info")
+	}
+	if info.Filename == "" {
+		return status.Error(codes.InvalidArgument, "filename is required")
+	}
+
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	streamed := make(chan error, 1)
+	go func() {
+		err := writeUploadForm(stream, form, info)
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+		streamed <- err
+	}()
+
+	data, _, err := s.api.send(stream.Context(), http.MethodPost, "/photos/upload", form.FormDataContentType(), reader)
+	// The request may have failed before reading the whole body
+	reader.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		// A broken stream explains the failure better than the request's
+		// error, but the writer may still be waiting for the next chunk
+		select {
+		case streamErr := <-streamed:
+			if streamErr != nil && streamErr != io.ErrClosedPipe {
+				return streamErr
+			}
+		default:
+		}
+		return err
+	}
+	if err := <-streamed; err != nil {
+		return err
+	}
+	photo := &photosv1.Photo{}
+	if err := decode(data, photo); err != nil {
+		return err
+	}
+	return stream.SendAndClose(photo)
+}
+
+// quoteEscaper escapes a filename in a Content-Disposition header
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// writeUploadForm writes the upload's fields, then its file from the
+// stream's chunks
+func writeUploadForm(stream photosv1.PhotoService_UploadPhotoServer, form *multipart.Writer, info *photosv1.UploadPhotoInfo) error {
+	fields := map[string]string{
+		"library_id": info.LibraryId,
+		"tags":       strings.Join(info.Tags, ","),
+		"dedupe":     info.Dedupe,
+	}
+	if info.Rating != nil {
+		fields["rating"] = strconv.Itoa(int(*info.Rating))
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(info.Filename)))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="photo"; filename="`+quoteEscaper.Replace(info.Filename)+`"`)
+	header.Set("Content-Type", contentType)
+	file, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if message.GetInfo() != nil {
+			return status.Error(codes.InvalidArgument, "an upload has only one info message")
+		}
+		if _, err := file.Write(message.GetChunk()); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *photoService) ListPhotos(ctx context.Context, req *photosv1.ListPhotosRequest) (*photosv1.ListPhotosResponse, error) {
+	params := map[string]string{
+		"library_id":   req.LibraryId,
+		"tag":          req.Tag,
+		"q":            req.Q,
+		"page":         number(req.Page),
+		"limit":        number(req.Limit),
+		"cursor":       req.Cursor,
+		"include_tags": flag(req.IncludeTags),
+	}
+	if req.Favorite != nil {
+		params["favorite"] = strconv.FormatBool(*req.Favorite)
+	}
+	if req.Rating != nil {
+		params["rating"] = strconv.Itoa(int(*req.Rating))
+	}
+	response := &photosv1.ListPhotosResponse{}
+	return response, s.api.call(ctx, http.MethodGet, "/photos"+query(params), nil, response)
+}
+
+func (s *photoService) GetPhoto(ctx context.Context, req *photosv1.GetPhotoRequest) (*photosv1.Photo, error) {
+	path := "/photos" + segment(req.Id) + query(map[string]string{"include_tags": flag(req.IncludeTags)})
+	photo := &photosv1.Photo{}
+	return photo, s.api.call(ctx, http.MethodGet, path, nil, photo)
+}
+
+func (s *photoService) UpdatePhoto(ctx context.Context, req *photosv1.UpdatePhotoRequest) (*photosv1.Photo, error) {
+	body := map[string]interface{}{}
+	if req.Rating != nil {
+		body["rating"] = *req.Rating
+	}
+	if req.Favorite != nil {
+		body["favorite"] = *req.Favorite
+	}
+	if req.Title != nil {
+		body["title"] = *req.Title
+	}
+	if req.Caption != nil {
+		body["caption"] = *req.Caption
+	}
+	if req.Description != nil {
+		body["description"] = *req.Description
+	}
+	if req.Latitude != nil {
+		body["latitude"] = *req.Latitude
+	}
+	if req.Longitude != nil {
+		body["longitude"] = *req.Longitude
+	}
+	photo := &photosv1.Photo{}
+	return photo, s.api.call(ctx, http.MethodPut, "/photos"+segment(req.Id), body, photo)
+}
+
+func (s *photoService) DeletePhoto(ctx context.Context, req *photosv1.DeletePhotoRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, s.api.call(ctx, http.MethodDelete, "/photos"+segment(req.Id), nil, nil)
+}
@@ -0,0 +1,216 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	photosv1 "photo-library-server/proto/photos/v1"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// apiPrefix is where the REST API the services call into is served
+const apiPrefix = "/api/v1"
+
+// NewServer creates a gRPC server for the services in photos.proto. Each
+// call runs as a request to the REST API on router, in-process, so it gets
+// the same validation, API key scopes and tenant scoping. Metadata such as
+// x-api-key is passed on as request headers. With tlsConfig the server only
+// accepts TLS connections.
+func NewServer(router http.Handler, tlsConfig *tls.Config) *grpc.Server {
+	var options []grpc.ServerOption
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+
+	api := &api{router: router}
+	photosv1.RegisterLibraryServiceServer(server, &libraryService{api: api})
+	photosv1.RegisterAlbumServiceServer(server, &albumService{api: api})
+	photosv1.RegisterPhotoServiceServer(server, &photoService{api: api})
+	photosv1.RegisterTagServiceServer(server, &tagService{api: api})
+	reflection.Register(server) // Lets tools such as grpcurl list the services
+	return server
+}
+
+// api makes requests to the REST API
+type api struct {
+	router http.Handler
+}
+
+// call sends a JSON body, nil for none, to the REST API and decodes the
+// response into out, nil to ignore it
+func (a *api) call(ctx context.Context, method, path string, body map[string]interface{}, out proto.Message) error {
+	data, _, err := a.do(ctx, method, path, body)
+	if err != nil || out == nil {
+		return err
+	}
+	return decode(data, out)
+}
+
+// list gets a REST API list, a JSON array, into the field of out
+func (a *api) list(ctx context.Context, path string, out proto.Message, field string) error {
+	data, _, err := a.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	data, _ = json.Marshal(map[string]json.RawMessage{field: data})
+	return decode(data, out)
+}
+
+// do sends a JSON body, nil for none, to the REST API and returns the
+// response. Error responses are returned as gRPC statuses.
+func (a *api) do(ctx context.Context, method, path string, body map[string]interface{}) ([]byte, int, error) {
+	if body == nil {
+		return a.send(ctx, method, path, "", nil)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, 0, status.Errorf(codes.Internal, "failed to encode request: %v", err)
+	}
+	return a.send(ctx, method, path, "application/json", bytes.NewReader(data))
+}
+
+// send makes a request to the REST API with any body, like do
+func (a *api) send(ctx context.Context, method, path, contentType string, body io.Reader) ([]byte, int, error) {
+	r, err := http.NewRequestWithContext(ctx, method, apiPrefix+path, body)
+	if err != nil {
+		return nil, 0, status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", contentType)
+	}
+	forwardMetadata(ctx, r)
+
+	w := &responseWriter{header: http.Header{}, status: http.StatusOK}
+	a.router.ServeHTTP(w, r)
+
+	if w.status >= http.StatusBadRequest {
+		return nil, w.status, statusError(w.status, w.body.Bytes())
+	}
+	return w.body.Bytes(), w.status, nil
+}
+
+// decode reads a REST API response into a message, skipping fields the
+// message doesn't have
+func decode(data []byte, out proto.Message) error {
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, out); err != nil {
+		return status.Errorf(codes.Internal, "failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// forwardMetadata passes the call's metadata on as request headers, and its
+// authority as the host, for API keys and tenants
+func forwardMetadata(ctx context.Context, r *http.Request) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return
+	}
+	for key, values := range md {
+		switch {
+		case key == ":authority":
+			if len(values) > 0 {
+				r.Host = values[0]
+			}
+		case strings.HasPrefix(key, ":"), strings.HasPrefix(key, "grpc-"), strings.HasSuffix(key, "-bin"),
+			key == "content-type", key == "te":
+			// Transport details of the gRPC call itself
+		default:
+			for _, value := range values {
+				r.Header.Add(key, value)
+			}
+		}
+	}
+}
+
+// httpCodes maps REST API statuses to gRPC codes
+var httpCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.AlreadyExists,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusUnsupportedMediaType:  codes.InvalidArgument,
+	http.StatusUnprocessableEntity:   codes.FailedPrecondition,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusInsufficientStorage:   codes.ResourceExhausted,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+	http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+}
+
+// errorDomain is the domain of the ErrorInfo details of failed calls
+const errorDomain = "photos.v1"
+
+// statusError turns an error response of the REST API into a gRPC status
+// with the same message, and its code as the reason of an ErrorInfo detail
+func statusError(httpStatus int, body []byte) error {
+	code, ok := httpCodes[httpStatus]
+	if !ok {
+		code = codes.Internal
+		if httpStatus < http.StatusInternalServerError {
+			code = codes.Unknown
+		}
+	}
+
+	var response struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	message := http.StatusText(httpStatus)
+	if json.Unmarshal(body, &response) == nil && response.Error != "" {
+		message = response.Error
+	}
+
+	st := status.New(code, message)
+	if response.Code != "" {
+		if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: response.Code, Domain: errorDomain}); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// responseWriter records a REST API response
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header         { return w.header }
+func (w *responseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *responseWriter) WriteHeader(status int)      { w.status = status }
+
+// query encodes the set parameters of a list request
+func query(params map[string]string) string {
+	values := url.Values{}
+	for key, value := range params {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// segment escapes an ID for use in a request path
+func segment(id string) string {
+	return "/" + url.PathEscape(id)
+}
@@ -0,0 +1,61 @@
+package grpcapi
+
+import (
+	"context"
+	"net/http"
+	photosv1 "photo-library-server/proto/photos/v1"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// tagService serves TagService from /api/v1/tags
+type tagService struct {
+	photosv1.UnimplementedTagServiceServer
+	api *api
+}
+
+func (s *tagService) CreateTag(ctx context.Context, req *photosv1.CreateTagRequest) (*photosv1.Tag, error) {
+	body := map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+		"color":       req.Color,
+	}
+	tag := &photosv1.Tag{}
+	return tag, s.api.call(ctx, http.MethodPost, "/tags", body, tag)
+}
+
+func (s *tagService) ListTags(ctx context.Context, req *photosv1.ListTagsRequest) (*photosv1.ListTagsResponse, error) {
+	response := &photosv1.ListTagsResponse{}
+	return response, s.api.list(ctx, "/tags", response, "tags")
+}
+
+func (s *tagService) GetTag(ctx context.Context, req *photosv1.GetTagRequest) (*photosv1.Tag, error) {
+	tag := &photosv1.Tag{}
+	return tag, s.api.call(ctx, http.MethodGet, "/tags"+segment(req.Id), nil, tag)
+}
+
+func (s *tagService) UpdateTag(ctx context.Context, req *photosv1.UpdateTagRequest) (*photosv1.Tag, error) {
+	body := map[string]interface{}{
+		"name":  req.Name,
+		"color": req.Color,
+	}
+	if req.Description != nil {
+		body["description"] = *req.Description
+	}
+	tag := &photosv1.Tag{}
+	return tag, s.api.call(ctx, http.MethodPut, "/tags"+segment(req.Id), body, tag)
+}
+
+func (s *tagService) DeleteTag(ctx context.Context, req *photosv1.DeleteTagRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, s.api.call(ctx, http.MethodDelete, "/tags"+segment(req.Id), nil, nil)
+}
+
+func (s *tagService) TagPhoto(ctx context.Context, req *photosv1.TagPhotoRequest) (*emptypb.Empty, error) {
+	body := map[string]interface{}{"photo_id": req.PhotoId}
+	return &emptypb.Empty{}, s.api.call(ctx, http.MethodPost, "/tags"+segment(req.TagId)+"/photos", body, nil)
+}
+
+func (s *tagService) UntagPhoto(ctx context.Context, req *photosv1.TagPhotoRequest) (*emptypb.Empty, error) {
+	path := "/tags" + segment(req.TagId) + "/photos" + segment(req.PhotoId)
+	return &emptypb.Empty{}, s.api.call(ctx, http.MethodDelete, path, nil, nil)
+}
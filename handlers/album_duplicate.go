@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxDuplicatedAlbumCopies is the most photos duplicating an album into
+// another library copies, since every file is copied within the request
+const maxDuplicatedAlbumCopies = 1000
+
+// duplicateAlbumRequest is the optional JSON body of DuplicateAlbum
+type duplicateAlbumRequest struct {
+	Name      string     `json:"name" binding:"omitempty,max=100"` // Defaults to the album's name followed by " (copy)"
+	LibraryID *uuid.UUID `json:"library_id"`                       // Library for the new album, the album's own by default
+}
+
+// DuplicateAlbum creates a new album with the same photos in the same order,
+// along with the album's description, sort mode, tags and cover. An album
+// duplicated into another library gets copies of the photos there, made in
+// one transaction whose files are removed again if any copy fails. Photos
+// in the trash are left out.
+func (h *AlbumHandler) DuplicateAlbum(c *gin.Context) {
+	albumID := c.Param("id")
+
+	id, err := uuid.Parse(albumID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return
+	}
+
+	var req duplicateAlbumRequest
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+			respondValidationError(c, err)
+			return
+		}
+	}
+
+	var album models.Album
+	if err := scopedDB(c, h.db).Preload("Tags").First(&album, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return
+	}
+
+	var targetLibrary models.Library
+	targetLibraryID := album.LibraryID
+	if req.LibraryID != nil {
+		targetLibraryID = *req.LibraryID
+	}
+	if err := scopedDB(c, h.db).First(&targetLibrary, targetLibraryID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "target_library_not_found", "Target library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify target library")
+		return
+	}
+	copying := targetLibrary.ID != album.LibraryID
+
+	var members []models.AlbumPhoto
+	if err := scopedDB(c, h.db).Where("album_id = ?", album.ID).
+		Order(`"order"`).Order("photo_id").
+		Find(&members).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos")
+		return
+	}
+	photoIDs := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		photoIDs = append(photoIDs, member.PhotoID)
+	}
+
+	// Copies need the tags of the photos they are made from
+	photoQuery := scopedDB(c, h.db)
+	if copying {
+		photoQuery = photoQuery.Preload("Tags")
+	}
+	var photos []models.Photo
+	if len(photoIDs) > 0 {
+		if err := photoQuery.Where("id IN ?", photoIDs).Find(&photos).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos")
+			return
+		}
+	}
+	if copying && len(photos) > maxDuplicatedAlbumCopies {
+		apierror.Respond(c, http.StatusBadRequest, "album_too_large", "Albums with more than 1000 photos can't be duplicated into another library")
+		return
+	}
+	live := make(map[uuid.UUID]*models.Photo, len(photos))
+	for i := range photos {
+		live[photos[i].ID] = &photos[i]
+	}
+
+	name := req.Name
+	if name == "" {
+		name = album.Name + " (copy)"
+	}
+	duplicate := models.Album{
+		Name:        name,
+		Description: album.Description,
+		LibraryID:   targetLibrary.ID,
+		SortMode:    album.SortMode,
+	}
+
+	photoHandler := NewPhotoHandler(h.db, h.config, nil)
+	var copies []*photoCopy
+	err = scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&duplicate).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to create album"}
+		}
+
+		// Members keep their order values, so ties sort as they did
+		newIDs := make(map[uuid.UUID]uuid.UUID, len(live))
+		var albumPhotos []models.AlbumPhoto
+		for _, member := range members {
+			photo, ok := live[member.PhotoID]
+			if !ok {
+				continue // In the trash
+			}
+			newID := photo.ID
+			if copying {
+				photoCopy, err := photoHandler.startCopy(tx, photo, &targetLibrary)
+				if err != nil {
+					return err
+				}
+				copies = append(copies, photoCopy)
+				if err := photoCopy.record(tx); err != nil {
+					return err
+				}
+				newID = photoCopy.newPhoto.ID
+			}
+			newIDs[photo.ID] = newID
+			albumPhotos = append(albumPhotos, models.AlbumPhoto{AlbumID: duplicate.ID, PhotoID: newID, Order: member.Order})
+		}
+		if len(albumPhotos) > 0 {
+			if err := tx.CreateInBatches(&albumPhotos, 500).Error; err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to add photos to album"}
+			}
+		}
+
+		for _, tag := range album.Tags {
+			if err := tx.Create(&models.AlbumTag{AlbumID: duplicate.ID, TagID: tag.ID}).Error; err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to copy album tags"}
+			}
+		}
+
+		// A cover in the trash is left unset, as the first photo stands in
+		if album.CoverPhotoID != nil {
+			if coverID, ok := newIDs[*album.CoverPhotoID]; ok {
+				if err := tx.Model(&duplicate).UpdateColumn("cover_photo_id", coverID).Error; err != nil {
+					return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to set album cover"}
+				}
+			}
+		}
+		if err := updateAlbumDateRanges(tx, []uuid.UUID{duplicate.ID}); err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album dates"}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, photoCopy := range copies {
+			photoCopy.undo()
+		}
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	for _, photoCopy := range copies {
+		photoHandler.prepareThumbnails(&photoCopy.newPhoto, &targetLibrary)
+	}
+
+	// Load the new album with its library and tags for the response
+	scopedDB(c, h.db).Preload("Library").Preload("Tags").First(&duplicate, duplicate.ID)
+	albums := []models.Album{duplicate}
+	if err := loadAlbumCovers(scopedDB(c, h.db), albums); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to load album cover")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Album duplicated successfully",
+		"original_id":   album.ID,
+		"album":         albums[0],
+		"copied_photos": len(copies),
+	})
+}
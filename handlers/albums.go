@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
 	"photo-library-server/models"
+	"photo-library-server/repository"
+	"sort"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -11,35 +17,60 @@ import (
 
 // AlbumHandler handles album-related HTTP requests
 type AlbumHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	albums    repository.AlbumRepo
+	libraries repository.LibraryRepo
+	config    *config.Config
 }
 
 // NewAlbumHandler creates a new album handler
-func NewAlbumHandler(db *gorm.DB) *AlbumHandler {
-	return &AlbumHandler{db: db}
+func NewAlbumHandler(db *gorm.DB, cfg *config.Config) *AlbumHandler {
+	return &AlbumHandler{db: db, albums: repository.NewAlbumRepo(db), libraries: repository.NewLibraryRepo(db), config: cfg}
+}
+
+// albumSortOrders are the album sort modes and the ORDER BY clauses of
+// queries joined with album_photos they stand for. Photos without a capture
+// date or rating come last, and ties keep the manual order.
+var albumSortOrders = map[string]string{
+	"manual":      `album_photos."order"`,
+	"uploaded_at": `photos.uploaded_at, album_photos."order"`,
+	"taken_at":    `photos.taken_at IS NULL, photos.taken_at, album_photos."order"`,
+	"filename":    `photos.original_name, album_photos."order"`,
+	"rating":      `photos.rating IS NULL, photos.rating DESC, album_photos."order"`,
+}
+
+// albumSortOrder returns the ORDER BY clause of an album's sort mode
+func albumSortOrder(album models.Album) string {
+	if order, ok := albumSortOrders[album.SortMode]; ok {
+		return order
+	}
+	return albumSortOrders["manual"]
+}
+
+// createAlbumRequest is the JSON body of CreateAlbum
+type createAlbumRequest struct {
+	Name        string    `json:"name" binding:"required,min=1,max=100"`
+	Description string    `json:"description" binding:"max=500"`
+	LibraryID   uuid.UUID `json:"library_id" binding:"required"`
+	SortMode    string    `json:"sort_mode" binding:"omitempty,oneof=manual uploaded_at taken_at filename rating"` // manual by default
 }
 
 // CreateAlbum creates a new album
 func (h *AlbumHandler) CreateAlbum(c *gin.Context) {
-	var req struct {
-		Name        string    `json:"name" binding:"required,min=1,max=100"`
-		Description string    `json:"description" binding:"max=500"`
-		LibraryID   uuid.UUID `json:"library_id" binding:"required"`
-	}
+	var req createAlbumRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
 		return
 	}
 
 	// Verify library exists
-	var library models.Library
-	if err := h.db.First(&library, req.LibraryID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Library not found"})
+	if _, err := h.libraries.Get(c.Request.Context(), req.LibraryID, repository.LibraryRelations{}); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify library")
 		return
 	}
 
@@ -47,45 +78,61 @@ func (h *AlbumHandler) CreateAlbum(c *gin.Context) {
 		Name:        req.Name,
 		Description: req.Description,
 		LibraryID:   req.LibraryID,
+		SortMode:    req.SortMode,
+	}
+	if album.SortMode == "" {
+		album.SortMode = "manual"
 	}
 
-	if err := h.db.Create(&album).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create album"})
+	if err := h.albums.Create(c.Request.Context(), &album); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create album")
 		return
 	}
 
 	// Load the library for response
-	h.db.Preload("Library").First(&album, album.ID)
+	if created, err := h.albums.Get(c.Request.Context(), album.ID, repository.AlbumRelations{Library: true}); err == nil {
+		album = *created
+	}
 
 	c.JSON(http.StatusCreated, album)
 }
 
-// GetAlbums returns albums, optionally filtered by library
+// GetAlbums returns albums, optionally filtered by library or tag
 func (h *AlbumHandler) GetAlbums(c *gin.Context) {
-	var albums []models.Album
-
-	query := h.db.Model(&models.Album{})
+	var filter repository.AlbumFilter
 
 	// Filter by library if specified
 	if libraryID := c.Query("library_id"); libraryID != "" {
 		id, err := uuid.Parse(libraryID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library ID"})
+			apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
 			return
 		}
-		query = query.Where("library_id = ?", id)
+		filter.LibraryID = id
+	}
+
+	// Filter by tag if specified
+	if tagName := c.Query("tag"); tagName != "" {
+		filter.Tag = tagNamePolicy(h.config).Normalize(tagName)
 	}
 
 	// Optional: include related data
-	if c.Query("include_library") == "true" {
-		query = query.Preload("Library")
+	albums, err := h.albums.List(c.Request.Context(), filter, repository.AlbumRelations{
+		Library: c.Query("include_library") == "true",
+		Photos:  c.Query("include_photos") == "true",
+		Tags:    c.Query("include_tags") == "true",
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch albums")
+		return
 	}
-	if c.Query("include_photos") == "true" {
-		query = query.Preload("Photos")
+	if err := sortAlbumPhotos(scopedDB(c, h.db), albums); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch albums")
+		return
 	}
 
-	if err := query.Find(&albums).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch albums"})
+	if err := loadAlbumCovers(scopedDB(c, h.db), albums); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album covers")
 		return
 	}
 
@@ -98,31 +145,114 @@ func (h *AlbumHandler) GetAlbum(c *gin.Context) {
 
 	id, err := uuid.Parse(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
 		return
 	}
 
-	var album models.Album
-	query := h.db.Model(&models.Album{})
-
 	// Optional: include related data
-	if c.Query("include_library") == "true" {
-		query = query.Preload("Library")
+	album, err := h.albums.Get(c.Request.Context(), id, repository.AlbumRelations{
+		Library:   c.Query("include_library") == "true",
+		Photos:    c.Query("include_photos") == "true",
+		PhotoTags: true,
+		Tags:      c.Query("include_tags") == "true",
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return
+	}
+
+	albums := []models.Album{*album}
+	if err := sortAlbumPhotos(scopedDB(c, h.db), albums); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return
 	}
-	if c.Query("include_photos") == "true" {
-		query = query.Preload("Photos").Preload("Photos.Tags")
+	if err := loadAlbumCovers(scopedDB(c, h.db), albums); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album cover")
+		return
 	}
 
-	if err := query.First(&album, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+	c.JSON(http.StatusOK, albums[0])
+}
+
+// GetAlbumPhotos returns a page of an album's photos, in the album's sort
+// mode unless order names another sort mode or order_by or order_dir ask
+// for a photo field
+func (h *AlbumHandler) GetAlbumPhotos(c *gin.Context) {
+	albumID := c.Param("id")
+
+	id, err := uuid.Parse(albumID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return
+	}
+
+	album, err := h.albums.Get(c.Request.Context(), id, repository.AlbumRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch album"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
 		return
 	}
 
-	c.JSON(http.StatusOK, album)
+	inAlbum := func() *gorm.DB {
+		return scopedDB(c, h.db).Model(&models.Photo{}).
+			Joins("JOIN album_photos ON album_photos.photo_id = photos.id").
+			Where("album_photos.album_id = ?", album.ID)
+	}
+
+	columns := map[string]string{"order": `album_photos."order"`}
+	for field, column := range photoOrderColumns {
+		columns[field] = column
+	}
+
+	order := albumSortOrder(*album)
+	if mode := c.Query("order"); mode != "" {
+		var ok bool
+		if order, ok = albumSortOrders[mode]; !ok {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "order must be manual, uploaded_at, taken_at, filename or rating")
+			return
+		}
+	}
+	if c.Query("order_by") != "" || c.Query("order_dir") != "" {
+		order = listOrder(c, columns, "order", "asc")
+	}
+
+	page, limit := pagination(c)
+	photos := []models.Photo{}
+	query := preloadPhotoRelations(c, inAlbum()).
+		Order(order).
+		Order("photos.id"). // Stable pages for photos with the same order
+		Offset((page - 1) * limit).
+		Limit(limit)
+	if err := query.Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos")
+		return
+	}
+
+	var total int64
+	inAlbum().Count(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"photos": photos,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// updateAlbumRequest is the JSON body of UpdateAlbum
+type updateAlbumRequest struct {
+	Name        *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description,omitempty" binding:"omitempty,max=500"`
+	SortMode    *string `json:"sort_mode,omitempty" binding:"omitempty,oneof=manual uploaded_at taken_at filename rating"`
 }
 
 // UpdateAlbum updates an album
@@ -131,27 +261,24 @@ func (h *AlbumHandler) UpdateAlbum(c *gin.Context) {
 
 	id, err := uuid.Parse(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
 		return
 	}
 
-	var req struct {
-		Name        *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
-		Description *string `json:"description,omitempty" binding:"omitempty,max=500"`
-	}
+	var req updateAlbumRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
 		return
 	}
 
-	var album models.Album
-	if err := h.db.First(&album, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+	album, err := h.albums.Get(c.Request.Context(), id, repository.AlbumRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch album"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
 		return
 	}
 
@@ -162,9 +289,12 @@ func (h *AlbumHandler) UpdateAlbum(c *gin.Context) {
 	if req.Description != nil {
 		album.Description = *req.Description
 	}
+	if req.SortMode != nil {
+		album.SortMode = *req.SortMode
+	}
 
-	if err := h.db.Save(&album).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update album"})
+	if err := h.albums.Save(c.Request.Context(), album); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album")
 		return
 	}
 
@@ -177,97 +307,95 @@ func (h *AlbumHandler) DeleteAlbum(c *gin.Context) {
 
 	id, err := uuid.Parse(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
 		return
 	}
 
-	var album models.Album
-	if err := h.db.First(&album, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+	album, err := h.albums.Get(c.Request.Context(), id, repository.AlbumRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch album"})
-		return
-	}
-
-	// Use transaction to clean up album_photos relationships
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Delete album_photos relationships
-	if err := tx.Where("album_id = ?", id).Delete(&models.AlbumPhoto{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove photos from album"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
 		return
 	}
 
-	// Delete the album
-	if err := tx.Delete(&album).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete album"})
+	// Photo memberships, tags and shared links go with the album
+	if err := h.albums.Delete(c.Request.Context(), album); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete album")
 		return
 	}
 
-	tx.Commit()
 	c.JSON(http.StatusOK, gin.H{"message": "Album deleted successfully"})
 }
 
-// AddPhotoToAlbum adds a photo to an album
+// addAlbumPhotosRequest is the JSON body of AddPhotoToAlbum
+type addAlbumPhotosRequest struct {
+	PhotoID       uuid.UUID   `json:"photo_id"`
+	Order         int         `json:"order"`
+	PhotoIDs      []uuid.UUID `json:"photo_ids" binding:"omitempty,max=1000"`
+	StartPosition *int        `json:"start_position"` // First order value for photo_ids, defaults to appending
+}
+
+// AddPhotoToAlbum adds a photo, or a list of photos, to an album
 func (h *AlbumHandler) AddPhotoToAlbum(c *gin.Context) {
 	albumID := c.Param("id")
 
 	id, err := uuid.Parse(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
 		return
 	}
 
-	var req struct {
-		PhotoID uuid.UUID `json:"photo_id" binding:"required"`
-		Order   int       `json:"order"`
-	}
+	var req addAlbumPhotosRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
+		return
+	}
+
+	if req.PhotoID == uuid.Nil && len(req.PhotoIDs) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "photo_id is required")
 		return
 	}
 
 	// Verify album exists
 	var album models.Album
-	if err := h.db.First(&album, id).Error; err != nil {
+	if err := scopedDB(c, h.db).First(&album, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify album"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify album")
+		return
+	}
+
+	if len(req.PhotoIDs) > 0 {
+		h.addPhotosToAlbum(c, &album, req.PhotoIDs, req.StartPosition)
 		return
 	}
 
 	// Verify photo exists and is in the same library
 	var photo models.Photo
-	if err := h.db.First(&photo, req.PhotoID).Error; err != nil {
+	if err := scopedDB(c, h.db).First(&photo, req.PhotoID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify photo"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify photo")
 		return
 	}
 
 	if photo.LibraryID != album.LibraryID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Photo and album must be in the same library"})
+		apierror.Respond(c, http.StatusBadRequest, "library_mismatch", "Photo and album must be in the same library")
 		return
 	}
 
 	// Check if photo is already in the album
 	var existingRelation models.AlbumPhoto
-	if err := h.db.Where("album_id = ? AND photo_id = ?", id, req.PhotoID).First(&existingRelation).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Photo is already in this album"})
+	if err := scopedDB(c, h.db).Where("album_id = ? AND photo_id = ?", id, req.PhotoID).First(&existingRelation).Error; err == nil {
+		apierror.Respond(c, http.StatusConflict, "duplicate_album_photo", "Photo is already in this album")
 		return
 	}
 
@@ -277,14 +405,149 @@ func (h *AlbumHandler) AddPhotoToAlbum(c *gin.Context) {
 		Order:   req.Order,
 	}
 
-	if err := h.db.Create(&albumPhoto).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add photo to album"})
+	// Add the photo and widen the album's date range together
+	tx := scopedDB(c, h.db).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Create(&albumPhoto).Error; err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add photo to album")
+		return
+	}
+
+	if err := updateAlbumDateRanges(tx, []uuid.UUID{id}); err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album dates")
 		return
 	}
 
+	tx.Commit()
+
 	c.JSON(http.StatusCreated, gin.H{"message": "Photo added to album successfully"})
 }
 
+// addPhotosToAlbum adds several photos to an album in a single transaction.
+// Every photo must exist and belong to the album's library; photos already in
+// the album are skipped.
+func (h *AlbumHandler) addPhotosToAlbum(c *gin.Context, album *models.Album, photoIDs []uuid.UUID, startPosition *int) {
+	// Drop duplicate IDs while keeping the requested order
+	seen := make(map[uuid.UUID]bool)
+	var uniqueIDs []uuid.UUID
+	for _, photoID := range photoIDs {
+		if !seen[photoID] {
+			seen[photoID] = true
+			uniqueIDs = append(uniqueIDs, photoID)
+		}
+	}
+
+	// Verify all photos exist and are in the same library
+	var photos []models.Photo
+	if err := scopedDB(c, h.db).Where("id IN ?", uniqueIDs).Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify photos")
+		return
+	}
+
+	found := make(map[uuid.UUID]models.Photo)
+	for _, photo := range photos {
+		found[photo.ID] = photo
+	}
+
+	missing := []uuid.UUID{}
+	wrongLibrary := []uuid.UUID{}
+	for _, photoID := range uniqueIDs {
+		photo, ok := found[photoID]
+		if !ok {
+			missing = append(missing, photoID)
+		} else if photo.LibraryID != album.LibraryID {
+			wrongLibrary = append(wrongLibrary, photoID)
+		}
+	}
+
+	if len(missing) > 0 {
+		apierror.RespondWithDetails(c, http.StatusNotFound, "photo_not_found", "Photo not found", gin.H{"photo_ids": missing})
+		return
+	}
+	if len(wrongLibrary) > 0 {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, "library_mismatch", "Photo and album must be in the same library", gin.H{"photo_ids": wrongLibrary})
+		return
+	}
+
+	// Skip photos that are already members
+	var existingIDs []uuid.UUID
+	if err := scopedDB(c, h.db).Model(&models.AlbumPhoto{}).
+		Where("album_id = ? AND photo_id IN ?", album.ID, uniqueIDs).
+		Pluck("photo_id", &existingIDs).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check album membership")
+		return
+	}
+
+	existing := make(map[uuid.UUID]bool)
+	for _, photoID := range existingIDs {
+		existing[photoID] = true
+	}
+
+	// Default to appending after the current last photo
+	position := 0
+	if startPosition != nil {
+		position = *startPosition
+	} else {
+		var maxOrder *int
+		scopedDB(c, h.db).Model(&models.AlbumPhoto{}).Where("album_id = ?", album.ID).Select("MAX(\"order\")").Row().Scan(&maxOrder)
+		if maxOrder != nil {
+			position = *maxOrder + 1
+		}
+	}
+
+	var albumPhotos []models.AlbumPhoto
+	skipped := []uuid.UUID{}
+	for _, photoID := range uniqueIDs {
+		if existing[photoID] {
+			skipped = append(skipped, photoID)
+			continue
+		}
+		albumPhotos = append(albumPhotos, models.AlbumPhoto{
+			AlbumID: album.ID,
+			PhotoID: photoID,
+			Order:   position,
+		})
+		position++
+	}
+
+	if len(albumPhotos) > 0 {
+		// Insert all memberships in one transaction so a failure adds nothing
+		tx := scopedDB(c, h.db).Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		if err := tx.Create(&albumPhotos).Error; err != nil {
+			tx.Rollback()
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add photos to album")
+			return
+		}
+
+		if err := updateAlbumDateRanges(tx, []uuid.UUID{album.ID}); err != nil {
+			tx.Rollback()
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album dates")
+			return
+		}
+
+		tx.Commit()
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":           "Photos added to album successfully",
+		"added":             len(albumPhotos),
+		"skipped_photo_ids": skipped,
+	})
+}
+
 // RemovePhotoFromAlbum removes a photo from an album
 func (h *AlbumHandler) RemovePhotoFromAlbum(c *gin.Context) {
 	albumID := c.Param("id")
@@ -292,30 +555,156 @@ func (h *AlbumHandler) RemovePhotoFromAlbum(c *gin.Context) {
 
 	albumUUID, err := uuid.Parse(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
 		return
 	}
 
 	photoUUID, err := uuid.Parse(photoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
 		return
 	}
 
-	result := h.db.Where("album_id = ? AND photo_id = ?", albumUUID, photoUUID).Delete(&models.AlbumPhoto{})
+	tx := scopedDB(c, h.db).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Join rows have no tenant of their own, so go by the album's
+	result := tx.Where("album_id = ? AND photo_id = ?", albumUUID, photoUUID).
+		Where("album_id IN (?)", tx.Model(&models.Album{}).Select("id")).
+		Delete(&models.AlbumPhoto{})
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove photo from album"})
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove photo from album")
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found in album"})
+		tx.Rollback()
+		apierror.Respond(c, http.StatusNotFound, "photo_not_in_album", "Photo not found in album")
+		return
+	}
+
+	if err := updateAlbumDateRanges(tx, []uuid.UUID{albumUUID}); err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album dates")
+		return
+	}
+
+	if err := clearRemovedAlbumCovers(tx, []uuid.UUID{albumUUID}); err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album cover")
 		return
 	}
 
+	tx.Commit()
+
 	c.JSON(http.StatusOK, gin.H{"message": "Photo removed from album successfully"})
 }
 
+// removeAlbumPhotosRequest is the JSON body of RemovePhotosFromAlbum
+type removeAlbumPhotosRequest struct {
+	PhotoIDs []uuid.UUID `json:"photo_ids" binding:"required,min=1,max=1000"`
+}
+
+// RemovePhotosFromAlbum removes a list of photos from an album in one call
+func (h *AlbumHandler) RemovePhotosFromAlbum(c *gin.Context) {
+	albumID := c.Param("id")
+
+	id, err := uuid.Parse(albumID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return
+	}
+
+	var req removeAlbumPhotosRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	// Verify album exists
+	var album models.Album
+	if err := scopedDB(c, h.db).First(&album, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify album")
+		return
+	}
+
+	// Work out which of the requested photos are actually members
+	var memberIDs []uuid.UUID
+	if err := scopedDB(c, h.db).Model(&models.AlbumPhoto{}).
+		Where("album_id = ? AND photo_id IN ?", id, req.PhotoIDs).
+		Pluck("photo_id", &memberIDs).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check album membership")
+		return
+	}
+
+	members := make(map[uuid.UUID]bool)
+	for _, photoID := range memberIDs {
+		members[photoID] = true
+	}
+
+	notInAlbum := []uuid.UUID{}
+	seen := make(map[uuid.UUID]bool)
+	for _, photoID := range req.PhotoIDs {
+		if !members[photoID] && !seen[photoID] {
+			notInAlbum = append(notInAlbum, photoID)
+		}
+		seen[photoID] = true
+	}
+
+	var removed int64
+	if len(memberIDs) > 0 {
+		tx := scopedDB(c, h.db).Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		result := tx.Where("album_id = ? AND photo_id IN ?", id, memberIDs).Delete(&models.AlbumPhoto{})
+		if result.Error != nil {
+			tx.Rollback()
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove photos from album")
+			return
+		}
+
+		if err := updateAlbumDateRanges(tx, []uuid.UUID{id}); err != nil {
+			tx.Rollback()
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album dates")
+			return
+		}
+
+		if err := clearRemovedAlbumCovers(tx, []uuid.UUID{id}); err != nil {
+			tx.Rollback()
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album cover")
+			return
+		}
+
+		tx.Commit()
+		removed = result.RowsAffected
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":                "Photos removed from album successfully",
+		"removed":                removed,
+		"not_in_album_photo_ids": notInAlbum,
+	})
+}
+
+// photoOrderRequest is the JSON body of UpdatePhotoOrder
+type photoOrderRequest struct {
+	Order int `json:"order" binding:"required"`
+}
+
 // UpdatePhotoOrder updates the order of a photo in an album
 func (h *AlbumHandler) UpdatePhotoOrder(c *gin.Context) {
 	albumID := c.Param("id")
@@ -323,38 +712,397 @@ func (h *AlbumHandler) UpdatePhotoOrder(c *gin.Context) {
 
 	albumUUID, err := uuid.Parse(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
 		return
 	}
 
 	photoUUID, err := uuid.Parse(photoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
 		return
 	}
 
-	var req struct {
-		Order int `json:"order" binding:"required"`
-	}
+	var req photoOrderRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
 		return
 	}
 
-	result := h.db.Model(&models.AlbumPhoto{}).
+	// Join rows have no tenant of their own, so go by the album's
+	result := scopedDB(c, h.db).Model(&models.AlbumPhoto{}).
 		Where("album_id = ? AND photo_id = ?", albumUUID, photoUUID).
+		Where("album_id IN (?)", scopedDB(c, h.db).Model(&models.Album{}).Select("id")).
 		Update("order", req.Order)
 
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update photo order"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo order")
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found in album"})
+		apierror.Respond(c, http.StatusNotFound, "photo_not_in_album", "Photo not found in album")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Photo order updated successfully"})
 }
+
+// reorderAlbumPhotosRequest is the JSON body of ReorderAlbumPhotos
+type reorderAlbumPhotosRequest struct {
+	PhotoIDs []uuid.UUID `json:"photo_ids" binding:"required,min=1,max=10000"`
+	Position *int        `json:"position" binding:"omitempty,min=0"` // Move photo_ids here, 0 being first, rather than listing every photo
+}
+
+// ReorderAlbumPhotos renumbers an album's photos in one transaction, for
+// drag-and-drop reordering. photo_ids either lists every photo of the album
+// in its new order, or, with a position, the photos to move there in order,
+// the others keeping theirs around them. Positions past the end append.
+func (h *AlbumHandler) ReorderAlbumPhotos(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return
+	}
+
+	var req reorderAlbumPhotosRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	listed := make(map[uuid.UUID]bool)
+	for _, photoID := range req.PhotoIDs {
+		if listed[photoID] {
+			apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeValidation, "Photos can only be listed once", gin.H{"photo_ids": []uuid.UUID{photoID}})
+			return
+		}
+		listed[photoID] = true
+	}
+
+	var album models.Album
+	if err := scopedDB(c, h.db).Select("id").First(&album, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return
+	}
+
+	var order []uuid.UUID
+	err = scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		var current []uuid.UUID
+		if err := tx.Model(&models.AlbumPhoto{}).Where("album_id = ?", album.ID).
+			Order(`"order", photo_id`).Pluck("photo_id", &current).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos"}
+		}
+		members := make(map[uuid.UUID]bool, len(current))
+		for _, photoID := range current {
+			members[photoID] = true
+		}
+		notInAlbum := []uuid.UUID{}
+		for _, photoID := range req.PhotoIDs {
+			if !members[photoID] {
+				notInAlbum = append(notInAlbum, photoID)
+			}
+		}
+		if len(notInAlbum) > 0 {
+			return &albumOrderError{"photo_not_in_album", "Photo is not in the album", notInAlbum}
+		}
+
+		if req.Position == nil {
+			if len(req.PhotoIDs) != len(current) {
+				unlisted := []uuid.UUID{}
+				for _, photoID := range current {
+					if !listed[photoID] {
+						unlisted = append(unlisted, photoID)
+					}
+				}
+				return &albumOrderError{apierror.CodeValidation, "photo_ids must list every photo of the album, or come with a position", unlisted}
+			}
+			order = req.PhotoIDs
+		} else {
+			rest := make([]uuid.UUID, 0, len(current))
+			for _, photoID := range current {
+				if !listed[photoID] {
+					rest = append(rest, photoID)
+				}
+			}
+			position := min(*req.Position, len(rest))
+			order = append(append(append(order, rest[:position]...), req.PhotoIDs...), rest[position:]...)
+		}
+
+		for i, photoID := range order {
+			if err := tx.Model(&models.AlbumPhoto{}).Where("album_id = ? AND photo_id = ?", album.ID, photoID).
+				Update("order", i).Error; err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo order"}
+			}
+		}
+		return nil
+	})
+	if orderErr, ok := err.(*albumOrderError); ok {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, orderErr.code, orderErr.message, gin.H{"photo_ids": orderErr.photoIDs})
+		return
+	}
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Album photos reordered successfully",
+		"photo_ids": order,
+	})
+}
+
+// albumOrderError rejects a reorder because of the photos it lists
+type albumOrderError struct {
+	code     string
+	message  string
+	photoIDs []uuid.UUID
+}
+
+func (e *albumOrderError) Error() string {
+	return e.message
+}
+
+// albumCoverRequest is the JSON body of SetAlbumCover
+type albumCoverRequest struct {
+	PhotoID *uuid.UUID `json:"photo_id"`
+}
+
+// SetAlbumCover chooses the album's cover photo, which must be in the album.
+// A null photo_id goes back to using the first photo.
+func (h *AlbumHandler) SetAlbumCover(c *gin.Context) {
+	albumID := c.Param("id")
+
+	id, err := uuid.Parse(albumID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return
+	}
+
+	var req albumCoverRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	album, err := h.albums.Get(c.Request.Context(), id, repository.AlbumRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return
+	}
+
+	if req.PhotoID != nil {
+		var count int64
+		if err := scopedDB(c, h.db).Model(&models.AlbumPhoto{}).
+			Where("album_id = ? AND photo_id = ?", album.ID, *req.PhotoID).
+			Count(&count).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check album membership")
+			return
+		}
+		if count == 0 {
+			apierror.Respond(c, http.StatusBadRequest, "photo_not_in_album", "Photo is not in the album")
+			return
+		}
+	}
+
+	album.CoverPhotoID = req.PhotoID
+	if err := scopedDB(c, h.db).Model(album).Update("cover_photo_id", req.PhotoID).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album cover")
+		return
+	}
+
+	albums := []models.Album{*album}
+	if err := loadAlbumCovers(scopedDB(c, h.db), albums); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album cover")
+		return
+	}
+
+	c.JSON(http.StatusOK, albums[0])
+}
+
+// albumDateSubquery computes an album's earliest or latest photo capture
+// date, ignoring photos in the trash
+const albumDateSubquery = "(SELECT %s(photos.taken_at) FROM photos JOIN album_photos ON album_photos.photo_id = photos.id WHERE album_photos.album_id = albums.id AND photos.deleted_at IS NULL)"
+
+// updateAlbumDateRanges recomputes the start and end dates of the given
+// albums from the capture dates of their photos. It should run in the same
+// transaction as the membership or capture date change.
+func updateAlbumDateRanges(db *gorm.DB, albumIDs []uuid.UUID) error {
+	if len(albumIDs) == 0 {
+		return nil
+	}
+	// UpdateColumns leaves updated_at alone, the album itself wasn't edited
+	return db.Model(&models.Album{}).Where("id IN ?", albumIDs).UpdateColumns(map[string]interface{}{
+		"start_date": gorm.Expr(fmt.Sprintf(albumDateSubquery, "MIN")),
+		"end_date":   gorm.Expr(fmt.Sprintf(albumDateSubquery, "MAX")),
+	}).Error
+}
+
+// albumIDsForPhotos returns the IDs of the albums containing any of photoIDs
+func albumIDsForPhotos(db *gorm.DB, photoIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var albumIDs []uuid.UUID
+	err := db.Model(&models.AlbumPhoto{}).
+		Where("photo_id IN ?", photoIDs).
+		Distinct().
+		Pluck("album_id", &albumIDs).Error
+	return albumIDs, err
+}
+
+// firstAlbumPhotoCondition matches the album_photos row that comes first in
+// its album, by order and then photo ID as album listings sort them. Photos
+// in the trash don't count.
+const firstAlbumPhotoCondition = `NOT EXISTS (SELECT 1 FROM album_photos AS earlier JOIN photos AS earlier_photos ON earlier_photos.id = earlier.photo_id WHERE earlier.album_id = album_photos.album_id AND earlier_photos.deleted_at IS NULL AND (earlier."order" < album_photos."order" OR (earlier."order" = album_photos."order" AND earlier.photo_id < album_photos.photo_id)))`
+
+// sortAlbumPhotos puts the preloaded photos of albums in the order of each
+// album's sort mode, the same order GetAlbumPhotos lists them in
+func sortAlbumPhotos(db *gorm.DB, albums []models.Album) error {
+	var ids []uuid.UUID
+	for _, album := range albums {
+		if len(album.Photos) > 1 {
+			ids = append(ids, album.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var members []models.AlbumPhoto
+	if err := db.Select("album_id", "photo_id", "order").Where("album_id IN ?", ids).Find(&members).Error; err != nil {
+		return err
+	}
+	positions := make(map[[2]uuid.UUID]int, len(members))
+	for _, member := range members {
+		positions[[2]uuid.UUID{member.AlbumID, member.PhotoID}] = member.Order
+	}
+
+	for i := range albums {
+		album := &albums[i]
+		sort.SliceStable(album.Photos, func(x, y int) bool {
+			a, b := album.Photos[x], album.Photos[y]
+			switch album.SortMode {
+			case "uploaded_at":
+				if !a.UploadedAt.Equal(b.UploadedAt) {
+					return a.UploadedAt.Before(b.UploadedAt)
+				}
+			case "taken_at":
+				if (a.TakenAt == nil) != (b.TakenAt == nil) {
+					return b.TakenAt == nil
+				}
+				if a.TakenAt != nil && !a.TakenAt.Equal(*b.TakenAt) {
+					return a.TakenAt.Before(*b.TakenAt)
+				}
+			case "filename":
+				if a.OriginalName != b.OriginalName {
+					return a.OriginalName < b.OriginalName
+				}
+			case "rating":
+				if (a.Rating == nil) != (b.Rating == nil) {
+					return b.Rating == nil
+				}
+				if a.Rating != nil && *a.Rating != *b.Rating {
+					return *a.Rating > *b.Rating
+				}
+			}
+			positionA := positions[[2]uuid.UUID{album.ID, a.ID}]
+			positionB := positions[[2]uuid.UUID{album.ID, b.ID}]
+			if positionA != positionB {
+				return positionA < positionB
+			}
+			return a.ID.String() < b.ID.String()
+		})
+	}
+	return nil
+}
+
+// loadAlbumCovers fills in the cover photo of albums, using the first photo
+// in album order for albums without a chosen cover, or whose cover is in the
+// trash. Empty albums get none.
+func loadAlbumCovers(db *gorm.DB, albums []models.Album) error {
+	var chosen []uuid.UUID
+	for _, album := range albums {
+		if album.CoverPhotoID != nil {
+			chosen = append(chosen, *album.CoverPhotoID)
+		}
+	}
+	live := make(map[uuid.UUID]bool)
+	if len(chosen) > 0 {
+		var liveIDs []uuid.UUID
+		if err := db.Model(&models.Photo{}).Where("id IN ?", chosen).Pluck("id", &liveIDs).Error; err != nil {
+			return err
+		}
+		for _, id := range liveIDs {
+			live[id] = true
+		}
+	}
+
+	coverIDs := make(map[uuid.UUID]uuid.UUID) // album ID -> photo ID
+	var uncovered []uuid.UUID
+	for _, album := range albums {
+		if album.CoverPhotoID != nil && live[*album.CoverPhotoID] {
+			coverIDs[album.ID] = *album.CoverPhotoID
+		} else {
+			uncovered = append(uncovered, album.ID)
+		}
+	}
+
+	if len(uncovered) > 0 {
+		var firsts []models.AlbumPhoto
+		if err := db.Model(&models.AlbumPhoto{}).
+			Select("album_photos.*").
+			Joins("JOIN photos ON photos.id = album_photos.photo_id").
+			Where("album_photos.album_id IN ? AND photos.deleted_at IS NULL", uncovered).
+			Where(firstAlbumPhotoCondition).
+			Find(&firsts).Error; err != nil {
+			return err
+		}
+		for _, first := range firsts {
+			coverIDs[first.AlbumID] = first.PhotoID
+		}
+	}
+
+	if len(coverIDs) == 0 {
+		return nil
+	}
+
+	photoIDs := make([]uuid.UUID, 0, len(coverIDs))
+	for _, photoID := range coverIDs {
+		photoIDs = append(photoIDs, photoID)
+	}
+
+	var photos []models.Photo
+	if err := db.Where("id IN ?", photoIDs).Find(&photos).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[uuid.UUID]*models.Photo, len(photos))
+	for i := range photos {
+		byID[photos[i].ID] = &photos[i]
+	}
+	for i := range albums {
+		if photoID, ok := coverIDs[albums[i].ID]; ok {
+			albums[i].CoverPhoto = byID[photoID]
+		}
+	}
+	return nil
+}
+
+// clearRemovedAlbumCovers unsets the chosen cover of the given albums where
+// that photo is no longer a member, so they fall back to the first photo. It
+// should run in the same transaction as the membership change.
+func clearRemovedAlbumCovers(db *gorm.DB, albumIDs []uuid.UUID) error {
+	if len(albumIDs) == 0 {
+		return nil
+	}
+	return db.Model(&models.Album{}).
+		Where("id IN ? AND cover_photo_id IS NOT NULL", albumIDs).
+		Where("NOT EXISTS (SELECT 1 FROM album_photos WHERE album_photos.album_id = albums.id AND album_photos.photo_id = albums.cover_photo_id)").
+		UpdateColumn("cover_photo_id", nil).Error
+}
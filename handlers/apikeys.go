@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/apikeys"
+	"photo-library-server/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKeyHandler manages the API keys automation scripts authenticate with
+type APIKeyHandler struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// createAPIKeyRequest is the JSON body of CreateAPIKey
+type createAPIKeyRequest struct {
+	Name  string `json:"name" binding:"required,min=1,max=100"`
+	Scope string `json:"scope" binding:"required,oneof=read upload full"`
+}
+
+// CreateAPIKey issues a new key. The key is only ever returned here, later
+// responses identify it by its prefix.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req createAPIKeyRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	key, err := apikeys.Generate()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate API key")
+		return
+	}
+
+	apiKey := models.APIKey{
+		Name:    strings.TrimSpace(req.Name),
+		Scope:   req.Scope,
+		Prefix:  apikeys.Prefix(key),
+		KeyHash: apikeys.Hash(key),
+	}
+
+	if err := scopedDB(c, h.db).Create(&apiKey).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         apiKey.ID,
+		"name":       apiKey.Name,
+		"scope":      apiKey.Scope,
+		"prefix":     apiKey.Prefix,
+		"created_at": apiKey.CreatedAt,
+		"key":        key, // Shown once, only the hash is stored
+	})
+}
+
+// GetAPIKeys returns all API keys, without the keys themselves
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	keys := []models.APIKey{}
+	if err := scopedDB(c, h.db).Order("created_at").Find(&keys).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// DeleteAPIKey revokes a key, requests using it fail from then on
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+
+	id, err := uuid.Parse(keyID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_api_key_id", "Invalid API key ID")
+		return
+	}
+
+	result := scopedDB(c, h.db).Delete(&models.APIKey{}, id)
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete API key")
+		return
+	}
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, "api_key_not_found", "API key not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key deleted successfully"})
+}
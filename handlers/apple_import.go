@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/jobs"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// appleFavoriteRating is the XMP rating export tools give favorites, since
+// Photos has no other way to record them in a sidecar
+const appleFavoriteRating = 5
+
+// AppleImportRequest names an Apple Photos or iCloud Photos export on the
+// server's disk
+type AppleImportRequest struct {
+	Path string `json:"path" binding:"required"`
+}
+
+// appleExport is what an export directory holds: its photo files and what
+// its CSV files say about them, keyed by lowercased file name
+type appleExport struct {
+	files     []appleExportFile
+	favorites map[string]bool
+	albums    map[string][]string // Album names of each file, from iCloud's Albums/*.csv
+}
+
+// appleExportFile is a file of an export, in the album its folder names
+type appleExportFile struct {
+	path  string
+	album string
+}
+
+// ImportAppleExport imports an Apple Photos export (originals with XMP and
+// AAE sidecars) or an iCloud Photos data download from a directory on the
+// server, as a background job. Files are copied into the library; keywords
+// become tags, favorites the favorite flag and albums Albums.
+func (h *PhotoHandler) ImportAppleExport(c *gin.Context) {
+	libraryID := c.Param("id")
+
+	id, err := uuid.Parse(libraryID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
+		return
+	}
+
+	var req AppleImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var library models.Library
+	if err := scopedDB(c, h.db).First(&library, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
+		return
+	}
+
+	// Imported files are registered as a scan registers them, in plaintext
+	if library.Encrypted {
+		apierror.Respond(c, http.StatusBadRequest, "encrypted_not_supported", "Encrypted libraries can't import exports")
+		return
+	}
+	if library.ReadOnly {
+		apierror.Respond(c, http.StatusForbidden, "library_read_only", "Library is read-only")
+		return
+	}
+	if isRelocating(library.ID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
+		return
+	}
+
+	root, err := filepath.Abs(req.Path)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "import_path_not_found", "Export directory not found")
+		return
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		apierror.Respond(c, http.StatusBadRequest, "import_path_not_found", "Export directory not found")
+		return
+	}
+	// Copies would land in the directory being walked, a scan adopts such files
+	if images, err := filepath.Abs(library.Images); err == nil && inDirectory(images, root) {
+		apierror.Respond(c, http.StatusBadRequest, "import_path_in_library", "Export directory is inside the library, scan the library instead")
+		return
+	}
+
+	job, err := h.jobs.SubmitFor(library.TenantID, "apple_photos_import", func(ctx context.Context, job *jobs.Job) error {
+		return h.importAppleExport(ctx, job, &library, root)
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule import job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// importAppleExport copies an export's files into a library, and finishes
+// with a summary result. Files the library already holds are not copied
+// again but still join their albums, so an interrupted import can be rerun.
+func (h *PhotoHandler) importAppleExport(ctx context.Context, job *jobs.Job, library *models.Library, root string) error {
+	export, err := readAppleExport(root)
+	if err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+
+	// One unit per file plus the final summary result
+	job.SetTotal(len(export.files) + 1)
+
+	db := tenant.Scope(h.db, library.TenantID)
+	albums := &appleAlbums{db: db, library: library, byName: map[string]*appleAlbum{}}
+	var imported, existing, unsupported int
+	failed := []scanFailure{}
+	for _, file := range export.files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		photo, err := h.importAppleFile(library, file.path)
+		switch {
+		case err == nil:
+			imported++
+		case err == errAlreadyImported:
+			existing++
+		case err == errUnsupportedFile:
+			unsupported++
+		default:
+			rel, _ := filepath.Rel(root, file.path)
+			failed = append(failed, scanFailure{Path: rel, Error: err.Error()})
+		}
+
+		if photo != nil {
+			name := strings.ToLower(filepath.Base(file.path))
+			if err := h.applyAppleMetadata(db, photo, file.path, export.favorites[name]); err != nil {
+				rel, _ := filepath.Rel(root, file.path)
+				failed = append(failed, scanFailure{Path: rel, Error: err.Error()})
+			}
+
+			names := export.albums[name]
+			if file.album != "" {
+				names = append([]string{file.album}, names...)
+			}
+			for _, albumName := range names {
+				if err := albums.add(albumName, photo); err != nil {
+					rel, _ := filepath.Rel(root, file.path)
+					failed = append(failed, scanFailure{Path: rel, Error: err.Error()})
+				}
+			}
+		}
+		job.Advance(1)
+	}
+
+	if err := updateAlbumDateRanges(db, albums.ids()); err != nil {
+		return err
+	}
+
+	job.AddResult(map[string]interface{}{
+		"files":          len(export.files),
+		"imported":       imported,
+		"existing":       existing,
+		"unsupported":    unsupported,
+		"albums_created": albums.created,
+		"failed":         failed,
+	})
+	return nil
+}
+
+// importAppleFile copies one exported file into a library and registers it.
+// A file whose bytes the library already holds isn't copied, its photo is
+// returned with errAlreadyImported.
+func (h *PhotoHandler) importAppleFile(library *models.Library, path string) (*models.Photo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > h.config.MaxFileSize {
+		return nil, fmt.Errorf("file exceeds maximum allowed size of %d bytes", h.config.MaxFileSize)
+	}
+
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+	var found models.Photo
+	err = tenant.Scope(h.db, library.TenantID).Where("library_id = ? AND checksum = ?", library.ID, checksum).
+		Order("uploaded_at asc").
+		First(&found).Error
+	if err == nil {
+		return &found, errAlreadyImported
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	if err := checkQuota(h.db, library, info.Size()); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(library.Images, 0755); err != nil {
+		return nil, err
+	}
+	if opErr := h.checkDiskSpace(library.Images, info.Size()); opErr != nil {
+		return nil, opErr
+	}
+
+	name := filepath.Base(path)
+	dst := filepath.Join(library.Images, h.generateUniqueFilename(name))
+	if err := h.copyFile(path, dst); err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+	photo, err := h.importFile(library, dst)
+	if err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+
+	// The copy has a generated name, the photo keeps the exported one
+	if err := h.db.Model(photo).Update("original_name", name).Error; err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// applyAppleMetadata carries what an export says about a file over to its
+// photo: keywords from its XMP sidecar become tags and its rating is kept,
+// and it is marked a favorite if the export's CSV or rating says so
+func (h *PhotoHandler) applyAppleMetadata(db *gorm.DB, photo *models.Photo, path string, favorite bool) error {
+	// Photos names sidecars IMG_0001.xmp, other tools IMG_0001.HEIC.xmp
+	var sidecar []byte
+	for _, candidate := range []string{metadata.SidecarPath(path), path + ".xmp"} {
+		if data, err := os.ReadFile(candidate); err == nil {
+			sidecar = data
+			break
+		}
+	}
+
+	updates := map[string]interface{}{}
+	if rating := metadata.ExtractRating(sidecar); rating != nil && *rating >= 0 && *rating <= 5 {
+		updates["rating"] = *rating
+		favorite = favorite || *rating == appleFavoriteRating
+	}
+	if favorite {
+		updates["favorite"] = true
+	}
+	if len(updates) > 0 {
+		if err := db.Model(photo).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to save photo metadata: %w", err)
+		}
+	}
+
+	for _, keyword := range metadata.ExtractKeywords(sidecar) {
+		// Keywords longer than the tag name limit can't be represented as tags
+		if len([]rune(keyword)) > maxTagNameLength {
+			continue
+		}
+		if err := h.addTagToPhoto(photo, keyword); err != nil {
+			return fmt.Errorf("failed to tag photo: %w", err)
+		}
+	}
+	return nil
+}
+
+// readAppleExport lists the photo files of an export directory and reads its
+// CSV files. Photos app exports hold originals, in a folder per album when
+// exported that way, next to .xmp and .aae sidecars. iCloud data downloads
+// hold a Photos folder with "Photo Details" CSVs of favorites, and an Albums
+// folder with a CSV of file names per album.
+func readAppleExport(root string) (*appleExport, error) {
+	export := &appleExport{favorites: map[string]bool{}, albums: map[string][]string{}}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		switch ext := strings.ToLower(filepath.Ext(path)); {
+		case ext == ".xmp" || ext == ".aae":
+			// Sidecars are read with their photo, Photos' edits can't be applied
+		case ext == ".csv" && strings.HasPrefix(strings.ToLower(d.Name()), "photo details"):
+			return readAppleCSV(path, "imgName", func(name string, row map[string]string) {
+				if strings.EqualFold(row["favorite"], "yes") {
+					export.favorites[name] = true
+				}
+			})
+		case ext == ".csv" && strings.EqualFold(filepath.Base(dir), "Albums"):
+			album := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
+			return readAppleCSV(path, "Images", func(name string, row map[string]string) {
+				export.albums[name] = append(export.albums[name], album)
+			})
+		case ext == ".csv":
+		default:
+			file := appleExportFile{path: path}
+			if dir != root && !strings.EqualFold(filepath.Base(dir), "Photos") {
+				file.album = filepath.Base(dir)
+			}
+			export.files = append(export.files, file)
+		}
+		return nil
+	})
+	return export, err
+}
+
+// readAppleCSV calls row for each row of a CSV file with a header, with the
+// lowercased file name in its key column and the row's values by header
+func readAppleCSV(path, key string, row func(name string, values map[string]string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	header := records[0]
+	for _, record := range records[1:] {
+		values := map[string]string{}
+		for i, value := range record {
+			if i < len(header) {
+				values[strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))] = strings.TrimSpace(value)
+			}
+		}
+		if name := values[key]; name != "" {
+			row(strings.ToLower(name), values)
+		}
+	}
+	return nil
+}
+
+// appleAlbums finds or creates the albums of an import by name, and adds
+// photos to them after their current members
+type appleAlbums struct {
+	db      *gorm.DB
+	library *models.Library
+	byName  map[string]*appleAlbum
+	created int
+}
+
+type appleAlbum struct {
+	id        uuid.UUID
+	nextOrder int
+}
+
+func (a *appleAlbums) add(name string, photo *models.Photo) error {
+	album, ok := a.byName[name]
+	if !ok {
+		var found models.Album
+		err := a.db.Where("library_id = ? AND name = ?", a.library.ID, name).Order("created_at").First(&found).Error
+		if err == gorm.ErrRecordNotFound {
+			found = models.Album{Name: name, LibraryID: a.library.ID}
+			if err := a.db.Create(&found).Error; err != nil {
+				return fmt.Errorf("failed to create album: %w", err)
+			}
+			a.created++
+		} else if err != nil {
+			return err
+		}
+
+		album = &appleAlbum{id: found.ID}
+		var maxOrder *int
+		if err := a.db.Model(&models.AlbumPhoto{}).Where("album_id = ?", found.ID).Select("MAX(\"order\")").Row().Scan(&maxOrder); err != nil {
+			return err
+		}
+		if maxOrder != nil {
+			album.nextOrder = *maxOrder + 1
+		}
+		a.byName[name] = album
+	}
+
+	var count int64
+	if err := a.db.Model(&models.AlbumPhoto{}).Where("album_id = ? AND photo_id = ?", album.id, photo.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if err := a.db.Create(&models.AlbumPhoto{AlbumID: album.id, PhotoID: photo.ID, Order: album.nextOrder}).Error; err != nil {
+		return fmt.Errorf("failed to add photo to album: %w", err)
+	}
+	album.nextOrder++
+	return nil
+}
+
+// ids returns the IDs of the albums the import touched
+func (a *appleAlbums) ids() []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(a.byName))
+	for _, album := range a.byName {
+		ids = append(ids, album.id)
+	}
+	return ids
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/apikeys"
+	"photo-library-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// auditMissingFile is a photo record whose file is gone
+type auditMissingFile struct {
+	PhotoID  uuid.UUID `json:"photo_id"`
+	FilePath string    `json:"file_path"`
+	Fixed    bool      `json:"fixed"` // Flagged as missing
+}
+
+// auditUntrackedFile is a file in the images directory without a photo record
+type auditUntrackedFile struct {
+	Path    string     `json:"path"` // Relative to the images directory
+	Fixed   bool       `json:"fixed"`
+	PhotoID *uuid.UUID `json:"photo_id,omitempty"` // Record created by the fix
+	Error   string     `json:"error,omitempty"`
+}
+
+// auditPhotoTag is a photo_tags row whose tag no longer exists
+type auditPhotoTag struct {
+	PhotoID uuid.UUID `json:"photo_id"`
+	TagID   uuid.UUID `json:"tag_id"`
+}
+
+// auditAlbumPhoto is an album_photos row whose album or photo no longer
+// exists, or whose photo has left the album's library
+type auditAlbumPhoto struct {
+	AlbumID uuid.UUID `json:"album_id"`
+	PhotoID uuid.UUID `json:"photo_id"`
+}
+
+// AuditLibrary reports inconsistencies between a library's records and its
+// files: records whose files are missing, files without records, and join
+// rows pointing at tags, albums or photos that are gone. With fix=true the
+// problems are repaired as well: missing files are flagged as a rescan would,
+// untracked files are imported in place and dangling rows are deleted.
+func (h *PhotoHandler) AuditLibrary(c *gin.Context) {
+	libraryID := c.Param("id")
+
+	id, err := uuid.Parse(libraryID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
+		return
+	}
+
+	var library models.Library
+	if err := scopedDB(c, h.db).First(&library, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
+		return
+	}
+
+	fix := c.Query("fix") == "true"
+	if fix {
+		// Audits are GET requests, which read-only keys may make
+		if scope, ok := apikeys.ScopeFromContext(c.Request.Context()); ok && scope != apikeys.ScopeFull {
+			apierror.Respond(c, http.StatusForbidden, "api_key_scope_denied", "API key scope does not allow repairs")
+			return
+		}
+		if library.ReadOnly {
+			apierror.Respond(c, http.StatusForbidden, "library_read_only", "Library is read-only")
+			return
+		}
+		if isRelocating(library.ID) {
+			apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
+			return
+		}
+	}
+
+	db := scopedDB(c, h.db)
+
+	// Trashed photos still own their files
+	var photos []models.Photo
+	if err := db.Unscoped().Select("id", "file_path", "missing").Where("library_id = ?", id).Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photos")
+		return
+	}
+
+	missing := []auditMissingFile{}
+	knownPaths := make(map[string]bool, len(photos))
+	for _, photo := range photos {
+		knownPaths[filepath.Clean(photo.FilePath)] = true
+		if _, err := os.Stat(photo.FilePath); !os.IsNotExist(err) {
+			continue
+		}
+		entry := auditMissingFile{PhotoID: photo.ID, FilePath: photo.FilePath}
+		if fix {
+			entry.Fixed = photo.Missing || db.Unscoped().Model(&models.Photo{}).Where("id = ?", photo.ID).Update("missing", true).Error == nil
+		}
+		missing = append(missing, entry)
+	}
+
+	files, err := scanCandidates(library.Images)
+	if err != nil && !os.IsNotExist(err) {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list images directory")
+		return
+	}
+	untracked := []auditUntrackedFile{}
+	for _, path := range files {
+		if knownPaths[path] {
+			continue
+		}
+		rel, _ := filepath.Rel(library.Images, path)
+		entry := auditUntrackedFile{Path: rel}
+		if fix {
+			entry.PhotoID, entry.Error = h.adoptFile(&library, path)
+			entry.Fixed = entry.PhotoID != nil
+		}
+		untracked = append(untracked, entry)
+	}
+
+	libraryPhotos := h.db.Unscoped().Model(&models.Photo{}).Select("id").Where("library_id = ?", id)
+	libraryAlbums := h.db.Model(&models.Album{}).Select("id").Where("library_id = ?", id)
+
+	photoTags := []auditPhotoTag{}
+	if err := h.db.Model(&models.PhotoTag{}).
+		Where("photo_id IN (?)", libraryPhotos).
+		Where("tag_id NOT IN (?)", h.db.Model(&models.Tag{}).Select("id")).
+		Select("photo_id", "tag_id").
+		Find(&photoTags).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check photo tags")
+		return
+	}
+
+	// Rows are found from whichever side still belongs to the library
+	albumPhotos := []auditAlbumPhoto{}
+	if err := h.db.Model(&models.AlbumPhoto{}).
+		Where("album_id IN (?) AND photo_id NOT IN (?)", libraryAlbums, libraryPhotos).
+		Or("photo_id IN (?) AND album_id NOT IN (?)", libraryPhotos, h.db.Model(&models.Album{}).Select("id")).
+		Select("album_id", "photo_id").
+		Find(&albumPhotos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check album photos")
+		return
+	}
+
+	if fix && len(photoTags)+len(albumPhotos) > 0 {
+		if err := h.db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range photoTags {
+				if err := tx.Where("photo_id = ? AND tag_id = ?", row.PhotoID, row.TagID).Delete(&models.PhotoTag{}).Error; err != nil {
+					return err
+				}
+			}
+			for _, row := range albumPhotos {
+				if err := tx.Where("album_id = ? AND photo_id = ?", row.AlbumID, row.PhotoID).Delete(&models.AlbumPhoto{}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete dangling rows")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"library_id":            library.ID,
+		"fixed":                 fix,
+		"missing_files":         missing,
+		"untracked_files":       untracked,
+		"dangling_photo_tags":   photoTags,
+		"dangling_album_photos": albumPhotos,
+	})
+}
+
+// adoptFile imports an untracked file found by an audit, returning the new
+// photo's ID or why it couldn't be imported
+func (h *PhotoHandler) adoptFile(library *models.Library, path string) (*uuid.UUID, string) {
+	// Files on disk are plaintext, see ScanLibrary
+	if library.Encrypted {
+		return nil, "Encrypted libraries can't import files in place"
+	}
+	photo, err := h.importFile(library, path)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return &photo.ID, ""
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/database"
+	"photo-library-server/jobs"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BackupHandler handles online database backup HTTP requests
+type BackupHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	jobs   *jobs.Manager
+
+	mu sync.Mutex // One backup at a time
+}
+
+// NewBackupHandler creates a new backup handler
+func NewBackupHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager) *BackupHandler {
+	return &BackupHandler{db: db, config: cfg, jobs: jobManager}
+}
+
+// Backups are named after when they were made, so names sort by age
+const backupTimeFormat = "20060102T150405.000Z"
+
+// backupNamePattern matches the names given to backups, and nothing that
+// could lead out of the backup directory
+var backupNamePattern = regexp.MustCompile(`^backup-\d{8}T\d{6}\.\d{3}Z$`)
+
+// backupRequest is the optional JSON body of CreateBackup
+type backupRequest struct {
+	IncludeManifest bool `json:"include_manifest"` // List every photo file alongside the database
+}
+
+// backupInfo describes a backup in listings and job results
+type backupInfo struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	Manifest    bool      `json:"manifest"`
+	CreatedAt   time.Time `json:"created_at"`
+	DownloadURL string    `json:"download_url"`
+	ManifestURL string    `json:"manifest_url,omitempty"`
+}
+
+// manifestPhoto is a photo file listed in a backup manifest
+type manifestPhoto struct {
+	ID          uuid.UUID  `json:"id"`
+	TenantID    string     `json:"tenant_id,omitempty"`
+	LibraryID   uuid.UUID  `json:"library_id"`
+	FilePath    string     `json:"file_path"`
+	FileSize    int64      `json:"file_size"`
+	Checksum    string     `json:"checksum,omitempty"`
+	StorageTier string     `json:"storage_tier"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // In the trash
+}
+
+// CreateBackup snapshots the database into the backup directory as a
+// background job, with a manifest of every photo file when asked for. The
+// job's result describes the backup.
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	if h.db.Dialector.Name() != database.DriverSQLite {
+		apierror.Respond(c, http.StatusNotImplemented, "backup_unsupported", "Online backups are only supported for SQLite, back up PostgreSQL with pg_dump")
+		return
+	}
+
+	var req backupRequest
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+			respondValidationError(c, err)
+			return
+		}
+	}
+
+	job, err := h.jobs.SubmitFor(requestTenant(c), "database_backup", func(ctx context.Context, job *jobs.Job) error {
+		job.SetTotal(1)
+		info, err := h.backup(ctx, req.IncludeManifest)
+		if err != nil {
+			return err
+		}
+		job.AddResult(info)
+		return nil
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule backup job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// backup writes a new backup, and its manifest when includeManifest is set
+func (h *BackupHandler) backup(ctx context.Context, includeManifest bool) (*backupInfo, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(h.config.BackupDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := "backup-" + time.Now().UTC().Format(backupTimeFormat)
+	path := h.backupPath(name)
+	if err := database.Backup(ctx, h.db, path); err != nil {
+		return nil, err
+	}
+	if includeManifest {
+		if err := writeBackupManifest(path, h.manifestPath(name), name); err != nil {
+			return nil, err
+		}
+	}
+	return h.backupInfo(name)
+}
+
+// writeBackupManifest lists the photo files recorded in the backup at
+// dbPath, so the manifest matches the database it comes with. Photos are
+// streamed from the backup rather than held in memory.
+func writeBackupManifest(dbPath, path, name string) (err error) {
+	snapshot, err := database.OpenSnapshot(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.CloseSnapshot(snapshot)
+
+	rows, err := snapshot.Table("photos").
+		Select("id, tenant_id, library_id, file_path, file_size, COALESCE(checksum, '') AS checksum, storage_tier, deleted_at").
+		Order("id").Rows()
+	if err != nil {
+		return fmt.Errorf("failed to list photos in backup: %w", err)
+	}
+	defer rows.Close()
+
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	defer func() {
+		file.Close()
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	header, _ := json.Marshal(struct {
+		Backup    string    `json:"backup"`
+		CreatedAt time.Time `json:"created_at"`
+	}{name + ".db", time.Now().UTC()})
+	// The photos array goes where the header's closing brace was
+	if _, err := file.Write(append(header[:len(header)-1], `,"photos":[`...)); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	for first := true; rows.Next(); first = false {
+		var photo manifestPhoto
+		if err := snapshot.ScanRows(rows, &photo); err != nil {
+			return fmt.Errorf("failed to read photo from backup: %w", err)
+		}
+		if !first {
+			if _, err := file.WriteString(","); err != nil {
+				return fmt.Errorf("failed to write manifest: %w", err)
+			}
+		}
+		if err := encoder.Encode(photo); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list photos in backup: %w", err)
+	}
+	if _, err := file.WriteString("]}\n"); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move manifest into place: %w", err)
+	}
+	return nil
+}
+
+// GetBackups lists the backups in the backup directory, newest first
+func (h *BackupHandler) GetBackups(c *gin.Context) {
+	entries, err := os.ReadDir(h.config.BackupDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read backup directory")
+		return
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".db"); ok && backupNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	backups := []backupInfo{}
+	for _, name := range names {
+		info, err := h.backupInfo(name)
+		if err != nil {
+			continue // Removed since the directory was read
+		}
+		backups = append(backups, *info)
+	}
+	c.JSON(http.StatusOK, backups)
+}
+
+// DownloadBackup sends a backup's database file
+func (h *BackupHandler) DownloadBackup(c *gin.Context) {
+	h.sendBackupFile(c, h.backupPath(c.Param("name")), c.Param("name")+".db", "backup_not_found", "Backup not found")
+}
+
+// DownloadBackupManifest sends the manifest of a backup's photo files
+func (h *BackupHandler) DownloadBackupManifest(c *gin.Context) {
+	h.sendBackupFile(c, h.manifestPath(c.Param("name")), c.Param("name")+".manifest.json", "manifest_not_found", "Backup has no manifest")
+}
+
+// sendBackupFile sends a file of the backup named in the request as an
+// attachment, with notFoundCode when it doesn't exist
+func (h *BackupHandler) sendBackupFile(c *gin.Context, path, filename, notFoundCode, notFoundMessage string) {
+	if !backupNamePattern.MatchString(c.Param("name")) {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_backup_name", "Invalid backup name")
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		apierror.Respond(c, http.StatusNotFound, notFoundCode, notFoundMessage)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.File(path)
+}
+
+// backupInfo describes the backup called name
+func (h *BackupHandler) backupInfo(name string) (*backupInfo, error) {
+	stat, err := os.Stat(h.backupPath(name))
+	if err != nil {
+		return nil, err
+	}
+	createdAt, _ := time.Parse(backupTimeFormat, strings.TrimPrefix(name, "backup-"))
+
+	info := &backupInfo{
+		Name:        name,
+		Size:        stat.Size(),
+		CreatedAt:   createdAt,
+		DownloadURL: "/api/v1/admin/backups/" + name,
+	}
+	if _, err := os.Stat(h.manifestPath(name)); err == nil {
+		info.Manifest = true
+		info.ManifestURL = info.DownloadURL + "/manifest"
+	}
+	return info, nil
+}
+
+// backupPath returns where the database file of the backup called name is kept
+func (h *BackupHandler) backupPath(name string) string {
+	return filepath.Join(h.config.BackupDir, name+".db")
+}
+
+// manifestPath returns where the manifest of the backup called name is kept
+func (h *BackupHandler) manifestPath(name string) string {
+	return filepath.Join(h.config.BackupDir, name+".manifest.json")
+}
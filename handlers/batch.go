@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/middleware"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BatchHandler runs several API requests in one round trip
+type BatchHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	router http.Handler // The full API, for batches that aren't atomic
+}
+
+// NewBatchHandler creates a new batch handler. Sub-requests are dispatched to
+// router, which is normally the engine the handler itself is registered on.
+func NewBatchHandler(db *gorm.DB, cfg *config.Config, router http.Handler) *BatchHandler {
+	return &BatchHandler{db: db, config: cfg, router: router}
+}
+
+// batchRequest is one sub-request of a batch
+type batchRequest struct {
+	Method string          `json:"method" binding:"required,oneof=GET POST PUT DELETE"`
+	Path   string          `json:"path" binding:"required"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// batchResult is the outcome of one sub-request
+type batchResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"` // null for responses that aren't JSON
+}
+
+// executeBatchRequest is the JSON body of ExecuteBatch
+type executeBatchRequest struct {
+	Requests []batchRequest `json:"requests" binding:"required,min=1,max=50,dive"` // At most 50 sub-requests
+	Atomic   bool           `json:"atomic"`
+}
+
+// ExecuteBatch runs sub-requests in order and reports each one's status and
+// body. Atomic batches are limited to database-only operations, run in one
+// transaction, and stop and roll back at the first failure.
+func (h *BatchHandler) ExecuteBatch(c *gin.Context) {
+	var req executeBatchRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	for i, sub := range req.Requests {
+		if !strings.HasPrefix(sub.Path, "/api/v1/") && !strings.HasPrefix(sub.Path, "/api/v2/") {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, fmt.Sprintf("Request %d: path must start with /api/v1/ or /api/v2/", i))
+			return
+		}
+		if strings.HasSuffix(strings.SplitN(sub.Path, "?", 2)[0], "/batch") {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, fmt.Sprintf("Request %d: batches can't be nested", i))
+			return
+		}
+	}
+
+	if !req.Atomic {
+		results := make([]batchResult, 0, len(req.Requests))
+		for _, sub := range req.Requests {
+			results = append(results, dispatchBatchRequest(c.Request.Context(), h.router, sub))
+		}
+		c.JSON(http.StatusOK, gin.H{"atomic": false, "results": results})
+		return
+	}
+
+	tx := scopedDB(c, h.db).Begin()
+	if tx.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to start transaction")
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	// Handlers that open their own transaction get a savepoint inside this one
+	tx.Statement.ConnPool = &batchTx{ConnPool: tx.Statement.ConnPool}
+	router := h.atomicRouter(tx)
+
+	results := make([]batchResult, 0, len(req.Requests))
+	committed := true
+	for _, sub := range req.Requests {
+		result := dispatchBatchRequest(c.Request.Context(), router, sub)
+		results = append(results, result)
+		if result.Status >= http.StatusBadRequest {
+			committed = false
+			break
+		}
+	}
+
+	if committed {
+		if err := tx.Commit().Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to commit batch")
+			return
+		}
+	} else {
+		tx.Rollback()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"atomic": true, "committed": committed, "results": results})
+}
+
+// atomicRouter serves the database-only routes with handlers bound to tx.
+// Anything that touches files or queues jobs can't be rolled back and is
+// rejected.
+func (h *BatchHandler) atomicRouter(tx *gorm.DB) *gin.Engine {
+	albumHandler := NewAlbumHandler(tx, h.config)
+	photoHandler := NewPhotoHandler(tx, h.config, nil)
+	tagHandler := NewTagHandler(tx, h.config)
+	trashHandler := NewTrashHandler(tx, h.config, nil)
+
+	router := gin.New()
+	router.NoRoute(func(c *gin.Context) {
+		apierror.Respond(c, http.StatusBadRequest, "not_allowed_in_atomic_batch", "This operation can't be part of an atomic batch")
+	})
+
+	// Sub-requests are limited to the scope of the batch's API key
+	apiKeyAuth := middleware.APIKeyMiddleware(h.db, h.config)
+	v1 := router.Group("/api/v1", apiKeyAuth)
+	v2 := router.Group("/api/v2", middleware.EnvelopeMiddleware(), apiKeyAuth)
+	for _, api := range []*gin.RouterGroup{v1, v2} {
+		albums := api.Group("/albums")
+		{
+			albums.POST("", albumHandler.CreateAlbum)
+			albums.GET("/:id", albumHandler.GetAlbum)
+			albums.PUT("/:id", albumHandler.UpdateAlbum)
+			albums.DELETE("/:id", albumHandler.DeleteAlbum)
+			albums.POST("/:id/photos", albumHandler.AddPhotoToAlbum)
+			albums.DELETE("/:id/photos/:photo_id", albumHandler.RemovePhotoFromAlbum)
+			albums.POST("/:id/photos/remove", albumHandler.RemovePhotosFromAlbum)
+			albums.PUT("/:id/photos/:photo_id/order", albumHandler.UpdatePhotoOrder)
+			albums.PUT("/:id/cover", albumHandler.SetAlbumCover)
+		}
+
+		photos := api.Group("/photos")
+		{
+			photos.GET("/:id", photoHandler.GetPhoto)
+			photos.DELETE("/:id", photoHandler.DeletePhoto) // Files stay until the trash is purged
+			photos.POST("/:id/restore", trashHandler.RestorePhoto)
+			photos.POST("/:id/favorite", photoHandler.ToggleFavorite)
+			photos.GET("/:id/metadata", photoHandler.GetPhotoMetadata)
+			photos.PUT("/:id/metadata", photoHandler.SetPhotoMetadata)
+			photos.DELETE("/:id/metadata/:key", photoHandler.DeletePhotoMetadata)
+			// Rating write-back rewrites files
+			if h.config.XMPWriteback == "" || h.config.XMPWriteback == "off" {
+				photos.PUT("/:id", photoHandler.UpdatePhoto)
+			}
+		}
+
+		tags := api.Group("/tags")
+		{
+			tags.POST("", tagHandler.CreateTag)
+			tags.GET("/:id", tagHandler.GetTag)
+			tags.PUT("/:id", tagHandler.UpdateTag)
+			tags.DELETE("/:id", tagHandler.DeleteTag)
+			tags.POST("/:id/photos", tagHandler.AddTagToPhoto)
+			tags.DELETE("/:id/photos/:photo_id", tagHandler.RemoveTagFromPhoto)
+			tags.POST("/:id/albums", tagHandler.AddTagToAlbum)
+			tags.DELETE("/:id/albums/:album_id", tagHandler.RemoveTagFromAlbum)
+		}
+	}
+	return router
+}
+
+// dispatchBatchRequest runs one sub-request against router in-process
+func dispatchBatchRequest(ctx context.Context, router http.Handler, sub batchRequest) batchResult {
+	r, err := http.NewRequestWithContext(ctx, sub.Method, sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		message, _ := json.Marshal(apierror.Body(apierror.CodeValidation, "Invalid request path"))
+		return batchResult{Status: http.StatusBadRequest, Body: message}
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	w := &batchResponseWriter{header: http.Header{}}
+	router.ServeHTTP(w, r)
+
+	result := batchResult{Status: w.status}
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+	if strings.HasPrefix(w.header.Get("Content-Type"), "application/json") && json.Valid(w.body.Bytes()) {
+		result.Body = w.body.Bytes()
+	}
+	return result
+}
+
+// batchResponseWriter collects a sub-request's response in memory
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+func (w *batchResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *batchResponseWriter) Flush() {}
+
+// batchTx is the connection pool of an atomic batch's transaction. Beginning
+// a transaction on it opens a savepoint, so handlers that manage their own
+// transactions commit into and roll back within the batch.
+type batchTx struct {
+	gorm.ConnPool
+	savepoints int
+}
+
+// BeginTx implements gorm.ConnPoolBeginner
+func (t *batchTx) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	t.savepoints++
+	name := fmt.Sprintf("batch_%d", t.savepoints)
+	if _, err := t.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return nil, err
+	}
+	return &batchSavepoint{ConnPool: t.ConnPool, name: name}, nil
+}
+
+// Commit implements gorm.TxCommitter for the batch's own transaction
+func (t *batchTx) Commit() error {
+	return t.ConnPool.(gorm.TxCommitter).Commit()
+}
+
+// Rollback implements gorm.TxCommitter for the batch's own transaction
+func (t *batchTx) Rollback() error {
+	return t.ConnPool.(gorm.TxCommitter).Rollback()
+}
+
+// batchSavepoint is a handler's transaction within an atomic batch
+type batchSavepoint struct {
+	gorm.ConnPool
+	name string
+}
+
+// Commit releases the savepoint, keeping its changes in the batch transaction
+func (s *batchSavepoint) Commit() error {
+	_, err := s.ExecContext(context.Background(), "RELEASE SAVEPOINT "+s.name)
+	return err
+}
+
+// Rollback undoes the changes made since the savepoint
+func (s *batchSavepoint) Rollback() error {
+	_, err := s.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT "+s.name)
+	if err != nil {
+		return err
+	}
+	_, err = s.ExecContext(context.Background(), "RELEASE SAVEPOINT "+s.name)
+	return err
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-library-server/apikeys"
+	"photo-library-server/config"
+	"photo-library-server/documents"
+	"photo-library-server/raw"
+	"photo-library-server/thumbnails"
+	"photo-library-server/video"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API and server versions reported to clients
+const (
+	APIVersion    = "v1"
+	ServerVersion = "1.0.0"
+)
+
+// CapabilitiesHandler reports what this server supports and how it is configured
+type CapabilitiesHandler struct {
+	config *config.Config
+}
+
+// NewCapabilitiesHandler creates a new capabilities handler
+func NewCapabilitiesHandler(cfg *config.Config) *CapabilitiesHandler {
+	return &CapabilitiesHandler{config: cfg}
+}
+
+// GetCapabilities returns upload limits, optional subsystems and the API
+// version so clients can adapt instead of hardcoding server settings
+func (h *CapabilitiesHandler) GetCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"api_version":    APIVersion,
+		"api_versions":   []string{"v1", "v2"}, // v2 wraps responses in a {data, meta, errors} envelope
+		"server_version": ServerVersion,
+		"uploads": gin.H{
+			"max_file_size":   h.config.MaxFileSize,
+			"allowed_types":   h.config.AllowedTypes,
+			"max_concurrent":  h.config.MaxConcurrentUploads, // More are turned away with 503, 0 means unlimited
+			"timeout_seconds": int64(h.config.UploadTimeout.Seconds()),
+		},
+		"downloads": gin.H{
+			"rate_limit":        h.config.DownloadRateLimit,
+			"global_rate_limit": h.config.GlobalDownloadRateLimit,
+			"offload":           h.config.FileOffload,
+		},
+		"features": gin.H{
+			"thumbnails": gin.H{
+				"enabled": true,
+				"sizes":   thumbnails.Sizes,
+			},
+			"signed_urls": gin.H{
+				"enabled":     h.config.URLSigningSecret != "",
+				"required":    h.config.RequireSignedURLs && h.config.URLSigningSecret != "",
+				"ttl_seconds": int64(h.config.SignedURLTTL.Seconds()),
+			},
+			"api_keys": gin.H{
+				"required": h.config.RequireAPIKey,
+				"header":   apikeys.Header,
+				"scopes":   apikeys.Scopes,
+			},
+			"tenants": gin.H{
+				"mode": h.config.TenantMode,
+			},
+			"cdn": gin.H{
+				"enabled": h.config.CDNBaseURL != "",
+				"signed":  h.config.CDNBaseURL != "" && (h.config.CDNSigningSecret != "" || h.config.URLSigningSecret != ""),
+			},
+			"storage_alerts": gin.H{
+				"enabled": len(h.config.StorageAlertThresholds) > 0 && h.config.StorageCheckInterval > 0,
+				"webhook": h.config.AlertWebhookURL != "",
+				"email":   h.config.AlertEmailTo != "" && h.config.SMTPAddr != "",
+			},
+			"cold_storage": gin.H{
+				"enabled":   h.config.ColdStoragePath != "",
+				"automatic": h.config.ColdStoragePath != "" && h.config.ColdStorageAfterMonths > 0,
+			},
+			"trash": gin.H{
+				"retention_days": h.config.TrashRetentionDays, // Default for libraries without their own, 0 keeps deleted photos until the trash is emptied
+			},
+			"geocoding": gin.H{
+				"provider": h.config.Geocoder, // "off", "offline" or "nominatim"
+			},
+			"classification": gin.H{
+				"enabled":   h.config.Classifier != "" && h.config.Classifier != "off",
+				"on_upload": h.config.ClassifyOnUpload,
+			},
+			"xmp_writeback":     h.config.XMPWriteback,
+			"dedupe_uploads":    h.config.DedupeUploads, // Default for uploads, see the dedupe form field
+			"tag_normalization": tagNamePolicy(h.config).String(),
+			"motion_photos":     true,
+			"raw":               gin.H{"enabled": true, "formats": raw.Names()},
+			"documents":         gin.H{"enabled": true, "types": []string{documents.MimeType}}, // Per library, see accept_documents
+			"encryption":        gin.H{"enabled": h.config.EncryptionSecret != ""},             // Per library, see encrypted
+			"video":             gin.H{"enabled": h.videoEnabled(), "types": video.MimeTypes, "poster_frames": video.PostersAvailable()},
+			"faces":             gin.H{"enabled": h.config.FaceDetector != "" && h.config.FaceDetector != "off", "on_upload": h.config.DetectFacesOnUpload},
+			"shares":            gin.H{"enabled": false},
+		},
+	})
+}
+
+// videoEnabled reports whether any video type may be uploaded
+func (h *CapabilitiesHandler) videoEnabled() bool {
+	for _, allowedType := range h.config.AllowedTypes {
+		if video.IsVideoType(allowedType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"photo-library-server/alerts"
+	"photo-library-server/apierror"
+	"photo-library-server/diskspace"
+	"photo-library-server/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// volumeUsage describes a volume holding library directories or cold storage
+type volumeUsage struct {
+	ID          string   `json:"id"`
+	Paths       []string `json:"paths"` // Directories on this volume
+	TotalBytes  int64    `json:"total_bytes"`
+	FreeBytes   int64    `json:"free_bytes"`
+	UsedPercent float64  `json:"used_percent"`
+}
+
+// newVolumeUsage rounds a volume's figures for responses and alerts
+func newVolumeUsage(volume diskspace.Volume) *volumeUsage {
+	return &volumeUsage{
+		ID:          volume.ID,
+		TotalBytes:  volume.Total,
+		FreeBytes:   volume.Free,
+		UsedPercent: math.Round(volume.UsedPercent()*10) / 10,
+	}
+}
+
+// collectVolumes groups directories by the volume they are on, skipping ones
+// whose usage can't be read (missing directories, unsupported platforms)
+func collectVolumes(dirs []string) []*volumeUsage {
+	var volumes []*volumeUsage
+	byID := map[string]*volumeUsage{}
+	for _, dir := range dirs {
+		volume, err := diskspace.Usage(dir)
+		if err != nil {
+			continue
+		}
+		usage, ok := byID[volume.ID]
+		if !ok {
+			usage = newVolumeUsage(volume)
+			byID[volume.ID] = usage
+			volumes = append(volumes, usage)
+		}
+		usage.Paths = append(usage.Paths, dir)
+	}
+	return volumes
+}
+
+// GetUsage reports free space on the volumes holding libraries and the total
+// size of stored photos. Tenants only see their own libraries and photos.
+func (h *StorageHandler) GetUsage(c *gin.Context) {
+	var libraries []models.Library
+	if err := scopedDB(c, h.db).Find(&libraries).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch libraries")
+		return
+	}
+
+	// Photos in the trash still take up space
+	var photoBytes int64
+	scopedDB(c, h.db).Unscoped().Model(&models.Photo{}).
+		Select("COALESCE(SUM(file_size), 0)").
+		Row().Scan(&photoBytes)
+
+	dirs := make([]string, 0, len(libraries)+1)
+	for _, library := range libraries {
+		dirs = append(dirs, library.Images)
+	}
+
+	response := gin.H{
+		"photo_bytes":      photoBytes,
+		"alert_thresholds": h.config.StorageAlertThresholds,
+	}
+
+	// Cold storage and the overall limit are shared by all tenants
+	if requestTenant(c) == "" {
+		if h.config.ColdStoragePath != "" {
+			dirs = append(dirs, h.config.ColdStoragePath)
+		}
+		if h.config.StorageUsageLimit > 0 {
+			response["usage_limit"] = h.config.StorageUsageLimit
+			response["usage_percent"] = math.Round(float64(photoBytes)/float64(h.config.StorageUsageLimit)*1000) / 10
+		}
+	}
+
+	volumes := collectVolumes(dirs)
+	if volumes == nil {
+		volumes = []*volumeUsage{}
+	}
+	response["volumes"] = volumes
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CheckCapacity alerts through the configured notifiers when a volume or the
+// overall usage crosses one of the alert thresholds, and returns the alerts.
+// Each threshold alerts once until usage drops back below it.
+func (h *StorageHandler) CheckCapacity(ctx context.Context) []alerts.Alert {
+	var libraries []models.Library
+	if err := h.db.Find(&libraries).Error; err != nil {
+		slog.Warn("Failed to check storage capacity", "error", err)
+		return nil
+	}
+
+	dirs := make([]string, 0, len(libraries)+1)
+	for _, library := range libraries {
+		dirs = append(dirs, library.Images)
+	}
+	if h.config.ColdStoragePath != "" {
+		dirs = append(dirs, h.config.ColdStoragePath)
+	}
+
+	var fired []alerts.Alert
+	now := time.Now()
+	for _, volume := range collectVolumes(dirs) {
+		threshold, ok := h.crossedThreshold("volume:"+volume.ID, volume.UsedPercent)
+		if !ok {
+			continue
+		}
+		fired = append(fired, alerts.Alert{
+			Event:   "storage_capacity",
+			Message: fmt.Sprintf("Storage volume is %.0f%% full", volume.UsedPercent),
+			Details: map[string]interface{}{
+				"volume":       volume.ID,
+				"paths":        volume.Paths,
+				"threshold":    threshold,
+				"used_percent": volume.UsedPercent,
+				"free_bytes":   volume.FreeBytes,
+				"total_bytes":  volume.TotalBytes,
+			},
+			Time: now,
+		})
+	}
+
+	if limit := h.config.StorageUsageLimit; limit > 0 {
+		var photoBytes int64
+		h.db.Unscoped().Model(&models.Photo{}).Select("COALESCE(SUM(file_size), 0)").Row().Scan(&photoBytes)
+		percent := math.Round(float64(photoBytes)/float64(limit)*1000) / 10
+		if threshold, ok := h.crossedThreshold("usage", percent); ok {
+			fired = append(fired, alerts.Alert{
+				Event:   "storage_usage",
+				Message: fmt.Sprintf("Photos use %.0f%% of the storage limit", percent),
+				Details: map[string]interface{}{
+					"threshold":     threshold,
+					"usage_percent": percent,
+					"photo_bytes":   photoBytes,
+					"usage_limit":   limit,
+				},
+				Time: now,
+			})
+		}
+	}
+
+	notifiers := alerts.FromConfig(h.config)
+	for _, alert := range fired {
+		slog.Warn(alert.Message, "event", alert.Event)
+		if err := alerts.Send(ctx, notifiers, alert); err != nil {
+			slog.Warn("Failed to send storage alert", "error", err)
+		}
+	}
+	return fired
+}
+
+// crossedThreshold returns the highest alert threshold percent has reached
+// for key, and whether that is higher than at the previous check
+func (h *StorageHandler) crossedThreshold(key string, percent float64) (int, bool) {
+	level := 0
+	for _, threshold := range h.config.StorageAlertThresholds {
+		if threshold > 0 && percent >= float64(threshold) {
+			level = threshold
+		}
+	}
+
+	h.alertMu.Lock()
+	defer h.alertMu.Unlock()
+	previous := h.alerted[key]
+	h.alerted[key] = level
+	return level, level > previous
+}
+
+// StartCapacityMonitor runs CheckCapacity every interval until the returned
+// stop function is called. It does nothing without thresholds.
+func (h *StorageHandler) StartCapacityMonitor(interval time.Duration) (stop func()) {
+	if len(h.config.StorageAlertThresholds) == 0 || interval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				h.CheckCapacity(context.Background())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/classify"
+	"photo-library-server/config"
+	"photo-library-server/jobs"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"photo-library-server/thumbnails"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClassifyHandler suggests tags for photos with an image classifier in the
+// background, and handles reviewing the suggestions
+type ClassifyHandler struct {
+	db         *gorm.DB
+	config     *config.Config
+	jobs       *jobs.Manager
+	classifier classify.Classifier // nil when classification is off
+}
+
+// NewClassifyHandler creates a new classify handler
+func NewClassifyHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager, classifier classify.Classifier) *ClassifyHandler {
+	return &ClassifyHandler{db: db, config: cfg, jobs: jobManager, classifier: classifier}
+}
+
+// classifyResult is the per-photo outcome of a classify job
+type classifyResult struct {
+	PhotoID     uuid.UUID `json:"photo_id"`
+	Status      string    `json:"status"`      // "classified", "skipped" (a type that can't be rendered) or "failed"
+	Suggestions int       `json:"suggestions"` // New suggestions made
+	Error       string    `json:"error,omitempty"`
+}
+
+// RunClassify queues a job suggesting tags for the photos that haven't been
+// classified yet
+func (h *ClassifyHandler) RunClassify(c *gin.Context) {
+	if h.classifier == nil {
+		apierror.Respond(c, http.StatusBadRequest, "classifier_not_configured", "Image classification is not configured")
+		return
+	}
+
+	job, err := h.SubmitClassify(requestTenant(c), nil)
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule classify job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// SubmitClassify queues a background job suggesting tags for the given
+// photos, or for every photo that hasn't been classified when photoIDs is
+// nil. A tenant's job only covers that tenant's photos, an empty tenant
+// covers all of them. Failed photos are retried by the next job.
+func (h *ClassifyHandler) SubmitClassify(tenantID string, photoIDs []uuid.UUID) (*jobs.Job, error) {
+	return h.jobs.SubmitFor(tenantID, "classify", func(ctx context.Context, job *jobs.Job) error {
+		query := tenant.Scope(h.db, tenantID).
+			Select("id", "tenant_id", "library_id", "file_path", "encrypted")
+		if photoIDs != nil {
+			query = query.Where("id IN ?", photoIDs)
+		} else {
+			query = query.Where("classified_at IS NULL")
+		}
+
+		var photos []models.Photo
+		if err := query.Find(&photos).Error; err != nil {
+			return fmt.Errorf("failed to find photos to classify: %w", err)
+		}
+
+		job.SetTotal(len(photos))
+		for _, photo := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			job.AddResult(h.classifyPhoto(ctx, photo))
+		}
+		return nil
+	})
+}
+
+// classifyPhoto stores the classifier's suggestions for one photo. Labels
+// below the confidence threshold, ones the photo is already tagged with and
+// ones suggested before, even if rejected, are left out.
+func (h *ClassifyHandler) classifyPhoto(ctx context.Context, photo models.Photo) classifyResult {
+	result := classifyResult{PhotoID: photo.ID, Status: "classified"}
+	db := tenant.Scope(h.db, photo.TenantID)
+
+	image, err := analysisImage(h.config, &photo, classify.InputSize)
+	switch {
+	case err == thumbnails.ErrUnsupported:
+		result.Status = "skipped"
+	case err != nil:
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	default:
+		labels, err := h.classifier.Classify(ctx, image)
+		if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			return result
+		}
+		if result.Suggestions, err = h.suggestTags(db, &photo, labels); err != nil {
+			result.Status, result.Error = "failed", "Failed to store suggestions"
+			return result
+		}
+	}
+
+	if err := db.Model(&models.Photo{}).Where("id = ?", photo.ID).
+		Update("classified_at", time.Now()).Error; err != nil {
+		result.Status, result.Error = "failed", "Failed to update photo"
+	}
+	return result
+}
+
+// analysisImage renders the JPEG of a photo sent to a model, at most size
+// pixels wide and high. Videos are represented by their poster frame,
+// documents by their first page.
+func analysisImage(cfg *config.Config, photo *models.Photo, size int) ([]byte, error) {
+	if !photo.Encrypted {
+		return thumbnails.ResizeFile(photo.FilePath, size, size, thumbnails.FitContain)
+	}
+
+	data, err := readOriginal(cfg, photo)
+	if err != nil {
+		return nil, err
+	}
+	return thumbnails.ResizeData(data, size, size, thumbnails.FitContain)
+}
+
+// suggestTags stores labels as pending suggestions for a photo and returns
+// how many were new. Labels naming a tag alias are suggested as the tag.
+func (h *ClassifyHandler) suggestTags(db *gorm.DB, photo *models.Photo, labels []classify.Label) (int, error) {
+	var tagged []string
+	if err := db.Table("tags").
+		Joins("JOIN photo_tags ON photo_tags.tag_id = tags.id").
+		Where("photo_tags.photo_id = ?", photo.ID).
+		Pluck("tags.name", &tagged).Error; err != nil {
+		return 0, err
+	}
+	skip := make(map[string]bool, len(tagged))
+	for _, name := range tagged {
+		skip[name] = true
+	}
+
+	policy := tagNamePolicy(h.config)
+	suggested := 0
+	for _, label := range labels {
+		if label.Confidence < h.config.ClassifierMinConfidence {
+			continue
+		}
+		name := policy.Normalize(label.Name)
+		if name == "" || len([]rune(name)) > maxTagNameLength {
+			continue
+		}
+		if tag, err := findTagByName(db, name); err == nil {
+			name = tag.Name
+		} else if err != gorm.ErrRecordNotFound {
+			return suggested, err
+		}
+		if skip[name] {
+			continue
+		}
+		skip[name] = true
+
+		suggestion := models.TagSuggestion{
+			TenantID:   photo.TenantID,
+			PhotoID:    photo.ID,
+			Name:       name,
+			Confidence: label.Confidence,
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&suggestion)
+		if result.Error != nil {
+			return suggested, result.Error
+		}
+		suggested += int(result.RowsAffected)
+	}
+	return suggested, nil
+}
+
+// StartClassifyScheduler classifies new photos every interval until the
+// returned stop function is called. It does nothing if classification is off.
+func (h *ClassifyHandler) StartClassifyScheduler(interval time.Duration) (stop func()) {
+	if h.classifier == nil || interval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := h.SubmitClassify("", nil); err != nil {
+					slog.Warn("Failed to schedule classification", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// classifyUpload queues classification of a newly uploaded photo, if
+// classification on upload is enabled
+func (h *ClassifyHandler) classifyUpload(photo *models.Photo) {
+	if h == nil || h.classifier == nil || !h.config.ClassifyOnUpload {
+		return
+	}
+	if _, err := h.SubmitClassify(photo.TenantID, []uuid.UUID{photo.ID}); err != nil {
+		// The next scheduled pass picks the photo up
+		slog.Warn("Failed to queue classification", "photo_id", photo.ID, "error", err)
+	}
+}
+
+// GetSuggestions returns a page of tag suggestions, most confident first.
+// Only pending ones are listed unless status says otherwise.
+func (h *ClassifyHandler) GetSuggestions(c *gin.Context) {
+	query, err := h.filterSuggestions(c, scopedDB(c, h.db).Model(&models.TagSuggestion{}))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	page, limit := pagination(c)
+	suggestions := []models.TagSuggestion{}
+	if err := query.Order("confidence desc, created_at, id").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&suggestions).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch suggestions")
+		return
+	}
+
+	var total int64
+	countQuery, _ := h.filterSuggestions(c, scopedDB(c, h.db).Model(&models.TagSuggestion{}))
+	countQuery.Count(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"suggestions": suggestions,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetPhotoSuggestions returns the tag suggestions of a photo, most confident
+// first. Only pending ones are listed unless status says otherwise.
+func (h *ClassifyHandler) GetPhotoSuggestions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	if err := scopedDB(c, h.db).Select("id").First(&models.Photo{}, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	query, err := h.filterSuggestions(c, scopedDB(c, h.db).Where("photo_id = ?", id))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	suggestions := []models.TagSuggestion{}
+	if err := query.Order("confidence desc, name").Find(&suggestions).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch suggestions")
+		return
+	}
+
+	c.JSON(http.StatusOK, suggestions)
+}
+
+// reviewSuggestionsRequest is the JSON body of ReviewSuggestions
+type reviewSuggestionsRequest struct {
+	Accept []uuid.UUID `json:"accept" binding:"max=1000"` // Suggestions to apply as tags
+	Reject []uuid.UUID `json:"reject" binding:"max=1000"` // Suggestions to dismiss
+}
+
+// ReviewSuggestions accepts and rejects tag suggestions in one transaction.
+// Accepting tags the photo, creating the tag if needed; either can be
+// changed by reviewing the suggestion again.
+func (h *ClassifyHandler) ReviewSuggestions(c *gin.Context) {
+	var req reviewSuggestionsRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	if len(req.Accept)+len(req.Reject) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Provide suggestions to accept or reject")
+		return
+	}
+
+	statuses := make(map[uuid.UUID]string, len(req.Accept)+len(req.Reject))
+	for _, id := range req.Reject {
+		statuses[id] = models.SuggestionRejected
+	}
+	for _, id := range req.Accept {
+		if statuses[id] == models.SuggestionRejected {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Suggestions can't be both accepted and rejected")
+			return
+		}
+		statuses[id] = models.SuggestionAccepted
+	}
+	ids := make([]uuid.UUID, 0, len(statuses))
+	for id := range statuses {
+		ids = append(ids, id)
+	}
+
+	var suggestions []models.TagSuggestion
+	if err := scopedDB(c, h.db).Where("id IN ?", ids).Find(&suggestions).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch suggestions")
+		return
+	}
+	if len(suggestions) != len(ids) {
+		found := make(map[uuid.UUID]bool, len(suggestions))
+		for _, suggestion := range suggestions {
+			found[suggestion.ID] = true
+		}
+		missing := []uuid.UUID{}
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+		apierror.RespondWithDetails(c, http.StatusNotFound, "suggestion_not_found", "Suggestions not found", gin.H{"suggestion_ids": missing})
+		return
+	}
+
+	err := scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		for i := range suggestions {
+			suggestion := &suggestions[i]
+			suggestion.Status = statuses[suggestion.ID]
+			if suggestion.Status == models.SuggestionAccepted {
+				if err := h.applySuggestion(tx, suggestion); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(suggestion).Update("status", suggestion.Status).Error; err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update suggestions"}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// Helper methods
+
+// filterSuggestions applies the status, photo_id and min_confidence query
+// parameters of a suggestion list
+func (h *ClassifyHandler) filterSuggestions(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	switch status := c.DefaultQuery("status", models.SuggestionPending); status {
+	case models.SuggestionPending, models.SuggestionAccepted, models.SuggestionRejected:
+		query = query.Where("status = ?", status)
+	case "all":
+	default:
+		return nil, fmt.Errorf("Invalid status, use pending, accepted, rejected or all")
+	}
+
+	if photoID := c.Query("photo_id"); photoID != "" {
+		id, err := uuid.Parse(photoID)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid photo_id")
+		}
+		query = query.Where("photo_id = ?", id)
+	}
+
+	if value := c.Query("min_confidence"); value != "" {
+		confidence, err := strconv.ParseFloat(value, 64)
+		if err != nil || confidence < 0 || confidence > 1 {
+			return nil, fmt.Errorf("Invalid min_confidence, expected a number from 0 to 1")
+		}
+		query = query.Where("confidence >= ?", confidence)
+	}
+	return query, nil
+}
+
+// applySuggestion tags a suggestion's photo with the suggested tag, creating
+// the tag if it doesn't exist
+func (h *ClassifyHandler) applySuggestion(tx *gorm.DB, suggestion *models.TagSuggestion) error {
+	var photo models.Photo
+	if err := tx.Select("id", "library_id").First(&photo, suggestion.PhotoID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &photoOpError{http.StatusNotFound, "photo_not_found", "Photo not found"}
+		}
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo"}
+	}
+	if err := checkWritable(tx, photo.LibraryID); err != nil {
+		return err
+	}
+
+	tag, err := findTagByName(tx, suggestion.Name)
+	if err == gorm.ErrRecordNotFound {
+		tag = models.Tag{Name: suggestion.Name}
+		err = tx.Create(&tag).Error
+	}
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up tags"}
+	}
+
+	photoTag := models.PhotoTag{PhotoID: photo.ID, TagID: tag.ID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&photoTag).Error; err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to tag photo"}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"photo-library-server/signing"
+	"photo-library-server/thumbnails"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxDownloadURLTTL caps how long an issued download URL can stay valid
+const maxDownloadURLTTL = 7 * 24 * time.Hour
+
+// DownloadHandler issues temporary download URLs for photo originals
+type DownloadHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	signer *signing.Signer
+}
+
+// NewDownloadHandler creates a new download handler
+func NewDownloadHandler(db *gorm.DB, cfg *config.Config, signer *signing.Signer) *DownloadHandler {
+	return &DownloadHandler{db: db, config: cfg, signer: signer}
+}
+
+// downloadURLRequest is the JSON body of CreateDownloadURL
+type downloadURLRequest struct {
+	ExpiresIn int  `json:"expires_in"` // Seconds, defaults to SIGNED_URL_TTL
+	OneTime   bool `json:"one_time"`
+}
+
+// signedURLRequest is the JSON body of CreateSignedURL
+type signedURLRequest struct {
+	ExpiresIn int    `json:"expires_in"`                                    // Seconds, defaults to SIGNED_URL_TTL
+	Kind      string `json:"kind" binding:"omitempty,oneof=file thumbnail"` // What the URL serves, file by default
+	Size      string `json:"size"`                                          // Thumbnail size, small by default
+}
+
+// CreateDownloadURL returns a short-lived, optionally one-time URL for a
+// photo's original file that can be handed to services without API credentials
+func (h *DownloadHandler) CreateDownloadURL(c *gin.Context) {
+	var req downloadURLRequest
+
+	photo, expires, ok := h.prepareSignedURL(c, &req, &req.ExpiresIn)
+	if !ok {
+		return
+	}
+
+	path := "/api/v1/photos/" + photo.ID.String() + "/file"
+
+	var signed string
+	if req.OneTime {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create download URL")
+			return
+		}
+		signed = h.signer.SignPathOnce(path, expires, hex.EncodeToString(nonce))
+	} else {
+		signed = h.signer.SignPathUntil(path, expires)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"url":        requestBaseURL(c) + signed,
+		"path":       signed,
+		"expires_at": time.Unix(expires.Unix(), 0).UTC(),
+		"one_time":   req.OneTime,
+	})
+}
+
+// CreateSignedURL returns an expiring URL for a photo's file or thumbnail
+// that works without credentials, for embedding photos in external pages
+func (h *DownloadHandler) CreateSignedURL(c *gin.Context) {
+	var req signedURLRequest
+
+	photo, expires, ok := h.prepareSignedURL(c, &req, &req.ExpiresIn)
+	if !ok {
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = "file"
+	}
+	if req.Size != "" {
+		if req.Kind != "thumbnail" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "size only applies to thumbnails")
+			return
+		}
+		if _, ok := thumbnails.Sizes[req.Size]; !ok {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid size. Must be one of: small, medium")
+			return
+		}
+	}
+
+	// The size isn't part of the signature, like on thumbnail_url
+	signed := h.signer.SignPathUntil("/api/v1/photos/"+photo.ID.String()+"/"+req.Kind, expires)
+	if req.Size != "" {
+		signed += "&size=" + req.Size
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"url":        requestBaseURL(c) + signed,
+		"path":       signed,
+		"expires_at": time.Unix(expires.Unix(), 0).UTC(),
+	})
+}
+
+// prepareSignedURL binds the optional JSON body of a signed URL request into
+// req, then returns the photo and when the URL should expire. It writes the
+// error response and returns false when no URL can be issued.
+func (h *DownloadHandler) prepareSignedURL(c *gin.Context, req interface{}, expiresIn *int) (*models.Photo, time.Time, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return nil, time.Time{}, false
+	}
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(req); err != nil && err != io.EOF {
+			respondValidationError(c, err)
+			return nil, time.Time{}, false
+		}
+	}
+
+	if !h.signer.Enabled() {
+		apierror.Respond(c, http.StatusBadRequest, "url_signing_not_configured", "URL signing is not configured")
+		return nil, time.Time{}, false
+	}
+
+	ttl := h.config.SignedURLTTL
+	if *expiresIn != 0 {
+		ttl = time.Duration(*expiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > maxDownloadURLTTL {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "expires_in must be between 1 and 604800 seconds")
+		return nil, time.Time{}, false
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return nil, time.Time{}, false
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return nil, time.Time{}, false
+	}
+	return &photo, time.Now().Add(ttl), true
+}
+
+// requestBaseURL returns the scheme and host the client used to reach the server
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
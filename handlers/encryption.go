@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"os"
+	"photo-library-server/config"
+	"photo-library-server/encryption"
+	"photo-library-server/models"
+
+	"github.com/google/uuid"
+)
+
+// errEncryptionNotConfigured is returned when an encrypted library is used
+// without ENCRYPTION_SECRET
+var errEncryptionNotConfigured = errors.New("encryption is not configured")
+
+// libraryKey returns the key that encrypts a library's files
+func libraryKey(cfg *config.Config, libraryID uuid.UUID) ([]byte, error) {
+	if cfg.EncryptionSecret == "" {
+		return nil, errEncryptionNotConfigured
+	}
+	return encryption.DeriveKey(cfg.EncryptionSecret, libraryID.String()), nil
+}
+
+// openOriginal opens a photo's original file for reading, decrypting it if
+// it is stored encrypted. It also returns the plaintext size.
+func openOriginal(cfg *config.Config, photo *models.Photo) (io.ReadSeekCloser, int64, error) {
+	if !photo.Encrypted {
+		file, err := os.Open(photo.FilePath)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+		return file, info.Size(), nil
+	}
+
+	key, err := libraryKey(cfg, photo.LibraryID)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := encryption.Open(photo.FilePath, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, r.Size(), nil
+}
+
+// readOriginal returns the plaintext contents of a photo's original file
+func readOriginal(cfg *config.Config, photo *models.Photo) ([]byte, error) {
+	if !photo.Encrypted {
+		return os.ReadFile(photo.FilePath)
+	}
+
+	key, err := libraryKey(cfg, photo.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.ReadFile(photo.FilePath, key)
+}
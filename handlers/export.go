@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/repository"
+	"photo-library-server/thumbnails"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxExportPhotos caps how many photos a single ZIP export may contain
+const maxExportPhotos = 1000
+
+// exportFilter selects photos for an export the same way GET /photos filters them
+type exportFilter struct {
+	LibraryID *uuid.UUID        `json:"library_id"`
+	AlbumID   *uuid.UUID        `json:"album_id"`
+	Tag       string            `json:"tag"`
+	Rating    *int              `json:"rating" binding:"omitempty,min=0,max=5"`
+	Favorite  *bool             `json:"favorite"`
+	Query     string            `json:"q"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// exportRequest is the JSON body of ExportPhotos
+type exportRequest struct {
+	PhotoIDs []uuid.UUID   `json:"photo_ids" binding:"max=1000"`
+	Filter   *exportFilter `json:"filter"`
+	Size     string        `json:"size"` // "original" (default) or a thumbnail size
+	// EmbedMetadata writes each photo's current metadata into its file
+	EmbedMetadata bool `json:"embed_metadata"`
+}
+
+// ExportPhotos streams a ZIP archive of the selected photos, either by ID or
+// by filter, optionally replacing originals with a cached rendition
+func (h *PhotoHandler) ExportPhotos(c *gin.Context) {
+	var req exportRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	if (len(req.PhotoIDs) == 0) == (req.Filter == nil) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Provide either photo_ids or filter")
+		return
+	}
+
+	h.exportPhotos(c, req)
+}
+
+// exportPhotos streams the ZIP archive of a validated export request, for
+// ExportPhotos and DownloadPhotos alike
+func (h *PhotoHandler) exportPhotos(c *gin.Context, req exportRequest) {
+	if req.Size == "" {
+		req.Size = "original"
+	}
+	if _, ok := thumbnails.Sizes[req.Size]; !ok && req.Size != "original" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid size. Must be one of: original, small, medium")
+		return
+	}
+
+	var photos []models.Photo
+	if req.Filter != nil {
+		filter := repository.PhotoFilter{
+			Rating:   req.Filter.Rating,
+			Favorite: req.Filter.Favorite,
+			Text:     strings.TrimSpace(req.Filter.Query),
+			Metadata: req.Filter.Metadata,
+		}
+		if req.Filter.LibraryID != nil {
+			filter.LibraryID = *req.Filter.LibraryID
+		}
+		if req.Filter.Tag != "" {
+			filter.Tag = tagNamePolicy(h.config).Normalize(req.Filter.Tag)
+		}
+		query := repository.FilterPhotos(exportQuery(scopedDB(c, h.db), req.EmbedMetadata).Preload("Library").Model(&models.Photo{}), filter)
+		if req.Filter.AlbumID != nil {
+			query = query.Joins("JOIN album_photos ON photos.id = album_photos.photo_id").
+				Where("album_photos.album_id = ?", *req.Filter.AlbumID)
+		}
+
+		// Fetch one extra row to detect selections over the limit
+		if err := query.Order("photos.uploaded_at desc").Limit(maxExportPhotos + 1).Find(&photos).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photos")
+			return
+		}
+		if len(photos) > maxExportPhotos {
+			apierror.Respond(c, http.StatusBadRequest, "too_many_photos", fmt.Sprintf("Filter matches more than %d photos", maxExportPhotos))
+			return
+		}
+		if len(photos) == 0 {
+			apierror.Respond(c, http.StatusNotFound, "no_matching_photos", "No photos match the filter")
+			return
+		}
+	} else {
+		found, missing, err := photosInOrder(exportQuery(scopedDB(c, h.db), req.EmbedMetadata), req.PhotoIDs)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photos")
+			return
+		}
+		if len(missing) > 0 {
+			apierror.RespondWithDetails(c, http.StatusNotFound, "photo_not_found", "Photos not found", gin.H{"photo_ids": missing})
+			return
+		}
+		photos = found
+	}
+
+	streamPhotoArchive(c, h.config, photos, req.Size, fmt.Sprintf("photos-%s.zip", time.Now().UTC().Format("20060102-150405")), req.EmbedMetadata)
+}
+
+// downloadPhotosRequest is the JSON body of DownloadPhotos
+type downloadPhotosRequest struct {
+	PhotoIDs []uuid.UUID `json:"photo_ids" binding:"required,min=1,max=1000"`
+	Size     string      `json:"size"` // "original" (default) or a thumbnail size
+	// EmbedMetadata writes each photo's current metadata into its file
+	EmbedMetadata bool `json:"embed_metadata"`
+}
+
+// DownloadPhotos streams a ZIP archive of the given photos in the order
+// listed, for downloading a selection such as search results in one request
+func (h *PhotoHandler) DownloadPhotos(c *gin.Context) {
+	var req downloadPhotosRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	// Photos listed by ID are exported the same way in both endpoints
+	h.exportPhotos(c, exportRequest{PhotoIDs: req.PhotoIDs, Size: req.Size, EmbedMetadata: req.EmbedMetadata})
+}
+
+// photosInOrder loads photos with their libraries in the order of ids,
+// dropping duplicate IDs, and returns the IDs that weren't found
+func photosInOrder(db *gorm.DB, ids []uuid.UUID) ([]models.Photo, []uuid.UUID, error) {
+	var found []models.Photo
+	if err := db.Preload("Library").Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[uuid.UUID]models.Photo, len(found))
+	for _, photo := range found {
+		byID[photo.ID] = photo
+	}
+
+	var photos []models.Photo
+	var missing []uuid.UUID
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		photo, ok := byID[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		photos = append(photos, photo)
+	}
+	return photos, missing, nil
+}
+
+// DownloadAlbum streams a ZIP archive of an album's photos in album order,
+// named after their original filenames. Photos are read one at a time, so
+// albums of any size stream without being held in memory.
+func (h *AlbumHandler) DownloadAlbum(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return
+	}
+
+	size := c.DefaultQuery("size", "original")
+	if _, ok := thumbnails.Sizes[size]; !ok && size != "original" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid size. Must be one of: original, small, medium")
+		return
+	}
+	embed := c.Query("embed_metadata") == "true"
+
+	var album models.Album
+	if err := scopedDB(c, h.db).First(&album, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return
+	}
+
+	var photos []models.Photo
+	if err := exportQuery(scopedDB(c, h.db), embed).Preload("Library").
+		Joins("JOIN album_photos ON photos.id = album_photos.photo_id").
+		Where("album_photos.album_id = ?", id).
+		Order(albumSortOrder(album)).
+		Order("photos.id").
+		Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos")
+		return
+	}
+	if len(photos) == 0 {
+		apierror.Respond(c, http.StatusNotFound, "album_empty", "Album has no photos")
+		return
+	}
+
+	streamPhotoArchive(c, h.config, photos, size, archiveName(album.Name)+".zip", embed)
+}
+
+// archiveName makes name safe to use as a download filename
+func archiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`"\/:*?<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		return "album"
+	}
+	return name
+}
+
+// exportQuery loads photos' tags along with them when their metadata is to
+// be embedded
+func exportQuery(db *gorm.DB, embed bool) *gorm.DB {
+	if embed {
+		return db.Preload("Tags")
+	}
+	return db
+}
+
+// streamPhotoArchive writes photos as a ZIP attachment called filename,
+// optionally replacing originals with a cached rendition at size. With embed,
+// JPEG entries carry the photo's current metadata and other formats get an
+// XMP sidecar entry next to them.
+func streamPhotoArchive(c *gin.Context, cfg *config.Config, photos []models.Photo, size, filename string, embed bool) {
+	// Check files up front since errors can't be reported once streaming starts
+	var unavailable []uuid.UUID
+	for _, photo := range photos {
+		if _, err := os.Stat(photo.FilePath); os.IsNotExist(err) {
+			unavailable = append(unavailable, photo.ID)
+		}
+	}
+	if len(unavailable) > 0 {
+		apierror.RespondWithDetails(c, http.StatusNotFound, "photo_file_not_found", "Photo files not found", gin.H{"photo_ids": unavailable})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	names := make(map[string]bool, len(photos))
+	for _, photo := range photos {
+		name := photo.OriginalName
+		var content io.Reader
+		isJPEG := photo.MimeType == "image/jpeg"
+		if size != "original" {
+			rendition, err := exportRendition(cfg, &photo, size)
+			switch {
+			case err == nil:
+				content = bytes.NewReader(rendition)
+				name = strings.TrimSuffix(name, filepath.Ext(name)) + ".jpg"
+				isJPEG = true
+			case err != thumbnails.ErrUnsupported:
+				slog.Warn("Failed to render photo for export", "photo_id", photo.ID, "error", err)
+			}
+			// Images that can't be resized are exported as originals
+		}
+
+		var original io.Closer
+		if content == nil {
+			file, _, err := openOriginal(cfg, &photo)
+			if err != nil {
+				// Headers are already sent, so abort and leave a truncated archive
+				c.Error(err)
+				return
+			}
+			content, original = file, file
+		}
+
+		var sidecar []byte
+		if embed {
+			fields := embeddedFields(&photo)
+			if isJPEG {
+				// Rewriting the file needs all of it, one photo at a time
+				data, err := io.ReadAll(content)
+				if err == nil {
+					data, err = metadata.Embed(data, fields)
+				}
+				if err != nil {
+					if original != nil {
+						original.Close()
+					}
+					c.Error(err)
+					return
+				}
+				content = bytes.NewReader(data)
+			} else {
+				sidecar = metadata.Sidecar(fields)
+			}
+		}
+
+		name = uniqueExportName(names, name)
+		err := writeExportEntry(archive, content, name, photo.UploadedAt)
+		if original != nil {
+			original.Close()
+		}
+		if err == nil && sidecar != nil {
+			err = writeExportEntry(archive, bytes.NewReader(sidecar), uniqueExportName(names, name+".xmp"), photo.UploadedAt)
+		}
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+// embeddedFields returns the metadata of photo, with its tags loaded, that
+// downloads embed in its file
+func embeddedFields(photo *models.Photo) metadata.Fields {
+	keywords := make([]string, len(photo.Tags))
+	for i, tag := range photo.Tags {
+		keywords[i] = tag.Name
+	}
+	return metadata.Fields{
+		Title:     photo.Title,
+		Caption:   photo.Caption,
+		Keywords:  keywords,
+		Rating:    photo.Rating,
+		Latitude:  photo.Latitude,
+		Longitude: photo.Longitude,
+	}
+}
+
+// exportRendition returns a photo's rendition at size, rendering it in memory
+// for encrypted photos since their renditions aren't cached
+func exportRendition(cfg *config.Config, photo *models.Photo, size string) ([]byte, error) {
+	if photo.Encrypted {
+		data, err := readOriginal(cfg, photo)
+		if err != nil {
+			return nil, err
+		}
+		return thumbnails.Render(data, size)
+	}
+
+	path, err := thumbnails.Ensure(photo.Library.Images, photo.FilePath, size)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// writeExportEntry copies content into the archive without recompressing it,
+// since image formats are already compressed
+func writeExportEntry(archive *zip.Writer, content io.Reader, name string, modified time.Time) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, content)
+	return err
+}
+
+// uniqueExportName returns name, or name with a " (n)" suffix if an entry
+// with that name is already in the archive
+func uniqueExportName(used map[string]bool, name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "photo"
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/faces"
+	"photo-library-server/jobs"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"photo-library-server/thumbnails"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FaceHandler finds faces in photos in the background and clusters them into
+// people, and handles naming and correcting the people
+type FaceHandler struct {
+	db       *gorm.DB
+	config   *config.Config
+	jobs     *jobs.Manager
+	detector faces.Detector // nil when face detection is off
+	cluster  sync.Mutex     // Jobs run side by side, but assign faces to people one at a time
+}
+
+// NewFaceHandler creates a new face handler
+func NewFaceHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager, detector faces.Detector) *FaceHandler {
+	return &FaceHandler{db: db, config: cfg, jobs: jobManager, detector: detector}
+}
+
+// faceDetectionResult is the per-photo outcome of a face detection job
+type faceDetectionResult struct {
+	PhotoID uuid.UUID `json:"photo_id"`
+	Status  string    `json:"status"` // "detected", "skipped" (a type that can't be rendered) or "failed"
+	Faces   int       `json:"faces"`  // Faces found
+	Error   string    `json:"error,omitempty"`
+}
+
+// RunFaceDetection queues a job finding the faces in photos that haven't been
+// scanned yet
+func (h *FaceHandler) RunFaceDetection(c *gin.Context) {
+	if h.detector == nil {
+		apierror.Respond(c, http.StatusBadRequest, "face_detector_not_configured", "Face detection is not configured")
+		return
+	}
+
+	job, err := h.SubmitFaceDetection(requestTenant(c), nil)
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule face detection job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// SubmitFaceDetection queues a background job finding the faces in the given
+// photos, or in every photo that hasn't been scanned when photoIDs is nil. A
+// tenant's job only covers that tenant's photos, an empty tenant covers all
+// of them. Failed photos are retried by the next job.
+func (h *FaceHandler) SubmitFaceDetection(tenantID string, photoIDs []uuid.UUID) (*jobs.Job, error) {
+	return h.jobs.SubmitFor(tenantID, "detect_faces", func(ctx context.Context, job *jobs.Job) error {
+		query := tenant.Scope(h.db, tenantID).
+			Select("id", "tenant_id", "library_id", "file_path", "encrypted")
+		if photoIDs != nil {
+			query = query.Where("id IN ?", photoIDs)
+		} else {
+			query = query.Where("faces_found_at IS NULL")
+		}
+
+		var photos []models.Photo
+		if err := query.Find(&photos).Error; err != nil {
+			return fmt.Errorf("failed to find photos to scan for faces: %w", err)
+		}
+
+		job.SetTotal(len(photos))
+		for _, photo := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			job.AddResult(h.detectFaces(ctx, photo))
+		}
+		return nil
+	})
+}
+
+// detectFaces replaces the faces found in one photo and assigns each to the
+// most similar person, or to a new unnamed person when none is similar enough
+func (h *FaceHandler) detectFaces(ctx context.Context, photo models.Photo) faceDetectionResult {
+	result := faceDetectionResult{PhotoID: photo.ID, Status: "detected"}
+	db := tenant.Scope(h.db, photo.TenantID)
+
+	var found []faces.Face
+	image, err := analysisImage(h.config, &photo, faces.InputSize)
+	switch {
+	case err == thumbnails.ErrUnsupported:
+		result.Status = "skipped"
+	case err != nil:
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	default:
+		if found, err = h.detector.Detect(ctx, image); err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			return result
+		}
+	}
+
+	h.cluster.Lock()
+	defer h.cluster.Unlock()
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Scanning a photo again starts over rather than adding duplicates.
+		// People keep their centroids, so the faces join them again.
+		if err := tx.Where("photo_id = ?", photo.ID).Delete(&models.Face{}).Error; err != nil {
+			return err
+		}
+
+		var people []models.Person
+		if err := tx.Select("id", "centroid", "centroid_faces").Find(&people).Error; err != nil {
+			return err
+		}
+		taken := map[uuid.UUID]bool{} // Two faces in one photo are two people
+
+		for _, detected := range found {
+			if detected.Confidence < h.config.FaceMinConfidence {
+				continue
+			}
+
+			person := h.closestPerson(people, taken, detected.Embedding)
+			if person == nil {
+				people = append(people, models.Person{TenantID: photo.TenantID})
+				person = &people[len(people)-1]
+				if err := tx.Create(person).Error; err != nil {
+					return err
+				}
+			}
+			taken[person.ID] = true
+
+			centroid := faces.Mean(faces.DecodeEmbedding(person.Centroid), person.CentroidFaces, detected.Embedding)
+			person.Centroid, person.CentroidFaces = faces.EncodeEmbedding(centroid), person.CentroidFaces+1
+			if err := tx.Model(person).Updates(map[string]interface{}{
+				"centroid":       person.Centroid,
+				"centroid_faces": person.CentroidFaces,
+			}).Error; err != nil {
+				return err
+			}
+
+			face := models.Face{
+				TenantID:   photo.TenantID,
+				PhotoID:    photo.ID,
+				PersonID:   &person.ID,
+				X:          detected.Box.X,
+				Y:          detected.Box.Y,
+				Width:      detected.Box.Width,
+				Height:     detected.Box.Height,
+				Confidence: detected.Confidence,
+				Embedding:  faces.EncodeEmbedding(detected.Embedding),
+			}
+			if err := tx.Create(&face).Error; err != nil {
+				return err
+			}
+			result.Faces++
+		}
+
+		return tx.Model(&models.Photo{}).Where("id = ?", photo.ID).
+			Update("faces_found_at", time.Now()).Error
+	})
+	if err != nil {
+		result.Status, result.Faces, result.Error = "failed", 0, "Failed to store faces"
+	}
+	return result
+}
+
+// closestPerson returns the person whose centroid is most similar to
+// embedding, at least by the match threshold, skipping taken people
+func (h *FaceHandler) closestPerson(people []models.Person, taken map[uuid.UUID]bool, embedding []float32) *models.Person {
+	var closest *models.Person
+	best := h.config.FaceMatchThreshold
+	for i := range people {
+		if taken[people[i].ID] {
+			continue
+		}
+		if similarity := faces.Similarity(faces.DecodeEmbedding(people[i].Centroid), embedding); similarity >= best {
+			closest, best = &people[i], similarity
+		}
+	}
+	return closest
+}
+
+// StartFaceDetectionScheduler scans new photos for faces every interval until
+// the returned stop function is called. It does nothing if face detection is
+// off.
+func (h *FaceHandler) StartFaceDetectionScheduler(interval time.Duration) (stop func()) {
+	if h.detector == nil || interval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := h.SubmitFaceDetection("", nil); err != nil {
+					slog.Warn("Failed to schedule face detection", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// detectUploadFaces queues face detection for a newly uploaded photo, if
+// detection on upload is enabled
+func (h *FaceHandler) detectUploadFaces(photo *models.Photo) {
+	if h == nil || h.detector == nil || !h.config.DetectFacesOnUpload {
+		return
+	}
+	if _, err := h.SubmitFaceDetection(photo.TenantID, []uuid.UUID{photo.ID}); err != nil {
+		// The next scheduled pass picks the photo up
+		slog.Warn("Failed to queue face detection", "photo_id", photo.ID, "error", err)
+	}
+}
+
+// GetPhotoFaces returns the faces found in a photo with their people, largest
+// first
+func (h *FaceHandler) GetPhotoFaces(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	if err := scopedDB(c, h.db).Select("id").First(&models.Photo{}, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	found := []models.Face{}
+	if err := scopedDB(c, h.db).Preload("Person").Where("photo_id = ?", id).
+		Order("width * height desc, id").Find(&found).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch faces")
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// updateFaceRequest is the JSON body of UpdateFace
+type updateFaceRequest struct {
+	PersonID *uuid.UUID `json:"person_id"` // null takes the face away from its person
+}
+
+// UpdateFace moves a face to another person, correcting the clustering. The
+// centroids of both people are recomputed from their faces.
+func (h *FaceHandler) UpdateFace(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_face_id", "Invalid face ID")
+		return
+	}
+
+	var req updateFaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	h.cluster.Lock()
+	defer h.cluster.Unlock()
+
+	var face models.Face
+	err = scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&face, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return &photoOpError{http.StatusNotFound, "face_not_found", "Face not found"}
+			}
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch face"}
+		}
+
+		if req.PersonID != nil {
+			if err := tx.Select("id").First(&models.Person{}, *req.PersonID).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return &photoOpError{http.StatusNotFound, "person_not_found", "Person not found"}
+				}
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch person"}
+			}
+		}
+
+		previous := face.PersonID
+		face.PersonID = req.PersonID
+		if err := tx.Model(&face).Update("person_id", face.PersonID).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update face"}
+		}
+		for _, personID := range []*uuid.UUID{previous, face.PersonID} {
+			if personID == nil {
+				continue
+			}
+			if err := recomputeCentroid(tx, *personID); err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update person"}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	if err := scopedDB(c, h.db).Preload("Person").First(&face, face.ID).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch face")
+		return
+	}
+	c.JSON(http.StatusOK, face)
+}
+
+// recomputeCentroid sets a person's centroid to the mean embedding of their
+// faces. A person left without faces keeps their centroid, so faces found
+// later can still join them.
+func recomputeCentroid(tx *gorm.DB, personID uuid.UUID) error {
+	var embeddings [][]byte
+	if err := tx.Model(&models.Face{}).Where("person_id = ?", personID).
+		Pluck("embedding", &embeddings).Error; err != nil {
+		return err
+	}
+	if len(embeddings) == 0 {
+		return nil
+	}
+
+	var centroid []float32
+	for i, embedding := range embeddings {
+		centroid = faces.Mean(centroid, i, faces.DecodeEmbedding(embedding))
+	}
+	return tx.Model(&models.Person{}).Where("id = ?", personID).Updates(map[string]interface{}{
+		"centroid":       faces.EncodeEmbedding(centroid),
+		"centroid_faces": len(embeddings),
+	}).Error
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FeedHandler serves Atom feeds of recent uploads, for feed readers and
+// photo frames following a library or album
+type FeedHandler struct {
+	db *gorm.DB
+}
+
+// NewFeedHandler creates a new feed handler
+func NewFeedHandler(db *gorm.DB) *FeedHandler {
+	return &FeedHandler{db: db}
+}
+
+// atomFeed is an Atom (RFC 4287) feed document
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Links     []atomLink `xml:"link"`
+	Summary   *atomText  `xml:"summary,omitempty"`
+	Content   atomText   `xml:"content"`
+}
+
+// GetLibraryFeed serves /feeds/library/<id>.atom, the photos most recently
+// uploaded to a library
+func (h *FeedHandler) GetLibraryFeed(c *gin.Context) {
+	id, ok := feedID(c)
+	if !ok {
+		return
+	}
+
+	var library models.Library
+	if err := scopedDB(c, h.db).First(&library, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
+		return
+	}
+
+	_, limit := pagination(c)
+	var photos []models.Photo
+	if err := scopedDB(c, h.db).Where("library_id = ?", library.ID).
+		Order("uploaded_at DESC").Order("id").
+		Limit(limit).
+		Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photos")
+		return
+	}
+
+	writeFeed(c, atomFeed{
+		ID:       "urn:uuid:" + library.ID.String(),
+		Title:    library.Name,
+		Subtitle: library.Description,
+	}, library.UpdatedAt, photos)
+}
+
+// GetAlbumFeed serves /feeds/album/<id>.atom, the album's photos that were
+// uploaded most recently
+func (h *FeedHandler) GetAlbumFeed(c *gin.Context) {
+	id, ok := feedID(c)
+	if !ok {
+		return
+	}
+
+	var album models.Album
+	if err := scopedDB(c, h.db).First(&album, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return
+	}
+
+	_, limit := pagination(c)
+	var photos []models.Photo
+	if err := scopedDB(c, h.db).
+		Joins("JOIN album_photos ON album_photos.photo_id = photos.id").
+		Where("album_photos.album_id = ?", album.ID).
+		Order("photos.uploaded_at DESC").Order("photos.id").
+		Limit(limit).
+		Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos")
+		return
+	}
+
+	writeFeed(c, atomFeed{
+		ID:       "urn:uuid:" + album.ID.String(),
+		Title:    album.Name,
+		Subtitle: album.Description,
+	}, album.UpdatedAt, photos)
+}
+
+// feedID parses the ID out of the request's :feed, "<id>.atom", answering
+// the request when it isn't one
+func feedID(c *gin.Context) (uuid.UUID, bool) {
+	name, ok := strings.CutSuffix(c.Param("feed"), ".atom")
+	if !ok {
+		apierror.Respond(c, http.StatusNotFound, "feed_not_found", "Feeds are only served as .atom")
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(name)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_feed_id", "Invalid feed ID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// writeFeed fills in feed's entries from photos, newest first, and writes
+// it. The feed was last updated when its newest photo was, or at updated
+// when it has none.
+func writeFeed(c *gin.Context, feed atomFeed, updated time.Time, photos []models.Photo) {
+	base := requestBaseURL(c)
+	absolute := func(u string) string {
+		if strings.HasPrefix(u, "/") {
+			return base + u
+		}
+		return u // Already absolute, on a CDN
+	}
+
+	feed.Author = atomAuthor{Name: feed.Title}
+	feed.Links = []atomLink{{Rel: "self", Href: base + c.Request.URL.RequestURI(), Type: "application/atom+xml"}}
+	for _, photo := range photos {
+		if photo.UpdatedAt.After(updated) {
+			updated = photo.UpdatedAt
+		}
+
+		title := photo.Title
+		if title == "" {
+			title = photo.OriginalName
+		}
+		// Thumbnail URLs are signed on their path alone, so a size can be added
+		thumbnail := absolute(photo.ThumbnailURL)
+		if strings.Contains(thumbnail, "?") {
+			thumbnail += "&size=medium"
+		} else {
+			thumbnail += "?size=medium"
+		}
+		content := fmt.Sprintf(`<p><img src="%s" alt="%s"></p>`, html.EscapeString(thumbnail), html.EscapeString(title))
+		if photo.Caption != "" {
+			content += "<p>" + html.EscapeString(photo.Caption) + "</p>"
+		}
+
+		entry := atomEntry{
+			ID:        "urn:uuid:" + photo.ID.String(),
+			Title:     title,
+			Published: photo.UploadedAt.UTC().Format(time.RFC3339),
+			Updated:   photo.UpdatedAt.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "alternate", Href: absolute(photo.FileURL), Type: photo.MimeType},
+				{Rel: "enclosure", Href: thumbnail, Type: "image/jpeg"},
+			},
+			Content: atomText{Type: "html", Body: content},
+		}
+		if photo.Caption != "" {
+			entry.Summary = &atomText{Type: "text", Body: photo.Caption}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to render feed")
+		return
+	}
+	c.Data(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"photo-library-server/repository"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultNearRadiusKm = 1.0
+	maxNearRadiusKm     = 20000.0 // Half the Earth's circumference
+)
+
+// parseCoordinates parses a comma-separated list of exactly n numbers
+func parseCoordinates(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, errors.New("wrong number of coordinates")
+	}
+
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errors.New("invalid coordinate")
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// geoFilter reads the bbox and near/radius filters of a photo list request
+func geoFilter(bbox, near, radius string) (*repository.BoundingBox, *repository.Circle, error) {
+	var box *repository.BoundingBox
+	if bbox != "" {
+		values, err := parseCoordinates(bbox, 4)
+		if err != nil || !validLongitude(values[0]) || !validLatitude(values[1]) ||
+			!validLongitude(values[2]) || !validLatitude(values[3]) || values[1] > values[3] {
+			return nil, nil, errors.New("Invalid bbox, expected minLon,minLat,maxLon,maxLat")
+		}
+		box = &repository.BoundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	}
+
+	var circle *repository.Circle
+	if near != "" {
+		point, err := parseCoordinates(near, 2)
+		if err != nil || !validLatitude(point[0]) || !validLongitude(point[1]) {
+			return nil, nil, errors.New("Invalid near, expected lat,lon")
+		}
+
+		radiusKm := defaultNearRadiusKm
+		if radius != "" {
+			radiusKm, err = strconv.ParseFloat(radius, 64)
+			if err != nil || !(radiusKm > 0 && radiusKm <= maxNearRadiusKm) {
+				return nil, nil, errors.New("Invalid radius, expected kilometers between 0 and 20000")
+			}
+		}
+		circle = &repository.Circle{Lat: point[0], Lon: point[1], RadiusKm: radiusKm}
+	} else if radius != "" {
+		return nil, nil, errors.New("radius requires near")
+	}
+
+	return box, circle, nil
+}
+
+// samePosition reports whether two optional positions are equal
+func samePosition(lat1, lon1, lat2, lon2 *float64) bool {
+	if lat1 == nil || lon1 == nil || lat2 == nil || lon2 == nil {
+		return (lat1 == nil) == (lat2 == nil) && (lon1 == nil) == (lon2 == nil)
+	}
+	return *lat1 == *lat2 && *lon1 == *lon2
+}
+
+func validLatitude(lat float64) bool {
+	return lat >= -90 && lat <= 90
+}
+
+func validLongitude(lon float64) bool {
+	return lon >= -180 && lon <= 180
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/geocode"
+	"photo-library-server/jobs"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GeocodeHandler fills in the country, city and place of photos from their
+// GPS positions in the background
+type GeocodeHandler struct {
+	db       *gorm.DB
+	config   *config.Config
+	jobs     *jobs.Manager
+	provider geocode.Provider // nil when reverse geocoding is off
+}
+
+// NewGeocodeHandler creates a new geocode handler
+func NewGeocodeHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager, provider geocode.Provider) *GeocodeHandler {
+	return &GeocodeHandler{db: db, config: cfg, jobs: jobManager, provider: provider}
+}
+
+// geocodeResult is the per-photo outcome of a geocode job
+type geocodeResult struct {
+	PhotoID uuid.UUID `json:"photo_id"`
+	Status  string    `json:"status"` // "found", "not_found" or "failed"
+	Place   string    `json:"place,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// RunGeocode queues a job looking up the places of photos whose positions
+// haven't been looked up yet
+func (h *GeocodeHandler) RunGeocode(c *gin.Context) {
+	if h.provider == nil {
+		apierror.Respond(c, http.StatusBadRequest, "geocoding_not_configured", "Reverse geocoding is not configured")
+		return
+	}
+
+	job, err := h.SubmitGeocode(requestTenant(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule geocode job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// SubmitGeocode queues a background job looking up the place of every photo
+// with a position that hasn't been looked up. A tenant's job only covers that
+// tenant's photos, an empty tenant covers all of them. Failed lookups are
+// retried by the next job.
+func (h *GeocodeHandler) SubmitGeocode(tenantID string) (*jobs.Job, error) {
+	return h.jobs.SubmitFor(tenantID, "geocode", func(ctx context.Context, job *jobs.Job) error {
+		db := tenant.Scope(h.db, tenantID)
+
+		var photos []models.Photo
+		if err := db.Select("id", "latitude", "longitude").
+			Where("latitude IS NOT NULL AND longitude IS NOT NULL AND geocoded_at IS NULL").
+			Find(&photos).Error; err != nil {
+			return fmt.Errorf("failed to find photos to geocode: %w", err)
+		}
+
+		job.SetTotal(len(photos))
+		for _, photo := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			job.AddResult(h.geocodePhoto(ctx, db, photo))
+		}
+		return nil
+	})
+}
+
+// geocodePhoto looks up and stores the place of one photo
+func (h *GeocodeHandler) geocodePhoto(ctx context.Context, db *gorm.DB, photo models.Photo) geocodeResult {
+	result := geocodeResult{PhotoID: photo.ID, Status: "found"}
+
+	place, err := h.provider.Reverse(ctx, *photo.Latitude, *photo.Longitude)
+	if err != nil {
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+	if place == nil {
+		result.Status = "not_found"
+		place = &geocode.Place{}
+	}
+	result.Place = place.Name
+
+	// Positions changed since they were read are left for the next job
+	if err := db.Model(&models.Photo{}).
+		Where("id = ? AND latitude = ? AND longitude = ?", photo.ID, *photo.Latitude, *photo.Longitude).
+		Updates(map[string]interface{}{
+			"country":     place.CountryCode,
+			"city":        place.City,
+			"place":       place.Name,
+			"geocoded_at": time.Now(),
+		}).Error; err != nil {
+		result.Status, result.Error = "failed", "Failed to update photo"
+	}
+	return result
+}
+
+// StartGeocodeScheduler looks up the places of new positions every interval
+// until the returned stop function is called. It does nothing if reverse
+// geocoding is off.
+func (h *GeocodeHandler) StartGeocodeScheduler(interval time.Duration) (stop func()) {
+	if h.provider == nil || interval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := h.SubmitGeocode(""); err != nil {
+					slog.Warn("Failed to schedule geocoding", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// clearPlace resets the looked-up place of a photo whose position changed,
+// so the next geocode job looks it up again
+func clearPlace(photo *models.Photo) {
+	photo.Country, photo.City, photo.Place = "", "", ""
+	photo.GeocodedAt = nil
+}
@@ -0,0 +1,677 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"photo-library-server/repository"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+)
+
+// GraphQLHandler serves a read-only GraphQL API over libraries, albums,
+// photos and tags. Nested relations, such as an album's photos and their
+// tags, are resolved in one query per level rather than one per record.
+type GraphQLHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	schema graphql.Schema
+}
+
+// NewGraphQLHandler creates a new GraphQL handler
+func NewGraphQLHandler(db *gorm.DB, cfg *config.Config) *GraphQLHandler {
+	h := &GraphQLHandler{db: db, config: cfg}
+	schema, err := h.buildSchema()
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error()) // A mistake in the type definitions below
+	}
+	h.schema = schema
+	return h
+}
+
+// graphqlRequest is the JSON body of Query
+type graphqlRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Query runs a GraphQL query sent as a JSON body, or in the query,
+// operationName and variables parameters of a GET request
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	var req graphqlRequest
+
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid variables, expected a JSON object")
+				return
+			}
+		}
+		if req.Query == "" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "query is required")
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), graphqlLoadersKey{}, newGraphQLLoaders(scopedDB(c, h.db)))
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+
+	// Queries that couldn't run at all, such as ones that don't parse or ask
+	// for unknown fields, are the client's fault. Other failed fields leave
+	// the rest of the data and their errors.
+	status := http.StatusOK
+	if result.Data == nil && result.HasErrors() {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, result)
+}
+
+// buildSchema defines the GraphQL types. Fields are named like the JSON of
+// the REST API, and relations resolve through the request's batch loaders.
+func (h *GraphQLHandler) buildSchema() (graphql.Schema, error) {
+	var libraryType, albumType, photoType, tagType *graphql.Object
+
+	// bytes are sizes in bytes, which can exceed the 32-bit GraphQL Int
+	bytes := func(description string) *graphql.Field {
+		return &graphql.Field{Type: nonNull(graphql.Float), Description: description}
+	}
+	listOf := func(t graphql.Type) graphql.Output {
+		return nonNull(graphql.NewList(nonNull(t)))
+	}
+
+	libraryType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Library",
+		Description: "A photo library with its own storage directory",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":                   {Type: nonNull(graphql.ID)},
+				"name":                 {Type: nonNull(graphql.String)},
+				"description":          {Type: nonNull(graphql.String)},
+				"images":               {Type: nonNull(graphql.String), Description: "Directory the library's files are stored in"},
+				"import_keywords":      {Type: nonNull(graphql.Boolean)},
+				"thumbnail_mode":       {Type: nonNull(graphql.String)},
+				"accept_documents":     {Type: nonNull(graphql.Boolean)},
+				"encrypted":            {Type: nonNull(graphql.Boolean)},
+				"watch":                {Type: nonNull(graphql.Boolean)},
+				"read_only":            {Type: nonNull(graphql.Boolean)},
+				"quota_bytes":          bytes("Most bytes the library's photos may take up, 0 for no limit"),
+				"trash_retention_days": {Type: graphql.Int, Description: "Days deleted photos stay in the trash, null for the server's default"},
+				"created_at":           {Type: nonNull(graphql.DateTime)},
+				"updated_at":           {Type: nonNull(graphql.DateTime)},
+				"albums": {
+					Type:        listOf(albumType),
+					Description: "The library's albums, by name",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).libraryAlbums.load(p.Source.(*models.Library).ID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	albumType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Album",
+		Description: "An album of photos within a library",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":             {Type: nonNull(graphql.ID)},
+				"name":           {Type: nonNull(graphql.String)},
+				"description":    {Type: nonNull(graphql.String)},
+				"library_id":     {Type: nonNull(graphql.ID)},
+				"start_date":     {Type: graphql.DateTime, Description: "Earliest capture date of the album's photos"},
+				"end_date":       {Type: graphql.DateTime, Description: "Latest capture date of the album's photos"},
+				"cover_photo_id": {Type: graphql.ID, Description: "Chosen cover, null when the first photo stands in"},
+				"sort_mode":      {Type: nonNull(graphql.String), Description: "Order of the album's photos: manual, uploaded_at, taken_at, filename or rating"},
+				"created_at":     {Type: nonNull(graphql.DateTime)},
+				"updated_at":     {Type: nonNull(graphql.DateTime)},
+				"library": {
+					Type: nonNull(libraryType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).libraries.load(p.Source.(*models.Album).LibraryID), nil
+					},
+				},
+				"cover_photo": {
+					Type:        photoType,
+					Description: "The chosen cover, or the first photo in album order, null for empty albums",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).albumCovers.load(p.Source.(*models.Album).ID), nil
+					},
+				},
+				"photos": {
+					Type:        listOf(photoType),
+					Description: "The album's photos, in the order of its sort mode",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).albumPhotos.load(p.Source.(*models.Album).ID), nil
+					},
+				},
+				"tags": {
+					Type:        listOf(tagType),
+					Description: "Tags applied to the album, by name",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).albumTags.load(p.Source.(*models.Album).ID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	photoType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Photo",
+		Description: "A photo, video or document and its metadata",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":            {Type: nonNull(graphql.ID)},
+				"filename":      {Type: nonNull(graphql.String)},
+				"original_name": {Type: nonNull(graphql.String)},
+				"file_path":     {Type: nonNull(graphql.String)},
+				"mime_type":     {Type: nonNull(graphql.String)},
+				"file_size":     bytes("Size of the file in bytes"),
+				"checksum":      {Type: nonNull(graphql.String), Description: "SHA-256 of the file contents, hex encoded"},
+				"width":         {Type: nonNull(graphql.Int)},
+				"height":        {Type: nonNull(graphql.Int)},
+				"rating":        {Type: graphql.Int, Description: "0-5 stars, null when unrated"},
+				"title":         {Type: nonNull(graphql.String)},
+				"caption":       {Type: nonNull(graphql.String)},
+				"description":   {Type: nonNull(graphql.String)},
+				"favorite":      {Type: nonNull(graphql.Boolean)},
+				"storage_tier":  {Type: nonNull(graphql.String)},
+				"missing":       {Type: nonNull(graphql.Boolean)},
+				"corrupt":       {Type: nonNull(graphql.Boolean)},
+				"verified_at":   {Type: graphql.DateTime},
+				"library_id":    {Type: nonNull(graphql.ID)},
+				"taken_at":      {Type: graphql.DateTime},
+				"latitude":      {Type: graphql.Float},
+				"longitude":     {Type: graphql.Float},
+				"country":       {Type: nonNull(graphql.String)},
+				"city":          {Type: nonNull(graphql.String)},
+				"place":         {Type: nonNull(graphql.String)},
+				"has_motion":    {Type: nonNull(graphql.Boolean)},
+				"page_count":    {Type: nonNull(graphql.Int)},
+				"raw_format":    {Type: nonNull(graphql.String)},
+				"duration":      {Type: nonNull(graphql.Float), Description: "Length of a video in seconds, 0 for photos"},
+				"encrypted":     {Type: nonNull(graphql.Boolean)},
+				"uploaded_at":   {Type: nonNull(graphql.DateTime)},
+				"created_at":    {Type: nonNull(graphql.DateTime)},
+				"updated_at":    {Type: nonNull(graphql.DateTime)},
+				"file_url":      {Type: nonNull(graphql.String)},
+				"thumbnail_url": {Type: nonNull(graphql.String)},
+				"motion_url":    {Type: nonNull(graphql.String)},
+				"preview_url":   {Type: nonNull(graphql.String)},
+				"library": {
+					Type: nonNull(libraryType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).libraries.load(p.Source.(*models.Photo).LibraryID), nil
+					},
+				},
+				"albums": {
+					Type:        listOf(albumType),
+					Description: "Albums the photo is in, by name",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).photoAlbums.load(p.Source.(*models.Photo).ID), nil
+					},
+				},
+				"tags": {
+					Type:        listOf(tagType),
+					Description: "Tags applied to the photo, by name",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).photoTags.load(p.Source.(*models.Photo).ID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	tagType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Tag",
+		Description: "A textual tag applied to photos and albums",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":          {Type: nonNull(graphql.ID)},
+				"name":        {Type: nonNull(graphql.String)},
+				"description": {Type: nonNull(graphql.String)},
+				"color":       {Type: nonNull(graphql.String)},
+				"created_at":  {Type: nonNull(graphql.DateTime)},
+				"updated_at":  {Type: nonNull(graphql.DateTime)},
+				"photos": {
+					Type:        listOf(photoType),
+					Description: "Photos with the tag, most recently uploaded first",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).tagPhotos.load(p.Source.(*models.Tag).ID), nil
+					},
+				},
+				"albums": {
+					Type:        listOf(albumType),
+					Description: "Albums with the tag, by name",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p).tagAlbums.load(p.Source.(*models.Tag).ID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	idArgs := graphql.FieldConfigArgument{"id": {Type: nonNull(graphql.ID)}}
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"libraries": {
+				Type:        listOf(libraryType),
+				Description: "All libraries, by name",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var libraries []*models.Library
+					if err := loadersFrom(p).db.Order("name").Find(&libraries).Error; err != nil {
+						return nil, errors.New("Failed to fetch libraries")
+					}
+					return libraries, nil
+				},
+			},
+			"library": {
+				Type: libraryType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return findByID[models.Library](p, "library")
+				},
+			},
+			"albums": {
+				Type:        listOf(albumType),
+				Description: "Albums by name, optionally only those of a library or with a tag",
+				Args: graphql.FieldConfigArgument{
+					"library_id": {Type: graphql.ID},
+					"tag":        {Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					query := loadersFrom(p).db.Model(&models.Album{})
+					if value, ok := p.Args["library_id"].(string); ok {
+						id, err := uuid.Parse(value)
+						if err != nil {
+							return nil, errors.New("Invalid library ID")
+						}
+						query = query.Where("albums.library_id = ?", id)
+					}
+					if name, ok := p.Args["tag"].(string); ok {
+						query = whereTagName(query.Joins("JOIN album_tags ON albums.id = album_tags.album_id").
+							Joins("JOIN tags ON album_tags.tag_id = tags.id"), h.config, name)
+					}
+
+					var albums []*models.Album
+					if err := query.Order("albums.name").Find(&albums).Error; err != nil {
+						return nil, errors.New("Failed to fetch albums")
+					}
+					return albums, nil
+				},
+			},
+			"album": {
+				Type: albumType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return findByID[models.Album](p, "album")
+				},
+			},
+			"photos": {
+				Type:        listOf(photoType),
+				Description: "A page of photos, most recently uploaded first, optionally filtered",
+				Args: graphql.FieldConfigArgument{
+					"library_id": {Type: graphql.ID},
+					"tag":        {Type: graphql.String},
+					"favorite":   {Type: graphql.Boolean},
+					"rating":     {Type: graphql.Int},
+					"q":          {Type: graphql.String, Description: "Text to find in titles, captions, descriptions and filenames"},
+					"limit":      {Type: graphql.Int, DefaultValue: 50, Description: "Photos per page, 50 by default and at most 100"},
+					"offset":     {Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var filter repository.PhotoFilter
+					if value, ok := p.Args["library_id"].(string); ok {
+						id, err := uuid.Parse(value)
+						if err != nil {
+							return nil, errors.New("Invalid library ID")
+						}
+						filter.LibraryID = id
+					}
+					if name, ok := p.Args["tag"].(string); ok {
+						filter.Tag = tagNamePolicy(h.config).Normalize(name)
+					}
+					if favorite, ok := p.Args["favorite"].(bool); ok {
+						filter.Favorite = &favorite
+					}
+					if rating, ok := p.Args["rating"].(int); ok {
+						filter.Rating = &rating
+					}
+					if q, ok := p.Args["q"].(string); ok {
+						filter.Text = strings.TrimSpace(q)
+					}
+					query := repository.FilterPhotos(loadersFrom(p).db.Model(&models.Photo{}), filter)
+
+					// Out of range values fall back to the defaults, like page and limit do
+					limit, _ := p.Args["limit"].(int)
+					if limit <= 0 || limit > 100 {
+						limit = 50
+					}
+					offset, _ := p.Args["offset"].(int)
+					offset = max(offset, 0)
+
+					var photos []*models.Photo
+					if err := query.Order("photos.uploaded_at desc").Order("photos.id desc").
+						Offset(offset).Limit(limit).Find(&photos).Error; err != nil {
+						return nil, errors.New("Failed to fetch photos")
+					}
+					return photos, nil
+				},
+			},
+			"photo": {
+				Type: photoType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return findByID[models.Photo](p, "photo")
+				},
+			},
+			"tags": {
+				Type:        listOf(tagType),
+				Description: "All tags, by name",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var tags []*models.Tag
+					if err := loadersFrom(p).db.Order("name").Find(&tags).Error; err != nil {
+						return nil, errors.New("Failed to fetch tags")
+					}
+					return tags, nil
+				},
+			},
+			"tag": {
+				Type: tagType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return findByID[models.Tag](p, "tag")
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// nonNull marks a GraphQL type as never null
+func nonNull(t graphql.Type) *graphql.NonNull {
+	return graphql.NewNonNull(t)
+}
+
+// findByID resolves a top-level lookup by the id argument, to null when
+// there's no such record
+func findByID[T any](p graphql.ResolveParams, what string) (interface{}, error) {
+	id, err := uuid.Parse(p.Args["id"].(string))
+	if err != nil {
+		return nil, errors.New("Invalid " + what + " ID")
+	}
+
+	var record T
+	if err := loadersFrom(p).db.First(&record, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, errors.New("Failed to fetch " + what)
+	}
+	return &record, nil
+}
+
+type graphqlLoadersKey struct{}
+
+// graphqlLoaders batch the relations of one GraphQL request. Each field
+// resolver queues its record and returns a thunk; the executor resolves a
+// whole level of the response before running that level's thunks, so the
+// first thunk loads the relation for every queued record at once.
+type graphqlLoaders struct {
+	db *gorm.DB
+
+	libraries     *batchLoader[*models.Library]
+	libraryAlbums *batchLoader[[]*models.Album]
+	albumCovers   *batchLoader[*models.Photo]
+	albumPhotos   *batchLoader[[]*models.Photo]
+	albumTags     *batchLoader[[]*models.Tag]
+	photoAlbums   *batchLoader[[]*models.Album]
+	photoTags     *batchLoader[[]*models.Tag]
+	tagPhotos     *batchLoader[[]*models.Photo]
+	tagAlbums     *batchLoader[[]*models.Album]
+}
+
+func newGraphQLLoaders(db *gorm.DB) *graphqlLoaders {
+	return &graphqlLoaders{
+		db: db,
+		libraries: newBatchLoader("libraries", func(ids []uuid.UUID) (map[uuid.UUID]*models.Library, error) {
+			var libraries []*models.Library
+			if err := db.Where("id IN ?", ids).Find(&libraries).Error; err != nil {
+				return nil, err
+			}
+			byID := make(map[uuid.UUID]*models.Library, len(libraries))
+			for _, library := range libraries {
+				byID[library.ID] = library
+			}
+			return byID, nil
+		}),
+		libraryAlbums: newBatchLoader("library albums", func(ids []uuid.UUID) (map[uuid.UUID][]*models.Album, error) {
+			var albums []*models.Album
+			if err := db.Where("library_id IN ?", ids).Order("name").Find(&albums).Error; err != nil {
+				return nil, err
+			}
+			byLibrary := make(map[uuid.UUID][]*models.Album, len(ids))
+			for _, id := range ids {
+				byLibrary[id] = []*models.Album{}
+			}
+			for _, album := range albums {
+				byLibrary[album.LibraryID] = append(byLibrary[album.LibraryID], album)
+			}
+			return byLibrary, nil
+		}),
+		albumCovers: newBatchLoader("album covers", func(ids []uuid.UUID) (map[uuid.UUID]*models.Photo, error) {
+			var albums []models.Album
+			if err := db.Where("id IN ?", ids).Find(&albums).Error; err != nil {
+				return nil, err
+			}
+			if err := loadAlbumCovers(db, albums); err != nil {
+				return nil, err
+			}
+			covers := make(map[uuid.UUID]*models.Photo, len(albums))
+			for _, album := range albums {
+				covers[album.ID] = album.CoverPhoto
+			}
+			return covers, nil
+		}),
+		albumPhotos: newBatchLoader("album photos", func(ids []uuid.UUID) (map[uuid.UUID][]*models.Photo, error) {
+			related, err := loadJoined(db, joinTable{"album_photos", "album_id", "photo_id", `album_photos."order", album_photos.photo_id`}, "", ids,
+				func(p *models.Photo) uuid.UUID { return p.ID })
+			if err != nil {
+				return nil, err
+			}
+
+			// Put each album's photos in the order of its sort mode
+			var albums []models.Album
+			if err := db.Select("id", "sort_mode").Where("id IN ?", ids).Find(&albums).Error; err != nil {
+				return nil, err
+			}
+			for i := range albums {
+				for _, photo := range related[albums[i].ID] {
+					albums[i].Photos = append(albums[i].Photos, *photo)
+				}
+			}
+			if err := sortAlbumPhotos(db, albums); err != nil {
+				return nil, err
+			}
+			for _, album := range albums {
+				photos := make([]*models.Photo, len(album.Photos))
+				for i := range album.Photos {
+					photos[i] = &album.Photos[i]
+				}
+				related[album.ID] = photos
+			}
+			return related, nil
+		}),
+		albumTags: newBatchLoader("album tags", func(ids []uuid.UUID) (map[uuid.UUID][]*models.Tag, error) {
+			return loadJoined(db, joinTable{"album_tags", "album_id", "tag_id", ""}, "name", ids,
+				func(t *models.Tag) uuid.UUID { return t.ID })
+		}),
+		photoAlbums: newBatchLoader("photo albums", func(ids []uuid.UUID) (map[uuid.UUID][]*models.Album, error) {
+			return loadJoined(db, joinTable{"album_photos", "photo_id", "album_id", ""}, "name", ids,
+				func(a *models.Album) uuid.UUID { return a.ID })
+		}),
+		photoTags: newBatchLoader("photo tags", func(ids []uuid.UUID) (map[uuid.UUID][]*models.Tag, error) {
+			return loadJoined(db, joinTable{"photo_tags", "photo_id", "tag_id", ""}, "name", ids,
+				func(t *models.Tag) uuid.UUID { return t.ID })
+		}),
+		tagPhotos: newBatchLoader("tag photos", func(ids []uuid.UUID) (map[uuid.UUID][]*models.Photo, error) {
+			return loadJoined(db, joinTable{"photo_tags", "tag_id", "photo_id", ""}, "uploaded_at desc, id desc", ids,
+				func(p *models.Photo) uuid.UUID { return p.ID })
+		}),
+		tagAlbums: newBatchLoader("tag albums", func(ids []uuid.UUID) (map[uuid.UUID][]*models.Album, error) {
+			return loadJoined(db, joinTable{"album_tags", "tag_id", "album_id", ""}, "name", ids,
+				func(a *models.Album) uuid.UUID { return a.ID })
+		}),
+	}
+}
+
+// loadersFrom returns the batch loaders of the request being resolved
+func loadersFrom(p graphql.ResolveParams) *graphqlLoaders {
+	return p.Context.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+}
+
+// batchLoader loads one relation for many records in one query. The
+// executor resolves fields one at a time, so it needs no locking.
+type batchLoader[V any] struct {
+	what    string
+	fetch   func(ids []uuid.UUID) (map[uuid.UUID]V, error)
+	queued  []uuid.UUID
+	loaded  map[uuid.UUID]V
+	failed  map[uuid.UUID]bool
+	pending map[uuid.UUID]bool
+}
+
+func newBatchLoader[V any](what string, fetch func(ids []uuid.UUID) (map[uuid.UUID]V, error)) *batchLoader[V] {
+	return &batchLoader[V]{
+		what:    what,
+		fetch:   fetch,
+		loaded:  map[uuid.UUID]V{},
+		failed:  map[uuid.UUID]bool{},
+		pending: map[uuid.UUID]bool{},
+	}
+}
+
+// load queues id and returns a thunk for its value, which fetches every
+// queued ID the first time one of them is asked for
+func (b *batchLoader[V]) load(id uuid.UUID) func() (interface{}, error) {
+	if _, ok := b.loaded[id]; !ok && !b.pending[id] && !b.failed[id] {
+		b.queued = append(b.queued, id)
+		b.pending[id] = true
+	}
+
+	return func() (interface{}, error) {
+		if b.pending[id] {
+			ids := b.queued
+			b.queued = nil
+			values, err := b.fetch(ids)
+			for _, queued := range ids {
+				delete(b.pending, queued)
+				if err != nil {
+					b.failed[queued] = true
+				} else {
+					b.loaded[queued] = values[queued]
+				}
+			}
+		}
+		if b.failed[id] {
+			return nil, errors.New("Failed to fetch " + b.what)
+		}
+		return b.loaded[id], nil
+	}
+}
+
+// joinTable describes a many-to-many join table as seen from one side
+type joinTable struct {
+	name   string
+	parent string // Column of the records the relation is loaded for
+	child  string // Column of the related records
+	order  string // Order of the related records within a parent, empty to use the records' own order
+}
+
+// loadJoined loads the records related to each parent through a join table,
+// in two queries: the join rows and then the records. Records come in the
+// table's order when it has one, and in recordOrder otherwise. Every parent
+// gets a list, empty when nothing is related.
+func loadJoined[T any](db *gorm.DB, table joinTable, recordOrder string, parents []uuid.UUID, idOf func(*T) uuid.UUID) (map[uuid.UUID][]*T, error) {
+	var links []struct {
+		ParentID uuid.UUID
+		ChildID  uuid.UUID
+	}
+	query := db.Table(table.name).
+		Select(table.parent+" AS parent_id, "+table.child+" AS child_id").
+		Where(table.parent+" IN ?", parents)
+	if table.order != "" {
+		query = query.Order(table.order)
+	}
+	if err := query.Scan(&links).Error; err != nil {
+		return nil, err
+	}
+
+	related := make(map[uuid.UUID][]*T, len(parents))
+	for _, parent := range parents {
+		related[parent] = []*T{}
+	}
+	if len(links) == 0 {
+		return related, nil
+	}
+
+	childIDs := make([]uuid.UUID, 0, len(links))
+	for _, link := range links {
+		childIDs = append(childIDs, link.ChildID)
+	}
+	var records []*T
+	query = db.Where("id IN ?", childIDs)
+	if table.order == "" && recordOrder != "" {
+		query = query.Order(recordOrder)
+	}
+	if err := query.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	// Records missing here are in the trash or another tenant's
+	byID := make(map[uuid.UUID]*T, len(records))
+	for _, record := range records {
+		byID[idOf(record)] = record
+	}
+	if table.order != "" {
+		for _, link := range links {
+			if record, ok := byID[link.ChildID]; ok {
+				related[link.ParentID] = append(related[link.ParentID], record)
+			}
+		}
+		return related, nil
+	}
+
+	parentsOf := make(map[uuid.UUID][]uuid.UUID, len(records))
+	for _, link := range links {
+		parentsOf[link.ChildID] = append(parentsOf[link.ChildID], link.ParentID)
+	}
+	for _, record := range records {
+		for _, parent := range parentsOf[idOf(record)] {
+			related[parent] = append(related[parent], record)
+		}
+	}
+	return related, nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/config"
+	"photo-library-server/database"
+	"photo-library-server/models"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// readinessTimeout bounds each readiness check, so a hung database or network
+// volume fails the probe instead of stalling it
+const readinessTimeout = 2 * time.Second
+
+// HealthHandler answers health checks and Kubernetes probes
+type HealthHandler struct {
+	db      *gorm.DB
+	config  *config.Config
+	started time.Time
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(db *gorm.DB, cfg *config.Config) *HealthHandler {
+	return &HealthHandler{db: db, config: cfg, started: time.Now()}
+}
+
+// dependencyCheck is the outcome of checking one dependency
+type dependencyCheck struct {
+	Status    string   `json:"status"` // "ok" or "fail"
+	Error     string   `json:"error,omitempty"`
+	LatencyMS float64  `json:"latency_ms"`
+	Pending   []string `json:"pending,omitempty"` // Unapplied migrations, missing tables and columns
+	Checked   int      `json:"checked,omitempty"` // Directories written to
+	Failed    []string `json:"failed,omitempty"`  // Directories that couldn't be written
+}
+
+// Health reports that the server is up
+func (h *HealthHandler) Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "healthy",
+		"service": "photo-library-server",
+	})
+}
+
+// Liveness reports that the process is running and serving requests. It
+// checks no dependencies, so an unreachable database doesn't get the process
+// restarted.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "alive",
+		"uptime_seconds": int64(time.Since(h.started).Seconds()),
+	})
+}
+
+// Readiness reports whether the server can handle requests: the database is
+// reachable, migrations have been applied and storage is writable. It
+// responds with 503 Service Unavailable if any check fails.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	ctx := c.Request.Context()
+	checks := gin.H{}
+	ready := true
+
+	for name, check := range map[string]func(context.Context) dependencyCheck{
+		"database":   h.checkDatabase,
+		"migrations": h.checkMigrations,
+		"storage":    h.checkStorage,
+	} {
+		ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		start := time.Now()
+		result := check(ctx)
+		cancel()
+		result.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+		if result.Status != "ok" {
+			ready = false
+		}
+		checks[name] = result
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+// checkDatabase pings the database
+func (h *HealthHandler) checkDatabase(ctx context.Context) dependencyCheck {
+	sqlDB, err := h.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		return dependencyCheck{Status: "fail", Error: "Database unreachable: " + err.Error()}
+	}
+	return dependencyCheck{Status: "ok"}
+}
+
+// checkMigrations looks for tables and columns the models need but the
+// database lacks, as after an upgrade that hasn't migrated yet
+func (h *HealthHandler) checkMigrations(ctx context.Context) dependencyCheck {
+	pending, err := database.PendingMigrations(h.db.WithContext(ctx))
+	if err != nil {
+		return dependencyCheck{Status: "fail", Error: err.Error()}
+	}
+	if len(pending) > 0 {
+		return dependencyCheck{Status: "fail", Error: "Migrations have not been applied", Pending: pending}
+	}
+	return dependencyCheck{Status: "ok"}
+}
+
+// checkStorage writes a scratch file into every library's images directory
+// and cold storage, across all tenants
+func (h *HealthHandler) checkStorage(ctx context.Context) dependencyCheck {
+	var images []string
+	if err := h.db.WithContext(ctx).Model(&models.Library{}).Distinct().Pluck("images", &images).Error; err != nil {
+		return dependencyCheck{Status: "fail", Error: "Failed to list libraries"}
+	}
+	dirs := map[string]bool{}
+	for _, dir := range images {
+		dirs[filepath.Clean(dir)] = true
+	}
+	if h.config.ColdStoragePath != "" {
+		dirs[filepath.Clean(h.config.ColdStoragePath)] = true
+	}
+
+	result := dependencyCheck{Status: "ok", Checked: len(dirs)}
+	for dir := range dirs {
+		if ctx.Err() != nil {
+			result.Failed = append(result.Failed, dir) // Out of time
+			continue
+		}
+		if !writable(dir) {
+			result.Failed = append(result.Failed, dir)
+		}
+	}
+	if len(result.Failed) > 0 {
+		sort.Strings(result.Failed)
+		result.Status, result.Error = "fail", "Storage directories are not writable"
+	}
+	return result
+}
+
+// writable reports whether a file can be created in dir
+func writable(dir string) bool {
+	file, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return false
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return true
+}
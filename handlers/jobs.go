@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/jobs"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// JobHandler handles background job HTTP requests
+type JobHandler struct {
+	jobs *jobs.Manager
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(jobManager *jobs.Manager) *JobHandler {
+	return &JobHandler{jobs: jobManager}
+}
+
+// GetJobs returns all known background jobs, newest first. In multi-tenant
+// mode only the tenant's own jobs are listed.
+func (h *JobHandler) GetJobs(c *gin.Context) {
+	snapshots := []jobs.Snapshot{}
+	for _, job := range h.jobs.List() {
+		if canSeeJob(c, job) {
+			snapshots = append(snapshots, job.Snapshot())
+		}
+	}
+
+	c.JSON(http.StatusOK, snapshots)
+}
+
+// GetJob returns the status and results of a specific job
+func (h *JobHandler) GetJob(c *gin.Context) {
+	jobID := c.Param("id")
+
+	id, err := uuid.Parse(jobID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_job_id", "Invalid job ID")
+		return
+	}
+
+	job, ok := h.jobs.Get(id)
+	if !ok || !canSeeJob(c, job) {
+		apierror.Respond(c, http.StatusNotFound, "job_not_found", "Job not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, job.Snapshot())
+}
+
+// canSeeJob reports whether the request may see job, tenants only see jobs
+// submitted on their behalf
+func canSeeJob(c *gin.Context, job *jobs.Job) bool {
+	id := requestTenant(c)
+	return id == "" || job.Owner() == id
+}
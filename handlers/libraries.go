@@ -1,25 +1,37 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/diskspace"
+	"photo-library-server/jobs"
 	"photo-library-server/models"
+	"photo-library-server/repository"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // LibraryHandler handles library-related HTTP requests
 type LibraryHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	libraries repository.LibraryRepo
+	config    *config.Config
+	jobs      *jobs.Manager
 }
 
 // NewLibraryHandler creates a new library handler
-func NewLibraryHandler(db *gorm.DB) *LibraryHandler {
-	return &LibraryHandler{db: db}
+func NewLibraryHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager) *LibraryHandler {
+	return &LibraryHandler{db: db, libraries: repository.NewLibraryRepo(db), config: cfg, jobs: jobManager}
 }
 
 // Helper functions for directory management
@@ -46,54 +58,101 @@ func removeDirectoryIfExists(path string) error {
 	return nil
 }
 
+// createLibraryRequest is the JSON body of CreateLibrary
+type createLibraryRequest struct {
+	Name            string `json:"name" binding:"required,min=1,max=100"`
+	Description     string `json:"description" binding:"max=500"`
+	Images          string `json:"images" binding:"required,min=1,max=500"`
+	ImportKeywords  bool   `json:"import_keywords"`
+	ThumbnailMode   string `json:"thumbnail_mode" binding:"omitempty,oneof=eager background lazy"`
+	AcceptDocuments bool   `json:"accept_documents"`
+	Encrypted       bool   `json:"encrypted"`
+	Watch           bool   `json:"watch"`
+	ReadOnly        bool   `json:"read_only"`
+	QuotaBytes      int64  `json:"quota_bytes" binding:"min=0"`
+	// Days deleted photos stay in the trash, unset for TRASH_RETENTION_DAYS
+	TrashRetentionDays *int `json:"trash_retention_days" binding:"omitempty,min=0"`
+}
+
 // CreateLibrary creates a new library
 func (h *LibraryHandler) CreateLibrary(c *gin.Context) {
-	var req struct {
-		Name        string `json:"name" binding:"required,min=1,max=100"`
-		Description string `json:"description" binding:"max=500"`
-		Images      string `json:"images" binding:"required,min=1,max=500"`
-	}
+	var req createLibraryRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
+		return
+	}
+
+	if req.Encrypted && h.config.EncryptionSecret == "" {
+		apierror.Respond(c, http.StatusBadRequest, "encryption_not_configured", "Encryption is not configured on this server")
+		return
+	}
+	if req.Encrypted && req.Watch {
+		apierror.Respond(c, http.StatusBadRequest, "encrypted_not_supported", "Encrypted libraries can't be watched")
 		return
 	}
 
 	// Validate the images path format (basic validation)
 	if !isValidPath(req.Images) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid images path format"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid images path format")
+		return
+	}
+	// Paths are stored absolute and clean, so one directory is always
+	// spelled the same way
+	images, err := filepath.Abs(req.Images)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid images path format")
 		return
 	}
+	req.Images = images
 
 	// Check if library with same name already exists
-	var existingLibrary models.Library
-	if err := h.db.Where("name = ?", req.Name).First(&existingLibrary).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Library with this name already exists"})
+	if taken, err := h.libraries.NameTaken(c.Request.Context(), req.Name, uuid.Nil); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check library names")
+		return
+	} else if taken {
+		apierror.Respond(c, http.StatusConflict, "duplicate_library_name", "Library with this name already exists")
 		return
 	}
 
-	// Check if library with same images path already exists
-	if err := h.db.Where("images = ?", req.Images).First(&existingLibrary).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Library with this images path already exists"})
+	// Check if a library of any tenant already keeps its images in, above
+	// or below this directory
+	if taken, err := h.libraries.ImagesTaken(c.Request.Context(), req.Images, uuid.Nil); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check library paths")
+		return
+	} else if taken {
+		apierror.Respond(c, http.StatusConflict, "duplicate_library_path", "Library with this images path already exists, or one nested with it")
 		return
 	}
 
+	if req.ThumbnailMode == "" {
+		req.ThumbnailMode = models.ThumbnailModeLazy
+	}
+
 	library := models.Library{
-		Name:        req.Name,
-		Description: req.Description,
-		Images:      req.Images,
+		Name:               req.Name,
+		Description:        req.Description,
+		Images:             req.Images,
+		ImportKeywords:     req.ImportKeywords,
+		ThumbnailMode:      req.ThumbnailMode,
+		AcceptDocuments:    req.AcceptDocuments,
+		Encrypted:          req.Encrypted,
+		Watch:              req.Watch,
+		ReadOnly:           req.ReadOnly,
+		QuotaBytes:         req.QuotaBytes,
+		TrashRetentionDays: req.TrashRetentionDays,
 	}
 
 	// Create the images directory
 	if err := createDirectoryIfNotExists(req.Images); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create images directory"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create images directory")
 		return
 	}
 
-	if err := h.db.Create(&library).Error; err != nil {
+	if err := h.libraries.Create(c.Request.Context(), &library); err != nil {
 		// Cleanup directory if database creation fails
 		removeDirectoryIfExists(req.Images)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create library")
 		return
 	}
 
@@ -102,17 +161,12 @@ func (h *LibraryHandler) CreateLibrary(c *gin.Context) {
 
 // GetLibraries returns all libraries
 func (h *LibraryHandler) GetLibraries(c *gin.Context) {
-	var libraries []models.Library
-
-	query := h.db.Model(&models.Library{})
-
 	// Optional: include counts
-	if c.Query("include_counts") == "true" {
-		query = query.Preload("Albums").Preload("Photos")
-	}
+	counts := c.Query("include_counts") == "true"
 
-	if err := query.Find(&libraries).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch libraries"})
+	libraries, err := h.libraries.List(c.Request.Context(), repository.LibraryRelations{Albums: counts, Photos: counts})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch libraries")
 		return
 	}
 
@@ -125,85 +179,122 @@ func (h *LibraryHandler) GetLibrary(c *gin.Context) {
 
 	id, err := uuid.Parse(libraryID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
 		return
 	}
 
-	var library models.Library
-	query := h.db.Model(&models.Library{})
-
 	// Optional: include related data
-	if c.Query("include_albums") == "true" {
-		query = query.Preload("Albums")
-	}
-	if c.Query("include_photos") == "true" {
-		query = query.Preload("Photos")
-	}
-
-	if err := query.First(&library, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Library not found"})
+	library, err := h.libraries.Get(c.Request.Context(), id, repository.LibraryRelations{
+		Albums: c.Query("include_albums") == "true",
+		Photos: c.Query("include_photos") == "true",
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
 		return
 	}
 
 	c.JSON(http.StatusOK, library)
 }
 
+// updateLibraryRequest is the JSON body of UpdateLibrary
+type updateLibraryRequest struct {
+	Name            *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Description     *string `json:"description,omitempty" binding:"omitempty,max=500"`
+	Images          *string `json:"images,omitempty" binding:"omitempty,min=1,max=500"`
+	ImportKeywords  *bool   `json:"import_keywords,omitempty"`
+	ThumbnailMode   *string `json:"thumbnail_mode,omitempty" binding:"omitempty,oneof=eager background lazy"`
+	AcceptDocuments *bool   `json:"accept_documents,omitempty"`
+	Watch           *bool   `json:"watch,omitempty"`
+	ReadOnly        *bool   `json:"read_only,omitempty"`
+	QuotaBytes      *int64  `json:"quota_bytes,omitempty" binding:"omitempty,min=0"`
+	// A null trash retention goes back to TRASH_RETENTION_DAYS
+	TrashRetentionDays *int `json:"trash_retention_days" binding:"omitempty,min=0"`
+}
+
 // UpdateLibrary updates a library
 func (h *LibraryHandler) UpdateLibrary(c *gin.Context) {
 	libraryID := c.Param("id")
 
 	id, err := uuid.Parse(libraryID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
 		return
 	}
 
-	var req struct {
-		Name        *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
-		Description *string `json:"description,omitempty" binding:"omitempty,max=500"`
-		Images      *string `json:"images,omitempty" binding:"omitempty,min=1,max=500"`
-	}
+	var req updateLibraryRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		respondValidationError(c, err)
 		return
 	}
 
+	// A null trash retention clears it, so tell that apart from one left out
+	var fields map[string]json.RawMessage
+	json.Unmarshal(c.MustGet(gin.BodyBytesKey).([]byte), &fields)
+	_, retentionSet := fields["trash_retention_days"]
+
 	// Validate the images path format if provided
 	if req.Images != nil && !isValidPath(*req.Images) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid images path format"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid images path format")
 		return
 	}
+	if req.Images != nil {
+		images, err := filepath.Abs(*req.Images)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid images path format")
+			return
+		}
+		req.Images = &images
+	}
 
-	var library models.Library
-	if err := h.db.First(&library, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Library not found"})
+	library, err := h.libraries.Get(c.Request.Context(), id, repository.LibraryRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
 		return
 	}
 
 	// Check if another library with same name exists (only if name is being updated)
 	if req.Name != nil {
-		var existingLibrary models.Library
-		if err := h.db.Where("name = ? AND id != ?", *req.Name, id).First(&existingLibrary).Error; err == nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "Library with this name already exists"})
+		if taken, err := h.libraries.NameTaken(c.Request.Context(), *req.Name, id); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check library names")
+			return
+		} else if taken {
+			apierror.Respond(c, http.StatusConflict, "duplicate_library_name", "Library with this name already exists")
 			return
 		}
 	}
 
-	// Check if another library with same images path exists (only if path is changing)
+	// Check if another library of any tenant keeps its images in, above or
+	// below the new directory (only if path is changing)
 	var pathChanged bool
-	if req.Images != nil && *req.Images != library.Images {
-		var existingLibrary models.Library
-		if err := h.db.Where("images = ? AND id != ?", *req.Images, id).First(&existingLibrary).Error; err == nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "Library with this images path already exists"})
+	currentImages, err := filepath.Abs(library.Images)
+	if err != nil {
+		currentImages = filepath.Clean(library.Images)
+	}
+	if req.Images != nil && *req.Images != currentImages {
+		// Moving a directory into itself, or over its own parent, would
+		// delete the files it copies
+		if pathsOverlap(currentImages, *req.Images) {
+			apierror.Respond(c, http.StatusBadRequest, "nested_images_path", "New images directory can't contain or be inside the current one")
+			return
+		}
+		if taken, err := h.libraries.ImagesTaken(c.Request.Context(), *req.Images, id); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check library paths")
+			return
+		} else if taken {
+			apierror.Respond(c, http.StatusConflict, "duplicate_library_path", "Library with this images path already exists, or one nested with it")
+			return
+		}
+		if !isEmptyOrMissingDir(*req.Images) {
+			apierror.Respond(c, http.StatusConflict, "images_directory_not_empty", "New images directory must be empty")
 			return
 		}
 		pathChanged = true
@@ -216,33 +307,93 @@ func (h *LibraryHandler) UpdateLibrary(c *gin.Context) {
 	if req.Description != nil {
 		library.Description = *req.Description
 	}
-	if req.Images != nil {
-		library.Images = *req.Images
+	if req.ImportKeywords != nil {
+		library.ImportKeywords = *req.ImportKeywords
 	}
-
-	// If images path is changing, handle directory operations
-	if pathChanged {
-		// Create new directory
-		if err := createDirectoryIfNotExists(library.Images); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create new images directory"})
+	if req.ThumbnailMode != nil {
+		library.ThumbnailMode = *req.ThumbnailMode
+	}
+	if req.AcceptDocuments != nil {
+		library.AcceptDocuments = *req.AcceptDocuments
+	}
+	if req.Watch != nil {
+		if *req.Watch && library.Encrypted {
+			apierror.Respond(c, http.StatusBadRequest, "encrypted_not_supported", "Encrypted libraries can't be watched")
 			return
 		}
+		library.Watch = *req.Watch
+	}
+	if req.ReadOnly != nil {
+		library.ReadOnly = *req.ReadOnly
+	}
+	if req.QuotaBytes != nil {
+		// Lowering a quota below current usage only stops further growth
+		library.QuotaBytes = *req.QuotaBytes
+	}
+	if retentionSet {
+		// Photos already in the trash follow the new period
+		library.TrashRetentionDays = req.TrashRetentionDays
+	}
+
+	// A dry run reports what the update would do without doing it
+	if c.Query("dry_run") == "true" {
+		response := gin.H{"dry_run": true, "library": library, "relocation": nil}
+		if pathChanged {
+			if isRelocating(library.ID) {
+				apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is already being relocated")
+				return
+			}
+			plan, err := h.planRelocation(library.ID, library.Images, *req.Images)
+			if errors.Is(err, errNestedRelocation) {
+				apierror.Respond(c, http.StatusBadRequest, "nested_images_path", "New images directory can't contain or be inside the current one")
+				return
+			}
+			if err != nil {
+				apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to plan relocation")
+				return
+			}
+			response["relocation"] = plan
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
 
-		// TODO: Move existing files from old path to new path
-		// This is a complex operation that should be done carefully
-		// For now, we'll just create the new directory and let users handle migration
+	// Only one relocation may run per library, and uploads wait for it
+	if pathChanged && !beginRelocation(library.ID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is already being relocated")
+		return
 	}
 
-	if err := h.db.Save(&library).Error; err != nil {
-		// If database save failed and we created a new directory, clean it up
+	// The images path itself only changes once the relocation job has moved the files
+	if err := h.libraries.Save(c.Request.Context(), library); err != nil {
 		if pathChanged {
-			removeDirectoryIfExists(library.Images)
+			endRelocation(library.ID)
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update library")
 		return
 	}
 
-	c.JSON(http.StatusOK, library)
+	if !pathChanged {
+		c.JSON(http.StatusOK, library)
+		return
+	}
+
+	oldPath, newPath := library.Images, *req.Images
+	job, err := h.jobs.SubmitFor(library.TenantID, "library_relocation", func(ctx context.Context, job *jobs.Job) error {
+		defer endRelocation(id)
+		return h.relocateLibrary(ctx, job, id, oldPath, newPath)
+	})
+	if err != nil {
+		endRelocation(library.ID)
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule relocation job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, gin.H{
+		"library": library,
+		"job":     job.Snapshot(),
+	})
 }
 
 // DeleteLibrary deletes a library and all its associated data
@@ -251,53 +402,41 @@ func (h *LibraryHandler) DeleteLibrary(c *gin.Context) {
 
 	id, err := uuid.Parse(libraryID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
 		return
 	}
 
-	var library models.Library
-	if err := h.db.First(&library, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Library not found"})
+	library, err := h.libraries.Get(c.Request.Context(), id, repository.LibraryRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
 		return
 	}
 
-	// Use transaction to ensure data consistency
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Delete all photos in this library (this will also clean up photo_tags and album_photos via foreign key constraints)
-	if err := tx.Where("library_id = ?", id).Delete(&models.Photo{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete library photos"})
+	// Archives are kept whole until the flag is cleared on purpose
+	if library.ReadOnly {
+		apierror.Respond(c, http.StatusForbidden, "library_read_only", "Library is read-only")
 		return
 	}
 
-	// Delete all albums in this library
-	if err := tx.Where("library_id = ?", id).Delete(&models.Album{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete library albums"})
+	// Albums, photos and everything recorded about them go with the library
+	if err := h.libraries.Delete(c.Request.Context(), library); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete library")
 		return
 	}
 
-	// Delete the library itself
-	if err := tx.Delete(&library).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete library"})
-		return
+	// Remove the library's images directory and all its contents, along with
+	// any originals moved to cold storage
+	err = removeDirectoryIfExists(library.Images)
+	if h.config.ColdStoragePath != "" {
+		if coldErr := removeDirectoryIfExists(filepath.Join(h.config.ColdStoragePath, library.ID.String())); coldErr != nil && err == nil {
+			err = coldErr
+		}
 	}
-
-	tx.Commit()
-
-	// Remove the library's images directory and all its contents
-	if err := removeDirectoryIfExists(library.Images); err != nil {
+	if err != nil {
 		// Log error but don't fail the request since DB is already updated
 		// In production, you might want to queue this for retry
 		c.JSON(http.StatusOK, gin.H{
@@ -316,52 +455,57 @@ func (h *LibraryHandler) GetLibraryStats(c *gin.Context) {
 
 	id, err := uuid.Parse(libraryID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
 		return
 	}
 
 	// Check if library exists
-	var library models.Library
-	if err := h.db.First(&library, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Library not found"})
+	library, err := h.libraries.Get(c.Request.Context(), id, repository.LibraryRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
 		return
 	}
 
 	stats := struct {
-		LibraryID   uuid.UUID `json:"library_id"`
-		LibraryName string    `json:"library_name"`
-		PhotoCount  int64     `json:"photo_count"`
-		AlbumCount  int64     `json:"album_count"`
-		TagCount    int64     `json:"tag_count"`
-		TotalSize   int64     `json:"total_size_bytes"`
+		LibraryID     uuid.UUID    `json:"library_id"`
+		LibraryName   string       `json:"library_name"`
+		PhotoCount    int64        `json:"photo_count"`
+		FavoriteCount int64        `json:"favorite_count"`
+		AlbumCount    int64        `json:"album_count"`
+		TagCount      int64        `json:"tag_count"`
+		TotalSize     int64        `json:"total_size_bytes"`
+		Volume        *volumeUsage `json:"volume,omitempty"` // Space on the filesystem holding the library
+		Quota         *quotaUsage  `json:"quota,omitempty"`  // Only for libraries with a quota
 	}{
 		LibraryID:   library.ID,
 		LibraryName: library.Name,
 	}
 
-	// Count photos
-	h.db.Model(&models.Photo{}).Where("library_id = ?", id).Count(&stats.PhotoCount)
-
-	// Count albums
-	h.db.Model(&models.Album{}).Where("library_id = ?", id).Count(&stats.AlbumCount)
+	counts, err := h.libraries.Stats(c.Request.Context(), id)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library stats")
+		return
+	}
+	stats.PhotoCount = counts.PhotoCount
+	stats.FavoriteCount = counts.FavoriteCount
+	stats.AlbumCount = counts.AlbumCount
+	stats.TagCount = counts.TagCount
+	stats.TotalSize = counts.TotalSize
 
-	// Count unique tags used in this library
-	h.db.Table("tags").
-		Joins("JOIN photo_tags ON tags.id = photo_tags.tag_id").
-		Joins("JOIN photos ON photo_tags.photo_id = photos.id").
-		Where("photos.library_id = ?", id).
-		Distinct("tags.id").
-		Count(&stats.TagCount)
+	if volume, err := diskspace.Usage(library.Images); err == nil {
+		stats.Volume = newVolumeUsage(volume)
+		stats.Volume.Paths = []string{library.Images}
+	}
 
-	// Calculate total file size
-	h.db.Model(&models.Photo{}).
-		Where("library_id = ?", id).
-		Select("COALESCE(SUM(file_size), 0)").
-		Row().Scan(&stats.TotalSize)
+	if library.QuotaBytes > 0 {
+		if used, err := libraryUsage(scopedDB(c, h.db), id); err == nil {
+			stats.Quota = newQuotaUsage(library.QuotaBytes, used)
+		}
+	}
 
 	c.JSON(http.StatusOK, stats)
 }
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-library-server/jobs"
+	"photo-library-server/metrics"
+	"photo-library-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MetricsHandler serves server metrics to Prometheus
+type MetricsHandler struct {
+	db   *gorm.DB
+	jobs *jobs.Manager
+}
+
+// NewMetricsHandler creates a new metrics handler
+func NewMetricsHandler(db *gorm.DB, jobManager *jobs.Manager) *MetricsHandler {
+	return &MetricsHandler{db: db, jobs: jobManager}
+}
+
+// GetMetrics writes all metrics in the Prometheus text format, refreshing the
+// gauges first. Storage usage covers every tenant's libraries.
+func (h *MetricsHandler) GetMetrics(c *gin.Context) {
+	if sqlDB, err := h.db.DB(); err == nil {
+		stats := sqlDB.Stats()
+		metrics.DBConnections.Set(float64(stats.InUse), "in_use")
+		metrics.DBConnections.Set(float64(stats.Idle), "idle")
+	}
+
+	metrics.JobQueueDepth.Set(float64(h.jobs.QueueDepth()))
+
+	// Trashed photos keep their files until purged, as with quotas
+	var usage []struct {
+		LibraryID uuid.UUID
+		TenantID  string
+		Photos    int64
+		Bytes     int64
+	}
+	if err := h.db.Unscoped().Model(&models.Library{}).
+		Select("libraries.id AS library_id, libraries.tenant_id, COUNT(photos.id) AS photos, COALESCE(SUM(photos.file_size), 0) AS bytes").
+		Joins("LEFT JOIN photos ON photos.library_id = libraries.id").
+		Group("libraries.id, libraries.tenant_id").
+		Scan(&usage).Error; err == nil {
+		metrics.LibraryStorageBytes.Reset()
+		metrics.LibraryPhotos.Reset()
+		for _, library := range usage {
+			metrics.LibraryStorageBytes.Set(float64(library.Bytes), library.LibraryID.String(), library.TenantID)
+			metrics.LibraryPhotos.Set(float64(library.Photos), library.LibraryID.String(), library.TenantID)
+		}
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.Default.WriteText(c.Writer)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/diskspace"
+	"photo-library-server/documents"
+	"photo-library-server/encryption"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/thumbnails"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// movePhotoRequest is the JSON body of MovePhoto
+type movePhotoRequest struct {
+	LibraryID uuid.UUID `json:"library_id" binding:"required"`
+}
+
+// MovePhoto moves a photo, file and record, to another library. It keeps its
+// ID, tags and custom metadata but leaves the albums of its old library.
+func (h *PhotoHandler) MovePhoto(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var req movePhotoRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).Preload("Library").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	var targetLibrary models.Library
+	if err := scopedDB(c, h.db).First(&targetLibrary, req.LibraryID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "target_library_not_found", "Target library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify target library")
+		return
+	}
+
+	if err := h.movePhotoToLibrary(&photo, &targetLibrary); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	// Reload so the response has the new library and file URLs
+	if err := scopedDB(c, h.db).Preload("Library").Preload("Tags").First(&photo, id).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, photo)
+}
+
+// movePhotoToLibrary moves a photo's file into the target library, stored the
+// way that library stores files, and updates its record. Album memberships
+// are dropped since albums belong to one library. photo must have its Library
+// preloaded.
+func (h *PhotoHandler) movePhotoToLibrary(photo *models.Photo, targetLibrary *models.Library) error {
+	move, err := h.startMove(h.db, photo, targetLibrary)
+	if err != nil {
+		return err
+	}
+	if err := h.db.Transaction(move.record); err != nil {
+		move.undo()
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to move photo"}
+	}
+	h.finishMove(move)
+	return nil
+}
+
+// photoMove is a photo move whose file is in place but whose record may not
+// be updated yet
+type photoMove struct {
+	photo         *models.Photo
+	targetLibrary *models.Library
+	src, dst      string
+	rewrite       bool // The file was copied in a new form, not renamed
+}
+
+// startMove checks that a photo can move to the target library and moves its
+// file. The move must then be recorded and finished, or undone. The target's
+// quota is checked against db.
+func (h *PhotoHandler) startMove(db *gorm.DB, photo *models.Photo, targetLibrary *models.Library) (*photoMove, error) {
+	if photo.LibraryID == targetLibrary.ID {
+		return nil, &photoOpError{http.StatusBadRequest, "already_in_library", "Photo is already in the target library"}
+	}
+	if photo.Library.ReadOnly {
+		return nil, errReadOnlyLibrary
+	}
+	if targetLibrary.ReadOnly {
+		return nil, errReadOnlyTarget
+	}
+	if isRelocating(photo.LibraryID) || isRelocating(targetLibrary.ID) {
+		return nil, &photoOpError{http.StatusConflict, "library_relocating", "Library is being relocated, try again later"}
+	}
+	if photo.MimeType == documents.MimeType && !targetLibrary.AcceptDocuments {
+		return nil, &photoOpError{http.StatusBadRequest, "documents_not_accepted", "Target library does not accept documents"}
+	}
+
+	move := &photoMove{photo: photo, targetLibrary: targetLibrary, src: photo.FilePath}
+	if _, err := os.Stat(move.src); os.IsNotExist(err) {
+		return nil, &photoOpError{http.StatusNotFound, "photo_file_not_found", "Photo file not found"}
+	}
+	if err := checkQuota(db, targetLibrary, photo.FileSize); err != nil {
+		return nil, err
+	}
+
+	// Cold originals stay cold, under the target library's cold directory
+	move.dst = filepath.Join(targetLibrary.Images, photo.Filename)
+	if photo.StorageTier == models.StorageTierCold {
+		move.dst = filepath.Join(h.config.ColdStoragePath, targetLibrary.ID.String(), photo.Filename)
+	}
+	if err := os.MkdirAll(filepath.Dir(move.dst), 0755); err != nil {
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to create target library images directory"}
+	}
+
+	// Encrypted files are keyed to their library, so they are rewritten
+	// rather than renamed
+	move.rewrite = photo.Encrypted || targetLibrary.Encrypted
+	if move.rewrite {
+		storedSize := photo.FileSize
+		if targetLibrary.Encrypted {
+			storedSize = encryption.EncryptedSize(photo.FileSize)
+		}
+		if opErr := h.checkDiskSpace(filepath.Dir(move.dst), storedSize); opErr != nil {
+			return nil, opErr
+		}
+		if err := h.copyOriginal(photo, targetLibrary, move.dst); err != nil {
+			if err == errEncryptionNotConfigured {
+				return nil, &photoOpError{http.StatusInternalServerError, "encryption_not_configured", "Encryption is not configured on this server"}
+			}
+			if diskspace.IsFull(err) {
+				return nil, errDiskFull
+			}
+			return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to move photo file"}
+		}
+	} else if err := moveFile(move.src, move.dst); err != nil {
+		if diskspace.IsFull(err) {
+			return nil, errDiskFull
+		}
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to move photo file"}
+	}
+	return move, nil
+}
+
+// record points the photo's record at its new library and file and takes it
+// out of its old albums
+func (m *photoMove) record(tx *gorm.DB) error {
+	albumIDs, err := albumIDsForPhotos(tx, []uuid.UUID{m.photo.ID})
+	if err != nil {
+		return err
+	}
+	if err := tx.Where("photo_id = ?", m.photo.ID).Delete(&models.AlbumPhoto{}).Error; err != nil {
+		return err
+	}
+	// A bare model, or the preloaded Library would be saved back
+	if err := tx.Model(&models.Photo{}).Where("id = ?", m.photo.ID).Updates(map[string]interface{}{
+		"library_id": m.targetLibrary.ID,
+		"file_path":  m.dst,
+		"encrypted":  m.targetLibrary.Encrypted,
+	}).Error; err != nil {
+		return err
+	}
+	if err := updateAlbumDateRanges(tx, albumIDs); err != nil {
+		return err
+	}
+	return clearRemovedAlbumCovers(tx, albumIDs)
+}
+
+// undo puts the file back so the unchanged record stays accurate
+func (m *photoMove) undo() {
+	if m.rewrite {
+		os.Remove(m.dst)
+	} else {
+		moveFile(m.dst, m.src)
+	}
+}
+
+// finishMove cleans up after a recorded move and prepares the photo's
+// renditions in its new library
+func (h *PhotoHandler) finishMove(m *photoMove) {
+	// The record points at the new file, so cleanup failures are only logged
+	if m.rewrite {
+		if err := os.Remove(m.src); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to delete file", "path", m.src, "error", err)
+		}
+	}
+
+	// The sidecar follows the original; a failure here only loses metadata
+	if _, err := os.Stat(metadata.SidecarPath(m.src)); err == nil {
+		if err := moveFile(metadata.SidecarPath(m.src), metadata.SidecarPath(m.dst)); err != nil {
+			slog.Warn("Failed to move sidecar", "path", m.src, "error", err)
+		}
+	}
+
+	photo := m.photo
+	thumbnails.Remove(photo.Library.Images, m.src)
+	photo.LibraryID, photo.Library = m.targetLibrary.ID, *m.targetLibrary
+	photo.FilePath, photo.Encrypted = m.dst, m.targetLibrary.Encrypted
+	h.prepareThumbnails(photo, m.targetLibrary)
+}
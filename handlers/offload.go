@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"photo-library-server/config"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// File offload modes, see config.FileOffload
+const (
+	offloadXAccelRedirect = "x-accel-redirect"
+	offloadXSendfile      = "x-sendfile"
+)
+
+// offloadFile asks the front-end server to send the file at path instead of
+// copying it through Go. It returns false, leaving the response untouched,
+// when offloading is off or path isn't under a mapped directory.
+func offloadFile(c *gin.Context, cfg *config.Config, path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	switch cfg.FileOffload {
+	case offloadXSendfile:
+		c.Header("X-Sendfile", absPath)
+	case offloadXAccelRedirect:
+		location, ok := accelLocation(cfg.FileOffloadMap, absPath)
+		if !ok {
+			return false
+		}
+		c.Header("X-Accel-Redirect", location)
+	default:
+		return false
+	}
+
+	c.Status(http.StatusOK)
+	return true
+}
+
+// accelLocation maps a file path to a URI in an nginx internal location using
+// dir=location pairs. The longest matching directory wins.
+func accelLocation(mappings, path string) (string, bool) {
+	var bestDir, bestLocation string
+	for _, pair := range strings.Split(mappings, ",") {
+		dir, location, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || dir == "" || location == "" {
+			continue
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(absDir) > len(bestDir) {
+			bestDir, bestLocation = absDir, location
+		}
+	}
+	if bestDir == "" {
+		return "", false
+	}
+
+	rel, _ := filepath.Rel(bestDir, path)
+	uri := strings.TrimSuffix(bestLocation, "/") + "/" + filepath.ToSlash(rel)
+	return (&url.URL{Path: uri}).EscapedPath(), true
+}
@@ -0,0 +1,769 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/apikeys"
+	"photo-library-server/config"
+	"photo-library-server/jobs"
+	"photo-library-server/middleware"
+	"photo-library-server/models"
+	"photo-library-server/openapi"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Response bodies that handlers build with gin.H, described for the spec
+type (
+	errorResponse struct {
+		Error string `json:"error"` // Message for people, details such as photo_ids may follow
+		Code  string `json:"code"`  // Stable identifier to branch on, like library_not_found
+	}
+	messageResponse struct {
+		Message string `json:"message"`
+		Warning string `json:"warning,omitempty"`
+	}
+	pageInfo struct {
+		Page       int    `json:"page,omitempty"`
+		Limit      int    `json:"limit"`
+		Total      int64  `json:"total"`
+		NextCursor string `json:"next_cursor,omitempty"` // Photo lists ordered by upload time
+	}
+	photoPage struct {
+		Photos     []models.Photo `json:"photos"`
+		Pagination pageInfo       `json:"pagination"`
+	}
+	trashPage struct {
+		Photos      []trashedPhoto `json:"photos"`
+		NextPurgeAt *time.Time     `json:"next_purge_at"` // When the first of them is due, null if none is
+		Pagination  pageInfo       `json:"pagination"`
+	}
+	suggestionPage struct {
+		Suggestions []models.TagSuggestion `json:"suggestions"`
+		Pagination  pageInfo               `json:"pagination"`
+	}
+	similarPhotoPage struct {
+		PhotoID    uuid.UUID      `json:"photo_id"`
+		Threshold  int            `json:"threshold"`
+		Photos     []similarPhoto `json:"photos"` // Each with distance, the bits its hash differs in
+		Pagination pageInfo       `json:"pagination"`
+	}
+	peoplePage struct {
+		People     []models.Person `json:"people"`
+		Pagination pageInfo        `json:"pagination"`
+	}
+	reviewSuggestionsResponse struct {
+		Suggestions []models.TagSuggestion `json:"suggestions"`
+	}
+	relocationResponse struct {
+		Library models.Library `json:"library"`
+		Job     jobs.Snapshot  `json:"job"`
+	}
+	albumPhotosAddedResponse struct {
+		Message         string      `json:"message"`
+		Added           int         `json:"added"`
+		SkippedPhotoIDs []uuid.UUID `json:"skipped_photo_ids"`
+	}
+	albumReorderResponse struct {
+		Message  string      `json:"message"`
+		PhotoIDs []uuid.UUID `json:"photo_ids"` // Every photo of the album in its new order
+	}
+	sharedAlbumResponse struct {
+		Album      sharedAlbum   `json:"album"`
+		Photos     []sharedPhoto `json:"photos"`
+		Pagination pageInfo      `json:"pagination"`
+	}
+	duplicateAlbumResponse struct {
+		Message      string       `json:"message"`
+		OriginalID   uuid.UUID    `json:"original_id"`
+		Album        models.Album `json:"album"`
+		CopiedPhotos int          `json:"copied_photos"` // Photos copied into another library, 0 within the album's own
+	}
+	albumPhotosRemovedResponse struct {
+		Message            string      `json:"message"`
+		Removed            int64       `json:"removed"`
+		NotInAlbumPhotoIDs []uuid.UUID `json:"not_in_album_photo_ids"`
+	}
+	createdAPIKeyResponse struct {
+		ID        uuid.UUID `json:"id"`
+		Name      string    `json:"name"`
+		Scope     string    `json:"scope"`
+		Prefix    string    `json:"prefix"`
+		CreatedAt time.Time `json:"created_at"`
+		Key       string    `json:"key"` // Shown once
+	}
+	auditResponse struct {
+		LibraryID           uuid.UUID            `json:"library_id"`
+		Fixed               bool                 `json:"fixed"`
+		MissingFiles        []auditMissingFile   `json:"missing_files"`
+		UntrackedFiles      []auditUntrackedFile `json:"untracked_files"`
+		DanglingPhotoTags   []auditPhotoTag      `json:"dangling_photo_tags"`
+		DanglingAlbumPhotos []auditAlbumPhoto    `json:"dangling_album_photos"`
+	}
+	batchResponse struct {
+		Atomic    bool          `json:"atomic"`
+		Committed bool          `json:"committed,omitempty"` // Atomic batches
+		Results   []batchResult `json:"results"`
+	}
+	downloadURLResponse struct {
+		URL       string    `json:"url"`
+		Path      string    `json:"path"`
+		ExpiresAt time.Time `json:"expires_at"`
+		OneTime   bool      `json:"one_time"`
+	}
+	signedURLResponse struct {
+		URL       string    `json:"url"`
+		Path      string    `json:"path"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	photoBatchResponse struct {
+		Operation string             `json:"operation"`
+		Committed bool               `json:"committed"`
+		Results   []photoBatchResult `json:"results"`
+	}
+	batchUploadResponse struct {
+		Results    []batchUploadResult `json:"results"`
+		Created    int                 `json:"created"`
+		Duplicates int                 `json:"duplicates"`
+		Failed     int                 `json:"failed"`
+	}
+	copyPhotoResponse struct {
+		Message     string       `json:"message"`
+		OriginalID  uuid.UUID    `json:"original_id"`
+		CopiedPhoto models.Photo `json:"copied_photo"`
+	}
+	metadataResponse struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	timelineResponse struct {
+		Granularity string           `json:"granularity"`
+		Total       int64            `json:"total"`
+		Buckets     []timelineBucket `json:"buckets"`
+		Pagination  pageInfo         `json:"pagination"` // Total counts buckets
+	}
+	batchTagsResponse struct {
+		Message     string       `json:"message"`
+		PhotoCount  int          `json:"photo_count"`
+		Added       int64        `json:"added"`   // Tags applied to photos that didn't have them
+		Removed     int64        `json:"removed"` // Tags taken off photos
+		CreatedTags []models.Tag `json:"created_tags"`
+	}
+	tagCompletionsResponse struct {
+		Query string          `json:"query"` // q as normalized for matching
+		Tags  []tagCompletion `json:"tags"`
+	}
+	topTagsResponse struct {
+		Window string     `json:"window"`
+		Since  *time.Time `json:"since"` // null for window=all
+		Tags   []topTag   `json:"tags"`
+	}
+	readinessResponse struct {
+		Status string                     `json:"status" binding:"oneof=ready not_ready"`
+		Checks map[string]dependencyCheck `json:"checks"`
+	}
+	graphqlResponse struct {
+		Data   map[string]interface{} `json:"data"` // null when the query couldn't run
+		Errors []graphqlError         `json:"errors,omitempty"`
+	}
+	graphqlError struct {
+		Message string        `json:"message"`
+		Path    []interface{} `json:"path,omitempty"` // Field the error is about, by name and list index
+	}
+	objectResponse map[string]interface{}
+)
+
+// uploadForm is the multipart form of UploadPhoto
+type uploadForm struct {
+	LibraryID uuid.UUID    `json:"library_id" binding:"required"`
+	Photo     openapi.File `json:"photo" binding:"required"`
+	Rating    int          `json:"rating" binding:"min=0,max=5"`
+	Tags      string       `json:"tags"` // Comma-separated tag names
+	Dedupe    string       `json:"dedupe" binding:"oneof=off link reject"`
+}
+
+// batchUploadForm is the multipart form of UploadPhotos
+type batchUploadForm struct {
+	LibraryID uuid.UUID      `json:"library_id" binding:"required"`
+	Photos    []openapi.File `json:"photos" binding:"required"`
+	Rating    int            `json:"rating" binding:"min=0,max=5"`
+	Tags      string         `json:"tags"` // Comma-separated tag names, applied to every photo
+	Dedupe    string         `json:"dedupe" binding:"oneof=off link reject"`
+}
+
+// routeDoc documents one route in the OpenAPI spec
+type routeDoc struct {
+	Summary     string
+	Description string
+	Query       []openapi.Parameter
+	Body        interface{}         // JSON request body, a value of its type
+	Form        interface{}         // Multipart form, a value of its type
+	Status      int                 // Success status, 200 if unset
+	Response    interface{}         // JSON response body, nil for none
+	Produces    string              // Content type of a response that isn't JSON
+	Job         bool                // Starts a background job: 202 Accepted with the job and its Location
+	Also        map[int]interface{} // Other success responses by status, such as 202 Accepted
+}
+
+// query documents a query parameter of a kind openapi.Scalar knows
+func query(name, kind, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: openapi.Scalar(kind)}
+}
+
+var (
+	pageParams = []openapi.Parameter{
+		query("page", "integer", "Page number, from 1"),
+		query("limit", "integer", "Results per page, 50 by default and at most 100"),
+	}
+	photoFilterParams = []openapi.Parameter{
+		query("library_id", "uuid", "Only photos in this library"),
+		query("rating", "integer", "Only photos with this rating, 0-5"),
+		query("unrated", "boolean", "Only photos without a rating, or only rated ones"),
+		query("favorite", "boolean", "Only favorites, or only photos that aren't"),
+		query("storage_tier", "string", "hot or cold"),
+		query("missing", "boolean", "Photos a rescan found without a file"),
+		query("corrupt", "boolean", "Photos whose file no longer matches its checksum"),
+		query("tag", "string", "Only photos with this tag"),
+		query("untagged", "boolean", "Only photos without tags, or only tagged ones"),
+		query("bbox", "string", "minLon,minLat,maxLon,maxLat"),
+		query("near", "string", "lat,lon, with radius"),
+		query("radius", "number", "Kilometres around near"),
+		query("country", "string", "ISO 3166-1 alpha-2 code"),
+		query("city", "string", ""),
+		query("place", "string", ""),
+		query("q", "string", "Searches titles, captions, descriptions and original filenames"),
+		query("uploaded_after", "string", "Date (2024-05-17) or RFC 3339 time"),
+		query("uploaded_before", "string", "Date or RFC 3339 time"),
+		query("taken_after", "string", "Date or RFC 3339 time"),
+		query("taken_before", "string", "Date or RFC 3339 time"),
+		{Name: "metadata", In: "query", Style: "deepObject", Description: "metadata[key]=value matches custom fields",
+			Schema: &openapi.Schema{Type: "object", AdditionalProperties: openapi.Scalar("string")}},
+	}
+	photoIncludeParams = []openapi.Parameter{
+		query("include_library", "boolean", ""),
+		query("include_albums", "boolean", ""),
+		query("include_tags", "boolean", ""),
+	}
+	signedURLParams = []openapi.Parameter{
+		query("expires", "integer", "Expiry of a signed URL, Unix seconds"),
+		query("signature", "string", "Signature of a signed URL"),
+		query("nonce", "string", "One-time signed URLs"),
+	}
+	suggestionParams = []openapi.Parameter{
+		query("status", "string", "pending (default), accepted, rejected or all"),
+		query("min_confidence", "number", "From 0 to 1"),
+	}
+)
+
+// params joins parameter lists
+func params(lists ...[]openapi.Parameter) []openapi.Parameter {
+	var all []openapi.Parameter
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// routeDocs documents every route, keyed by method and gin path. /api/v2
+// serves the same routes as /api/v1 and isn't listed separately.
+var routeDocs = map[string]routeDoc{
+	"GET /api/v1/capabilities": {Summary: "Get upload limits, enabled features and API version", Response: objectResponse{}},
+	"POST /api/v1/batch": {Summary: "Run up to 50 requests in one call",
+		Description: "Sub-requests run in order. Atomic batches run in one transaction and roll back at the first failure.",
+		Body:        executeBatchRequest{}, Response: batchResponse{}},
+
+	"POST /api/v1/libraries": {Summary: "Create a library", Body: createLibraryRequest{}, Status: http.StatusCreated, Response: models.Library{}},
+	"GET /api/v1/libraries": {Summary: "List libraries", Response: []models.Library{},
+		Query: []openapi.Parameter{query("include_counts", "boolean", "Include albums and photos")}},
+	"GET /api/v1/libraries/:id": {Summary: "Get a library", Response: models.Library{},
+		Query: []openapi.Parameter{query("include_albums", "boolean", ""), query("include_photos", "boolean", "")}},
+	"PUT /api/v1/libraries/:id": {Summary: "Update a library",
+		Description: "Changing images moves the files as a background job and answers 202 Accepted. With dry_run=true the planned relocation is reported instead.",
+		Query:       []openapi.Parameter{query("dry_run", "boolean", "Report what the update would do")},
+		Body:        updateLibraryRequest{}, Response: models.Library{}, Also: map[int]interface{}{http.StatusAccepted: relocationResponse{}}},
+	"DELETE /api/v1/libraries/:id":      {Summary: "Delete a library, its photos and files", Response: messageResponse{}},
+	"GET /api/v1/libraries/:id/stats":   {Summary: "Get library statistics", Response: objectResponse{}},
+	"POST /api/v1/libraries/:id/rescan": {Summary: "Detect changed and missing files", Job: true},
+	"POST /api/v1/libraries/:id/scan":   {Summary: "Import files in the images directory that aren't photos yet", Job: true},
+	"POST /api/v1/libraries/:id/import/apple": {Summary: "Import an Apple Photos or iCloud Photos export from the server's disk",
+		Body: AppleImportRequest{}, Job: true},
+	"POST /api/v1/libraries/:id/verify": {Summary: "Check every photo file against its checksum", Job: true},
+	"GET /api/v1/libraries/:id/audit": {Summary: "Report missing files, untracked files and dangling rows",
+		Query: []openapi.Parameter{query("fix", "boolean", "Repair what is found")}, Response: auditResponse{}},
+
+	"POST /api/v1/albums": {Summary: "Create an album", Body: createAlbumRequest{}, Status: http.StatusCreated, Response: models.Album{}},
+	"GET /api/v1/albums": {Summary: "List albums", Response: []models.Album{}, Query: params([]openapi.Parameter{
+		query("library_id", "uuid", "Only albums in this library"),
+		query("tag", "string", "Only albums with this tag"),
+		query("include_library", "boolean", ""), query("include_photos", "boolean", ""), query("include_tags", "boolean", ""),
+	})},
+	"GET /api/v1/albums/:id": {Summary: "Get an album", Response: models.Album{}, Query: []openapi.Parameter{
+		query("include_library", "boolean", ""), query("include_photos", "boolean", ""), query("include_tags", "boolean", ""),
+	}},
+	"GET /api/v1/albums/:id/photos": {Summary: "List an album's photos in album order", Response: photoPage{},
+		Query: params(pageParams, []openapi.Parameter{
+			query("order", "string", "Sort mode overriding the album's: manual, uploaded_at, taken_at, filename or rating"),
+			query("order_by", "string", "order for the manual order, or a photo list field"),
+			query("order_dir", "string", "asc or desc"),
+		})},
+	"PUT /api/v1/albums/:id":    {Summary: "Update an album", Body: updateAlbumRequest{}, Response: models.Album{}},
+	"DELETE /api/v1/albums/:id": {Summary: "Delete an album", Response: messageResponse{}},
+	"POST /api/v1/albums/:id/photos": {Summary: "Add photos to an album",
+		Description: "Either photo_id with an order, or up to 1000 photo_ids placed from start_position.",
+		Body:        addAlbumPhotosRequest{}, Status: http.StatusCreated, Response: albumPhotosAddedResponse{}},
+	"DELETE /api/v1/albums/:id/photos/:photo_id": {Summary: "Remove a photo from an album", Response: messageResponse{}},
+	"POST /api/v1/albums/:id/photos/remove":      {Summary: "Remove many photos from an album", Body: removeAlbumPhotosRequest{}, Response: albumPhotosRemovedResponse{}},
+	"PUT /api/v1/albums/:id/photos/order": {Summary: "Renumber an album's photos, or move some to a position", Body: reorderAlbumPhotosRequest{}, Response: albumReorderResponse{},
+		Description: "Without position, photo_ids lists every photo of the album in its new order."},
+	"PUT /api/v1/albums/:id/photos/:photo_id/order": {Summary: "Change a photo's position in an album", Body: photoOrderRequest{}, Response: messageResponse{}},
+	"PUT /api/v1/albums/:id/cover":                  {Summary: "Set or clear the album cover", Body: albumCoverRequest{}, Response: models.Album{}},
+	"POST /api/v1/albums/:id/duplicate": {Summary: "Duplicate an album, optionally into another library", Body: duplicateAlbumRequest{},
+		Status: http.StatusCreated, Response: duplicateAlbumResponse{},
+		Description: "The new album has the same photos in the same order. Duplicating into another library copies the photos there."},
+	"POST /api/v1/albums/:id/shares": {Summary: "Share an album through a link that needs no API key", Body: createShareRequest{},
+		Status: http.StatusCreated, Response: models.AlbumShare{}},
+	"GET /api/v1/albums/:id/shares":              {Summary: "List an album's shares", Response: []models.AlbumShare{}},
+	"DELETE /api/v1/albums/:id/shares/:share_id": {Summary: "Revoke a share", Response: messageResponse{}},
+	"GET /api/v1/albums/:id/download": {Summary: "Download an album's photos as a ZIP", Produces: "application/zip",
+		Query: []openapi.Parameter{
+			query("size", "string", "original or a thumbnail size"),
+			query("embed_metadata", "boolean", "Write current metadata into JPEGs, with XMP sidecars for other formats"),
+		}},
+
+	"POST /api/v1/photos/upload": {Summary: "Upload a photo", Form: uploadForm{}, Status: http.StatusCreated, Response: models.Photo{},
+		Description: "With dedupe=link a file already in the library returns the existing photo with 200 OK; with dedupe=reject it fails with 409 Conflict."},
+	"POST /api/v1/photos/upload/batch": {Summary: "Upload many photos in one request", Form: batchUploadForm{}, Response: batchUploadResponse{}},
+	"POST /api/v1/photos/batch": {Summary: "Apply one operation to many photos in one transaction",
+		Body: photoBatchRequest{}, Response: photoBatchResponse{}},
+	"POST /api/v1/photos/bulk-copy": {Summary: "Copy many photos to a library", Body: bulkCopyRequest{}, Job: true},
+	"POST /api/v1/photos/export": {Summary: "Download selected photos, by ID or filter, as a ZIP",
+		Body: exportRequest{}, Produces: "application/zip"},
+	"POST /api/v1/photos/download": {Summary: "Download the listed photos as a ZIP, in the order given",
+		Body: downloadPhotosRequest{}, Produces: "application/zip"},
+	"POST /api/v1/photos/geocode":      {Summary: "Look up the places of new GPS positions", Job: true},
+	"POST /api/v1/photos/classify":     {Summary: "Suggest tags for photos that haven't been classified", Job: true},
+	"POST /api/v1/photos/detect-faces": {Summary: "Find faces in photos that haven't been scanned and cluster them into people", Job: true},
+	"POST /api/v1/photos/hash":         {Summary: "Compute the perceptual hashes of photos that lack one", Job: true},
+	"GET /api/v1/photos": {Summary: "List photos", Response: photoPage{}, Query: params(photoFilterParams, pageParams, photoIncludeParams, []openapi.Parameter{
+		query("order_by", "string", "uploaded_at, created_at, rating, filename or file_size"),
+		query("order_dir", "string", "asc or desc"),
+		query("cursor", "string", "Continue from pagination.next_cursor instead of a page"),
+	})},
+	"GET /api/v1/photos/timeline": {Summary: "Count photos per day, month or year", Response: timelineResponse{}, Query: params([]openapi.Parameter{
+		query("granularity", "string", "day, month or year"),
+		query("thumbnails", "integer", "Photos per period, 0-10"),
+	}, photoFilterParams, pageParams)},
+	"GET /api/v1/photos/:id":    {Summary: "Get a photo", Response: models.Photo{}},
+	"PUT /api/v1/photos/:id":    {Summary: "Update a photo's rating, favorite flag, texts or position", Body: updatePhotoRequest{}, Response: models.Photo{}},
+	"DELETE /api/v1/photos/:id": {Summary: "Move a photo to the trash", Response: messageResponse{}},
+	"GET /api/v1/photos/:id/file": {Summary: "Download the photo file", Produces: "application/octet-stream",
+		Description: "Edited photos are served as a JPEG of their current version. Scaled or cropped with w, h and fit. Accepts signed file_url links without an API key.",
+		Query: params([]openapi.Parameter{
+			query("w", "integer", "Width in pixels"),
+			query("h", "integer", "Height in pixels"),
+			query("fit", "string", "contain or cover"),
+			query("embed_metadata", "boolean", "Write current metadata into a JPEG original"),
+			query("version", "string", "original or an edit version number, the version being served by default"),
+		}, signedURLParams)},
+	"GET /api/v1/photos/:id/thumbnail": {Summary: "Download a JPEG rendition", Produces: "image/jpeg",
+		Query: params([]openapi.Parameter{
+			query("size", "string", "Rendition, small by default"),
+			query("version", "string", "original or an edit version number, the version being served by default"),
+		}, signedURLParams)},
+	"GET /api/v1/photos/:id/motion":  {Summary: "Download the clip embedded in a Motion Photo", Produces: "video/mp4", Query: signedURLParams},
+	"GET /api/v1/photos/:id/preview": {Summary: "Download the JPEG preview embedded in a RAW file", Produces: "image/jpeg", Query: signedURLParams},
+	"GET /api/v1/photos/:id/frame": {Summary: "Download the frame of a video at a timestamp", Produces: "image/jpeg",
+		Query: []openapi.Parameter{
+			{Name: "t", In: "query", Required: true, Description: "Seconds into the video, below its duration", Schema: openapi.Scalar("number")},
+			query("w", "integer", "Width in pixels"),
+			query("h", "integer", "Height in pixels"),
+			query("fit", "string", "contain or cover"),
+		}},
+	"POST /api/v1/photos/:id/copy": {Summary: "Copy a photo to the same or another library", Body: copyPhotoRequest{},
+		Status: http.StatusCreated, Response: copyPhotoResponse{}},
+	"POST /api/v1/photos/:id/move": {Summary: "Move a photo to another library", Body: movePhotoRequest{}, Response: models.Photo{}},
+	"POST /api/v1/photos/:id/download-url": {Summary: "Create a temporary signed URL for the original",
+		Body: downloadURLRequest{}, Status: http.StatusCreated, Response: downloadURLResponse{}},
+	"POST /api/v1/photos/:id/signed-url": {Summary: "Create an expiring signed URL for embedding the file or a thumbnail",
+		Body: signedURLRequest{}, Status: http.StatusCreated, Response: signedURLResponse{}},
+	"PUT /api/v1/photos/:id/storage-tier": {Summary: "Move the original between hot and cold storage", Body: storageTierRequest{}, Response: models.Photo{}},
+	"POST /api/v1/photos/:id/rotate":      {Summary: "Rotate or flip the original", Body: rotateRequest{}, Response: models.Photo{}},
+	"POST /api/v1/photos/:id/edits": {Summary: "Save a new version with crop, rotate, exposure and filter edits",
+		Description: "Operations are added to the stack of the version being served, or to none with from_original. The file is never changed.",
+		Body:        editPhotoRequest{}, Status: http.StatusCreated, Response: models.PhotoVersion{}},
+	"GET /api/v1/photos/:id/edits":            {Summary: "List a photo's edit versions", Response: photoVersionsResponse{}},
+	"POST /api/v1/photos/:id/edits/restore":   {Summary: "Choose the version served, 0 for the original", Body: restoreVersionRequest{}, Response: models.Photo{}},
+	"POST /api/v1/photos/:id/verify":          {Summary: "Check the file against its checksum", Response: verifyResult{}},
+	"POST /api/v1/photos/:id/restore":         {Summary: "Restore a photo from the trash", Response: models.Photo{}},
+	"POST /api/v1/photos/:id/favorite":        {Summary: "Toggle the favorite flag", Response: models.Photo{}},
+	"GET /api/v1/photos/:id/metadata":         {Summary: "Get a photo's custom fields", Response: metadataResponse{}},
+	"PUT /api/v1/photos/:id/metadata":         {Summary: "Set custom fields, null removes one", Body: setMetadataRequest{}, Response: metadataResponse{}},
+	"DELETE /api/v1/photos/:id/metadata/:key": {Summary: "Remove a custom field", Response: messageResponse{}},
+	"GET /api/v1/photos/:id/suggestions": {Summary: "List a photo's tag suggestions, most confident first",
+		Response: []models.TagSuggestion{}, Query: suggestionParams},
+	"GET /api/v1/photos/:id/faces": {Summary: "List the faces found in a photo with their people, largest first", Response: []models.Face{}},
+	"GET /api/v1/photos/:id/similar": {Summary: "List photos that look like a photo, most similar first", Response: similarPhotoPage{},
+		Description: "Compares perceptual hashes. Filters narrow the candidates, library_id to search within one library.",
+		Query: params([]openapi.Parameter{
+			query("threshold", "integer", "Most bits the hashes may differ in, 0-64, 10 by default"),
+		}, photoFilterParams, pageParams)},
+
+	"POST /api/v1/tags": {Summary: "Create a tag", Body: createTagRequest{}, Status: http.StatusCreated, Response: models.Tag{}},
+	"GET /api/v1/tags": {Summary: "List tags", Response: []models.Tag{}, Query: []openapi.Parameter{
+		query("include_count", "boolean", "Include photo_count"), query("include_photos", "boolean", ""),
+	}},
+	"GET /api/v1/tags/top": {Summary: "Rank tags by recent use", Response: topTagsResponse{}, Query: []openapi.Parameter{
+		query("window", "string", "7d, 2w, 12h or all, 30d by default"),
+		query("limit", "integer", "At most 100, 10 by default"),
+	}},
+	"POST /api/v1/tags/batch": {Summary: "Add and remove tags on many photos in one transaction", Body: batchTagsRequest{}, Response: batchTagsResponse{},
+		Description: "Tags to add are created when missing. Unknown photos fail the whole batch with photo_ids listed."},
+	"GET /api/v1/tags/suggest": {Summary: "Complete a partly typed tag name, most used first", Response: tagCompletionsResponse{},
+		Description: "Tags whose name or an alias starts with q come first, then names containing q or a typo away from it.",
+		Query: []openapi.Parameter{
+			query("q", "string", "The start of a tag name"),
+			query("limit", "integer", "At most 50, 10 by default"),
+		}},
+	"GET /api/v1/tags/:id": {Summary: "Get a tag", Response: models.Tag{},
+		Query: []openapi.Parameter{query("include_photos", "boolean", "")}},
+	"GET /api/v1/tags/:id/photos":               {Summary: "List a tag's photos", Query: params(photoFilterParams, pageParams), Response: photoPage{}},
+	"PUT /api/v1/tags/:id":                      {Summary: "Update a tag", Body: updateTagRequest{}, Response: models.Tag{}},
+	"DELETE /api/v1/tags/:id":                   {Summary: "Delete a tag", Response: messageResponse{}},
+	"POST /api/v1/tags/:id/photos":              {Summary: "Tag a photo", Body: tagPhotoRequest{}, Response: messageResponse{}},
+	"DELETE /api/v1/tags/:id/photos/:photo_id":  {Summary: "Untag a photo", Response: messageResponse{}},
+	"POST /api/v1/tags/:id/albums":              {Summary: "Tag an album", Body: tagAlbumRequest{}, Response: messageResponse{}},
+	"DELETE /api/v1/tags/:id/albums/:album_id":  {Summary: "Untag an album", Response: messageResponse{}},
+	"GET /api/v1/tags/:id/stats":                {Summary: "Get tag statistics", Response: objectResponse{}},
+	"GET /api/v1/tags/:id/aliases":              {Summary: "List a tag's aliases, by name", Response: []models.TagAlias{}},
+	"POST /api/v1/tags/:id/aliases":             {Summary: "Add an alias that resolves to the tag in uploads and filters", Body: tagAliasRequest{}, Status: http.StatusCreated, Response: models.TagAlias{}},
+	"PUT /api/v1/tags/:id/aliases/:alias_id":    {Summary: "Rename a tag alias", Body: tagAliasRequest{}, Response: models.TagAlias{}},
+	"DELETE /api/v1/tags/:id/aliases/:alias_id": {Summary: "Remove a tag alias", Response: messageResponse{}},
+
+	"GET /api/v1/suggestions": {Summary: "List tag suggestions, most confident first", Response: suggestionPage{},
+		Query: params(suggestionParams, pageParams, []openapi.Parameter{query("photo_id", "uuid", "Only this photo's suggestions")})},
+	"POST /api/v1/suggestions/review": {Summary: "Accept and reject tag suggestions in one transaction",
+		Description: "Accepting tags the photo, creating the tag if needed.",
+		Body:        reviewSuggestionsRequest{}, Response: reviewSuggestionsResponse{}},
+
+	"GET /api/v1/people": {Summary: "List people, named first, then by face count", Response: peoplePage{},
+		Query: params([]openapi.Parameter{
+			query("named", "boolean", "Only named or only unnamed people"),
+			query("name", "string", "Name contains, case-insensitive"),
+		}, pageParams)},
+	"GET /api/v1/people/:id": {Summary: "Get a person", Response: models.Person{}},
+	"PUT /api/v1/people/:id": {Summary: "Name or rename a person, an empty name unnames them", Body: updatePersonRequest{}, Response: models.Person{},
+		Description: "Names are unique; naming a person like another returns 409 Conflict with the other's person_id, to merge them instead."},
+	"DELETE /api/v1/people/:id": {Summary: "Delete a person, keeping their faces without a person", Response: messageResponse{}},
+	"POST /api/v1/people/:id/merge": {Summary: "Move other people's faces to the person and delete them",
+		Body: mergePeopleRequest{}, Response: models.Person{}},
+	"GET /api/v1/people/:id/photos": {Summary: "List the photos a person appears in", Query: params(photoFilterParams, pageParams), Response: photoPage{}},
+	"PUT /api/v1/faces/:id":         {Summary: "Move a face to another person, or to none", Body: updateFaceRequest{}, Response: models.Face{}},
+
+	"GET /api/v1/jobs":     {Summary: "List background jobs, newest first", Response: []jobs.Snapshot{}},
+	"GET /api/v1/jobs/:id": {Summary: "Get a background job's status and results", Response: jobs.Snapshot{}},
+
+	"POST /api/v1/apikeys":       {Summary: "Create an API key, shown once", Body: createAPIKeyRequest{}, Status: http.StatusCreated, Response: createdAPIKeyResponse{}},
+	"GET /api/v1/apikeys":        {Summary: "List API keys", Response: []models.APIKey{}},
+	"DELETE /api/v1/apikeys/:id": {Summary: "Revoke an API key", Response: messageResponse{}},
+
+	"POST /api/v1/storage/tiering": {Summary: "Move old originals to cold storage", Job: true},
+	"GET /api/v1/storage/usage":    {Summary: "Get free space on library volumes and total photo size", Response: objectResponse{}},
+
+	"GET /api/v1/trash":        {Summary: "List photos in the trash", Query: params(photoFilterParams, pageParams), Response: trashPage{}},
+	"DELETE /api/v1/trash":     {Summary: "Permanently delete everything in the trash", Job: true},
+	"DELETE /api/v1/trash/:id": {Summary: "Permanently delete a photo in the trash", Response: messageResponse{}},
+
+	"POST /api/v1/admin/backup": {Summary: "Snapshot the SQLite database into the backup directory", Body: backupRequest{}, Job: true,
+		Description: "Needs a full-scope key, and the admin key in multi-tenant mode. The job's result describes the backup."},
+	"GET /api/v1/admin/backups":                {Summary: "List database backups, newest first", Response: []backupInfo{}},
+	"GET /api/v1/admin/backups/:name":          {Summary: "Download a database backup", Produces: "application/vnd.sqlite3"},
+	"GET /api/v1/admin/backups/:name/manifest": {Summary: "Download the photo file manifest of a backup", Produces: "application/json"},
+
+	"GET /graphql": {Summary: "Run a GraphQL query given in the query string", Response: graphqlResponse{}, Query: []openapi.Parameter{
+		{Name: "query", In: "query", Required: true, Description: "The GraphQL query", Schema: openapi.Scalar("string")},
+		query("operationName", "string", "Operation to run when the query holds several"),
+		query("variables", "string", "Variables as a JSON object"),
+	}},
+	"POST /graphql": {Summary: "Run a GraphQL query",
+		Description: "Queries libraries, albums, photos and tags with nested relations, such as an album's photos and their tags. " +
+			"Fields are named like the REST API's JSON. The API is read-only, so read-scoped API keys may use it.",
+		Body: graphqlRequest{}, Response: graphqlResponse{}},
+
+	"GET /feeds/library/:feed": {Summary: "Atom feed of a library's recent uploads", Produces: "application/atom+xml",
+		Description: "feed is the library ID followed by .atom. Entries link the file and enclose a medium thumbnail.",
+		Query:       []openapi.Parameter{query("limit", "integer", "Entries, 50 by default and at most 100")}},
+	"GET /feeds/album/:feed": {Summary: "Atom feed of an album's recently uploaded photos", Produces: "application/atom+xml",
+		Description: "feed is the album ID followed by .atom.",
+		Query:       []openapi.Parameter{query("limit", "integer", "Entries, 50 by default and at most 100")}},
+
+	"GET /webdav/*path": {Summary: "Download a photo's original from the WebDAV mount", Produces: "application/octet-stream",
+		Description: "The mount is read-only. Folders are listed with PROPFIND: libraries, each with Albums and Photos folders."},
+	"HEAD /webdav/*path": {Summary: "Check a photo's original on the WebDAV mount", Produces: "application/octet-stream"},
+
+	"GET /shared/:token": {Summary: "Gallery of a shared album, or its password form", Produces: "text/html",
+		Query: pageParams},
+	"POST /shared/:token": {Summary: "Unlock a password protected share", Produces: "text/html", Status: http.StatusSeeOther,
+		Description: "Takes the password form field and sets a cookie for the share, then redirects to the gallery."},
+	"GET /shared/:token/album": {Summary: "Get a shared album and a page of its photos", Response: sharedAlbumResponse{},
+		Description: "Password protected shares need the password in the X-Share-Password header.", Query: pageParams},
+	"GET /shared/:token/photos/:id/file": {Summary: "Download a photo of a shared album", Produces: "application/octet-stream"},
+	"GET /shared/:token/photos/:id/thumbnail": {Summary: "Download a JPEG rendition of a photo of a shared album", Produces: "image/jpeg",
+		Query: []openapi.Parameter{query("size", "string", "Rendition, small by default")}},
+
+	"GET /health":  {Summary: "Health check", Response: objectResponse{}},
+	"GET /healthz": {Summary: "Liveness probe", Response: objectResponse{}},
+	"GET /readyz": {Summary: "Readiness probe: database, migrations and storage", Response: readinessResponse{},
+		Also: map[int]interface{}{http.StatusServiceUnavailable: readinessResponse{}}},
+	"GET /metrics":          {Summary: "Metrics in the Prometheus text format", Produces: "text/plain"},
+	"GET /api":              {Summary: "API overview with links to this spec", Response: objectResponse{}},
+	"GET /api/openapi.json": {Summary: "This OpenAPI specification", Response: objectResponse{}},
+	"GET /api/docs":         {Summary: "Swagger UI for this specification", Produces: "text/html"},
+}
+
+// routeTagDescriptions describes the groups operations are tagged with, the
+// first path segment under /api/v1, or graphql
+var routeTagDescriptions = map[string]string{
+	"capabilities": "What this server supports",
+	"batch":        "Many requests in one round trip",
+	"libraries":    "Libraries and their storage",
+	"albums":       "Albums within libraries",
+	"photos":       "Photos, their files and metadata",
+	"tags":         "Tags on photos and albums",
+	"jobs":         "Background jobs",
+	"apikeys":      "API keys for automation",
+	"storage":      "Storage tiers and capacity",
+	"trash":        "Deleted photos",
+	"admin":        "Database backups and other server administration",
+	"graphql":      "GraphQL queries over libraries, albums, photos and tags",
+	"server":       "Health, metrics and documentation",
+}
+
+// DocsHandler serves the OpenAPI specification of the routes registered on a
+// router, and Swagger UI to browse it
+type DocsHandler struct {
+	router *gin.Engine
+	config *config.Config
+
+	once sync.Once
+	spec []byte
+	err  error
+}
+
+// NewDocsHandler creates a new docs handler. The spec is built on first
+// request, once every route has been registered.
+func NewDocsHandler(router *gin.Engine, cfg *config.Config) *DocsHandler {
+	return &DocsHandler{router: router, config: cfg}
+}
+
+// GetIndex points at the specification and its documentation
+func (h *DocsHandler) GetIndex(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"service": "Photo Library Management Server",
+		"version": ServerVersion,
+		"api_versions": gin.H{
+			"/api/v1": "Plain JSON responses",
+			"/api/v2": "The same endpoints with responses wrapped in {data, meta, errors}",
+		},
+		"openapi": "/api/openapi.json",
+		"docs":    "/api/docs",
+	})
+}
+
+// GetOpenAPISpec serves the OpenAPI 3 specification as JSON
+func (h *DocsHandler) GetOpenAPISpec(c *gin.Context) {
+	h.once.Do(func() {
+		var doc *openapi.Document
+		if doc, h.err = BuildOpenAPISpec(h.router.Routes(), h.config); h.err == nil {
+			h.spec, h.err = json.Marshal(doc)
+		}
+	})
+	if h.err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, h.err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.spec)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the spec
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Photo Library API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// GetSwaggerUI serves Swagger UI for the specification
+func (h *DocsHandler) GetSwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+// jsonContent is a JSON body with the given schema, none for a nil schema
+func jsonContent(schema *openapi.Schema) map[string]openapi.MediaType {
+	if schema == nil {
+		return nil
+	}
+	return map[string]openapi.MediaType{"application/json": {Schema: schema}}
+}
+
+// BuildOpenAPISpec describes the given routes with routeDocs. Routes without
+// docs, and docs without a route, are errors, so the two can't drift apart.
+func BuildOpenAPISpec(routes gin.RoutesInfo, cfg *config.Config) (*openapi.Document, error) {
+	registry := openapi.NewRegistry()
+	registry.Define(gorm.DeletedAt{}, &openapi.Schema{Type: "string", Format: "date-time", Nullable: true})
+	registry.Define(objectResponse{}, &openapi.Schema{Type: "object"})
+	errorSchema := registry.Schema(errorResponse{})
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "Photo Library Management Server",
+			Version: ServerVersion,
+			Description: "Every /api/v1 operation is also served under /api/v2, with JSON responses wrapped in " +
+				"a {data, meta, errors} envelope, where errors are {status, code, message, details}.",
+		},
+		Paths: map[string]openapi.PathItem{},
+		Components: openapi.Components{SecuritySchemes: map[string]openapi.SecurityScheme{
+			"apiKey": {Type: "apiKey", In: "header", Name: apikeys.Header, Description: "read, upload or full scope"},
+		}},
+	}
+	if !cfg.RequireAPIKey {
+		doc.Security = []openapi.SecurityRequirement{{}, {"apiKey": {}}} // Keys are optional
+	} else {
+		doc.Security = []openapi.SecurityRequirement{{"apiKey": {}}}
+	}
+
+	var undocumented []string
+	documented := map[string]bool{}
+	tags := map[string]bool{}
+	for _, route := range routes {
+		// OpenAPI has no place for WebDAV's PROPFIND
+		if strings.HasPrefix(route.Path, "/api/v2/") || route.Method == http.MethodOptions || route.Method == apikeys.MethodPropfind {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		rd, ok := routeDocs[key]
+		if !ok {
+			undocumented = append(undocumented, key)
+			continue
+		}
+		documented[key] = true
+
+		path, names := openapi.Path(route.Path)
+		tag := "server"
+		if rest, ok := strings.CutPrefix(route.Path, "/api/v1/"); ok {
+			tag, _, _ = strings.Cut(rest, "/")
+		} else if route.Path == "/graphql" {
+			tag = "graphql" // Authenticated and tenant scoped like the REST API
+		} else if strings.HasPrefix(route.Path, "/feeds/") {
+			tag = "feeds" // Authenticated and tenant scoped like the REST API
+		} else if strings.HasPrefix(route.Path, "/webdav/") {
+			tag = "webdav" // API keys are sent as the Basic auth password
+		} else if strings.HasPrefix(route.Path, "/shared/") {
+			tag = "shared" // Open to anyone with the link, the share decides the tenant
+		}
+		tags[tag] = true
+
+		op := &openapi.Operation{
+			Tags:        []string{tag},
+			Summary:     rd.Summary,
+			Description: rd.Description,
+			OperationID: openapi.OperationID(route.Handler),
+			Responses:   map[string]*openapi.Response{},
+		}
+		open := tag == "server" || tag == "shared"
+		if open {
+			op.Security = []openapi.SecurityRequirement{{}} // Outside the API, no key needed
+		}
+
+		for _, name := range names {
+			schema := openapi.Scalar("uuid")
+			if name == "key" || name == "token" || name == "feed" || name == "path" {
+				schema = openapi.Scalar("string")
+			}
+			op.Parameters = append(op.Parameters, openapi.Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		}
+		op.Parameters = append(op.Parameters, rd.Query...)
+		if !open && cfg.TenantMode == middleware.TenantModeHeader {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name: cfg.TenantHeader, In: "header", Required: true, Description: "Tenant ID", Schema: openapi.Scalar("string"),
+			})
+		}
+
+		switch {
+		case rd.Body != nil:
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+				"application/json": {Schema: registry.Schema(rd.Body)},
+			}}
+		case rd.Form != nil:
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+				"multipart/form-data": {Schema: registry.Schema(rd.Form)},
+			}}
+		}
+
+		status := rd.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		switch {
+		case rd.Job:
+			op.Responses[strconv.Itoa(http.StatusAccepted)] = &openapi.Response{
+				Description: "Job started",
+				Headers:     map[string]openapi.Header{"Location": {Description: "The job's status URL", Schema: openapi.Scalar("string")}},
+				Content:     jsonContent(registry.Schema(jobs.Snapshot{})),
+			}
+		case rd.Produces != "":
+			op.Responses[strconv.Itoa(status)] = &openapi.Response{
+				Description: http.StatusText(status),
+				Content:     map[string]openapi.MediaType{rd.Produces: {Schema: openapi.Scalar("binary")}},
+			}
+		default:
+			op.Responses[strconv.Itoa(status)] = &openapi.Response{Description: http.StatusText(status), Content: jsonContent(registry.Schema(rd.Response))}
+		}
+		for status, body := range rd.Also {
+			op.Responses[strconv.Itoa(status)] = &openapi.Response{Description: http.StatusText(status), Content: jsonContent(registry.Schema(body))}
+		}
+		op.Responses["default"] = &openapi.Response{Description: "Error", Content: jsonContent(errorSchema)}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = openapi.PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	var stale []string
+	for key := range routeDocs {
+		if !documented[key] {
+			stale = append(stale, key)
+		}
+	}
+	if len(undocumented) > 0 || len(stale) > 0 {
+		sort.Strings(undocumented)
+		sort.Strings(stale)
+		return nil, fmt.Errorf("OpenAPI docs out of sync with routes: undocumented %v, no route for %v", undocumented, stale)
+	}
+
+	for name := range tags {
+		doc.Tags = append(doc.Tags, openapi.Tag{Name: name, Description: routeTagDescriptions[name]})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	doc.Components.Schemas = registry.Schemas()
+	return doc, nil
+}
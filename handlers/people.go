@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Longest accepted person name
+const maxPersonNameLength = 100
+
+// withFaceCounts selects people with the number of their faces in photos
+// outside the trash
+func withFaceCounts(query *gorm.DB) *gorm.DB {
+	return query.Model(&models.Person{}).
+		Select("people.*, (SELECT COUNT(*) FROM faces JOIN photos ON photos.id = faces.photo_id WHERE faces.person_id = people.id AND photos.deleted_at IS NULL) AS face_count")
+}
+
+// GetPeople returns a page of people, named ones first and then by how many
+// faces they have. named=true or named=false lists only those.
+func (h *FaceHandler) GetPeople(c *gin.Context) {
+	filtered := func() (*gorm.DB, error) {
+		query := scopedDB(c, h.db).Model(&models.Person{})
+		switch c.Query("named") {
+		case "":
+		case "true":
+			query = query.Where("people.name <> ''")
+		case "false":
+			query = query.Where("people.name = ''")
+		default:
+			return nil, fmt.Errorf("Invalid named, use true or false")
+		}
+		if name := strings.TrimSpace(c.Query("name")); name != "" {
+			query = query.Where("LOWER(people.name) LIKE ?", "%"+strings.ToLower(name)+"%")
+		}
+		return query, nil
+	}
+
+	query, err := filtered()
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	page, limit := pagination(c)
+	people := []models.Person{}
+	if err := withFaceCounts(query).
+		Order("people.name = '', face_count desc, people.name, people.id").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&people).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch people")
+		return
+	}
+
+	var total int64
+	countQuery, _ := filtered()
+	countQuery.Count(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"people": people,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetPerson returns a single person
+func (h *FaceHandler) GetPerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_person_id", "Invalid person ID")
+		return
+	}
+
+	var person models.Person
+	if err := withFaceCounts(scopedDB(c, h.db)).First(&person, "people.id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "person_not_found", "Person not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch person")
+		return
+	}
+
+	c.JSON(http.StatusOK, person)
+}
+
+// updatePersonRequest is the JSON body of UpdatePerson
+type updatePersonRequest struct {
+	Name *string `json:"name" binding:"required"` // Empty makes the person unnamed again
+}
+
+// UpdatePerson names a person, or renames one. Names are unique, so two
+// clusters of the same person are merged rather than given one name.
+func (h *FaceHandler) UpdatePerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_person_id", "Invalid person ID")
+		return
+	}
+
+	var req updatePersonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	name := strings.TrimSpace(*req.Name)
+	if len([]rune(name)) > maxPersonNameLength {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Name can be at most 100 characters")
+		return
+	}
+
+	var person models.Person
+	if err := scopedDB(c, h.db).First(&person, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "person_not_found", "Person not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch person")
+		return
+	}
+
+	if name != "" {
+		var existing models.Person
+		err := scopedDB(c, h.db).Select("id").
+			Where("name = ? AND id <> ?", name, person.ID).First(&existing).Error
+		if err == nil {
+			apierror.RespondWithDetails(c, http.StatusConflict, "duplicate_person",
+				"Another person has this name, merge them instead", gin.H{"person_id": existing.ID})
+			return
+		}
+		if err != gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check person names")
+			return
+		}
+	}
+
+	if err := scopedDB(c, h.db).Model(&person).Update("name", name).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update person")
+		return
+	}
+
+	withFaceCounts(scopedDB(c, h.db)).First(&person, "people.id = ?", person.ID)
+	c.JSON(http.StatusOK, person)
+}
+
+// DeletePerson deletes a person. Their faces stay with their photos, without
+// a person, and can be assigned to another with PUT /faces/:id.
+func (h *FaceHandler) DeletePerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_person_id", "Invalid person ID")
+		return
+	}
+
+	h.cluster.Lock()
+	defer h.cluster.Unlock()
+
+	err = scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Face{}).Where("person_id = ?", id).Update("person_id", nil).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update faces"}
+		}
+		result := tx.Delete(&models.Person{}, id)
+		if result.Error != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete person"}
+		}
+		if result.RowsAffected == 0 {
+			return &photoOpError{http.StatusNotFound, "person_not_found", "Person not found"}
+		}
+		return nil
+	})
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Person deleted successfully"})
+}
+
+// mergePeopleRequest is the JSON body of MergePeople
+type mergePeopleRequest struct {
+	PersonIDs []uuid.UUID `json:"person_ids" binding:"required,min=1,max=100"` // People merged into the person and deleted
+}
+
+// MergePeople moves the faces of other people to a person and deletes them,
+// joining clusters that turned out to be the same person. The person keeps
+// their name.
+func (h *FaceHandler) MergePeople(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_person_id", "Invalid person ID")
+		return
+	}
+
+	var req mergePeopleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	merged := map[uuid.UUID]bool{}
+	for _, other := range req.PersonIDs {
+		if other == id {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "A person can't be merged into themselves")
+			return
+		}
+		merged[other] = true
+	}
+
+	h.cluster.Lock()
+	defer h.cluster.Unlock()
+
+	err = scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&models.Person{}, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return &photoOpError{http.StatusNotFound, "person_not_found", "Person not found"}
+			}
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch person"}
+		}
+
+		var found int64
+		if err := tx.Model(&models.Person{}).Where("id IN ?", req.PersonIDs).Count(&found).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch people"}
+		}
+		if int(found) != len(merged) {
+			return &photoOpError{http.StatusNotFound, "person_not_found", "Person not found"}
+		}
+
+		if err := tx.Model(&models.Face{}).Where("person_id IN ?", req.PersonIDs).Update("person_id", id).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to move faces"}
+		}
+		if err := tx.Where("id IN ?", req.PersonIDs).Delete(&models.Person{}).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete people"}
+		}
+		if err := recomputeCentroid(tx, id); err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update person"}
+		}
+		return nil
+	})
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	var person models.Person
+	withFaceCounts(scopedDB(c, h.db)).First(&person, "people.id = ?", id)
+	c.JSON(http.StatusOK, person)
+}
+
+// GetPersonPhotos returns a page of the photos a person appears in,
+// filterable like GET /photos
+func (h *FaceHandler) GetPersonPhotos(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_person_id", "Invalid person ID")
+		return
+	}
+
+	if err := scopedDB(c, h.db).Select("id").First(&models.Person{}, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "person_not_found", "Person not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch person")
+		return
+	}
+
+	// A subquery rather than a join, so photos with several faces of the
+	// person are listed once
+	withPerson := func() (*gorm.DB, error) {
+		pictured := h.db.Table("faces").Select("photo_id").Where("person_id = ?", id)
+		return filterPhotos(c, h.config, scopedDB(c, h.db).Model(&models.Photo{}).Where("photos.id IN (?)", pictured))
+	}
+
+	query, err := withPerson()
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	page, limit := pagination(c)
+	photos := []models.Photo{}
+	query = preloadPhotoRelations(c, query).
+		Order(listOrder(c, photoOrderColumns, "uploaded_at", "desc")).
+		Order("photos.id"). // Stable pages for photos uploaded together
+		Offset((page - 1) * limit).
+		Limit(limit)
+	if err := query.Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch person photos")
+		return
+	}
+
+	var total int64
+	countQuery, _ := withPerson()
+	countQuery.Count(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"photos": photos,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
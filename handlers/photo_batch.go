@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// photoBatchResult is the per-photo outcome of a photo batch
+type photoBatchResult struct {
+	PhotoID       uuid.UUID  `json:"photo_id"`
+	Status        string     `json:"status"` // "ok", "failed", "rolled_back" or "skipped"
+	CopiedPhotoID *uuid.UUID `json:"copied_photo_id,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// photoBatch is the state of a photo batch running in one transaction
+type photoBatch struct {
+	h             *PhotoHandler
+	tx            *gorm.DB
+	targetLibrary *models.Library // move and copy
+	album         *models.Album   // add_to_album
+	albumPosition int             // Next order value in album
+	rating        *int            // set_rating
+	tagIDs        []uuid.UUID     // add_tags and remove_tags
+
+	undos    []func() // File changes to reverse if the batch rolls back
+	finishes []func() // Work that waits for the batch to commit
+}
+
+// photoBatchRequest is the JSON body of BatchPhotos
+type photoBatchRequest struct {
+	PhotoIDs  []uuid.UUID `json:"photo_ids" binding:"required,min=1,max=1000"`
+	Operation string      `json:"operation" binding:"required,oneof=delete move copy set_rating add_tags remove_tags add_to_album"`
+	LibraryID uuid.UUID   `json:"library_id"`                                  // move and copy
+	AlbumID   uuid.UUID   `json:"album_id"`                                    // add_to_album
+	Rating    *int        `json:"rating" binding:"omitempty,min=0,max=5"`      // set_rating, null clears
+	Tags      []string    `json:"tags" binding:"omitempty,max=50,dive,max=50"` // add_tags and remove_tags
+}
+
+// BatchPhotos applies one operation to many photos in a single transaction.
+// Photos are processed in order and the first failure rolls back the whole
+// batch, so either every photo changes or none do. Moved and copied files
+// are put back when the batch rolls back.
+func (h *PhotoHandler) BatchPhotos(c *gin.Context) {
+	var req photoBatchRequest
+
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	batch := &photoBatch{h: h}
+	switch req.Operation {
+	case "move", "copy":
+		if req.LibraryID == uuid.Nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "library_id is required")
+			return
+		}
+		var targetLibrary models.Library
+		if err := scopedDB(c, h.db).First(&targetLibrary, req.LibraryID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				apierror.Respond(c, http.StatusNotFound, "target_library_not_found", "Target library not found")
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify target library")
+			return
+		}
+		batch.targetLibrary = &targetLibrary
+
+	case "add_to_album":
+		if req.AlbumID == uuid.Nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "album_id is required")
+			return
+		}
+		var album models.Album
+		if err := scopedDB(c, h.db).First(&album, req.AlbumID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify album")
+			return
+		}
+		batch.album = &album
+
+	case "set_rating":
+		// A null rating clears it, so tell that apart from one left out
+		var fields map[string]json.RawMessage
+		json.Unmarshal(c.MustGet(gin.BodyBytesKey).([]byte), &fields)
+		if _, ok := fields["rating"]; !ok {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "rating is required")
+			return
+		}
+		batch.rating = req.Rating
+
+	case "add_tags", "remove_tags":
+		if len(req.Tags) == 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "tags is required")
+			return
+		}
+	}
+
+	// Drop duplicate IDs while keeping the requested order
+	seen := make(map[uuid.UUID]bool)
+	var photoIDs []uuid.UUID
+	for _, photoID := range req.PhotoIDs {
+		if !seen[photoID] {
+			seen[photoID] = true
+			photoIDs = append(photoIDs, photoID)
+		}
+	}
+
+	tx := scopedDB(c, h.db).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			batch.undo()
+			panic(r)
+		}
+	}()
+	batch.tx = tx
+
+	if err := batch.prepare(req.Operation, req.Tags); err != nil {
+		tx.Rollback()
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	results := make([]photoBatchResult, 0, len(photoIDs))
+	committed := true
+	for _, photoID := range photoIDs {
+		result := photoBatchResult{PhotoID: photoID, Status: "skipped"}
+		if committed {
+			result.Status = "ok"
+			copiedID, err := batch.apply(req.Operation, photoID)
+			if err != nil {
+				result.Status, result.Error = "failed", err.Error()
+				committed = false
+			}
+			result.CopiedPhotoID = copiedID
+		}
+		results = append(results, result)
+	}
+
+	if committed && batch.album != nil {
+		// Albums span the dates of the photos added to them
+		if err := updateAlbumDateRanges(tx, []uuid.UUID{batch.album.ID}); err != nil {
+			committed = false
+		}
+	}
+	if committed {
+		if err := tx.Commit().Error; err != nil {
+			batch.undo()
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to commit batch")
+			return
+		}
+		for _, finish := range batch.finishes {
+			finish()
+		}
+	} else {
+		tx.Rollback()
+		batch.undo()
+		for i := range results {
+			if results[i].Status == "ok" {
+				results[i].Status, results[i].CopiedPhotoID = "rolled_back", nil
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"operation": req.Operation,
+		"committed": committed,
+		"results":   results,
+	})
+}
+
+// prepare looks up what an operation needs before any photo is processed
+func (b *photoBatch) prepare(operation string, tagNames []string) error {
+	switch operation {
+	case "add_tags", "remove_tags":
+		for _, name := range tagNames {
+			name = tagNamePolicy(b.h.config).Normalize(name)
+			if name == "" {
+				return &photoOpError{http.StatusBadRequest, apierror.CodeValidation, "Tag names can't be empty"}
+			}
+
+			tag, err := findTagByName(b.tx, name)
+			if err == gorm.ErrRecordNotFound && operation == "add_tags" {
+				tag = models.Tag{Name: name}
+				err = b.tx.Create(&tag).Error
+			}
+			if err == gorm.ErrRecordNotFound {
+				continue // Nothing to remove
+			}
+			if err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up tags"}
+			}
+			b.tagIDs = append(b.tagIDs, tag.ID)
+		}
+
+	case "add_to_album":
+		// Append after the current last photo
+		var maxOrder *int
+		b.tx.Model(&models.AlbumPhoto{}).Where("album_id = ?", b.album.ID).Select("MAX(\"order\")").Row().Scan(&maxOrder)
+		if maxOrder != nil {
+			b.albumPosition = *maxOrder + 1
+		}
+	}
+	return nil
+}
+
+// apply runs an operation on one photo within the batch's transaction. Copies
+// return the new photo's ID.
+func (b *photoBatch) apply(operation string, photoID uuid.UUID) (*uuid.UUID, error) {
+	var photo models.Photo
+	if err := b.tx.Preload("Library").Preload("Tags").First(&photo, photoID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &photoOpError{http.StatusNotFound, "photo_not_found", "Photo not found"}
+		}
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo"}
+	}
+
+	// Album membership isn't part of the photo, the rest is
+	switch operation {
+	case "set_rating", "add_tags", "remove_tags":
+		if photo.Library.ReadOnly {
+			return nil, errReadOnlyLibrary
+		}
+	}
+
+	switch operation {
+	case "delete":
+		return nil, trashPhoto(b.tx, &photo)
+
+	case "move":
+		move, err := b.h.startMove(b.tx, &photo, b.targetLibrary)
+		if err != nil {
+			return nil, err
+		}
+		b.undos = append(b.undos, move.undo)
+		if err := move.record(b.tx); err != nil {
+			return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to move photo"}
+		}
+		b.finishes = append(b.finishes, func() { b.h.finishMove(move) })
+
+	case "copy":
+		photoCopy, err := b.h.startCopy(b.tx, &photo, b.targetLibrary)
+		if err != nil {
+			return nil, err
+		}
+		b.undos = append(b.undos, photoCopy.undo)
+		if err := photoCopy.record(b.tx); err != nil {
+			return nil, err
+		}
+		b.finishes = append(b.finishes, func() { b.h.prepareThumbnails(&photoCopy.newPhoto, b.targetLibrary) })
+		return &photoCopy.newPhoto.ID, nil
+
+	case "set_rating":
+		// Write-back rewrites the file, so photos keeping their rating are left alone
+		changed := !sameRating(photo.Rating, b.rating)
+		if err := b.tx.Model(&models.Photo{}).Where("id = ?", photo.ID).Update("rating", b.rating).Error; err != nil {
+			return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo"}
+		}
+		// Keep external editors in agreement with the stored rating
+		photo.Rating = b.rating
+		if changed {
+			b.finishes = append(b.finishes, func() { b.h.writeBackRating(tenant.Scope(b.h.db, photo.TenantID), &photo) })
+		}
+
+	case "add_tags":
+		for _, tagID := range b.tagIDs {
+			var count int64
+			if err := b.tx.Model(&models.PhotoTag{}).Where("photo_id = ? AND tag_id = ?", photo.ID, tagID).Count(&count).Error; err != nil {
+				return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to add tags"}
+			}
+			if count > 0 {
+				continue
+			}
+			if err := b.tx.Create(&models.PhotoTag{PhotoID: photo.ID, TagID: tagID}).Error; err != nil {
+				return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to add tags"}
+			}
+		}
+
+	case "remove_tags":
+		if len(b.tagIDs) > 0 {
+			if err := b.tx.Where("photo_id = ? AND tag_id IN ?", photo.ID, b.tagIDs).Delete(&models.PhotoTag{}).Error; err != nil {
+				return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove tags"}
+			}
+		}
+
+	case "add_to_album":
+		if photo.LibraryID != b.album.LibraryID {
+			return nil, &photoOpError{http.StatusBadRequest, "library_mismatch", "Photo and album must be in the same library"}
+		}
+		var count int64
+		if err := b.tx.Model(&models.AlbumPhoto{}).Where("album_id = ? AND photo_id = ?", b.album.ID, photo.ID).Count(&count).Error; err != nil {
+			return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to check album membership"}
+		}
+		if count > 0 {
+			return nil, nil // Already a member
+		}
+		if err := b.tx.Create(&models.AlbumPhoto{AlbumID: b.album.ID, PhotoID: photo.ID, Order: b.albumPosition}).Error; err != nil {
+			return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to add photo to album"}
+		}
+		b.albumPosition++
+	}
+	return nil, nil
+}
+
+// undo reverses the file changes of a batch that didn't commit, newest first
+func (b *photoBatch) undo() {
+	for i := len(b.undos) - 1; i >= 0; i-- {
+		b.undos[i]()
+	}
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/edits"
+	"photo-library-server/models"
+	"photo-library-server/thumbnails"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// editPhotoRequest is the JSON body of EditPhoto
+type editPhotoRequest struct {
+	Operations []edits.Operation `json:"operations" binding:"required,min=1"`
+	// FromOriginal starts a new stack instead of adding to the served version's
+	FromOriginal bool `json:"from_original"`
+}
+
+// restoreVersionRequest is the JSON body of RestorePhotoVersion
+type restoreVersionRequest struct {
+	Version *int `json:"version" binding:"required,min=0"` // 0 for the original
+}
+
+// photoVersionsResponse is the response of ListPhotoVersions
+type photoVersionsResponse struct {
+	Current  int                   `json:"current"` // Number of the version served, 0 for the original
+	Versions []models.PhotoVersion `json:"versions"`
+}
+
+// errVersionNotFound is returned for edit versions a photo doesn't have
+var errVersionNotFound = &photoOpError{http.StatusNotFound, "version_not_found", "Photo version not found"}
+
+// EditPhoto saves a new version of a photo with operations added to the edit
+// stack of the version being served, and serves it from then on. The
+// photo's file is left as it is.
+func (h *PhotoHandler) EditPhoto(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var req editPhotoRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).Preload("Library").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if photo.Library.ReadOnly {
+		respondPhotoOpError(c, errReadOnlyLibrary)
+		return
+	}
+	if strings.HasPrefix(photo.MimeType, "video/") {
+		apierror.Respond(c, http.StatusUnsupportedMediaType, "unsupported_file_type", "Videos can't be edited")
+		return
+	}
+
+	var operations []edits.Operation
+	if photo.EditVersion > 0 && !req.FromOriginal {
+		current, err := findPhotoVersion(scopedDB(c, h.db), photo.ID, photo.EditVersion)
+		if err != nil {
+			respondPhotoOpError(c, err)
+			return
+		}
+		operations = current.Operations
+	}
+	operations = append(operations, req.Operations...)
+	if err := edits.Validate(operations); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	// Render once up front, so files that can't be edited are refused and
+	// the first request for the new version is served from the cache
+	if _, err := os.Stat(photo.FilePath); os.IsNotExist(err) {
+		apierror.Respond(c, http.StatusNotFound, "photo_file_not_found", "Photo file not found")
+		return
+	}
+	rendition, err := renderEdits(h.config, &photo, operations)
+	if err != nil {
+		respondEditError(c, err)
+		return
+	}
+
+	version := models.PhotoVersion{PhotoID: photo.ID, Operations: operations}
+	if err := scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		// Numbers of reverted versions aren't reused, so their cached
+		// renditions are never served for a different stack
+		var last *int
+		if err := tx.Model(&models.PhotoVersion{}).Where("photo_id = ?", photo.ID).
+			Select("MAX(number)").Row().Scan(&last); err != nil {
+			return err
+		}
+		version.Number = 1
+		if last != nil {
+			version.Number = *last + 1
+		}
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+		return tx.Model(&photo).Update("edit_version", version.Number).Error
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save photo version")
+		return
+	}
+
+	if !photo.Encrypted {
+		h.resized.Put(editedCacheKey(&photo, version.Number), rendition)
+	}
+	c.JSON(http.StatusCreated, version)
+}
+
+// ListPhotoVersions returns the edit versions of a photo, oldest first
+func (h *PhotoHandler) ListPhotoVersions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	versions := []models.PhotoVersion{}
+	if err := scopedDB(c, h.db).Where("photo_id = ?", photo.ID).Order("number").Find(&versions).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, photoVersionsResponse{Current: photo.EditVersion, Versions: versions})
+}
+
+// RestorePhotoVersion chooses which version of a photo is served, 0 going
+// back to the original. Versions are kept either way.
+func (h *PhotoHandler) RestorePhotoVersion(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var req restoreVersionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).Preload("Library").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+	if photo.Library.ReadOnly {
+		respondPhotoOpError(c, errReadOnlyLibrary)
+		return
+	}
+
+	if *req.Version > 0 {
+		if _, err := findPhotoVersion(scopedDB(c, h.db), photo.ID, *req.Version); err != nil {
+			respondPhotoOpError(c, err)
+			return
+		}
+	}
+	if err := scopedDB(c, h.db).Model(&photo).Update("edit_version", *req.Version).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo")
+		return
+	}
+
+	// Reload so the file URLs carry the new content version
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+	c.JSON(http.StatusOK, photo)
+}
+
+// findPhotoVersion loads version number of a photo
+func findPhotoVersion(db *gorm.DB, photoID uuid.UUID, number int) (*models.PhotoVersion, error) {
+	var version models.PhotoVersion
+	if err := db.Where("photo_id = ? AND number = ?", photoID, number).First(&version).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errVersionNotFound
+		}
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo version"}
+	}
+	return &version, nil
+}
+
+// requestedVersion returns the number of the version a file request asks for
+// with ?version=, original (0), a version number or by default the one being
+// served. It writes the error response and returns false for bad requests.
+func requestedVersion(c *gin.Context, db *gorm.DB, photo *models.Photo) (int, bool) {
+	switch value := c.Query("version"); value {
+	case "":
+		return photo.EditVersion, true
+	case "original":
+		return 0, true
+	default:
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "version must be original or a version number")
+			return 0, false
+		}
+		if number != photo.EditVersion {
+			if _, err := findPhotoVersion(db, photo.ID, number); err != nil {
+				respondPhotoOpError(c, err)
+				return 0, false
+			}
+		}
+		return number, true
+	}
+}
+
+// fileVersion identifies the contents served for version number of a photo,
+// matching ContentVersion for the version being served
+func fileVersion(photo *models.Photo, number int) string {
+	if number == 0 {
+		return photo.OriginalVersion()
+	}
+	return photo.OriginalVersion() + "-" + strconv.Itoa(number)
+}
+
+// editedCacheKey names the cached rendition of version number of a photo.
+// Keys change with the original's contents, so rotating the file doesn't
+// leave stale renditions behind.
+func editedCacheKey(photo *models.Photo, number int) string {
+	return fmt.Sprintf("%s_%s_edit.jpg", photo.ID, fileVersion(photo, number))
+}
+
+// editedRendition returns a JPEG of version number of a photo, from the
+// resize cache when it's there. Like resized copies, renditions of encrypted
+// photos are rendered on every request and never stored.
+func (h *PhotoHandler) editedRendition(db *gorm.DB, photo *models.Photo, number int) ([]byte, error) {
+	key := editedCacheKey(photo, number)
+	if !photo.Encrypted {
+		if path, ok := h.resized.Get(key); ok {
+			if data, err := os.ReadFile(path); err == nil {
+				return data, nil
+			}
+		}
+	}
+
+	version, err := findPhotoVersion(db, photo.ID, number)
+	if err != nil {
+		return nil, err
+	}
+	data, err := renderEdits(h.config, photo, version.Operations)
+	if err != nil {
+		return nil, err
+	}
+	if !photo.Encrypted {
+		h.resized.Put(key, data)
+	}
+	return data, nil
+}
+
+// serveEditedThumbnail serves a rendition of version number of a photo,
+// cached with resized images rather than next to the original's renditions
+func (h *PhotoHandler) serveEditedThumbnail(c *gin.Context, photo *models.Photo, number int, size string) {
+	c.Header("Cache-Control", "private, max-age=86400")
+
+	key := fmt.Sprintf("%s_%s_%s.jpg", photo.ID, fileVersion(photo, number), size)
+	path, ok := "", false
+	if !photo.Encrypted {
+		path, ok = h.resized.Get(key)
+	}
+	if !ok {
+		edited, err := h.editedRendition(scopedDB(c, h.db), photo, number)
+		if err != nil {
+			respondEditError(c, err)
+			return
+		}
+		rendition, err := thumbnails.Render(edited, size)
+		if err != nil {
+			respondThumbnailError(c, err)
+			return
+		}
+		if photo.Encrypted {
+			c.Data(http.StatusOK, "image/jpeg", rendition)
+			return
+		}
+		if path, err = h.resized.Put(key, rendition); err != nil {
+			c.Data(http.StatusOK, "image/jpeg", rendition)
+			return
+		}
+	}
+
+	c.Header("Content-Type", "image/jpeg")
+	if offloadFile(c, h.config, path) {
+		return
+	}
+	c.File(path)
+}
+
+// renderEdits applies operations to a photo's original and encodes the
+// result as a JPEG
+func renderEdits(cfg *config.Config, photo *models.Photo, operations []edits.Operation) ([]byte, error) {
+	original, err := readOriginal(cfg, photo)
+	if err != nil {
+		return nil, err
+	}
+	src, err := thumbnails.Decode(original)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, edits.Apply(src, operations), &jpeg.Options{Quality: rotateJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// respondEditError writes the response for a failed edited rendition
+func respondEditError(c *gin.Context, err error) {
+	var opErr *photoOpError
+	switch {
+	case errors.As(err, &opErr):
+		respondPhotoOpError(c, err)
+	case err == thumbnails.ErrUnsupported:
+		apierror.Respond(c, http.StatusUnsupportedMediaType, "unsupported_file_type", "Editing is not supported for this file type")
+	default:
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to render edited photo")
+	}
+}
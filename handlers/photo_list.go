@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"photo-library-server/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// photoOrderColumns are the fields photo lists can be ordered by
+var photoOrderColumns = map[string]string{
+	"uploaded_at": "photos.uploaded_at",
+	"created_at":  "photos.created_at",
+	"rating":      "photos.rating",
+	"filename":    "photos.filename",
+	"file_size":   "photos.file_size",
+}
+
+// photoFilter reads the library_id, rating, unrated, favorite,
+// storage_tier, missing, corrupt, tag, untagged, bbox, near, country, city,
+// place, metadata[key], q and uploaded/taken date range filters of a photo
+// list request
+func photoFilter(c *gin.Context, cfg *config.Config) (repository.PhotoFilter, error) {
+	var filter repository.PhotoFilter
+	flag := func(param string) *bool {
+		value := c.Query(param)
+		if value == "" {
+			return nil
+		}
+		set := value == "true"
+		return &set
+	}
+
+	if libraryID := c.Query("library_id"); libraryID != "" {
+		id, err := uuid.Parse(libraryID)
+		if err != nil {
+			return filter, errors.New("Invalid library ID")
+		}
+		filter.LibraryID = id
+	}
+
+	// Ratings out of range are ignored
+	if rating := c.Query("rating"); rating != "" {
+		if r, err := strconv.Atoi(rating); err == nil && r >= 0 && r <= 5 {
+			filter.Rating = &r
+		}
+	}
+	filter.Unrated = flag("unrated")
+	filter.StorageTier = c.Query("storage_tier")
+	filter.Favorite = flag("favorite")
+	filter.Missing = flag("missing")
+	filter.Corrupt = flag("corrupt")
+
+	if tagName := c.Query("tag"); tagName != "" {
+		filter.Tag = tagNamePolicy(cfg).Normalize(tagName)
+	}
+	filter.Untagged = flag("untagged")
+
+	var err error
+	filter.Within, filter.Near, err = geoFilter(c.Query("bbox"), c.Query("near"), c.Query("radius"))
+	if err != nil {
+		return filter, err
+	}
+	filter.Country = strings.ToUpper(c.Query("country"))
+	filter.City = c.Query("city")
+	filter.Place = c.Query("place")
+
+	filter.Metadata = c.QueryMap("metadata")
+	filter.Text = strings.TrimSpace(c.Query("q"))
+
+	// Upload and capture date ranges
+	for _, date := range []struct {
+		param string
+		field **time.Time
+	}{
+		{"uploaded_after", &filter.UploadedAfter},
+		{"uploaded_before", &filter.UploadedBefore},
+		{"taken_after", &filter.TakenAfter},
+		{"taken_before", &filter.TakenBefore},
+	} {
+		if value := c.Query(date.param); value != "" {
+			t, err := parseDateParam(value)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s, expected a date (2006-01-02) or RFC 3339 time", date.param)
+			}
+			*date.field = &t
+		}
+	}
+
+	return filter, nil
+}
+
+// filterPhotos applies the photo list filters of a request to query
+func filterPhotos(c *gin.Context, cfg *config.Config, query *gorm.DB) (*gorm.DB, error) {
+	filter, err := photoFilter(c, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return repository.FilterPhotos(query, filter), nil
+}
+
+// parseDateParam parses a date or RFC 3339 time query parameter. Dates are
+// midnight UTC, so a before filter on a date excludes that day.
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// pagination reads the page and limit query parameters of a list request,
+// 50 items per page by default and at most 100
+func pagination(c *gin.Context) (page, limit int) {
+	page, limit = 1, 50
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	return page, limit
+}
+
+// listOrder returns the ORDER BY clause for the order_by and order_dir query
+// parameters, falling back to the defaults for unknown values
+func listOrder(c *gin.Context, columns map[string]string, defaultField, defaultDir string) string {
+	column, ok := columns[c.DefaultQuery("order_by", defaultField)]
+	if !ok {
+		column = columns[defaultField]
+	}
+
+	orderDir := c.DefaultQuery("order_dir", defaultDir)
+	if orderDir != "asc" && orderDir != "desc" {
+		orderDir = defaultDir
+	}
+	return column + " " + orderDir
+}
+
+// photoCursor is a position in a photo list ordered by upload time, with the
+// photo ID breaking ties between photos uploaded at the same moment
+type photoCursor struct {
+	UploadedAt time.Time `json:"u"`
+	ID         uuid.UUID `json:"i"`
+	Desc       bool      `json:"d"`
+}
+
+// encodePhotoCursor returns the opaque cursor continuing a list after photo
+func encodePhotoCursor(photo models.Photo, desc bool) string {
+	data, _ := json.Marshal(photoCursor{UploadedAt: photo.UploadedAt, ID: photo.ID, Desc: desc})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePhotoCursor parses a cursor from encodePhotoCursor
+func decodePhotoCursor(s string) (photoCursor, error) {
+	var cursor photoCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &cursor) != nil || cursor.ID == uuid.Nil || cursor.UploadedAt.IsZero() {
+		return photoCursor{}, errors.New("Invalid cursor")
+	}
+	return cursor, nil
+}
+
+// preloadPhotoRelations applies the include_library, include_tags and
+// include_albums flags of photo requests
+func preloadPhotoRelations(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if c.Query("include_library") == "true" {
+		query = query.Preload("Library")
+	}
+	if c.Query("include_tags") == "true" {
+		query = query.Preload("Tags")
+	}
+	if c.Query("include_albums") == "true" {
+		query = query.Preload("Albums")
+	}
+	return query
+}
+
+// photoRelations returns the include_library, include_tags and
+// include_albums flags of photo requests for repositories
+func photoRelations(c *gin.Context) repository.PhotoRelations {
+	return repository.PhotoRelations{
+		Library: c.Query("include_library") == "true",
+		Tags:    c.Query("include_tags") == "true",
+		Albums:  c.Query("include_albums") == "true",
+	}
+}
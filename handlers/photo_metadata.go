@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Limits on custom metadata fields
+const (
+	maxMetadataFields      = 100  // Fields per photo
+	maxMetadataKeyLength   = 64   // Characters in a key
+	maxMetadataValueLength = 1000 // Characters in a value
+)
+
+// GetPhotoMetadata returns the custom metadata fields of a photo
+func (h *PhotoHandler) GetPhotoMetadata(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	db := scopedDB(c, h.db)
+	if err := db.Select("id").First(&models.Photo{}, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	fields, err := photoMetadata(db, id)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo metadata")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"metadata": fields})
+}
+
+// setMetadataRequest is the JSON body of SetPhotoMetadata
+type setMetadataRequest struct {
+	Metadata map[string]*string `json:"metadata" binding:"required"`
+}
+
+// SetPhotoMetadata sets custom metadata fields on a photo. Fields not in the
+// request are kept, and a null value removes a field.
+func (h *PhotoHandler) SetPhotoMetadata(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var req setMetadataRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "metadata is required")
+		return
+	}
+	if len(req.Metadata) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "metadata must contain at least one field")
+		return
+	}
+
+	keys := make([]string, 0, len(req.Metadata))
+	for key, value := range req.Metadata {
+		if err := validateMetadataKey(key); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+			return
+		}
+		if value != nil && len([]rune(*value)) > maxMetadataValueLength {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, fmt.Sprintf("metadata values must be at most %d characters", maxMetadataValueLength))
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).Select("id", "library_id").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+	if err := checkWritable(scopedDB(c, h.db), photo.LibraryID); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	tx := scopedDB(c, h.db).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Replace the fields being set, which also removes the nulled ones
+	if err := tx.Where("photo_id = ? AND key IN ?", id, keys).Delete(&models.PhotoMetadata{}).Error; err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo metadata")
+		return
+	}
+
+	rows := []models.PhotoMetadata{}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := req.Metadata[key]; value != nil {
+			rows = append(rows, models.PhotoMetadata{PhotoID: id, Key: key, Value: *value})
+		}
+	}
+	if len(rows) > 0 {
+		if err := tx.Create(&rows).Error; err != nil {
+			tx.Rollback()
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo metadata")
+			return
+		}
+	}
+
+	fields, err := photoMetadata(tx, id)
+	if err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo metadata")
+		return
+	}
+	if len(fields) > maxMetadataFields {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, fmt.Sprintf("Photos can have at most %d metadata fields", maxMetadataFields))
+		return
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"metadata": fields})
+}
+
+// DeletePhotoMetadata removes a custom metadata field from a photo
+func (h *PhotoHandler) DeletePhotoMetadata(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	db := scopedDB(c, h.db)
+	var photo models.Photo
+	if err := db.Select("id", "library_id").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+	if err := checkWritable(db, photo.LibraryID); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	result := db.Where("photo_id = ? AND key = ?", id, c.Param("key")).Delete(&models.PhotoMetadata{})
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete metadata field")
+		return
+	}
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, "metadata_field_not_found", "Metadata field not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Metadata field deleted successfully"})
+}
+
+// photoMetadata returns the custom metadata fields of a photo as a map
+func photoMetadata(db *gorm.DB, photoID uuid.UUID) (map[string]string, error) {
+	var rows []models.PhotoMetadata
+	if err := db.Where("photo_id = ?", photoID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(rows))
+	for _, row := range rows {
+		fields[row.Key] = row.Value
+	}
+	return fields, nil
+}
+
+// validateMetadataKey checks that a metadata key is short and made of
+// letters, digits, dots, dashes and underscores, so it can be used as a
+// metadata[key] filter
+func validateMetadataKey(key string) error {
+	if key == "" || len(key) > maxMetadataKeyLength {
+		return fmt.Errorf("metadata keys must be 1 to %d characters", maxMetadataKeyLength)
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._-", r)) {
+			return fmt.Errorf("metadata key %q may only contain letters, digits, '.', '-' and '_'", key)
+		}
+	}
+	return nil
+}
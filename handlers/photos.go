@@ -1,36 +1,73 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"photo-library-server/apierror"
 	"photo-library-server/config"
+	"photo-library-server/diskcache"
+	"photo-library-server/diskspace"
+	"photo-library-server/documents"
+	"photo-library-server/encryption"
+	"photo-library-server/jobs"
+	"photo-library-server/logging"
+	"photo-library-server/metadata"
+	"photo-library-server/metrics"
 	"photo-library-server/models"
+	"photo-library-server/raw"
+	"photo-library-server/repository"
+	"photo-library-server/tenant"
+	"photo-library-server/thumbnails"
+	"photo-library-server/video"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // PhotoHandler handles photo-related HTTP requests
 type PhotoHandler struct {
-	db     *gorm.DB
-	config *config.Config
+	db       *gorm.DB
+	photos   repository.PhotoRepo
+	config   *config.Config
+	jobs     *jobs.Manager
+	resized  *diskcache.Cache // Images resized on request
+	classify *ClassifyHandler // Suggests tags for uploads, if set
+	faces    *FaceHandler     // Finds faces in uploads, if set
 }
 
 // NewPhotoHandler creates a new photo handler
-func NewPhotoHandler(db *gorm.DB, cfg *config.Config) *PhotoHandler {
-	return &PhotoHandler{db: db, config: cfg}
+func NewPhotoHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager) *PhotoHandler {
+	return &PhotoHandler{db: db, photos: repository.NewPhotoRepo(db), config: cfg, jobs: jobManager, resized: diskcache.New(cfg.ResizeCacheDir, cfg.ResizeCacheSize)}
+}
+
+// ClassifyUploads has new uploads classified by classifier
+func (h *PhotoHandler) ClassifyUploads(classifier *ClassifyHandler) {
+	h.classify = classifier
+}
+
+// DetectFacesInUploads has faces in new uploads found by detector
+func (h *PhotoHandler) DetectFacesInUploads(detector *FaceHandler) {
+	h.faces = detector
 }
 
 // UploadPhoto handles photo upload
@@ -38,246 +75,502 @@ func (h *PhotoHandler) UploadPhoto(c *gin.Context) {
 	// Parse multipart form
 	err := c.Request.ParseMultipartForm(h.config.MaxFileSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large or invalid form data"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_form", "File too large or invalid form data")
 		return
 	}
 
 	// Get library ID
 	libraryIDStr := c.PostForm("library_id")
 	if libraryIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "library_id is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "library_id is required")
 		return
 	}
 
 	libraryID, err := uuid.Parse(libraryIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
 		return
 	}
 
 	// Verify library exists
 	var library models.Library
-	if err := h.db.First(&library, libraryID).Error; err != nil {
+	if err := scopedDB(c, h.db).First(&library, libraryID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Library not found"})
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify library"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify library")
 		return
 	}
 
-	// Get the uploaded file
-	file, header, err := c.Request.FormFile("photo")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No photo file provided"})
+	if library.ReadOnly {
+		apierror.Respond(c, http.StatusForbidden, "library_read_only", "Library is read-only")
 		return
 	}
-	defer file.Close()
-
-	// Validate file type
-	if !h.isValidImageType(header.Header.Get("Content-Type")) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image type. Supported types: JPEG, PNG, GIF, WebP, TIFF, BMP"})
+	if isRelocating(library.ID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
 		return
 	}
 
-	// Validate file size
-	if header.Size > h.config.MaxFileSize {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", h.config.MaxFileSize)})
+	// Get the uploaded file
+	header, err := c.FormFile("photo")
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "file_required", "No photo file provided")
 		return
 	}
 
-	// Get image dimensions
-	width, height, err := h.getImageDimensions(file)
+	dedupe := uploadDedupe(c, h.config)
+	photo, err := h.storeUpload(c, &library, header, uploadRating(c), uploadTagNames(c), dedupe != dedupeOff)
+	if duplicate, ok := err.(*duplicateUploadError); ok && dedupe == dedupeLink {
+		// The existing photo stands in for the upload, unchanged
+		photo = duplicate.existing
+		scopedDB(c, h.db).Preload("Library").Preload("Tags").First(photo, photo.ID)
+		c.JSON(http.StatusOK, photo)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image file"})
+		respondPhotoOpError(c, err)
 		return
 	}
 
-	// Reset file pointer
-	file.Seek(0, 0)
+	// Load the photo with library for response
+	scopedDB(c, h.db).Preload("Library").Preload("Tags").First(photo, photo.ID)
 
-	// Generate unique filename
-	filename := h.generateUniqueFilename(header.Filename)
-	filePath := filepath.Join(library.Images, filename)
+	c.JSON(http.StatusCreated, photo)
+}
 
-	// Ensure library images directory exists
-	if err := os.MkdirAll(library.Images, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create library images directory"})
+// maxBatchUploadFiles caps the files accepted by one batch upload
+const maxBatchUploadFiles = 100
+
+// batchUploadResult is the per-file outcome of a batch upload
+type batchUploadResult struct {
+	Filename string        `json:"filename"`
+	Status   string        `json:"status"` // "created", "duplicate" (an existing photo is returned) or "failed"
+	PhotoID  *uuid.UUID    `json:"photo_id,omitempty"`
+	Photo    *models.Photo `json:"photo,omitempty"`
+	Code     string        `json:"code,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// UploadPhotos stores every file of a multipart request in one library and
+// reports the outcome per file, a failed file doesn't stop the others
+func (h *PhotoHandler) UploadPhotos(c *gin.Context) {
+	// Parse multipart form
+	if err := c.Request.ParseMultipartForm(h.config.MaxFileSize); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_form", "File too large or invalid form data")
 		return
 	}
 
-	// Save file to disk
-	dst, err := os.Create(filePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	libraryIDStr := c.PostForm("library_id")
+	if libraryIDStr == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "library_id is required")
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		os.Remove(filePath) // Cleanup on failure
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	libraryID, err := uuid.Parse(libraryIDStr)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
 		return
 	}
 
-	// Parse optional rating
-	var rating *int
-	if ratingStr := c.PostForm("rating"); ratingStr != "" {
-		if r, err := strconv.Atoi(ratingStr); err == nil && r >= 0 && r <= 5 {
-			rating = &r
+	var library models.Library
+	if err := scopedDB(c, h.db).First(&library, libraryID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
+			return
 		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify library")
+		return
 	}
 
-	// Create photo record
-	photo := models.Photo{
-		Filename:     filename,
-		OriginalName: header.Filename,
-		FilePath:     filePath,
-		MimeType:     header.Header.Get("Content-Type"),
-		FileSize:     header.Size,
-		Width:        width,
-		Height:       height,
-		Rating:       rating,
-		LibraryID:    libraryID,
-		UploadedAt:   time.Now(),
-	}
-
-	if err := h.db.Create(&photo).Error; err != nil {
-		os.Remove(filePath) // Cleanup on failure
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save photo metadata"})
+	if library.ReadOnly {
+		apierror.Respond(c, http.StatusForbidden, "library_read_only", "Library is read-only")
+		return
+	}
+	if isRelocating(library.ID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
 		return
 	}
 
-	// Handle tags if provided
-	if tagsStr := c.PostForm("tags"); tagsStr != "" {
-		tags := strings.Split(tagsStr, ",")
-		for _, tagName := range tags {
-			tagName = strings.TrimSpace(tagName)
-			if tagName != "" {
-				h.addTagToPhoto(&photo, tagName)
+	headers := c.Request.MultipartForm.File["photos"]
+	if len(headers) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, "file_required", "No photo files provided")
+		return
+	}
+	if len(headers) > maxBatchUploadFiles {
+		apierror.Respond(c, http.StatusBadRequest, "too_many_files", fmt.Sprintf("A batch upload can hold at most %d files", maxBatchUploadFiles))
+		return
+	}
+
+	// Rating, tags and duplicate handling apply to every file
+	rating := uploadRating(c)
+	tagNames := uploadTagNames(c)
+	dedupe := uploadDedupe(c, h.config)
+
+	results := make([]batchUploadResult, 0, len(headers))
+	created, duplicates := 0, 0
+	for _, header := range headers {
+		result := batchUploadResult{Filename: header.Filename, Status: "failed"}
+		photo, err := h.storeUpload(c, &library, header, rating, tagNames, dedupe != dedupeOff)
+		if duplicate, ok := err.(*duplicateUploadError); ok {
+			result.PhotoID = &duplicate.existing.ID
+			if dedupe == dedupeLink {
+				scopedDB(c, h.db).Preload("Tags").First(duplicate.existing, duplicate.existing.ID)
+				result.Status = "duplicate"
+				result.Photo = duplicate.existing
+				duplicates++
+			} else {
+				result.Code, result.Error = errorCode(err), err.Error()
 			}
+		} else if err != nil {
+			result.Code, result.Error = errorCode(err), err.Error()
+		} else {
+			scopedDB(c, h.db).Preload("Tags").First(photo, photo.ID)
+			result.Status = "created"
+			result.PhotoID = &photo.ID
+			result.Photo = photo
+			created++
 		}
+		results = append(results, result)
 	}
 
-	// Load the photo with library for response
-	h.db.Preload("Library").Preload("Tags").First(&photo, photo.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"results":    results,
+		"created":    created,
+		"duplicates": duplicates,
+		"failed":     len(results) - created - duplicates,
+	})
+}
 
-	c.JSON(http.StatusCreated, photo)
+// uploadRating returns the optional rating field of an upload form, ignoring
+// values outside 0-5
+func uploadRating(c *gin.Context) *int {
+	if ratingStr := c.PostForm("rating"); ratingStr != "" {
+		if r, err := strconv.Atoi(ratingStr); err == nil && r >= 0 && r <= 5 {
+			return &r
+		}
+	}
+	return nil
 }
 
-// GetPhotos returns photos, optionally filtered
-func (h *PhotoHandler) GetPhotos(c *gin.Context) {
-	var photos []models.Photo
+// Duplicate handling of uploads, see config.DedupeUploads
+const (
+	dedupeOff    = "off"
+	dedupeLink   = "link"
+	dedupeReject = "reject"
+)
 
-	query := h.db.Model(&models.Photo{})
+// uploadDedupe returns the duplicate handling of an upload: its dedupe form
+// field ("true" or "link", "reject", "false" or "off") if given, otherwise
+// the configured default
+func uploadDedupe(c *gin.Context, cfg *config.Config) string {
+	switch c.PostForm("dedupe") {
+	case "true", dedupeLink:
+		return dedupeLink
+	case dedupeReject:
+		return dedupeReject
+	case "false", dedupeOff:
+		return dedupeOff
+	}
+	if cfg.DedupeUploads == dedupeLink || cfg.DedupeUploads == dedupeReject {
+		return cfg.DedupeUploads
+	}
+	return dedupeOff
+}
 
-	// Filter by library if specified
-	if libraryID := c.Query("library_id"); libraryID != "" {
-		id, err := uuid.Parse(libraryID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library ID"})
-			return
+// uploadTagNames splits the optional comma-separated tags field of an upload form
+func uploadTagNames(c *gin.Context) []string {
+	var names []string
+	for _, tagName := range strings.Split(c.PostForm("tags"), ",") {
+		if tagName = strings.TrimSpace(tagName); tagName != "" {
+			names = append(names, tagName)
 		}
-		query = query.Where("library_id = ?", id)
+	}
+	return names
+}
+
+// storeUpload validates one uploaded file, saves it into library and creates
+// its photo record with the given rating and tags. With dedupe, files whose
+// bytes the library already holds are not stored and a duplicateUploadError
+// is returned instead.
+func (h *PhotoHandler) storeUpload(c *gin.Context, library *models.Library, header *multipart.FileHeader, rating *int, tagNames []string, dedupe bool) (*models.Photo, error) {
+	// Validate file type, documents are only accepted by libraries that opt in
+	mimeType := header.Header.Get("Content-Type")
+	isDocument := mimeType == documents.MimeType
+	if isDocument && !library.AcceptDocuments {
+		return nil, &photoOpError{http.StatusBadRequest, "documents_not_accepted", "This library does not accept documents"}
+	}
+
+	// Browsers rarely know RAW content types, so RAW files go by extension
+	rawFormat, isRaw := raw.FormatOf(header.Filename)
+	if isRaw {
+		mimeType = rawFormat.MimeType
 	}
 
-	// Filter by rating if specified
-	if rating := c.Query("rating"); rating != "" {
-		if r, err := strconv.Atoi(rating); err == nil && r >= 0 && r <= 5 {
-			query = query.Where("rating = ?", r)
+	if !isDocument && !h.isValidImageType(mimeType) {
+		return nil, &photoOpError{http.StatusBadRequest, "unsupported_file_type", "Invalid image type. Supported types: JPEG, PNG, GIF, WebP, TIFF, BMP, CR2, NEF, ARW and DNG RAW files, and MP4 and MOV videos"}
+	}
+	isVideo := video.IsVideoType(mimeType)
+
+	// Files in encrypted libraries need the server's encryption secret
+	var key []byte
+	if library.Encrypted {
+		var err error
+		if key, err = libraryKey(h.config, library.ID); err != nil {
+			return nil, &photoOpError{http.StatusInternalServerError, "encryption_not_configured", "Encryption is not configured on this server"}
 		}
 	}
 
-	// Filter by tag if specified
-	if tagName := c.Query("tag"); tagName != "" {
-		query = query.Joins("JOIN photo_tags ON photos.id = photo_tags.photo_id").
-			Joins("JOIN tags ON photo_tags.tag_id = tags.id").
-			Where("tags.name = ?", tagName)
+	// Validate file size
+	if header.Size > h.config.MaxFileSize {
+		return nil, &photoOpError{http.StatusBadRequest, "file_too_large", fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", h.config.MaxFileSize)}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, &photoOpError{http.StatusBadRequest, "file_required", "No photo file provided"}
 	}
+	defer file.Close()
 
-	// Pagination
-	page := 1
-	limit := 50 // Default limit
-	if p := c.Query("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
+	// Get image dimensions, or the page count and first page size of a document
+	var width, height, pageCount int
+	var videoInfo *video.Info
+	if isDocument {
+		width, height, pageCount, err = h.getDocumentInfo(file)
+		if err != nil {
+			return nil, &photoOpError{http.StatusBadRequest, "invalid_file", "Invalid document file"}
+		}
+	} else if isRaw {
+		width, height, err = h.getRawDimensions(file)
+		if err != nil {
+			return nil, &photoOpError{http.StatusBadRequest, "invalid_file", "Invalid RAW file"}
+		}
+	} else if isVideo {
+		videoInfo, err = video.Inspect(file, header.Size)
+		if err != nil {
+			return nil, &photoOpError{http.StatusBadRequest, "invalid_file", "Invalid video file"}
+		}
+		width, height = videoInfo.Width, videoInfo.Height
+	} else {
+		width, height, err = h.getImageDimensions(file)
+		if err != nil {
+			return nil, &photoOpError{http.StatusBadRequest, "invalid_file", "Invalid image file"}
 		}
 	}
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
+
+	// Reset file pointer
+	file.Seek(0, 0)
+
+	if dedupe {
+		existing, err := h.findDuplicate(library, file)
+		if err != nil {
+			return nil, err
 		}
+		if existing != nil {
+			return nil, &duplicateUploadError{existing: existing}
+		}
+	}
+
+	// Duplicates take no space, so the quota is checked after them
+	if err := checkQuota(h.db, library, header.Size); err != nil {
+		return nil, err
+	}
+
+	// Generate unique filename
+	filename := h.generateUniqueFilename(header.Filename)
+	filePath := filepath.Join(library.Images, filename)
+
+	// Ensure library images directory exists
+	if err := os.MkdirAll(library.Images, 0755); err != nil {
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to create library images directory"}
+	}
+
+	// Refuse uploads that would fill the disk rather than leave a partial file
+	storedSize := header.Size
+	if key != nil {
+		storedSize = encryption.EncryptedSize(header.Size)
+	}
+	if opErr := h.checkDiskSpace(library.Images, storedSize); opErr != nil {
+		return nil, opErr
 	}
 
-	offset := (page - 1) * limit
-	query = query.Offset(offset).Limit(limit)
+	// Save file to disk
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to save file"}
+	}
+	defer dst.Close()
 
-	// Ordering
-	orderBy := c.DefaultQuery("order_by", "uploaded_at")
-	orderDir := c.DefaultQuery("order_dir", "desc")
-	if orderDir != "asc" && orderDir != "desc" {
-		orderDir = "desc"
+	// The checksum is always of the plaintext
+	hash := sha256.New()
+	plaintext := io.TeeReader(file, hash)
+	if key != nil {
+		err = encryption.Encrypt(dst, plaintext, key, header.Size)
+	} else {
+		_, err = io.Copy(dst, plaintext)
+	}
+	if err != nil {
+		os.Remove(filePath) // Cleanup on failure
+		if diskspace.IsFull(err) {
+			return nil, errDiskFull
+		}
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to save file"}
 	}
 
-	allowedOrderFields := []string{"uploaded_at", "created_at", "rating", "filename", "file_size"}
-	isValidOrderField := false
-	for _, field := range allowedOrderFields {
-		if field == orderBy {
-			isValidOrderField = true
-			break
+	// Embedded metadata is read from the upload since the stored file may be
+	// encrypted. Videos are too large to hold in memory and were inspected above.
+	var data []byte
+	if !isVideo {
+		file.Seek(0, io.SeekStart)
+		if data, err = io.ReadAll(file); err != nil {
+			logging.FromContext(c.Request.Context()).Warn("Failed to read metadata", "filename", header.Filename, "error", err)
 		}
 	}
-	if !isValidOrderField {
-		orderBy = "uploaded_at"
+
+	// Capture time from EXIF/XMP, if the file records one, or the recording
+	// time of a video
+	takenAt := metadata.ExtractCaptureTime(data)
+	var duration float64
+	if videoInfo != nil {
+		takenAt, duration = videoInfo.CreatedAt, videoInfo.Duration
+	}
+
+	// Where the photo was taken, if the camera recorded it
+	var latitude, longitude *float64
+	if loc := metadata.ExtractLocation(data); loc != nil {
+		latitude, longitude = &loc.Latitude, &loc.Longitude
 	}
 
-	query = query.Order(fmt.Sprintf("%s %s", orderBy, orderDir))
+	// Motion Photos carry a video clip after the still
+	motion := metadata.FindMotionVideo(data)
+
+	// For finding similar photos. Videos are hashed by a backfill job, which
+	// extracts their poster frame.
+	var perceptualHash string
+	if hash, err := thumbnails.HashData(data); err == nil {
+		perceptualHash = hash.String()
+	}
 
-	// Optional: include related data
-	if c.Query("include_library") == "true" {
-		query = query.Preload("Library")
+	// Create photo record
+	photo := models.Photo{
+		Filename:       filename,
+		OriginalName:   header.Filename,
+		FilePath:       filePath,
+		MimeType:       mimeType,
+		FileSize:       header.Size,
+		Checksum:       hex.EncodeToString(hash.Sum(nil)),
+		PerceptualHash: perceptualHash,
+		Width:          width,
+		Height:         height,
+		Rating:         rating,
+		LibraryID:      library.ID,
+		TakenAt:        takenAt,
+		Latitude:       latitude,
+		Longitude:      longitude,
+		HasMotion:      motion != nil,
+		PageCount:      pageCount,
+		RawFormat:      rawFormat.Name,
+		Duration:       duration,
+		Encrypted:      library.Encrypted,
+		UploadedAt:     time.Now(),
+	}
+
+	if err := scopedDB(c, h.db).Create(&photo).Error; err != nil {
+		os.Remove(filePath) // Cleanup on failure
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to save photo metadata"}
 	}
-	if c.Query("include_tags") == "true" {
-		query = query.Preload("Tags")
+
+	// Handle tags if provided
+	for _, tagName := range tagNames {
+		h.addTagToPhoto(&photo, tagName)
 	}
-	if c.Query("include_albums") == "true" {
-		query = query.Preload("Albums")
+
+	// Import embedded IPTC/XMP keywords as tags if the library opted in
+	if library.ImportKeywords {
+		h.importKeywords(&photo, data)
 	}
 
-	if err := query.Find(&photos).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photos"})
+	h.prepareThumbnails(&photo, library)
+	h.classify.classifyUpload(&photo)
+	h.faces.detectUploadFaces(&photo)
+
+	metrics.UploadedFiles.Inc()
+	metrics.UploadBytes.Add(float64(header.Size))
+
+	return &photo, nil
+}
+
+// GetPhotos returns photos, optionally filtered. Lists ordered by upload
+// time also page by cursor, which stays consistent while photos are added.
+func (h *PhotoHandler) GetPhotos(c *gin.Context) {
+	filter, err := photoFilter(c, h.config)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
 		return
 	}
 
-	// Get total count for pagination
-	var total int64
-	countQuery := h.db.Model(&models.Photo{})
-	if libraryID := c.Query("library_id"); libraryID != "" {
-		id, _ := uuid.Parse(libraryID)
-		countQuery = countQuery.Where("library_id = ?", id)
+	// Pagination, by cursor when one is given and by page otherwise
+	page, limit := pagination(c)
+	// One extra photo tells whether there's a next page
+	listPage := repository.PhotoPage{
+		Order:  listOrder(c, photoOrderColumns, "uploaded_at", "desc"),
+		Offset: (page - 1) * limit,
+		Limit:  limit + 1,
+		With:   photoRelations(c),
+	}
+	byUploadTime := strings.HasPrefix(listPage.Order, "photos.uploaded_at ")
+	desc := strings.HasSuffix(listPage.Order, " desc")
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodePhotoCursor(value)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+			return
+		}
+		if c.Query("order_by") != "" && !byUploadTime {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Cursors can only page photos ordered by uploaded_at")
+			return
+		}
+		// The cursor keeps the direction of the list it came from
+		page, byUploadTime, desc = 0, true, cursor.Desc
+		after := repository.PhotoCursor(cursor)
+		listPage.After = &after
+	}
+
+	photos, err := h.photos.List(c.Request.Context(), filter, listPage)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photos")
+		return
 	}
-	if rating := c.Query("rating"); rating != "" {
-		if r, err := strconv.Atoi(rating); err == nil && r >= 0 && r <= 5 {
-			countQuery = countQuery.Where("rating = ?", r)
+
+	var nextCursor *string
+	if len(photos) > limit {
+		photos = photos[:limit]
+		if byUploadTime {
+			cursor := encodePhotoCursor(photos[limit-1], desc)
+			nextCursor = &cursor
 		}
 	}
-	if tagName := c.Query("tag"); tagName != "" {
-		countQuery = countQuery.Joins("JOIN photo_tags ON photos.id = photo_tags.photo_id").
-			Joins("JOIN tags ON photo_tags.tag_id = tags.id").
-			Where("tags.name = ?", tagName)
+
+	// Get total count for pagination
+	total, err := h.photos.Count(c.Request.Context(), filter)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to count photos")
+		return
 	}
-	countQuery.Count(&total)
 
-	response := gin.H{
-		"photos": photos,
-		"pagination": gin.H{
-			"page":  page,
-			"limit": limit,
-			"total": total,
-		},
+	pagination := gin.H{
+		"limit":       limit,
+		"total":       total,
+		"next_cursor": nextCursor,
+	}
+	if page > 0 {
+		pagination["page"] = page
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, gin.H{
+		"photos":     photos,
+		"pagination": pagination,
+	})
 }
 
 // GetPhoto returns a specific photo by ID
@@ -286,135 +579,207 @@ func (h *PhotoHandler) GetPhoto(c *gin.Context) {
 
 	id, err := uuid.Parse(photoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
 		return
 	}
 
-	var photo models.Photo
-	query := h.db.Model(&models.Photo{})
-
-	// Optional: include related data
-	if c.Query("include_library") == "true" {
-		query = query.Preload("Library")
-	}
-	if c.Query("include_tags") == "true" {
-		query = query.Preload("Tags")
-	}
-	if c.Query("include_albums") == "true" {
-		query = query.Preload("Albums")
-	}
-
-	if err := query.First(&photo, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+	photo, err := h.photos.Get(c.Request.Context(), id, photoRelations(c))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photo"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
 		return
 	}
 
 	c.JSON(http.StatusOK, photo)
 }
 
+// updatePhotoRequest is the JSON body of UpdatePhoto
+type updatePhotoRequest struct {
+	Rating   *int    `json:"rating" binding:"omitempty,min=0,max=5"`
+	Favorite *bool   `json:"favorite"`
+	Title    *string `json:"title" binding:"omitempty,max=200"`
+	Caption  *string `json:"caption" binding:"omitempty,max=500"`
+	// Latitude and longitude are set, or cleared with nulls, together
+	Latitude  *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	// Named apart from album and tag descriptions, which have a lower limit
+	PhotoDescription *string `json:"description" binding:"omitempty,max=5000"`
+}
+
 // UpdatePhoto updates photo metadata
 func (h *PhotoHandler) UpdatePhoto(c *gin.Context) {
 	photoID := c.Param("id")
 
 	id, err := uuid.Parse(photoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
 		return
 	}
 
-	var req struct {
-		Rating *int `json:"rating" binding:"omitempty,min=0,max=5"`
+	var req updatePhotoRequest
+
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		respondValidationError(c, err)
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+	// A null rating or position clears it, so tell that apart from one left out
+	var fields map[string]json.RawMessage
+	json.Unmarshal(c.MustGet(gin.BodyBytesKey).([]byte), &fields)
+	_, ratingSet := fields["rating"]
+	_, latitudeSet := fields["latitude"]
+	_, longitudeSet := fields["longitude"]
+	if latitudeSet != longitudeSet || (req.Latitude == nil) != (req.Longitude == nil) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "latitude and longitude must be given together")
 		return
 	}
 
-	var photo models.Photo
-	if err := h.db.First(&photo, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+	photo, err := h.photos.Get(c.Request.Context(), id, repository.PhotoRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if err := checkWritable(scopedDB(c, h.db), photo.LibraryID); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	// Update only provided fields. Write-back rewrites the file, so it only
+	// runs when the rating actually changes.
+	ratingChanged := ratingSet && !sameRating(photo.Rating, req.Rating)
+	if ratingSet {
+		photo.Rating = req.Rating
+	}
+	if req.Favorite != nil {
+		photo.Favorite = *req.Favorite
+	}
+	if latitudeSet && !samePosition(photo.Latitude, photo.Longitude, req.Latitude, req.Longitude) {
+		photo.Latitude, photo.Longitude = req.Latitude, req.Longitude
+		clearPlace(photo)
+	}
+	if req.Title != nil {
+		photo.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Caption != nil {
+		photo.Caption = strings.TrimSpace(*req.Caption)
+	}
+	if req.PhotoDescription != nil {
+		photo.Description = strings.TrimSpace(*req.PhotoDescription)
+	}
+
+	if err := h.photos.Save(c.Request.Context(), photo); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo")
+		return
+	}
+
+	// Keep external editors in agreement with the stored rating
+	if ratingChanged {
+		h.writeBackRating(scopedDB(c, h.db), photo)
+	}
+
+	c.JSON(http.StatusOK, photo)
+}
+
+// ToggleFavorite marks a photo as a favorite, or unmarks it if it already is one
+func (h *PhotoHandler) ToggleFavorite(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	photo, err := h.photos.Get(c.Request.Context(), id, repository.PhotoRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photo"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
 		return
 	}
 
-	// Update rating
-	photo.Rating = req.Rating
+	if err := checkWritable(scopedDB(c, h.db), photo.LibraryID); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
 
-	if err := h.db.Save(&photo).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update photo"})
+	if err := h.photos.ToggleFavorite(c.Request.Context(), photo); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo")
 		return
 	}
 
 	c.JSON(http.StatusOK, photo)
 }
 
-// DeletePhoto deletes a photo and its file
+// DeletePhoto moves a photo to the trash. Its file, tags and album
+// memberships are kept until it is purged, so it can be restored.
 func (h *PhotoHandler) DeletePhoto(c *gin.Context) {
 	photoID := c.Param("id")
 
 	id, err := uuid.Parse(photoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
 		return
 	}
 
-	var photo models.Photo
-	if err := h.db.First(&photo, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+	photo, err := h.photos.Get(c.Request.Context(), id, repository.PhotoRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photo"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
 		return
 	}
 
-	// Use transaction to clean up all relationships
-	tx := h.db.Begin()
+	tx := scopedDB(c, h.db).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
 		}
 	}()
 
-	// Delete photo_tags relationships
-	if err := tx.Where("photo_id = ?", id).Delete(&models.PhotoTag{}).Error; err != nil {
+	if err := trashPhoto(tx, photo); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove photo tags"})
+		respondPhotoOpError(c, err)
 		return
 	}
 
-	// Delete album_photos relationships
-	if err := tx.Where("photo_id = ?", id).Delete(&models.AlbumPhoto{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove photo from albums"})
-		return
-	}
+	tx.Commit()
 
-	// Delete the photo record
-	if err := tx.Delete(&photo).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete photo"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{"message": "Photo moved to trash"})
+}
 
-	tx.Commit()
+// trashPhoto moves a photo to the trash within tx
+func trashPhoto(tx *gorm.DB, photo *models.Photo) error {
+	if err := checkWritable(tx, photo.LibraryID); err != nil {
+		return err
+	}
 
-	// Delete the physical file
-	if err := os.Remove(photo.FilePath); err != nil {
-		// Log error but don't fail the request since DB is already updated
-		// In production, you might want to queue this for retry
-		fmt.Printf("Warning: Failed to delete file %s: %v\n", photo.FilePath, err)
+	// Sets deleted_at, which hides the photo from everything but the trash
+	if err := tx.Delete(photo).Error; err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete photo"}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Photo deleted successfully"})
+	// Albums holding the photo no longer span its date
+	albumIDs, err := albumIDsForPhotos(tx, []uuid.UUID{photo.ID})
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo albums"}
+	}
+	if err := updateAlbumDateRanges(tx, albumIDs); err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album dates"}
+	}
+	return nil
 }
 
 // ServePhoto serves the actual photo file
@@ -423,142 +788,450 @@ func (h *PhotoHandler) ServePhoto(c *gin.Context) {
 
 	id, err := uuid.Parse(photoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	// Web clients can ask for exactly the size they display
+	width, height, fit, err := resizeRequest(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
 		return
 	}
 
 	var photo models.Photo
-	if err := h.db.First(&photo, id).Error; err != nil {
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photo"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
 		return
 	}
 
 	// Check if file exists
 	if _, err := os.Stat(photo.FilePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Photo file not found"})
+		apierror.Respond(c, http.StatusNotFound, "photo_file_not_found", "Photo file not found")
 		return
 	}
 
-	c.Header("Content-Type", photo.MimeType)
-	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", photo.OriginalName))
-	c.File(photo.FilePath)
-}
-
-// CopyPhoto copies a photo to the same or different library with a new unique identifier
-func (h *PhotoHandler) CopyPhoto(c *gin.Context) {
-	photoID := c.Param("id")
-
-	sourceID, err := uuid.Parse(photoID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+	// Edited photos are served as edited unless the original is asked for
+	number, ok := requestedVersion(c, scopedDB(c, h.db), &photo)
+	if !ok {
 		return
 	}
 
-	var req struct {
-		LibraryID uuid.UUID `json:"library_id" binding:"required"`
+	if width > 0 || height > 0 {
+		h.serveResized(c, &photo, number, width, height, fit)
+		return
 	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+	if number > 0 {
+		h.serveEdited(c, &photo, number)
 		return
 	}
 
-	// Verify source photo exists
-	var sourcePhoto models.Photo
-	if err := h.db.Preload("Tags").First(&sourcePhoto, sourceID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Source photo not found"})
+	c.Header("Content-Type", photo.MimeType)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", photo.OriginalName))
+
+	// Only JPEGs can be rewritten, other formats are served as stored
+	if c.Query("embed_metadata") == "true" && photo.MimeType == "image/jpeg" {
+		data, err := readOriginal(h.config, &photo)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read photo file")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch source photo"})
+		h.serveEmbedded(c, &photo, photo.OriginalName, data)
 		return
 	}
 
-	// Verify target library exists
-	var targetLibrary models.Library
-	if err := h.db.First(&targetLibrary, req.LibraryID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Target library not found"})
+	// Both paths below honor Range, If-None-Match and If-Modified-Since
+	// against this tag, so caches can revalidate and downloads can resume
+	c.Header("ETag", fmt.Sprintf("%q", photo.OriginalVersion()))
+
+	if photo.Encrypted {
+		original, _, err := openOriginal(h.config, &photo)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to decrypt photo file")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify target library"})
+		defer original.Close()
+		http.ServeContent(c.Writer, c.Request, photo.OriginalName, photo.UpdatedAt, original)
 		return
 	}
 
-	// Check if source file exists
-	if _, err := os.Stat(sourcePhoto.FilePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Source photo file not found"})
+	if offloadFile(c, h.config, photo.FilePath) {
 		return
 	}
+	c.File(photo.FilePath)
+}
 
-	// Generate new filename for the copy
-	newFilename := h.generateUniqueFilename(sourcePhoto.OriginalName)
-	newFilePath := filepath.Join(targetLibrary.Images, newFilename)
+// serveEdited serves version number of a photo as a JPEG
+func (h *PhotoHandler) serveEdited(c *gin.Context, photo *models.Photo, number int) {
+	data, err := h.editedRendition(scopedDB(c, h.db), photo, number)
+	if err != nil {
+		respondEditError(c, err)
+		return
+	}
 
-	// Ensure target library images directory exists
-	if err := os.MkdirAll(targetLibrary.Images, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create target library images directory"})
+	name := strings.TrimSuffix(photo.OriginalName, filepath.Ext(photo.OriginalName)) + ".jpg"
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", name))
+	if c.Query("embed_metadata") == "true" {
+		h.serveEmbedded(c, photo, name, data)
 		return
 	}
 
-	// Copy the physical file
-	if err := h.copyFile(sourcePhoto.FilePath, newFilePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy photo file"})
+	c.Header("ETag", fmt.Sprintf("%q", fileVersion(photo, number)))
+	http.ServeContent(c.Writer, c.Request, name, photo.UpdatedAt, bytes.NewReader(data))
+}
+
+// serveEmbedded serves a JPEG of a photo, its original or an edited version,
+// with its current title, caption, tags, rating and location written into
+// the file's XMP
+func (h *PhotoHandler) serveEmbedded(c *gin.Context, photo *models.Photo, name string, data []byte) {
+	if err := scopedDB(c, h.db).Model(photo).Association("Tags").Find(&photo.Tags); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo tags")
 		return
 	}
 
-	// Create new photo record with copied metadata
-	newPhoto := models.Photo{
-		Filename:     newFilename,
-		OriginalName: sourcePhoto.OriginalName,
-		FilePath:     newFilePath,
-		MimeType:     sourcePhoto.MimeType,
-		FileSize:     sourcePhoto.FileSize,
-		Width:        sourcePhoto.Width,
-		Height:       sourcePhoto.Height,
-		Rating:       sourcePhoto.Rating,
-		LibraryID:    req.LibraryID,
-		UploadedAt:   time.Now(), // New upload time for the copy
+	data, err := metadata.Embed(data, embeddedFields(photo))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to embed photo metadata")
+		return
 	}
 
-	// Use transaction to ensure data consistency
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// The file changes with the metadata, so tag it by content
+	sum := sha256.Sum256(data)
+	c.Header("ETag", fmt.Sprintf("%q", hex.EncodeToString(sum[:])))
+	http.ServeContent(c.Writer, c.Request, name, photo.UpdatedAt, bytes.NewReader(data))
+}
+
+// ServeThumbnail serves a cached rendition of a photo, generating it on first request
+func (h *PhotoHandler) ServeThumbnail(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	size := c.DefaultQuery("size", thumbnails.DefaultSize)
+	if _, ok := thumbnails.Sizes[size]; !ok {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid size. Must be one of: small, medium")
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).Preload("Library").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
 		}
-	}()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
 
-	// Create the new photo record
-	if err := tx.Create(&newPhoto).Error; err != nil {
-		tx.Rollback()
-		os.Remove(newFilePath) // Cleanup file on failure
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create photo copy"})
+	if _, err := os.Stat(photo.FilePath); os.IsNotExist(err) {
+		apierror.Respond(c, http.StatusNotFound, "photo_file_not_found", "Photo file not found")
 		return
 	}
 
-	// Copy all tags from source photo to new photo
-	for _, tag := range sourcePhoto.Tags {
-		photoTag := models.PhotoTag{
-			PhotoID: newPhoto.ID,
-			TagID:   tag.ID,
+	number, ok := requestedVersion(c, scopedDB(c, h.db), &photo)
+	if !ok {
+		return
+	}
+	if number > 0 {
+		h.serveEditedThumbnail(c, &photo, number, size)
+		return
+	}
+
+	// Renditions of encrypted photos would leak their content, so they are
+	// rendered in memory for every request instead of being cached
+	if photo.Encrypted {
+		data, err := readOriginal(h.config, &photo)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to decrypt photo file")
+			return
 		}
-		if err := tx.Create(&photoTag).Error; err != nil {
-			tx.Rollback()
-			os.Remove(newFilePath) // Cleanup file on failure
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy photo tags"})
+		rendition, err := thumbnails.Render(data, size)
+		if err != nil {
+			respondThumbnailError(c, err)
 			return
 		}
+		c.Header("Cache-Control", "private, max-age=86400")
+		c.Data(http.StatusOK, "image/jpeg", rendition)
+		return
 	}
 
-	tx.Commit()
+	path, err := thumbnails.Ensure(photo.Library.Images, photo.FilePath, size)
+	if err != nil {
+		respondThumbnailError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Cache-Control", "private, max-age=86400")
+	if offloadFile(c, h.config, path) {
+		return
+	}
+	c.File(path)
+}
+
+// resizeRequest reads the w, h and fit query parameters of a file request.
+// Both sizes are 0 when the original is wanted.
+func resizeRequest(c *gin.Context) (int, int, string, error) {
+	var size [2]int
+	for i, param := range []string{"w", "h"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > thumbnails.MaxResizeDimension {
+			return 0, 0, "", fmt.Errorf("%s must be a number between 1 and %d", param, thumbnails.MaxResizeDimension)
+		}
+		size[i] = n
+	}
+
+	fit := c.DefaultQuery("fit", thumbnails.FitContain)
+	switch fit {
+	case thumbnails.FitContain:
+	case thumbnails.FitCover:
+		if size[0] == 0 || size[1] == 0 {
+			return 0, 0, "", fmt.Errorf("fit=cover needs both w and h")
+		}
+	default:
+		return 0, 0, "", fmt.Errorf("Invalid fit. Must be one of: contain, cover")
+	}
+	return size[0], size[1], fit, nil
+}
+
+// serveResized serves version number of a photo, 0 for its original, scaled
+// to the requested box, from the resize cache if it was requested at that
+// size before
+func (h *PhotoHandler) serveResized(c *gin.Context, photo *models.Photo, number, width, height int, fit string) {
+	name := strings.TrimSuffix(photo.OriginalName, filepath.Ext(photo.OriginalName)) + ".jpg"
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", name))
+	c.Header("Cache-Control", "private, max-age=86400")
+
+	resize := func() ([]byte, error) {
+		if number > 0 {
+			edited, err := h.editedRendition(scopedDB(c, h.db), photo, number)
+			if err != nil {
+				return nil, err
+			}
+			return thumbnails.ResizeData(edited, width, height, fit)
+		}
+		if photo.Encrypted {
+			data, err := readOriginal(h.config, photo)
+			if err != nil {
+				return nil, err
+			}
+			return thumbnails.ResizeData(data, width, height, fit)
+		}
+		return thumbnails.ResizeFile(photo.FilePath, width, height, fit)
+	}
+
+	// Like renditions, resized copies of encrypted photos are never stored
+	if photo.Encrypted {
+		resized, err := resize()
+		if err != nil {
+			respondResizeError(c, err)
+			return
+		}
+		c.Data(http.StatusOK, "image/jpeg", resized)
+		return
+	}
+
+	// The content version keeps edited photos from hitting stale entries
+	key := fmt.Sprintf("%s_%s_%dx%d_%s.jpg", photo.ID, fileVersion(photo, number), width, height, fit)
+	path, ok := h.resized.Get(key)
+	if !ok {
+		resized, err := resize()
+		if err != nil {
+			respondResizeError(c, err)
+			return
+		}
+		if path, err = h.resized.Put(key, resized); err != nil {
+			// Caching is disabled or failed, the image is still good
+			c.Data(http.StatusOK, "image/jpeg", resized)
+			return
+		}
+	}
+
+	c.Header("Content-Type", "image/jpeg")
+	if offloadFile(c, h.config, path) {
+		return
+	}
+	c.File(path)
+}
+
+// respondResizeError writes the response for a failed resize
+func respondResizeError(c *gin.Context, err error) {
+	if opErr, ok := err.(*photoOpError); ok {
+		respondPhotoOpError(c, opErr)
+		return
+	}
+	if err == thumbnails.ErrUnsupported {
+		apierror.Respond(c, http.StatusUnsupportedMediaType, "unsupported_file_type", "Resizing is not supported for this file type")
+		return
+	}
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to resize photo")
+}
+
+// respondThumbnailError writes the response for a failed rendition
+func respondThumbnailError(c *gin.Context, err error) {
+	if err == thumbnails.ErrUnsupported {
+		apierror.Respond(c, http.StatusUnsupportedMediaType, "unsupported_file_type", "Thumbnails are not supported for this image type")
+		return
+	}
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate thumbnail")
+}
+
+// ServeMotion serves the video clip embedded in a Motion Photo
+func (h *PhotoHandler) ServeMotion(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if _, err := os.Stat(photo.FilePath); os.IsNotExist(err) {
+		apierror.Respond(c, http.StatusNotFound, "photo_file_not_found", "Photo file not found")
+		return
+	}
+
+	data, err := readOriginal(h.config, &photo)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read photo file")
+		return
+	}
+
+	motion := metadata.FindMotionVideo(data)
+	if motion == nil {
+		apierror.Respond(c, http.StatusNotFound, "no_motion_clip", "Photo has no motion clip")
+		return
+	}
+
+	name := strings.TrimSuffix(photo.OriginalName, filepath.Ext(photo.OriginalName)) + ".mp4"
+	c.Header("Content-Type", "video/mp4")
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", name))
+	http.ServeContent(c.Writer, c.Request, name, photo.UpdatedAt, bytes.NewReader(data[motion.Offset:motion.Offset+motion.Length]))
+}
+
+// ServePreview serves the JPEG preview embedded in a RAW file
+func (h *PhotoHandler) ServePreview(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if photo.RawFormat == "" {
+		apierror.Respond(c, http.StatusNotFound, "not_raw_file", "Photo is not a RAW file")
+		return
+	}
+
+	if _, err := os.Stat(photo.FilePath); os.IsNotExist(err) {
+		apierror.Respond(c, http.StatusNotFound, "photo_file_not_found", "Photo file not found")
+		return
+	}
+
+	data, err := readOriginal(h.config, &photo)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read photo file")
+		return
+	}
+
+	preview := raw.Preview(data)
+	if preview == nil {
+		apierror.Respond(c, http.StatusNotFound, "no_raw_preview", "RAW file has no embedded preview")
+		return
+	}
+
+	name := strings.TrimSuffix(photo.OriginalName, filepath.Ext(photo.OriginalName)) + ".jpg"
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", name))
+	http.ServeContent(c.Writer, c.Request, name, photo.UpdatedAt, bytes.NewReader(preview))
+}
+
+// copyPhotoRequest is the JSON body of CopyPhoto
+type copyPhotoRequest struct {
+	LibraryID uuid.UUID `json:"library_id" binding:"required"`
+}
+
+// CopyPhoto copies a photo to the same or different library with a new unique identifier
+func (h *PhotoHandler) CopyPhoto(c *gin.Context) {
+	photoID := c.Param("id")
+
+	sourceID, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var req copyPhotoRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	// Verify source photo exists
+	var sourcePhoto models.Photo
+	if err := scopedDB(c, h.db).Preload("Tags").First(&sourcePhoto, sourceID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Source photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch source photo")
+		return
+	}
+
+	// Verify target library exists
+	var targetLibrary models.Library
+	if err := scopedDB(c, h.db).First(&targetLibrary, req.LibraryID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "target_library_not_found", "Target library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify target library")
+		return
+	}
+
+	newPhoto, err := h.copyPhotoToLibrary(&sourcePhoto, &targetLibrary)
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
 
 	// Load the new photo with all relationships for response
-	h.db.Preload("Library").Preload("Tags").First(&newPhoto, newPhoto.ID)
+	scopedDB(c, h.db).Preload("Library").Preload("Tags").First(newPhoto, newPhoto.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":      "Photo copied successfully",
@@ -567,8 +1240,320 @@ func (h *PhotoHandler) CopyPhoto(c *gin.Context) {
 	})
 }
 
+// bulkCopyResult is the per-photo outcome of a bulk copy job
+type bulkCopyResult struct {
+	PhotoID       uuid.UUID  `json:"photo_id"`
+	Status        string     `json:"status"` // "copied" or "failed"
+	CopiedPhotoID *uuid.UUID `json:"copied_photo_id,omitempty"`
+	Code          string     `json:"code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// bulkCopyRequest is the JSON body of BulkCopyPhotos
+type bulkCopyRequest struct {
+	PhotoIDs  []uuid.UUID `json:"photo_ids" binding:"required,min=1,max=1000"`
+	LibraryID uuid.UUID   `json:"library_id" binding:"required"`
+}
+
+// BulkCopyPhotos copies several photos into a library as a background job
+func (h *PhotoHandler) BulkCopyPhotos(c *gin.Context) {
+	var req bulkCopyRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	// Verify target library exists
+	var targetLibrary models.Library
+	if err := scopedDB(c, h.db).First(&targetLibrary, req.LibraryID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "target_library_not_found", "Target library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify target library")
+		return
+	}
+	if targetLibrary.ReadOnly {
+		respondPhotoOpError(c, errReadOnlyTarget)
+		return
+	}
+
+	photoIDs := req.PhotoIDs
+	job, err := h.jobs.SubmitFor(targetLibrary.TenantID, "bulk_copy", func(ctx context.Context, job *jobs.Job) error {
+		job.SetTotal(len(photoIDs))
+		for _, photoID := range photoIDs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			job.AddResult(h.bulkCopyOne(photoID, &targetLibrary))
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule copy job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
 // Helper methods
 
+// bulkCopyOne copies a single photo for BulkCopyPhotos and reports the outcome
+func (h *PhotoHandler) bulkCopyOne(photoID uuid.UUID, targetLibrary *models.Library) bulkCopyResult {
+	result := bulkCopyResult{PhotoID: photoID, Status: "failed"}
+
+	// Only photos of the target library's tenant can be copied
+	var sourcePhoto models.Photo
+	if err := tenant.Scope(h.db, targetLibrary.TenantID).Preload("Tags").First(&sourcePhoto, photoID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			result.Code, result.Error = "photo_not_found", "Source photo not found"
+		} else {
+			result.Code, result.Error = apierror.CodeInternal, "Failed to fetch source photo"
+		}
+		return result
+	}
+
+	newPhoto, err := h.copyPhotoToLibrary(&sourcePhoto, targetLibrary)
+	if err != nil {
+		result.Code, result.Error = errorCode(err), err.Error()
+		return result
+	}
+
+	result.Status = "copied"
+	result.CopiedPhotoID = &newPhoto.ID
+	return result
+}
+
+// photoOpError carries the HTTP status, error code and client-facing message
+// of a failed photo operation so shared helpers can be reused by single and
+// bulk endpoints
+type photoOpError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *photoOpError) Error() string {
+	return e.message
+}
+
+// respondPhotoOpError writes err as a JSON error response
+func respondPhotoOpError(c *gin.Context, err error) {
+	if opErr, ok := err.(*photoOpError); ok {
+		apierror.Respond(c, opErr.status, opErr.code, opErr.message)
+		return
+	}
+	if duplicate, ok := err.(*duplicateUploadError); ok {
+		apierror.RespondWithDetails(c, http.StatusConflict, "duplicate_photo", duplicate.Error(), gin.H{"photo_id": duplicate.existing.ID})
+		return
+	}
+	if quotaErr, ok := err.(*quotaExceededError); ok {
+		apierror.RespondWithDetails(c, http.StatusRequestEntityTooLarge, "quota_exceeded", "Library quota exceeded", gin.H{
+			"quota_bytes":     quotaErr.QuotaBytes,
+			"used_bytes":      quotaErr.UsedBytes,
+			"requested_bytes": quotaErr.RequestedBytes,
+		})
+		return
+	}
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, err.Error())
+}
+
+// errorCode returns the error code of a failed photo operation, for the
+// per-photo results of bulk endpoints
+func errorCode(err error) string {
+	switch err := err.(type) {
+	case *photoOpError:
+		return err.code
+	case *duplicateUploadError:
+		return "duplicate_photo"
+	case *quotaExceededError:
+		return "quota_exceeded"
+	}
+	return apierror.CodeInternal
+}
+
+// duplicateUploadError is returned for uploads whose bytes the target
+// library already holds
+type duplicateUploadError struct {
+	existing *models.Photo
+}
+
+func (e *duplicateUploadError) Error() string {
+	return "Photo already exists in this library"
+}
+
+// findDuplicate returns the earliest photo in library with the same contents
+// as file, or nil if there is none. file is left at its start.
+func (h *PhotoHandler) findDuplicate(library *models.Library, file multipart.File) (*models.Photo, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, &photoOpError{http.StatusBadRequest, "invalid_form", "Failed to read uploaded file"}
+	}
+	file.Seek(0, 0)
+
+	var existing models.Photo
+	err := h.db.Where("library_id = ? AND checksum = ?", library.ID, hex.EncodeToString(hash.Sum(nil))).
+		Order("uploaded_at asc").
+		First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to check for duplicates"}
+	}
+	return &existing, nil
+}
+
+// copyPhotoToLibrary duplicates a photo's file, metadata and tags into the
+// target library. sourcePhoto must have its Tags preloaded.
+func (h *PhotoHandler) copyPhotoToLibrary(sourcePhoto *models.Photo, targetLibrary *models.Library) (*models.Photo, error) {
+	photoCopy, err := h.startCopy(h.db, sourcePhoto, targetLibrary)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use transaction to ensure data consistency
+	if err := h.db.Transaction(photoCopy.record); err != nil {
+		photoCopy.undo()
+		return nil, err
+	}
+
+	h.prepareThumbnails(&photoCopy.newPhoto, targetLibrary)
+
+	return &photoCopy.newPhoto, nil
+}
+
+// photoCopy is a copied photo file whose record may not be created yet
+type photoCopy struct {
+	sourcePhoto *models.Photo
+	newPhoto    models.Photo
+}
+
+// startCopy checks that a photo can be copied to the target library, copies
+// its file and prepares the new record. The copy must then be recorded, or
+// undone. The target's quota is checked against db.
+func (h *PhotoHandler) startCopy(db *gorm.DB, sourcePhoto *models.Photo, targetLibrary *models.Library) (*photoCopy, error) {
+	if targetLibrary.ReadOnly {
+		return nil, errReadOnlyTarget
+	}
+	if isRelocating(targetLibrary.ID) {
+		return nil, &photoOpError{http.StatusConflict, "library_relocating", "Target library is being relocated, try again later"}
+	}
+
+	if sourcePhoto.MimeType == documents.MimeType && !targetLibrary.AcceptDocuments {
+		return nil, &photoOpError{http.StatusBadRequest, "documents_not_accepted", "Target library does not accept documents"}
+	}
+
+	// Check if source file exists
+	if _, err := os.Stat(sourcePhoto.FilePath); os.IsNotExist(err) {
+		return nil, &photoOpError{http.StatusNotFound, "photo_file_not_found", "Source photo file not found"}
+	}
+	if err := checkQuota(db, targetLibrary, sourcePhoto.FileSize); err != nil {
+		return nil, err
+	}
+
+	// Generate new filename for the copy
+	newFilename := h.generateUniqueFilename(sourcePhoto.OriginalName)
+	newFilePath := filepath.Join(targetLibrary.Images, newFilename)
+
+	// Ensure target library images directory exists
+	if err := os.MkdirAll(targetLibrary.Images, 0755); err != nil {
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to create target library images directory"}
+	}
+
+	storedSize := sourcePhoto.FileSize
+	if targetLibrary.Encrypted {
+		storedSize = encryption.EncryptedSize(sourcePhoto.FileSize)
+	}
+	if opErr := h.checkDiskSpace(targetLibrary.Images, storedSize); opErr != nil {
+		return nil, opErr
+	}
+
+	// Copy the physical file, re-encrypting it for the target library if needed
+	if err := h.copyOriginal(sourcePhoto, targetLibrary, newFilePath); err != nil {
+		if err == errEncryptionNotConfigured {
+			return nil, &photoOpError{http.StatusInternalServerError, "encryption_not_configured", "Encryption is not configured on this server"}
+		}
+		if diskspace.IsFull(err) {
+			return nil, errDiskFull
+		}
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to copy photo file"}
+	}
+
+	// Create new photo record with copied metadata
+	return &photoCopy{sourcePhoto: sourcePhoto, newPhoto: models.Photo{
+		Filename:       newFilename,
+		OriginalName:   sourcePhoto.OriginalName,
+		FilePath:       newFilePath,
+		MimeType:       sourcePhoto.MimeType,
+		FileSize:       sourcePhoto.FileSize,
+		Checksum:       sourcePhoto.Checksum,
+		PerceptualHash: sourcePhoto.PerceptualHash,
+		Width:          sourcePhoto.Width,
+		Height:         sourcePhoto.Height,
+		Rating:         sourcePhoto.Rating,
+		Favorite:       sourcePhoto.Favorite,
+		Title:          sourcePhoto.Title,
+		Caption:        sourcePhoto.Caption,
+		Description:    sourcePhoto.Description,
+		LibraryID:      targetLibrary.ID,
+		TenantID:       targetLibrary.TenantID,
+		TakenAt:        sourcePhoto.TakenAt,
+		Latitude:       sourcePhoto.Latitude,
+		Longitude:      sourcePhoto.Longitude,
+		Country:        sourcePhoto.Country,
+		City:           sourcePhoto.City,
+		Place:          sourcePhoto.Place,
+		GeocodedAt:     sourcePhoto.GeocodedAt,
+		HasMotion:      sourcePhoto.HasMotion,
+		PageCount:      sourcePhoto.PageCount,
+		RawFormat:      sourcePhoto.RawFormat,
+		Duration:       sourcePhoto.Duration,
+		Encrypted:      targetLibrary.Encrypted,
+		UploadedAt:     time.Now(), // New upload time for the copy
+	}}, nil
+}
+
+// record creates the copy's record with the source photo's tags and custom
+// metadata fields
+func (p *photoCopy) record(tx *gorm.DB) error {
+	// Create the new photo record
+	if err := tx.Create(&p.newPhoto).Error; err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to create photo copy"}
+	}
+
+	// Copy all tags from source photo to new photo
+	for _, tag := range p.sourcePhoto.Tags {
+		photoTag := models.PhotoTag{
+			PhotoID: p.newPhoto.ID,
+			TagID:   tag.ID,
+		}
+		if err := tx.Create(&photoTag).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to copy photo tags"}
+		}
+	}
+
+	// Copy custom metadata fields
+	fields, err := photoMetadata(tx, p.sourcePhoto.ID)
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to copy photo metadata"}
+	}
+	for key, value := range fields {
+		if err := tx.Create(&models.PhotoMetadata{PhotoID: p.newPhoto.ID, Key: key, Value: value}).Error; err != nil {
+			return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to copy photo metadata"}
+		}
+	}
+	return nil
+}
+
+// undo removes the copied file of a copy that wasn't recorded
+func (p *photoCopy) undo() {
+	os.Remove(p.newPhoto.FilePath)
+}
+
 func (h *PhotoHandler) isValidImageType(mimeType string) bool {
 	for _, allowedType := range h.config.AllowedTypes {
 		if mimeType == allowedType {
@@ -586,6 +1571,42 @@ func (h *PhotoHandler) getImageDimensions(file multipart.File) (int, int, error)
 	return img.Width, img.Height, nil
 }
 
+// getDocumentInfo returns the page count of a PDF and the size of its
+// scanned first page, if it has one
+func (h *PhotoHandler) getDocumentInfo(file multipart.File) (int, int, int, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	info := documents.Inspect(data)
+	if info == nil {
+		return 0, 0, 0, fmt.Errorf("not a PDF document")
+	}
+
+	var width, height int
+	if info.Cover != nil {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(info.Cover)); err == nil {
+			width, height = cfg.Width, cfg.Height
+		}
+	}
+	return width, height, info.PageCount, nil
+}
+
+// getRawDimensions returns the image size recorded in a RAW file
+func (h *PhotoHandler) getRawDimensions(file multipart.File) (int, int, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info := raw.Inspect(data)
+	if info == nil {
+		return 0, 0, fmt.Errorf("not a TIFF-based RAW file")
+	}
+	return info.Width, info.Height, nil
+}
+
 func (h *PhotoHandler) generateUniqueFilename(originalName string) string {
 	ext := filepath.Ext(originalName)
 	name := strings.TrimSuffix(originalName, ext)
@@ -595,13 +1616,20 @@ func (h *PhotoHandler) generateUniqueFilename(originalName string) string {
 }
 
 func (h *PhotoHandler) addTagToPhoto(photo *models.Photo, tagName string) error {
-	// Find or create tag
-	var tag models.Tag
-	if err := h.db.Where("name = ?", tagName).First(&tag).Error; err != nil {
+	tagName = tagNamePolicy(h.config).Normalize(tagName)
+	if tagName == "" {
+		return nil
+	}
+
+	// Find or create tag among the photo's tenant's tags, aliases naming
+	// their tag
+	db := tenant.Scope(h.db, photo.TenantID)
+	tag, err := findTagByName(db, tagName)
+	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// Create new tag
 			tag = models.Tag{Name: tagName}
-			if err := h.db.Create(&tag).Error; err != nil {
+			if err := db.Create(&tag).Error; err != nil {
 				return err
 			}
 		} else {
@@ -625,6 +1653,145 @@ func (h *PhotoHandler) addTagToPhoto(photo *models.Photo, tagName string) error
 	return h.db.Create(&photoTag).Error
 }
 
+// importKeywords tags a photo with the keywords embedded in its file contents
+func (h *PhotoHandler) importKeywords(photo *models.Photo, data []byte) {
+	for _, keyword := range metadata.ExtractKeywords(data) {
+		// Keywords longer than the tag name limit can't be represented as tags
+		if len([]rune(keyword)) > maxTagNameLength {
+			continue
+		}
+		h.addTagToPhoto(photo, keyword)
+	}
+}
+
+// sameRating reports whether two ratings, either of which may be unset, are
+// the same
+func sameRating(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// writeBackRating mirrors a photo's rating into XMP metadata according to the
+// configured write-back mode. An embedded rating changes the file, whose new
+// size and checksum are saved through db.
+func (h *PhotoHandler) writeBackRating(db *gorm.DB, photo *models.Photo) {
+	switch h.config.XMPWriteback {
+	case "embed":
+		// Encrypted files are never rewritten, they get a sidecar like other formats
+		if photo.MimeType == "image/jpeg" && !photo.Encrypted {
+			if err := metadata.EmbedRating(photo.FilePath, photo.Rating); err != nil {
+				slog.Warn("Failed to write rating into file", "path", photo.FilePath, "error", err)
+				return
+			}
+
+			// Embedding the packet changes the file size and checksum
+			if info, err := os.Stat(photo.FilePath); err == nil {
+				photo.FileSize = info.Size()
+				photo.Checksum, _ = fileChecksum(photo.FilePath)
+				db.Model(photo).Updates(map[string]interface{}{"file_size": photo.FileSize, "checksum": photo.Checksum})
+			}
+			return
+		}
+		// Other formats can't be rewritten safely, fall back to a sidecar
+		fallthrough
+	case "sidecar":
+		if err := metadata.WriteSidecarRating(photo.FilePath, photo.Rating); err != nil {
+			slog.Warn("Failed to write rating sidecar", "path", photo.FilePath, "error", err)
+		}
+	}
+}
+
+// prepareThumbnails generates a new photo's renditions according to its
+// library's thumbnail mode. Lazy libraries generate them on first request.
+func (h *PhotoHandler) prepareThumbnails(photo *models.Photo, library *models.Library) {
+	// Renditions of encrypted photos are rendered on request and never stored
+	if photo.Encrypted {
+		return
+	}
+
+	switch library.ThumbnailMode {
+	case models.ThumbnailModeEager:
+		if err := thumbnails.GenerateAll(library.Images, photo.FilePath); err != nil && err != thumbnails.ErrUnsupported {
+			slog.Warn("Failed to generate thumbnails", "path", photo.FilePath, "error", err)
+		}
+	case models.ThumbnailModeBackground:
+		libraryDir, filePath := library.Images, photo.FilePath
+		_, err := h.jobs.SubmitFor(library.TenantID, "thumbnails", func(ctx context.Context, job *jobs.Job) error {
+			job.SetTotal(1)
+			defer job.Advance(1)
+			if err := thumbnails.GenerateAll(libraryDir, filePath); err != nil && err != thumbnails.ErrUnsupported {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			// Thumbnails will still be generated lazily when first requested
+			slog.Warn("Failed to queue thumbnails", "path", photo.FilePath, "error", err)
+		}
+	}
+}
+
+// errDiskFull is returned when a file doesn't fit on the library's filesystem
+var errDiskFull = &photoOpError{http.StatusInsufficientStorage, "insufficient_storage", "Not enough free disk space to store the file"}
+
+// checkDiskSpace returns a 507 error if storing size more bytes in dir would
+// eat into the configured free space reserve
+func (h *PhotoHandler) checkDiskSpace(dir string, size int64) *photoOpError {
+	ok, err := diskspace.Check(dir, size, h.config.DiskSpaceReserve)
+	if err != nil {
+		// Let the write itself fail if the filesystem can't be queried
+		slog.Warn("Failed to check free space", "path", dir, "error", err)
+		return nil
+	}
+	if !ok {
+		return errDiskFull
+	}
+	return nil
+}
+
+// copyOriginal copies a photo's original to dst in the form the target
+// library stores files, decrypting and encrypting as needed
+func (h *PhotoHandler) copyOriginal(photo *models.Photo, targetLibrary *models.Library, dst string) error {
+	if !photo.Encrypted && !targetLibrary.Encrypted {
+		return h.copyFile(photo.FilePath, dst)
+	}
+
+	var key []byte
+	if targetLibrary.Encrypted {
+		var err error
+		if key, err = libraryKey(h.config, targetLibrary.ID); err != nil {
+			return err
+		}
+	}
+
+	source, size, err := openOriginal(h.config, photo)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	if key != nil {
+		err = encryption.Encrypt(destFile, source, key, size)
+	} else {
+		_, err = io.Copy(destFile, source)
+	}
+	if err == nil {
+		err = destFile.Sync()
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
 func (h *PhotoHandler) copyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
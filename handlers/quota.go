@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// quotaExceededError is returned when storing a file would take a library
+// over its quota
+type quotaExceededError struct {
+	QuotaBytes     int64 `json:"quota_bytes"`
+	UsedBytes      int64 `json:"used_bytes"`
+	RequestedBytes int64 `json:"requested_bytes"`
+}
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf("Library quota exceeded: %d of %d bytes used, %d more requested", e.UsedBytes, e.QuotaBytes, e.RequestedBytes)
+}
+
+// quotaUsage describes how much of its quota a library uses
+type quotaUsage struct {
+	QuotaBytes     int64   `json:"quota_bytes"`
+	UsedBytes      int64   `json:"used_bytes"` // Trashed photos count until purged
+	AvailableBytes int64   `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+}
+
+// libraryUsage returns the bytes taken by a library's photos. Trashed photos
+// count too, their files are kept until purged.
+func libraryUsage(db *gorm.DB, libraryID uuid.UUID) (int64, error) {
+	var used int64
+	err := db.Unscoped().Model(&models.Photo{}).
+		Where("library_id = ?", libraryID).
+		Select("COALESCE(SUM(file_size), 0)").
+		Row().Scan(&used)
+	return used, err
+}
+
+// newQuotaUsage rounds a library's quota figures for responses
+func newQuotaUsage(quota, used int64) *quotaUsage {
+	return &quotaUsage{
+		QuotaBytes:     quota,
+		UsedBytes:      used,
+		AvailableBytes: max(quota-used, 0),
+		UsedPercent:    math.Round(float64(used)/float64(quota)*1000) / 10,
+	}
+}
+
+// checkQuota returns a quotaExceededError if adding size bytes to library
+// would take it over its quota. db must see the photos recorded so far, so
+// batches pass their transaction.
+func checkQuota(db *gorm.DB, library *models.Library, size int64) error {
+	if library.QuotaBytes <= 0 {
+		return nil
+	}
+	used, err := libraryUsage(db, library.ID)
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to check library quota"}
+	}
+	if used+size > library.QuotaBytes {
+		return &quotaExceededError{QuotaBytes: library.QuotaBytes, UsedBytes: used, RequestedBytes: size}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// errReadOnlyLibrary is returned for changes to the photos of a read-only
+// library. Its settings, albums and trash stay editable, so the flag can be
+// cleared again.
+var errReadOnlyLibrary = &photoOpError{http.StatusForbidden, "library_read_only", "Library is read-only"}
+
+// errReadOnlyTarget is returned for copies and moves into a read-only library
+var errReadOnlyTarget = &photoOpError{http.StatusForbidden, "library_read_only", "Target library is read-only"}
+
+// checkWritable returns errReadOnlyLibrary if the photos of a library can't be
+// changed
+func checkWritable(db *gorm.DB, libraryID uuid.UUID) error {
+	var library models.Library
+	if err := db.Select("id", "read_only").First(&library, libraryID).Error; err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library"}
+	}
+	if library.ReadOnly {
+		return errReadOnlyLibrary
+	}
+	return nil
+}
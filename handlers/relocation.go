@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"photo-library-server/diskspace"
+	"photo-library-server/jobs"
+	"photo-library-server/models"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// relocatingLibraries holds the IDs of libraries whose files are being moved.
+// Writes into those libraries are refused until the move has finished so no
+// file can be left behind in the old directory.
+var relocatingLibraries sync.Map
+
+// beginRelocation marks a library as relocating, returning false if it already was
+func beginRelocation(libraryID uuid.UUID) bool {
+	_, alreadyRunning := relocatingLibraries.LoadOrStore(libraryID, struct{}{})
+	return !alreadyRunning
+}
+
+// endRelocation clears the relocating mark set by beginRelocation
+func endRelocation(libraryID uuid.UUID) {
+	relocatingLibraries.Delete(libraryID)
+}
+
+// isRelocating reports whether a library's files are currently being moved
+func isRelocating(libraryID uuid.UUID) bool {
+	_, ok := relocatingLibraries.Load(libraryID)
+	return ok
+}
+
+// isEmptyOrMissingDir reports whether path is absent or an empty directory
+func isEmptyOrMissingDir(path string) bool {
+	entries, err := os.ReadDir(path)
+	if os.IsNotExist(err) {
+		return true
+	}
+	return err == nil && len(entries) == 0
+}
+
+// errNestedRelocation is returned when a library's old and new images
+// directories are the same or one contains the other
+var errNestedRelocation = errors.New("old and new images directories are nested")
+
+// pathsOverlap reports whether a and b are the same directory or one is
+// below the other
+func pathsOverlap(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	return inDirectory(a, b) || inDirectory(b, a)
+}
+
+// relocationPlan describes what relocating a library would do
+type relocationPlan struct {
+	OldPath        string `json:"old_path"`
+	NewPath        string `json:"new_path"`
+	Method         string `json:"method"` // "rename" within a filesystem, "copy" across them
+	Files          int    `json:"files"`
+	Bytes          int64  `json:"bytes"`
+	PhotosUpdated  int    `json:"photos_updated"`
+	AvailableBytes int64  `json:"available_bytes"` // Free space where the new directory would be
+	Fits           bool   `json:"fits"`            // Whether a copy would fit, always true for a rename
+}
+
+// planRelocation works out what relocateLibrary would do without touching
+// any files or records
+func (h *LibraryHandler) planRelocation(libraryID uuid.UUID, oldPath, newPath string) (*relocationPlan, error) {
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	if pathsOverlap(oldPath, newPath) {
+		return nil, errNestedRelocation
+	}
+	plan := &relocationPlan{OldPath: oldPath, NewPath: newPath, Method: "rename", Fits: true}
+
+	if _, err := os.Stat(oldPath); err == nil {
+		err := filepath.WalkDir(oldPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				plan.Files++
+				plan.Bytes += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var paths []string
+	if err := h.db.Unscoped().Model(&models.Photo{}).Where("library_id = ?", libraryID).Pluck("file_path", &paths).Error; err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if inDirectory(oldPath, path) {
+			plan.PhotosUpdated++
+		}
+	}
+
+	// The new directory may not exist yet, so look at its nearest ancestor
+	target := newPath
+	for {
+		if _, err := os.Stat(target); err == nil || filepath.Dir(target) == target {
+			break
+		}
+		target = filepath.Dir(target)
+	}
+	targetVolume, err := diskspace.Usage(target)
+	if err == diskspace.ErrUnsupported {
+		return plan, nil // Free space and filesystems can't be told on this platform
+	}
+	if err != nil {
+		return nil, err
+	}
+	plan.AvailableBytes = targetVolume.Free
+
+	if plan.Files > 0 {
+		if sourceVolume, err := diskspace.Usage(oldPath); err != nil || sourceVolume.ID != targetVolume.ID {
+			plan.Method = "copy"
+			plan.Fits = plan.Bytes <= plan.AvailableBytes
+		}
+	}
+	return plan, nil
+}
+
+// relocateLibrary moves a library's images directory to newPath and rewrites
+// the stored paths of its photos. The directory is renamed when possible;
+// otherwise every file is copied and verified before the old directory is
+// removed. On failure the library is left at oldPath.
+func (h *LibraryHandler) relocateLibrary(ctx context.Context, job *jobs.Job, libraryID uuid.UUID, oldPath, newPath string) error {
+	job.SetTotal(1)
+
+	// Copying into its own subtree and then removing the source would
+	// destroy the library
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	if pathsOverlap(oldPath, newPath) {
+		return errNestedRelocation
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent of new images directory: %w", err)
+	}
+
+	renamed := false
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		// Nothing to move
+		if err := createDirectoryIfNotExists(newPath); err != nil {
+			return fmt.Errorf("failed to create new images directory: %w", err)
+		}
+	} else {
+		// The target was checked to be empty, so it can be replaced by a rename
+		os.Remove(newPath)
+		if err := os.Rename(oldPath, newPath); err == nil {
+			renamed = true
+		} else if err := copyTreeVerified(ctx, job, oldPath, newPath); err != nil {
+			os.RemoveAll(newPath)
+			return err
+		}
+	}
+
+	undo := func() {
+		if renamed {
+			os.Rename(newPath, oldPath)
+		} else {
+			os.RemoveAll(newPath)
+		}
+	}
+
+	// Rewrite the library and photo paths together
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			undo()
+		}
+	}()
+
+	if err := tx.Model(&models.Library{}).Where("id = ?", libraryID).Update("images", newPath).Error; err != nil {
+		tx.Rollback()
+		undo()
+		return fmt.Errorf("failed to update library path: %w", err)
+	}
+
+	// Photos in the trash move with the library too
+	var photos []models.Photo
+	if err := tx.Unscoped().Where("library_id = ?", libraryID).Find(&photos).Error; err != nil {
+		tx.Rollback()
+		undo()
+		return fmt.Errorf("failed to fetch library photos: %w", err)
+	}
+
+	updated := 0
+	for _, photo := range photos {
+		// Photos stored elsewhere (e.g. cold storage) keep their path
+		rel, err := filepath.Rel(oldPath, photo.FilePath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if err := tx.Unscoped().Model(&models.Photo{}).Where("id = ?", photo.ID).Update("file_path", filepath.Join(newPath, rel)).Error; err != nil {
+			tx.Rollback()
+			undo()
+			return fmt.Errorf("failed to update path of photo %s: %w", photo.ID, err)
+		}
+		updated++
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		undo()
+		return fmt.Errorf("failed to commit relocation: %w", err)
+	}
+
+	method := "rename"
+	if !renamed {
+		method = "copy"
+		// Everything was verified, the old directory can go
+		if err := removeDirectoryIfExists(oldPath); err != nil {
+			slog.Warn("Failed to remove old images directory", "path", oldPath, "error", err)
+		}
+	}
+
+	job.AddResult(map[string]interface{}{
+		"old_path":       oldPath,
+		"new_path":       newPath,
+		"method":         method,
+		"photos_updated": updated,
+	})
+	return nil
+}
+
+// copyTreeVerified copies every file under src to dst, checking each copy's
+// SHA-256 against the original
+func copyTreeVerified(ctx context.Context, job *jobs.Job, src, dst string) error {
+	var files []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list images directory: %w", err)
+	}
+
+	// One unit per copied file plus the final summary result
+	job.SetTotal(len(files) + 1)
+
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+		}
+		if err := copyFileVerified(path, target); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", rel, err)
+		}
+		job.Advance(1)
+	}
+	return nil
+}
+
+// copyFileVerified copies src to dst, preserving mode and modification time,
+// and re-reads dst to confirm its checksum matches
+func copyFileVerified(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	sourceHash := sha256.New()
+	if _, err := io.Copy(destFile, io.TeeReader(sourceFile, sourceHash)); err != nil {
+		destFile.Close()
+		return err
+	}
+	if err := destFile.Sync(); err != nil {
+		destFile.Close()
+		return err
+	}
+	if err := destFile.Close(); err != nil {
+		return err
+	}
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	written, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer written.Close()
+
+	destHash := sha256.New()
+	if _, err := io.Copy(destHash, written); err != nil {
+		return err
+	}
+	if !bytes.Equal(sourceHash.Sum(nil), destHash.Sum(nil)) {
+		return fmt.Errorf("checksum mismatch after copy")
+	}
+	return nil
+}
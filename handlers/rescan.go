@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"photo-library-server/apierror"
+	"photo-library-server/documents"
+	"photo-library-server/jobs"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/raw"
+	"photo-library-server/thumbnails"
+	"photo-library-server/video"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// rescanResult is the per-photo outcome of a library rescan
+type rescanResult struct {
+	PhotoID uuid.UUID `json:"photo_id"`
+	Status  string    `json:"status"` // "unchanged", "updated", "missing", "restored" or "failed"
+	Error   string    `json:"error,omitempty"`
+}
+
+// RescanLibrary reconciles a library's photo records with the files on disk
+// as a background job
+func (h *LibraryHandler) RescanLibrary(c *gin.Context) {
+	libraryID := c.Param("id")
+
+	id, err := uuid.Parse(libraryID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
+		return
+	}
+
+	var library models.Library
+	if err := scopedDB(c, h.db).First(&library, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
+		return
+	}
+
+	if isRelocating(library.ID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
+		return
+	}
+
+	job, err := h.jobs.SubmitFor(library.TenantID, "library_rescan", func(ctx context.Context, job *jobs.Job) error {
+		var photos []models.Photo
+		if err := h.db.Where("library_id = ?", library.ID).Find(&photos).Error; err != nil {
+			return err
+		}
+
+		job.SetTotal(len(photos))
+		for i := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			job.AddResult(h.rescanPhoto(&photos[i], &library))
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule rescan job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// rescanPhoto compares one photo record with its file and updates the record
+// if the file went missing, came back, or was changed outside the API
+func (h *LibraryHandler) rescanPhoto(photo *models.Photo, library *models.Library) rescanResult {
+	result := rescanResult{PhotoID: photo.ID, Status: "unchanged"}
+
+	_, err := os.Stat(photo.FilePath)
+	if os.IsNotExist(err) {
+		if !photo.Missing {
+			if err := h.db.Model(photo).Update("missing", true).Error; err != nil {
+				result.Status, result.Error = "failed", "Failed to flag missing photo"
+				return result
+			}
+		}
+		result.Status = "missing"
+		return result
+	}
+	if err != nil {
+		result.Status, result.Error = "failed", "Failed to read photo file"
+		return result
+	}
+
+	updates := map[string]interface{}{}
+	if photo.Missing {
+		updates["missing"] = false
+		result.Status = "restored"
+	}
+
+	// Checksums and sizes are of the plaintext, so encrypted files are
+	// decrypted first
+	data, err := readOriginal(h.config, photo)
+	if err != nil {
+		result.Status, result.Error = "failed", "Failed to read photo file"
+		return result
+	}
+	size := int64(len(data))
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	switch {
+	case photo.Checksum == "":
+		// Records from before checksums were kept get a baseline
+		updates["checksum"] = checksum
+		if size != photo.FileSize {
+			refreshFileMetadata(data, checksum, updates)
+		}
+	case checksum != photo.Checksum || size != photo.FileSize:
+		refreshFileMetadata(data, checksum, updates)
+	}
+
+	// Records from before capture times were kept get one if the file has it
+	if _, refreshed := updates["file_size"]; !refreshed && photo.TakenAt == nil {
+		if takenAt := metadata.ExtractCaptureTime(data); takenAt != nil {
+			updates["taken_at"] = takenAt
+		}
+	}
+
+	// Likewise for GPS positions
+	if _, refreshed := updates["file_size"]; !refreshed && photo.Latitude == nil {
+		if loc := metadata.ExtractLocation(data); loc != nil {
+			updates["latitude"], updates["longitude"] = loc.Latitude, loc.Longitude
+		}
+	}
+
+	// Positions that moved need their place looking up again
+	if lat, ok := updates["latitude"].(float64); ok {
+		lon := updates["longitude"].(float64)
+		if !samePosition(photo.Latitude, photo.Longitude, &lat, &lon) {
+			updates["country"], updates["city"], updates["place"] = "", "", ""
+			updates["geocoded_at"] = nil
+		}
+	}
+
+	if _, changed := updates["file_size"]; changed {
+		// Cached renditions show the old image
+		thumbnails.Remove(library.Images, photo.FilePath)
+		// The new contents are taken as intended, see verifyPhoto
+		updates["corrupt"] = false
+		if result.Status == "unchanged" {
+			result.Status = "updated"
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := h.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(photo).Updates(updates).Error; err != nil {
+				return err
+			}
+			if _, changed := updates["taken_at"]; !changed {
+				return nil
+			}
+			// Albums holding the photo may span different dates now
+			albumIDs, err := albumIDsForPhotos(tx, []uuid.UUID{photo.ID})
+			if err != nil {
+				return err
+			}
+			return updateAlbumDateRanges(tx, albumIDs)
+		}); err != nil {
+			result.Status, result.Error = "failed", "Failed to update photo"
+		}
+	}
+	return result
+}
+
+// refreshFileMetadata records the size, checksum, type, dimensions, capture
+// time, GPS position, motion clip presence, page count and video duration of a photo's
+// current contents in updates
+func refreshFileMetadata(data []byte, checksum string, updates map[string]interface{}) {
+	updates["file_size"] = int64(len(data))
+	updates["checksum"] = checksum
+
+	mimeType := http.DetectContentType(data)
+	if strings.HasPrefix(mimeType, "image/") || mimeType == documents.MimeType || video.IsVideoType(mimeType) {
+		updates["mime_type"] = mimeType
+	}
+
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		updates["width"] = cfg.Width
+		updates["height"] = cfg.Height
+	} else if info := raw.Inspect(data); info != nil && info.Width > 0 {
+		updates["width"] = info.Width
+		updates["height"] = info.Height
+	}
+
+	updates["taken_at"] = metadata.ExtractCaptureTime(data)
+	// A position set by hand is kept unless the new file records one
+	if loc := metadata.ExtractLocation(data); loc != nil {
+		updates["latitude"], updates["longitude"] = loc.Latitude, loc.Longitude
+	}
+	updates["has_motion"] = metadata.FindMotionVideo(data) != nil
+
+	// Videos keep their hash, which is of the poster frame
+	if hash, err := thumbnails.HashData(data); err == nil {
+		updates["perceptual_hash"] = hash.String()
+	} else if !video.IsVideoType(mimeType) {
+		updates["perceptual_hash"] = ""
+	}
+
+	if mimeType == documents.MimeType {
+		if info := documents.Inspect(data); info != nil {
+			updates["page_count"] = info.PageCount
+		}
+	}
+
+	if info, err := video.Inspect(bytes.NewReader(data), int64(len(data))); err == nil {
+		updates["width"] = info.Width
+		updates["height"] = info.Height
+		updates["duration"] = info.Duration
+		updates["taken_at"] = info.CreatedAt
+	}
+}
+
+// fileChecksum returns the hex-encoded SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/thumbnails"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// rotateJPEGQuality is used when re-encoding rotated JPEGs, high enough that
+// the one generation of loss isn't visible
+const rotateJPEGQuality = 95
+
+// rotateRequest is the JSON body of RotatePhoto
+type rotateRequest struct {
+	Degrees int    `json:"degrees" binding:"omitempty,oneof=90 180 270"`
+	Flip    string `json:"flip" binding:"omitempty,oneof=horizontal vertical"`
+}
+
+// RotatePhoto turns a photo clockwise and/or mirrors it, rewriting its file
+func (h *PhotoHandler) RotatePhoto(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var req rotateRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	if req.Degrees == 0 && req.Flip == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "degrees or flip is required")
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).Preload("Library").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if err := h.rotatePhoto(&photo, req.Degrees, req.Flip); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	// Reload so the file URLs carry the new content version
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, photo)
+}
+
+// rotatePhoto rewrites a photo's file with its pixels transformed and records
+// the new dimensions, size and checksum. photo must have its Library preloaded.
+func (h *PhotoHandler) rotatePhoto(photo *models.Photo, degrees int, flip string) error {
+	if photo.Library.ReadOnly {
+		return errReadOnlyLibrary
+	}
+	if isRelocating(photo.LibraryID) {
+		return &photoOpError{http.StatusConflict, "library_relocating", "Library is being relocated, try again later"}
+	}
+
+	// Like rating write-back, encrypted files are never rewritten
+	if photo.Encrypted {
+		return &photoOpError{http.StatusConflict, "encrypted_not_supported", "Encrypted photos can't be rotated"}
+	}
+	if photo.MimeType != "image/jpeg" && photo.MimeType != "image/png" {
+		return &photoOpError{http.StatusUnsupportedMediaType, "unsupported_file_type", "Only JPEG and PNG photos can be rotated"}
+	}
+
+	original, err := os.ReadFile(photo.FilePath)
+	if os.IsNotExist(err) {
+		return &photoOpError{http.StatusNotFound, "photo_file_not_found", "Photo file not found"}
+	}
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to read photo file"}
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return &photoOpError{http.StatusUnprocessableEntity, "invalid_file", "Failed to decode photo"}
+	}
+	rotated := thumbnails.Rotate(src, degrees, flip)
+
+	var buf bytes.Buffer
+	if photo.MimeType == "image/jpeg" {
+		err = jpeg.Encode(&buf, rotated, &jpeg.Options{Quality: rotateJPEGQuality})
+	} else {
+		err = png.Encode(&buf, rotated)
+	}
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to encode rotated photo"}
+	}
+
+	// Keywords, capture time, ratings and Motion Photo clips survive the rewrite
+	data := metadata.CarryOver(original, buf.Bytes())
+
+	if opErr := h.checkDiskSpace(filepath.Dir(photo.FilePath), int64(len(data))); opErr != nil {
+		return opErr
+	}
+	if err := writeFileAtomic(photo.FilePath, data); err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to write rotated photo"}
+	}
+
+	bounds := rotated.Bounds()
+	sum := sha256.Sum256(data)
+	if err := h.db.Model(photo).Updates(map[string]interface{}{
+		"width":           bounds.Dx(),
+		"height":          bounds.Dy(),
+		"file_size":       int64(len(data)),
+		"checksum":        hex.EncodeToString(sum[:]),
+		"perceptual_hash": thumbnails.HashImage(rotated).String(),
+	}).Error; err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo"}
+	}
+
+	// Cached renditions show the old orientation. Resized copies are keyed by
+	// checksum and simply stop being requested.
+	thumbnails.Remove(photo.Library.Images, photo.FilePath)
+	h.prepareThumbnails(photo, &photo.Library)
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	os.Chmod(tmpPath, info.Mode().Perm())
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/documents"
+	"photo-library-server/jobs"
+	"photo-library-server/models"
+	"photo-library-server/raw"
+	"photo-library-server/tenant"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// errUnsupportedFile is returned for files of a type the library can't hold
+	errUnsupportedFile = errors.New("unsupported file type")
+	// errAlreadyImported is returned for files that already have a photo record
+	errAlreadyImported = errors.New("file is already in the library")
+)
+
+// scanTypesByExtension covers allowed types that content sniffing can't
+// recognize
+var scanTypesByExtension = map[string]string{
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".mov":  "video/quicktime",
+}
+
+// scanFailure is a file a library scan couldn't import
+type scanFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ScanLibrary imports files found in a library's images directory that have
+// no photo record yet, as a background job. Files stay where they are.
+func (h *PhotoHandler) ScanLibrary(c *gin.Context) {
+	libraryID := c.Param("id")
+
+	id, err := uuid.Parse(libraryID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
+		return
+	}
+
+	var library models.Library
+	if err := scopedDB(c, h.db).First(&library, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
+		return
+	}
+
+	// Files on disk are plaintext, so adopting them would break the promise
+	// that everything in the library is encrypted
+	if library.Encrypted {
+		apierror.Respond(c, http.StatusBadRequest, "encrypted_not_supported", "Encrypted libraries can't import files in place")
+		return
+	}
+	if library.ReadOnly {
+		apierror.Respond(c, http.StatusForbidden, "library_read_only", "Library is read-only")
+		return
+	}
+	if isRelocating(library.ID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
+		return
+	}
+
+	job, err := h.jobs.SubmitFor(library.TenantID, "library_scan", func(ctx context.Context, job *jobs.Job) error {
+		return h.scanLibrary(ctx, job, &library)
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule scan job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// scanLibrary walks a library's images directory, importing unknown files,
+// and finishes with a summary result
+func (h *PhotoHandler) scanLibrary(ctx context.Context, job *jobs.Job, library *models.Library) error {
+	files, err := scanCandidates(library.Images)
+	if err != nil {
+		return fmt.Errorf("failed to list images directory: %w", err)
+	}
+
+	// Trashed photos still own their files
+	var known []string
+	if err := h.db.Unscoped().Model(&models.Photo{}).Where("library_id = ?", library.ID).Pluck("file_path", &known).Error; err != nil {
+		return err
+	}
+	knownPaths := make(map[string]bool, len(known))
+	for _, path := range known {
+		knownPaths[filepath.Clean(path)] = true
+	}
+
+	// One unit per file plus the final summary result
+	job.SetTotal(len(files) + 1)
+
+	var imported, skipped, unsupported int
+	failed := []scanFailure{}
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if knownPaths[path] {
+			skipped++
+		} else {
+			_, err := h.importFile(library, path)
+			switch {
+			case err == nil:
+				imported++
+			case err == errAlreadyImported:
+				skipped++
+			case err == errUnsupportedFile:
+				unsupported++
+			default:
+				rel, _ := filepath.Rel(library.Images, path)
+				failed = append(failed, scanFailure{Path: rel, Error: err.Error()})
+			}
+		}
+		job.Advance(1)
+	}
+
+	job.AddResult(map[string]interface{}{
+		"files":       len(files),
+		"imported":    imported,
+		"skipped":     skipped,
+		"unsupported": unsupported,
+		"failed":      failed,
+	})
+	return nil
+}
+
+// scanCandidates lists the regular files under dir that could be photos,
+// leaving out hidden files and directories (such as cached thumbnails) and
+// XMP sidecars
+func scanCandidates(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && !strings.EqualFold(filepath.Ext(path), ".xmp") {
+			files = append(files, filepath.Clean(path))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// importFile registers a file already in a library's images directory as a
+// photo, reading its type, dimensions and embedded metadata as an upload
+// would. The file is left where it is.
+func (h *PhotoHandler) importFile(library *models.Library, path string) (*models.Photo, error) {
+	db := tenant.Scope(h.db, library.TenantID)
+
+	var count int64
+	if err := db.Unscoped().Model(&models.Photo{}).Where("library_id = ? AND file_path = ?", library.ID, path).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errAlreadyImported
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > h.config.MaxFileSize {
+		return nil, fmt.Errorf("file exceeds maximum allowed size of %d bytes", h.config.MaxFileSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := http.DetectContentType(data)
+	if mimeType == "application/octet-stream" {
+		mimeType = scanTypesByExtension[strings.ToLower(filepath.Ext(path))]
+	}
+	rawFormat, isRaw := raw.FormatOf(path)
+	if isRaw {
+		mimeType = rawFormat.MimeType
+	}
+	if mimeType == documents.MimeType {
+		if !library.AcceptDocuments {
+			return nil, errUnsupportedFile
+		}
+	} else if !h.isValidImageType(mimeType) {
+		return nil, errUnsupportedFile
+	}
+
+	rel, err := filepath.Rel(library.Images, path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	photo := models.Photo{
+		Filename:     rel,
+		OriginalName: filepath.Base(path),
+		FilePath:     path,
+		MimeType:     mimeType,
+		FileSize:     info.Size(),
+		Checksum:     checksum,
+		LibraryID:    library.ID,
+		TenantID:     library.TenantID,
+		RawFormat:    rawFormat.Name,
+		UploadedAt:   time.Now(),
+	}
+
+	// Dimensions, capture time, position and the like, as a rescan reads them
+	fileMetadata := map[string]interface{}{}
+	refreshFileMetadata(data, checksum, fileMetadata)
+	delete(fileMetadata, "mime_type") // Already settled above
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&photo).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Photo{}).Where("id = ?", photo.ID).Updates(fileMetadata).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save photo metadata: %w", err)
+	}
+	if err := db.First(&photo, photo.ID).Error; err != nil {
+		return nil, err
+	}
+
+	if library.ImportKeywords {
+		h.importKeywords(&photo, data)
+	}
+	h.prepareThumbnails(&photo, library)
+
+	return &photo, nil
+}
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ShareHandler manages shared album links and serves the galleries they
+// open to viewers without an API key
+type ShareHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	photos *PhotoHandler // Serves the shared files
+}
+
+// NewShareHandler creates a new share handler
+func NewShareHandler(db *gorm.DB, cfg *config.Config, photos *PhotoHandler) *ShareHandler {
+	return &ShareHandler{db: db, config: cfg, photos: photos}
+}
+
+// SharePasswordHeader carries the password of a protected share for API
+// clients, browsers unlock shares with a form instead
+const SharePasswordHeader = "X-Share-Password"
+
+// shareCookie remembers that a browser unlocked a protected share. It is
+// limited to the share's path, so each share has its own.
+const shareCookie = "share_access"
+
+var (
+	errShareNotFound         = &photoOpError{http.StatusNotFound, "share_not_found", "Share not found"}
+	errShareExpired          = &photoOpError{http.StatusGone, "share_expired", "Share has expired"}
+	errSharePasswordRequired = &photoOpError{http.StatusUnauthorized, "share_password_required", "This share is password protected"}
+	errSharePasswordInvalid  = &photoOpError{http.StatusUnauthorized, "share_password_invalid", "Wrong password"}
+)
+
+// createShareRequest is the optional JSON body of CreateShare
+type createShareRequest struct {
+	Password  string     `json:"password" binding:"omitempty,min=4,max=72"` // bcrypt only reads 72 bytes
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateShare creates a link to an album's gallery that works without an
+// API key, optionally protected by a password and expiring
+func (h *ShareHandler) CreateShare(c *gin.Context) {
+	album, ok := h.findAlbum(c)
+	if !ok {
+		return
+	}
+
+	var req createShareRequest
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+			respondValidationError(c, err)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "expires_at must be in the future")
+		return
+	}
+
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate share token")
+		return
+	}
+	share := models.AlbumShare{
+		AlbumID:   album.ID,
+		Token:     base64.RawURLEncoding.EncodeToString(token),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to hash share password")
+			return
+		}
+		share.PasswordHash = string(hash)
+	}
+
+	if err := scopedDB(c, h.db).Create(&share).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create share")
+		return
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+// GetShares returns the shares of an album, expired ones included
+func (h *ShareHandler) GetShares(c *gin.Context) {
+	album, ok := h.findAlbum(c)
+	if !ok {
+		return
+	}
+
+	shares := []models.AlbumShare{}
+	if err := scopedDB(c, h.db).Where("album_id = ?", album.ID).Order("created_at").Find(&shares).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch shares")
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+// DeleteShare revokes a share, its link stops working at once
+func (h *ShareHandler) DeleteShare(c *gin.Context) {
+	album, ok := h.findAlbum(c)
+	if !ok {
+		return
+	}
+
+	shareID, err := uuid.Parse(c.Param("share_id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_share_id", "Invalid share ID")
+		return
+	}
+
+	result := scopedDB(c, h.db).Where("album_id = ?", album.ID).Delete(&models.AlbumShare{}, shareID)
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete share")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondPhotoOpError(c, errShareNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share deleted successfully"})
+}
+
+// findAlbum loads the album of the request's :id, answering the request
+// when it can't
+func (h *ShareHandler) findAlbum(c *gin.Context) (*models.Album, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return nil, false
+	}
+
+	var album models.Album
+	if err := scopedDB(c, h.db).First(&album, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return nil, false
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album")
+		return nil, false
+	}
+	return &album, true
+}
+
+// sharedAlbum is what viewers of a share see of its album
+type sharedAlbum struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	StartDate   *time.Time `json:"start_date"`
+	EndDate     *time.Time `json:"end_date"`
+	ExpiresAt   *time.Time `json:"expires_at"` // When the share stops working
+}
+
+// sharedPhoto is what viewers of a share see of a photo, with URLs under
+// the share's
+type sharedPhoto struct {
+	ID           uuid.UUID  `json:"id"`
+	Title        string     `json:"title"`
+	Caption      string     `json:"caption"`
+	MimeType     string     `json:"mime_type"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	TakenAt      *time.Time `json:"taken_at"`
+	FileURL      string     `json:"file_url"`
+	ThumbnailURL string     `json:"thumbnail_url"` // Add size=small|medium to choose a rendition
+}
+
+// GetSharedAlbum returns the album of a share with a page of its photos, in
+// the album's sort mode. Protected shares need the password in the
+// X-Share-Password header, or the cookie of an unlocked gallery.
+func (h *ShareHandler) GetSharedAlbum(c *gin.Context) {
+	share, album, err := h.openShare(c)
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	page, limit := pagination(c)
+	photos, total, err := h.sharedPhotos(c, share, album, page, limit)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"album":  sharedAlbumOf(share, album),
+		"photos": photos,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// ServeSharedPhoto serves the file of a photo in a shared album
+func (h *ShareHandler) ServeSharedPhoto(c *gin.Context) {
+	if h.openSharedPhoto(c) {
+		h.photos.ServePhoto(c)
+	}
+}
+
+// ServeSharedThumbnail serves a rendition of a photo in a shared album
+func (h *ShareHandler) ServeSharedThumbnail(c *gin.Context) {
+	if h.openSharedPhoto(c) {
+		h.photos.ServeThumbnail(c)
+	}
+}
+
+// openSharedPhoto checks that the request may see photo :id of a shared
+// album, answering the request when it may not
+func (h *ShareHandler) openSharedPhoto(c *gin.Context) bool {
+	_, album, err := h.openShare(c)
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return false
+	}
+
+	var count int64
+	if err := scopedDB(c, h.db).Model(&models.Photo{}).
+		Joins("JOIN album_photos ON album_photos.photo_id = photos.id").
+		Where("album_photos.album_id = ? AND photos.id = ?", album.ID, id).
+		Count(&count).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return false
+	}
+	if count == 0 {
+		apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+		return false
+	}
+	return true
+}
+
+// GetGallery serves the HTML gallery of a share, or the password form of a
+// protected share that wasn't unlocked yet
+func (h *ShareHandler) GetGallery(c *gin.Context) {
+	share, album, err := h.openShare(c)
+	if err == errSharePasswordRequired || err == errSharePasswordInvalid {
+		renderSharePage(c, http.StatusUnauthorized, "password", gin.H{"Action": share.URL})
+		return
+	}
+	if err != nil {
+		renderShareError(c, err)
+		return
+	}
+
+	page, limit := pagination(c)
+	photos, total, err := h.sharedPhotos(c, share, album, page, limit)
+	if err != nil {
+		renderShareError(c, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album photos"})
+		return
+	}
+
+	data := gin.H{"Album": sharedAlbumOf(share, album), "Photos": photos}
+	if page > 1 {
+		data["PreviousURL"] = fmt.Sprintf("%s?page=%d&limit=%d", share.URL, page-1, limit)
+	}
+	if int64(page*limit) < total {
+		data["NextURL"] = fmt.Sprintf("%s?page=%d&limit=%d", share.URL, page+1, limit)
+	}
+	renderSharePage(c, http.StatusOK, "gallery", data)
+}
+
+// UnlockShare checks the password posted by a share's password form and
+// remembers it in a cookie, then sends the browser back to the gallery
+func (h *ShareHandler) UnlockShare(c *gin.Context) {
+	share, err := h.findShare(c)
+	if err != nil {
+		renderShareError(c, err)
+		return
+	}
+
+	if share.PasswordHash != "" {
+		if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(c.PostForm("password"))) != nil {
+			renderSharePage(c, http.StatusUnauthorized, "password", gin.H{"Action": share.URL, "Error": errSharePasswordInvalid.message})
+			return
+		}
+
+		// A session cookie, unless the share expires first
+		maxAge := 0
+		if share.ExpiresAt != nil {
+			maxAge = int(time.Until(*share.ExpiresAt).Seconds()) + 1
+		}
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(shareCookie, shareAccess(share), maxAge, share.URL, "", c.Request.TLS != nil, true)
+	}
+
+	c.Redirect(http.StatusSeeOther, share.URL)
+}
+
+// findShare looks up the share of the request's :token and scopes the
+// request to the share's tenant, since viewers name none
+func (h *ShareHandler) findShare(c *gin.Context) (*models.AlbumShare, error) {
+	var share models.AlbumShare
+	if err := h.db.Where("token = ?", c.Param("token")).First(&share).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errShareNotFound
+		}
+		return nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch share"}
+	}
+	if share.ExpiresAt != nil && !share.ExpiresAt.After(time.Now()) {
+		return nil, errShareExpired
+	}
+
+	c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), share.TenantID))
+	return &share, nil
+}
+
+// openShare looks up the share of the request and its album, checking the
+// password of protected shares. The share is returned with password errors,
+// so the form can be shown.
+func (h *ShareHandler) openShare(c *gin.Context) (*models.AlbumShare, *models.Album, error) {
+	share, err := h.findShare(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if share.PasswordHash != "" {
+		cookie, _ := c.Cookie(shareCookie)
+		password := c.GetHeader(SharePasswordHeader)
+		switch {
+		case subtle.ConstantTimeCompare([]byte(cookie), []byte(shareAccess(share))) == 1:
+		case password == "":
+			return share, nil, errSharePasswordRequired
+		case bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil:
+			return share, nil, errSharePasswordInvalid
+		}
+	}
+
+	var album models.Album
+	if err := scopedDB(c, h.db).First(&album, share.AlbumID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, errShareNotFound
+		}
+		return nil, nil, &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch album"}
+	}
+	return share, &album, nil
+}
+
+// shareAccess is the cookie value proving a protected share was unlocked.
+// It changes with the password hash, so it can't be guessed from the token.
+func shareAccess(share *models.AlbumShare) string {
+	sum := sha256.Sum256([]byte(share.Token + ":" + share.PasswordHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// sharedPhotos returns a page of a shared album's photos, in the album's
+// sort mode, and how many it has
+func (h *ShareHandler) sharedPhotos(c *gin.Context, share *models.AlbumShare, album *models.Album, page, limit int) ([]sharedPhoto, int64, error) {
+	inAlbum := func() *gorm.DB {
+		return scopedDB(c, h.db).Model(&models.Photo{}).
+			Joins("JOIN album_photos ON album_photos.photo_id = photos.id").
+			Where("album_photos.album_id = ?", album.ID)
+	}
+
+	var photos []models.Photo
+	if err := inAlbum().
+		Order(albumSortOrder(*album)).
+		Order("photos.id").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&photos).Error; err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := inAlbum().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	shared := make([]sharedPhoto, 0, len(photos))
+	for _, photo := range photos {
+		base := share.URL + "/photos/" + photo.ID.String()
+		shared = append(shared, sharedPhoto{
+			ID:           photo.ID,
+			Title:        photo.Title,
+			Caption:      photo.Caption,
+			MimeType:     photo.MimeType,
+			Width:        photo.Width,
+			Height:       photo.Height,
+			TakenAt:      photo.TakenAt,
+			FileURL:      base + "/file",
+			ThumbnailURL: base + "/thumbnail",
+		})
+	}
+	return shared, total, nil
+}
+
+// sharedAlbumOf returns what viewers of share see of album
+func sharedAlbumOf(share *models.AlbumShare, album *models.Album) sharedAlbum {
+	return sharedAlbum{
+		Name:        album.Name,
+		Description: album.Description,
+		StartDate:   album.StartDate,
+		EndDate:     album.EndDate,
+		ExpiresAt:   share.ExpiresAt,
+	}
+}
+
+// sharePages are the HTML pages of shared galleries. They are kept plain,
+// with no scripts, so they work in any browser.
+var sharePages = template.Must(template.New("share").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <meta name="robots" content="noindex">
+  <title>{{.}}</title>
+  <style>
+    body { font-family: sans-serif; margin: 2rem auto; max-width: 80rem; padding: 0 1rem; }
+    .photos { display: grid; grid-template-columns: repeat(auto-fill, minmax(12rem, 1fr)); gap: 0.5rem; }
+    .photos img { width: 100%; height: 12rem; object-fit: cover; display: block; }
+    .photos figcaption { font-size: 0.875rem; }
+    .error { color: #b00020; }
+  </style>
+</head>
+<body>
+{{end}}
+
+{{define "gallery"}}{{template "head" .Album.Name}}
+  <h1>{{.Album.Name}}</h1>
+  {{with .Album.Description}}<p>{{.}}</p>{{end}}
+  <div class="photos">
+  {{- range .Photos}}
+    <figure>
+      <a href="{{.FileURL}}"><img src="{{.ThumbnailURL}}" alt="{{.Title}}" loading="lazy"></a>
+      {{with .Caption}}<figcaption>{{.}}</figcaption>{{end}}
+    </figure>
+  {{- else}}
+    <p>This album is empty.</p>
+  {{- end}}
+  </div>
+  <p>{{with .PreviousURL}}<a href="{{.}}">Previous</a>{{end}} {{with .NextURL}}<a href="{{.}}">Next</a>{{end}}</p>
+</body>
+</html>
+{{end}}
+
+{{define "password"}}{{template "head" "Password required"}}
+  <h1>Password required</h1>
+  {{with .Error}}<p class="error">{{.}}</p>{{end}}
+  <form method="post" action="{{.Action}}">
+    <input type="password" name="password" autofocus required>
+    <button type="submit">View album</button>
+  </form>
+</body>
+</html>
+{{end}}
+
+{{define "message"}}{{template "head" .Message}}
+  <h1>{{.Message}}</h1>
+</body>
+</html>
+{{end}}
+`))
+
+// renderSharePage writes one of sharePages
+func renderSharePage(c *gin.Context, status int, page string, data gin.H) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	if err := sharePages.ExecuteTemplate(c.Writer, page, data); err != nil {
+		c.Error(err)
+	}
+}
+
+// renderShareError writes the page for a share that can't be viewed
+func renderShareError(c *gin.Context, err error) {
+	opErr, ok := err.(*photoOpError)
+	if !ok {
+		opErr = &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, err.Error()}
+	}
+	renderSharePage(c, opErr.status, "message", gin.H{"Message": opErr.message})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/jobs"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"photo-library-server/thumbnails"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Most bits the perceptual hashes of similar photos differ in by default.
+// Shots of a burst are usually within 10, unrelated photos around 32.
+const defaultSimilarThreshold = 10
+
+// similarPhoto is a photo found to look like another, with how different it is
+type similarPhoto struct {
+	models.Photo
+	Distance int `json:"distance"` // Bits the perceptual hashes differ in, 0 looks the same
+}
+
+// MarshalJSON adds distance to the photo's fields, since the promoted
+// models.Photo marshaler would otherwise drop it
+func (p similarPhoto) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(p.Photo)
+	if err != nil {
+		return nil, err
+	}
+	return append(data[:len(data)-1], fmt.Sprintf(`,"distance":%d}`, p.Distance)...), nil
+}
+
+// GetSimilarPhotos returns the photos that look like a photo, most similar
+// first, such as the other shots of a burst. Candidates can be narrowed with
+// the filters of GET /photos, library_id to search within one library.
+func (h *PhotoHandler) GetSimilarPhotos(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	threshold := defaultSimilarThreshold
+	if value := c.Query("threshold"); value != "" {
+		threshold, err = strconv.Atoi(value)
+		if err != nil || threshold < 0 || threshold > thumbnails.MaxHashDistance {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation,
+				fmt.Sprintf("Invalid threshold, expected 0 to %d", thumbnails.MaxHashDistance))
+			return
+		}
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	// Photos uploaded before hashing, or videos, are hashed on first use
+	if photo.PerceptualHash == "" {
+		if err := storePerceptualHash(h.db, h.config, &photo); err != nil {
+			if err == thumbnails.ErrUnsupported {
+				apierror.Respond(c, http.StatusUnprocessableEntity, "similarity_not_supported", "Similar photos can't be found for this file type")
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to hash photo")
+			return
+		}
+	}
+	hash, err := thumbnails.ParseHash(photo.PerceptualHash)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to hash photo")
+		return
+	}
+
+	query, err := filterPhotos(c, h.config, scopedDB(c, h.db).Model(&models.Photo{}).
+		Where("photos.perceptual_hash <> '' AND photos.id <> ?", photo.ID))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	// Hamming distances aren't something databases index, so the hashes are
+	// compared here. They are small enough for libraries of many photos.
+	var candidates []struct {
+		ID             uuid.UUID
+		PerceptualHash string
+	}
+	if err := query.Select("photos.id", "photos.perceptual_hash").Scan(&candidates).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photos")
+		return
+	}
+
+	var matches []similarPhoto
+	for _, candidate := range candidates {
+		other, err := thumbnails.ParseHash(candidate.PerceptualHash)
+		if err != nil {
+			continue
+		}
+		if distance := hash.Distance(other); distance <= threshold {
+			matches = append(matches, similarPhoto{Photo: models.Photo{ID: candidate.ID}, Distance: distance})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID.String() < matches[j].ID.String()
+	})
+
+	page, limit := pagination(c)
+	pageMatches := []similarPhoto{}
+	if start := (page - 1) * limit; start < len(matches) {
+		pageMatches = matches[start:min(start+limit, len(matches))]
+	}
+
+	if len(pageMatches) > 0 {
+		ids := make([]uuid.UUID, len(pageMatches))
+		for i, match := range pageMatches {
+			ids[i] = match.ID
+		}
+		var photos []models.Photo
+		if err := preloadPhotoRelations(c, scopedDB(c, h.db)).Where("id IN ?", ids).Find(&photos).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photos")
+			return
+		}
+		byID := make(map[uuid.UUID]models.Photo, len(photos))
+		for _, found := range photos {
+			byID[found.ID] = found
+		}
+		for i := range pageMatches {
+			pageMatches[i].Photo = byID[pageMatches[i].ID]
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"photo_id":  photo.ID,
+		"threshold": threshold,
+		"photos":    pageMatches,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": len(matches),
+		},
+	})
+}
+
+// hashResult is the per-photo outcome of a perceptual hash job
+type hashResult struct {
+	PhotoID uuid.UUID `json:"photo_id"`
+	Status  string    `json:"status"` // "hashed", "skipped" (a type that can't be rendered) or "failed"
+	Error   string    `json:"error,omitempty"`
+}
+
+// HashPhotos queues a job computing the perceptual hashes of photos that
+// lack one, such as photos uploaded before similarity search and videos
+func (h *PhotoHandler) HashPhotos(c *gin.Context) {
+	tenantID := requestTenant(c)
+	job, err := h.jobs.SubmitFor(tenantID, "perceptual_hash", func(ctx context.Context, job *jobs.Job) error {
+		var photos []models.Photo
+		if err := tenant.Scope(h.db, tenantID).
+			Select("id", "tenant_id", "file_path", "encrypted", "perceptual_hash").
+			Where("perceptual_hash = ''").
+			Find(&photos).Error; err != nil {
+			return fmt.Errorf("failed to find photos to hash: %w", err)
+		}
+
+		job.SetTotal(len(photos))
+		for _, photo := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			result := hashResult{PhotoID: photo.ID, Status: "hashed"}
+			switch err := storePerceptualHash(tenant.Scope(h.db, photo.TenantID), h.config, &photo); {
+			case err == thumbnails.ErrUnsupported:
+				result.Status = "skipped"
+			case err != nil:
+				result.Status, result.Error = "failed", err.Error()
+			}
+			job.AddResult(result)
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule hash job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// storePerceptualHash computes and saves the perceptual hash of a photo.
+// Videos are hashed by their poster frame, documents by their first page.
+func storePerceptualHash(db *gorm.DB, cfg *config.Config, photo *models.Photo) error {
+	var hash thumbnails.Hash
+	var err error
+	if photo.Encrypted {
+		var data []byte
+		if data, err = readOriginal(cfg, photo); err == nil {
+			hash, err = thumbnails.HashData(data)
+		}
+	} else {
+		hash, err = thumbnails.HashFile(photo.FilePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	photo.PerceptualHash = hash.String()
+	return db.Model(&models.Photo{}).Where("id = ?", photo.ID).
+		Update("perceptual_hash", photo.PerceptualHash).Error
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/jobs"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"photo-library-server/thumbnails"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StorageHandler handles storage tiering and capacity HTTP requests
+type StorageHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	jobs   *jobs.Manager
+
+	alertMu sync.Mutex
+	alerted map[string]int // Highest capacity threshold alerted per volume
+}
+
+// NewStorageHandler creates a new storage handler
+func NewStorageHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager) *StorageHandler {
+	return &StorageHandler{db: db, config: cfg, jobs: jobManager, alerted: map[string]int{}}
+}
+
+// tieringResult is the per-photo outcome of a tiering job
+type tieringResult struct {
+	PhotoID uuid.UUID `json:"photo_id"`
+	Status  string    `json:"status"` // "moved" or "failed"
+	Code    string    `json:"code,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// storageTierRequest is the JSON body of SetPhotoTier
+type storageTierRequest struct {
+	StorageTier string `json:"storage_tier" binding:"required,oneof=hot cold"`
+}
+
+// SetPhotoTier moves a photo's original between hot and cold storage
+func (h *StorageHandler) SetPhotoTier(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var req storageTierRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	if req.StorageTier == models.StorageTierCold && h.config.ColdStoragePath == "" {
+		apierror.Respond(c, http.StatusBadRequest, "cold_storage_not_configured", "Cold storage is not configured")
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).Preload("Library").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if photo.StorageTier != req.StorageTier {
+		if err := h.moveToTier(&photo, req.StorageTier); err != nil {
+			respondPhotoOpError(c, err)
+			return
+		}
+	}
+
+	scopedDB(c, h.db).Preload("Library").Preload("Tags").First(&photo, photo.ID)
+
+	c.JSON(http.StatusOK, photo)
+}
+
+// RunTiering queues a pass that moves old originals to cold storage
+func (h *StorageHandler) RunTiering(c *gin.Context) {
+	if !h.tieringEnabled() {
+		apierror.Respond(c, http.StatusBadRequest, "cold_storage_not_configured", "Cold storage is not configured")
+		return
+	}
+
+	job, err := h.SubmitTiering(requestTenant(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule tiering job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// SubmitTiering queues a background job moving hot originals uploaded more
+// than ColdStorageAfterMonths ago to cold storage. A tenant's pass only moves
+// that tenant's photos, an empty tenant covers all of them.
+func (h *StorageHandler) SubmitTiering(tenantID string) (*jobs.Job, error) {
+	return h.jobs.SubmitFor(tenantID, "storage_tiering", func(ctx context.Context, job *jobs.Job) error {
+		cutoff := time.Now().AddDate(0, -h.config.ColdStorageAfterMonths, 0)
+
+		var photos []models.Photo
+		if err := tenant.Scope(h.db, tenantID).Preload("Library").
+			Where("storage_tier = ? AND uploaded_at < ?", models.StorageTierHot, cutoff).
+			Find(&photos).Error; err != nil {
+			return fmt.Errorf("failed to find photos to move: %w", err)
+		}
+
+		job.SetTotal(len(photos))
+		for i := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			result := tieringResult{PhotoID: photos[i].ID, Status: "moved"}
+			if err := h.moveToTier(&photos[i], models.StorageTierCold); err != nil {
+				result.Status = "failed"
+				result.Code, result.Error = errorCode(err), err.Error()
+			}
+			job.AddResult(result)
+		}
+		return nil
+	})
+}
+
+// StartTieringScheduler runs SubmitTiering every interval until the returned
+// stop function is called. It does nothing if tiering is not configured.
+func (h *StorageHandler) StartTieringScheduler(interval time.Duration) (stop func()) {
+	if !h.tieringEnabled() || interval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := h.SubmitTiering(""); err != nil {
+					slog.Warn("Failed to schedule storage tiering", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// Helper methods
+
+func (h *StorageHandler) tieringEnabled() bool {
+	return h.config.ColdStoragePath != "" && h.config.ColdStorageAfterMonths > 0
+}
+
+// moveToTier relocates a photo's original (and XMP sidecar) to the given tier
+// and records the new location. photo must have its Library preloaded.
+func (h *StorageHandler) moveToTier(photo *models.Photo, tier string) error {
+	if isRelocating(photo.LibraryID) {
+		return &photoOpError{http.StatusConflict, "library_relocating", "Library is being relocated, try again later"}
+	}
+
+	var dst string
+	switch tier {
+	case models.StorageTierCold:
+		dst = filepath.Join(h.config.ColdStoragePath, photo.LibraryID.String(), photo.Filename)
+	default:
+		dst = filepath.Join(photo.Library.Images, photo.Filename)
+	}
+
+	src := photo.FilePath
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return &photoOpError{http.StatusNotFound, "photo_file_not_found", "Photo file not found"}
+	}
+
+	// Render thumbnails before the original goes cold so they can keep being
+	// served from the library directory without touching slow storage.
+	// Renditions of encrypted photos are never cached.
+	if tier == models.StorageTierCold && !photo.Encrypted {
+		if err := thumbnails.GenerateAll(photo.Library.Images, src); err != nil && err != thumbnails.ErrUnsupported {
+			slog.Warn("Failed to generate thumbnails", "path", src, "error", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to create storage directory"}
+	}
+
+	if err := moveFile(src, dst); err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to move photo file"}
+	}
+
+	if err := h.db.Model(photo).Updates(map[string]interface{}{
+		"file_path":    dst,
+		"storage_tier": tier,
+	}).Error; err != nil {
+		moveFile(dst, src) // Put the file back so the record stays accurate
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to update photo storage tier"}
+	}
+
+	// The sidecar follows the original; a failure here only loses metadata
+	if _, err := os.Stat(metadata.SidecarPath(src)); err == nil {
+		if err := moveFile(metadata.SidecarPath(src), metadata.SidecarPath(dst)); err != nil {
+			slog.Warn("Failed to move sidecar", "path", src, "error", err)
+		}
+	}
+
+	photo.FilePath = dst
+	photo.StorageTier = tier
+	return nil
+}
+
+// moveFile renames src to dst, falling back to copy and delete when they are
+// on different filesystems. The modification time is preserved so cached
+// thumbnails stay valid.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
+		destFile.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := destFile.Sync(); err != nil {
+		destFile.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := destFile.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	return os.Remove(src)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"photo-library-server/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// findTagByName returns the tag named name, or the tag name is an alias of.
+// name must already be normalized.
+func findTagByName(db *gorm.DB, name string) (models.Tag, error) {
+	var tag models.Tag
+	err := db.Where("name = ?", name).First(&tag).Error
+	if err != gorm.ErrRecordNotFound {
+		return tag, err
+	}
+
+	var alias models.TagAlias
+	if err := db.Where("name = ?", name).First(&alias).Error; err != nil {
+		return tag, err
+	}
+	return tag, db.First(&tag, alias.TagID).Error
+}
+
+// whereTagName limits a query joined with tags to the tag named name, or the
+// tag name is an alias of
+func whereTagName(query *gorm.DB, cfg *config.Config, name string) *gorm.DB {
+	return repository.WhereTagName(query, tagNamePolicy(cfg).Normalize(name))
+}
+
+// checkTagNameFree returns an error if a tag or an alias, other than the alias
+// except, already has name. Tag and alias names share one namespace so each
+// name resolves to one tag.
+func checkTagNameFree(ctx context.Context, tags repository.TagRepo, name string, except uuid.UUID) error {
+	taken, err := tags.NameTaken(ctx, name, uuid.Nil)
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to check tag names"}
+	}
+	if taken {
+		return &photoOpError{http.StatusConflict, "duplicate_tag", "Tag with this name already exists"}
+	}
+
+	taken, err = tags.AliasTaken(ctx, name, except)
+	if err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to check tag names"}
+	}
+	if taken {
+		return &photoOpError{http.StatusConflict, "duplicate_tag_alias", "Tag alias with this name already exists"}
+	}
+	return nil
+}
+
+// tagAliasRequest is the JSON body of CreateTagAlias and UpdateTagAlias
+type tagAliasRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=50"`
+}
+
+// GetTagAliases returns the aliases of a tag, by name
+func (h *TagHandler) GetTagAliases(c *gin.Context) {
+	tagID := c.Param("id")
+
+	id, err := uuid.Parse(tagID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
+		return
+	}
+
+	var tag models.Tag
+	if err := scopedDB(c, h.db).First(&tag, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
+		return
+	}
+
+	aliases := []models.TagAlias{}
+	if err := scopedDB(c, h.db).Where("tag_id = ?", tag.ID).Order("name").Find(&aliases).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag aliases")
+		return
+	}
+
+	c.JSON(http.StatusOK, aliases)
+}
+
+// CreateTagAlias adds an alternative name for a tag
+func (h *TagHandler) CreateTagAlias(c *gin.Context) {
+	tagID := c.Param("id")
+
+	id, err := uuid.Parse(tagID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
+		return
+	}
+
+	var req tagAliasRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	req.Name = tagNamePolicy(h.config).Normalize(req.Name)
+	if req.Name == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "name is required")
+		return
+	}
+
+	var tag models.Tag
+	if err := scopedDB(c, h.db).First(&tag, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
+		return
+	}
+
+	if err := checkTagNameFree(c.Request.Context(), h.tags, req.Name, uuid.Nil); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	alias := models.TagAlias{
+		TagID: tag.ID,
+		Name:  req.Name,
+	}
+
+	if err := scopedDB(c, h.db).Create(&alias).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create tag alias")
+		return
+	}
+
+	c.JSON(http.StatusCreated, alias)
+}
+
+// UpdateTagAlias renames an alias of a tag
+func (h *TagHandler) UpdateTagAlias(c *gin.Context) {
+	tagID := c.Param("id")
+	aliasID := c.Param("alias_id")
+
+	tagUUID, err := uuid.Parse(tagID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
+		return
+	}
+
+	aliasUUID, err := uuid.Parse(aliasID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_alias_id", "Invalid tag alias ID")
+		return
+	}
+
+	var req tagAliasRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	req.Name = tagNamePolicy(h.config).Normalize(req.Name)
+	if req.Name == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "name is required")
+		return
+	}
+
+	var alias models.TagAlias
+	if err := scopedDB(c, h.db).Where("tag_id = ?", tagUUID).First(&alias, aliasUUID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "tag_alias_not_found", "Tag alias not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag alias")
+		return
+	}
+
+	if err := checkTagNameFree(c.Request.Context(), h.tags, req.Name, alias.ID); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	alias.Name = req.Name
+	if err := scopedDB(c, h.db).Save(&alias).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update tag alias")
+		return
+	}
+
+	c.JSON(http.StatusOK, alias)
+}
+
+// DeleteTagAlias removes an alias of a tag
+func (h *TagHandler) DeleteTagAlias(c *gin.Context) {
+	tagID := c.Param("id")
+	aliasID := c.Param("alias_id")
+
+	tagUUID, err := uuid.Parse(tagID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
+		return
+	}
+
+	aliasUUID, err := uuid.Parse(aliasID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_alias_id", "Invalid tag alias ID")
+		return
+	}
+
+	result := scopedDB(c, h.db).Where("tag_id = ? AND id = ?", tagUUID, aliasUUID).Delete(&models.TagAlias{})
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete tag alias")
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, "tag_alias_not_found", "Tag alias not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag alias deleted successfully"})
+}
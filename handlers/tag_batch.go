@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// batchTagsRequest is the JSON body of BatchTags
+type batchTagsRequest struct {
+	PhotoIDs []uuid.UUID `json:"photo_ids" binding:"required,min=1,max=1000"`
+	Add      []string    `json:"add" binding:"omitempty,max=50,dive,max=50"`    // Tag names or aliases, created when missing
+	Remove   []string    `json:"remove" binding:"omitempty,max=50,dive,max=50"` // Tag names or aliases, unknown ones are ignored
+}
+
+// BatchTags adds and removes tags on many photos in one transaction, such as
+// tagging a whole shoot. Tags to add that don't exist yet are created.
+// Either every photo is changed or, when one is missing or read-only, none.
+func (h *TagHandler) BatchTags(c *gin.Context) {
+	var req batchTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "add or remove is required")
+		return
+	}
+
+	policy := tagNamePolicy(h.config)
+	normalize := func(names []string) ([]string, bool) {
+		seen := make(map[string]bool)
+		var normalized []string
+		for _, name := range names {
+			name = policy.Normalize(name)
+			if name == "" {
+				return nil, false
+			}
+			if !seen[name] {
+				seen[name] = true
+				normalized = append(normalized, name)
+			}
+		}
+		return normalized, true
+	}
+	add, ok := normalize(req.Add)
+	if !ok {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Tag names can't be empty")
+		return
+	}
+	remove, ok := normalize(req.Remove)
+	if !ok {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Tag names can't be empty")
+		return
+	}
+
+	// Drop duplicate IDs
+	seen := make(map[uuid.UUID]bool)
+	var photoIDs []uuid.UUID
+	for _, photoID := range req.PhotoIDs {
+		if !seen[photoID] {
+			seen[photoID] = true
+			photoIDs = append(photoIDs, photoID)
+		}
+	}
+
+	var photos []models.Photo
+	if err := scopedDB(c, h.db).Select("id", "library_id").Where("id IN ?", photoIDs).Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify photos")
+		return
+	}
+	found := make(map[uuid.UUID]bool)
+	libraryIDs := make(map[uuid.UUID]bool)
+	for _, photo := range photos {
+		found[photo.ID] = true
+		libraryIDs[photo.LibraryID] = true
+	}
+	missing := []uuid.UUID{}
+	for _, photoID := range photoIDs {
+		if !found[photoID] {
+			missing = append(missing, photoID)
+		}
+	}
+	if len(missing) > 0 {
+		apierror.RespondWithDetails(c, http.StatusNotFound, "photo_not_found", "Photo not found", gin.H{"photo_ids": missing})
+		return
+	}
+	for libraryID := range libraryIDs {
+		if err := checkWritable(scopedDB(c, h.db), libraryID); err != nil {
+			respondPhotoOpError(c, err)
+			return
+		}
+	}
+
+	var added, removed int64
+	created := []models.Tag{}
+	err := scopedDB(c, h.db).Transaction(func(tx *gorm.DB) error {
+		var addIDs []uuid.UUID
+		for _, name := range add {
+			tag, err := findTagByName(tx, name)
+			if err == gorm.ErrRecordNotFound {
+				tag = models.Tag{Name: name}
+				if err = tx.Create(&tag).Error; err == nil {
+					created = append(created, tag)
+				}
+			}
+			if err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up tags"}
+			}
+			addIDs = append(addIDs, tag.ID)
+		}
+
+		var removeIDs []uuid.UUID
+		for _, name := range remove {
+			tag, err := findTagByName(tx, name)
+			if err == gorm.ErrRecordNotFound {
+				continue // Nothing to remove
+			}
+			if err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up tags"}
+			}
+			for _, id := range addIDs {
+				if id == tag.ID {
+					return &photoOpError{http.StatusBadRequest, apierror.CodeValidation, "A tag can't be both added and removed"}
+				}
+			}
+			removeIDs = append(removeIDs, tag.ID)
+		}
+
+		if len(removeIDs) > 0 {
+			result := tx.Where("photo_id IN ? AND tag_id IN ?", photoIDs, removeIDs).Delete(&models.PhotoTag{})
+			if result.Error != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove tags"}
+			}
+			removed = result.RowsAffected
+		}
+
+		if len(addIDs) > 0 {
+			// Skip photos that already have a tag
+			var existing []models.PhotoTag
+			if err := tx.Select("photo_id", "tag_id").
+				Where("photo_id IN ? AND tag_id IN ?", photoIDs, addIDs).
+				Find(&existing).Error; err != nil {
+				return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to add tags"}
+			}
+			tagged := make(map[[2]uuid.UUID]bool)
+			for _, photoTag := range existing {
+				tagged[[2]uuid.UUID{photoTag.PhotoID, photoTag.TagID}] = true
+			}
+
+			var photoTags []models.PhotoTag
+			for _, photoID := range photoIDs {
+				for _, tagID := range addIDs {
+					if !tagged[[2]uuid.UUID{photoID, tagID}] {
+						photoTags = append(photoTags, models.PhotoTag{PhotoID: photoID, TagID: tagID})
+					}
+				}
+			}
+			if len(photoTags) > 0 {
+				if err := tx.CreateInBatches(&photoTags, 500).Error; err != nil {
+					return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to add tags"}
+				}
+			}
+			added = int64(len(photoTags))
+		}
+		return nil
+	})
+	if err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Photos tagged successfully",
+		"photo_count":  len(photoIDs),
+		"added":        added,
+		"removed":      removed,
+		"created_tags": created,
+	})
+}
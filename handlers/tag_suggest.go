@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Completions returned by default and at most
+const (
+	defaultTagCompletions = 10
+	maxTagCompletions     = 50
+)
+
+// Ranks of completions, prefix matches before fuzzy ones
+const (
+	matchPrefix = iota
+	matchFuzzy
+)
+
+// tagCompletion is a tag offered while typing, with how often it is used
+type tagCompletion struct {
+	models.Tag
+	PhotoCount int64  `json:"photo_count"`
+	Alias      string `json:"alias,omitempty"` // The alias that matched, when the tag's name didn't
+	Match      string `json:"match"`           // "prefix" or "fuzzy"
+
+	rank int
+}
+
+// MarshalJSON adds the completion fields to the tag's, since the promoted
+// models.Tag marshaler would otherwise drop them
+func (t tagCompletion) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(t.Tag)
+	if err != nil {
+		return nil, err
+	}
+	extra, err := json.Marshal(struct {
+		PhotoCount int64  `json:"photo_count"`
+		Alias      string `json:"alias,omitempty"`
+		Match      string `json:"match"`
+	}{t.PhotoCount, t.Alias, t.Match})
+	if err != nil {
+		return nil, err
+	}
+	return append(append(data[:len(data)-1], ','), extra[1:]...), nil
+}
+
+// SuggestTags completes a partly typed tag name (q), for tagging UIs.
+// Tags whose name or an alias starts with q come first, found through the
+// lowercase name indexes; when they are fewer than limit, names containing
+// q or within a typo or two of it follow. Each group is ordered by how many
+// photos have the tag.
+func (h *TagHandler) SuggestTags(c *gin.Context) {
+	q := strings.ToLower(tagNamePolicy(h.config).Normalize(c.Query("q")))
+	if q == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "q is required")
+		return
+	}
+
+	limit := defaultTagCompletions
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxTagCompletions {
+			limit = parsed
+		}
+	}
+
+	db := scopedDB(c, h.db)
+	matches := map[uuid.UUID]*tagCompletion{}
+	add := func(id uuid.UUID, alias string, rank int) {
+		if found, ok := matches[id]; ok && found.rank <= rank {
+			return
+		}
+		matches[id] = &tagCompletion{Tag: models.Tag{ID: id}, Alias: alias, rank: rank}
+	}
+
+	// Ranges rather than LIKE, which neither database can answer from an
+	// index on LOWER(name)
+	upper := q + string(utf8.MaxRune)
+	var named []models.Tag
+	if err := db.Select("id").
+		Where("LOWER(name) >= ? AND LOWER(name) < ?", q, upper).
+		Order("LOWER(name)").Limit(maxTagCompletions).
+		Find(&named).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
+		return
+	}
+	for _, tag := range named {
+		add(tag.ID, "", matchPrefix)
+	}
+	var aliased []models.TagAlias
+	if err := db.Select("tag_id", "name").
+		Where("LOWER(name) >= ? AND LOWER(name) < ?", q, upper).
+		Order("LOWER(name)").Limit(maxTagCompletions).
+		Find(&aliased).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag aliases")
+		return
+	}
+	for _, alias := range aliased {
+		add(alias.TagID, alias.Name, matchPrefix)
+	}
+
+	// Fuzzy matches can't use an index, but a vocabulary of tags is small
+	// enough to scan when there aren't enough prefix matches
+	if len(matches) < limit {
+		var tags []models.Tag
+		var aliases []models.TagAlias
+		if err := db.Select("id", "name").Find(&tags).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
+			return
+		}
+		if err := db.Select("tag_id", "name").Find(&aliases).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag aliases")
+			return
+		}
+		for _, tag := range tags {
+			if rank, ok := matchTagName(q, tag.Name); ok {
+				add(tag.ID, "", rank)
+			}
+		}
+		for _, alias := range aliases {
+			if rank, ok := matchTagName(q, alias.Name); ok {
+				add(alias.TagID, alias.Name, rank)
+			}
+		}
+	}
+
+	completions := []tagCompletion{}
+	if len(matches) > 0 {
+		ids := make([]uuid.UUID, 0, len(matches))
+		for id := range matches {
+			ids = append(ids, id)
+		}
+		if err := loadCompletions(db, ids, matches); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
+			return
+		}
+		for _, match := range matches {
+			if match.Name == "" {
+				continue // Deleted since it matched
+			}
+			match.Match = "prefix"
+			if match.rank == matchFuzzy {
+				match.Match = "fuzzy"
+			}
+			completions = append(completions, *match)
+		}
+	}
+	sort.Slice(completions, func(i, j int) bool {
+		a, b := completions[i], completions[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.PhotoCount != b.PhotoCount {
+			return a.PhotoCount > b.PhotoCount
+		}
+		return a.Name < b.Name
+	})
+	if len(completions) > limit {
+		completions = completions[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query": q,
+		"tags":  completions,
+	})
+}
+
+// loadCompletions fills in the matched tags and how many photos outside the
+// trash have each
+func loadCompletions(db *gorm.DB, ids []uuid.UUID, matches map[uuid.UUID]*tagCompletion) error {
+	var tags []models.Tag
+	if err := db.Where("id IN ?", ids).Find(&tags).Error; err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		matches[tag.ID].Tag = tag
+	}
+
+	var counts []struct {
+		TagID uuid.UUID
+		Count int64
+	}
+	if err := db.Table("photo_tags").
+		Select("photo_tags.tag_id, COUNT(*) AS count").
+		Joins("JOIN photos ON photos.id = photo_tags.photo_id").
+		Where("photo_tags.tag_id IN ? AND photos.deleted_at IS NULL", ids).
+		Group("photo_tags.tag_id").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	for _, count := range counts {
+		matches[count.TagID].PhotoCount = count.Count
+	}
+	return nil
+}
+
+// matchTagName reports whether a tag name completes q. Names starting with
+// q are prefix matches; names containing q, or starting with something a
+// typo away from it (two for long queries), are fuzzy ones.
+func matchTagName(q, name string) (int, bool) {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, q) {
+		return matchPrefix, true
+	}
+	if strings.Contains(name, q) {
+		return matchFuzzy, true
+	}
+
+	query := []rune(q)
+	typos := len(query) / 4
+	if typos == 0 {
+		return 0, false
+	}
+	typos = min(typos, 2)
+
+	// Compare against the start of the name as long as the query, a rune
+	// shorter or longer for a missed or doubled letter
+	runes := []rune(name)
+	for n := len(query) - typos; n <= len(query)+typos; n++ {
+		if n > 0 && n <= len(runes) && editDistance(query, runes[:n]) <= typos {
+			return matchFuzzy, true
+		}
+	}
+	return 0, false
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
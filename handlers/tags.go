@@ -1,23 +1,53 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
 	"photo-library-server/models"
+	"photo-library-server/repository"
+	"photo-library-server/tagnorm"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// maxTagNameLength mirrors the name length limit enforced on tag requests
+const maxTagNameLength = 50
+
 // TagHandler handles tag-related HTTP requests
 type TagHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	tags   repository.TagRepo
+	photos repository.PhotoRepo
+	albums repository.AlbumRepo
+	config *config.Config
 }
 
 // NewTagHandler creates a new tag handler
-func NewTagHandler(db *gorm.DB) *TagHandler {
-	return &TagHandler{db: db}
+func NewTagHandler(db *gorm.DB, cfg *config.Config) *TagHandler {
+	repos := repository.NewGorm(db)
+	return &TagHandler{db: db, tags: repos.Tags, photos: repos.Photos, albums: repos.Albums, config: cfg}
+}
+
+// tagNamePolicy returns the configured tag name normalization, falling back
+// to the default policy if the configuration is invalid
+func tagNamePolicy(cfg *config.Config) tagnorm.Policy {
+	policy, err := tagnorm.ParsePolicy(cfg.TagNormalization)
+	if err != nil {
+		slog.Warn("Invalid tag normalization, using the default", "error", err)
+		return tagnorm.DefaultPolicy
+	}
+	return policy
 }
 
 // isValidHexColor validates if a string is a valid hex color format
@@ -29,38 +59,48 @@ func isValidHexColor(color string) bool {
 	return matched
 }
 
+// createTagRequest is the JSON body of CreateTag
+type createTagRequest struct {
+	Name        string `json:"name" binding:"required,min=1,max=50"`
+	Description string `json:"description" binding:"max=500"`
+	Color       string `json:"color" binding:"omitempty,len=7"` // hex color like #FF0000
+}
+
 // CreateTag creates a new tag
 func (h *TagHandler) CreateTag(c *gin.Context) {
-	var req struct {
-		Name  string `json:"name" binding:"required,min=1,max=50"`
-		Color string `json:"color" binding:"omitempty,len=7"` // hex color like #FF0000
-	}
+	var req createTagRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
+		return
+	}
+
+	req.Name = tagNamePolicy(h.config).Normalize(req.Name)
+	if req.Name == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "name is required")
 		return
 	}
 
 	// Validate hex color format
 	if !isValidHexColor(req.Color) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid color format. Color must be a valid hex color (e.g., #FF0000)"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid color format. Color must be a valid hex color (e.g., #FF0000)")
 		return
 	}
 
-	// Check if tag with same name already exists
-	var existingTag models.Tag
-	if err := h.db.Where("name = ?", req.Name).First(&existingTag).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Tag with this name already exists"})
+	// Check if a tag or alias with same name already exists
+	if err := checkTagNameFree(c.Request.Context(), h.tags, req.Name, uuid.Nil); err != nil {
+		respondPhotoOpError(c, err)
 		return
 	}
 
 	tag := models.Tag{
-		Name:  req.Name,
-		Color: req.Color,
+		Name:        req.Name,
+		Description: req.Description,
+		Color:       req.Color,
 	}
 
-	if err := h.db.Create(&tag).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+	if err := h.tags.Create(c.Request.Context(), &tag); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create tag")
 		return
 	}
 
@@ -71,12 +111,12 @@ func (h *TagHandler) CreateTag(c *gin.Context) {
 func (h *TagHandler) GetTags(c *gin.Context) {
 	var tags []models.Tag
 
-	query := h.db.Model(&models.Tag{})
+	query := scopedDB(c, h.db).Model(&models.Tag{})
 
 	// Optional: include photo count
 	if c.Query("include_count") == "true" {
 		// Use a subquery to count photos for each tag
-		query = query.Select("tags.*, (SELECT COUNT(*) FROM photo_tags WHERE photo_tags.tag_id = tags.id) as photo_count")
+		query = query.Select("tags.*, (SELECT COUNT(*) FROM photo_tags JOIN photos ON photos.id = photo_tags.photo_id WHERE photo_tags.tag_id = tags.id AND photos.deleted_at IS NULL) as photo_count")
 	}
 
 	// Optional: include photos
@@ -85,41 +125,197 @@ func (h *TagHandler) GetTags(c *gin.Context) {
 	}
 
 	if err := query.Find(&tags).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
 		return
 	}
 
 	c.JSON(http.StatusOK, tags)
 }
 
+// GetTopTags returns tags ranked by how many photos they were applied to
+// within a recent window (window=30d by default, or window=all)
+func (h *TagHandler) GetTopTags(c *gin.Context) {
+	window := c.DefaultQuery("window", "30d")
+	period, err := parseWindow(window)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid window. Use a duration like 7d, 2w, 12h or all")
+		return
+	}
+
+	limit := 10 // Default limit
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	query := scopedDB(c, h.db).Table("tags").
+		Select("tags.*, COUNT(DISTINCT photo_tags.photo_id) as photo_count").
+		Joins("JOIN photo_tags ON photo_tags.tag_id = tags.id").
+		Joins("JOIN photos ON photos.id = photo_tags.photo_id").
+		Where("photos.deleted_at IS NULL")
+
+	var since *time.Time
+	if period > 0 {
+		cutoff := time.Now().Add(-period)
+		since = &cutoff
+		query = query.Where("photo_tags.created_at >= ?", cutoff)
+	}
+
+	topTags := []topTag{}
+	if err := query.Group("tags.id").
+		Order("photo_count DESC, tags.name ASC").
+		Limit(limit).
+		Scan(&topTags).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch top tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window": window,
+		"since":  since,
+		"tags":   topTags,
+	})
+}
+
+// topTag is a tag with the number of photos it was applied to in a window
+type topTag struct {
+	models.Tag
+	PhotoCount int64 `json:"photo_count"`
+}
+
+// MarshalJSON adds photo_count to the tag's fields, since the promoted
+// models.Tag marshaler would otherwise drop it
+func (t topTag) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(t.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return append(data[:len(data)-1], fmt.Sprintf(`,"photo_count":%d}`, t.PhotoCount)...), nil
+}
+
+// parseWindow parses a look-back window such as 30d, 2w or 12h. "all"
+// returns zero, meaning no limit.
+func parseWindow(window string) (time.Duration, error) {
+	if window == "all" {
+		return 0, nil
+	}
+	if window == "" {
+		return 0, fmt.Errorf("window is empty")
+	}
+
+	var period time.Duration
+	if unit := window[len(window)-1:]; unit == "d" || unit == "w" {
+		n, err := strconv.Atoi(strings.TrimSuffix(window, unit))
+		if err != nil {
+			return 0, err
+		}
+		period = time.Duration(n) * 24 * time.Hour
+		if unit == "w" {
+			period *= 7
+		}
+	} else {
+		parsed, err := time.ParseDuration(window)
+		if err != nil {
+			return 0, err
+		}
+		period = parsed
+	}
+
+	if period <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+	return period, nil
+}
+
 // GetTag returns a specific tag by ID
 func (h *TagHandler) GetTag(c *gin.Context) {
 	tagID := c.Param("id")
 
 	id, err := uuid.Parse(tagID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
 		return
 	}
 
-	var tag models.Tag
-	query := h.db.Model(&models.Tag{})
-
 	// Optional: include photos
-	if c.Query("include_photos") == "true" {
-		query = query.Preload("Photos")
+	tag, err := h.tags.Get(c.Request.Context(), id, repository.TagRelations{Photos: c.Query("include_photos") == "true"})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
+		return
 	}
 
-	if err := query.First(&tag, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	c.JSON(http.StatusOK, tag)
+}
+
+// GetTagPhotos returns a page of a tag's photos, accepting the same filters
+// and sort options as the photo list
+func (h *TagHandler) GetTagPhotos(c *gin.Context) {
+	tagID := c.Param("id")
+
+	id, err := uuid.Parse(tagID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
+		return
+	}
+
+	tag, err := h.tags.Get(c.Request.Context(), id, repository.TagRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
-	c.JSON(http.StatusOK, tag)
+	// A subquery rather than a join so the tag filter can still join photo_tags
+	withTag := func() (*gorm.DB, error) {
+		tagged := h.db.Table("photo_tags").Select("photo_id").Where("tag_id = ?", tag.ID)
+		return filterPhotos(c, h.config, scopedDB(c, h.db).Model(&models.Photo{}).Where("photos.id IN (?)", tagged))
+	}
+
+	query, err := withTag()
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	page, limit := pagination(c)
+	photos := []models.Photo{}
+	query = preloadPhotoRelations(c, query).
+		Order(listOrder(c, photoOrderColumns, "uploaded_at", "desc")).
+		Order("photos.id"). // Stable pages for photos uploaded together
+		Offset((page - 1) * limit).
+		Limit(limit)
+	if err := query.Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag photos")
+		return
+	}
+
+	var total int64
+	countQuery, _ := withTag()
+	countQuery.Count(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"photos": photos,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// updateTagRequest is the JSON body of UpdateTag
+type updateTagRequest struct {
+	Name        string  `json:"name" binding:"required,min=1,max=50"`
+	Description *string `json:"description,omitempty" binding:"omitempty,max=500"`
+	Color       string  `json:"color" binding:"omitempty,len=7"`
 }
 
 // UpdateTag updates a tag
@@ -128,49 +324,66 @@ func (h *TagHandler) UpdateTag(c *gin.Context) {
 
 	id, err := uuid.Parse(tagID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
 		return
 	}
 
-	var req struct {
-		Name  string `json:"name" binding:"required,min=1,max=50"`
-		Color string `json:"color" binding:"omitempty,len=7"`
-	}
+	var req updateTagRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
+		return
+	}
+
+	req.Name = tagNamePolicy(h.config).Normalize(req.Name)
+	if req.Name == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "name is required")
 		return
 	}
 
 	// Validate hex color format
 	if !isValidHexColor(req.Color) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid color format. Color must be a valid hex color (e.g., #FF0000)"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid color format. Color must be a valid hex color (e.g., #FF0000)")
 		return
 	}
 
-	var tag models.Tag
-	if err := h.db.First(&tag, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	tag, err := h.tags.Get(c.Request.Context(), id, repository.TagRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
 	// Check if another tag with same name exists
-	var existingTag models.Tag
-	if err := h.db.Where("name = ? AND id != ?", req.Name, id).First(&existingTag).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Tag with this name already exists"})
+	if taken, err := h.tags.NameTaken(c.Request.Context(), req.Name, id); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check tag names")
+		return
+	} else if taken {
+		apierror.Respond(c, http.StatusConflict, "duplicate_tag", "Tag with this name already exists")
+		return
+	}
+
+	// Names of aliases would stop resolving to their tags
+	if taken, err := h.tags.AliasTaken(c.Request.Context(), req.Name, uuid.Nil); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check tag names")
+		return
+	} else if taken {
+		apierror.Respond(c, http.StatusConflict, "duplicate_tag_alias", "Tag alias with this name already exists")
 		return
 	}
 
 	// Update fields
 	tag.Name = req.Name
 	tag.Color = req.Color
+	if req.Description != nil {
+		tag.Description = *req.Description
+	}
 
-	if err := h.db.Save(&tag).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+	if err := h.tags.Save(c.Request.Context(), tag); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update tag")
 		return
 	}
 
@@ -183,108 +396,90 @@ func (h *TagHandler) DeleteTag(c *gin.Context) {
 
 	id, err := uuid.Parse(tagID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
 		return
 	}
 
-	var tag models.Tag
-	if err := h.db.First(&tag, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	tag, err := h.tags.Get(c.Request.Context(), id, repository.TagRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
-	// Use transaction to clean up relationships
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Delete photo_tags relationships
-	if err := tx.Where("tag_id = ?", id).Delete(&models.PhotoTag{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove tag from photos"})
+	// Aliases go with the tag, and it comes off every photo and album
+	if err := h.tags.Delete(c.Request.Context(), tag); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete tag")
 		return
 	}
 
-	// Delete the tag itself
-	if err := tx.Delete(&tag).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
-		return
-	}
-
-	tx.Commit()
 	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
 }
 
+// tagPhotoRequest is the JSON body of AddTagToPhoto
+type tagPhotoRequest struct {
+	PhotoID string `json:"photo_id" binding:"required"`
+}
+
 // AddTagToPhoto adds a tag to a photo
 func (h *TagHandler) AddTagToPhoto(c *gin.Context) {
 	tagID := c.Param("id")
 
 	id, err := uuid.Parse(tagID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
 		return
 	}
 
-	var req struct {
-		PhotoID string `json:"photo_id" binding:"required"`
-	}
+	var req tagPhotoRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": processValidationError(err)})
+		respondValidationError(c, err)
 		return
 	}
 
 	// Parse photo ID manually to provide better error message
 	photoUUID, err := uuid.Parse(req.PhotoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo_id"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo_id")
 		return
 	}
 
 	// Verify tag exists
-	var tag models.Tag
-	if err := h.db.First(&tag, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	tag, err := h.tags.Get(c.Request.Context(), id, repository.TagRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify tag")
 		return
 	}
 
 	// Verify photo exists
-	var photo models.Photo
-	if err := h.db.First(&photo, photoUUID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+	photo, err := h.photos.Get(c.Request.Context(), photoUUID, repository.PhotoRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify photo"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify photo")
 		return
 	}
-
-	// Check if relationship already exists
-	var existingRelation models.PhotoTag
-	if err := h.db.Where("tag_id = ? AND photo_id = ?", id, photoUUID).First(&existingRelation).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Tag already associated with this photo"})
+	if err := checkWritable(scopedDB(c, h.db), photo.LibraryID); err != nil {
+		respondPhotoOpError(c, err)
 		return
 	}
 
-	photoTag := models.PhotoTag{
-		TagID:   id,
-		PhotoID: photoUUID,
-	}
-
-	if err := h.db.Create(&photoTag).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add tag to photo"})
+	if err := h.tags.AddToPhoto(c.Request.Context(), tag.ID, photo.ID); err != nil {
+		if errors.Is(err, repository.ErrExists) {
+			apierror.Respond(c, http.StatusConflict, "duplicate_photo_tag", "Tag already associated with this photo")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add tag to photo")
 		return
 	}
 
@@ -298,81 +493,167 @@ func (h *TagHandler) RemoveTagFromPhoto(c *gin.Context) {
 
 	tagUUID, err := uuid.Parse(tagID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
 		return
 	}
 
 	photoUUID, err := uuid.Parse(photoID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
 		return
 	}
 
-	result := h.db.Where("tag_id = ? AND photo_id = ?", tagUUID, photoUUID).Delete(&models.PhotoTag{})
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove tag from photo"})
-		return
+	// Photos that are gone are reported by the delete below
+	if photo, err := h.photos.Get(c.Request.Context(), photoUUID, repository.PhotoRelations{}); err == nil {
+		if err := checkWritable(scopedDB(c, h.db), photo.LibraryID); err != nil {
+			respondPhotoOpError(c, err)
+			return
+		}
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found on photo"})
+	if err := h.tags.RemoveFromPhoto(c.Request.Context(), tagUUID, photoUUID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "photo_tag_not_found", "Tag not found on photo")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove tag from photo")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Tag removed from photo successfully"})
 }
 
+// tagAlbumRequest is the JSON body of AddTagToAlbum
+type tagAlbumRequest struct {
+	AlbumID string `json:"album_id" binding:"required"`
+}
+
+// AddTagToAlbum adds a tag to an album
+func (h *TagHandler) AddTagToAlbum(c *gin.Context) {
+	tagID := c.Param("id")
+
+	id, err := uuid.Parse(tagID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
+		return
+	}
+
+	var req tagAlbumRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	albumUUID, err := uuid.Parse(req.AlbumID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album_id")
+		return
+	}
+
+	// Verify tag exists
+	tag, err := h.tags.Get(c.Request.Context(), id, repository.TagRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify tag")
+		return
+	}
+
+	// Verify album exists
+	album, err := h.albums.Get(c.Request.Context(), albumUUID, repository.AlbumRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "album_not_found", "Album not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify album")
+		return
+	}
+
+	if err := h.tags.AddToAlbum(c.Request.Context(), tag.ID, album.ID); err != nil {
+		if errors.Is(err, repository.ErrExists) {
+			apierror.Respond(c, http.StatusConflict, "duplicate_album_tag", "Tag already associated with this album")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add tag to album")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag added to album successfully"})
+}
+
+// RemoveTagFromAlbum removes a tag from an album
+func (h *TagHandler) RemoveTagFromAlbum(c *gin.Context) {
+	tagID := c.Param("id")
+	albumID := c.Param("album_id")
+
+	tagUUID, err := uuid.Parse(tagID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
+		return
+	}
+
+	albumUUID, err := uuid.Parse(albumID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_album_id", "Invalid album ID")
+		return
+	}
+
+	if err := h.tags.RemoveFromAlbum(c.Request.Context(), tagUUID, albumUUID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "album_tag_not_found", "Tag not found on album")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove tag from album")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag removed from album successfully"})
+}
+
 // GetTagStats returns statistics for a tag
 func (h *TagHandler) GetTagStats(c *gin.Context) {
 	tagID := c.Param("id")
 
 	id, err := uuid.Parse(tagID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		apierror.Respond(c, http.StatusBadRequest, "invalid_tag_id", "Invalid tag ID")
 		return
 	}
 
 	// Check if tag exists
-	var tag models.Tag
-	if err := h.db.First(&tag, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	tag, err := h.tags.Get(c.Request.Context(), id, repository.TagRelations{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, "tag_not_found", "Tag not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
-	// Get library breakdown
-	type LibraryStats struct {
-		LibraryID   uuid.UUID `json:"library_id"`
-		LibraryName string    `json:"library_name"`
-		PhotoCount  int64     `json:"photo_count"`
+	counts, err := h.tags.Stats(c.Request.Context(), id)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag stats")
+		return
 	}
 
 	stats := struct {
-		TagID      uuid.UUID      `json:"tag_id"`
-		TagName    string         `json:"tag_name"`
-		PhotoCount int64          `json:"photo_count"`
-		Libraries  []LibraryStats `json:"libraries"`
+		TagID      uuid.UUID                    `json:"tag_id"`
+		TagName    string                       `json:"tag_name"`
+		PhotoCount int64                        `json:"photo_count"`
+		AlbumCount int64                        `json:"album_count"`
+		Libraries  []repository.TagLibraryCount `json:"libraries"`
 	}{
-		TagID:   tag.ID,
-		TagName: tag.Name,
+		TagID:      tag.ID,
+		TagName:    tag.Name,
+		PhotoCount: counts.PhotoCount,
+		AlbumCount: counts.AlbumCount,
+		Libraries:  counts.Libraries,
 	}
 
-	// Count total photos with this tag
-	h.db.Model(&models.PhotoTag{}).Where("tag_id = ?", id).Count(&stats.PhotoCount)
-
-	var libraryStats []LibraryStats
-	h.db.Table("libraries").
-		Select("libraries.id as library_id, libraries.name as library_name, COUNT(photo_tags.photo_id) as photo_count").
-		Joins("JOIN photos ON libraries.id = photos.library_id").
-		Joins("JOIN photo_tags ON photos.id = photo_tags.photo_id").
-		Where("photo_tags.tag_id = ?", id).
-		Group("libraries.id, libraries.name").
-		Find(&libraryStats)
-
-	stats.Libraries = libraryStats
-
 	c.JSON(http.StatusOK, stats)
 }
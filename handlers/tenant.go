@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"photo-library-server/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scopedDB limits db to the tenant of the request in multi-tenant mode. Use it
+// for everything a request reads or writes, not for work that outlives the
+// request such as background jobs.
+func scopedDB(c *gin.Context, db *gorm.DB) *gorm.DB {
+	return db.WithContext(c.Request.Context())
+}
+
+// requestTenant returns the tenant of the request, empty outside multi-tenant
+// mode
+func requestTenant(c *gin.Context) string {
+	id, _ := tenant.FromContext(c.Request.Context())
+	return id
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/repository"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTimelineThumbnails = 4
+	maxTimelineThumbnails     = 10
+)
+
+// timelineBucket is one period of a photo timeline
+type timelineBucket struct {
+	Period string          `json:"period"` // "2024", "2024-05" or "2024-05-17"
+	Start  time.Time       `json:"start"`
+	Count  int             `json:"count"`
+	Photos []timelinePhoto `json:"photos"` // The period's most recent photos
+}
+
+// timelinePhoto is a representative photo of a timeline bucket
+type timelinePhoto struct {
+	ID           uuid.UUID  `json:"id"`
+	TakenAt      *time.Time `json:"taken_at"`
+	ThumbnailURL string     `json:"thumbnail_url"`
+}
+
+// GetTimeline returns photo counts and a few thumbnails per day, month or
+// year, newest first, so clients can draw a timeline without fetching every
+// photo. Photos are placed by capture date, or upload date when they have
+// none, and the photo list filters apply. Buckets are paged like photo lists.
+func (h *PhotoHandler) GetTimeline(c *gin.Context) {
+	granularity := c.DefaultQuery("granularity", "month")
+	if _, ok := repository.TimelineLayouts[granularity]; !ok {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid granularity, expected day, month or year")
+		return
+	}
+
+	thumbnails := defaultTimelineThumbnails
+	if n := c.Query("thumbnails"); n != "" {
+		parsed, err := strconv.Atoi(n)
+		if err != nil || parsed < 0 || parsed > maxTimelineThumbnails {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, "Invalid thumbnails, expected 0 to 10")
+			return
+		}
+		thumbnails = parsed
+	}
+
+	filter, err := photoFilter(c, h.config)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	total, err := h.photos.Count(c.Request.Context(), filter)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch timeline")
+		return
+	}
+
+	page, limit := pagination(c)
+	periods, totalBuckets, err := h.photos.Timeline(c.Request.Context(), filter, repository.TimelinePage{
+		Granularity: granularity,
+		Offset:      (page - 1) * limit,
+		Limit:       limit,
+		Thumbnails:  thumbnails,
+	})
+	if errors.Is(err, repository.ErrUnsupported) {
+		apierror.Respond(c, http.StatusNotImplemented, "timeline_not_supported", "Timeline isn't supported on this database")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch timeline")
+		return
+	}
+
+	buckets := make([]timelineBucket, len(periods))
+	for i, period := range periods {
+		buckets[i] = timelineBucket{Period: period.Period, Start: period.Start, Count: period.Count, Photos: make([]timelinePhoto, len(period.Photos))}
+		for j, photo := range period.Photos {
+			buckets[i].Photos[j] = timelinePhoto{ID: photo.ID, TakenAt: photo.TakenAt, ThumbnailURL: photo.ThumbnailURL}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"granularity": granularity,
+		"total":       total,
+		"buckets":     buckets,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": totalBuckets,
+		},
+	})
+}
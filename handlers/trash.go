@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/jobs"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"photo-library-server/thumbnails"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TrashHandler handles HTTP requests for deleted photos, which are kept in
+// the trash until they are purged
+type TrashHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	jobs   *jobs.Manager
+}
+
+// NewTrashHandler creates a new trash handler
+func NewTrashHandler(db *gorm.DB, cfg *config.Config, jobManager *jobs.Manager) *TrashHandler {
+	return &TrashHandler{db: db, config: cfg, jobs: jobManager}
+}
+
+// purgeResult is the per-photo outcome of a purge job
+type purgeResult struct {
+	PhotoID uuid.UUID `json:"photo_id"`
+	Status  string    `json:"status"` // "deleted" or "failed"
+	Code    string    `json:"code,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// trashedPhoto is a photo in the trash, with when it is due to be purged
+type trashedPhoto struct {
+	models.Photo
+	PurgeAt *time.Time `json:"purge_at"` // nil while its library keeps the trash until purged by hand
+}
+
+// MarshalJSON adds purge_at to the photo's fields, since the promoted
+// models.Photo marshaler would otherwise drop it
+func (p trashedPhoto) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(p.Photo)
+	if err != nil {
+		return nil, err
+	}
+	purgeAt, err := json.Marshal(p.PurgeAt)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(data[:len(data)-1], `,"purge_at":`...), append(purgeAt, '}')...), nil
+}
+
+// trashedPhotos returns db limited to photos in the trash
+func trashedPhotos(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Model(&models.Photo{}).Where("photos.deleted_at IS NOT NULL")
+}
+
+// trashRetentionDays returns how many days deleted photos of a library stay
+// in the trash, 0 to keep them until purged by hand
+func trashRetentionDays(cfg *config.Config, library *models.Library) int {
+	if library.TrashRetentionDays != nil {
+		return *library.TrashRetentionDays
+	}
+	return cfg.TrashRetentionDays
+}
+
+// purgeAt returns when a photo deleted at deletedAt becomes due to be
+// purged, nil if it is kept until purged by hand
+func purgeAt(deletedAt time.Time, retentionDays int) *time.Time {
+	if retentionDays <= 0 {
+		return nil
+	}
+	due := deletedAt.AddDate(0, 0, retentionDays)
+	return &due
+}
+
+// libraryRetention returns the trash retention period of each given library
+func (h *TrashHandler) libraryRetention(db *gorm.DB, ids []uuid.UUID) (map[uuid.UUID]int, error) {
+	var libraries []models.Library
+	if len(ids) > 0 {
+		if err := db.Select("id", "trash_retention_days").Where("id IN ?", ids).Find(&libraries).Error; err != nil {
+			return nil, err
+		}
+	}
+	retention := make(map[uuid.UUID]int, len(libraries))
+	for i := range libraries {
+		retention[libraries[i].ID] = trashRetentionDays(h.config, &libraries[i])
+	}
+	return retention, nil
+}
+
+// GetTrash returns the photos in the trash, most recently deleted first, each
+// with when it is due to be purged, and when the first of them is
+func (h *TrashHandler) GetTrash(c *gin.Context) {
+	var photos []models.Photo
+
+	query, err := filterPhotos(c, h.config, trashedPhotos(scopedDB(c, h.db)))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	page, limit := pagination(c)
+	if err := query.Offset((page - 1) * limit).Limit(limit).
+		Order("photos.deleted_at desc").
+		Find(&photos).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch trash")
+		return
+	}
+
+	var total int64
+	countQuery, _ := filterPhotos(c, h.config, trashedPhotos(scopedDB(c, h.db)))
+	countQuery.Count(&total)
+
+	// Retention is per library, so the first photo due may be on any page
+	var libraryIDs []uuid.UUID
+	libraryQuery, _ := filterPhotos(c, h.config, trashedPhotos(scopedDB(c, h.db)))
+	if err := libraryQuery.Distinct().Pluck("photos.library_id", &libraryIDs).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch trash")
+		return
+	}
+	retention, err := h.libraryRetention(scopedDB(c, h.db), libraryIDs)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch libraries")
+		return
+	}
+
+	var nextPurgeAt *time.Time
+	for _, libraryID := range libraryIDs {
+		if retention[libraryID] <= 0 {
+			continue
+		}
+		var oldest models.Photo
+		oldestQuery, _ := filterPhotos(c, h.config, trashedPhotos(scopedDB(c, h.db)))
+		if err := oldestQuery.Select("photos.deleted_at").
+			Where("photos.library_id = ?", libraryID).
+			Order("photos.deleted_at").
+			Take(&oldest).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch trash")
+			return
+		}
+		if due := purgeAt(oldest.DeletedAt.Time, retention[libraryID]); nextPurgeAt == nil || due.Before(*nextPurgeAt) {
+			nextPurgeAt = due
+		}
+	}
+
+	trashed := make([]trashedPhoto, len(photos))
+	for i, photo := range photos {
+		trashed[i] = trashedPhoto{Photo: photo, PurgeAt: purgeAt(photo.DeletedAt.Time, retention[photo.LibraryID])}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"photos":        trashed,
+		"next_purge_at": nextPurgeAt,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// RestorePhoto takes a photo out of the trash, back into its albums and with
+// its tags
+func (h *TrashHandler) RestorePhoto(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var photo models.Photo
+	if err := trashedPhotos(scopedDB(c, h.db)).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_in_trash", "Photo not found in trash")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	tx := scopedDB(c, h.db).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Unscoped().Model(&photo).Update("deleted_at", nil).Error; err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to restore photo")
+		return
+	}
+
+	// Albums holding the photo span its date again
+	albumIDs, err := albumIDsForPhotos(tx, []uuid.UUID{id})
+	if err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo albums")
+		return
+	}
+	if err := updateAlbumDateRanges(tx, albumIDs); err != nil {
+		tx.Rollback()
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update album dates")
+		return
+	}
+
+	tx.Commit()
+
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, photo)
+}
+
+// PurgePhoto permanently deletes a photo in the trash and its file
+func (h *TrashHandler) PurgePhoto(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var photo models.Photo
+	if err := trashedPhotos(scopedDB(c, h.db)).Preload("Library").First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_in_trash", "Photo not found in trash")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if err := purgePhoto(scopedDB(c, h.db), &photo); err != nil {
+		respondPhotoOpError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Photo deleted permanently"})
+}
+
+// EmptyTrash queues a job permanently deleting every photo in the trash
+func (h *TrashHandler) EmptyTrash(c *gin.Context) {
+	job, err := h.SubmitPurge(requestTenant(c), false)
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule purge job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// SubmitPurge queues a background job permanently deleting photos in the
+// trash: all of them, or with dueOnly those kept there longer than their
+// library's retention period. A tenant's purge only covers that tenant's
+// photos, an empty tenant covers all of them.
+func (h *TrashHandler) SubmitPurge(tenantID string, dueOnly bool) (*jobs.Job, error) {
+	return h.jobs.SubmitFor(tenantID, "trash_purge", func(ctx context.Context, job *jobs.Job) error {
+		db := tenant.Scope(h.db, tenantID)
+
+		var photos []models.Photo
+		if !dueOnly {
+			if err := trashedPhotos(db).Preload("Library").Find(&photos).Error; err != nil {
+				return fmt.Errorf("failed to find photos to purge: %w", err)
+			}
+		} else {
+			// Each library has its own cutoff
+			var libraries []models.Library
+			if err := db.Find(&libraries).Error; err != nil {
+				return fmt.Errorf("failed to find libraries to purge: %w", err)
+			}
+			now := time.Now()
+			for i := range libraries {
+				days := trashRetentionDays(h.config, &libraries[i])
+				if days <= 0 {
+					continue
+				}
+				var due []models.Photo
+				if err := trashedPhotos(db).Preload("Library").
+					Where("photos.library_id = ? AND photos.deleted_at < ?", libraries[i].ID, now.AddDate(0, 0, -days)).
+					Find(&due).Error; err != nil {
+					return fmt.Errorf("failed to find photos to purge: %w", err)
+				}
+				photos = append(photos, due...)
+			}
+		}
+
+		job.SetTotal(len(photos))
+		for i := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			result := purgeResult{PhotoID: photos[i].ID, Status: "deleted"}
+			if err := purgePhoto(db, &photos[i]); err != nil {
+				result.Status = "failed"
+				result.Code, result.Error = errorCode(err), err.Error()
+			}
+			job.AddResult(result)
+		}
+		return nil
+	})
+}
+
+// StartPurgeScheduler purges photos that have been in the trash for longer
+// than their library's retention period every interval until the returned
+// stop function is called. Libraries without their own period use
+// TrashRetentionDays, so the scheduler runs even when that keeps the trash
+// indefinitely.
+func (h *TrashHandler) StartPurgeScheduler(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := h.SubmitPurge("", true); err != nil {
+					slog.Warn("Failed to schedule trash purge", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// purgePhoto permanently deletes a photo in the trash: its record, tags,
+// custom metadata, tag suggestions, faces, edit versions and album
+// memberships, then its file, XMP sidecar and renditions. photo must have its
+// Library preloaded.
+func purgePhoto(db *gorm.DB, photo *models.Photo) error {
+	if isRelocating(photo.LibraryID) {
+		return &photoOpError{http.StatusConflict, "library_relocating", "Library is being relocated, try again later"}
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("photo_id = ?", photo.ID).Delete(&models.PhotoTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("photo_id = ?", photo.ID).Delete(&models.PhotoMetadata{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("photo_id = ?", photo.ID).Delete(&models.TagSuggestion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("photo_id = ?", photo.ID).Delete(&models.Face{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("photo_id = ?", photo.ID).Delete(&models.PhotoVersion{}).Error; err != nil {
+			return err
+		}
+		albumIDs, err := albumIDsForPhotos(tx, []uuid.UUID{photo.ID})
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("photo_id = ?", photo.ID).Delete(&models.AlbumPhoto{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(photo).Error; err != nil {
+			return err
+		}
+		// Albums with the photo as their chosen cover fall back to the first photo
+		return clearRemovedAlbumCovers(tx, albumIDs)
+	}); err != nil {
+		return &photoOpError{http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete photo"}
+	}
+
+	// The record is gone, so file cleanup failures are only logged
+	if err := os.Remove(photo.FilePath); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to delete file", "path", photo.FilePath, "error", err)
+	}
+
+	// Remove the XMP sidecar written by rating write-back, if any
+	if err := os.Remove(metadata.SidecarPath(photo.FilePath)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to delete sidecar", "path", photo.FilePath, "error", err)
+	}
+
+	thumbnails.Remove(photo.Library.Images, photo.FilePath)
+	return nil
+}
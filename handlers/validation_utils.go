@@ -1,64 +1,142 @@
 package handlers
 
-import "strings"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"photo-library-server/apierror"
+	"reflect"
+	"strings"
 
-// processValidationError extracts field names from gin validation errors
-func processValidationError(err error) string {
-	errStr := err.Error()
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
 
-	// Extract field name from gin validation error
-	if strings.Contains(errStr, "Error:Field validation for 'Name' failed") {
-		if strings.Contains(errStr, "required") {
-			return "name is required"
-		}
-		if strings.Contains(errStr, "max") {
-			return "name must be at most 100 characters"
-		}
-		if strings.Contains(errStr, "min") {
-			return "name must be at least 1 character"
-		}
-		return "name is invalid"
+func init() {
+	// Validation errors name fields the way clients send them
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(jsonFieldName)
 	}
-	if strings.Contains(errStr, "Error:Field validation for 'Color' failed") {
-		if strings.Contains(errStr, "len") {
-			return "color must be exactly 7 characters (e.g., #FF0000)"
-		}
-		return "color validation failed"
+}
+
+// jsonFieldName returns the JSON name of a request struct field
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
 	}
-	if strings.Contains(errStr, "Error:Field validation for 'Description' failed") {
-		if strings.Contains(errStr, "max") {
-			return "description must be at most 500 characters"
+	return name
+}
+
+// fieldError describes one invalid field of a request body
+type fieldError struct {
+	Field   string `json:"field"`           // Path of the field, like requests[0].method
+	Rule    string `json:"rule"`            // The rule it broke, such as required, max or oneof
+	Param   string `json:"param,omitempty"` // The rule's parameter, such as the maximum
+	Message string `json:"message"`
+}
+
+// respondValidationError writes the response for a request that failed to
+// bind. Broken rules are reported per field in details, with the first
+// one's message as the error message.
+func respondValidationError(c *gin.Context, err error) {
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		fields := make([]fieldError, 0, len(invalid))
+		for _, fe := range invalid {
+			fields = append(fields, fieldError{
+				Field:   fieldPath(fe),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: validationMessage(fe),
+			})
 		}
-		return "description is invalid"
-	}
-	if strings.Contains(errStr, "Error:Field validation for 'LibraryID' failed") {
-		return "library_id is required"
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeValidation, fields[0].Message, gin.H{"fields": fields})
+		return
 	}
-	if strings.Contains(errStr, "Error:Field validation for 'PhotoID' failed") {
-		return "photo_id is required"
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		apierror.Respond(c, http.StatusBadRequest, "invalid_json", "Request body is required")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		apierror.Respond(c, http.StatusBadRequest, "invalid_json", "Request body is not valid JSON")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, fmt.Sprintf("%s must be %s", typeErr.Field, jsonTypeName(typeErr.Type)))
+	default:
+		// Values rejected while decoding, such as malformed UUIDs
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
 	}
-	if strings.Contains(errStr, "Error:Field validation for 'Order' failed") {
-		return "order is required"
+}
+
+// fieldPath returns the path of an invalid field below the request struct
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
 	}
-	if strings.Contains(errStr, "Error:Field validation for 'Images' failed") {
-		if strings.Contains(errStr, "required") {
-			return "images is required"
-		}
-		if strings.Contains(errStr, "max") {
-			return "images path must be at most 500 characters"
+	return fe.Field()
+}
+
+// validationMessage describes a broken binding rule in words
+func validationMessage(fe validator.FieldError) string {
+	field, param := fieldPath(fe), fe.Param()
+
+	// Lengths are counted in characters for strings and items for lists
+	verb, unit := "be", ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters"
+		if param == "1" {
+			unit = " character"
 		}
-		if strings.Contains(errStr, "min") {
-			return "images path must be at least 1 character"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		verb, unit = "contain", " items"
+		if param == "1" {
+			unit = " item"
 		}
-		return "images path is invalid"
 	}
-	if strings.Contains(errStr, "Error:Field validation for 'Rating' failed") {
-		if strings.Contains(errStr, "min") || strings.Contains(errStr, "max") {
-			return "rating must be between 0 and 5"
-		}
-		return "rating is invalid"
+
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "min":
+		return fmt.Sprintf("%s must %s at least %s%s", field, verb, param, unit)
+	case "max":
+		return fmt.Sprintf("%s must %s at most %s%s", field, verb, param, unit)
+	case "len":
+		return fmt.Sprintf("%s must %s exactly %s%s", field, verb, param, unit)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.Join(strings.Fields(param), ", "))
 	}
+	return field + " is invalid"
+}
 
-	// Fallback to original error
-	return errStr
+// jsonTypeName describes the JSON value a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a different type"
 }
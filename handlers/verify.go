@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/encryption"
+	"photo-library-server/jobs"
+	"photo-library-server/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// verifyResult is the outcome of checking one photo's file against its checksum
+type verifyResult struct {
+	PhotoID  uuid.UUID `json:"photo_id"`
+	Status   string    `json:"status"` // "ok", "corrupt", "missing", "baseline" or "failed"
+	Expected string    `json:"expected,omitempty"`
+	Actual   string    `json:"actual,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// VerifyPhoto reads a photo's whole file and compares it with the checksum
+// taken when it was stored, flagging it as corrupt if they differ
+func (h *PhotoHandler) VerifyPhoto(c *gin.Context) {
+	photoID := c.Param("id")
+
+	id, err := uuid.Parse(photoID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if isRelocating(photo.LibraryID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.verifyPhoto(&photo))
+}
+
+// VerifyLibrary verifies every photo of a library as a background job
+func (h *PhotoHandler) VerifyLibrary(c *gin.Context) {
+	libraryID := c.Param("id")
+
+	id, err := uuid.Parse(libraryID)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_library_id", "Invalid library ID")
+		return
+	}
+
+	var library models.Library
+	if err := scopedDB(c, h.db).First(&library, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "library_not_found", "Library not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library")
+		return
+	}
+
+	if isRelocating(library.ID) {
+		apierror.Respond(c, http.StatusConflict, "library_relocating", "Library is being relocated, try again later")
+		return
+	}
+
+	job, err := h.jobs.SubmitFor(library.TenantID, "library_verify", func(ctx context.Context, job *jobs.Job) error {
+		var photos []models.Photo
+		if err := h.db.Where("library_id = ?", library.ID).Find(&photos).Error; err != nil {
+			return err
+		}
+
+		job.SetTotal(len(photos))
+		for i := range photos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			job.AddResult(h.verifyPhoto(&photos[i]))
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeJobQueueFull, "Unable to schedule verification job, try again later")
+		return
+	}
+
+	c.Header("Location", "/api/v1/jobs/"+job.ID().String())
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// verifyPhoto checks one photo's file against its checksum and records the
+// outcome on the photo. Unlike a rescan, a mismatch is treated as damage
+// rather than an edit, so the stored checksum is kept.
+func (h *PhotoHandler) verifyPhoto(photo *models.Photo) verifyResult {
+	result := verifyResult{PhotoID: photo.ID, Expected: photo.Checksum}
+	updates := map[string]interface{}{}
+
+	checksum, err := originalChecksum(h.config, photo)
+	switch {
+	case os.IsNotExist(err):
+		result.Status = "missing"
+		updates["missing"] = true
+	case err == encryption.ErrInvalid:
+		// Encrypted chunks are authenticated, so any change fails decryption
+		result.Status, result.Error = "corrupt", "File failed decryption"
+		updates["corrupt"] = true
+	case err != nil:
+		result.Status, result.Error = "failed", "Failed to read photo file"
+		return result
+	case photo.Checksum == "":
+		// Records from before checksums were kept get a baseline
+		result.Status, result.Actual = "baseline", checksum
+		updates["checksum"] = checksum
+		updates["corrupt"], updates["missing"] = false, false
+	case checksum != photo.Checksum:
+		result.Status, result.Actual = "corrupt", checksum
+		updates["corrupt"], updates["missing"] = true, false
+	default:
+		// A file restored from a backup clears earlier flags
+		result.Status, result.Actual = "ok", checksum
+		updates["corrupt"], updates["missing"] = false, false
+	}
+
+	if result.Status != "missing" {
+		updates["verified_at"] = time.Now()
+	}
+	if err := h.db.Model(&models.Photo{}).Where("id = ?", photo.ID).Updates(updates).Error; err != nil {
+		result.Status, result.Error = "failed", "Failed to update photo"
+	}
+	return result
+}
+
+// originalChecksum returns the hex-encoded SHA-256 of a photo's original,
+// decrypting it first if it is stored encrypted
+func originalChecksum(cfg *config.Config, photo *models.Photo) (string, error) {
+	if !photo.Encrypted {
+		return fileChecksum(photo.FilePath)
+	}
+
+	key, err := libraryKey(cfg, photo.LibraryID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(photo.FilePath); err != nil {
+		return "", err
+	}
+	reader, err := encryption.Open(photo.FilePath, key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"photo-library-server/apierror"
+	"photo-library-server/models"
+	"photo-library-server/thumbnails"
+	"photo-library-server/video"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ServeFrame serves the frame of a video shown t seconds in as a JPEG, for
+// scrubbing previews. It can be scaled with w, h and fit like /file. Frames
+// are extracted with ffmpeg and kept in the resize cache.
+func (h *PhotoHandler) ServeFrame(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, "invalid_photo_id", "Invalid photo ID")
+		return
+	}
+
+	width, height, fit, err := resizeRequest(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation, err.Error())
+		return
+	}
+
+	var photo models.Photo
+	if err := scopedDB(c, h.db).First(&photo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusNotFound, "photo_not_found", "Photo not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch photo")
+		return
+	}
+
+	if !video.IsVideoType(photo.MimeType) {
+		apierror.Respond(c, http.StatusBadRequest, "not_a_video", "Photo is not a video")
+		return
+	}
+
+	// Timestamps are rounded to milliseconds, finer steps show the same frame
+	t, err := strconv.ParseFloat(c.Query("t"), 64)
+	if err != nil || math.IsNaN(t) || t < 0 || t >= photo.Duration {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeValidation,
+			fmt.Sprintf("t must be a time in seconds from 0 to below the video's duration of %g", photo.Duration))
+		return
+	}
+	offset := strconv.FormatFloat(t, 'f', 3, 64)
+
+	// ffmpeg can't read encrypted files, as with their thumbnails
+	if photo.Encrypted {
+		apierror.Respond(c, http.StatusUnsupportedMediaType, "unsupported_file_type", "Frames are not supported for encrypted videos")
+		return
+	}
+
+	if _, err := os.Stat(photo.FilePath); os.IsNotExist(err) {
+		apierror.Respond(c, http.StatusNotFound, "photo_file_not_found", "Photo file not found")
+		return
+	}
+
+	name := fmt.Sprintf("%s_%ss.jpg", strings.TrimSuffix(photo.OriginalName, filepath.Ext(photo.OriginalName)), offset)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", name))
+	c.Header("Cache-Control", "private, max-age=86400")
+
+	// The content version keeps a replaced file from hitting stale frames
+	key := fmt.Sprintf("%s_%s_frame_%s_%dx%d_%s.jpg", photo.ID, photo.OriginalVersion(), offset, width, height, fit)
+	path, ok := h.resized.Get(key)
+	if !ok {
+		seconds, _ := strconv.ParseFloat(offset, 64)
+		png, err := video.Frame(photo.FilePath, seconds)
+		if err == video.ErrNoFFmpeg {
+			apierror.Respond(c, http.StatusNotImplemented, "ffmpeg_not_available", "Video frames need ffmpeg, which isn't installed on this server")
+			return
+		}
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to extract frame")
+			return
+		}
+		frame, err := thumbnails.ResizeData(png, width, height, fit)
+		if err != nil {
+			respondResizeError(c, err)
+			return
+		}
+		if path, err = h.resized.Put(key, frame); err != nil {
+			// Caching is disabled or failed, the frame is still good
+			c.Data(http.StatusOK, "image/jpeg", frame)
+			return
+		}
+	}
+
+	c.Header("Content-Type", "image/jpeg")
+	if offloadFile(c, h.config, path) {
+		return
+	}
+	c.File(path)
+}
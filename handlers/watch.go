@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"log/slog"
+	"path/filepath"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"photo-library-server/watcher"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LibraryWatcher imports files dropped into the images directories of watched
+// libraries: those with watch set, or every library with WATCH_LIBRARIES on.
+// Encrypted and read-only libraries are never watched.
+type LibraryWatcher struct {
+	db     *gorm.DB
+	config *config.Config
+	photos *PhotoHandler
+
+	mu        sync.Mutex
+	watcher   *watcher.Watcher
+	libraries map[string]uuid.UUID // Watched images directory to its library
+
+	importing sync.Mutex // Imports run one at a time, however many files land at once
+}
+
+// NewLibraryWatcher creates a library watcher that imports through photos
+func NewLibraryWatcher(db *gorm.DB, cfg *config.Config, photos *PhotoHandler) *LibraryWatcher {
+	return &LibraryWatcher{db: db, config: cfg, photos: photos, libraries: make(map[string]uuid.UUID)}
+}
+
+// Start watches the libraries that should be watched, refreshing the set every
+// WatchSyncInterval so library changes are picked up, until the returned
+// stop function is called
+func (w *LibraryWatcher) Start() (stop func()) {
+	if err := w.Sync(); err != nil {
+		slog.Warn("Failed to start library watcher", "error", err)
+	}
+	if w.config.WatchSyncInterval <= 0 {
+		return w.close
+	}
+
+	ticker := time.NewTicker(w.config.WatchSyncInterval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := w.Sync(); err != nil {
+					slog.Warn("Failed to refresh watched libraries", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		w.close()
+	}
+}
+
+// Sync starts watching libraries that should be watched and stops watching
+// the rest, including libraries being relocated or made read-only
+func (w *LibraryWatcher) Sync() error {
+	query := w.db.Where("encrypted = ? AND read_only = ?", false, false)
+	if !w.config.WatchLibraries {
+		query = query.Where("watch = ?", true)
+	}
+	var libraries []models.Library
+	if err := query.Find(&libraries).Error; err != nil {
+		return err
+	}
+
+	wanted := make(map[string]uuid.UUID, len(libraries))
+	for _, library := range libraries {
+		if !isRelocating(library.ID) {
+			wanted[filepath.Clean(library.Images)] = library.ID
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watcher == nil {
+		if len(wanted) == 0 {
+			return nil
+		}
+		fsWatcher, err := watcher.New(w.config.WatchDebounce, w.importFile)
+		if err != nil {
+			return err
+		}
+		w.watcher = fsWatcher
+	}
+
+	for dir, id := range w.libraries {
+		if wanted[dir] != id {
+			w.watcher.Remove(dir)
+			delete(w.libraries, dir)
+		}
+	}
+	for dir, id := range wanted {
+		if _, ok := w.libraries[dir]; ok {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			// The directory may not exist yet, try again on the next sync
+			slog.Warn("Failed to watch directory", "path", dir, "error", err)
+			w.watcher.Remove(dir)
+			continue
+		}
+		w.libraries[dir] = id
+	}
+	return nil
+}
+
+// close stops watching every library
+func (w *LibraryWatcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watcher != nil {
+		w.watcher.Close()
+		w.watcher = nil
+	}
+	w.libraries = make(map[string]uuid.UUID)
+}
+
+// importFile imports a settled file into the library whose directory holds it
+func (w *LibraryWatcher) importFile(path string) {
+	if strings.EqualFold(filepath.Ext(path), ".xmp") {
+		return // Sidecars belong to the photo next to them
+	}
+
+	// Nested libraries are possible, the innermost one owns the file
+	w.mu.Lock()
+	var libraryID uuid.UUID
+	var libraryDir string
+	for dir, id := range w.libraries {
+		if inDirectory(dir, path) && len(dir) > len(libraryDir) {
+			libraryDir, libraryID = dir, id
+		}
+	}
+	w.mu.Unlock()
+	if libraryID == uuid.Nil {
+		return
+	}
+
+	w.importing.Lock()
+	defer w.importing.Unlock()
+
+	var library models.Library
+	if err := w.db.First(&library, libraryID).Error; err != nil {
+		slog.Warn("Failed to import file", "path", path, "error", err)
+		return
+	}
+	if library.Encrypted || library.ReadOnly || isRelocating(library.ID) {
+		return
+	}
+
+	switch _, err := w.photos.importFile(&library, path); err {
+	case nil, errAlreadyImported:
+		// Files written by uploads and copies already have records
+	case errUnsupportedFile:
+		slog.Warn("Not importing file of unsupported type", "path", path, "library", library.Name)
+	default:
+		slog.Warn("Failed to import file", "path", path, "library", library.Name, "error", err)
+	}
+}
+
+// inDirectory reports whether path is dir or below it
+func inDirectory(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
+)
+
+// WebDAV folders inside each library's folder
+const (
+	webdavAlbumsDir = "Albums"
+	webdavPhotosDir = "Photos"
+)
+
+// WebDAVHandler serves libraries as a read-only WebDAV share, so desktops
+// can mount the server as a network drive. Each library is a folder holding
+// an Albums folder, with a folder per album, and a Photos folder with all of
+// its photos under their original names.
+type WebDAVHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	locks  webdav.LockSystem
+}
+
+// NewWebDAVHandler creates a new WebDAV handler
+func NewWebDAVHandler(db *gorm.DB, cfg *config.Config) *WebDAVHandler {
+	return &WebDAVHandler{db: db, config: cfg, locks: webdav.NewMemLS()}
+}
+
+// ServeWebDAV answers the read methods of WebDAV, GET, HEAD and PROPFIND, for
+// the mount at the route's /*path
+func (h *WebDAVHandler) ServeWebDAV(c *gin.Context) {
+	dav := &webdav.Handler{
+		Prefix:     strings.TrimSuffix(c.FullPath(), "/*path"),
+		FileSystem: &libraryFS{db: h.db, config: h.config},
+		LockSystem: h.locks,
+	}
+	dav.ServeHTTP(c.Writer, c.Request)
+}
+
+// OptionsWebDAV advertises a class 1 server without locking, which clients
+// such as Finder and Explorer mount read-only
+func (h *WebDAVHandler) OptionsWebDAV(c *gin.Context) {
+	c.Header("DAV", "1")
+	c.Header("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+	c.Header("MS-Author-Via", "DAV")
+	c.Status(http.StatusOK)
+}
+
+// libraryFS is the tree of libraries, albums and photos as a webdav.FileSystem.
+// Every change is refused.
+type libraryFS struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+func (fs *libraryFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (fs *libraryFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (fs *libraryFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (fs *libraryFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, _, err := fs.resolve(ctx, name)
+	return info, err
+}
+
+func (fs *libraryFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	info, entries, err := fs.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &davDir{info: info, entries: entries}, nil
+	}
+
+	var photo models.Photo
+	if err := fs.db.WithContext(ctx).First(&photo, info.photoID).Error; err != nil {
+		return nil, os.ErrNotExist
+	}
+	original, _, err := openOriginal(fs.config, &photo)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return &davFile{ReadSeekCloser: original, info: info}, nil
+}
+
+// resolve finds the file or folder at name, along with a folder's entries
+func (fs *libraryFS) resolve(ctx context.Context, name string) (*davInfo, []os.FileInfo, error) {
+	db := fs.db.WithContext(ctx)
+	parts := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	if parts[0] == "" {
+		parts = nil
+	}
+
+	var libraries []models.Library
+	if err := db.Order("created_at").Order("id").Find(&libraries).Error; err != nil {
+		return nil, nil, err
+	}
+	entries := make([]os.FileInfo, 0, len(libraries))
+	names := davNames{}
+	var library *models.Library
+	var libraryInfo *davInfo
+	for i := range libraries {
+		entry := davFolder(names.add(libraries[i].Name, libraries[i].ID, ""), libraries[i].UpdatedAt)
+		entries = append(entries, entry)
+		if len(parts) > 0 && strings.EqualFold(entry.name, parts[0]) {
+			library, libraryInfo = &libraries[i], entry
+		}
+	}
+	if len(parts) == 0 {
+		return davFolder("/", time.Time{}), entries, nil
+	}
+	if library == nil {
+		return nil, nil, os.ErrNotExist
+	}
+
+	if len(parts) == 1 {
+		return libraryInfo, []os.FileInfo{
+			davFolder(webdavAlbumsDir, library.UpdatedAt),
+			davFolder(webdavPhotosDir, library.UpdatedAt),
+		}, nil
+	}
+
+	switch {
+	case strings.EqualFold(parts[1], webdavPhotosDir):
+		photos, err := davPhotos(db.Where("library_id = ?", library.ID))
+		if err != nil {
+			return nil, nil, err
+		}
+		return davLookup(davFolder(webdavPhotosDir, library.UpdatedAt), photos, parts[2:])
+
+	case strings.EqualFold(parts[1], webdavAlbumsDir):
+		var albums []models.Album
+		if err := db.Where("library_id = ?", library.ID).Order("created_at").Order("id").Find(&albums).Error; err != nil {
+			return nil, nil, err
+		}
+		folders := make([]os.FileInfo, 0, len(albums))
+		names := davNames{}
+		var album *models.Album
+		var albumInfo *davInfo
+		for i := range albums {
+			folder := davFolder(names.add(albums[i].Name, albums[i].ID, ""), albums[i].UpdatedAt)
+			folders = append(folders, folder)
+			if len(parts) > 2 && strings.EqualFold(folder.name, parts[2]) {
+				album, albumInfo = &albums[i], folder
+			}
+		}
+		if len(parts) == 2 {
+			return davFolder(webdavAlbumsDir, library.UpdatedAt), folders, nil
+		}
+		if album == nil {
+			return nil, nil, os.ErrNotExist
+		}
+
+		photos, err := davPhotos(db.Joins("JOIN album_photos ON album_photos.photo_id = photos.id").
+			Where("album_photos.album_id = ?", album.ID))
+		if err != nil {
+			return nil, nil, err
+		}
+		return davLookup(albumInfo, photos, parts[3:])
+	}
+	return nil, nil, os.ErrNotExist
+}
+
+// davPhotos lists the photos query selects as files, oldest upload first so
+// that names stay put as photos are added
+func davPhotos(query *gorm.DB) ([]os.FileInfo, error) {
+	var photos []models.Photo
+	if err := query.Select("photos.id", "photos.original_name", "photos.file_size", "photos.mime_type", "photos.checksum", "photos.updated_at").
+		Order("photos.uploaded_at").Order("photos.id").
+		Find(&photos).Error; err != nil {
+		return nil, err
+	}
+
+	files := make([]os.FileInfo, 0, len(photos))
+	names := davNames{}
+	for _, photo := range photos {
+		files = append(files, &davInfo{
+			name:     names.add(strings.TrimSuffix(photo.OriginalName, path.Ext(photo.OriginalName)), photo.ID, path.Ext(photo.OriginalName)),
+			size:     photo.FileSize,
+			modTime:  photo.UpdatedAt,
+			photoID:  photo.ID,
+			mimeType: photo.MimeType,
+			etag:     fmt.Sprintf("%q", photo.ContentVersion()),
+		})
+	}
+	return files, nil
+}
+
+// davLookup returns folder with its files, or the file named by rest
+func davLookup(folder *davInfo, files []os.FileInfo, rest []string) (*davInfo, []os.FileInfo, error) {
+	switch len(rest) {
+	case 0:
+		return folder, files, nil
+	case 1:
+		for _, file := range files {
+			if strings.EqualFold(file.Name(), rest[0]) {
+				return file.(*davInfo), nil, nil
+			}
+		}
+	}
+	return nil, nil, os.ErrNotExist
+}
+
+// davNames hands out the names of a folder's entries. Desktop file systems
+// ignore case and can't hold slashes, so a name that is taken regardless of
+// case gets the start of its record's ID appended.
+type davNames map[string]bool
+
+func (n davNames) add(base string, id uuid.UUID, ext string) string {
+	base = strings.NewReplacer("/", "_", "\\", "_").Replace(base)
+	if base == "" {
+		base = id.String()
+	}
+	name := base + ext
+	if n[strings.ToLower(name)] {
+		name = fmt.Sprintf("%s (%s)%s", base, id.String()[:8], ext)
+	}
+	n[strings.ToLower(name)] = true
+	return name
+}
+
+// davInfo describes a folder or a photo's file
+type davInfo struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	dir      bool
+	photoID  uuid.UUID
+	mimeType string
+	etag     string
+}
+
+func davFolder(name string, modTime time.Time) *davInfo {
+	return &davInfo{name: name, modTime: modTime, dir: true}
+}
+
+func (i *davInfo) Name() string       { return i.name }
+func (i *davInfo) Size() int64        { return i.size }
+func (i *davInfo) ModTime() time.Time { return i.modTime }
+func (i *davInfo) IsDir() bool        { return i.dir }
+func (i *davInfo) Sys() interface{}   { return nil }
+
+func (i *davInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ContentType saves the webdav package from opening every photo of a
+// listing to sniff its type
+func (i *davInfo) ContentType(ctx context.Context) (string, error) {
+	if i.mimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.mimeType, nil
+}
+
+// ETag matches the one the photo's file is served with
+func (i *davInfo) ETag(ctx context.Context) (string, error) {
+	if i.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.etag, nil
+}
+
+// davFile is an open photo
+type davFile struct {
+	io.ReadSeekCloser
+	info *davInfo
+}
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// davDir is an open folder
+type davDir struct {
+	info    *davInfo
+	entries []os.FileInfo
+	pos     int
+}
+
+func (d *davDir) Close() error { return nil }
+
+func (d *davDir) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *davDir) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	rest := d.entries[d.pos:]
+	if count <= 0 {
+		d.pos = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.pos += count
+	return rest[:count], nil
+}
+
+func (d *davDir) Stat() (os.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *davDir) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
@@ -0,0 +1,331 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status describes where a job is in its lifecycle
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// finishedJobRetention controls how long completed jobs stay queryable
+const finishedJobRetention = 24 * time.Hour
+
+// cancelGracePeriod is how long Shutdown waits for cancelled jobs to return
+var cancelGracePeriod = 10 * time.Second
+
+var (
+	// ErrQueueFull is returned when no more jobs can be accepted right now
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrShuttingDown is returned when jobs are submitted after Shutdown
+	ErrShuttingDown = errors.New("job manager is shutting down")
+)
+
+// Func is the work performed by a job. It should report progress through
+// the job and return a non-nil error only if the job as a whole failed.
+type Func func(ctx context.Context, job *Job) error
+
+// Job is a unit of background work with progress and per-item results
+type Job struct {
+	mu sync.Mutex
+
+	id         uuid.UUID
+	jobType    string
+	owner      string // Who may see the job, empty for everyone
+	status     Status
+	total      int
+	processed  int
+	results    []interface{}
+	err        string
+	createdAt  time.Time
+	startedAt  *time.Time
+	finishedAt *time.Time
+}
+
+// Snapshot is a point-in-time, JSON-friendly copy of a job
+type Snapshot struct {
+	ID         uuid.UUID     `json:"id"`
+	Type       string        `json:"type"`
+	Status     Status        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Results    []interface{} `json:"results"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+// ID returns the job's unique identifier
+func (j *Job) ID() uuid.UUID {
+	return j.id
+}
+
+// Owner returns who submitted the job, empty when it isn't owned
+func (j *Job) Owner() string {
+	return j.owner
+}
+
+// SetTotal records how many items the job will process
+func (j *Job) SetTotal(total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total = total
+}
+
+// AddResult records the outcome of one processed item
+func (j *Job) AddResult(result interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.results = append(j.results, result)
+	j.processed++
+}
+
+// Advance records progress without storing a per-item result
+func (j *Job) Advance(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processed += n
+}
+
+// Snapshot returns a copy of the job's current state
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	results := make([]interface{}, len(j.results))
+	copy(results, j.results)
+
+	return Snapshot{
+		ID:         j.id,
+		Type:       j.jobType,
+		Status:     j.status,
+		Total:      j.total,
+		Processed:  j.processed,
+		Results:    results,
+		Error:      j.err,
+		CreatedAt:  j.createdAt,
+		StartedAt:  j.startedAt,
+		FinishedAt: j.finishedAt,
+	}
+}
+
+func (j *Job) finishedBefore(cutoff time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.finishedAt != nil && j.finishedAt.Before(cutoff)
+}
+
+type queuedJob struct {
+	job *Job
+	run Func
+}
+
+// Manager runs jobs on a fixed pool of workers and keeps their state in memory
+type Manager struct {
+	mu       sync.RWMutex
+	jobs     map[uuid.UUID]*Job
+	queue    chan queuedJob
+	closed   bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	workers  sync.WaitGroup
+	inFlight sync.WaitGroup
+}
+
+// NewManager creates a job manager and starts its workers
+func NewManager(workers, queueSize int) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		jobs:   make(map[uuid.UUID]*Job),
+		queue:  make(chan queuedJob, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for i := 0; i < workers; i++ {
+		m.workers.Add(1)
+		go m.worker()
+	}
+
+	return m
+}
+
+// Submit queues a new job of the given type
+func (m *Manager) Submit(jobType string, run Func) (*Job, error) {
+	return m.SubmitFor("", jobType, run)
+}
+
+// SubmitFor queues a new job of the given type on behalf of owner, such as a
+// tenant
+func (m *Manager) SubmitFor(owner, jobType string, run Func) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrShuttingDown
+	}
+
+	m.pruneLocked()
+
+	job := &Job{
+		id:        uuid.New(),
+		jobType:   jobType,
+		owner:     owner,
+		status:    StatusPending,
+		results:   []interface{}{},
+		createdAt: time.Now(),
+	}
+
+	m.inFlight.Add(1)
+	select {
+	case m.queue <- queuedJob{job: job, run: run}:
+	default:
+		m.inFlight.Done()
+		return nil, ErrQueueFull
+	}
+
+	m.jobs[job.id] = job
+	return job, nil
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id uuid.UUID) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// List returns all known jobs, newest first
+func (m *Manager) List() []*Job {
+	m.mu.RLock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].createdAt.After(jobs[k].createdAt)
+	})
+	return jobs
+}
+
+// QueueDepth returns the number of jobs waiting for a worker
+func (m *Manager) QueueDepth() int {
+	return len(m.queue)
+}
+
+// Shutdown stops accepting jobs and waits for queued and running jobs to
+// finish. If ctx expires first, running jobs are cancelled, queued ones fail
+// without running, and Shutdown waits up to cancelGracePeriod more for them
+// to return, so what they use can be closed safely afterwards.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.inFlight.Wait()
+		m.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		m.cancel()
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+	}
+
+	select {
+	case <-done:
+		return fmt.Errorf("jobs did not finish before shutdown deadline: %w", ctx.Err())
+	case <-time.After(cancelGracePeriod):
+		return fmt.Errorf("jobs did not stop within %s of being cancelled: %w", cancelGracePeriod, ctx.Err())
+	}
+}
+
+// pruneLocked drops finished jobs past the retention window; m.mu must be held
+func (m *Manager) pruneLocked() {
+	cutoff := time.Now().Add(-finishedJobRetention)
+	for id, job := range m.jobs {
+		if job.finishedBefore(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func (m *Manager) worker() {
+	defer m.workers.Done()
+	for queued := range m.queue {
+		m.execute(queued)
+	}
+}
+
+func (m *Manager) execute(queued queuedJob) {
+	defer m.inFlight.Done()
+
+	job := queued.job
+	now := time.Now()
+	job.mu.Lock()
+	// Jobs still queued when shutdown cancels them aren't started
+	if err := m.ctx.Err(); err != nil {
+		job.status = StatusFailed
+		job.err = err.Error()
+		job.finishedAt = &now
+		job.mu.Unlock()
+		return
+	}
+	job.status = StatusRunning
+	job.startedAt = &now
+	job.mu.Unlock()
+
+	var err error
+	func() {
+		// A panicking job must not take the worker down with it
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		err = queued.run(m.ctx, job)
+	}()
+
+	finished := time.Now()
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.finishedAt = &finished
+	if err != nil {
+		job.status = StatusFailed
+		job.err = err.Error()
+		return
+	}
+	job.status = StatusCompleted
+}
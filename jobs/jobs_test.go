@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitFor blocks until the job finishes or the test times out
+func waitFor(t *testing.T, job *Job) Snapshot {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		snapshot := job.Snapshot()
+		if snapshot.Status == StatusCompleted || snapshot.Status == StatusFailed {
+			return snapshot
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", job.ID())
+	return Snapshot{}
+}
+
+func TestManager(t *testing.T) {
+	t.Run("Job results and progress", func(t *testing.T) {
+		m := NewManager(1, 10)
+		defer m.Shutdown(context.Background())
+
+		job, err := m.Submit("test", func(ctx context.Context, job *Job) error {
+			job.SetTotal(2)
+			job.AddResult("a")
+			job.AddResult("b")
+			return nil
+		})
+		require.NoError(t, err)
+
+		snapshot := waitFor(t, job)
+		assert.Equal(t, StatusCompleted, snapshot.Status)
+		assert.Equal(t, 2, snapshot.Total)
+		assert.Equal(t, 2, snapshot.Processed)
+		assert.Equal(t, []interface{}{"a", "b"}, snapshot.Results)
+		assert.NotNil(t, snapshot.StartedAt)
+		assert.NotNil(t, snapshot.FinishedAt)
+
+		found, ok := m.Get(job.ID())
+		assert.True(t, ok)
+		assert.Equal(t, job, found)
+	})
+
+	t.Run("Owned jobs", func(t *testing.T) {
+		m := NewManager(1, 10)
+		defer m.Shutdown(context.Background())
+
+		job, err := m.SubmitFor("smith", "test", func(ctx context.Context, job *Job) error { return nil })
+		require.NoError(t, err)
+		assert.Equal(t, "smith", job.Owner())
+
+		unowned, err := m.Submit("test", func(ctx context.Context, job *Job) error { return nil })
+		require.NoError(t, err)
+		assert.Empty(t, unowned.Owner())
+	})
+
+	t.Run("Failed and panicking jobs", func(t *testing.T) {
+		m := NewManager(1, 10)
+		defer m.Shutdown(context.Background())
+
+		failing, err := m.Submit("test", func(ctx context.Context, job *Job) error {
+			return errors.New("boom")
+		})
+		require.NoError(t, err)
+		panicking, err := m.Submit("test", func(ctx context.Context, job *Job) error {
+			panic("oops")
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "boom", waitFor(t, failing).Error)
+		assert.Contains(t, waitFor(t, panicking).Error, "oops")
+		assert.Len(t, m.List(), 2)
+	})
+
+	t.Run("Queue full and shutdown", func(t *testing.T) {
+		m := NewManager(1, 1)
+		release := make(chan struct{})
+
+		blocking := func(ctx context.Context, job *Job) error {
+			<-release
+			return nil
+		}
+
+		_, err := m.Submit("test", blocking)
+		require.NoError(t, err)
+
+		// Wait for the worker to pick up the first job so the queue slot frees
+		time.Sleep(20 * time.Millisecond)
+		_, err = m.Submit("test", blocking)
+		require.NoError(t, err)
+
+		_, err = m.Submit("test", blocking)
+		assert.ErrorIs(t, err, ErrQueueFull)
+
+		close(release)
+		require.NoError(t, m.Shutdown(context.Background()))
+
+		_, err = m.Submit("test", blocking)
+		assert.ErrorIs(t, err, ErrShuttingDown)
+	})
+
+	t.Run("Shutdown deadline waits for cancelled jobs", func(t *testing.T) {
+		m := NewManager(1, 2)
+		var stopped atomic.Bool
+		running, err := m.Submit("test", func(ctx context.Context, job *Job) error {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond) // Cleanup after cancellation
+			stopped.Store(true)
+			return ctx.Err()
+		})
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+		queued, err := m.Submit("test", func(ctx context.Context, job *Job) error {
+			t.Error("queued job started after shutdown cancelled it")
+			return nil
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = m.Shutdown(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, stopped.Load(), "Shutdown returned before the cancelled job did")
+		assert.Equal(t, StatusFailed, running.Snapshot().Status)
+		assert.Equal(t, StatusFailed, queued.Snapshot().Status)
+	})
+
+	t.Run("Shutdown gives up on jobs ignoring cancellation", func(t *testing.T) {
+		defer func(grace time.Duration) { cancelGracePeriod = grace }(cancelGracePeriod)
+		cancelGracePeriod = 20 * time.Millisecond
+
+		m := NewManager(1, 1)
+		release := make(chan struct{})
+		defer close(release)
+		_, err := m.Submit("test", func(ctx context.Context, job *Job) error {
+			<-release
+			return nil
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = m.Shutdown(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "of being cancelled")
+	})
+}
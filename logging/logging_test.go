@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{
+		"":        slog.LevelInfo,
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+	} {
+		level, err := ParseLevel(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, level, name)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("Records below the level are dropped", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := New(&out, slog.LevelWarn)
+		logger.Info("ignored")
+		logger.Warn("kept", "path", "/tmp/a.jpg")
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+		assert.Equal(t, "WARN", record["level"])
+		assert.Equal(t, "kept", record["msg"])
+		assert.Equal(t, "/tmp/a.jpg", record["path"])
+	})
+
+	t.Run("Context loggers carry the request ID", func(t *testing.T) {
+		var out bytes.Buffer
+		previous := slog.Default()
+		slog.SetDefault(New(&out, slog.LevelInfo))
+		defer slog.SetDefault(previous)
+
+		_, ok := RequestID(context.Background())
+		assert.False(t, ok)
+
+		ctx := WithRequestID(context.Background(), "abc-123")
+		id, ok := RequestID(ctx)
+		require.True(t, ok)
+		assert.Equal(t, "abc-123", id)
+
+		FromContext(ctx).Info("hello")
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+		assert.Equal(t, "abc-123", record["request_id"])
+	})
+}
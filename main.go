@@ -1,58 +1,253 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"photo-library-server/apikeys"
+	"photo-library-server/cdn"
+	"photo-library-server/classify"
 	"photo-library-server/config"
 	"photo-library-server/database"
+	"photo-library-server/faces"
+	"photo-library-server/geocode"
+	"photo-library-server/grpcapi"
 	"photo-library-server/handlers"
+	"photo-library-server/jobs"
+	"photo-library-server/logging"
 	"photo-library-server/middleware"
+	"photo-library-server/models"
+	"photo-library-server/signing"
+	"photo-library-server/tagnorm"
+	"photo-library-server/thumbnails"
+	"photo-library-server/tlsserver"
+	"photo-library-server/video"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	// Load configuration
-	cfg := config.LoadConfig()
+	// A server failing after startup still stops gracefully, the process only
+	// exits with an error once the deferred cleanup below has run. Registered
+	// first so it runs last.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	// Load configuration, from a file if one is given
+	configPath := flag.String("config", "", "YAML or TOML config file, environment variables override its settings")
+	migrateTo := flag.Int("migrate-to", -1, "Migrate the database schema up or down to this version and exit, 0 reverts every migration")
+	flag.Parse()
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Structured logging, log.Printf output goes through the same JSON handler
+	logLevel, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	logger := logging.New(os.Stdout, logLevel)
+	slog.SetDefault(logger)
+
+	if _, err := tagnorm.ParsePolicy(cfg.TagNormalization); err != nil {
+		log.Fatalf("Invalid TAG_NORMALIZATION: %v", err)
+	}
+
+	switch cfg.TenantMode {
+	case "off", middleware.TenantModeHeader:
+	case middleware.TenantModeSubdomain:
+		if cfg.TenantDomain == "" {
+			log.Fatalf("TENANT_MODE=subdomain requires TENANT_DOMAIN")
+		}
+	default:
+		log.Fatalf("Invalid TENANT_MODE: %q", cfg.TenantMode)
+	}
+
+	tlsSetup, err := tlsserver.New(cfg)
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+	if tlsSetup == nil && cfg.HTTPRedirectPort != "" {
+		log.Fatalf("HTTP_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS")
+	}
 
 	// Initialize database
-	sqliteDB, err := database.NewSQLiteDB(cfg.DatabasePath)
+	dsn := cfg.DatabasePath
+	if cfg.DatabaseDriver == database.DriverPostgres {
+		if cfg.DatabaseURL == "" {
+			log.Fatalf("DB_DRIVER=postgres requires DATABASE_URL")
+		}
+		dsn = cfg.DatabaseURL
+	}
+	db, err := database.Open(cfg.DatabaseDriver, dsn, database.Options{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		QueryTimeout:    cfg.DBQueryTimeout,
+
+		SQLiteJournalMode: cfg.SQLiteJournalMode,
+		SQLiteSynchronous: cfg.SQLiteSynchronous,
+		SQLiteBusyTimeout: cfg.SQLiteBusyTimeout,
+		SQLiteForeignKeys: cfg.SQLiteForeignKeys,
+	})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer sqliteDB.Close()
+	defer db.Close()
+
+	if *migrateTo >= 0 {
+		if err := db.MigrateTo(*migrateTo); err != nil {
+			log.Fatalf("Failed to migrate to version %d: %v", *migrateTo, err)
+		}
+		log.Printf("Database schema is at version %d", *migrateTo)
+		return
+	}
 
 	// Run migrations
-	if err := sqliteDB.Migrate(); err != nil {
+	if err := db.Migrate(); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
 	// Create indexes for better performance
-	if err := sqliteDB.CreateIndexes(); err != nil {
+	if err := db.CreateIndexes(); err != nil {
 		log.Printf("Warning: Failed to create indexes: %v", err)
 	}
 
+	// Encrypted libraries can't be read without the secret they were created with
+	if cfg.EncryptionSecret == "" {
+		var encrypted int64
+		db.GetDB().Model(&models.Library{}).Where("encrypted = ?", true).Count(&encrypted)
+		if encrypted > 0 {
+			log.Printf("Warning: %d encrypted libraries exist but ENCRYPTION_SECRET is not set, their photos can't be served", encrypted)
+		}
+	}
+
+	// Configured thumbnail sizes replace the built-in ones
+	if len(cfg.ThumbnailSizes) > 0 {
+		if _, ok := cfg.ThumbnailSizes[thumbnails.DefaultSize]; !ok {
+			log.Fatalf("THUMBNAIL_SIZES must include %q", thumbnails.DefaultSize)
+		}
+		thumbnails.Sizes = cfg.ThumbnailSizes
+	}
+
+	// Video poster frames, and so video thumbnails, need ffmpeg
+	video.FFmpegPath = cfg.FFmpegPath
+	if !video.PostersAvailable() {
+		log.Printf("Warning: %s not found, videos will have no thumbnails or frames", cfg.FFmpegPath)
+	}
+
+	// Reverse geocoding, loading the offline dataset up front
+	geocoder, err := geocode.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up geocoder: %v", err)
+	}
+
+	// Tag suggestions from an image classifier
+	classifier, err := classify.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up classifier: %v", err)
+	}
+
+	// Face detection and clustering into people
+	faceDetector, err := faces.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up face detector: %v", err)
+	}
+
+	// Start background job workers
+	jobManager := jobs.NewManager(cfg.JobWorkers, cfg.JobQueueSize)
+	defer func() {
+		// Runs after the schedulers below stopped, so no new jobs arrive
+		ctx, cancel := shutdownContext(cfg.JobShutdownTimeout)
+		defer cancel()
+		if err := jobManager.Shutdown(ctx); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
 	// Initialize Gin router
 	if gin.Mode() == gin.DebugMode {
 		gin.SetMode(gin.ReleaseMode) // Use release mode for better performance
 	}
 
 	router := gin.New()
-	router.Use(gin.Logger())
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.LoggerMiddleware(logger))
+	router.Use(middleware.MetricsMiddleware()) // Outside recovery, so panics count as 500s
 	router.Use(gin.Recovery())
-	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.CORSMiddleware(cfg))
+
+	// Downloads share one bandwidth budget across all file-serving routes
+	downloadLimit := middleware.BandwidthLimitMiddleware(cfg)
+
+	// Slow or numerous uploads and renders can't exhaust memory and file handles
+	requestTimeout := middleware.TimeoutMiddleware(cfg.RequestTimeout)
+	uploadTimeout := middleware.TimeoutMiddleware(cfg.UploadTimeout)
+	uploadLimit := middleware.ConcurrencyLimitMiddleware(cfg.MaxConcurrentUploads)
+	processingLimit := middleware.ConcurrencyLimitMiddleware(cfg.MaxConcurrentProcessing)
+
+	// Issue signed file URLs when a signing secret is configured, pointing at
+	// the CDN when one is configured
+	signer := signing.NewSigner(cfg.URLSigningSecret, cfg.SignedURLTTL)
+	fileURLs := cdn.FromConfig(cfg, signer)
+	models.FileURLFunc = fileURLs.URL
 
 	// Initialize handlers
-	libraryHandler := handlers.NewLibraryHandler(sqliteDB.GetDB())
-	albumHandler := handlers.NewAlbumHandler(sqliteDB.GetDB())
-	photoHandler := handlers.NewPhotoHandler(sqliteDB.GetDB(), cfg)
-	tagHandler := handlers.NewTagHandler(sqliteDB.GetDB())
+	libraryHandler := handlers.NewLibraryHandler(db.GetDB(), cfg, jobManager)
+	albumHandler := handlers.NewAlbumHandler(db.GetDB(), cfg)
+	photoHandler := handlers.NewPhotoHandler(db.GetDB(), cfg, jobManager)
+	tagHandler := handlers.NewTagHandler(db.GetDB(), cfg)
+	jobHandler := handlers.NewJobHandler(jobManager)
+	storageHandler := handlers.NewStorageHandler(db.GetDB(), cfg, jobManager)
+	trashHandler := handlers.NewTrashHandler(db.GetDB(), cfg, jobManager)
+	geocodeHandler := handlers.NewGeocodeHandler(db.GetDB(), cfg, jobManager, geocoder)
+	classifyHandler := handlers.NewClassifyHandler(db.GetDB(), cfg, jobManager, classifier)
+	photoHandler.ClassifyUploads(classifyHandler)
+	faceHandler := handlers.NewFaceHandler(db.GetDB(), cfg, jobManager, faceDetector)
+	photoHandler.DetectFacesInUploads(faceHandler)
+	capabilitiesHandler := handlers.NewCapabilitiesHandler(cfg)
+	downloadHandler := handlers.NewDownloadHandler(db.GetDB(), cfg, signer)
+	batchHandler := handlers.NewBatchHandler(db.GetDB(), cfg, router)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db.GetDB())
+	metricsHandler := handlers.NewMetricsHandler(db.GetDB(), jobManager)
+	healthHandler := handlers.NewHealthHandler(db.GetDB(), cfg)
+	graphqlHandler := handlers.NewGraphQLHandler(db.GetDB(), cfg)
+	shareHandler := handlers.NewShareHandler(db.GetDB(), cfg, photoHandler)
+	feedHandler := handlers.NewFeedHandler(db.GetDB())
+	webdavHandler := handlers.NewWebDAVHandler(db.GetDB(), cfg)
+	backupHandler := handlers.NewBackupHandler(db.GetDB(), cfg, jobManager)
+	docsHandler := handlers.NewDocsHandler(router, cfg)
+
+	// API routes, v2 serves the same handlers with responses wrapped
+	// in a {data, meta, errors} envelope
+	apiKeyAuth := middleware.APIKeyMiddleware(db.GetDB(), cfg)
+	v1 := router.Group("/api/v1", middleware.TenantMiddleware(cfg), apiKeyAuth)
+	v2 := router.Group("/api/v2", middleware.EnvelopeMiddleware(), middleware.TenantMiddleware(cfg), apiKeyAuth)
+	for _, api := range []*gin.RouterGroup{v1, v2} {
+		// Server capabilities
+		api.GET("/capabilities", capabilitiesHandler.GetCapabilities)
+
+		// Run many requests in one round trip
+		api.POST("/batch", batchHandler.ExecuteBatch)
 
-	// API routes
-	api := router.Group("/api/v1")
-	{
 		// Library routes
-		libraries := api.Group("/libraries")
+		libraries := api.Group("/libraries", requestTimeout)
 		{
 			libraries.POST("", libraryHandler.CreateLibrary)
 			libraries.GET("", libraryHandler.GetLibraries)
@@ -60,114 +255,387 @@ func main() {
 			libraries.PUT("/:id", libraryHandler.UpdateLibrary)
 			libraries.DELETE("/:id", libraryHandler.DeleteLibrary)
 			libraries.GET("/:id/stats", libraryHandler.GetLibraryStats)
+			libraries.POST("/:id/rescan", libraryHandler.RescanLibrary)         // Reconcile photo records with files on disk
+			libraries.POST("/:id/scan", photoHandler.ScanLibrary)               // Import files already in the images directory
+			libraries.POST("/:id/import/apple", photoHandler.ImportAppleExport) // Import an Apple Photos or iCloud export
+			libraries.GET("/:id/audit", photoHandler.AuditLibrary)              // Report (and with ?fix=true repair) orphaned files and rows
+			libraries.POST("/:id/verify", photoHandler.VerifyLibrary)           // Check every file against its checksum
 		}
 
 		// Album routes
-		albums := api.Group("/albums")
+		albums := api.Group("/albums", requestTimeout)
 		{
 			albums.POST("", albumHandler.CreateAlbum)
 			albums.GET("", albumHandler.GetAlbums)
 			albums.GET("/:id", albumHandler.GetAlbum)
+			albums.GET("/:id/photos", albumHandler.GetAlbumPhotos) // Page through an album's photos
 			albums.PUT("/:id", albumHandler.UpdateAlbum)
 			albums.DELETE("/:id", albumHandler.DeleteAlbum)
 			albums.POST("/:id/photos", albumHandler.AddPhotoToAlbum)
 			albums.DELETE("/:id/photos/:photo_id", albumHandler.RemovePhotoFromAlbum)
+			albums.POST("/:id/photos/remove", albumHandler.RemovePhotosFromAlbum) // Remove many photos in one call
 			albums.PUT("/:id/photos/:photo_id/order", albumHandler.UpdatePhotoOrder)
+			albums.PUT("/:id/photos/order", albumHandler.ReorderAlbumPhotos) // Renumber all photos, or move some to a position
+			albums.PUT("/:id/cover", albumHandler.SetAlbumCover)
+			albums.POST("/:id/duplicate", albumHandler.DuplicateAlbum) // Copy an album, and with library_id its photos, into a new album
+			albums.POST("/:id/shares", shareHandler.CreateShare)       // Link to a gallery of the album that needs no API key
+			albums.GET("/:id/shares", shareHandler.GetShares)
+			albums.DELETE("/:id/shares/:share_id", shareHandler.DeleteShare)
 		}
+		api.GET("/albums/:id/download", downloadLimit, albumHandler.DownloadAlbum) // Stream a ZIP of the album's photos, outside the request timeout
 
 		// Photo routes
 		photos := api.Group("/photos")
 		{
-			photos.POST("/upload", photoHandler.UploadPhoto)
-			photos.GET("", photoHandler.GetPhotos)
-			photos.GET("/:id", photoHandler.GetPhoto)
-			photos.PUT("/:id", photoHandler.UpdatePhoto)
-			photos.DELETE("/:id", photoHandler.DeletePhoto)
-			photos.GET("/:id/file", photoHandler.ServePhoto) // Serve actual photo file
-			photos.POST("/:id/copy", photoHandler.CopyPhoto) // Copy photo to same or different library
+			photos.POST("/upload", uploadLimit, uploadTimeout, photoHandler.UploadPhoto)
+			photos.POST("/upload/batch", uploadLimit, uploadTimeout, photoHandler.UploadPhotos) // Upload many files in one request
+			photos.POST("/batch", requestTimeout, photoHandler.BatchPhotos)                     // Apply one operation to many photos in one transaction
+			photos.POST("/bulk-copy", requestTimeout, photoHandler.BulkCopyPhotos)              // Copy many photos as a background job
+			photos.POST("/export", downloadLimit, photoHandler.ExportPhotos)                    // Stream a ZIP of selected photos
+			photos.POST("/download", downloadLimit, photoHandler.DownloadPhotos)                // Stream a ZIP of the listed photos
+			photos.POST("/geocode", requestTimeout, geocodeHandler.RunGeocode)                  // Look up places of new positions as a background job
+			photos.POST("/classify", requestTimeout, classifyHandler.RunClassify)               // Suggest tags for new photos as a background job
+			photos.POST("/detect-faces", requestTimeout, faceHandler.RunFaceDetection)          // Find faces in new photos as a background job
+			photos.POST("/hash", requestTimeout, photoHandler.HashPhotos)                       // Compute missing perceptual hashes as a background job
+			photos.GET("", requestTimeout, photoHandler.GetPhotos)
+			photos.GET("/timeline", requestTimeout, photoHandler.GetTimeline) // Photo counts and thumbnails per day, month or year
+			photos.GET("/:id", requestTimeout, photoHandler.GetPhoto)
+			photos.PUT("/:id", requestTimeout, photoHandler.UpdatePhoto)
+			photos.DELETE("/:id", requestTimeout, photoHandler.DeletePhoto)
+			photos.GET("/:id/file", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, photoHandler.ServePhoto)                           // Serve actual photo file
+			photos.GET("/:id/thumbnail", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, processingLimit, photoHandler.ServeThumbnail) // Serve a cached rendition of the photo
+			photos.GET("/:id/motion", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, photoHandler.ServeMotion)                        // Serve the clip embedded in a Motion Photo
+			photos.GET("/:id/preview", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, photoHandler.ServePreview)                      // Serve the JPEG preview embedded in a RAW file
+			photos.GET("/:id/frame", downloadLimit, processingLimit, photoHandler.ServeFrame)                                                                         // Serve a video frame at a timestamp, for scrubbing previews
+			photos.POST("/:id/copy", requestTimeout, photoHandler.CopyPhoto)                                                                                          // Copy photo to same or different library
+			photos.POST("/:id/move", requestTimeout, photoHandler.MovePhoto)                                                                                          // Move photo to a different library
+			photos.POST("/:id/download-url", requestTimeout, downloadHandler.CreateDownloadURL)                                                                       // Temporary signed URL for the original
+			photos.POST("/:id/signed-url", requestTimeout, downloadHandler.CreateSignedURL)                                                                           // Expiring URL for embedding the file or a thumbnail
+			photos.PUT("/:id/storage-tier", requestTimeout, storageHandler.SetPhotoTier)                                                                              // Move original between hot and cold storage
+			photos.POST("/:id/rotate", requestTimeout, processingLimit, photoHandler.RotatePhoto)                                                                     // Rotate or flip the original
+			photos.POST("/:id/edits", requestTimeout, processingLimit, photoHandler.EditPhoto)                                                                        // Save a new version with edits applied
+			photos.GET("/:id/edits", requestTimeout, photoHandler.ListPhotoVersions)                                                                                  // Saved edit versions
+			photos.POST("/:id/edits/restore", requestTimeout, photoHandler.RestorePhotoVersion)                                                                       // Choose the version served, 0 for the original
+			photos.POST("/:id/verify", requestTimeout, photoHandler.VerifyPhoto)                                                                                      // Check the file against its checksum
+			photos.POST("/:id/restore", requestTimeout, trashHandler.RestorePhoto)                                                                                    // Take a deleted photo out of the trash
+			photos.POST("/:id/favorite", requestTimeout, photoHandler.ToggleFavorite)                                                                                 // Mark or unmark as a favorite
+			photos.GET("/:id/metadata", requestTimeout, photoHandler.GetPhotoMetadata)                                                                                // Custom key/value fields
+			photos.PUT("/:id/metadata", requestTimeout, photoHandler.SetPhotoMetadata)                                                                                // Set or remove (null) custom fields
+			photos.DELETE("/:id/metadata/:key", requestTimeout, photoHandler.DeletePhotoMetadata)                                                                     // Remove one custom field
+			photos.GET("/:id/suggestions", requestTimeout, classifyHandler.GetPhotoSuggestions)                                                                       // Tags suggested by the classifier
+			photos.GET("/:id/faces", requestTimeout, faceHandler.GetPhotoFaces)                                                                                       // Faces found and who they are
+			photos.GET("/:id/similar", requestTimeout, photoHandler.GetSimilarPhotos)                                                                                 // Photos that look alike, such as shots of a burst
 		}
 
 		// Tag routes
-		tags := api.Group("/tags")
+		tags := api.Group("/tags", requestTimeout)
 		{
 			tags.POST("", tagHandler.CreateTag)
 			tags.GET("", tagHandler.GetTags)
+			tags.GET("/top", tagHandler.GetTopTags)
+			tags.GET("/suggest", tagHandler.SuggestTags) // Complete a partly typed tag name
+			tags.POST("/batch", tagHandler.BatchTags)    // Add and remove tags on many photos in one transaction
 			tags.GET("/:id", tagHandler.GetTag)
+			tags.GET("/:id/photos", tagHandler.GetTagPhotos) // Page through a tag's photos
 			tags.PUT("/:id", tagHandler.UpdateTag)
 			tags.DELETE("/:id", tagHandler.DeleteTag)
 			tags.POST("/:id/photos", tagHandler.AddTagToPhoto)
 			tags.DELETE("/:id/photos/:photo_id", tagHandler.RemoveTagFromPhoto)
+			tags.POST("/:id/albums", tagHandler.AddTagToAlbum)
+			tags.DELETE("/:id/albums/:album_id", tagHandler.RemoveTagFromAlbum)
 			tags.GET("/:id/stats", tagHandler.GetTagStats)
+			tags.GET("/:id/aliases", tagHandler.GetTagAliases)               // Alternative names
+			tags.POST("/:id/aliases", tagHandler.CreateTagAlias)             // Add a name resolving to the tag
+			tags.PUT("/:id/aliases/:alias_id", tagHandler.UpdateTagAlias)    // Rename an alias
+			tags.DELETE("/:id/aliases/:alias_id", tagHandler.DeleteTagAlias) // Remove an alias
+		}
+
+		// Tag suggestion routes
+		suggestions := api.Group("/suggestions", requestTimeout)
+		{
+			suggestions.GET("", classifyHandler.GetSuggestions)
+			suggestions.POST("/review", classifyHandler.ReviewSuggestions) // Accept and reject suggestions
+		}
+
+		// People and face routes
+		people := api.Group("/people", requestTimeout)
+		{
+			people.GET("", faceHandler.GetPeople)
+			people.GET("/:id", faceHandler.GetPerson)
+			people.PUT("/:id", faceHandler.UpdatePerson) // Name a cluster of faces
+			people.DELETE("/:id", faceHandler.DeletePerson)
+			people.POST("/:id/merge", faceHandler.MergePeople)     // Join clusters of the same person
+			people.GET("/:id/photos", faceHandler.GetPersonPhotos) // Page through the photos a person is in
+		}
+		api.PUT("/faces/:id", requestTimeout, faceHandler.UpdateFace) // Move a face to another person
+
+		// Job routes
+		jobRoutes := api.Group("/jobs", requestTimeout)
+		{
+			jobRoutes.GET("", jobHandler.GetJobs)
+			jobRoutes.GET("/:id", jobHandler.GetJob)
+		}
+
+		// API key routes
+		keys := api.Group("/apikeys", requestTimeout)
+		{
+			keys.POST("", apiKeyHandler.CreateAPIKey)
+			keys.GET("", apiKeyHandler.GetAPIKeys)
+			keys.DELETE("/:id", apiKeyHandler.DeleteAPIKey)
+		}
+
+		// Storage routes
+		storage := api.Group("/storage", requestTimeout)
+		{
+			storage.POST("/tiering", storageHandler.RunTiering) // Move old originals to cold storage as a background job
+			storage.GET("/usage", storageHandler.GetUsage)      // Free space per volume and total photo size
+		}
+
+		// Trash routes
+		trash := api.Group("/trash", requestTimeout)
+		{
+			trash.GET("", trashHandler.GetTrash)
+			trash.DELETE("", trashHandler.EmptyTrash)     // Purge everything in the trash as a background job
+			trash.DELETE("/:id", trashHandler.PurgePhoto) // Delete one photo and its file permanently
+		}
+
+		// Server administration, across tenants and so for the admin key alone in multi-tenant mode
+		admin := api.Group("/admin", middleware.AdminKeyMiddleware(cfg))
+		{
+			admin.POST("/backup", requestTimeout, backupHandler.CreateBackup) // Snapshot the database as a background job
+			admin.GET("/backups", requestTimeout, backupHandler.GetBackups)
+			admin.GET("/backups/:name", downloadLimit, backupHandler.DownloadBackup)                  // Database file of a backup
+			admin.GET("/backups/:name/manifest", downloadLimit, backupHandler.DownloadBackupManifest) // Photo files listed in a backup
 		}
 	}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "healthy",
-			"service": "photo-library-server",
-		})
-	})
+	// GraphQL API, read-only, with the same tenant and API key checks
+	graphql := router.Group("/graphql", middleware.TenantMiddleware(cfg), apiKeyAuth, requestTimeout)
+	{
+		graphql.GET("", graphqlHandler.Query)
+		graphql.POST("", graphqlHandler.Query)
+	}
 
-	// API documentation endpoint
-	router.GET("/api", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"service": "Photo Library Management Server",
-			"version": "1.0.0",
-			"endpoints": gin.H{
-				"libraries": gin.H{
-					"POST   /api/v1/libraries":           "Create a new library",
-					"GET    /api/v1/libraries":           "Get all libraries",
-					"GET    /api/v1/libraries/:id":       "Get a specific library",
-					"PUT    /api/v1/libraries/:id":       "Update a library",
-					"DELETE /api/v1/libraries/:id":       "Delete a library",
-					"GET    /api/v1/libraries/:id/stats": "Get library statistics",
-				},
-				"albums": gin.H{
-					"POST   /api/v1/albums":                            "Create a new album",
-					"GET    /api/v1/albums":                            "Get all albums",
-					"GET    /api/v1/albums/:id":                        "Get a specific album",
-					"PUT    /api/v1/albums/:id":                        "Update an album",
-					"DELETE /api/v1/albums/:id":                        "Delete an album",
-					"POST   /api/v1/albums/:id/photos":                 "Add photo to album",
-					"DELETE /api/v1/albums/:id/photos/:photo_id":       "Remove photo from album",
-					"PUT    /api/v1/albums/:id/photos/:photo_id/order": "Update photo order in album",
-				},
-				"photos": gin.H{
-					"POST   /api/v1/photos/upload":   "Upload a new photo",
-					"GET    /api/v1/photos":          "Get all photos with filters",
-					"GET    /api/v1/photos/:id":      "Get a specific photo",
-					"PUT    /api/v1/photos/:id":      "Update photo metadata",
-					"DELETE /api/v1/photos/:id":      "Delete a photo",
-					"GET    /api/v1/photos/:id/file": "Serve the actual photo file",
-					"POST   /api/v1/photos/:id/copy": "Copy photo to same or different library",
-				},
-				"tags": gin.H{
-					"POST   /api/v1/tags":                      "Create a new tag",
-					"GET    /api/v1/tags":                      "Get all tags",
-					"GET    /api/v1/tags/:id":                  "Get a specific tag",
-					"PUT    /api/v1/tags/:id":                  "Update a tag",
-					"DELETE /api/v1/tags/:id":                  "Delete a tag",
-					"POST   /api/v1/tags/:id/photos":           "Add tag to photo",
-					"DELETE /api/v1/tags/:id/photos/:photo_id": "Remove tag from photo",
-					"GET    /api/v1/tags/:id/stats":            "Get tag statistics",
-				},
-				"health": gin.H{
-					"GET /health": "Health check endpoint",
-				},
-			},
-		})
-	})
+	// Atom feeds of recent uploads, with the same tenant and API key checks
+	feeds := router.Group("/feeds", middleware.TenantMiddleware(cfg), apiKeyAuth, requestTimeout)
+	{
+		feeds.GET("/library/:feed", feedHandler.GetLibraryFeed) // /feeds/library/<id>.atom
+		feeds.GET("/album/:feed", feedHandler.GetAlbumFeed)     // /feeds/album/<id>.atom
+	}
+
+	// Read-only WebDAV mount of libraries, albums and photos. Desktop clients
+	// send the API key as their password.
+	dav := router.Group("/webdav", middleware.BasicAuthKeyMiddleware("Photo Library"), middleware.TenantMiddleware(cfg), apiKeyAuth)
+	{
+		dav.OPTIONS("/*path", webdavHandler.OptionsWebDAV)                      // Advertise a read-only mount
+		dav.Handle(apikeys.MethodPropfind, "/*path", webdavHandler.ServeWebDAV) // List folders and file properties
+		dav.GET("/*path", downloadLimit, webdavHandler.ServeWebDAV)             // Download a photo's original
+		dav.HEAD("/*path", webdavHandler.ServeWebDAV)                           // Check a photo's original
+	}
+
+	// Shared album galleries, open to anyone with the link and so outside the
+	// tenant and API key checks; the share decides the tenant
+	shared := router.Group("/shared/:token")
+	{
+		shared.GET("", requestTimeout, shareHandler.GetGallery)                                                // HTML gallery, or the password form
+		shared.POST("", requestTimeout, shareHandler.UnlockShare)                                              // Check the password form
+		shared.GET("/album", requestTimeout, shareHandler.GetSharedAlbum)                                      // The album and a page of its photos as JSON
+		shared.GET("/photos/:id/file", downloadLimit, shareHandler.ServeSharedPhoto)                           // Serve a photo of the album
+		shared.GET("/photos/:id/thumbnail", downloadLimit, processingLimit, shareHandler.ServeSharedThumbnail) // Serve a rendition of a photo of the album
+	}
+
+	// Health check endpoints
+	router.GET("/health", healthHandler.Health)
+	router.GET("/healthz", healthHandler.Liveness) // Liveness probe: the process is up
+	router.GET("/readyz", healthHandler.Readiness) // Readiness probe: database, migrations and storage
+
+	// Prometheus metrics endpoint
+	router.GET("/metrics", metricsHandler.GetMetrics)
+
+	// API documentation endpoints, the spec covers every route registered above
+	router.GET("/api", docsHandler.GetIndex)
+	router.GET("/api/openapi.json", docsHandler.GetOpenAPISpec) // OpenAPI 3 specification
+	router.GET("/api/docs", docsHandler.GetSwaggerUI)           // Swagger UI
+
+	// Periodically move old originals to cold storage when configured
+	stopTiering := storageHandler.StartTieringScheduler(cfg.TieringInterval)
+	defer stopTiering()
+
+	// Periodically purge photos that have been in the trash too long
+	stopPurge := trashHandler.StartPurgeScheduler(cfg.TrashPurgeInterval)
+	defer stopPurge()
+
+	// Periodically look up the places of new photo positions
+	stopGeocode := geocodeHandler.StartGeocodeScheduler(cfg.GeocodeInterval)
+	defer stopGeocode()
+
+	// Periodically suggest tags for new photos
+	stopClassify := classifyHandler.StartClassifyScheduler(cfg.ClassifyInterval)
+	defer stopClassify()
+
+	// Periodically find faces in new photos
+	stopFaces := faceHandler.StartFaceDetectionScheduler(cfg.FaceDetectionInterval)
+	defer stopFaces()
+
+	// Import files dropped into the images directories of watched libraries
+	stopWatcher := handlers.NewLibraryWatcher(db.GetDB(), cfg, photoHandler).Start()
+	defer stopWatcher()
+
+	// Warn through webhooks or email before volumes fill up
+	stopCapacityMonitor := storageHandler.StartCapacityMonitor(cfg.StorageCheckInterval)
+	defer stopCapacityMonitor()
 
 	// Start server
 	address := fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
 	log.Printf("Starting Photo Library Server on %s", address)
-	log.Printf("Database: %s", cfg.DatabasePath)
+	if cfg.DatabaseDriver == database.DriverPostgres {
+		log.Printf("Database: PostgreSQL") // The URL may hold a password
+	} else {
+		log.Printf("Database: %s", cfg.DatabasePath)
+	}
 	log.Printf("Max file size: %d bytes (%.1f MB)", cfg.MaxFileSize, float64(cfg.MaxFileSize)/(1024*1024))
+	if cfg.DownloadRateLimit > 0 || cfg.GlobalDownloadRateLimit > 0 {
+		log.Printf("Download limits: %d bytes/s per connection, %d bytes/s global (0 = unlimited)", cfg.DownloadRateLimit, cfg.GlobalDownloadRateLimit)
+	}
+	if cfg.FileOffload != "" && cfg.FileOffload != "off" {
+		log.Printf("File downloads offloaded to the front-end server with %s", cfg.FileOffload)
+	}
+	switch cfg.TenantMode {
+	case middleware.TenantModeHeader:
+		log.Printf("Multi-tenant mode: tenant ID from the %s header", cfg.TenantHeader)
+	case middleware.TenantModeSubdomain:
+		log.Printf("Multi-tenant mode: tenant ID from subdomains of %s", cfg.TenantDomain)
+	}
+	if cfg.CDNBaseURL != "" {
+		log.Printf("File URLs point at the CDN at %s", cfg.CDNBaseURL)
+	}
+	if cfg.RequireAPIKey {
+		log.Printf("API keys required in the %s header", apikeys.Header)
+	}
 	log.Printf("Images stored in library-specific directories")
-	log.Printf("API documentation available at: http://%s/api", address)
+	if cfg.ColdStoragePath != "" && cfg.ColdStorageAfterMonths > 0 {
+		log.Printf("Originals older than %d months move to cold storage at %s", cfg.ColdStorageAfterMonths, cfg.ColdStoragePath)
+	}
+	if cfg.TrashRetentionDays > 0 {
+		log.Printf("Deleted photos are purged from the trash after %d days", cfg.TrashRetentionDays)
+	}
+	if geocoder != nil {
+		log.Printf("Photo positions are reverse geocoded with the %s geocoder", cfg.Geocoder)
+	}
+	if classifier != nil {
+		log.Printf("Tags are suggested by the classifier at %s", cfg.ClassifierURL)
+	}
+	if faceDetector != nil {
+		log.Printf("Faces are found by the face detector at %s", cfg.FaceDetectorURL)
+	}
+	if cfg.WatchLibraries {
+		log.Printf("Watching every unencrypted library for new files")
+	}
+	scheme := "http"
+	if tlsSetup != nil {
+		scheme = "https"
+		if tlsSetup.Autocert() {
+			log.Printf("TLS certificates from Let's Encrypt for %s", strings.Join(cfg.TLSAutocertDomains, ", "))
+		} else {
+			log.Printf("TLS certificate from %s", cfg.TLSCertFile)
+		}
+	}
+	log.Printf("API documentation available at: %s://%s/api", scheme, address)
+
+	server := &http.Server{Addr: address, Handler: router}
+	serverErr := make(chan error, 3)
+	go func() {
+		if tlsSetup == nil {
+			serverErr <- server.ListenAndServe()
+			return
+		}
+		server.TLSConfig = tlsSetup.Config
+		serverErr <- server.ListenAndServeTLS("", "") // Certificates come from TLSConfig
+	}()
+
+	// Plain HTTP is redirected to HTTPS, and answers Let's Encrypt challenges
+	var redirectServer *http.Server
+	if tlsSetup != nil && cfg.HTTPRedirectPort != "" {
+		redirectAddress := fmt.Sprintf("%s:%s", cfg.Host, cfg.HTTPRedirectPort)
+		redirectServer = &http.Server{
+			Addr:              redirectAddress,
+			Handler:           tlsSetup.RedirectHandler(cfg.Port),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		log.Printf("Redirecting HTTP on %s to HTTPS", redirectAddress)
+		go func() {
+			serverErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	// gRPC on its own port, for ingestion tools and other programmatic clients
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != "" {
+		grpcAddress := fmt.Sprintf("%s:%s", cfg.Host, cfg.GRPCPort)
+		var grpcTLS *tls.Config
+		if tlsSetup != nil {
+			grpcTLS = tlsSetup.Config
+		}
+		grpcServer = grpcapi.NewServer(router, grpcTLS)
+		log.Printf("gRPC API on %s", grpcAddress)
+		go func() {
+			listener, err := net.Listen("tcp", grpcAddress)
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			serverErr <- grpcServer.Serve(listener)
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		// Other listeners may already be serving, so they are drained like on
+		// a signal
+		log.Printf("Server failed: %v, shutting down", err)
+		exitCode = 1
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
+	}
+	signal.Stop(signals) // A second signal kills the process right away
+
+	// Stop accepting connections and let in-flight requests, such as uploads,
+	// finish. Connections still open at the deadline are closed.
+	ctx, cancel := shutdownContext(cfg.ShutdownTimeout)
+	defer cancel()
+	if redirectServer != nil {
+		redirectServer.Close() // Redirects are instant, there is nothing to drain
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Warning: Requests did not finish before shutdown deadline: %v", err)
+		server.Close()
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			log.Printf("Warning: gRPC calls did not finish before shutdown deadline")
+			grpcServer.Stop()
+		}
+	}
+
+	// The deferred calls stop the schedulers, finish background jobs and
+	// close the database, in that order
+	log.Printf("Server stopped, finishing background work")
+}
 
-	if err := router.Run(address); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// shutdownContext returns a context expiring after timeout, or never when
+// timeout is 0
+func shutdownContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
 	}
+	return context.WithTimeout(context.Background(), timeout)
 }
@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EXIF tags holding the capture time, in order of preference
+const (
+	tagExifIFDPointer    = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+	tagDateTime          = 0x0132
+
+	tiffTypeASCII  = 2
+	exifTimeFormat = "2006:01:02 15:04:05"
+)
+
+var (
+	exifSignature = []byte("Exif\x00\x00")
+
+	// XMP properties holding the capture time, in order of preference
+	xmpDateProperties = []xmpProperty{
+		newXMPProperty("exif:DateTimeOriginal"),
+		newXMPProperty("xmp:CreateDate"),
+		newXMPProperty("photoshop:DateCreated"),
+	}
+
+	xmpDateLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+)
+
+// xmpProperty matches a simple XMP property written as either an attribute
+// or an element
+type xmpProperty struct {
+	attr    *regexp.Regexp
+	element *regexp.Regexp
+}
+
+func newXMPProperty(name string) xmpProperty {
+	quoted := regexp.QuoteMeta(name)
+	return xmpProperty{
+		attr:    regexp.MustCompile(`\s` + quoted + `\s*=\s*"([^"]*)"`),
+		element: regexp.MustCompile(`(?s)<` + quoted + `>(.*?)</` + quoted + `>`),
+	}
+}
+
+// ReadCaptureTime reads a file from disk and returns when it was taken, or
+// nil if the file doesn't record it
+func ReadCaptureTime(path string) (*time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractCaptureTime(data), nil
+}
+
+// ExtractCaptureTime returns the capture time recorded in EXIF, falling back
+// to XMP. Cameras record local wall-clock time without a zone, so the result
+// is that wall-clock time expressed in UTC.
+func ExtractCaptureTime(data []byte) *time.Time {
+	if isJPEG(data) {
+		for _, seg := range jpegSegments(data) {
+			if seg.marker == markerAPP1 && bytes.HasPrefix(seg.data, exifSignature) {
+				if t := exifCaptureTime(seg.data[len(exifSignature):]); t != nil {
+					return t
+				}
+			}
+		}
+	} else if isTIFF(data) {
+		if t := exifCaptureTime(data); t != nil {
+			return t
+		}
+	}
+
+	if packet := findXMPPacket(data); packet != nil {
+		return xmpCaptureTime(packet)
+	}
+	return nil
+}
+
+// isTIFF reports whether data starts with a TIFF header
+func isTIFF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
+
+// exifCaptureTime reads the capture time from a TIFF-structured EXIF block
+func exifCaptureTime(tiff []byte) *time.Time {
+	if len(tiff) < 8 {
+		return nil
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+
+	var exifIFD map[uint16][]byte
+	if pointer, ok := ifd0[tagExifIFDPointer]; ok && len(pointer) >= 4 {
+		exifIFD = readIFD(tiff, order, order.Uint32(pointer))
+	}
+
+	for _, value := range [][]byte{exifIFD[tagDateTimeOriginal], exifIFD[tagDateTimeDigitized], ifd0[tagDateTime]} {
+		if t := parseExifTime(value); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// readIFD returns the raw values of an IFD's ASCII entries and the 4-byte
+// value field of every other entry, keyed by tag
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16][]byte {
+	entries := make(map[uint16][]byte)
+	if int(offset)+2 > len(tiff) {
+		return entries
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	pos := int(offset) + 2
+	for i := 0; i < count && pos+12 <= len(tiff); i, pos = i+1, pos+12 {
+		tag := order.Uint16(tiff[pos:])
+		valueType := order.Uint16(tiff[pos+2:])
+		length := order.Uint32(tiff[pos+4:])
+		field := tiff[pos+8 : pos+12]
+
+		if valueType != tiffTypeASCII {
+			entries[tag] = field
+			continue
+		}
+		if length <= 4 {
+			entries[tag] = field[:length]
+			continue
+		}
+		start := order.Uint32(field)
+		if uint64(start)+uint64(length) > uint64(len(tiff)) {
+			continue
+		}
+		entries[tag] = tiff[start : start+length]
+	}
+	return entries
+}
+
+// parseExifTime parses an EXIF "YYYY:MM:DD HH:MM:SS" value
+func parseExifTime(value []byte) *time.Time {
+	s := strings.TrimRight(string(value), "\x00 ")
+	if s == "" {
+		return nil
+	}
+	t, err := time.ParseInLocation(exifTimeFormat, s, time.UTC)
+	if err != nil || t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// xmpCaptureTime reads the first capture date property found in an XMP packet
+func xmpCaptureTime(packet []byte) *time.Time {
+	for _, property := range xmpDateProperties {
+		var raw []byte
+		if match := property.attr.FindSubmatch(packet); match != nil {
+			raw = match[1]
+		} else if match := property.element.FindSubmatch(packet); match != nil {
+			raw = match[1]
+		} else {
+			continue
+		}
+
+		if t := parseXMPTime(strings.TrimSpace(string(raw))); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// parseXMPTime parses an ISO 8601 XMP date, keeping its wall-clock time
+func parseXMPTime(s string) *time.Time {
+	for _, layout := range xmpDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+			return &wall
+		}
+	}
+	return nil
+}
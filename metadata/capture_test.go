@@ -0,0 +1,161 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tiffEntry is an ASCII IFD entry used to build test EXIF blocks
+type tiffEntry struct {
+	tag   uint16
+	value string
+}
+
+// buildTIFF assembles a TIFF structure with the given IFD0 entries and, if
+// any exif entries are given, an EXIF sub-IFD
+func buildTIFF(order binary.ByteOrder, ifd0 []tiffEntry, exif []tiffEntry) []byte {
+	header := []byte("II*\x00\x08\x00\x00\x00")
+	if order == binary.BigEndian {
+		header = []byte("MM\x00*\x00\x00\x00\x08")
+	}
+
+	entryCount := len(ifd0)
+	if len(exif) > 0 {
+		entryCount++
+	}
+	ifd0Size := 2 + 12*entryCount + 4
+	exifOffset := 8 + ifd0Size
+	exifSize := 0
+	if len(exif) > 0 {
+		exifSize = 2 + 12*len(exif) + 4
+	}
+	dataOffset := exifOffset + exifSize
+
+	var data []byte
+	writeIFD := func(entries []tiffEntry, pointer bool) []byte {
+		count := len(entries)
+		if pointer {
+			count++
+		}
+		ifd := make([]byte, 2, 2+12*count+4)
+		order.PutUint16(ifd, uint16(count))
+		for _, entry := range entries {
+			value := append([]byte(entry.value), 0)
+			e := make([]byte, 12)
+			order.PutUint16(e, entry.tag)
+			order.PutUint16(e[2:], tiffTypeASCII)
+			order.PutUint32(e[4:], uint32(len(value)))
+			order.PutUint32(e[8:], uint32(dataOffset+len(data)))
+			data = append(data, value...)
+			ifd = append(ifd, e...)
+		}
+		if pointer {
+			e := make([]byte, 12)
+			order.PutUint16(e, tagExifIFDPointer)
+			order.PutUint16(e[2:], 4) // LONG
+			order.PutUint32(e[4:], 1)
+			order.PutUint32(e[8:], uint32(exifOffset))
+			ifd = append(ifd, e...)
+		}
+		return append(ifd, 0, 0, 0, 0)
+	}
+
+	result := append([]byte{}, header...)
+	result = append(result, writeIFD(ifd0, len(exif) > 0)...)
+	if len(exif) > 0 {
+		result = append(result, writeIFD(exif, false)...)
+	}
+	return append(result, data...)
+}
+
+// exifSegment wraps a TIFF structure in an APP1 EXIF segment
+func exifSegment(tiff []byte) []byte {
+	return appSegment(markerAPP1, append(append([]byte{}, exifSignature...), tiff...))
+}
+
+func TestExtractCaptureTime(t *testing.T) {
+	want := time.Date(2023, 6, 3, 14, 30, 5, 0, time.UTC)
+
+	t.Run("EXIF DateTimeOriginal in JPEG", func(t *testing.T) {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			tiff := buildTIFF(order,
+				[]tiffEntry{{tagDateTime, "2024:01:01 00:00:00"}},
+				[]tiffEntry{{tagDateTimeOriginal, "2023:06:03 14:30:05"}},
+			)
+			got := ExtractCaptureTime(buildJPEG(exifSegment(tiff)))
+
+			require.NotNil(t, got, order.String())
+			assert.True(t, want.Equal(*got), order.String())
+		}
+	})
+
+	t.Run("EXIF falls back to IFD0 DateTime", func(t *testing.T) {
+		tiff := buildTIFF(binary.LittleEndian, []tiffEntry{{tagDateTime, "2023:06:03 14:30:05"}}, nil)
+		got := ExtractCaptureTime(buildJPEG(exifSegment(tiff)))
+
+		require.NotNil(t, got)
+		assert.True(t, want.Equal(*got))
+	})
+
+	t.Run("EXIF in TIFF file", func(t *testing.T) {
+		tiff := buildTIFF(binary.BigEndian, nil, []tiffEntry{{tagDateTimeOriginal, "2023:06:03 14:30:05"}})
+		got := ExtractCaptureTime(tiff)
+
+		require.NotNil(t, got)
+		assert.True(t, want.Equal(*got))
+	})
+
+	t.Run("Blank EXIF date is ignored", func(t *testing.T) {
+		tiff := buildTIFF(binary.LittleEndian, nil, []tiffEntry{{tagDateTimeOriginal, "0000:00:00 00:00:00"}})
+
+		assert.Nil(t, ExtractCaptureTime(buildJPEG(exifSegment(tiff))))
+	})
+
+	t.Run("XMP attribute keeps wall-clock time", func(t *testing.T) {
+		packet := `<x:xmpmeta><rdf:Description xmp:CreateDate="2023-06-03T14:30:05+02:00"/></x:xmpmeta>`
+		data := buildJPEG(appSegment(markerAPP1, append(append([]byte{}, xmpSignature...), packet...)))
+		got := ExtractCaptureTime(data)
+
+		require.NotNil(t, got)
+		assert.True(t, want.Equal(*got))
+	})
+
+	t.Run("XMP element date only", func(t *testing.T) {
+		packet := `<x:xmpmeta><photoshop:DateCreated>2023-06-03</photoshop:DateCreated></x:xmpmeta>`
+		got := ExtractCaptureTime([]byte("\x89PNG\r\n\x1a\n" + packet))
+
+		require.NotNil(t, got)
+		assert.True(t, time.Date(2023, 6, 3, 0, 0, 0, 0, time.UTC).Equal(*got))
+	})
+
+	t.Run("No capture time", func(t *testing.T) {
+		assert.Nil(t, ExtractCaptureTime(buildJPEG()))
+		assert.Nil(t, ExtractCaptureTime([]byte("not an image")))
+	})
+
+	t.Run("Truncated EXIF", func(t *testing.T) {
+		tiff := buildTIFF(binary.LittleEndian, nil, []tiffEntry{{tagDateTimeOriginal, "2023:06:03 14:30:05"}})
+
+		assert.Nil(t, ExtractCaptureTime(buildJPEG(exifSegment(tiff[:30]))))
+	})
+}
+
+func TestReadCaptureTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	tiff := buildTIFF(binary.LittleEndian, nil, []tiffEntry{{tagDateTimeOriginal, "2023:06:03 14:30:05"}})
+	require.NoError(t, os.WriteFile(path, buildJPEG(exifSegment(tiff)), 0644))
+
+	got, err := ReadCaptureTime(path)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, 2023, got.Year())
+
+	_, err = ReadCaptureTime(filepath.Join(t.TempDir(), "missing.jpg"))
+	assert.Error(t, err)
+}
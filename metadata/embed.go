@@ -0,0 +1,145 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// Namespaces of the properties Embed writes
+const (
+	dcNamespace   = "http://purl.org/dc/elements/1.1/"
+	exifNamespace = "http://ns.adobe.com/exif/1.0/"
+)
+
+// embeddedProperties are replaced wholesale by Embed, in attribute or
+// element form, whatever value they had
+var embeddedProperties = []*regexp.Regexp{
+	embeddedProperty("dc:title"),
+	embeddedProperty("dc:description"),
+	embeddedProperty("dc:subject"),
+	embeddedProperty("xmp:Rating"),
+	embeddedProperty("exif:GPSLatitude"),
+	embeddedProperty("exif:GPSLongitude"),
+}
+
+var (
+	rdfEnd     = []byte("</rdf:RDF>")
+	xmpMetaEnd = []byte("</x:xmpmeta>")
+)
+
+func embeddedProperty(name string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(name)
+	return regexp.MustCompile(`(?s)\s+` + quoted + `\s*=\s*"[^"]*"|\s*<` + quoted + `\b[^>]*?(?:/>|>.*?</` + quoted + `>)`)
+}
+
+// Fields is the descriptive metadata Embed writes into a file
+type Fields struct {
+	Title     string
+	Caption   string
+	Keywords  []string
+	Rating    *int
+	Latitude  *float64
+	Longitude *float64
+}
+
+// Embed returns a JPEG whose XMP packet carries fields as dc:title,
+// dc:description, dc:subject, xmp:Rating and exif:GPSLatitude/Longitude.
+// Whatever the packet held for those is replaced, empty fields removing it,
+// and the rest of the file's metadata is kept.
+func Embed(data []byte, fields Fields) ([]byte, error) {
+	return rewriteXMP(data, func(packet []byte) []byte {
+		return setXMPFields(packet, fields)
+	})
+}
+
+// Sidecar returns an XMP sidecar carrying fields, for formats Embed can't
+// rewrite
+func Sidecar(fields Fields) []byte {
+	return setXMPFields([]byte(emptyXMPPacket), fields)
+}
+
+// setXMPFields replaces the properties of fields in packet, adding the new
+// values in a description of their own
+func setXMPFields(packet []byte, fields Fields) []byte {
+	for _, property := range embeddedProperties {
+		packet = property.ReplaceAll(packet, nil)
+	}
+
+	// Descriptions go in the packet's RDF, or one of their own if it has none
+	wrap := false
+	end := bytes.LastIndex(packet, rdfEnd)
+	if end < 0 {
+		if end = bytes.LastIndex(packet, xmpMetaEnd); end < 0 {
+			return setXMPFields([]byte(emptyXMPPacket), fields)
+		}
+		wrap = true
+	}
+
+	var attrs, elements bytes.Buffer
+	if fields.Rating != nil {
+		fmt.Fprintf(&attrs, ` xmp:Rating="%d"`, *fields.Rating)
+	}
+	if fields.Latitude != nil && fields.Longitude != nil {
+		fmt.Fprintf(&attrs, ` exif:GPSLatitude="%s" exif:GPSLongitude="%s"`,
+			xmpCoordinateValue(*fields.Latitude, 'N', 'S'), xmpCoordinateValue(*fields.Longitude, 'E', 'W'))
+	}
+	if fields.Title != "" {
+		elements.WriteString(`   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">`)
+		xml.EscapeText(&elements, []byte(fields.Title))
+		elements.WriteString("</rdf:li></rdf:Alt></dc:title>\n")
+	}
+	if fields.Caption != "" {
+		elements.WriteString(`   <dc:description><rdf:Alt><rdf:li xml:lang="x-default">`)
+		xml.EscapeText(&elements, []byte(fields.Caption))
+		elements.WriteString("</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	if len(fields.Keywords) > 0 {
+		elements.WriteString("   <dc:subject><rdf:Bag>")
+		for _, keyword := range fields.Keywords {
+			elements.WriteString("<rdf:li>")
+			xml.EscapeText(&elements, []byte(keyword))
+			elements.WriteString("</rdf:li>")
+		}
+		elements.WriteString("</rdf:Bag></dc:subject>\n")
+	}
+	if attrs.Len() == 0 && elements.Len() == 0 {
+		return packet
+	}
+
+	var description bytes.Buffer
+	if wrap {
+		description.WriteString(` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	}
+	fmt.Fprintf(&description, `  <rdf:Description rdf:about="" xmlns:dc="%s" xmlns:xmp="%s" xmlns:exif="%s"`, dcNamespace, xmpNamespace, exifNamespace)
+	description.Write(attrs.Bytes())
+	if elements.Len() == 0 {
+		description.WriteString("/>\n ")
+	} else {
+		description.WriteString(">\n")
+		description.Write(elements.Bytes())
+		description.WriteString("  </rdf:Description>\n ")
+	}
+	if wrap {
+		description.WriteString("</rdf:RDF>\n")
+	}
+
+	result := make([]byte, 0, len(packet)+description.Len())
+	result = append(result, packet[:end]...)
+	result = append(result, description.Bytes()...)
+	return append(result, packet[end:]...)
+}
+
+// xmpCoordinateValue formats decimal degrees as an XMP GPS coordinate,
+// "DDD,MM.mmmmmmk" where k is the hemisphere
+func xmpCoordinateValue(degrees float64, positive, negative byte) string {
+	hemisphere := positive
+	if degrees < 0 {
+		hemisphere = negative
+	}
+	degrees = math.Abs(degrees)
+	whole := math.Floor(degrees)
+	return fmt.Sprintf("%d,%.6f%c", int(whole), (degrees-whole)*60, hemisphere)
+}
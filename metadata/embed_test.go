@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbed(t *testing.T) {
+	rating := 4
+	latitude, longitude := 48.858222, -2.2945
+	fields := Fields{
+		Title:     "Tower & river",
+		Caption:   "Evening <light>",
+		Keywords:  []string{"paris", "night"},
+		Rating:    &rating,
+		Latitude:  &latitude,
+		Longitude: &longitude,
+	}
+
+	t.Run("Without XMP", func(t *testing.T) {
+		data, err := Embed(buildJPEG(), fields)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"paris", "night"}, ExtractKeywords(data))
+		require.NotNil(t, ExtractRating(data))
+		assert.Equal(t, 4, *ExtractRating(data))
+		loc := ExtractLocation(data)
+		require.NotNil(t, loc)
+		assert.InDelta(t, latitude, loc.Latitude, 1e-6)
+		assert.InDelta(t, longitude, loc.Longitude, 1e-6)
+		assert.Contains(t, string(data), `<rdf:li xml:lang="x-default">Tower &amp; river</rdf:li>`)
+		assert.Contains(t, string(data), `<rdf:li xml:lang="x-default">Evening &lt;light&gt;</rdf:li>`)
+	})
+
+	t.Run("Replaces stale values and keeps the rest", func(t *testing.T) {
+		packet := fmt.Sprintf(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmp:Rating="1" exif:GPSLatitude="10,0.0N" exif:GPSLongitude="10,0.0E" GCamera:MicroVideo="1" GCamera:MicroVideoOffset="%d">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Old title</rdf:li></rdf:Alt></dc:title>
+<dc:subject><rdf:Bag><rdf:li>old</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description></rdf:RDF></x:xmpmeta>`, 1234)
+		data, err := Embed(buildJPEG(iptcSegment("iptc"), xmpSegment(packet)), fields)
+		require.NoError(t, err)
+
+		text := string(data)
+		assert.NotContains(t, text, "Old title")
+		assert.NotContains(t, text, `xmp:Rating="1"`)
+		assert.Contains(t, text, `GCamera:MicroVideoOffset="1234"`)
+		assert.ElementsMatch(t, []string{"paris", "night", "iptc"}, ExtractKeywords(data))
+		assert.Equal(t, 4, *ExtractRating(data))
+		assert.InDelta(t, latitude, ExtractLocation(data).Latitude, 1e-6)
+	})
+
+	t.Run("Empty fields remove values", func(t *testing.T) {
+		withValues, err := Embed(buildJPEG(), fields)
+		require.NoError(t, err)
+		data, err := Embed(withValues, Fields{})
+		require.NoError(t, err)
+
+		assert.Empty(t, ExtractKeywords(data))
+		assert.Nil(t, ExtractRating(data))
+		assert.Nil(t, ExtractLocation(data))
+		assert.NotContains(t, string(data), "Tower")
+	})
+
+	t.Run("Packet without RDF", func(t *testing.T) {
+		data, err := Embed(buildJPEG(xmpSegment(`<x:xmpmeta><rdf:Description GCamera:MicroVideo="1"/></x:xmpmeta>`)), fields)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `GCamera:MicroVideo="1"`)
+		assert.Equal(t, []string{"paris", "night"}, ExtractKeywords(data))
+	})
+
+	t.Run("Not a JPEG", func(t *testing.T) {
+		_, err := Embed([]byte("\x89PNG\r\n\x1a\n"), fields)
+		assert.Error(t, err)
+	})
+
+	t.Run("Sidecar", func(t *testing.T) {
+		sidecar := Sidecar(fields)
+		assert.Equal(t, []string{"paris", "night"}, ExtractKeywords(sidecar))
+		assert.Equal(t, 4, *ExtractRating(sidecar))
+		assert.InDelta(t, longitude, ExtractLocation(sidecar).Longitude, 1e-6)
+	})
+}
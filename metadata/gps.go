@@ -0,0 +1,195 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EXIF GPS tags
+const (
+	tagGPSIFDPointer   = 0x8825
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+var (
+	xmpLatitudeProperty  = newXMPProperty("exif:GPSLatitude")
+	xmpLongitudeProperty = newXMPProperty("exif:GPSLongitude")
+)
+
+// Location is a position in decimal degrees, positive to the north and east
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// ReadLocation reads a file from disk and returns where it was taken, or nil
+// if the file doesn't record it
+func ReadLocation(path string) (*Location, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractLocation(data), nil
+}
+
+// ExtractLocation returns the GPS position recorded in EXIF, falling back to
+// XMP. Positions outside the valid range are ignored, as is 0,0, which
+// cameras write when they have no fix.
+func ExtractLocation(data []byte) *Location {
+	var loc *Location
+	if isJPEG(data) {
+		for _, seg := range jpegSegments(data) {
+			if seg.marker == markerAPP1 && bytes.HasPrefix(seg.data, exifSignature) {
+				if loc = exifLocation(seg.data[len(exifSignature):]); loc != nil {
+					break
+				}
+			}
+		}
+	} else if isTIFF(data) {
+		loc = exifLocation(data)
+	}
+
+	if loc == nil {
+		if packet := findXMPPacket(data); packet != nil {
+			loc = xmpLocation(packet)
+		}
+	}
+
+	if loc == nil || !loc.valid() {
+		return nil
+	}
+	return loc
+}
+
+// valid reports whether a location is in range and not the 0,0 placeholder
+func (l *Location) valid() bool {
+	if l.Latitude == 0 && l.Longitude == 0 {
+		return false
+	}
+	return l.Latitude >= -90 && l.Latitude <= 90 && l.Longitude >= -180 && l.Longitude <= 180
+}
+
+// exifLocation reads the GPS position from a TIFF-structured EXIF block
+func exifLocation(tiff []byte) *Location {
+	if len(tiff) < 8 {
+		return nil
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+	pointer, ok := ifd0[tagGPSIFDPointer]
+	if !ok || len(pointer) < 4 {
+		return nil
+	}
+	gps := readIFD(tiff, order, order.Uint32(pointer))
+
+	lat, ok := exifCoordinate(tiff, order, gps[tagGPSLatitude], gps[tagGPSLatitudeRef], "S")
+	if !ok {
+		return nil
+	}
+	lon, ok := exifCoordinate(tiff, order, gps[tagGPSLongitude], gps[tagGPSLongitudeRef], "W")
+	if !ok {
+		return nil
+	}
+	return &Location{Latitude: lat, Longitude: lon}
+}
+
+// exifCoordinate converts a GPS coordinate stored as three RATIONALs
+// (degrees, minutes, seconds) at the offset in field to decimal degrees,
+// negated when ref is the negative hemisphere
+func exifCoordinate(tiff []byte, order binary.ByteOrder, field, ref []byte, negative string) (float64, bool) {
+	if len(field) < 4 {
+		return 0, false
+	}
+	start := uint64(order.Uint32(field))
+	if start+24 > uint64(len(tiff)) {
+		return 0, false
+	}
+
+	var value float64
+	for i, scale := range []float64{1, 60, 3600} {
+		num := order.Uint32(tiff[start+uint64(i)*8:])
+		den := order.Uint32(tiff[start+uint64(i)*8+4:])
+		if den == 0 {
+			if num == 0 {
+				continue
+			}
+			return 0, false
+		}
+		value += float64(num) / float64(den) / scale
+	}
+
+	if strings.TrimRight(string(ref), "\x00 ") == negative {
+		value = -value
+	}
+	return value, true
+}
+
+// xmpLocation reads the exif:GPSLatitude and exif:GPSLongitude properties of
+// an XMP packet
+func xmpLocation(packet []byte) *Location {
+	lat, ok := xmpCoordinate(packet, xmpLatitudeProperty, 'N', 'S')
+	if !ok {
+		return nil
+	}
+	lon, ok := xmpCoordinate(packet, xmpLongitudeProperty, 'E', 'W')
+	if !ok {
+		return nil
+	}
+	return &Location{Latitude: lat, Longitude: lon}
+}
+
+// xmpCoordinate parses an XMP GPS coordinate, written as "DDD,MM,SSk" or
+// "DDD,MM.mmk" where k is the hemisphere
+func xmpCoordinate(packet []byte, property xmpProperty, positive, negative byte) (float64, bool) {
+	var raw []byte
+	if match := property.attr.FindSubmatch(packet); match != nil {
+		raw = match[1]
+	} else if match := property.element.FindSubmatch(packet); match != nil {
+		raw = match[1]
+	} else {
+		return 0, false
+	}
+
+	s := strings.TrimSpace(string(raw))
+	if s == "" {
+		return 0, false
+	}
+	hemisphere := s[len(s)-1]
+	if hemisphere != positive && hemisphere != negative {
+		return 0, false
+	}
+
+	parts := strings.Split(s[:len(s)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var value float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		value += n / []float64{1, 60, 3600}[i]
+	}
+
+	if hemisphere == negative {
+		value = -value
+	}
+	return value, true
+}
@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gpsTIFF builds a TIFF whose IFD0 points to a GPS IFD with the given
+// hemisphere references and degree/minute/second rationals (numerator,
+// denominator pairs)
+func gpsTIFF(order binary.ByteOrder, latRef string, lat [6]uint32, lonRef string, lon [6]uint32) []byte {
+	header := []byte("II*\x00\x08\x00\x00\x00")
+	if order == binary.BigEndian {
+		header = []byte("MM\x00*\x00\x00\x00\x08")
+	}
+
+	entry := func(tag, valueType uint16, count uint32, value []byte) []byte {
+		e := make([]byte, 12)
+		order.PutUint16(e, tag)
+		order.PutUint16(e[2:], valueType)
+		order.PutUint32(e[4:], count)
+		copy(e[8:], value)
+		return e
+	}
+	long := func(v uint32) []byte {
+		b := make([]byte, 4)
+		order.PutUint32(b, v)
+		return b
+	}
+
+	// IFD0 with the pointer, then the GPS IFD with four entries, then the rationals
+	gpsOffset := uint32(8 + 2 + 12 + 4)
+	dataOffset := gpsOffset + 2 + 4*12 + 4
+
+	tiff := append([]byte{}, header...)
+	tiff = append(tiff, 0, 0)
+	order.PutUint16(tiff[8:], 1)
+	tiff = append(tiff, entry(tagGPSIFDPointer, 4, 1, long(gpsOffset))...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	count := make([]byte, 2)
+	order.PutUint16(count, 4)
+	tiff = append(tiff, count...)
+	tiff = append(tiff, entry(tagGPSLatitudeRef, tiffTypeASCII, 2, []byte(latRef+"\x00"))...)
+	tiff = append(tiff, entry(tagGPSLatitude, 5, 3, long(dataOffset))...)
+	tiff = append(tiff, entry(tagGPSLongitudeRef, tiffTypeASCII, 2, []byte(lonRef+"\x00"))...)
+	tiff = append(tiff, entry(tagGPSLongitude, 5, 3, long(dataOffset+24))...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	for _, v := range append(lat[:], lon[:]...) {
+		tiff = append(tiff, long(v)...)
+	}
+	return tiff
+}
+
+func TestExtractLocation(t *testing.T) {
+	t.Run("EXIF GPS in JPEG", func(t *testing.T) {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			// 33°51'31.2"S 151°12'54"E
+			tiff := gpsTIFF(order,
+				"S", [6]uint32{33, 1, 51, 1, 312, 10},
+				"E", [6]uint32{151, 1, 1290, 100, 0, 1},
+			)
+			loc := ExtractLocation(buildJPEG(exifSegment(tiff)))
+
+			require.NotNil(t, loc, order.String())
+			assert.InDelta(t, -33.858667, loc.Latitude, 1e-6, order.String())
+			assert.InDelta(t, 151.215, loc.Longitude, 1e-6, order.String())
+		}
+	})
+
+	t.Run("EXIF GPS in TIFF file", func(t *testing.T) {
+		tiff := gpsTIFF(binary.LittleEndian, "N", [6]uint32{48, 1, 51, 1, 0, 0}, "W", [6]uint32{2, 1, 30, 1, 0, 0})
+		loc := ExtractLocation(tiff)
+
+		require.NotNil(t, loc)
+		assert.InDelta(t, 48.85, loc.Latitude, 1e-6)
+		assert.InDelta(t, -2.5, loc.Longitude, 1e-6)
+	})
+
+	t.Run("XMP coordinates", func(t *testing.T) {
+		packet := `<x:xmpmeta><rdf:Description exif:GPSLatitude="40,26.7717N" exif:GPSLongitude="79,58,56W"/></x:xmpmeta>`
+		data := buildJPEG(xmpSegment(packet))
+		loc := ExtractLocation(data)
+
+		require.NotNil(t, loc)
+		assert.InDelta(t, 40.446195, loc.Latitude, 1e-6)
+		assert.InDelta(t, -79.982222, loc.Longitude, 1e-6)
+	})
+
+	t.Run("Missing or invalid positions", func(t *testing.T) {
+		assert.Nil(t, ExtractLocation(buildJPEG()))
+		assert.Nil(t, ExtractLocation([]byte("not an image")))
+
+		// No fix
+		zero := gpsTIFF(binary.LittleEndian, "N", [6]uint32{0, 1, 0, 1, 0, 1}, "E", [6]uint32{0, 1, 0, 1, 0, 1})
+		assert.Nil(t, ExtractLocation(buildJPEG(exifSegment(zero))))
+
+		// Out of range
+		far := gpsTIFF(binary.LittleEndian, "N", [6]uint32{95, 1, 0, 1, 0, 1}, "E", [6]uint32{10, 1, 0, 1, 0, 1})
+		assert.Nil(t, ExtractLocation(buildJPEG(exifSegment(far))))
+
+		// Longitude without a hemisphere
+		packet := `<x:xmpmeta><rdf:Description exif:GPSLatitude="40,26.7717N" exif:GPSLongitude="79,58,56"/></x:xmpmeta>`
+		assert.Nil(t, ExtractLocation(buildJPEG(xmpSegment(packet))))
+	})
+}
@@ -0,0 +1,238 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// JPEG markers and segment signatures used when scanning for embedded metadata
+const (
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerAPP1  = 0xE1
+	markerAPP13 = 0xED
+)
+
+var (
+	xmpSignature       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	photoshopSignature = []byte("Photoshop 3.0\x00")
+	xmpPacketStart     = []byte("<x:xmpmeta")
+	xmpPacketEnd       = []byte("</x:xmpmeta>")
+
+	dcSubjectPattern = regexp.MustCompile(`(?s)<dc:subject[^>]*>(.*?)</dc:subject>`)
+	rdfItemPattern   = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+)
+
+// segment is a single JPEG marker segment
+type segment struct {
+	marker byte
+	data   []byte
+}
+
+// ReadKeywords reads a file from disk and returns its embedded keywords
+func ReadKeywords(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractKeywords(data), nil
+}
+
+// ExtractKeywords returns the de-duplicated IPTC keywords and XMP dc:subject
+// entries embedded in an image, in the order they were found
+func ExtractKeywords(data []byte) []string {
+	var keywords []string
+
+	if isJPEG(data) {
+		for _, seg := range jpegSegments(data) {
+			switch {
+			case seg.marker == markerAPP1 && bytes.HasPrefix(seg.data, xmpSignature):
+				keywords = append(keywords, xmpSubjects(seg.data[len(xmpSignature):])...)
+			case seg.marker == markerAPP13 && bytes.HasPrefix(seg.data, photoshopSignature):
+				keywords = append(keywords, iptcKeywords(seg.data[len(photoshopSignature):])...)
+			}
+		}
+	} else if packet := findXMPPacket(data); packet != nil {
+		// PNG, TIFF and WebP store XMP in format-specific containers, but the
+		// packet itself is always plain XML that can be located directly
+		keywords = append(keywords, xmpSubjects(packet)...)
+	}
+
+	return dedupe(keywords)
+}
+
+// isJPEG reports whether data starts with a JPEG SOI marker
+func isJPEG(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0xFF && data[1] == markerSOI
+}
+
+// jpegSegments walks the marker segments preceding the image data
+func jpegSegments(data []byte) []segment {
+	var segments []segment
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte, skip it
+			pos++
+			continue
+		}
+		if marker == markerSOS || marker == markerEOI {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+
+		segments = append(segments, segment{marker: marker, data: data[pos+4 : pos+2+length]})
+		pos += 2 + length
+	}
+
+	return segments
+}
+
+// findXMPPacket locates a raw XMP packet anywhere in the file
+func findXMPPacket(data []byte) []byte {
+	start := bytes.Index(data, xmpPacketStart)
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(data[start:], xmpPacketEnd)
+	if end < 0 {
+		return nil
+	}
+	return data[start : start+end+len(xmpPacketEnd)]
+}
+
+// xmpSubjects extracts the dc:subject bag entries from an XMP packet
+func xmpSubjects(packet []byte) []string {
+	var subjects []string
+
+	for _, match := range dcSubjectPattern.FindAllSubmatch(packet, -1) {
+		for _, item := range rdfItemPattern.FindAllSubmatch(match[1], -1) {
+			subjects = append(subjects, html.UnescapeString(string(item[1])))
+		}
+	}
+
+	return subjects
+}
+
+// iptcKeywords extracts IPTC Keywords (2:25) from Photoshop image resource blocks
+func iptcKeywords(resources []byte) []string {
+	var keywords []string
+
+	pos := 0
+	for pos+12 <= len(resources) {
+		if !bytes.Equal(resources[pos:pos+4], []byte("8BIM")) {
+			break
+		}
+		resourceID := binary.BigEndian.Uint16(resources[pos+4 : pos+6])
+		pos += 6
+
+		// Pascal string name, padded to an even length
+		nameLength := int(resources[pos]) + 1
+		if nameLength%2 != 0 {
+			nameLength++
+		}
+		pos += nameLength
+		if pos+4 > len(resources) {
+			break
+		}
+
+		size := int(binary.BigEndian.Uint32(resources[pos : pos+4]))
+		pos += 4
+		if size < 0 || pos+size > len(resources) {
+			break
+		}
+
+		if resourceID == 0x0404 {
+			keywords = append(keywords, iptcDatasets(resources[pos:pos+size], 2, 25)...)
+		}
+
+		pos += size
+		if size%2 != 0 {
+			pos++
+		}
+	}
+
+	return keywords
+}
+
+// iptcDatasets returns the values of every IPTC dataset matching record:dataset
+func iptcDatasets(data []byte, record, dataset byte) []string {
+	var values []string
+
+	pos := 0
+	for pos+5 <= len(data) {
+		if data[pos] != 0x1C {
+			break
+		}
+		rec, ds := data[pos+1], data[pos+2]
+		size := int(binary.BigEndian.Uint16(data[pos+3 : pos+5]))
+		pos += 5
+
+		// Extended datasets encode the size in the following N bytes
+		if size&0x8000 != 0 {
+			n := size & 0x7FFF
+			if n > 4 || pos+n > len(data) {
+				break
+			}
+			size = 0
+			for _, b := range data[pos : pos+n] {
+				size = size<<8 | int(b)
+			}
+			pos += n
+		}
+		if pos+size > len(data) {
+			break
+		}
+
+		if rec == record && ds == dataset {
+			values = append(values, decodeText(data[pos:pos+size]))
+		}
+		pos += size
+	}
+
+	return values
+}
+
+// decodeText interprets IPTC text as UTF-8, falling back to Latin-1
+func decodeText(raw []byte) string {
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// dedupe trims keywords and removes empty and repeated entries
+func dedupe(keywords []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" || seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		result = append(result, keyword)
+	}
+
+	return result
+}
@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildJPEG assembles a minimal JPEG byte stream from APPn segments
+func buildJPEG(segments ...[]byte) []byte {
+	data := []byte{0xFF, markerSOI}
+	for _, seg := range segments {
+		data = append(data, seg...)
+	}
+	return append(data, 0xFF, markerEOI)
+}
+
+// appSegment wraps a payload in a JPEG marker segment
+func appSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// iptcSegment builds an APP13 Photoshop segment holding IPTC keywords
+func iptcSegment(keywords ...string) []byte {
+	var iptc []byte
+	for _, keyword := range keywords {
+		iptc = append(iptc, 0x1C, 2, 25, 0, 0)
+		binary.BigEndian.PutUint16(iptc[len(iptc)-2:], uint16(len(keyword)))
+		iptc = append(iptc, keyword...)
+	}
+
+	resource := []byte("8BIM")
+	resource = append(resource, 0x04, 0x04, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(resource[len(resource)-4:], uint32(len(iptc)))
+	resource = append(resource, iptc...)
+	if len(iptc)%2 != 0 {
+		resource = append(resource, 0)
+	}
+
+	return appSegment(markerAPP13, append(append([]byte{}, photoshopSignature...), resource...))
+}
+
+func TestExtractKeywords(t *testing.T) {
+	t.Run("XMP dc:subject in JPEG", func(t *testing.T) {
+		packet := `<x:xmpmeta><rdf:RDF><rdf:Description><dc:subject><rdf:Bag>` +
+			`<rdf:li>travel</rdf:li><rdf:li>Rock &amp; Roll</rdf:li></rdf:Bag></dc:subject>` +
+			`</rdf:Description></rdf:RDF></x:xmpmeta>`
+		data := buildJPEG(appSegment(markerAPP1, append(append([]byte{}, xmpSignature...), packet...)))
+
+		assert.Equal(t, []string{"travel", "Rock & Roll"}, ExtractKeywords(data))
+	})
+
+	t.Run("IPTC keywords in JPEG", func(t *testing.T) {
+		data := buildJPEG(iptcSegment("family", "birthday"))
+
+		assert.Equal(t, []string{"family", "birthday"}, ExtractKeywords(data))
+	})
+
+	t.Run("IPTC Latin-1 keyword", func(t *testing.T) {
+		data := buildJPEG(iptcSegment("caf\xe9"))
+
+		assert.Equal(t, []string{"café"}, ExtractKeywords(data))
+	})
+
+	t.Run("Duplicates across IPTC and XMP are merged", func(t *testing.T) {
+		packet := `<x:xmpmeta><dc:subject><rdf:Bag><rdf:li> family </rdf:li><rdf:li>summer</rdf:li></rdf:Bag></dc:subject></x:xmpmeta>`
+		data := buildJPEG(
+			iptcSegment("family"),
+			appSegment(markerAPP1, append(append([]byte{}, xmpSignature...), packet...)),
+		)
+
+		assert.Equal(t, []string{"family", "summer"}, ExtractKeywords(data))
+	})
+
+	t.Run("Raw XMP packet in non-JPEG file", func(t *testing.T) {
+		data := []byte("\x89PNG\r\n\x1a\n...iTXtXML:com.adobe.xmp\x00\x00\x00\x00\x00" +
+			`<x:xmpmeta><dc:subject><rdf:Bag><rdf:li>scan</rdf:li></rdf:Bag></dc:subject></x:xmpmeta>`)
+
+		assert.Equal(t, []string{"scan"}, ExtractKeywords(data))
+	})
+
+	t.Run("No metadata", func(t *testing.T) {
+		assert.Empty(t, ExtractKeywords(buildJPEG()))
+		assert.Empty(t, ExtractKeywords([]byte("not an image")))
+	})
+}
+
+func TestRatingWriteBack(t *testing.T) {
+	t.Run("Set, replace and remove rating in packet", func(t *testing.T) {
+		three, four := 3, 4
+
+		packet := setXMPRating([]byte(emptyXMPPacket), &three)
+		assert.Equal(t, 3, *ExtractRating(packet))
+
+		packet = setXMPRating(packet, &four)
+		assert.Equal(t, 4, *ExtractRating(packet))
+		assert.Equal(t, 1, bytes.Count(packet, []byte("xmp:Rating")))
+
+		packet = setXMPRating(packet, nil)
+		assert.Nil(t, ExtractRating(packet))
+	})
+
+	t.Run("Element-style rating is replaced", func(t *testing.T) {
+		two := 2
+		packet := []byte(`<x:xmpmeta><rdf:RDF><rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/">` +
+			`<xmp:Rating>5</xmp:Rating></rdf:Description></rdf:RDF></x:xmpmeta>`)
+
+		packet = setXMPRating(packet, &two)
+		assert.Equal(t, 2, *ExtractRating(packet))
+		assert.NotContains(t, string(packet), "<xmp:Rating>")
+		assert.Equal(t, 1, bytes.Count(packet, []byte("xmlns:xmp=")))
+	})
+
+	t.Run("Embed rating keeps existing keywords", func(t *testing.T) {
+		packet := `<x:xmpmeta><rdf:RDF><rdf:Description><dc:subject><rdf:Bag><rdf:li>kept</rdf:li>` +
+			`</rdf:Bag></dc:subject></rdf:Description></rdf:RDF></x:xmpmeta>`
+		path := filepath.Join(t.TempDir(), "photo.jpg")
+		require.NoError(t, os.WriteFile(path, buildJPEG(appSegment(markerAPP1, append(append([]byte{}, xmpSignature...), packet...))), 0644))
+
+		one := 1
+		require.NoError(t, EmbedRating(path, &one))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 1, *ExtractRating(data))
+		assert.Equal(t, []string{"kept"}, ExtractKeywords(data))
+		assert.Len(t, jpegSegments(data), 1, "Existing XMP segment should be replaced, not duplicated")
+	})
+
+	t.Run("Sidecar is created next to the image", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "IMG_0001.png")
+		five := 5
+
+		require.NoError(t, WriteSidecarRating(path, &five))
+
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(path), "IMG_0001.xmp"))
+		require.NoError(t, err)
+		assert.Equal(t, 5, *ExtractRating(data))
+	})
+
+	t.Run("Embedding into non-JPEG fails", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "photo.png")
+		require.NoError(t, os.WriteFile(path, []byte("\x89PNG"), 0644))
+
+		assert.Error(t, EmbedRating(path, nil))
+	})
+}
@@ -0,0 +1,116 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// Samsung writes this marker right before the clip it appends to the JPEG
+	samsungMotionMarker = []byte("MotionPhoto_Data")
+
+	// Google camera XMP: the legacy MicroVideo offset counts back from the end
+	// of the file, the newer container lists the clip as a sized item
+	microVideoOffset  = newXMPProperty("GCamera:MicroVideoOffset")
+	motionItemPattern = regexp.MustCompile(`(?s)<Container:Item\b[^>]*\bItem:Semantic\s*=\s*"MotionPhoto"[^>]*>`)
+	itemLengthPattern = regexp.MustCompile(`\bItem:Length\s*=\s*"(\d+)"`)
+)
+
+// MotionVideo is the location of the clip embedded in a Motion Photo
+type MotionVideo struct {
+	Offset int64
+	Length int64
+}
+
+// ReadMotionVideo reads a file from disk and returns its embedded clip, or
+// nil if it isn't a Motion Photo
+func ReadMotionVideo(path string) (*MotionVideo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FindMotionVideo(data), nil
+}
+
+// FindMotionVideo locates the MP4 clip that Samsung and Google cameras append
+// to the JPEG of a Motion Photo
+func FindMotionVideo(data []byte) *MotionVideo {
+	if !isJPEG(data) {
+		return nil
+	}
+
+	var candidates []int64
+	if packet := findXMPPacket(data); packet != nil {
+		if match := microVideoOffset.attr.FindSubmatch(packet); match != nil {
+			if n, err := strconv.ParseInt(string(match[1]), 10, 64); err == nil {
+				candidates = append(candidates, int64(len(data))-n)
+			}
+		}
+		if item := motionItemPattern.Find(packet); item != nil {
+			if match := itemLengthPattern.FindSubmatch(item); match != nil {
+				if n, err := strconv.ParseInt(string(match[1]), 10, 64); err == nil {
+					candidates = append(candidates, int64(len(data))-n)
+				}
+			}
+		}
+	}
+	if i := bytes.LastIndex(data, samsungMotionMarker); i >= 0 {
+		candidates = append(candidates, int64(i+len(samsungMotionMarker)))
+	}
+
+	for _, offset := range candidates {
+		if offset <= 0 || offset >= int64(len(data)) {
+			continue
+		}
+		if length := mp4Length(data[offset:]); length > 0 {
+			return &MotionVideo{Offset: offset, Length: length}
+		}
+	}
+	return nil
+}
+
+// mp4Length returns the size of the MP4 file at the start of data by walking
+// its top-level boxes, or 0 if data doesn't start with one. Trailing bytes
+// (such as Samsung's SEF trailer) are not counted.
+func mp4Length(data []byte) int64 {
+	if len(data) < 8 || string(data[4:8]) != "ftyp" {
+		return 0
+	}
+
+	var pos int64
+	end := int64(len(data))
+	for pos+8 <= end {
+		size := int64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if !isBoxType(data[pos+4 : pos+8]) {
+			break
+		}
+		switch size {
+		case 0:
+			// The last box extends to the end of the file
+			return end
+		case 1:
+			if pos+16 > end {
+				return pos
+			}
+			size = int64(binary.BigEndian.Uint64(data[pos+8 : pos+16]))
+		}
+		if size < 8 || pos+size > end {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+// isBoxType reports whether b looks like an MP4 box type (four printable ASCII bytes)
+func isBoxType(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mp4Box builds an MP4 box with the given type and payload
+func mp4Box(boxType string, payload []byte) []byte {
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box, uint32(8+len(payload)))
+	copy(box[4:], boxType)
+	return append(box, payload...)
+}
+
+// testClip is a minimal MP4 made of ftyp, moov and mdat boxes
+func testClip() []byte {
+	clip := mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isommp41"))
+	clip = append(clip, mp4Box("moov", make([]byte, 16))...)
+	return append(clip, mp4Box("mdat", []byte("frames"))...)
+}
+
+// xmpSegment wraps an XMP packet in an APP1 segment
+func xmpSegment(packet string) []byte {
+	return appSegment(markerAPP1, append(append([]byte{}, xmpSignature...), packet...))
+}
+
+func TestFindMotionVideo(t *testing.T) {
+	clip := testClip()
+
+	t.Run("Google MicroVideo", func(t *testing.T) {
+		packet := fmt.Sprintf(`<x:xmpmeta><rdf:Description GCamera:MicroVideo="1" GCamera:MicroVideoOffset="%d"/></x:xmpmeta>`, len(clip))
+		still := buildJPEG(xmpSegment(packet))
+		data := append(still, clip...)
+
+		video := FindMotionVideo(data)
+		require.NotNil(t, video)
+		assert.Equal(t, int64(len(still)), video.Offset)
+		assert.Equal(t, int64(len(clip)), video.Length)
+	})
+
+	t.Run("Google container item", func(t *testing.T) {
+		packet := fmt.Sprintf(`<x:xmpmeta><Container:Directory><rdf:Seq>
+			<rdf:li><Container:Item Item:Mime="image/jpeg" Item:Semantic="Primary"/></rdf:li>
+			<rdf:li><Container:Item Item:Mime="video/mp4" Item:Semantic="MotionPhoto" Item:Length="%d"/></rdf:li>
+		</rdf:Seq></Container:Directory></x:xmpmeta>`, len(clip))
+		still := buildJPEG(xmpSegment(packet))
+
+		video := FindMotionVideo(append(still, clip...))
+		require.NotNil(t, video)
+		assert.Equal(t, int64(len(still)), video.Offset)
+	})
+
+	t.Run("Samsung trailer", func(t *testing.T) {
+		still := buildJPEG()
+		data := append(append(append(still, samsungMotionMarker...), clip...), []byte("SEFH\x00\x00\x00\x00SEFT")...)
+
+		video := FindMotionVideo(data)
+		require.NotNil(t, video)
+		assert.Equal(t, int64(len(still)+len(samsungMotionMarker)), video.Offset)
+		assert.Equal(t, int64(len(clip)), video.Length, "trailer after the clip is excluded")
+	})
+
+	t.Run("Plain JPEG", func(t *testing.T) {
+		assert.Nil(t, FindMotionVideo(buildJPEG()))
+	})
+
+	t.Run("Offset not pointing at a clip", func(t *testing.T) {
+		packet := `<x:xmpmeta><rdf:Description GCamera:MicroVideoOffset="4"/></x:xmpmeta>`
+		assert.Nil(t, FindMotionVideo(append(buildJPEG(xmpSegment(packet)), "abcd"...)))
+
+		packet = `<x:xmpmeta><rdf:Description GCamera:MicroVideoOffset="999999"/></x:xmpmeta>`
+		assert.Nil(t, FindMotionVideo(buildJPEG(xmpSegment(packet))))
+	})
+
+	t.Run("Not a JPEG", func(t *testing.T) {
+		assert.Nil(t, FindMotionVideo(clip))
+	})
+}
+
+func TestReadMotionVideo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "motion.jpg")
+	data := append(append(buildJPEG(), samsungMotionMarker...), testClip()...)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	video, err := ReadMotionVideo(path)
+	require.NoError(t, err)
+	assert.NotNil(t, video)
+
+	_, err = ReadMotionVideo(filepath.Join(t.TempDir(), "missing.jpg"))
+	assert.Error(t, err)
+}
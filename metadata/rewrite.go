@@ -0,0 +1,92 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	tagOrientation = 0x0112
+
+	markerAPP0 = 0xE0
+	markerCOM  = 0xFE
+)
+
+// CarryOver returns a re-encoded JPEG with the metadata segments (EXIF, XMP,
+// IPTC, comments) of the original it replaces, followed by any Motion Photo
+// clip the original had appended. The EXIF orientation is reset to normal
+// because the new pixels are already upright. Non-JPEG data is returned
+// unchanged.
+func CarryOver(original, encoded []byte) []byte {
+	if !isJPEG(original) || !isJPEG(encoded) {
+		return encoded
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(original) + len(encoded))
+	out.Write(encoded[:2])
+
+	for _, seg := range jpegSegments(original) {
+		if (seg.marker < markerAPP0 || seg.marker > 0xEF) && seg.marker != markerCOM {
+			continue
+		}
+		data := seg.data
+		if seg.marker == markerAPP1 && bytes.HasPrefix(data, exifSignature) {
+			data = append([]byte{}, data...)
+			resetOrientation(data[len(exifSignature):])
+		}
+		header := []byte{0xFF, seg.marker, 0, 0}
+		binary.BigEndian.PutUint16(header[2:], uint16(len(data)+2))
+		out.Write(header)
+		out.Write(data)
+	}
+	out.Write(encoded[2:])
+
+	// Clip offsets are counted back from the end of the file, so they stay
+	// valid when everything after the image moves along unchanged
+	if FindMotionVideo(original) != nil {
+		if end := imageEnd(original); end > 0 {
+			out.Write(original[end:])
+		}
+	}
+	return out.Bytes()
+}
+
+// resetOrientation sets the orientation tag of a TIFF-structured EXIF block
+// to 1 (upright) in place, if it has one
+func resetOrientation(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	// readIFD hands back the value field itself, not a copy
+	if field, ok := readIFD(tiff, order, order.Uint32(tiff[4:8]))[tagOrientation]; ok {
+		order.PutUint16(field, 1)
+	}
+}
+
+// imageEnd returns the offset just past a JPEG's EOI marker, or 0 if it has
+// none. Marker bytes can't occur in the entropy-coded data, so the first EOI
+// after the headers ends the image.
+func imageEnd(data []byte) int {
+	pos := 2
+	if segments := jpegSegments(data); len(segments) > 0 {
+		// Segments are slices of data, so their capacity gives their position
+		last := segments[len(segments)-1].data
+		pos = len(data) - cap(last) + len(last)
+	}
+	if i := bytes.Index(data[pos:], []byte{0xFF, markerEOI}); i >= 0 {
+		return pos + i + 2
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orientationTIFF builds a little-endian TIFF whose IFD0 holds only an
+// orientation entry
+func orientationTIFF(orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry, tagOrientation)
+	binary.LittleEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	return append(append(tiff, entry...), 0, 0, 0, 0)
+}
+
+func TestCarryOver(t *testing.T) {
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 30, 20)), nil))
+
+	t.Run("Metadata, orientation and motion clip", func(t *testing.T) {
+		clip := testClip()
+		packet := fmt.Sprintf(`<x:xmpmeta><rdf:Description GCamera:MicroVideoOffset="%d"/></x:xmpmeta>`, len(clip))
+		original := append(buildJPEG(exifSegment(orientationTIFF(6)), xmpSegment(packet), iptcSegment("beach")), clip...)
+
+		result := CarryOver(original, encoded.Bytes())
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(result))
+		require.NoError(t, err)
+		assert.Equal(t, 30, cfg.Width)
+		assert.Equal(t, []string{"beach"}, ExtractKeywords(result))
+
+		video := FindMotionVideo(result)
+		require.NotNil(t, video)
+		assert.Equal(t, clip, result[video.Offset:video.Offset+video.Length])
+
+		for _, seg := range jpegSegments(result) {
+			if seg.marker == markerAPP1 && bytes.HasPrefix(seg.data, exifSignature) {
+				ifd0 := readIFD(seg.data[len(exifSignature):], binary.LittleEndian, 8)
+				assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(ifd0[tagOrientation]))
+			}
+		}
+
+		// The original is left alone
+		assert.Contains(t, string(original), string(orientationTIFF(6)))
+	})
+
+	t.Run("Nothing to carry over", func(t *testing.T) {
+		result := CarryOver(buildJPEG(), encoded.Bytes())
+		assert.Equal(t, encoded.Bytes(), result)
+
+		png := []byte("\x89PNG\r\n\x1a\n")
+		assert.Equal(t, png, CarryOver(buildJPEG(iptcSegment("beach")), png))
+	})
+}
@@ -0,0 +1,206 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	xmpNamespace = "http://ns.adobe.com/xap/1.0/"
+
+	// emptyXMPPacket is the skeleton used when a file or sidecar has no XMP yet
+	emptyXMPPacket = `<?xpacket begin="` + "\xEF\xBB\xBF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+	// maxSegmentPayload is the largest payload a single JPEG segment can hold
+	maxSegmentPayload = 0xFFFF - 2
+)
+
+var (
+	ratingAttrPattern    = regexp.MustCompile(`\s+xmp:Rating\s*=\s*"([^"]*)"`)
+	ratingElementPattern = regexp.MustCompile(`(?s)\s*<xmp:Rating>(.*?)</xmp:Rating>`)
+	descriptionPattern   = regexp.MustCompile(`<rdf:Description\b`)
+	xmpNamespacePattern  = regexp.MustCompile(`xmlns:xmp\s*=\s*"` + regexp.QuoteMeta(xmpNamespace) + `"`)
+)
+
+// SidecarPath returns the XMP sidecar path for an image (IMG_0001.jpg -> IMG_0001.xmp)
+func SidecarPath(imagePath string) string {
+	return strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".xmp"
+}
+
+// ExtractRating returns the xmp:Rating stored in an image or sidecar, if any
+func ExtractRating(data []byte) *int {
+	packet := findXMPPacket(data)
+	if packet == nil {
+		return nil
+	}
+
+	var raw []byte
+	if match := ratingAttrPattern.FindSubmatch(packet); match != nil {
+		raw = match[1]
+	} else if match := ratingElementPattern.FindSubmatch(packet); match != nil {
+		raw = match[1]
+	} else {
+		return nil
+	}
+
+	rating, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil
+	}
+	return &rating
+}
+
+// WriteSidecarRating creates or updates the XMP sidecar next to an image so
+// that its xmp:Rating matches rating (nil removes the rating)
+func WriteSidecarRating(imagePath string, rating *int) error {
+	sidecar := SidecarPath(imagePath)
+
+	packet := []byte(emptyXMPPacket)
+	if existing, err := os.ReadFile(sidecar); err == nil {
+		if found := findXMPPacket(existing); found != nil {
+			packet = existing
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read sidecar: %w", err)
+	}
+
+	return writeFileAtomic(sidecar, setXMPRating(packet, rating))
+}
+
+// EmbedRating rewrites a JPEG so that its XMP packet carries rating (nil
+// removes the rating), inserting an XMP segment if the file has none
+func EmbedRating(imagePath string, rating *int) error {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return err
+	}
+	out, err := rewriteXMP(data, func(packet []byte) []byte {
+		return setXMPRating(packet, rating)
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(imagePath, out)
+}
+
+// rewriteXMP returns a JPEG with its XMP packet replaced by edit's version
+// of it, inserting an XMP segment if the file has none
+func rewriteXMP(data []byte, edit func(packet []byte) []byte) ([]byte, error) {
+	if !isJPEG(data) {
+		return nil, fmt.Errorf("embedding XMP is only supported for JPEG files")
+	}
+
+	// Locate an existing XMP segment, remembering where new segments may be
+	// inserted (after JFIF/EXIF headers, which must stay first)
+	insertAt := 2
+	var xmpStart, xmpEnd int
+	var packet []byte
+
+	pos := 2
+	for _, seg := range jpegSegments(data) {
+		length := len(seg.data) + 4
+		if seg.marker == markerAPP1 && bytes.HasPrefix(seg.data, xmpSignature) {
+			xmpStart, xmpEnd = pos, pos+length
+			packet = seg.data[len(xmpSignature):]
+			break
+		}
+		if seg.marker == 0xE0 || seg.marker == markerAPP1 {
+			insertAt = pos + length
+		}
+		pos += length
+	}
+
+	if packet == nil {
+		packet = []byte(emptyXMPPacket)
+		xmpStart, xmpEnd = insertAt, insertAt
+	}
+
+	payload := append(append([]byte{}, xmpSignature...), edit(packet)...)
+	if len(payload) > maxSegmentPayload {
+		return nil, fmt.Errorf("XMP packet too large to embed")
+	}
+
+	segment := []byte{0xFF, markerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	var out bytes.Buffer
+	out.Grow(len(data) + len(segment))
+	out.Write(data[:xmpStart])
+	out.Write(segment)
+	out.Write(data[xmpEnd:])
+
+	return out.Bytes(), nil
+}
+
+// setXMPRating replaces any xmp:Rating in packet with rating
+func setXMPRating(packet []byte, rating *int) []byte {
+	packet = ratingAttrPattern.ReplaceAll(packet, nil)
+	packet = ratingElementPattern.ReplaceAll(packet, nil)
+
+	if rating == nil {
+		return packet
+	}
+
+	loc := descriptionPattern.FindIndex(packet)
+	if loc == nil {
+		// No description to attach to, start from a fresh packet
+		return setXMPRating([]byte(emptyXMPPacket), rating)
+	}
+
+	attrs := fmt.Sprintf(` xmp:Rating="%d"`, *rating)
+	if !xmpNamespacePattern.Match(packet) {
+		attrs = ` xmlns:xmp="` + xmpNamespace + `"` + attrs
+	}
+
+	result := make([]byte, 0, len(packet)+len(attrs))
+	result = append(result, packet[:loc[1]]...)
+	result = append(result, attrs...)
+	return append(result, packet[loc[1]:]...)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+// so a failure never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Preserve the permissions of the file being replaced
+	if info, err := os.Stat(path); err == nil {
+		os.Chmod(tmpPath, info.Mode().Perm())
+	} else {
+		os.Chmod(tmpPath, 0644)
+	}
+
+	return os.Rename(tmpPath, path)
+}
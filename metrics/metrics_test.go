@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("Counters and gauges", func(t *testing.T) {
+		registry := NewRegistry()
+		requests := registry.NewCounter("requests_total", "Requests handled", "method", "status")
+		queue := registry.NewGauge("queue_depth", "Jobs waiting")
+
+		requests.Inc("GET", "200")
+		requests.Inc("GET", "200")
+		requests.Add(3, "POST", "201")
+		requests.Add(-1, "POST", "201") // Counters never go down
+		queue.Set(4)
+
+		var out bytes.Buffer
+		require.NoError(t, registry.WriteText(&out))
+		assert.Equal(t, `# HELP requests_total Requests handled
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="201"} 3
+# HELP queue_depth Jobs waiting
+# TYPE queue_depth gauge
+queue_depth 4
+`, out.String())
+		assert.Equal(t, float64(2), requests.Value("GET", "200"))
+	})
+
+	t.Run("Histograms are cumulative", func(t *testing.T) {
+		registry := NewRegistry()
+		latency := registry.NewHistogram("latency_seconds", "Latency", []float64{1, 0.1}, "route")
+
+		latency.Observe(0.05, "/a")
+		latency.Observe(0.1, "/a") // Bounds are inclusive
+		latency.Observe(0.5, "/a")
+		latency.Observe(7, "/a")
+
+		var out bytes.Buffer
+		require.NoError(t, registry.WriteText(&out))
+		assert.Equal(t, `# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 3
+latency_seconds_bucket{route="/a",le="+Inf"} 4
+latency_seconds_sum{route="/a"} 7.65
+latency_seconds_count{route="/a"} 4
+`, out.String())
+		assert.Equal(t, uint64(4), latency.Count("/a"))
+	})
+
+	t.Run("Label values are escaped", func(t *testing.T) {
+		registry := NewRegistry()
+		gauge := registry.NewGauge("g", "Gauge", "name")
+		gauge.Set(1, "a \"quoted\"\\ name\n")
+
+		var out bytes.Buffer
+		require.NoError(t, registry.WriteText(&out))
+		assert.Contains(t, out.String(), `g{name="a \"quoted\"\\ name\n"} 1`)
+	})
+
+	t.Run("Reset drops gauge series", func(t *testing.T) {
+		registry := NewRegistry()
+		gauge := registry.NewGauge("g", "Gauge", "library")
+		gauge.Set(1, "old")
+		gauge.Reset()
+		gauge.Set(2, "new")
+
+		var out bytes.Buffer
+		require.NoError(t, registry.WriteText(&out))
+		assert.NotContains(t, out.String(), "old")
+		assert.Contains(t, out.String(), `g{library="new"} 2`)
+	})
+
+	t.Run("Wrong label count panics", func(t *testing.T) {
+		registry := NewRegistry()
+		counter := registry.NewCounter("c", "Counter", "a", "b")
+		assert.Panics(t, func() { counter.Inc("only-one") })
+	})
+}
@@ -0,0 +1,25 @@
+package metrics
+
+// Default is the registry served at /metrics
+var Default = NewRegistry()
+
+// Server metrics, the gauges are refreshed each time /metrics is scraped
+var (
+	HTTPRequests = Default.NewCounter("photos_http_requests_total",
+		"HTTP requests handled, by method, route and status code", "method", "route", "status")
+	HTTPRequestDuration = Default.NewHistogram("photos_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by method and route", DefBuckets, "method", "route")
+	UploadBytes = Default.NewCounter("photos_upload_bytes_total",
+		"Bytes of uploaded files stored")
+	UploadedFiles = Default.NewCounter("photos_uploaded_files_total",
+		"Uploaded files stored")
+
+	DBConnections = Default.NewGauge("photos_db_connections",
+		"Database connections in the pool, by state (in_use or idle)", "state")
+	LibraryStorageBytes = Default.NewGauge("photos_library_storage_bytes",
+		"Bytes taken by each library's photos, including the trash", "library_id", "tenant")
+	LibraryPhotos = Default.NewGauge("photos_library_photos",
+		"Photos in each library, including the trash", "library_id", "tenant")
+	JobQueueDepth = Default.NewGauge("photos_job_queue_depth",
+		"Background jobs waiting for a worker")
+)
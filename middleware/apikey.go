@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/apikeys"
+	"photo-library-server/config"
+	"photo-library-server/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// signedFileKey marks requests that got past APIKeyMiddleware without a key
+// because they are for a file, SignedURLMiddleware then insists on a signature
+const signedFileKey = "signed_file_required"
+
+// signedFileRoutes are the routes served by SignedURLMiddleware
+var signedFileRoutes = []string{"/photos/:id/file", "/photos/:id/thumbnail", "/photos/:id/motion", "/photos/:id/preview"}
+
+// APIKeyMiddleware authenticates requests carrying an X-API-Key header and
+// limits them to their key's scope. Requests without a key are let through
+// unless cfg.RequireAPIKey is set, file requests then need a signed URL
+// instead. Keys are looked up within the request's tenant, so it must run
+// after TenantMiddleware.
+func APIKeyMiddleware(db *gorm.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Batch sub-requests run with the key of their batch
+		scope, ok := apikeys.ScopeFromContext(c.Request.Context())
+		if !ok {
+			key := c.GetHeader(apikeys.Header)
+			switch {
+			case key != "":
+				if scope, ok = authenticateAPIKey(c, db, cfg, key); !ok {
+					apierror.Abort(c, http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
+					return
+				}
+				c.Request = c.Request.WithContext(apikeys.WithScope(c.Request.Context(), scope))
+			case cfg.RequireAPIKey && isSignedFileRoute(c.FullPath()):
+				c.Set(signedFileKey, true)
+				c.Next()
+				return
+			case cfg.RequireAPIKey:
+				apierror.Abort(c, http.StatusUnauthorized, "api_key_required", "API key required")
+				return
+			default:
+				c.Next()
+				return
+			}
+		}
+
+		if !apikeys.Allows(scope, c.Request.Method, c.FullPath()) {
+			apierror.Abort(c, http.StatusForbidden, "api_key_scope_denied", "API key scope does not allow this request")
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminKeyMiddleware limits routes whose data spans tenants, such as
+// database backups, to the admin key in multi-tenant mode. Otherwise the
+// scope checks of APIKeyMiddleware are enough.
+func AdminKeyMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.TenantMode != TenantModeHeader && cfg.TenantMode != TenantModeSubdomain {
+			c.Next()
+			return
+		}
+		key := c.GetHeader(apikeys.Header)
+		if cfg.AdminAPIKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) != 1 {
+			apierror.Abort(c, http.StatusForbidden, "admin_key_required", "Only the admin API key may make this request")
+			return
+		}
+		c.Next()
+	}
+}
+
+// BasicAuthKeyMiddleware lets clients that can only send a username and
+// password, such as WebDAV mounts, authenticate with an API key as the
+// password. It must run before APIKeyMiddleware.
+func BasicAuthKeyMiddleware(realm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, password, ok := c.Request.BasicAuth(); ok && c.GetHeader(apikeys.Header) == "" {
+			c.Request.Header.Set(apikeys.Header, password)
+		}
+		if c.GetHeader(apikeys.Header) == "" {
+			// Clients only ask their user for credentials when challenged
+			c.Header("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+		}
+		c.Next()
+	}
+}
+
+// authenticateAPIKey returns the scope of key, which is either the configured
+// admin key or a stored key of the request's tenant
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, cfg *config.Config, key string) (string, bool) {
+	if cfg.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) == 1 {
+		return apikeys.ScopeFull, true
+	}
+
+	var apiKey models.APIKey
+	scoped := db.WithContext(c.Request.Context())
+	if err := scoped.Where("key_hash = ?", apikeys.Hash(key)).First(&apiKey).Error; err != nil {
+		return "", false
+	}
+
+	// Record use without writing on every request
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+		scoped.Model(&apiKey).UpdateColumn("last_used_at", now)
+	}
+	return apiKey.Scope, true
+}
+
+// isSignedFileRoute reports whether route serves files through SignedURLMiddleware
+func isSignedFileRoute(route string) bool {
+	for _, r := range signedFileRoutes {
+		if strings.HasSuffix(route, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"photo-library-server/config"
+	"photo-library-server/throttle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// throttledResponseWriter routes response bodies through a throttle.Writer
+type throttledResponseWriter struct {
+	gin.ResponseWriter
+	body *throttle.Writer
+}
+
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+func (w *throttledResponseWriter) WriteString(s string) (int, error) {
+	return w.body.Write([]byte(s))
+}
+
+// BandwidthLimitMiddleware caps how fast file responses are sent. Each request
+// is limited to cfg.DownloadRateLimit bytes/s and all requests passing through
+// the returned handler share cfg.GlobalDownloadRateLimit bytes/s. A limit of 0
+// disables that cap.
+func BandwidthLimitMiddleware(cfg *config.Config) gin.HandlerFunc {
+	global := throttle.NewBucket(cfg.GlobalDownloadRateLimit)
+
+	return func(c *gin.Context) {
+		perConnection := throttle.NewBucket(cfg.DownloadRateLimit)
+		if perConnection == nil && global == nil {
+			c.Next()
+			return
+		}
+
+		// The throttle.Writer writes to the original writer, which keeps
+		// status and header handling in gin's hands
+		original := c.Writer
+		c.Writer = &throttledResponseWriter{
+			ResponseWriter: original,
+			body:           throttle.NewWriter(c.Request.Context(), original, perConnection, global),
+		}
+		defer func() { c.Writer = original }()
+
+		c.Next()
+	}
+}
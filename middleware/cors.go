@@ -2,23 +2,181 @@ package middleware
 
 import (
 	"net/http"
+	"photo-library-server/config"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORSMiddleware handles CORS headers
-func CORSMiddleware() gin.HandlerFunc {
+// corsPolicy is the parsed CORS configuration
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool // Lowercased exact origins
+	wildcards   []originWildcard
+	methods     map[string]bool
+	methodList  string
+	anyHeader   bool
+	headers     map[string]bool // Canonical header names
+	headerList  string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// originWildcard matches the subdomains of a host, https://*.example.com is
+// {"https://", ".example.com"}
+type originWildcard struct {
+	scheme string
+	suffix string
+}
+
+func newCORSPolicy(cfg *config.Config) *corsPolicy {
+	p := &corsPolicy{
+		origins:     map[string]bool{},
+		methods:     map[string]bool{},
+		headers:     map[string]bool{},
+		exposed:     strings.Join(cfg.CORSExposedHeaders, ", "),
+		credentials: cfg.CORSAllowCredentials,
+	}
+	for _, origin := range cfg.CORSAllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			scheme, suffix, _ := strings.Cut(origin, "://*")
+			p.wildcards = append(p.wildcards, originWildcard{scheme: scheme + "://", suffix: suffix})
+		default:
+			p.origins[origin] = true
+		}
+	}
+
+	var methods []string
+	for _, method := range cfg.CORSAllowedMethods {
+		method = strings.ToUpper(method)
+		p.methods[method] = true
+		methods = append(methods, method)
+	}
+	p.methodList = strings.Join(methods, ", ")
+
+	var headers []string
+	for _, header := range cfg.CORSAllowedHeaders {
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+		headers = append(headers, header)
+	}
+	// Browsers must be able to send the tenant header
+	if cfg.TenantMode == TenantModeHeader && !p.anyHeader && !p.headers[http.CanonicalHeaderKey(cfg.TenantHeader)] {
+		p.headers[http.CanonicalHeaderKey(cfg.TenantHeader)] = true
+		headers = append(headers, cfg.TenantHeader)
+	}
+	p.headerList = strings.Join(headers, ", ")
+
+	if cfg.CORSMaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+	}
+	return p
+}
+
+// allowsOrigin reports whether requests from origin may be answered
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, wildcard := range p.wildcards {
+		// The subdomain must not be empty: https://.example.com isn't one
+		if strings.HasPrefix(origin, wildcard.scheme) && strings.HasSuffix(origin, wildcard.suffix) &&
+			len(origin) > len(wildcard.scheme)+len(wildcard.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether every header in a preflight's
+// Access-Control-Request-Headers list is allowed
+func (p *corsPolicy) allowsHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// CORSMiddleware answers cross-origin requests from browsers according to
+// the configured policy. Preflight requests are answered here with 204 No
+// Content, or 403 Forbidden if the origin, method or headers aren't allowed;
+// other requests from disallowed origins are served without CORS headers,
+// so browsers keep their responses from scripts.
+func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
+	policy := newCORSPolicy(cfg)
+
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, HEAD, PATCH, OPTIONS, GET, PUT, DELETE")
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
+		// Responses differ by origin, caches must keep them apart
+		c.Writer.Header().Add("Vary", "Origin")
+		if origin == "" {
+			c.Next()
 			return
 		}
 
-		c.Next()
+		if !policy.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if policy.anyOrigin && !policy.credentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if policy.credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if policy.exposed != "" {
+				c.Header("Access-Control-Expose-Headers", policy.exposed)
+			}
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		method := strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))
+		requested := c.GetHeader("Access-Control-Request-Headers")
+		if !policy.methods[method] || !policy.allowsHeaders(requested) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Header("Access-Control-Allow-Methods", policy.methodList)
+		if policy.anyHeader {
+			if requested != "" {
+				c.Header("Access-Control-Allow-Headers", requested)
+			}
+		} else if policy.headerList != "" {
+			c.Header("Access-Control-Allow-Headers", policy.headerList)
+		}
+		if policy.maxAge != "" {
+			c.Header("Access-Control-Max-Age", policy.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
 	}
 }
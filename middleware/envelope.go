@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"photo-library-server/apierror"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnvelopeVersion is reported in the meta of every envelope
+const EnvelopeVersion = "v2"
+
+// envelope is the shape of every JSON response under /api/v2
+type envelope struct {
+	Data   interface{}     `json:"data"`
+	Meta   gin.H           `json:"meta"`
+	Errors []envelopeError `json:"errors"`
+}
+
+// envelopeError describes one failure in an envelope
+type envelopeError struct {
+	Status  int                        `json:"status"`
+	Code    string                     `json:"code"` // Stable identifier such as library_not_found
+	Message string                     `json:"message"`
+	Details map[string]json.RawMessage `json:"details,omitempty"` // Other fields of the v1 error body
+}
+
+// Write modes of an envelopeWriter, decided on the first write
+const (
+	envelopeUndecided = iota
+	envelopeBuffer
+	envelopePassthrough
+)
+
+// envelopeWriter buffers JSON responses so they can be wrapped once the
+// handler is done, and passes anything else (files, archives) straight through
+type envelopeWriter struct {
+	gin.ResponseWriter
+	status int
+	mode   int
+	body   bytes.Buffer
+}
+
+func (w *envelopeWriter) decide() {
+	if w.mode != envelopeUndecided {
+		return
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.mode = envelopeBuffer
+		return
+	}
+	w.mode = envelopePassthrough
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *envelopeWriter) WriteHeader(code int) {
+	w.status = code
+	if w.mode == envelopePassthrough {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *envelopeWriter) WriteHeaderNow() {
+	if w.mode == envelopePassthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *envelopeWriter) Write(p []byte) (int, error) {
+	w.decide()
+	if w.mode == envelopeBuffer {
+		return w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *envelopeWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *envelopeWriter) Written() bool {
+	return w.mode == envelopeBuffer || w.ResponseWriter.Written()
+}
+
+func (w *envelopeWriter) Flush() {
+	if w.mode == envelopePassthrough {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// EnvelopeMiddleware wraps the JSON responses of the handlers after it in a
+// consistent {data, meta, errors} envelope, so v2 can share v1's handlers.
+// Error bodies become entries in errors and pagination moves into meta.
+func EnvelopeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		writer := &envelopeWriter{ResponseWriter: original}
+		c.Writer = writer
+		defer func() { c.Writer = original }()
+
+		c.Next()
+
+		switch writer.mode {
+		case envelopePassthrough:
+			return
+		case envelopeUndecided:
+			// Bodiless responses only need their status
+			if writer.status != 0 {
+				original.WriteHeader(writer.status)
+			}
+			return
+		}
+
+		status := writer.Status()
+		wrapped := wrapResponse(status, writer.body.Bytes())
+		data, err := json.Marshal(wrapped)
+		if err != nil {
+			status = http.StatusInternalServerError
+			data, _ = json.Marshal(envelope{
+				Meta:   gin.H{"api_version": EnvelopeVersion},
+				Errors: []envelopeError{{Status: status, Code: apierror.CodeInternal, Message: "Failed to encode response"}},
+			})
+		}
+
+		original.Header().Set("Content-Type", "application/json; charset=utf-8")
+		original.WriteHeader(status)
+		original.Write(data)
+	}
+}
+
+// wrapResponse builds the envelope for a v1 response body
+func wrapResponse(status int, body []byte) envelope {
+	wrapped := envelope{Meta: gin.H{"api_version": EnvelopeVersion}, Errors: []envelopeError{}}
+
+	var fields map[string]json.RawMessage
+	isObject := json.Unmarshal(body, &fields) == nil
+
+	if status >= http.StatusBadRequest {
+		failure := envelopeError{Status: status, Message: http.StatusText(status)}
+		if isObject {
+			var message string
+			if json.Unmarshal(fields["error"], &message) == nil && message != "" {
+				failure.Message = message
+				delete(fields, "error")
+			}
+			if json.Unmarshal(fields["code"], &failure.Code) == nil {
+				delete(fields, "code")
+			}
+			if len(fields) > 0 {
+				failure.Details = fields
+			}
+		}
+		wrapped.Errors = append(wrapped.Errors, failure)
+		return wrapped
+	}
+
+	// Paginated lists ({"photos": [...], "pagination": {...}}) become the
+	// list itself, with the pagination in meta
+	if pagination, ok := fields["pagination"]; ok && isObject && len(fields) == 2 {
+		wrapped.Meta["pagination"] = pagination
+		delete(fields, "pagination")
+		for _, list := range fields {
+			wrapped.Data = list
+		}
+		return wrapped
+	}
+
+	wrapped.Data = json.RawMessage(body)
+	return wrapped
+}
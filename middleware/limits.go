@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"photo-library-server/apierror"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutWriter holds back error responses written after the request's
+// deadline passed, they are replaced with a timeout error
+type timeoutWriter struct {
+	gin.ResponseWriter
+	deadline time.Time
+	timedOut bool
+}
+
+// expired reports whether the deadline passed. The request context can't
+// tell, the server cancels it when the read deadline ends its background read
+func (w *timeoutWriter) expired() bool {
+	return !time.Now().Before(w.deadline)
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest && !w.Written() && w.expired() {
+		w.timedOut = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.timedOut {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	if w.timedOut {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.timedOut {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// TimeoutMiddleware gives requests passing through the returned handler
+// timeout to finish. The request context expires at the deadline, reading the
+// request body fails after it, and a handler failing past it responds with
+// 503 Service Unavailable. A timeout of 0 disables the limit.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		deadline := time.Now().Add(timeout)
+		ctx, cancel := context.WithDeadline(c.Request.Context(), deadline)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		// Stalled uploads would otherwise hold the handler until the client gives up,
+		// not every writer supports read deadlines (tests, batch sub-requests)
+		_ = http.NewResponseController(c.Writer).SetReadDeadline(deadline)
+
+		original := c.Writer
+		writer := &timeoutWriter{ResponseWriter: original, deadline: deadline}
+		c.Writer = writer
+		defer func() { c.Writer = original }()
+
+		c.Next()
+
+		if writer.timedOut || (!original.Written() && writer.expired()) {
+			c.Writer = original
+			apierror.Abort(c, http.StatusServiceUnavailable, "request_timeout", "Request timed out")
+		}
+	}
+}
+
+// ConcurrencyLimitMiddleware lets at most limit requests through the returned
+// handler at once. Requests beyond that are turned away with 503 Service
+// Unavailable and a Retry-After header rather than queued, so bursts can't
+// pile up memory and file handles. A limit of 0 disables the cap.
+func ConcurrencyLimitMiddleware(limit int) gin.HandlerFunc {
+	slots := make(chan struct{}, max(limit, 0))
+
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			c.Header("Retry-After", "1")
+			apierror.Abort(c, http.StatusServiceUnavailable, "server_busy", "Server is busy, try again later")
+			return
+		}
+		defer func() { <-slots }()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"log/slog"
+	"photo-library-server/logging"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID, in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs accepted from clients and proxies,
+// anything else is replaced so IDs can't inject into logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware gives every request an ID, returned in the X-Request-ID
+// header and carried in the request context for logging. An ID sent by the
+// client or a proxy is kept; batch sub-requests share their batch's ID.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := logging.RequestID(c.Request.Context())
+		if !ok {
+			id = c.GetHeader(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = uuid.New().String()
+			}
+			c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		}
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// LoggerMiddleware logs one structured line per request once it is handled,
+// at error level for 5xx responses, warn for 4xx and info otherwise. It must
+// run after RequestIDMiddleware.
+func LoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path // Handlers may rewrite it
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if id, ok := logging.RequestID(c.Request.Context()); ok {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
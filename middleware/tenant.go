@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"photo-library-server/apierror"
+	"photo-library-server/config"
+	"photo-library-server/tenant"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tenant modes, see config.TenantMode
+const (
+	TenantModeHeader    = "header"
+	TenantModeSubdomain = "subdomain"
+)
+
+// TenantMiddleware scopes requests to the tenant named by the configured
+// header or subdomain, so handlers only see that tenant's records. Requests
+// without a valid tenant are rejected; it does nothing when multi-tenant mode
+// is off.
+func TenantMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Batch sub-requests inherit the tenant of the batch
+		if _, ok := tenant.FromContext(c.Request.Context()); ok {
+			c.Next()
+			return
+		}
+
+		var id string
+		switch cfg.TenantMode {
+		case TenantModeHeader:
+			id = c.GetHeader(cfg.TenantHeader)
+		case TenantModeSubdomain:
+			id = subdomain(c.Request.Host, cfg.TenantDomain)
+		default:
+			c.Next()
+			return
+		}
+
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			apierror.Abort(c, http.StatusBadRequest, "tenant_required", "Tenant is required")
+			return
+		}
+		if !tenant.ValidID(id) {
+			apierror.Abort(c, http.StatusBadRequest, "invalid_tenant_id", "Invalid tenant ID")
+			return
+		}
+
+		c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// subdomain returns the label of host directly under domain, or "" when host
+// isn't a subdomain of it
+func subdomain(host, domain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	domain = strings.ToLower(strings.Trim(domain, "."))
+	if domain == "" {
+		return ""
+	}
+
+	label, ok := strings.CutSuffix(host, "."+domain)
+	if !ok || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
@@ -0,0 +1,55 @@
+package models
+
+import "encoding/json"
+
+// Relations are omitted from JSON when they weren't loaded (nil) but always
+// present, as [] when empty, when they were. A plain omitempty tag can't tell
+// the two apart, so each model marshals its relations through pointers.
+
+// relation returns nil for an unloaded relation so omitempty drops it
+func relation[T any](items []T) *[]T {
+	if items == nil {
+		return nil
+	}
+	return &items
+}
+
+// MarshalJSON implements json.Marshaler
+func (l Library) MarshalJSON() ([]byte, error) {
+	type library Library
+	return json.Marshal(struct {
+		library
+		Albums *[]Album `json:"albums,omitempty"`
+		Photos *[]Photo `json:"photos,omitempty"`
+	}{library(l), relation(l.Albums), relation(l.Photos)})
+}
+
+// MarshalJSON implements json.Marshaler
+func (a Album) MarshalJSON() ([]byte, error) {
+	type album Album
+	return json.Marshal(struct {
+		album
+		Photos *[]Photo `json:"photos,omitempty"`
+		Tags   *[]Tag   `json:"tags,omitempty"`
+	}{album(a), relation(a.Photos), relation(a.Tags)})
+}
+
+// MarshalJSON implements json.Marshaler
+func (p Photo) MarshalJSON() ([]byte, error) {
+	type photo Photo
+	return json.Marshal(struct {
+		photo
+		Tags   *[]Tag   `json:"tags,omitempty"`
+		Albums *[]Album `json:"albums,omitempty"`
+	}{photo(p), relation(p.Tags), relation(p.Albums)})
+}
+
+// MarshalJSON implements json.Marshaler
+func (t Tag) MarshalJSON() ([]byte, error) {
+	type tag Tag
+	return json.Marshal(struct {
+		tag
+		Photos *[]Photo `json:"photos,omitempty"`
+		Albums *[]Album `json:"albums,omitempty"`
+	}{tag(t), relation(t.Photos), relation(t.Albums)})
+}
@@ -1,71 +1,189 @@
 package models
 
 import (
+	"strconv"
 	"time"
 
+	"photo-library-server/edits"
+	"photo-library-server/tenant"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // Library represents a photo library with a unique name
 type Library struct {
-	ID          uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
-	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
-	Description string    `json:"description"`
-	Images      string    `json:"images" gorm:"uniqueIndex;not null"` // Filepath where photos are stored
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Albums      []Album   `json:"albums,omitempty" gorm:"foreignKey:LibraryID"`
-	Photos      []Photo   `json:"photos,omitempty" gorm:"foreignKey:LibraryID"`
+	ID                 uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID           string    `json:"tenant_id,omitempty" gorm:"uniqueIndex:idx_libraries_tenant_name,priority:1;not null;default:''"` // Owning tenant in multi-tenant mode
+	Name               string    `json:"name" gorm:"uniqueIndex:idx_libraries_tenant_name,priority:2;not null"`                           // Unique per tenant
+	Description        string    `json:"description" gorm:"not null;default:''"`
+	Images             string    `json:"images" gorm:"uniqueIndex;not null"`    // Filepath where photos are stored
+	ImportKeywords     bool      `json:"import_keywords" gorm:"default:false"`  // Create tags from embedded IPTC/XMP keywords on upload
+	ThumbnailMode      string    `json:"thumbnail_mode" gorm:"default:lazy"`    // When renditions are generated: eager, background or lazy
+	AcceptDocuments    bool      `json:"accept_documents" gorm:"default:false"` // Accept PDFs (e.g. scanned letters) alongside photos
+	Encrypted          bool      `json:"encrypted" gorm:"default:false"`        // Store files encrypted at rest, set on creation only
+	Watch              bool      `json:"watch" gorm:"default:false"`            // Import files dropped into the images directory
+	ReadOnly           bool      `json:"read_only" gorm:"default:false"`        // Reject uploads, deletes, copies in and photo edits, for finished archives
+	QuotaBytes         int64     `json:"quota_bytes" gorm:"default:0"`          // Most bytes the library's photos may take up, 0 for no limit
+	TrashRetentionDays *int      `json:"trash_retention_days"`                  // Overrides TRASH_RETENTION_DAYS when set, 0 keeps deleted photos until purged by hand
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	Albums             []Album   `json:"albums,omitempty" gorm:"foreignKey:LibraryID"`
+	Photos             []Photo   `json:"photos,omitempty" gorm:"foreignKey:LibraryID"`
 }
 
 // Album represents a photo album within a library
 type Album struct {
-	ID          uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
-	Name        string    `json:"name" gorm:"not null"`
-	Description string    `json:"description"`
-	LibraryID   uuid.UUID `json:"library_id" gorm:"type:char(36);not null;index"`
-	Library     Library   `json:"library,omitempty" gorm:"foreignKey:LibraryID"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Photos      []Photo   `json:"photos,omitempty" gorm:"many2many:album_photos;"`
+	ID           uuid.UUID  `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID     string     `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	Name         string     `json:"name" gorm:"not null"`
+	Description  string     `json:"description"`
+	LibraryID    uuid.UUID  `json:"library_id" gorm:"type:char(36);not null;index"`
+	Library      Library    `json:"library,omitempty" gorm:"foreignKey:LibraryID"`
+	StartDate    *time.Time `json:"start_date"`                                 // Earliest capture date of the member photos, kept up to date on changes
+	EndDate      *time.Time `json:"end_date"`                                   // Latest capture date of the member photos
+	CoverPhotoID *uuid.UUID `json:"cover_photo_id" gorm:"type:char(36)"`        // Chosen cover, unset to use the first photo
+	CoverPhoto   *Photo     `json:"cover_photo,omitempty" gorm:"-"`             // Resolved cover, filled in on album responses
+	SortMode     string     `json:"sort_mode" gorm:"not null;default:'manual'"` // Order of the photos: manual, uploaded_at, taken_at, filename or rating
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Photos       []Photo    `json:"photos,omitempty" gorm:"many2many:album_photos;"`
+	Tags         []Tag      `json:"tags,omitempty" gorm:"many2many:album_tags;"`
 }
 
 // Photo represents a photo with metadata
 type Photo struct {
-	ID           uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
-	Filename     string    `json:"filename" gorm:"not null"`
-	OriginalName string    `json:"original_name" gorm:"not null"`
-	FilePath     string    `json:"file_path" gorm:"not null"`
-	MimeType     string    `json:"mime_type" gorm:"not null"`
-	FileSize     int64     `json:"file_size" gorm:"not null"`
-	Width        int       `json:"width"`
-	Height       int       `json:"height"`
-	Rating       *int      `json:"rating" gorm:"check:rating >= 0 AND rating <= 5"` // 0-5, nullable
-	LibraryID    uuid.UUID `json:"library_id" gorm:"type:char(36);not null;index"`
-	Library      Library   `json:"library,omitempty" gorm:"foreignKey:LibraryID"`
-	UploadedAt   time.Time `json:"uploaded_at"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Tags         []Tag     `json:"tags,omitempty" gorm:"many2many:photo_tags;"`
-	Albums       []Album   `json:"albums,omitempty" gorm:"many2many:album_photos;"`
-}
-
-// Tag represents a textual tag that can be applied to photos
+	ID             uuid.UUID      `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID       string         `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	Filename       string         `json:"filename" gorm:"not null"`
+	OriginalName   string         `json:"original_name" gorm:"not null"`
+	FilePath       string         `json:"file_path" gorm:"not null"`
+	MimeType       string         `json:"mime_type" gorm:"not null"`
+	FileSize       int64          `json:"file_size" gorm:"not null"`
+	Checksum       string         `json:"checksum,omitempty"`           // SHA-256 of the file contents, hex encoded
+	PerceptualHash string         `json:"-" gorm:"not null;default:''"` // Hash of the pixels, see thumbnails.Hash, empty until computed
+	Width          int            `json:"width"`
+	Height         int            `json:"height"`
+	Rating         *int           `json:"rating" gorm:"check:rating >= 0 AND rating <= 5"` // 0-5, nullable
+	Title          string         `json:"title" gorm:"not null;default:''"`                // Short name shown instead of the filename
+	Caption        string         `json:"caption" gorm:"not null;default:''"`              // One or two lines shown under the photo
+	Description    string         `json:"description" gorm:"not null;default:''"`          // Longer free-form notes
+	Favorite       bool           `json:"favorite" gorm:"default:false;index"`
+	StorageTier    string         `json:"storage_tier" gorm:"default:hot;index"` // hot (library directory) or cold (secondary storage)
+	Missing        bool           `json:"missing" gorm:"default:false;index"`    // Set by a rescan when the file is no longer on disk
+	Corrupt        bool           `json:"corrupt" gorm:"default:false;index"`    // Set by verification when the file no longer matches its checksum
+	VerifiedAt     *time.Time     `json:"verified_at"`                           // When verification last read the whole file
+	LibraryID      uuid.UUID      `json:"library_id" gorm:"type:char(36);not null;index"`
+	Library        Library        `json:"library,omitempty" gorm:"foreignKey:LibraryID"`
+	TakenAt        *time.Time     `json:"taken_at" gorm:"index"`                                 // Capture time from EXIF/XMP, camera wall-clock time
+	Latitude       *float64       `json:"latitude" gorm:"index:idx_photos_location,priority:1"`  // Decimal degrees from EXIF/XMP GPS or set by hand, north positive
+	Longitude      *float64       `json:"longitude" gorm:"index:idx_photos_location,priority:2"` // Decimal degrees, east positive
+	Country        string         `json:"country" gorm:"not null;default:'';index"`              // ISO 3166-1 alpha-2 code, from reverse geocoding
+	City           string         `json:"city" gorm:"not null;default:'';index"`
+	Place          string         `json:"place" gorm:"not null;default:''"` // Most specific named place, e.g. a landmark or neighbourhood
+	GeocodedAt     *time.Time     `json:"-"`                                // When the position was last looked up, nil if it still needs to be
+	ClassifiedAt   *time.Time     `json:"-"`                                // When tags were last suggested by the classifier, nil if they still need to be
+	FacesFoundAt   *time.Time     `json:"-"`                                // When faces were last detected, nil if they still need to be
+	HasMotion      bool           `json:"has_motion"`                       // Motion Photo with an embedded video clip
+	PageCount      int            `json:"page_count,omitempty"`             // Pages in a document, 0 for photos
+	RawFormat      string         `json:"raw_format,omitempty"`             // Camera RAW type (CR2, NEF, ARW or DNG), empty for other files
+	Duration       float64        `json:"duration,omitempty"`               // Length of a video in seconds, 0 for photos
+	Encrypted      bool           `json:"encrypted"`                        // File is stored encrypted with its library's key
+	EditVersion    int            `json:"edit_version" gorm:"default:0"`    // Number of the PhotoVersion served, 0 for the original
+	UploadedAt     time.Time      `json:"uploaded_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"deleted_at" gorm:"index"` // Set while the photo is in the trash, hidden from queries unless Unscoped
+	Tags           []Tag          `json:"tags,omitempty" gorm:"many2many:photo_tags;"`
+	Albums         []Album        `json:"albums,omitempty" gorm:"many2many:album_photos;"`
+	FileURL        string         `json:"file_url" gorm:"-"`              // URL for fetching the file, signed when URL signing is enabled
+	ThumbnailURL   string         `json:"thumbnail_url" gorm:"-"`         // URL for fetching a rendition, add size=small|medium to choose one
+	MotionURL      string         `json:"motion_url,omitempty" gorm:"-"`  // URL for fetching the embedded clip of a Motion Photo
+	PreviewURL     string         `json:"preview_url,omitempty" gorm:"-"` // URL for fetching the JPEG preview embedded in a RAW file
+}
+
+// Tag represents a textual tag that can be applied to photos and albums
 type Tag struct {
+	ID          uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID    string    `json:"tenant_id,omitempty" gorm:"uniqueIndex:idx_tags_tenant_name,priority:1;not null;default:''"` // Owning tenant in multi-tenant mode
+	Name        string    `json:"name" gorm:"uniqueIndex:idx_tags_tenant_name,priority:2;not null"`                           // Unique per tenant
+	Description string    `json:"description"`                                                                                // What the tag means, for curated vocabularies
+	Color       string    `json:"color"`                                                                                      // Optional hex color for UI
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Photos      []Photo   `json:"photos,omitempty" gorm:"many2many:photo_tags;"`
+	Albums      []Album   `json:"albums,omitempty" gorm:"many2many:album_tags;"`
+}
+
+// TagAlias is an alternative name for a tag, such as NYC for New York. Tags
+// named by an alias in uploads and filters resolve to the tag.
+type TagAlias struct {
 	ID        uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
-	Name      string    `json:"name" gorm:"uniqueIndex;not null"`
-	Color     string    `json:"color"` // Optional hex color for UI
+	TenantID  string    `json:"tenant_id,omitempty" gorm:"uniqueIndex:idx_tag_aliases_tenant_name,priority:1;not null;default:''"` // Owning tenant in multi-tenant mode
+	TagID     uuid.UUID `json:"tag_id" gorm:"type:char(36);not null;index"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_tag_aliases_tenant_name,priority:2;not null"` // Unique per tenant, and never also a tag's name
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Photos    []Photo   `json:"photos,omitempty" gorm:"many2many:photo_tags;"`
+}
+
+// TagSuggestion is a tag the classifier proposed for a photo. It becomes a
+// tag of the photo once accepted; rejected ones are kept so the same label
+// isn't suggested again.
+type TagSuggestion struct {
+	ID         uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID   string    `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	PhotoID    uuid.UUID `json:"photo_id" gorm:"type:char(36);uniqueIndex:idx_tag_suggestions_photo_name,priority:1;not null"`
+	Name       string    `json:"name" gorm:"uniqueIndex:idx_tag_suggestions_photo_name,priority:2;not null"` // Normalized tag name
+	Confidence float64   `json:"confidence" gorm:"not null"`                                                 // From 0 to 1
+	Status     string    `json:"status" gorm:"not null;default:pending;index"`                               // pending, accepted or rejected
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Person is a cluster of faces that look alike, unnamed until someone names
+// it. New faces join the person whose centroid, the mean of the embeddings
+// clustered so far, is most similar.
+type Person struct {
+	ID            uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID      string    `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	Name          string    `json:"name" gorm:"not null;default:'';index"`                // Empty for unnamed clusters
+	Centroid      []byte    `json:"-"`                                                    // Mean face embedding, see faces.EncodeEmbedding
+	CentroidFaces int       `json:"-" gorm:"not null;default:0"`                          // Embeddings averaged into Centroid
+	FaceCount     int64     `json:"face_count" gorm:"->;-:migration"`                     // Selected on responses, faces in photos outside the trash
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Face is a face found in a photo. Its box is given as fractions of the
+// photo's width and height from the top left corner.
+type Face struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID   string     `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	PhotoID    uuid.UUID  `json:"photo_id" gorm:"type:char(36);not null;index"`
+	PersonID   *uuid.UUID `json:"person_id" gorm:"type:char(36);index"` // nil when removed from its person
+	Person     *Person    `json:"person,omitempty" gorm:"foreignKey:PersonID"`
+	X          float64    `json:"x"`
+	Y          float64    `json:"y"`
+	Width      float64    `json:"width"`
+	Height     float64    `json:"height"`
+	Confidence float64    `json:"confidence"` // From 0 to 1
+	Embedding  []byte     `json:"-" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 // PhotoTag represents the many-to-many relationship between photos and tags
 type PhotoTag struct {
-	PhotoID uuid.UUID `gorm:"type:char(36);primaryKey"`
+	PhotoID   uuid.UUID `gorm:"type:char(36);primaryKey"`
+	TagID     uuid.UUID `gorm:"type:char(36);primaryKey"`
+	Photo     Photo     `gorm:"foreignKey:PhotoID"`
+	Tag       Tag       `gorm:"foreignKey:TagID"`
+	CreatedAt time.Time `gorm:"index"` // When the tag was applied to the photo
+}
+
+// AlbumTag represents the many-to-many relationship between albums and tags
+type AlbumTag struct {
+	AlbumID uuid.UUID `gorm:"type:char(36);primaryKey"`
 	TagID   uuid.UUID `gorm:"type:char(36);primaryKey"`
-	Photo   Photo     `gorm:"foreignKey:PhotoID"`
+	Album   Album     `gorm:"foreignKey:AlbumID"`
 	Tag     Tag       `gorm:"foreignKey:TagID"`
 }
 
@@ -78,11 +196,87 @@ type AlbumPhoto struct {
 	Order   int       `gorm:"default:0"` // For ordering photos within an album
 }
 
+// PhotoMetadata is a custom key/value field on a photo, for details such as
+// client names or project codes
+type PhotoMetadata struct {
+	PhotoID   uuid.UUID `gorm:"type:char(36);primaryKey"`
+	Key       string    `gorm:"primaryKey;size:64;index:idx_photo_metadata_key_value,priority:1"`
+	Value     string    `gorm:"not null;index:idx_photo_metadata_key_value,priority:2"`
+	Photo     Photo     `gorm:"foreignKey:PhotoID"`
+	UpdatedAt time.Time
+}
+
+// APIKey lets scripts call the API without interactive auth. Only a hash of
+// the key is stored, the key itself is shown once when it is created.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID   string     `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	Name       string     `json:"name" gorm:"not null"`
+	Scope      string     `json:"scope" gorm:"not null"`         // read, upload or full
+	Prefix     string     `json:"prefix" gorm:"not null"`        // Start of the key, to tell keys apart
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"` // SHA-256 of the key, hex encoded
+	LastUsedAt *time.Time `json:"last_used_at"`                  // Updated at most once a minute
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// AlbumShare is a link giving anyone who has it read-only access to an
+// album, without an API key
+type AlbumShare struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID     string     `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	AlbumID      uuid.UUID  `json:"album_id" gorm:"type:char(36);not null;index"`
+	Token        string     `json:"token" gorm:"uniqueIndex;not null"` // Random, identifies the share in its URL
+	PasswordHash string     `json:"-" gorm:"not null;default:''"`      // bcrypt hash, empty for shares anyone with the link can open
+	ExpiresAt    *time.Time `json:"expires_at"`                        // The share stops working after this, never when unset
+	CreatedAt    time.Time  `json:"created_at"`
+	HasPassword  bool       `json:"has_password" gorm:"-"`
+	URL          string     `json:"url" gorm:"-"` // Path of the shared gallery
+}
+
+// PhotoVersion is a saved edit stack of a photo. Edits are applied when the
+// photo is served, its file is never changed.
+type PhotoVersion struct {
+	ID         uuid.UUID         `json:"id" gorm:"type:char(36);primaryKey"`
+	TenantID   string            `json:"tenant_id,omitempty" gorm:"not null;default:'';index"` // Owning tenant in multi-tenant mode
+	PhotoID    uuid.UUID         `json:"photo_id" gorm:"type:char(36);not null;uniqueIndex:idx_photo_versions_number,priority:1"`
+	Number     int               `json:"number" gorm:"not null;uniqueIndex:idx_photo_versions_number,priority:2"` // Counts up from 1 per photo, never reused
+	Operations []edits.Operation `json:"operations" gorm:"serializer:json;not null"`                              // Applied to the original in order
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// Thumbnail generation modes for libraries
+const (
+	ThumbnailModeEager      = "eager"      // Generated synchronously during upload
+	ThumbnailModeBackground = "background" // Queued as a background job after upload
+	ThumbnailModeLazy       = "lazy"       // Generated and cached on first request
+)
+
+// Review states of tag suggestions
+const (
+	SuggestionPending  = "pending"  // Waiting for review
+	SuggestionAccepted = "accepted" // Applied to the photo as a tag
+	SuggestionRejected = "rejected" // Dismissed, not suggested again
+)
+
+// Storage tiers for photo originals
+const (
+	StorageTierHot  = "hot"  // Stored in the library's images directory
+	StorageTierCold = "cold" // Moved to the configured cold storage path
+)
+
+// FileURLFunc builds the URLs handed to clients for file access from a path
+// and a version of the file's contents. It is set at startup so that signed
+// and CDN URLs can be issued without models depending on config.
+var FileURLFunc func(path, version string) string
+
 // BeforeCreate hook to generate UUID before creating records
 func (l *Library) BeforeCreate(tx *gorm.DB) (err error) {
 	if l.ID == uuid.Nil {
 		l.ID = uuid.New()
 	}
+	if l.TenantID == "" {
+		l.TenantID = contextTenant(tx)
+	}
 	return
 }
 
@@ -90,6 +284,9 @@ func (a *Album) BeforeCreate(tx *gorm.DB) (err error) {
 	if a.ID == uuid.Nil {
 		a.ID = uuid.New()
 	}
+	if a.TenantID == "" {
+		a.TenantID = contextTenant(tx)
+	}
 	return
 }
 
@@ -100,6 +297,12 @@ func (p *Photo) BeforeCreate(tx *gorm.DB) (err error) {
 	if p.UploadedAt.IsZero() {
 		p.UploadedAt = time.Now()
 	}
+	if p.StorageTier == "" {
+		p.StorageTier = StorageTierHot
+	}
+	if p.TenantID == "" {
+		p.TenantID = contextTenant(tx)
+	}
 	return
 }
 
@@ -107,5 +310,140 @@ func (t *Tag) BeforeCreate(tx *gorm.DB) (err error) {
 	if t.ID == uuid.Nil {
 		t.ID = uuid.New()
 	}
+	if t.TenantID == "" {
+		t.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+func (a *TagAlias) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	if a.TenantID == "" {
+		a.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+func (s *TagSuggestion) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	if s.Status == "" {
+		s.Status = SuggestionPending
+	}
+	if s.TenantID == "" {
+		s.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+func (p *Person) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	if p.TenantID == "" {
+		p.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+func (f *Face) BeforeCreate(tx *gorm.DB) (err error) {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	if f.TenantID == "" {
+		f.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+// BeforeCreate hook to generate UUID before creating records
+func (k *APIKey) BeforeCreate(tx *gorm.DB) (err error) {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	if k.TenantID == "" {
+		k.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+func (v *PhotoVersion) BeforeCreate(tx *gorm.DB) (err error) {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	if v.TenantID == "" {
+		v.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+func (s *AlbumShare) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	if s.TenantID == "" {
+		s.TenantID = contextTenant(tx)
+	}
+	return
+}
+
+// AfterCreate hook to populate computed fields on new shares
+func (s *AlbumShare) AfterCreate(tx *gorm.DB) (err error) {
+	return s.AfterFind(tx)
+}
+
+// AfterFind hook to populate computed fields on loaded shares
+func (s *AlbumShare) AfterFind(tx *gorm.DB) (err error) {
+	s.HasPassword = s.PasswordHash != ""
+	s.URL = "/shared/" + s.Token
 	return
 }
+
+// contextTenant returns the tenant records created in tx belong to, empty
+// outside multi-tenant mode
+func contextTenant(tx *gorm.DB) string {
+	id, _ := tenant.FromContext(tx.Statement.Context)
+	return id
+}
+
+// AfterFind hook to populate computed URL fields on loaded photos
+func (p *Photo) AfterFind(tx *gorm.DB) (err error) {
+	version := p.ContentVersion()
+	p.FileURL = fileURL("/api/v1/photos/"+p.ID.String()+"/file", version)
+	p.ThumbnailURL = fileURL("/api/v1/photos/"+p.ID.String()+"/thumbnail", version)
+	if p.HasMotion {
+		p.MotionURL = fileURL("/api/v1/photos/"+p.ID.String()+"/motion", version)
+	}
+	if p.RawFormat != "" {
+		p.PreviewURL = fileURL("/api/v1/photos/"+p.ID.String()+"/preview", version)
+	}
+	return
+}
+
+// ContentVersion identifies what a photo's file URL serves, its original or
+// the edited version of it
+func (p *Photo) ContentVersion() string {
+	if p.EditVersion > 0 {
+		return p.OriginalVersion() + "-" + strconv.Itoa(p.EditVersion)
+	}
+	return p.OriginalVersion()
+}
+
+// OriginalVersion identifies the current contents of a photo's file, falling
+// back to its update time for records without a checksum
+func (p *Photo) OriginalVersion() string {
+	if len(p.Checksum) >= 16 {
+		return p.Checksum[:16]
+	}
+	return strconv.FormatInt(p.UpdatedAt.Unix(), 10)
+}
+
+func fileURL(path, version string) string {
+	if FileURLFunc == nil {
+		return path
+	}
+	return FileURLFunc(path, version)
+}
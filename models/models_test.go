@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -16,7 +17,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	require.NoError(t, err)
 
 	// Migrate the schema
-	err = db.AutoMigrate(&Library{}, &Album{}, &Photo{}, &Tag{}, &PhotoTag{}, &AlbumPhoto{})
+	err = db.AutoMigrate(&Library{}, &Album{}, &Photo{}, &Tag{}, &PhotoTag{}, &AlbumPhoto{}, &AlbumTag{})
 	require.NoError(t, err)
 
 	return db
@@ -330,6 +331,40 @@ func TestPhotoTag(t *testing.T) {
 	})
 }
 
+func TestAlbumTag(t *testing.T) {
+	t.Run("AlbumTag database creation", func(t *testing.T) {
+		db := setupTestDB(t)
+
+		library := Library{
+			Name:   "Test Library",
+			Images: "/test/path",
+		}
+		require.NoError(t, db.Create(&library).Error)
+
+		album := Album{
+			Name:      "Italy 2023",
+			LibraryID: library.ID,
+		}
+		require.NoError(t, db.Create(&album).Error)
+
+		tag := Tag{
+			Name: "travel",
+		}
+		require.NoError(t, db.Create(&tag).Error)
+
+		albumTag := AlbumTag{
+			AlbumID: album.ID,
+			TagID:   tag.ID,
+		}
+		require.NoError(t, db.Create(&albumTag).Error)
+
+		var loaded Album
+		require.NoError(t, db.Preload("Tags").First(&loaded, album.ID).Error)
+		require.Len(t, loaded.Tags, 1)
+		assert.Equal(t, tag.ID, loaded.Tags[0].ID)
+	})
+}
+
 func TestAlbumPhoto(t *testing.T) {
 	t.Run("AlbumPhoto struct creation", func(t *testing.T) {
 		albumID := uuid.New()
@@ -446,3 +481,54 @@ func TestModelRelationships(t *testing.T) {
 		assert.Equal(t, photo.ID, loadedLibrary.Photos[0].ID)
 	})
 }
+
+func TestRelationJSON(t *testing.T) {
+	db := setupTestDB(t)
+
+	library := Library{Name: "Test Library", Images: "/test/path"}
+	require.NoError(t, db.Create(&library).Error)
+	album := Album{Name: "Empty Album", LibraryID: library.ID}
+	require.NoError(t, db.Create(&album).Error)
+
+	t.Run("Unloaded relations are omitted", func(t *testing.T) {
+		var loaded Album
+		require.NoError(t, db.First(&loaded, album.ID).Error)
+
+		var fields map[string]interface{}
+		data, err := json.Marshal(loaded)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &fields))
+
+		assert.NotContains(t, fields, "photos")
+		assert.NotContains(t, fields, "tags")
+		assert.Equal(t, "Empty Album", fields["name"])
+	})
+
+	t.Run("Loaded empty relations are arrays", func(t *testing.T) {
+		var loaded Album
+		require.NoError(t, db.Preload("Photos").Preload("Tags").First(&loaded, album.ID).Error)
+
+		var fields map[string]interface{}
+		data, err := json.Marshal(loaded)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &fields))
+
+		assert.Equal(t, []interface{}{}, fields["photos"])
+		assert.Equal(t, []interface{}{}, fields["tags"])
+	})
+
+	t.Run("Nested models", func(t *testing.T) {
+		var loaded Library
+		require.NoError(t, db.Preload("Albums").Preload("Photos").First(&loaded, library.ID).Error)
+
+		var fields map[string]interface{}
+		data, err := json.Marshal(loaded)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &fields))
+
+		assert.Equal(t, []interface{}{}, fields["photos"])
+		albums := fields["albums"].([]interface{})
+		require.Len(t, albums, 1)
+		assert.NotContains(t, albums[0].(map[string]interface{}), "photos")
+	})
+}
@@ -0,0 +1,238 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	uuidType          = reflect.TypeOf(uuid.UUID{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	fileType          = reflect.TypeOf(File{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// File stands for an uploaded file in a multipart form
+type File struct{}
+
+// Registry derives schemas from Go types, the way encoding/json writes
+// them. Named structs become component schemas referred to by name;
+// binding tags add required fields, limits and enums.
+type Registry struct {
+	schemas   map[string]*Schema
+	names     map[reflect.Type]string
+	overrides map[reflect.Type]*Schema
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas:   map[string]*Schema{},
+		names:     map[reflect.Type]string{},
+		overrides: map[reflect.Type]*Schema{},
+	}
+}
+
+// Define sets the schema of a type that doesn't marshal the way its fields
+// suggest, such as one with a custom MarshalJSON
+func (r *Registry) Define(v interface{}, schema *Schema) {
+	r.overrides[reflect.TypeOf(v)] = schema
+}
+
+// Schema returns the schema of v's type, nil for a nil v
+func (r *Registry) Schema(v interface{}) *Schema {
+	if v == nil {
+		return nil
+	}
+	return r.schemaOf(reflect.TypeOf(v))
+}
+
+// Schemas returns the component schemas registered so far
+func (r *Registry) Schemas() map[string]*Schema {
+	return r.schemas
+}
+
+func (r *Registry) schemaOf(t reflect.Type) *Schema {
+	if schema, ok := r.overrides[t]; ok {
+		copied := *schema
+		return &copied
+	}
+
+	switch t {
+	case timeType:
+		return Scalar("date-time")
+	case uuidType:
+		return Scalar("uuid")
+	case rawMessageType:
+		return &Schema{} // Any JSON value
+	case fileType:
+		return Scalar("binary")
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := r.schemaOf(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return Scalar("boolean")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Scalar("integer")
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Scalar("number")
+	case reflect.String:
+		return Scalar("string")
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: r.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+			return Scalar("string")
+		}
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return r.named(t)
+	}
+	return &Schema{} // Interfaces and anything else: any JSON value
+}
+
+// named registers a named struct as a component schema and refers to it
+func (r *Registry) named(t reflect.Type) *Schema {
+	if name, ok := r.names[t]; ok {
+		return Ref(name)
+	}
+
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if _, taken := r.schemas[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+
+	// Reserve the name first, structs may refer to themselves
+	r.names[t] = name
+	r.schemas[name] = &Schema{}
+	*r.schemas[name] = *r.structSchema(t)
+	return Ref(name)
+}
+
+// structSchema describes a struct's fields as encoding/json writes them
+func (r *Registry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	r.addFields(schema, t)
+	return schema
+}
+
+func (r *Registry) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name of their own add their fields
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				r.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := r.schemaOf(field.Type)
+		if applyBinding(property, field.Tag.Get("binding")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// applyBinding adds the limits and enum of a gin binding tag to a property
+// and reports whether the tag makes it required. Rules after dive apply to
+// the items of a list and are skipped.
+func applyBinding(schema *Schema, binding string) bool {
+	if binding == "" || schema.Ref != "" {
+		return strings.HasPrefix(binding, "required")
+	}
+
+	required := false
+	for _, rule := range strings.Split(binding, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			return required
+		case "required":
+			required = true
+		case "oneof":
+			for _, value := range strings.Fields(arg) {
+				if number, err := strconv.Atoi(value); err == nil && schema.Type == "integer" {
+					schema.Enum = append(schema.Enum, number)
+				} else {
+					schema.Enum = append(schema.Enum, value)
+				}
+			}
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			setLimit(schema, name, limit)
+		}
+	}
+	return required
+}
+
+// setLimit applies a min, max or len rule the way the validator reads it
+// for the schema's type: length of strings, items of lists, value of numbers
+func setLimit(schema *Schema, rule string, limit float64) {
+	n := int(limit)
+	switch schema.Type {
+	case "string":
+		if rule != "max" {
+			schema.MinLength = &n
+		}
+		if rule != "min" {
+			schema.MaxLength = &n
+		}
+	case "array":
+		if rule != "max" {
+			schema.MinItems = &n
+		}
+		if rule != "min" {
+			schema.MaxItems = &n
+		}
+	case "integer", "number":
+		if rule != "max" {
+			schema.Minimum = &limit
+		}
+		if rule != "min" {
+			schema.Maximum = &limit
+		}
+	}
+}
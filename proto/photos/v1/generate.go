@@ -0,0 +1,5 @@
+// Package photosv1 holds the gRPC API definitions in photos.proto and the code
+// generated from them with protoc-gen-go and protoc-gen-go-grpc
+package photosv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative photos/v1/photos.proto
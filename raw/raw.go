@@ -0,0 +1,230 @@
+package raw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Format is a camera RAW format the server accepts
+type Format struct {
+	Name     string // Short name recorded on photos, e.g. CR2
+	MimeType string
+}
+
+// Formats maps file extensions to the RAW formats they hold. All of them are
+// TIFF-structured, which is what lets their embedded previews be found.
+var Formats = map[string]Format{
+	".cr2": {"CR2", "image/x-canon-cr2"},
+	".nef": {"NEF", "image/x-nikon-nef"},
+	".arw": {"ARW", "image/x-sony-arw"},
+	".dng": {"DNG", "image/x-adobe-dng"},
+}
+
+// TIFF tags describing the images in a RAW file
+const (
+	tagImageWidth      = 0x0100
+	tagImageLength     = 0x0101
+	tagCompression     = 0x0103
+	tagStripOffsets    = 0x0111
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014A
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+
+	tiffTypeShort = 3
+	tiffTypeLong  = 4
+	tiffTypeIFD   = 13
+
+	compressionOldJPEG = 6
+	compressionJPEG    = 7
+
+	// maxIFDs bounds the walk so corrupt files with IFD loops can't stall it
+	maxIFDs = 64
+)
+
+var jpegSOI = []byte{0xFF, 0xD8}
+
+// Info is what the server records about a RAW file
+type Info struct {
+	Width, Height int    // Size of the largest image in the file, normally the sensor image
+	Preview       []byte // Largest embedded JPEG preview, nil if the file has none
+}
+
+// FormatOf returns the RAW format a filename's extension names, if any
+func FormatOf(filename string) (Format, bool) {
+	format, ok := Formats[strings.ToLower(filepath.Ext(filename))]
+	return format, ok
+}
+
+// Names returns the short names of the supported formats, sorted
+func Names() []string {
+	names := make([]string, 0, len(Formats))
+	for _, format := range Formats {
+		names = append(names, format.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsTIFF reports whether data starts with a TIFF header
+func IsTIFF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
+
+// Inspect returns the dimensions and embedded preview of a TIFF-structured
+// RAW file, or nil if data isn't one
+func Inspect(data []byte) *Info {
+	if !IsTIFF(data) || len(data) < 8 {
+		return nil
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+	t := tiff{data: data, order: order}
+
+	info := &Info{}
+	var previewArea int
+	for _, ifd := range t.ifds(order.Uint32(data[4:8])) {
+		if w, h := t.first(ifd[tagImageWidth]), t.first(ifd[tagImageLength]); int(w)*int(h) > info.Width*info.Height {
+			info.Width, info.Height = int(w), int(h)
+		}
+
+		for _, preview := range t.jpegs(ifd) {
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(preview))
+			if err != nil {
+				continue // Lossless JPEG sensor data, not a viewable preview
+			}
+			if cfg.Width*cfg.Height > previewArea {
+				info.Preview, previewArea = preview, cfg.Width*cfg.Height
+			}
+			if cfg.Width*cfg.Height > info.Width*info.Height {
+				info.Width, info.Height = cfg.Width, cfg.Height
+			}
+		}
+	}
+	return info
+}
+
+// Preview returns the largest JPEG preview embedded in a RAW file, or nil
+func Preview(data []byte) []byte {
+	if info := Inspect(data); info != nil {
+		return info.Preview
+	}
+	return nil
+}
+
+// tiff reads the directory structure of a TIFF file
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// entry is an IFD entry, field is its 4-byte value or offset field
+type entry struct {
+	valueType uint16
+	count     uint32
+	field     []byte
+}
+
+// ifds returns every IFD reachable from the first one, following both the
+// next-IFD chain and SubIFDs, where cameras keep the full-size images
+func (t tiff) ifds(first uint32) []map[uint16]entry {
+	var ifds []map[uint16]entry
+	visited := make(map[uint32]bool)
+	queue := []uint32{first}
+	for len(queue) > 0 && len(ifds) < maxIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || visited[offset] || int(offset)+2 > len(t.data) {
+			continue
+		}
+		visited[offset] = true
+
+		count := int(t.order.Uint16(t.data[offset:]))
+		pos := int(offset) + 2
+		ifd := make(map[uint16]entry, count)
+		for i := 0; i < count && pos+12 <= len(t.data); i, pos = i+1, pos+12 {
+			ifd[t.order.Uint16(t.data[pos:])] = entry{
+				valueType: t.order.Uint16(t.data[pos+2:]),
+				count:     t.order.Uint32(t.data[pos+4:]),
+				field:     t.data[pos+8 : pos+12],
+			}
+		}
+		ifds = append(ifds, ifd)
+
+		queue = append(queue, t.values(ifd[tagSubIFDs])...)
+		if pos+4 <= len(t.data) {
+			queue = append(queue, t.order.Uint32(t.data[pos:]))
+		}
+	}
+	return ifds
+}
+
+// values returns the SHORT, LONG or IFD values of an entry
+func (t tiff) values(e entry) []uint32 {
+	size := 0
+	switch e.valueType {
+	case tiffTypeShort:
+		size = 2
+	case tiffTypeLong, tiffTypeIFD:
+		size = 4
+	default:
+		return nil
+	}
+
+	raw := e.field
+	if total := uint64(e.count) * uint64(size); total > 4 {
+		start := uint64(t.order.Uint32(e.field))
+		if start+total > uint64(len(t.data)) {
+			return nil
+		}
+		raw = t.data[start : start+total]
+	}
+
+	values := make([]uint32, 0, e.count)
+	for i := 0; i+size <= len(raw) && len(values) < int(e.count); i += size {
+		if size == 2 {
+			values = append(values, uint32(t.order.Uint16(raw[i:])))
+		} else {
+			values = append(values, t.order.Uint32(raw[i:]))
+		}
+	}
+	return values
+}
+
+// first returns an entry's first value, 0 if it has none
+func (t tiff) first(e entry) uint32 {
+	if values := t.values(e); len(values) > 0 {
+		return values[0]
+	}
+	return 0
+}
+
+// jpegs returns the JPEG streams an IFD points at, either through the
+// JPEGInterchangeFormat tags or as a single JPEG-compressed strip
+func (t tiff) jpegs(ifd map[uint16]entry) [][]byte {
+	var streams [][]byte
+	add := func(offset, length uint32) {
+		end := uint64(offset) + uint64(length)
+		if length > 0 && end <= uint64(len(t.data)) && bytes.HasPrefix(t.data[offset:], jpegSOI) {
+			streams = append(streams, t.data[offset:end])
+		}
+	}
+
+	if offset, ok := ifd[tagJPEGOffset]; ok {
+		add(t.first(offset), t.first(ifd[tagJPEGLength]))
+	}
+	if compression := t.first(ifd[tagCompression]); compression == compressionOldJPEG || compression == compressionJPEG {
+		offsets, counts := t.values(ifd[tagStripOffsets]), t.values(ifd[tagStripByteCounts])
+		if len(offsets) == 1 && len(counts) == 1 {
+			add(offsets[0], counts[0])
+		}
+	}
+	return streams
+}
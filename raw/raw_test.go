@@ -0,0 +1,123 @@
+package raw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJPEG encodes a blank w x h JPEG
+func testJPEG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil))
+	return buf.Bytes()
+}
+
+// buildRAW lays out a RAW file the way cameras do: IFD0 records the sensor
+// size and points at a small thumbnail, and a SubIFD holds the large preview
+// as a JPEG-compressed strip
+func buildRAW(order binary.ByteOrder, width, height uint32, thumb, preview []byte) []byte {
+	const ifd0, ifd1 = 8, 8 + 2 + 5*12 + 4
+	const dataStart = ifd1 + 2 + 3*12 + 4
+
+	b := make([]byte, dataStart)
+	if order == binary.LittleEndian {
+		copy(b, "II*\x00")
+	} else {
+		copy(b, "MM\x00*")
+	}
+	order.PutUint32(b[4:], ifd0)
+
+	putEntry := func(pos int, tag, valueType uint16, value uint32) {
+		order.PutUint16(b[pos:], tag)
+		order.PutUint16(b[pos+2:], valueType)
+		order.PutUint32(b[pos+4:], 1)
+		if valueType == tiffTypeShort {
+			order.PutUint16(b[pos+8:], uint16(value))
+		} else {
+			order.PutUint32(b[pos+8:], value)
+		}
+	}
+
+	order.PutUint16(b[ifd0:], 5)
+	putEntry(ifd0+2, tagImageWidth, tiffTypeLong, width)
+	putEntry(ifd0+14, tagImageLength, tiffTypeLong, height)
+	putEntry(ifd0+26, tagSubIFDs, tiffTypeIFD, ifd1)
+	putEntry(ifd0+38, tagJPEGOffset, tiffTypeLong, dataStart)
+	putEntry(ifd0+50, tagJPEGLength, tiffTypeLong, uint32(len(thumb)))
+
+	order.PutUint16(b[ifd1:], 3)
+	putEntry(ifd1+2, tagCompression, tiffTypeShort, compressionOldJPEG)
+	putEntry(ifd1+14, tagStripOffsets, tiffTypeLong, uint32(dataStart+len(thumb)))
+	putEntry(ifd1+26, tagStripByteCounts, tiffTypeLong, uint32(len(preview)))
+
+	b = append(b, thumb...)
+	return append(b, preview...)
+}
+
+func TestInspect(t *testing.T) {
+	thumb := testJPEG(t, 16, 12)
+	preview := testJPEG(t, 64, 48)
+
+	t.Run("Largest preview and sensor size", func(t *testing.T) {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			info := Inspect(buildRAW(order, 6000, 4000, thumb, preview))
+			require.NotNil(t, info)
+			assert.Equal(t, 6000, info.Width)
+			assert.Equal(t, 4000, info.Height)
+			assert.Equal(t, preview, info.Preview)
+		}
+	})
+
+	t.Run("No preview", func(t *testing.T) {
+		info := Inspect(buildRAW(binary.LittleEndian, 6000, 4000, nil, nil))
+		require.NotNil(t, info)
+		assert.Equal(t, 6000, info.Width)
+		assert.Nil(t, info.Preview)
+	})
+
+	t.Run("Preview larger than recorded size", func(t *testing.T) {
+		info := Inspect(buildRAW(binary.LittleEndian, 0, 0, thumb, preview))
+		require.NotNil(t, info)
+		assert.Equal(t, 64, info.Width)
+		assert.Equal(t, 48, info.Height)
+	})
+
+	t.Run("IFD loop", func(t *testing.T) {
+		data := buildRAW(binary.LittleEndian, 6000, 4000, thumb, preview)
+		// Point the SubIFD's next-IFD field back at IFD0
+		binary.LittleEndian.PutUint32(data[8+2+5*12+4+2+3*12:], 8)
+		assert.Equal(t, preview, Preview(data))
+	})
+
+	t.Run("Not TIFF", func(t *testing.T) {
+		assert.Nil(t, Inspect(preview))
+		assert.Nil(t, Preview([]byte("II")))
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		data := buildRAW(binary.LittleEndian, 6000, 4000, thumb, preview)
+		info := Inspect(data[:len(data)-len(preview)/2])
+		require.NotNil(t, info)
+		assert.Equal(t, thumb, info.Preview)
+	})
+}
+
+func TestFormatOf(t *testing.T) {
+	format, ok := FormatOf("IMG_0001.CR2")
+	assert.True(t, ok)
+	assert.Equal(t, "CR2", format.Name)
+	assert.Equal(t, "image/x-canon-cr2", format.MimeType)
+
+	format, ok = FormatOf("DSC_0001.nef")
+	assert.True(t, ok)
+	assert.Equal(t, "NEF", format.Name)
+
+	_, ok = FormatOf("photo.jpg")
+	assert.False(t, ok)
+}
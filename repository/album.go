@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"photo-library-server/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AlbumRepo stores albums
+type AlbumRepo interface {
+	List(ctx context.Context, filter AlbumFilter, with AlbumRelations) ([]models.Album, error)
+	Get(ctx context.Context, id uuid.UUID, with AlbumRelations) (*models.Album, error)
+	Create(ctx context.Context, album *models.Album) error
+	Save(ctx context.Context, album *models.Album) error
+	// Delete removes an album with its photo memberships, tags and shared
+	// links. The photos stay.
+	Delete(ctx context.Context, album *models.Album) error
+}
+
+// AlbumFilter limits the albums listed. Zero fields don't.
+type AlbumFilter struct {
+	LibraryID uuid.UUID
+	Tag       string // Normalized name of a tag or one of its aliases
+}
+
+// AlbumRelations selects the related records loaded with albums
+type AlbumRelations struct {
+	Library   bool
+	Photos    bool
+	PhotoTags bool // Tags of the album's photos, with Photos
+	Tags      bool
+}
+
+// gormAlbumRepo is the AlbumRepo of a GORM database
+type gormAlbumRepo struct {
+	db *gorm.DB
+}
+
+// NewAlbumRepo returns an AlbumRepo on db
+func NewAlbumRepo(db *gorm.DB) AlbumRepo {
+	return &gormAlbumRepo{db: db}
+}
+
+func (r *gormAlbumRepo) query(ctx context.Context, with AlbumRelations) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&models.Album{})
+	if with.Library {
+		query = query.Preload("Library")
+	}
+	if with.Photos {
+		query = query.Preload("Photos")
+		if with.PhotoTags {
+			query = query.Preload("Photos.Tags")
+		}
+	}
+	if with.Tags {
+		query = query.Preload("Tags")
+	}
+	return query
+}
+
+func (r *gormAlbumRepo) List(ctx context.Context, filter AlbumFilter, with AlbumRelations) ([]models.Album, error) {
+	query := r.query(ctx, with)
+	if filter.LibraryID != uuid.Nil {
+		query = query.Where("library_id = ?", filter.LibraryID)
+	}
+	if filter.Tag != "" {
+		query = WhereTagName(query.Joins("JOIN album_tags ON albums.id = album_tags.album_id").
+			Joins("JOIN tags ON album_tags.tag_id = tags.id"), filter.Tag)
+	}
+
+	var albums []models.Album
+	if err := query.Find(&albums).Error; err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+func (r *gormAlbumRepo) Get(ctx context.Context, id uuid.UUID, with AlbumRelations) (*models.Album, error) {
+	var album models.Album
+	if err := first(r.query(ctx, with), &album, id); err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+func (r *gormAlbumRepo) Create(ctx context.Context, album *models.Album) error {
+	return r.db.WithContext(ctx).Create(album).Error
+}
+
+func (r *gormAlbumRepo) Save(ctx context.Context, album *models.Album) error {
+	return r.db.WithContext(ctx).Save(album).Error
+}
+
+func (r *gormAlbumRepo) Delete(ctx context.Context, album *models.Album) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, step := range []struct {
+			what  string
+			model interface{}
+		}{
+			{"album photos", &models.AlbumPhoto{}},
+			{"album tags", &models.AlbumTag{}},
+			{"album shares", &models.AlbumShare{}}, // Shared links stop working with the album
+		} {
+			if err := tx.Where("album_id = ?", album.ID).Delete(step.model).Error; err != nil {
+				return fmt.Errorf("failed to delete %s: %w", step.what, err)
+			}
+		}
+
+		return tx.Delete(album).Error
+	})
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LibraryRepo stores libraries
+type LibraryRepo interface {
+	List(ctx context.Context, with LibraryRelations) ([]models.Library, error)
+	Get(ctx context.Context, id uuid.UUID, with LibraryRelations) (*models.Library, error)
+	// NameTaken reports whether a library of the context's tenant, other
+	// than except, is called name
+	NameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error)
+	// ImagesTaken reports whether a library of any tenant, other than
+	// except, keeps its images in the directory images, in one of its
+	// parents or in one below it. Paths are compared absolute and clean.
+	ImagesTaken(ctx context.Context, images string, except uuid.UUID) (bool, error)
+	Create(ctx context.Context, library *models.Library) error
+	Save(ctx context.Context, library *models.Library) error
+	// Delete removes a library with its albums and photos, including those
+	// in the trash, and everything recorded about them. Files are left alone.
+	Delete(ctx context.Context, library *models.Library) error
+	Stats(ctx context.Context, id uuid.UUID) (*LibraryStats, error)
+}
+
+// LibraryRelations selects the related records loaded with libraries
+type LibraryRelations struct {
+	Albums bool
+	Photos bool
+}
+
+// LibraryStats counts what a library holds. Photos in the trash aren't
+// counted.
+type LibraryStats struct {
+	PhotoCount    int64
+	FavoriteCount int64
+	AlbumCount    int64
+	TagCount      int64 // Distinct tags on the library's photos
+	TotalSize     int64 // Bytes in original files
+}
+
+// gormLibraryRepo is the LibraryRepo of a GORM database
+type gormLibraryRepo struct {
+	db *gorm.DB
+}
+
+// NewLibraryRepo returns a LibraryRepo on db
+func NewLibraryRepo(db *gorm.DB) LibraryRepo {
+	return &gormLibraryRepo{db: db}
+}
+
+func (r *gormLibraryRepo) query(ctx context.Context, with LibraryRelations) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&models.Library{})
+	if with.Albums {
+		query = query.Preload("Albums")
+	}
+	if with.Photos {
+		query = query.Preload("Photos")
+	}
+	return query
+}
+
+func (r *gormLibraryRepo) List(ctx context.Context, with LibraryRelations) ([]models.Library, error) {
+	var libraries []models.Library
+	if err := r.query(ctx, with).Find(&libraries).Error; err != nil {
+		return nil, err
+	}
+	return libraries, nil
+}
+
+func (r *gormLibraryRepo) Get(ctx context.Context, id uuid.UUID, with LibraryRelations) (*models.Library, error) {
+	var library models.Library
+	if err := first(r.query(ctx, with), &library, id); err != nil {
+		return nil, err
+	}
+	return &library, nil
+}
+
+func (r *gormLibraryRepo) NameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error) {
+	return exists(r.db.WithContext(ctx).Model(&models.Library{}).Where("name = ? AND id != ?", name, except))
+}
+
+func (r *gormLibraryRepo) ImagesTaken(ctx context.Context, images string, except uuid.UUID) (bool, error) {
+	images, err := filepath.Abs(images)
+	if err != nil {
+		return false, err
+	}
+
+	// Two tenants can't share a directory either, and a scan or watch of
+	// one library would reach into any library nested with it
+	ctx = tenant.WithID(ctx, "")
+	var paths []string
+	if err := r.db.WithContext(ctx).Model(&models.Library{}).Where("id != ?", except).Pluck("images", &paths).Error; err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if nested(images, path) || nested(path, images) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nested reports whether path is dir or below it
+func nested(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (r *gormLibraryRepo) Create(ctx context.Context, library *models.Library) error {
+	return r.db.WithContext(ctx).Create(library).Error
+}
+
+func (r *gormLibraryRepo) Save(ctx context.Context, library *models.Library) error {
+	return r.db.WithContext(ctx).Save(library).Error
+}
+
+func (r *gormLibraryRepo) Delete(ctx context.Context, library *models.Library) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		libraryPhotos := tx.Unscoped().Model(&models.Photo{}).Select("id").Where("library_id = ?", library.ID)
+		libraryAlbums := tx.Model(&models.Album{}).Select("id").Where("library_id = ?", library.ID)
+
+		// Records about the library's photos go first, then album
+		// memberships of its photos and of its albums, so nothing is left
+		// pointing at a deleted row
+		for _, step := range []struct {
+			what  string
+			query *gorm.DB
+			model interface{}
+		}{
+			{"photo metadata", tx.Where("photo_id IN (?)", libraryPhotos), &models.PhotoMetadata{}},
+			{"tag suggestions", tx.Where("photo_id IN (?)", libraryPhotos), &models.TagSuggestion{}},
+			{"faces", tx.Where("photo_id IN (?)", libraryPhotos), &models.Face{}},
+			{"photo versions", tx.Where("photo_id IN (?)", libraryPhotos), &models.PhotoVersion{}},
+			{"photo tags", tx.Where("photo_id IN (?)", libraryPhotos), &models.PhotoTag{}},
+			{"album photos", tx.Where("photo_id IN (?) OR album_id IN (?)", libraryPhotos, libraryAlbums), &models.AlbumPhoto{}},
+			{"photos", tx.Unscoped().Where("library_id = ?", library.ID), &models.Photo{}},
+			{"album tags", tx.Where("album_id IN (?)", libraryAlbums), &models.AlbumTag{}},
+			{"album shares", tx.Where("album_id IN (?)", libraryAlbums), &models.AlbumShare{}},
+			{"albums", tx.Where("library_id = ?", library.ID), &models.Album{}},
+		} {
+			if err := step.query.Delete(step.model).Error; err != nil {
+				return fmt.Errorf("failed to delete library %s: %w", step.what, err)
+			}
+		}
+
+		return tx.Delete(library).Error
+	})
+}
+
+func (r *gormLibraryRepo) Stats(ctx context.Context, id uuid.UUID) (*LibraryStats, error) {
+	db := r.db.WithContext(ctx)
+	var stats LibraryStats
+
+	if err := db.Model(&models.Photo{}).Where("library_id = ?", id).Count(&stats.PhotoCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Photo{}).Where("library_id = ? AND favorite = ?", id, true).Count(&stats.FavoriteCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Album{}).Where("library_id = ?", id).Count(&stats.AlbumCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Table("tags").
+		Joins("JOIN photo_tags ON tags.id = photo_tags.tag_id").
+		Joins("JOIN photos ON photo_tags.photo_id = photos.id").
+		Where("photos.library_id = ? AND photos.deleted_at IS NULL", id).
+		Distinct("tags.id").
+		Count(&stats.TagCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Photo{}).
+		Where("library_id = ?", id).
+		Select("COALESCE(SUM(file_size), 0)").
+		Row().Scan(&stats.TotalSize); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
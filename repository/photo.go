@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"photo-library-server/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PhotoRepo stores photos
+type PhotoRepo interface {
+	Get(ctx context.Context, id uuid.UUID, with PhotoRelations) (*models.Photo, error)
+	Save(ctx context.Context, photo *models.Photo) error
+	// ToggleFavorite flips whether a photo is a favorite and reloads it.
+	// Concurrent toggles each take effect.
+	ToggleFavorite(ctx context.Context, photo *models.Photo) error
+
+	// List returns a page of the photos matching filter. Photos in the
+	// trash aren't listed.
+	List(ctx context.Context, filter PhotoFilter, page PhotoPage) ([]models.Photo, error)
+	// Count counts the photos matching filter, leaving out the trash
+	Count(ctx context.Context, filter PhotoFilter) (int64, error)
+	// Timeline counts the photos matching filter per day, month or year of
+	// capture, or upload when they have no capture date. It returns a page
+	// of periods with photos, newest first, and the number of such periods.
+	Timeline(ctx context.Context, filter PhotoFilter, page TimelinePage) ([]TimelineBucket, int64, error)
+}
+
+// PhotoRelations selects the related records loaded with photos
+type PhotoRelations struct {
+	Library bool
+	Tags    bool
+	Albums  bool
+}
+
+// gormPhotoRepo is the PhotoRepo of a GORM database
+type gormPhotoRepo struct {
+	db *gorm.DB
+}
+
+// NewPhotoRepo returns a PhotoRepo on db
+func NewPhotoRepo(db *gorm.DB) PhotoRepo {
+	return &gormPhotoRepo{db: db}
+}
+
+// preloadPhotos loads the relations selected by with along with photos
+func preloadPhotos(query *gorm.DB, with PhotoRelations) *gorm.DB {
+	if with.Library {
+		query = query.Preload("Library")
+	}
+	if with.Tags {
+		query = query.Preload("Tags")
+	}
+	if with.Albums {
+		query = query.Preload("Albums")
+	}
+	return query
+}
+
+func (r *gormPhotoRepo) Get(ctx context.Context, id uuid.UUID, with PhotoRelations) (*models.Photo, error) {
+	query := preloadPhotos(r.db.WithContext(ctx).Model(&models.Photo{}), with)
+
+	var photo models.Photo
+	if err := first(query, &photo, id); err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+func (r *gormPhotoRepo) Save(ctx context.Context, photo *models.Photo) error {
+	return r.db.WithContext(ctx).Save(photo).Error
+}
+
+func (r *gormPhotoRepo) ToggleFavorite(ctx context.Context, photo *models.Photo) error {
+	db := r.db.WithContext(ctx)
+
+	// Flipped in SQL so concurrent toggles don't overwrite each other
+	if err := db.Model(photo).Update("favorite", gorm.Expr("NOT favorite")).Error; err != nil {
+		return err
+	}
+	return first(db, photo, photo.ID)
+}
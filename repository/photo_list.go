@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math"
+	"photo-library-server/database"
+	"photo-library-server/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// kmPerDegree is the length of a degree of latitude
+const kmPerDegree = 111.32
+
+// ErrUnsupported is returned for queries the database can't run
+var ErrUnsupported = errors.New("not supported by this database")
+
+// PhotoFilter selects the photos of a list. Zero fields match every photo.
+type PhotoFilter struct {
+	LibraryID   uuid.UUID
+	Rating      *int
+	Unrated     *bool // Whether no rating was given, 0 stars being one
+	StorageTier string
+	Favorite    *bool
+	Missing     *bool
+	Corrupt     *bool
+	Tag         string // Normalized name of a tag, or of an alias of one
+	Untagged    *bool
+	Within      *BoundingBox
+	Near        *Circle
+	Country     string // Upper case country code
+	City        string // Matched ignoring case
+	Place       string // Matched ignoring case
+	Metadata    map[string]string
+	Text        string // Found in titles, captions, descriptions and original names, ignoring case
+
+	// Photos without a capture date never match the taken filters
+	UploadedAfter  *time.Time
+	UploadedBefore *time.Time
+	TakenAfter     *time.Time
+	TakenBefore    *time.Time
+}
+
+// BoundingBox is an area of the map. A box whose minimum longitude is east of
+// its maximum crosses the antimeridian.
+type BoundingBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// Circle is the area within RadiusKm of a point
+type Circle struct {
+	Lat, Lon, RadiusKm float64
+}
+
+// PhotoPage selects a page of a photo list
+type PhotoPage struct {
+	Order  string // ORDER BY clause on photos columns
+	Offset int
+	Limit  int
+	// After continues a list in upload order after a photo, in place of
+	// Order and Offset
+	After *PhotoCursor
+	With  PhotoRelations
+}
+
+// PhotoCursor is a position in a photo list ordered by upload time, with the
+// photo ID breaking ties between photos uploaded at the same moment
+type PhotoCursor struct {
+	UploadedAt time.Time
+	ID         uuid.UUID
+	Desc       bool
+}
+
+// TimelineLayouts are the formats of TimelineBucket.Period at each
+// granularity
+var TimelineLayouts = map[string]string{
+	"day":   "2006-01-02",
+	"month": "2006-01",
+	"year":  "2006",
+}
+
+// timelinePeriods are the SQL expressions giving a photo's period at each
+// granularity, in UTC and formatted as in TimelineLayouts
+var timelinePeriods = map[string]map[string]string{
+	database.DriverSQLite: {
+		"day":   "strftime('%Y-%m-%d', COALESCE(photos.taken_at, photos.uploaded_at))",
+		"month": "strftime('%Y-%m', COALESCE(photos.taken_at, photos.uploaded_at))",
+		"year":  "strftime('%Y', COALESCE(photos.taken_at, photos.uploaded_at))",
+	},
+	database.DriverPostgres: {
+		"day":   "to_char(COALESCE(photos.taken_at, photos.uploaded_at) AT TIME ZONE 'UTC', 'YYYY-MM-DD')",
+		"month": "to_char(COALESCE(photos.taken_at, photos.uploaded_at) AT TIME ZONE 'UTC', 'YYYY-MM')",
+		"year":  "to_char(COALESCE(photos.taken_at, photos.uploaded_at) AT TIME ZONE 'UTC', 'YYYY')",
+	},
+}
+
+// TimelinePage selects a page of a photo timeline
+type TimelinePage struct {
+	Granularity string // A key of TimelineLayouts
+	Offset      int
+	Limit       int
+	Thumbnails  int // Most recent photos returned per bucket
+}
+
+// TimelineBucket is one period of a photo timeline
+type TimelineBucket struct {
+	Period string
+	Start  time.Time
+	Count  int
+	Photos []models.Photo // The period's most recent photos, newest first
+}
+
+// FilterPhotos limits a query on photos to those matching filter, for
+// handlers that build on the photo list filters
+func FilterPhotos(query *gorm.DB, filter PhotoFilter) *gorm.DB {
+	if filter.LibraryID != uuid.Nil {
+		query = query.Where("photos.library_id = ?", filter.LibraryID)
+	}
+	if filter.Rating != nil {
+		query = query.Where("photos.rating = ?", *filter.Rating)
+	}
+	if filter.Unrated != nil {
+		if *filter.Unrated {
+			query = query.Where("photos.rating IS NULL")
+		} else {
+			query = query.Where("photos.rating IS NOT NULL")
+		}
+	}
+	if filter.StorageTier != "" {
+		query = query.Where("photos.storage_tier = ?", filter.StorageTier)
+	}
+	if filter.Favorite != nil {
+		query = query.Where("photos.favorite = ?", *filter.Favorite)
+	}
+	if filter.Missing != nil {
+		query = query.Where("photos.missing = ?", *filter.Missing)
+	}
+	if filter.Corrupt != nil {
+		query = query.Where("photos.corrupt = ?", *filter.Corrupt)
+	}
+
+	if filter.Tag != "" {
+		query = WhereTagName(query.Joins("JOIN photo_tags ON photos.id = photo_tags.photo_id").
+			Joins("JOIN tags ON photo_tags.tag_id = tags.id"), filter.Tag)
+	}
+	if filter.Untagged != nil {
+		tagged := "EXISTS (SELECT 1 FROM photo_tags WHERE photo_tags.photo_id = photos.id)"
+		if *filter.Untagged {
+			tagged = "NOT " + tagged
+		}
+		query = query.Where(tagged)
+	}
+
+	if box := filter.Within; box != nil {
+		query = withinBoundingBox(query, *box)
+	}
+	if circle := filter.Near; circle != nil {
+		query = withinRadius(query, *circle)
+	}
+	if filter.Country != "" {
+		query = query.Where("photos.country = ?", filter.Country)
+	}
+	if filter.City != "" {
+		query = query.Where("LOWER(photos.city) = ?", strings.ToLower(filter.City))
+	}
+	if filter.Place != "" {
+		query = query.Where("LOWER(photos.place) = ?", strings.ToLower(filter.Place))
+	}
+
+	for key, value := range filter.Metadata {
+		matching := query.Session(&gorm.Session{NewDB: true}).Model(&models.PhotoMetadata{}).
+			Select("photo_id").Where("key = ? AND value = ?", key, value)
+		query = query.Where("photos.id IN (?)", matching)
+	}
+
+	if filter.Text != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(filter.Text))
+		pattern := "%" + escaped + "%"
+		query = query.Where(
+			`LOWER(photos.title) LIKE ? ESCAPE '\' OR LOWER(photos.caption) LIKE ? ESCAPE '\' OR `+
+				`LOWER(photos.description) LIKE ? ESCAPE '\' OR LOWER(photos.original_name) LIKE ? ESCAPE '\'`,
+			pattern, pattern, pattern, pattern)
+	}
+
+	for _, bound := range []struct {
+		condition string
+		value     *time.Time
+	}{
+		{"photos.uploaded_at >= ?", filter.UploadedAfter},
+		{"photos.uploaded_at < ?", filter.UploadedBefore},
+		{"photos.taken_at >= ?", filter.TakenAfter},
+		{"photos.taken_at < ?", filter.TakenBefore},
+	} {
+		if bound.value != nil {
+			query = query.Where(bound.condition, *bound.value)
+		}
+	}
+
+	return query
+}
+
+// withinBoundingBox limits query to photos inside box
+func withinBoundingBox(query *gorm.DB, box BoundingBox) *gorm.DB {
+	query = query.Where("photos.latitude BETWEEN ? AND ?", box.MinLat, box.MaxLat)
+	if box.MinLon <= box.MaxLon {
+		return query.Where("photos.longitude BETWEEN ? AND ?", box.MinLon, box.MaxLon)
+	}
+	return query.Where("(photos.longitude >= ? OR photos.longitude <= ?)", box.MinLon, box.MaxLon)
+}
+
+// withinRadius limits query to photos inside circle. Distances use an
+// equirectangular projection, which needs no SQL math functions and is close
+// enough at photo-browsing scales. Windows crossing the antimeridian are only
+// limited to their bounding box.
+func withinRadius(query *gorm.DB, circle Circle) *gorm.DB {
+	lat, lon := circle.Lat, circle.Lon
+	degLat := circle.RadiusKm / kmPerDegree
+	minLat, maxLat := math.Max(lat-degLat, -90), math.Min(lat+degLat, 90)
+
+	// Near the poles every longitude is in reach
+	cosLat := math.Cos(lat * math.Pi / 180)
+	degLon := 180.0
+	if cosLat > 1e-9 {
+		degLon = degLat / cosLat
+	}
+	if degLon >= 180 || minLat == -90 || maxLat == 90 {
+		return query.Where("photos.latitude BETWEEN ? AND ?", minLat, maxLat)
+	}
+
+	minLon, maxLon := lon-degLon, lon+degLon
+	if minLon < -180 || maxLon > 180 {
+		return withinBoundingBox(query, BoundingBox{math.Mod(minLon+540, 360) - 180, minLat, math.Mod(maxLon+540, 360) - 180, maxLat})
+	}
+
+	// The bounding box lets the location index do most of the work
+	query = withinBoundingBox(query, BoundingBox{minLon, minLat, maxLon, maxLat})
+	return query.Where(
+		"(photos.latitude - ?) * (photos.latitude - ?) + "+
+			"(photos.longitude - ?) * (photos.longitude - ?) * ? <= ?",
+		lat, lat, lon, lon, cosLat*cosLat, degLat*degLat)
+}
+
+// filtered returns the photos of the context's tenant matching filter
+func (r *gormPhotoRepo) filtered(ctx context.Context, filter PhotoFilter) *gorm.DB {
+	return FilterPhotos(r.db.WithContext(ctx).Model(&models.Photo{}), filter)
+}
+
+func (r *gormPhotoRepo) List(ctx context.Context, filter PhotoFilter, page PhotoPage) ([]models.Photo, error) {
+	query := preloadPhotos(r.filtered(ctx, filter), page.With)
+
+	if cursor := page.After; cursor != nil {
+		if cursor.Desc {
+			query = query.Where("photos.uploaded_at < ? OR (photos.uploaded_at = ? AND photos.id < ?)",
+				cursor.UploadedAt, cursor.UploadedAt, cursor.ID).
+				Order("photos.uploaded_at desc, photos.id desc")
+		} else {
+			query = query.Where("photos.uploaded_at > ? OR (photos.uploaded_at = ? AND photos.id > ?)",
+				cursor.UploadedAt, cursor.UploadedAt, cursor.ID).
+				Order("photos.uploaded_at asc, photos.id asc")
+		}
+	} else {
+		query = query.Offset(page.Offset).Order(page.Order)
+		// Photos uploaded at the same moment keep the order cursors use
+		if strings.HasPrefix(page.Order, "photos.uploaded_at ") {
+			if strings.HasSuffix(page.Order, " desc") {
+				query = query.Order("photos.id desc")
+			} else {
+				query = query.Order("photos.id asc")
+			}
+		}
+	}
+
+	var photos []models.Photo
+	if err := query.Limit(page.Limit).Find(&photos).Error; err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+func (r *gormPhotoRepo) Count(ctx context.Context, filter PhotoFilter) (int64, error) {
+	var count int64
+	if err := r.filtered(ctx, filter).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *gormPhotoRepo) Timeline(ctx context.Context, filter PhotoFilter, page TimelinePage) ([]TimelineBucket, int64, error) {
+	layout, ok := TimelineLayouts[page.Granularity]
+	if !ok {
+		return nil, 0, errors.New("unknown timeline granularity " + page.Granularity)
+	}
+	period, ok := timelinePeriods[r.db.Dialector.Name()][page.Granularity]
+	if !ok {
+		return nil, 0, ErrUnsupported
+	}
+
+	// Photos are counted per period in SQL, a page of periods at a time
+	var total int64
+	periods := r.filtered(ctx, filter).Select(period).Group(period)
+	if err := r.db.WithContext(ctx).Table("(?) AS periods", periods).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []struct {
+		Period string
+		Count  int
+	}
+	if err := r.filtered(ctx, filter).Select(period + " AS period, COUNT(*) AS count").Group(period).
+		Order("period DESC").Offset(page.Offset).Limit(page.Limit).Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	buckets := make([]TimelineBucket, 0, len(rows))
+	bucketOf := make(map[string]int, len(rows)) // Period to bucket index
+	for _, row := range rows {
+		start, err := time.Parse(layout, row.Period)
+		if err != nil {
+			return nil, 0, err
+		}
+		bucketOf[row.Period] = len(buckets)
+		buckets = append(buckets, TimelineBucket{Period: row.Period, Start: start, Count: row.Count, Photos: []models.Photo{}})
+	}
+	if len(buckets) == 0 || page.Thumbnails <= 0 {
+		return buckets, total, nil
+	}
+
+	// The most recent photos of each period on the page are picked in SQL
+	// too, so no list of IDs is bound to the query
+	ranked := r.filtered(ctx, filter).
+		Select("photos.id, ROW_NUMBER() OVER (PARTITION BY "+period+
+			" ORDER BY COALESCE(photos.taken_at, photos.uploaded_at) DESC, photos.id) AS position").
+		Where(period+" BETWEEN ? AND ?", buckets[len(buckets)-1].Period, buckets[0].Period)
+	representatives := r.db.Table("(?) AS ranked", ranked).Select("id").Where("position <= ?", page.Thumbnails)
+
+	var photos []models.Photo
+	if err := r.db.WithContext(ctx).Where("id IN (?)", representatives).
+		Order("COALESCE(taken_at, uploaded_at) DESC, id").Find(&photos).Error; err != nil {
+		return nil, 0, err
+	}
+	for _, photo := range photos {
+		date := photo.UploadedAt
+		if photo.TakenAt != nil {
+			date = *photo.TakenAt
+		}
+		if i, ok := bucketOf[date.UTC().Format(layout)]; ok {
+			buckets[i].Photos = append(buckets[i].Photos, photo)
+		}
+	}
+	return buckets, total, nil
+}
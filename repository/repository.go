@@ -0,0 +1,57 @@
+// Package repository keeps the queries behind libraries, albums, photos and
+// tags apart from the HTTP handlers, so the rules they enforce can be tested
+// without a request and another store can stand in for GORM.
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned for records that don't exist, or belong to another
+// tenant
+var ErrNotFound = errors.New("record not found")
+
+// ErrExists is returned when adding a relationship that is already there
+var ErrExists = errors.New("record already exists")
+
+// Repos holds a repository of each kind, all on the same database or
+// transaction
+type Repos struct {
+	Libraries LibraryRepo
+	Albums    AlbumRepo
+	Photos    PhotoRepo
+	Tags      TagRepo
+}
+
+// NewGorm returns GORM repositories on db. Their methods scope queries to
+// the tenant of the context they are given, as handlers do.
+func NewGorm(db *gorm.DB) Repos {
+	return Repos{
+		Libraries: NewLibraryRepo(db),
+		Albums:    NewAlbumRepo(db),
+		Photos:    NewPhotoRepo(db),
+		Tags:      NewTagRepo(db),
+	}
+}
+
+// first loads the record with id into dest, with ErrNotFound if there's none
+func first(query *gorm.DB, dest interface{}, id interface{}) error {
+	if err := query.First(dest, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// exists reports whether query matches any row
+func exists(query *gorm.DB) (bool, error) {
+	var count int64
+	if err := query.Limit(1).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"photo-library-server/database"
+	"photo-library-server/models"
+	"photo-library-server/tenant"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestDB returns a migrated in-memory database that enforces foreign keys
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := database.NewSQLiteDB(":memory:", database.Options{SQLiteForeignKeys: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Migrate())
+	return db.GetDB()
+}
+
+// seed creates a library holding an album with a tagged photo in it
+func seed(t *testing.T, ctx context.Context, repos Repos, db *gorm.DB, name string) (*models.Library, *models.Album, *models.Photo, *models.Tag) {
+	library := &models.Library{Name: name, Images: "/tmp/" + name}
+	require.NoError(t, repos.Libraries.Create(ctx, library))
+	album := &models.Album{Name: "Holiday", LibraryID: library.ID}
+	require.NoError(t, repos.Albums.Create(ctx, album))
+	photo := &models.Photo{Filename: "a.jpg", OriginalName: "a.jpg", FilePath: "/tmp/a.jpg", MimeType: "image/jpeg", FileSize: 10, LibraryID: library.ID}
+	require.NoError(t, db.WithContext(ctx).Create(photo).Error)
+	require.NoError(t, db.WithContext(ctx).Create(&models.AlbumPhoto{AlbumID: album.ID, PhotoID: photo.ID}).Error)
+	tag := &models.Tag{Name: name + "-tag"}
+	require.NoError(t, repos.Tags.Create(ctx, tag))
+	require.NoError(t, repos.Tags.AddToPhoto(ctx, tag.ID, photo.ID))
+	require.NoError(t, repos.Tags.AddToAlbum(ctx, tag.ID, album.ID))
+	return library, album, photo, tag
+}
+
+func TestLibraryRepo(t *testing.T) {
+	db := newTestDB(t)
+	repos := NewGorm(db)
+	smith := tenant.WithID(context.Background(), "smith")
+	jones := tenant.WithID(context.Background(), "jones")
+
+	library, album, photo, tag := seed(t, smith, repos, db, "family")
+
+	_, err := repos.Libraries.Get(jones, library.ID, LibraryRelations{})
+	assert.ErrorIs(t, err, ErrNotFound)
+	loaded, err := repos.Libraries.Get(smith, library.ID, LibraryRelations{Albums: true, Photos: true})
+	require.NoError(t, err)
+	assert.Len(t, loaded.Albums, 1)
+	assert.Len(t, loaded.Photos, 1)
+
+	// Names are per tenant, image directories aren't
+	taken, err := repos.Libraries.NameTaken(smith, "family", uuid.Nil)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	taken, err = repos.Libraries.NameTaken(smith, "family", library.ID)
+	require.NoError(t, err)
+	assert.False(t, taken)
+	taken, err = repos.Libraries.NameTaken(jones, "family", uuid.Nil)
+	require.NoError(t, err)
+	assert.False(t, taken)
+	taken, err = repos.Libraries.ImagesTaken(jones, "/tmp/family", uuid.Nil)
+	require.NoError(t, err)
+	assert.True(t, taken)
+
+	// Other spellings of the directory, its parents and its children are
+	// all taken
+	for _, images := range []string{"/tmp/family/", "/tmp/family/../family", "/tmp", "/tmp/family/2024"} {
+		taken, err = repos.Libraries.ImagesTaken(jones, images, uuid.Nil)
+		require.NoError(t, err)
+		assert.True(t, taken, images)
+	}
+	taken, err = repos.Libraries.ImagesTaken(jones, "/tmp/family-2024", uuid.Nil)
+	require.NoError(t, err)
+	assert.False(t, taken)
+	taken, err = repos.Libraries.ImagesTaken(smith, "/tmp/family/2024", library.ID)
+	require.NoError(t, err)
+	assert.False(t, taken)
+
+	stats, err := repos.Libraries.Stats(smith, library.ID)
+	require.NoError(t, err)
+	assert.Equal(t, LibraryStats{PhotoCount: 1, AlbumCount: 1, TagCount: 1, TotalSize: 10}, *stats)
+
+	// Deleting takes everything in the library along, but not the tag
+	require.NoError(t, repos.Libraries.Delete(smith, library))
+	for _, model := range []interface{}{&models.Library{}, &models.Album{}, &models.AlbumPhoto{}, &models.AlbumTag{}, &models.PhotoTag{}} {
+		var count int64
+		require.NoError(t, db.Model(model).Count(&count).Error)
+		assert.Zero(t, count, "%T", model)
+	}
+	var count int64
+	require.NoError(t, db.Unscoped().Model(&models.Photo{}).Where("id = ?", photo.ID).Count(&count).Error)
+	assert.Zero(t, count)
+	_, err = repos.Albums.Get(smith, album.ID, AlbumRelations{})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repos.Tags.Get(smith, tag.ID, TagRelations{})
+	assert.NoError(t, err)
+}
+
+func TestAlbumRepo(t *testing.T) {
+	db := newTestDB(t)
+	repos := NewGorm(db)
+	ctx := context.Background()
+
+	library, album, photo, tag := seed(t, ctx, repos, db, "family")
+	require.NoError(t, db.Create(&models.TagAlias{TagID: tag.ID, Name: "kin"}).Error)
+	other := &models.Album{Name: "Untagged", LibraryID: library.ID}
+	require.NoError(t, repos.Albums.Create(ctx, other))
+
+	// Tags match by name or alias
+	for _, name := range []string{"family-tag", "kin"} {
+		albums, err := repos.Albums.List(ctx, AlbumFilter{Tag: name}, AlbumRelations{})
+		require.NoError(t, err)
+		require.Len(t, albums, 1, name)
+		assert.Equal(t, album.ID, albums[0].ID)
+	}
+	albums, err := repos.Albums.List(ctx, AlbumFilter{LibraryID: library.ID}, AlbumRelations{})
+	require.NoError(t, err)
+	assert.Len(t, albums, 2)
+
+	loaded, err := repos.Albums.Get(ctx, album.ID, AlbumRelations{Library: true, Photos: true, PhotoTags: true, Tags: true})
+	require.NoError(t, err)
+	assert.Equal(t, "family", loaded.Library.Name)
+	require.Len(t, loaded.Photos, 1)
+	assert.Len(t, loaded.Photos[0].Tags, 1)
+	assert.Len(t, loaded.Tags, 1)
+
+	// The photos stay when their album goes
+	require.NoError(t, repos.Albums.Delete(ctx, album))
+	_, err = repos.Albums.Get(ctx, album.ID, AlbumRelations{})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repos.Photos.Get(ctx, photo.ID, PhotoRelations{})
+	assert.NoError(t, err)
+}
+
+func TestPhotoRepo(t *testing.T) {
+	db := newTestDB(t)
+	repos := NewGorm(db)
+	ctx := context.Background()
+
+	_, _, photo, _ := seed(t, ctx, repos, db, "family")
+
+	require.NoError(t, repos.Photos.ToggleFavorite(ctx, photo))
+	assert.True(t, photo.Favorite)
+	require.NoError(t, repos.Photos.ToggleFavorite(ctx, photo))
+	assert.False(t, photo.Favorite)
+
+	photo.Title = "Beach"
+	require.NoError(t, repos.Photos.Save(ctx, photo))
+	loaded, err := repos.Photos.Get(ctx, photo.ID, PhotoRelations{Library: true, Tags: true, Albums: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Beach", loaded.Title)
+	assert.Equal(t, "family", loaded.Library.Name)
+	assert.Len(t, loaded.Tags, 1)
+	assert.Len(t, loaded.Albums, 1)
+
+	_, err = repos.Photos.Get(ctx, uuid.New(), PhotoRelations{})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPhotoRepoList(t *testing.T) {
+	db := newTestDB(t)
+	repos := NewGorm(db)
+	smith := tenant.WithID(context.Background(), "smith")
+	jones := tenant.WithID(context.Background(), "jones")
+
+	library, _, tagged, _ := seed(t, smith, repos, db, "family")
+	add := func(name string, uploaded time.Time, taken *time.Time, favorite bool) *models.Photo {
+		photo := &models.Photo{Filename: name, OriginalName: name, FilePath: "/tmp/" + name, MimeType: "image/jpeg",
+			LibraryID: library.ID, UploadedAt: uploaded, TakenAt: taken, Favorite: favorite}
+		require.NoError(t, db.WithContext(smith).Create(photo).Error)
+		return photo
+	}
+	may := time.Date(2023, 5, 20, 18, 0, 0, 0, time.UTC)
+	july := time.Date(2023, 7, 4, 12, 0, 0, 0, time.UTC)
+	beach := add("beach.jpg", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), &may, true)
+	party := add("party.jpg", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), &july, false)
+	require.NoError(t, db.Model(tagged).Update("uploaded_at", time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)).Error)
+
+	// Filters narrow both the list and the count
+	favorite := true
+	photos, err := repos.Photos.List(smith, PhotoFilter{Favorite: &favorite}, PhotoPage{Order: "photos.uploaded_at desc", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, photos, 1)
+	assert.Equal(t, beach.ID, photos[0].ID)
+	count, err := repos.Photos.Count(smith, PhotoFilter{Tag: "family-tag"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = repos.Photos.Count(smith, PhotoFilter{Text: "PARTY"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = repos.Photos.Count(jones, PhotoFilter{})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// Pages by offset or continue after a cursor
+	photos, err = repos.Photos.List(smith, PhotoFilter{}, PhotoPage{Order: "photos.uploaded_at desc", Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, photos, 1)
+	assert.Equal(t, beach.ID, photos[0].ID)
+	photos, err = repos.Photos.List(smith, PhotoFilter{}, PhotoPage{
+		Limit: 10,
+		After: &PhotoCursor{UploadedAt: beach.UploadedAt, ID: beach.ID, Desc: true},
+		With:  PhotoRelations{Tags: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, photos, 1)
+	assert.Equal(t, tagged.ID, photos[0].ID)
+	assert.Len(t, photos[0].Tags, 1)
+
+	// Timelines group by capture date, falling back to upload date
+	buckets, total, err := repos.Photos.Timeline(smith, PhotoFilter{}, TimelinePage{Granularity: "month", Limit: 2, Thumbnails: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, "2023-07", buckets[0].Period)
+	assert.Equal(t, time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), buckets[0].Start)
+	require.Len(t, buckets[0].Photos, 1)
+	assert.Equal(t, party.ID, buckets[0].Photos[0].ID)
+	assert.Equal(t, "2023-05", buckets[1].Period)
+	assert.Equal(t, 2, buckets[1].Count)
+	require.Len(t, buckets[1].Photos, 1)
+	assert.Equal(t, beach.ID, buckets[1].Photos[0].ID)
+
+	buckets, total, err = repos.Photos.Timeline(smith, PhotoFilter{}, TimelinePage{Granularity: "year", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, 3, buckets[0].Count)
+	assert.Empty(t, buckets[0].Photos)
+}
+
+func TestTagRepo(t *testing.T) {
+	db := newTestDB(t)
+	repos := NewGorm(db)
+	smith := tenant.WithID(context.Background(), "smith")
+	jones := tenant.WithID(context.Background(), "jones")
+
+	library, album, photo, tag := seed(t, smith, repos, db, "family")
+	require.NoError(t, db.WithContext(smith).Create(&models.TagAlias{TagID: tag.ID, Name: "kin"}).Error)
+
+	assert.ErrorIs(t, repos.Tags.AddToPhoto(smith, tag.ID, photo.ID), ErrExists)
+	assert.ErrorIs(t, repos.Tags.AddToAlbum(smith, tag.ID, album.ID), ErrExists)
+
+	taken, err := repos.Tags.NameTaken(smith, "family-tag", uuid.Nil)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	taken, err = repos.Tags.AliasTaken(smith, "kin", uuid.Nil)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	taken, err = repos.Tags.AliasTaken(jones, "kin", uuid.Nil)
+	require.NoError(t, err)
+	assert.False(t, taken)
+
+	stats, err := repos.Tags.Stats(smith, tag.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.PhotoCount)
+	assert.Equal(t, int64(1), stats.AlbumCount)
+	assert.Equal(t, []TagLibraryCount{{LibraryID: library.ID, LibraryName: "family", PhotoCount: 1}}, stats.Libraries)
+
+	// Another tenant can't untag, it goes by the tag's tenant
+	assert.ErrorIs(t, repos.Tags.RemoveFromPhoto(jones, tag.ID, photo.ID), ErrNotFound)
+	require.NoError(t, repos.Tags.RemoveFromPhoto(smith, tag.ID, photo.ID))
+	assert.ErrorIs(t, repos.Tags.RemoveFromPhoto(smith, tag.ID, photo.ID), ErrNotFound)
+
+	require.NoError(t, repos.Tags.Delete(smith, tag))
+	taken, err = repos.Tags.AliasTaken(smith, "kin", uuid.Nil)
+	require.NoError(t, err)
+	assert.False(t, taken)
+	var count int64
+	require.NoError(t, db.Model(&models.AlbumTag{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
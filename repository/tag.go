@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"photo-library-server/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TagRepo stores tags and which photos and albums they are on
+type TagRepo interface {
+	Get(ctx context.Context, id uuid.UUID, with TagRelations) (*models.Tag, error)
+	// NameTaken reports whether a tag other than except is called name
+	NameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error)
+	// AliasTaken reports whether an alias other than except is called name
+	AliasTaken(ctx context.Context, name string, except uuid.UUID) (bool, error)
+	Create(ctx context.Context, tag *models.Tag) error
+	Save(ctx context.Context, tag *models.Tag) error
+	// Delete removes a tag with its aliases, taking it off every photo and
+	// album
+	Delete(ctx context.Context, tag *models.Tag) error
+
+	// AddToPhoto tags a photo, with ErrExists if it already has the tag
+	AddToPhoto(ctx context.Context, tagID, photoID uuid.UUID) error
+	// RemoveFromPhoto untags a photo, with ErrNotFound if it doesn't have
+	// the tag
+	RemoveFromPhoto(ctx context.Context, tagID, photoID uuid.UUID) error
+	// AddToAlbum tags an album, with ErrExists if it already has the tag
+	AddToAlbum(ctx context.Context, tagID, albumID uuid.UUID) error
+	// RemoveFromAlbum untags an album, with ErrNotFound if it doesn't have
+	// the tag
+	RemoveFromAlbum(ctx context.Context, tagID, albumID uuid.UUID) error
+
+	Stats(ctx context.Context, id uuid.UUID) (*TagStats, error)
+}
+
+// TagRelations selects the related records loaded with tags
+type TagRelations struct {
+	Photos bool
+}
+
+// TagStats counts where a tag is used. Photos in the trash aren't counted.
+type TagStats struct {
+	PhotoCount int64
+	AlbumCount int64
+	Libraries  []TagLibraryCount // Libraries with tagged photos
+}
+
+// TagLibraryCount is the number of a library's photos with a tag
+type TagLibraryCount struct {
+	LibraryID   uuid.UUID `json:"library_id"`
+	LibraryName string    `json:"library_name"`
+	PhotoCount  int64     `json:"photo_count"`
+}
+
+// WhereTagName limits a query joined with tags to the tag called name, or
+// the tag with an alias called name
+func WhereTagName(query *gorm.DB, name string) *gorm.DB {
+	return query.Where("(tags.name = ? OR tags.id IN (SELECT tag_id FROM tag_aliases WHERE name = ?))", name, name)
+}
+
+// gormTagRepo is the TagRepo of a GORM database
+type gormTagRepo struct {
+	db *gorm.DB
+}
+
+// NewTagRepo returns a TagRepo on db
+func NewTagRepo(db *gorm.DB) TagRepo {
+	return &gormTagRepo{db: db}
+}
+
+func (r *gormTagRepo) Get(ctx context.Context, id uuid.UUID, with TagRelations) (*models.Tag, error) {
+	query := r.db.WithContext(ctx).Model(&models.Tag{})
+	if with.Photos {
+		query = query.Preload("Photos")
+	}
+
+	var tag models.Tag
+	if err := first(query, &tag, id); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (r *gormTagRepo) NameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error) {
+	return exists(r.db.WithContext(ctx).Model(&models.Tag{}).Where("name = ? AND id != ?", name, except))
+}
+
+func (r *gormTagRepo) AliasTaken(ctx context.Context, name string, except uuid.UUID) (bool, error) {
+	return exists(r.db.WithContext(ctx).Model(&models.TagAlias{}).Where("name = ? AND id != ?", name, except))
+}
+
+func (r *gormTagRepo) Create(ctx context.Context, tag *models.Tag) error {
+	return r.db.WithContext(ctx).Create(tag).Error
+}
+
+func (r *gormTagRepo) Save(ctx context.Context, tag *models.Tag) error {
+	return r.db.WithContext(ctx).Save(tag).Error
+}
+
+func (r *gormTagRepo) Delete(ctx context.Context, tag *models.Tag) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, step := range []struct {
+			what  string
+			model interface{}
+		}{
+			{"photo tags", &models.PhotoTag{}},
+			{"album tags", &models.AlbumTag{}},
+			{"tag aliases", &models.TagAlias{}},
+		} {
+			if err := tx.Where("tag_id = ?", tag.ID).Delete(step.model).Error; err != nil {
+				return fmt.Errorf("failed to delete %s: %w", step.what, err)
+			}
+		}
+
+		return tx.Delete(tag).Error
+	})
+}
+
+func (r *gormTagRepo) AddToPhoto(ctx context.Context, tagID, photoID uuid.UUID) error {
+	db := r.db.WithContext(ctx)
+	tagged, err := exists(db.Model(&models.PhotoTag{}).Where("tag_id = ? AND photo_id = ?", tagID, photoID))
+	if err != nil {
+		return err
+	}
+	if tagged {
+		return ErrExists
+	}
+	return db.Create(&models.PhotoTag{TagID: tagID, PhotoID: photoID}).Error
+}
+
+func (r *gormTagRepo) RemoveFromPhoto(ctx context.Context, tagID, photoID uuid.UUID) error {
+	return r.untag(ctx, &models.PhotoTag{}, "photo_id", tagID, photoID)
+}
+
+func (r *gormTagRepo) AddToAlbum(ctx context.Context, tagID, albumID uuid.UUID) error {
+	db := r.db.WithContext(ctx)
+	tagged, err := exists(db.Model(&models.AlbumTag{}).Where("tag_id = ? AND album_id = ?", tagID, albumID))
+	if err != nil {
+		return err
+	}
+	if tagged {
+		return ErrExists
+	}
+	return db.Create(&models.AlbumTag{TagID: tagID, AlbumID: albumID}).Error
+}
+
+func (r *gormTagRepo) RemoveFromAlbum(ctx context.Context, tagID, albumID uuid.UUID) error {
+	return r.untag(ctx, &models.AlbumTag{}, "album_id", tagID, albumID)
+}
+
+// untag deletes the join row of model linking the tag to the record in
+// column
+func (r *gormTagRepo) untag(ctx context.Context, model interface{}, column string, tagID, id uuid.UUID) error {
+	db := r.db.WithContext(ctx)
+
+	// Join rows have no tenant of their own, so go by the tag's
+	result := db.Where("tag_id = ? AND "+column+" = ?", tagID, id).
+		Where("tag_id IN (?)", db.Model(&models.Tag{}).Select("id")).
+		Delete(model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormTagRepo) Stats(ctx context.Context, id uuid.UUID) (*TagStats, error) {
+	db := r.db.WithContext(ctx)
+	var stats TagStats
+
+	if err := db.Model(&models.PhotoTag{}).
+		Joins("JOIN photos ON photos.id = photo_tags.photo_id").
+		Where("photo_tags.tag_id = ? AND photos.deleted_at IS NULL", id).
+		Count(&stats.PhotoCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.AlbumTag{}).Where("tag_id = ?", id).Count(&stats.AlbumCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Table("libraries").
+		Select("libraries.id as library_id, libraries.name as library_name, COUNT(photo_tags.photo_id) as photo_count").
+		Joins("JOIN photos ON libraries.id = photos.library_id").
+		Joins("JOIN photo_tags ON photos.id = photo_tags.photo_id").
+		Where("photo_tags.tag_id = ? AND photos.deleted_at IS NULL", id).
+		Group("libraries.id, libraries.name").
+		Find(&stats.Libraries).Error; err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
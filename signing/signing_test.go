@@ -0,0 +1,72 @@
+package signing
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queryOf parses the query string of a signed path
+func queryOf(t *testing.T, signed string) (string, url.Values) {
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	return parsed.Path, parsed.Query()
+}
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner("secret", time.Hour)
+
+	t.Run("Round trip", func(t *testing.T) {
+		path, query := queryOf(t, signer.SignPath("/api/v1/photos/abc/file"))
+		assert.Equal(t, "/api/v1/photos/abc/file", path)
+		assert.NoError(t, signer.Verify(path, query))
+	})
+
+	t.Run("Stable within a TTL window", func(t *testing.T) {
+		assert.Equal(t, signer.SignPath("/a"), signer.SignPath("/a"))
+	})
+
+	t.Run("Tampering is detected", func(t *testing.T) {
+		_, query := queryOf(t, signer.SignPath("/api/v1/photos/abc/file"))
+		assert.ErrorIs(t, signer.Verify("/api/v1/photos/xyz/file", query), ErrInvalidSignature)
+
+		query.Set(ExpiresParam, "9999999999")
+		assert.ErrorIs(t, signer.Verify("/api/v1/photos/abc/file", query), ErrInvalidSignature)
+
+		other := NewSigner("other-secret", time.Hour)
+		path, query := queryOf(t, other.SignPath("/api/v1/photos/abc/file"))
+		assert.ErrorIs(t, signer.Verify(path, query), ErrInvalidSignature)
+	})
+
+	t.Run("Expired and missing signatures", func(t *testing.T) {
+		path, query := queryOf(t, signer.SignPathUntil("/p", time.Now().Add(-time.Second)))
+		assert.ErrorIs(t, signer.Verify(path, query), ErrExpired)
+		assert.ErrorIs(t, signer.Verify("/p", url.Values{}), ErrMissingSignature)
+	})
+
+	t.Run("One-time URLs", func(t *testing.T) {
+		path, query := queryOf(t, signer.SignPathOnce("/p", time.Now().Add(time.Minute), "n1"))
+		assert.NoError(t, signer.Verify(path, query))
+		assert.ErrorIs(t, signer.Verify(path, query), ErrAlreadyUsed)
+
+		// The nonce is covered by the signature
+		_, query = queryOf(t, signer.SignPathOnce("/p", time.Now().Add(time.Minute), "n2"))
+		query.Del(NonceParam)
+		assert.ErrorIs(t, signer.Verify(path, query), ErrInvalidSignature)
+
+		// Expired one-time URLs are rejected without being redeemed
+		path, query = queryOf(t, signer.SignPathOnce("/p", time.Now().Add(-time.Second), "n3"))
+		assert.ErrorIs(t, signer.Verify(path, query), ErrExpired)
+	})
+
+	t.Run("Disabled signer leaves paths untouched", func(t *testing.T) {
+		disabled := NewSigner("", time.Hour)
+		assert.False(t, disabled.Enabled())
+		assert.Equal(t, "/p", disabled.SignPath("/p"))
+		assert.False(t, strings.Contains(disabled.SignPathUntil("/p", time.Now()), "?"))
+	})
+}
@@ -0,0 +1,88 @@
+package tagnorm
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Policy describes which normalization steps are applied to tag names
+type Policy struct {
+	Trim         bool // Trim surrounding whitespace and collapse inner runs to one space
+	NFC          bool // Unicode NFC so composed and decomposed accents compare equal
+	CaseFold     bool // Unicode case folding ("DEJA VU" -> "deja vu")
+	StripAccents bool // Remove diacritics ("déjà vu" -> "deja vu")
+}
+
+// DefaultPolicy removes differences in spacing, Unicode form and case, which
+// are almost never meant to make two tags
+var DefaultPolicy = Policy{Trim: true, NFC: true, CaseFold: true}
+
+// ParsePolicy parses a comma-separated list of steps: trim, nfc, casefold,
+// strip_accents. "none" disables normalization entirely.
+func ParsePolicy(spec string) (Policy, error) {
+	var policy Policy
+	for _, step := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(strings.ToLower(step)) {
+		case "", "none":
+		case "trim":
+			policy.Trim = true
+		case "nfc":
+			policy.NFC = true
+		case "casefold", "lowercase":
+			policy.CaseFold = true
+		case "strip_accents":
+			policy.StripAccents = true
+		default:
+			return Policy{}, fmt.Errorf("unknown tag normalization step %q", step)
+		}
+	}
+	return policy, nil
+}
+
+// Normalize applies the policy to a tag name
+func (p Policy) Normalize(name string) string {
+	if p.Trim {
+		name = strings.Join(strings.Fields(name), " ")
+	}
+	if p.StripAccents {
+		// Decompose so accents become separate marks, drop them, then recompose
+		stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+		if err == nil {
+			name = stripped
+		}
+	}
+	if p.CaseFold {
+		name = cases.Fold().String(name)
+	}
+	if p.NFC {
+		name = norm.NFC.String(name)
+	}
+	return name
+}
+
+// String returns the policy in the form accepted by ParsePolicy
+func (p Policy) String() string {
+	var steps []string
+	if p.Trim {
+		steps = append(steps, "trim")
+	}
+	if p.NFC {
+		steps = append(steps, "nfc")
+	}
+	if p.CaseFold {
+		steps = append(steps, "casefold")
+	}
+	if p.StripAccents {
+		steps = append(steps, "strip_accents")
+	}
+	if len(steps) == 0 {
+		return "none"
+	}
+	return strings.Join(steps, ",")
+}
@@ -0,0 +1,45 @@
+package tagnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Run("Default policy", func(t *testing.T) {
+		// "e" + combining acute vs precomposed "é"
+		assert.Equal(t, "café", DefaultPolicy.Normalize("café"))
+		assert.Equal(t, "summer trip", DefaultPolicy.Normalize("  summer \t trip "))
+		for _, name := range []string{"Déjà vu", "déjà vu", "DÉJÀ VU "} {
+			assert.Equal(t, "déjà vu", DefaultPolicy.Normalize(name), name)
+		}
+		assert.Equal(t, "deja vu", DefaultPolicy.Normalize("DEJA VU "))
+	})
+
+	t.Run("Full policy merges variants", func(t *testing.T) {
+		policy, err := ParsePolicy("trim,nfc,casefold,strip_accents")
+		require.NoError(t, err)
+
+		for _, name := range []string{"Déjà vu", "deja vu", "DEJA VU ", "Déjà vu"} {
+			assert.Equal(t, "deja vu", policy.Normalize(name), name)
+		}
+		assert.Equal(t, "strasse", policy.Normalize("STRAßE"))
+	})
+
+	t.Run("Parse policy", func(t *testing.T) {
+		policy, err := ParsePolicy("none")
+		require.NoError(t, err)
+		assert.Equal(t, " As Is ", policy.Normalize(" As Is "))
+		assert.Equal(t, "none", policy.String())
+
+		policy, err = ParsePolicy(" Trim , CaseFold ")
+		require.NoError(t, err)
+		assert.Equal(t, Policy{Trim: true, CaseFold: true}, policy)
+		assert.Equal(t, "trim,casefold", policy.String())
+
+		_, err = ParsePolicy("trim,soundex")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,80 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Column is the column that holds the owning tenant in scoped tables
+const Column = "tenant_id"
+
+type contextKey struct{}
+
+// validID matches tenant IDs: lowercase letters, digits and hyphens, usable
+// as a DNS label
+var validID = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidID reports whether id can be used as a tenant ID
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// WithID returns a context scoped to the tenant id. An empty id leaves
+// queries unscoped.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant a context is scoped to
+func FromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// Scope returns db limited to the tenant id, for code that runs outside a
+// request (such as background jobs) but acts on behalf of one tenant
+func Scope(db *gorm.DB, id string) *gorm.DB {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.WithContext(WithID(ctx, id))
+}
+
+// Register installs callbacks that limit queries, updates and deletes on
+// tables to the tenant of the statement's context. Statements without a
+// tenant are left unscoped.
+func Register(db *gorm.DB, tables ...string) error {
+	scoped := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		scoped[table] = true
+	}
+
+	scope := func(db *gorm.DB) {
+		id, ok := FromContext(db.Statement.Context)
+		if !ok || id == "" || !scoped[db.Statement.Table] {
+			return
+		}
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: Column}, Value: id},
+		}})
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:query", scope); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:row", scope); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:update", scope); err != nil {
+		return err
+	}
+	return callbacks.Delete().Before("gorm:delete").Register("tenant:delete", scope)
+}
@@ -0,0 +1,97 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type item struct {
+	ID       uint
+	TenantID string
+	Name     string
+}
+
+type other struct {
+	ID   uint
+	Name string
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, Register(db, "items"))
+	require.NoError(t, db.AutoMigrate(&item{}, &other{}))
+
+	require.NoError(t, db.Create(&[]item{
+		{TenantID: "smith", Name: "a"},
+		{TenantID: "smith", Name: "b"},
+		{TenantID: "jones", Name: "c"},
+	}).Error)
+	require.NoError(t, db.Create(&other{Name: "shared"}).Error)
+	return db
+}
+
+func TestValidID(t *testing.T) {
+	assert.True(t, ValidID("smith"))
+	assert.True(t, ValidID("family-2"))
+	assert.False(t, ValidID(""))
+	assert.False(t, ValidID("Smith"))
+	assert.False(t, ValidID("-smith"))
+	assert.False(t, ValidID("smith.example"))
+}
+
+func TestScopedQueries(t *testing.T) {
+	db := setupDB(t)
+	smith := Scope(db, "smith")
+
+	var items []item
+	require.NoError(t, smith.Find(&items).Error)
+	assert.Len(t, items, 2)
+
+	var count int64
+	require.NoError(t, Scope(db, "jones").Model(&item{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	var found item
+	assert.ErrorIs(t, smith.Where("name = ?", "c").First(&found).Error, gorm.ErrRecordNotFound)
+
+	// Unscoped tables and statements without a tenant see everything
+	var others []other
+	require.NoError(t, smith.Find(&others).Error)
+	assert.Len(t, others, 1)
+	require.NoError(t, db.Find(&items).Error)
+	assert.Len(t, items, 3)
+	require.NoError(t, db.WithContext(WithID(context.Background(), "")).Find(&items).Error)
+	assert.Len(t, items, 3)
+}
+
+func TestScopedWrites(t *testing.T) {
+	db := setupDB(t)
+	smith := Scope(db, "smith")
+
+	result := smith.Model(&item{}).Where("name = ?", "c").Update("name", "renamed")
+	require.NoError(t, result.Error)
+	assert.Equal(t, int64(0), result.RowsAffected)
+
+	result = smith.Where("name IN ?", []string{"a", "c"}).Delete(&item{})
+	require.NoError(t, result.Error)
+	assert.Equal(t, int64(1), result.RowsAffected)
+
+	var count int64
+	db.Model(&item{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	id, ok := FromContext(WithID(context.Background(), "smith"))
+	assert.True(t, ok)
+	assert.Equal(t, "smith", id)
+}
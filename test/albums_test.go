@@ -1,13 +1,23 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"photo-library-server/models"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestAlbumEndpoints tests all album-related endpoints
@@ -120,6 +130,161 @@ func TestAlbumEndpoints(t *testing.T) {
 		}
 	})
 
+	t.Run("Album Tags", func(t *testing.T) {
+		italy := tc.createTestAlbum("Italy 2023", "Summer trip", library.ID)
+		home := tc.createTestAlbum("Home", "Around the house", library.ID)
+		travel := tc.createTestTag("Travel", "")
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", travel.ID), map[string]interface{}{"album_id": italy.ID.String()})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		// Tagging twice is a conflict
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", travel.ID), map[string]interface{}{"album_id": italy.ID.String()})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		// Filter albums by tag name
+		resp = tc.makeRequest("GET", "/api/v1/albums?tag=Travel&include_tags=true", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var albums []models.Album
+		json.Unmarshal(resp.Body.Bytes(), &albums)
+		assert.Len(t, albums, 1)
+		assert.Equal(t, italy.ID, albums[0].ID)
+		assert.Len(t, albums[0].Tags, 1)
+		assert.Equal(t, "travel", albums[0].Tags[0].Name)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s?include_tags=true", home.ID), nil)
+		var album models.Album
+		json.Unmarshal(resp.Body.Bytes(), &album)
+		assert.Empty(t, album.Tags)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/tags/%s/stats", travel.ID), nil)
+		var stats map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &stats)
+		assert.Equal(t, float64(1), stats["album_count"])
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/tags/%s/albums/%s", travel.ID, italy.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/tags/%s/albums/%s", travel.ID, italy.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeRequest("GET", "/api/v1/albums?tag=Travel", nil)
+		json.Unmarshal(resp.Body.Bytes(), &albums)
+		assert.Empty(t, albums)
+	})
+
+	t.Run("Album Tags - Not Found", func(t *testing.T) {
+		album := tc.createTestAlbum("Tagless", "", library.ID)
+		tag := tc.createTestTag("orphan", "")
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", uuid.New()), map[string]interface{}{"album_id": album.ID.String()})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", tag.ID), map[string]interface{}{"album_id": uuid.New().String()})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", tag.ID), map[string]interface{}{"album_id": "not-a-uuid"})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", tag.ID), map[string]interface{}{})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Delete Album - Removes Tags", func(t *testing.T) {
+		album := tc.createTestAlbum("Tagged Then Deleted", "", library.ID)
+		tag := tc.createTestTag("ephemeral", "")
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", tag.ID), map[string]interface{}{"album_id": album.ID.String()})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/albums/%s", album.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var count int64
+		tc.DB.GetDB().Model(&models.AlbumTag{}).Where("tag_id = ?", tag.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("Album Date Ranges", func(t *testing.T) {
+		album := tc.createTestAlbum("Italy 2023", "", library.ID)
+		assert.Nil(t, album.StartDate)
+		assert.Nil(t, album.EndDate)
+
+		upload := func(takenAt time.Time) TestPhoto {
+			resp := tc.makeMultipartRequest("/api/v1/photos/upload",
+				map[string]string{"library_id": library.ID.String()},
+				map[string][]byte{"photo": createTestImageTakenAt(takenAt)})
+			require.Equal(t, http.StatusCreated, resp.Code)
+
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			return photo
+		}
+
+		june3 := time.Date(2023, 6, 3, 9, 15, 0, 0, time.UTC)
+		june10 := time.Date(2023, 6, 10, 18, 0, 0, 0, time.UTC)
+		june17 := time.Date(2023, 6, 17, 20, 45, 0, 0, time.UTC)
+
+		first := upload(june10)
+		require.NotNil(t, first.TakenAt)
+		assert.True(t, june10.Equal(*first.TakenAt))
+		second := upload(june3)
+		third := upload(june17)
+		undated := tc.uploadTestPhoto(library.ID, "undated.jpg", nil, "")
+
+		getAlbum := func() TestAlbum {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s", album.ID), nil)
+			var result TestAlbum
+			json.Unmarshal(resp.Body.Bytes(), &result)
+			return result
+		}
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{"photo_id": first.ID})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		result := getAlbum()
+		require.NotNil(t, result.StartDate)
+		assert.True(t, june10.Equal(*result.StartDate))
+		assert.True(t, june10.Equal(*result.EndDate))
+
+		// Photos without a capture date don't affect the range
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{second.ID, third.ID, undated.ID},
+		})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		result = getAlbum()
+		assert.True(t, june3.Equal(*result.StartDate))
+		assert.True(t, june17.Equal(*result.EndDate))
+
+		// The range is part of album listings too
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums?library_id=%s", library.ID), nil)
+		var albums []TestAlbum
+		json.Unmarshal(resp.Body.Bytes(), &albums)
+		for _, a := range albums {
+			if a.ID == album.ID {
+				require.NotNil(t, a.StartDate)
+				assert.True(t, june3.Equal(*a.StartDate))
+			}
+		}
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/albums/%s/photos/%s", album.ID, third.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.True(t, june10.Equal(*getAlbum().EndDate))
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos/remove", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{second.ID},
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.True(t, june10.Equal(*getAlbum().StartDate))
+
+		// Deleting the last dated photo clears the range
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", first.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		result = getAlbum()
+		assert.Nil(t, result.StartDate)
+		assert.Nil(t, result.EndDate)
+	})
+
 	t.Run("Get Album by ID", func(t *testing.T) {
 		createdAlbum := tc.createTestAlbum("Single Album", "Test album", library.ID)
 
@@ -213,6 +378,100 @@ func TestAlbumEndpoints(t *testing.T) {
 		assert.Equal(t, "Photo added to album successfully", response["message"])
 	})
 
+	t.Run("Add Multiple Photos to Album", func(t *testing.T) {
+		album := tc.createTestAlbum("Bulk Add Album", "Bulk add", library.ID)
+		photo1 := tc.uploadTestPhoto(library.ID, "bulk_add1.jpg", nil, "")
+		photo2 := tc.uploadTestPhoto(library.ID, "bulk_add2.jpg", nil, "")
+		photo3 := tc.uploadTestPhoto(library.ID, "bulk_add3.jpg", nil, "")
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids":      []uuid.UUID{photo1.ID, photo2.ID},
+			"start_position": 10,
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, float64(2), response["added"])
+		assert.Empty(t, response["skipped_photo_ids"])
+
+		// Existing members are skipped and new ones are appended after the last position
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo2.ID, photo3.ID},
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, float64(1), response["added"])
+		assert.Equal(t, []interface{}{photo2.ID.String()}, response["skipped_photo_ids"])
+
+		var orders []int
+		tc.DB.GetDB().Model(&models.AlbumPhoto{}).Where("album_id = ?", album.ID).Order("\"order\"").Pluck("order", &orders)
+		assert.Equal(t, []int{10, 11, 12}, orders)
+	})
+
+	t.Run("Add Multiple Photos to Album - Validation Is All Or Nothing", func(t *testing.T) {
+		album := tc.createTestAlbum("Bulk Add Strict", "Bulk add", library.ID)
+		photo := tc.uploadTestPhoto(library.ID, "bulk_strict.jpg", nil, "")
+		otherPhoto := tc.uploadTestPhoto(otherLibrary.ID, "bulk_other.jpg", nil, "")
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo.ID, otherPhoto.ID},
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo.ID, uuid.New()},
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		var count int64
+		tc.DB.GetDB().Model(&models.AlbumPhoto{}).Where("album_id = ?", album.ID).Count(&count)
+		assert.Equal(t, int64(0), count, "No memberships should be created when validation fails")
+	})
+
+	t.Run("Remove Multiple Photos from Album", func(t *testing.T) {
+		album := tc.createTestAlbum("Bulk Remove Album", "Bulk remove", library.ID)
+		photo1 := tc.uploadTestPhoto(library.ID, "bulk_remove1.jpg", nil, "")
+		photo2 := tc.uploadTestPhoto(library.ID, "bulk_remove2.jpg", nil, "")
+		photo3 := tc.uploadTestPhoto(library.ID, "bulk_remove3.jpg", nil, "")
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo1.ID, photo2.ID, photo3.ID},
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		notMember := uuid.New()
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos/remove", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo1.ID, photo3.ID, notMember},
+		})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, float64(2), response["removed"])
+		assert.Equal(t, []interface{}{notMember.String()}, response["not_in_album_photo_ids"])
+
+		var remaining []string
+		tc.DB.GetDB().Model(&models.AlbumPhoto{}).Where("album_id = ?", album.ID).Pluck("photo_id", &remaining)
+		assert.Equal(t, []string{photo2.ID.String()}, remaining)
+	})
+
+	t.Run("Remove Multiple Photos from Album - Validation", func(t *testing.T) {
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos/remove", uuid.New()), map[string]interface{}{
+			"photo_ids": []uuid.UUID{uuid.New()},
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		album := tc.createTestAlbum("Bulk Remove Empty", "Bulk remove", library.ID)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos/remove", album.ID), map[string]interface{}{})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "photo_ids is required", response["error"])
+	})
+
 	t.Run("Add Photo to Album - Album Not Found", func(t *testing.T) {
 		nonExistentID := uuid.New()
 		photo := tc.uploadTestPhoto(library.ID, "orphan_photo.jpg", nil, "")
@@ -337,6 +596,564 @@ func TestAlbumEndpoints(t *testing.T) {
 		assert.Equal(t, "Photo order updated successfully", response["message"])
 	})
 
+	t.Run("Reorder Album Photos", func(t *testing.T) {
+		album := tc.createTestAlbum("Reorder Test", "", library.ID)
+		var ids []uuid.UUID
+		for i := 0; i < 5; i++ {
+			ids = append(ids, tc.uploadTestPhoto(library.ID, fmt.Sprintf("reorder%d.jpg", i), nil, "").ID)
+		}
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{"photo_ids": ids})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		a, b, c, d, e := ids[0], ids[1], ids[2], ids[3], ids[4]
+
+		orderPath := fmt.Sprintf("/api/v1/albums/%s/photos/order", album.ID)
+		reorder := func(body map[string]interface{}) []uuid.UUID {
+			resp := tc.makeRequest("PUT", orderPath, body)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var result struct {
+				PhotoIDs []uuid.UUID `json:"photo_ids"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result.PhotoIDs
+		}
+		albumOrder := func() []uuid.UUID {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var page struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+			order := []uuid.UUID{}
+			for _, photo := range page.Photos {
+				order = append(order, photo.ID)
+			}
+			return order
+		}
+
+		// The full list in its new order
+		assert.Equal(t, []uuid.UUID{e, c, a, d, b}, reorder(map[string]interface{}{"photo_ids": []uuid.UUID{e, c, a, d, b}}))
+		assert.Equal(t, []uuid.UUID{e, c, a, d, b}, albumOrder())
+
+		// Inserting some at a position keeps the others in order around them
+		assert.Equal(t, []uuid.UUID{e, b, d, c, a}, reorder(map[string]interface{}{"photo_ids": []uuid.UUID{b, d}, "position": 1}))
+		assert.Equal(t, []uuid.UUID{b, d, c, a, e}, reorder(map[string]interface{}{"photo_ids": []uuid.UUID{e}, "position": 99}))
+		assert.Equal(t, []uuid.UUID{a, b, d, c, e}, reorder(map[string]interface{}{"photo_ids": []uuid.UUID{a}, "position": 0}))
+		assert.Equal(t, []uuid.UUID{a, b, d, c, e}, albumOrder())
+
+		// Incomplete lists, strangers and repeats change nothing
+		outsider := tc.uploadTestPhoto(library.ID, "reorder-outsider.jpg", nil, "")
+		for _, body := range []map[string]interface{}{
+			{"photo_ids": []uuid.UUID{e, d, c, b}},
+			{"photo_ids": []uuid.UUID{e, d, c, b, a, outsider.ID}},
+			{"photo_ids": []uuid.UUID{outsider.ID}, "position": 0},
+			{"photo_ids": []uuid.UUID{a, a}, "position": 2},
+			{"photo_ids": []uuid.UUID{a}, "position": -1},
+			{"photo_ids": []uuid.UUID{}},
+		} {
+			resp := tc.makeRequest("PUT", orderPath, body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+		}
+		resp = tc.makeRequest("PUT", orderPath, map[string]interface{}{"photo_ids": []uuid.UUID{e, d, c, b}})
+		assert.Contains(t, resp.Body.String(), a.String())
+		assert.Equal(t, []uuid.UUID{a, b, d, c, e}, albumOrder())
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/photos/order", uuid.New()), map[string]interface{}{"photo_ids": ids})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Album Sort Mode", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/albums", map[string]interface{}{
+			"name": "Sorted Album", "library_id": library.ID, "sort_mode": "taken_at",
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var album struct {
+			ID       uuid.UUID `json:"id"`
+			SortMode string    `json:"sort_mode"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &album))
+		assert.Equal(t, "taken_at", album.SortMode)
+
+		upload := func(name string, data []byte, rating int) uuid.UUID {
+			resp := tc.uploadTestFile(library.ID, name, "image/jpeg", data)
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var photo TestPhoto
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &photo))
+			if rating > 0 {
+				resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", photo.ID), map[string]interface{}{"rating": rating})
+				require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			}
+			return photo.ID
+		}
+		// Added in manual order undated, late, early
+		undated := upload("b-undated.jpg", createTestImage(), 5)
+		late := upload("c-late.jpg", createTestImageTakenAt(time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)), 0)
+		early := upload("a-early.jpg", createTestImageTakenAt(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)), 3)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID),
+			map[string]interface{}{"photo_ids": []uuid.UUID{undated, late, early}})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		order := func(query string) ([]uuid.UUID, []uuid.UUID) {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos?%s", album.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var page struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+			listed := []uuid.UUID{}
+			for _, photo := range page.Photos {
+				listed = append(listed, photo.ID)
+			}
+
+			resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s?include_photos=true", album.ID), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var included struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &included))
+			preloaded := []uuid.UUID{}
+			for _, photo := range included.Photos {
+				preloaded = append(preloaded, photo.ID)
+			}
+			return listed, preloaded
+		}
+
+		for _, mode := range []struct {
+			name     string
+			expected []uuid.UUID
+		}{
+			{"taken_at", []uuid.UUID{early, late, undated}}, // Undated last
+			{"filename", []uuid.UUID{early, undated, late}},
+			{"rating", []uuid.UUID{undated, early, late}}, // Unrated last
+			{"manual", []uuid.UUID{undated, late, early}},
+			{"uploaded_at", []uuid.UUID{undated, late, early}},
+		} {
+			resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s", album.ID), map[string]interface{}{"sort_mode": mode.name})
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			listed, preloaded := order("")
+			assert.Equal(t, mode.expected, listed, mode.name)
+			assert.Equal(t, mode.expected, preloaded, mode.name)
+		}
+
+		// order_by still overrides the sort mode
+		listed, _ := order("order_by=filename&order_dir=desc")
+		assert.Equal(t, []uuid.UUID{late, undated, early}, listed)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s", album.ID), map[string]interface{}{"sort_mode": "random"})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", "/api/v1/albums", map[string]interface{}{
+			"name": "Unsorted Album", "library_id": library.ID, "sort_mode": "size",
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		defaulted := tc.createTestAlbum("Default Sort Album", "", library.ID)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s", defaulted.ID), nil)
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &album))
+		assert.Equal(t, "manual", album.SortMode)
+	})
+
+	t.Run("Duplicate Album", func(t *testing.T) {
+		master := tc.createTestAlbum("Master", "Every shot", library.ID)
+		var ids []uuid.UUID
+		for i := 0; i < 4; i++ {
+			ids = append(ids, tc.uploadTestPhoto(library.ID, fmt.Sprintf("master_%d.jpg", i), nil, "").ID)
+		}
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", master.ID), map[string]interface{}{"photo_ids": ids})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/photos/order", master.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{ids[2], ids[0], ids[3], ids[1]},
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/cover", master.ID), map[string]interface{}{"photo_id": ids[3]})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		tag := tc.createTestTag("master-tag", "")
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/albums", tag.ID), map[string]interface{}{"album_id": master.ID.String()})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", ids[1]), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		type duplicated struct {
+			OriginalID uuid.UUID `json:"original_id"`
+			Album      struct {
+				ID           uuid.UUID  `json:"id"`
+				Name         string     `json:"name"`
+				Description  string     `json:"description"`
+				LibraryID    uuid.UUID  `json:"library_id"`
+				CoverPhotoID *uuid.UUID `json:"cover_photo_id"`
+				Tags         []TestTag  `json:"tags"`
+			} `json:"album"`
+			CopiedPhotos int `json:"copied_photos"`
+		}
+		albumPhotos := func(albumID uuid.UUID) []TestPhoto {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", albumID), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var page struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+			return page.Photos
+		}
+
+		// Within the library the same photos are shared, without the trashed one
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/duplicate", master.ID), nil)
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var picks duplicated
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &picks))
+		assert.Equal(t, master.ID, picks.OriginalID)
+		assert.NotEqual(t, master.ID, picks.Album.ID)
+		assert.Equal(t, "Master (copy)", picks.Album.Name)
+		assert.Equal(t, "Every shot", picks.Album.Description)
+		assert.Equal(t, 0, picks.CopiedPhotos)
+		require.NotNil(t, picks.Album.CoverPhotoID)
+		assert.Equal(t, ids[3], *picks.Album.CoverPhotoID)
+		require.Len(t, picks.Album.Tags, 1)
+		assert.Equal(t, tag.ID, picks.Album.Tags[0].ID)
+		listed := []uuid.UUID{}
+		for _, photo := range albumPhotos(picks.Album.ID) {
+			listed = append(listed, photo.ID)
+		}
+		assert.Equal(t, []uuid.UUID{ids[2], ids[0], ids[3]}, listed)
+
+		// The duplicate changes on its own
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/albums/%s/photos/%s", picks.Album.ID, ids[0]), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Len(t, albumPhotos(master.ID), 3)
+
+		// Into another library the photos are copied
+		other := tc.createTestLibrary("Duplicate Target", "")
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/duplicate", master.ID), map[string]interface{}{
+			"name": "Selects", "library_id": other.ID,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var selects duplicated
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &selects))
+		assert.Equal(t, "Selects", selects.Album.Name)
+		assert.Equal(t, other.ID, selects.Album.LibraryID)
+		assert.Equal(t, 3, selects.CopiedPhotos)
+		copies := albumPhotos(selects.Album.ID)
+		require.Len(t, copies, 3)
+		for i, original := range []uuid.UUID{ids[2], ids[0], ids[3]} {
+			assert.NotEqual(t, original, copies[i].ID)
+			assert.Equal(t, other.ID, copies[i].LibraryID)
+		}
+		require.NotNil(t, selects.Album.CoverPhotoID)
+		assert.Equal(t, copies[2].ID, *selects.Album.CoverPhotoID)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/duplicate", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/duplicate", master.ID), map[string]interface{}{"library_id": uuid.New()})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Album Shares", func(t *testing.T) {
+		album := tc.createTestAlbum("Tom & Jerry <3", "", library.ID)
+		photo1 := tc.uploadTestPhoto(library.ID, "shared1.jpg", nil, "")
+		photo2 := tc.uploadTestPhoto(library.ID, "shared2.jpg", nil, "")
+		outsider := tc.uploadTestPhoto(library.ID, "not_shared.jpg", nil, "")
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo1.ID, photo2.ID},
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		type share struct {
+			ID          uuid.UUID `json:"id"`
+			Token       string    `json:"token"`
+			URL         string    `json:"url"`
+			HasPassword bool      `json:"has_password"`
+		}
+		createShare := func(body interface{}) share {
+			resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/shares", album.ID), body)
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var created share
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+			return created
+		}
+		view := func(method, url string, header http.Header, form string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(method, url, strings.NewReader(form))
+			require.NoError(t, err)
+			for name, values := range header {
+				req.Header[name] = values
+			}
+			if form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			w := httptest.NewRecorder()
+			tc.Router.ServeHTTP(w, req)
+			return w
+		}
+
+		open := createShare(nil)
+		assert.NotEmpty(t, open.Token)
+		assert.Equal(t, "/shared/"+open.Token, open.URL)
+		assert.False(t, open.HasPassword)
+
+		resp = view("GET", open.URL+"/album", nil, "")
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var shared struct {
+			Album struct {
+				Name string `json:"name"`
+			} `json:"album"`
+			Photos []struct {
+				ID           uuid.UUID `json:"id"`
+				FileURL      string    `json:"file_url"`
+				ThumbnailURL string    `json:"thumbnail_url"`
+			} `json:"photos"`
+			Pagination struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &shared))
+		assert.Equal(t, "Tom & Jerry <3", shared.Album.Name)
+		assert.Equal(t, int64(2), shared.Pagination.Total)
+		require.Len(t, shared.Photos, 2)
+		assert.Equal(t, photo1.ID, shared.Photos[0].ID)
+		assert.NotContains(t, resp.Body.String(), "file_path")
+		assert.Equal(t, fmt.Sprintf("%s/photos/%s/file", open.URL, photo1.ID), shared.Photos[0].FileURL)
+
+		resp = view("GET", shared.Photos[0].FileURL, nil, "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = view("GET", shared.Photos[1].ThumbnailURL, nil, "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		resp = view("GET", fmt.Sprintf("%s/photos/%s/file", open.URL, outsider.ID), nil, "")
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = view("GET", open.URL, nil, "")
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, resp.Body.String(), "<h1>Tom &amp; Jerry &lt;3</h1>")
+		assert.Contains(t, resp.Body.String(), shared.Photos[1].ThumbnailURL)
+
+		// Password protected
+		protected := createShare(map[string]interface{}{"password": "open sesame"})
+		assert.True(t, protected.HasPassword)
+		resp = view("GET", protected.URL+"/album", nil, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		assert.Contains(t, resp.Body.String(), "share_password_required")
+		resp = view("GET", protected.URL+"/album", http.Header{"X-Share-Password": {"wrong"}}, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		assert.Contains(t, resp.Body.String(), "share_password_invalid")
+		resp = view("GET", protected.URL+"/album", http.Header{"X-Share-Password": {"open sesame"}}, "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = view("GET", fmt.Sprintf("%s/photos/%s/file", protected.URL, photo1.ID), nil, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+		// Browsers unlock the gallery with the form
+		resp = view("GET", protected.URL, nil, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		assert.Contains(t, resp.Body.String(), `type="password"`)
+		assert.NotContains(t, resp.Body.String(), "Tom &amp; Jerry")
+		resp = view("POST", protected.URL, nil, "password=wrong")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		assert.Contains(t, resp.Body.String(), "Wrong password")
+		resp = view("POST", protected.URL, nil, "password=open+sesame")
+		require.Equal(t, http.StatusSeeOther, resp.Code)
+		assert.Equal(t, protected.URL, resp.Header().Get("Location"))
+		cookies := resp.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, protected.URL, cookies[0].Path)
+		unlocked := http.Header{"Cookie": {cookies[0].Name + "=" + cookies[0].Value}}
+		resp = view("GET", protected.URL, unlocked, "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = view("GET", fmt.Sprintf("%s/photos/%s/file", protected.URL, photo1.ID), unlocked, "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		// The cookie doesn't open other shares
+		other := createShare(map[string]interface{}{"password": "open sesame"})
+		resp = view("GET", other.URL+"/album", unlocked, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+		// Expiry
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/shares", album.ID), map[string]interface{}{
+			"expires_at": time.Now().Add(-time.Hour),
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		expiring := createShare(map[string]interface{}{"expires_at": time.Now().Add(time.Hour)})
+		resp = view("GET", expiring.URL+"/album", nil, "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		require.NoError(t, tc.DB.GetDB().Model(&models.AlbumShare{}).Where("id = ?", expiring.ID).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error)
+		resp = view("GET", expiring.URL+"/album", nil, "")
+		assert.Equal(t, http.StatusGone, resp.Code)
+		resp = view("GET", expiring.URL, nil, "")
+		assert.Equal(t, http.StatusGone, resp.Code)
+		assert.Contains(t, resp.Body.String(), "Share has expired")
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/shares", album.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var shares []share
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &shares))
+		assert.Len(t, shares, 4)
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/albums/%s/shares/%s", album.ID, open.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/albums/%s/shares/%s", album.ID, open.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = view("GET", open.URL+"/album", nil, "")
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		// Shares go with their album
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/albums/%s", album.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		resp = view("GET", protected.URL+"/album", http.Header{"X-Share-Password": {"open sesame"}}, "")
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Album Cover Photo", func(t *testing.T) {
+		album := tc.createTestAlbum("Cover Album", "", library.ID)
+		photo1 := tc.uploadTestPhoto(library.ID, "cover1.jpg", nil, "")
+		photo2 := tc.uploadTestPhoto(library.ID, "cover2.jpg", nil, "")
+		outsider := tc.uploadTestPhoto(library.ID, "cover_outsider.jpg", nil, "")
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo1.ID, photo2.ID},
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		getAlbum := func() models.Album {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s", album.ID), nil)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			var got models.Album
+			json.Unmarshal(resp.Body.Bytes(), &got)
+			return got
+		}
+
+		// Without a chosen cover the first photo is used
+		got := getAlbum()
+		assert.Nil(t, got.CoverPhotoID)
+		if assert.NotNil(t, got.CoverPhoto) {
+			assert.Equal(t, photo1.ID, got.CoverPhoto.ID)
+		}
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/cover", album.ID), map[string]interface{}{
+			"photo_id": photo2.ID,
+		})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		json.Unmarshal(resp.Body.Bytes(), &got)
+		if assert.NotNil(t, got.CoverPhotoID) {
+			assert.Equal(t, photo2.ID, *got.CoverPhotoID)
+		}
+
+		// Album lists include the cover
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums?library_id=%s", library.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var albums []models.Album
+		json.Unmarshal(resp.Body.Bytes(), &albums)
+		found := false
+		for _, listed := range albums {
+			if listed.ID == album.ID {
+				found = true
+				if assert.NotNil(t, listed.CoverPhoto) {
+					assert.Equal(t, photo2.ID, listed.CoverPhoto.ID)
+					assert.NotEmpty(t, listed.CoverPhoto.ThumbnailURL)
+				}
+			}
+		}
+		assert.True(t, found)
+
+		// The cover has to be in the album
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/cover", album.ID), map[string]interface{}{
+			"photo_id": outsider.ID,
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Photo is not in the album", response["error"])
+
+		// Removing the cover photo from the album falls back to the first photo
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/albums/%s/photos/%s", album.ID, photo2.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		got = getAlbum()
+		assert.Nil(t, got.CoverPhotoID)
+		if assert.NotNil(t, got.CoverPhoto) {
+			assert.Equal(t, photo1.ID, got.CoverPhoto.ID)
+		}
+
+		// A null photo_id clears the chosen cover
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/cover", album.ID), map[string]interface{}{
+			"photo_id": photo1.ID,
+		})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/cover", album.ID), map[string]interface{}{
+			"photo_id": nil,
+		})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Nil(t, getAlbum().CoverPhotoID)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/cover", uuid.New()), map[string]interface{}{
+			"photo_id": photo1.ID,
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Get Album Photos - Paginated", func(t *testing.T) {
+		album := tc.createTestAlbum("Paged Album", "", library.ID)
+		var ids []uuid.UUID
+		for i := 0; i < 3; i++ {
+			photo := tc.uploadTestPhoto(library.ID, fmt.Sprintf("paged_%d.jpg", i), nil, "paged")
+			ids = append(ids, photo.ID)
+			resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+				"photo_id": photo.ID,
+				"order":    3 - i, // Album order is the reverse of upload order
+			})
+			require.Equal(t, http.StatusCreated, resp.Code)
+		}
+		tc.uploadTestPhoto(library.ID, "not_in_album.jpg", nil, "")
+
+		type page struct {
+			Photos []struct {
+				ID   uuid.UUID         `json:"id"`
+				Tags []json.RawMessage `json:"tags"`
+			} `json:"photos"`
+			Pagination struct {
+				Page  int   `json:"page"`
+				Limit int   `json:"limit"`
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		get := func(query string) page {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos?%s", album.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var body page
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			return body
+		}
+
+		first := get("limit=2")
+		assert.Equal(t, int64(3), first.Pagination.Total)
+		require.Len(t, first.Photos, 2)
+		assert.Equal(t, ids[2], first.Photos[0].ID)
+		assert.Equal(t, ids[1], first.Photos[1].ID)
+		assert.Nil(t, first.Photos[0].Tags)
+
+		second := get("limit=2&page=2&include_tags=true")
+		require.Len(t, second.Photos, 1)
+		assert.Equal(t, ids[0], second.Photos[0].ID)
+		assert.Len(t, second.Photos[0].Tags, 1)
+
+		descending := get("order_dir=desc")
+		require.Len(t, descending.Photos, 3)
+		assert.Equal(t, ids[0], descending.Photos[0].ID)
+
+		byUpload := get("order_by=uploaded_at&order_dir=desc")
+		assert.Equal(t, ids[2], byUpload.Photos[0].ID)
+
+		// order picks a sort mode for one request
+		uploaded := get("order=uploaded_at&limit=2&page=2")
+		assert.Equal(t, int64(3), uploaded.Pagination.Total)
+		require.Len(t, uploaded.Photos, 1)
+		assert.Equal(t, ids[2], uploaded.Photos[0].ID)
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos?order=random", album.ID), nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		empty := tc.createTestAlbum("Empty Paged Album", "", library.ID)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", empty.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"photos":[]`)
+	})
+
 	t.Run("Update Photo Order - Not in Album", func(t *testing.T) {
 		album := tc.createTestAlbum("No Photo Album", "Empty", library.ID)
 		photo := tc.uploadTestPhoto(library.ID, "not_added.jpg", nil, "")
@@ -353,6 +1170,57 @@ func TestAlbumEndpoints(t *testing.T) {
 		assert.Equal(t, "Photo not found in album", response["error"])
 	})
 
+	t.Run("Download Album", func(t *testing.T) {
+		album := tc.createTestAlbum("Trip: Day/1", "", library.ID)
+
+		var photos []TestPhoto
+		for _, name := range []string{"beach.jpg", "dunes.jpg", "beach.jpg"} {
+			resp := tc.uploadTestFile(library.ID, name, "image/jpeg", createTestImage())
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			photos = append(photos, photo)
+		}
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/download", album.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photos[0].ID, photos[1].ID, photos[2].ID},
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		// Move the first photo to the end
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/photos/%s/order", album.ID, photos[0].ID), map[string]interface{}{"order": 10})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/download", album.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="Trip_ Day_1.zip"`, resp.Header().Get("Content-Disposition"))
+
+		body := resp.Body.Bytes()
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		var names []string
+		for _, f := range archive.File {
+			names = append(names, f.Name)
+		}
+		assert.Equal(t, []string{"dunes.jpg", "beach.jpg", "beach (2).jpg"}, names)
+
+		rc, err := archive.File[0].Open()
+		require.NoError(t, err)
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		original, _ := os.ReadFile(photos[1].FilePath)
+		assert.Equal(t, original, data)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/download?size=huge", album.ID), nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/download", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
 	t.Run("Album with Photos Integration", func(t *testing.T) {
 		album := tc.createTestAlbum("Integration Album", "Full test", library.ID)
 		photo1 := tc.uploadTestPhoto(library.ID, "integration1.jpg", nil, "")
@@ -2,83 +2,144 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
+	"io"
+	"log/slog"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"photo-library-server/apikeys"
+	"photo-library-server/cdn"
+	"photo-library-server/classify"
 	"photo-library-server/config"
 	"photo-library-server/database"
+	"photo-library-server/faces"
+	"photo-library-server/geocode"
+	"photo-library-server/grpcapi"
 	"photo-library-server/handlers"
+	"photo-library-server/jobs"
+	"photo-library-server/logging"
 	"photo-library-server/middleware"
+	"photo-library-server/models"
+	photosv1 "photo-library-server/proto/photos/v1"
+	"photo-library-server/signing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
 )
 
 // TestContext holds the test environment
 type TestContext struct {
 	DB      *database.SQLiteDB
 	Router  *gin.Engine
+	Config  *config.Config
+	Storage *handlers.StorageHandler // For running capacity checks directly
+	Watcher *handlers.LibraryWatcher // For syncing watched libraries directly
+	Trash   *handlers.TrashHandler   // For running scheduled purges directly
 	TempDir string
 }
 
 // TestLibrary represents a library for testing
 type TestLibrary struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Images      string    `json:"images"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Images        string    `json:"images"`
+	ThumbnailMode string    `json:"thumbnail_mode"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // TestPhoto represents a photo for testing
 type TestPhoto struct {
-	ID           uuid.UUID `json:"id"`
-	Filename     string    `json:"filename"`
-	OriginalName string    `json:"original_name"`
-	FilePath     string    `json:"file_path"`
-	MimeType     string    `json:"mime_type"`
-	FileSize     int64     `json:"file_size"`
-	Width        int       `json:"width"`
-	Height       int       `json:"height"`
-	Rating       *int      `json:"rating"`
-	LibraryID    uuid.UUID `json:"library_id"`
-	UploadedAt   time.Time `json:"uploaded_at"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uuid.UUID  `json:"id"`
+	Filename     string     `json:"filename"`
+	OriginalName string     `json:"original_name"`
+	FilePath     string     `json:"file_path"`
+	MimeType     string     `json:"mime_type"`
+	FileSize     int64      `json:"file_size"`
+	Checksum     string     `json:"checksum"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	Rating       *int       `json:"rating"`
+	Favorite     bool       `json:"favorite"`
+	Title        string     `json:"title"`
+	Caption      string     `json:"caption"`
+	Description  string     `json:"description"`
+	StorageTier  string     `json:"storage_tier"`
+	Missing      bool       `json:"missing"`
+	Corrupt      bool       `json:"corrupt"`
+	VerifiedAt   *time.Time `json:"verified_at"`
+	TakenAt      *time.Time `json:"taken_at"`
+	Latitude     *float64   `json:"latitude"`
+	Longitude    *float64   `json:"longitude"`
+	Country      string     `json:"country"`
+	City         string     `json:"city"`
+	Place        string     `json:"place"`
+	HasMotion    bool       `json:"has_motion"`
+	PageCount    int        `json:"page_count"`
+	RawFormat    string     `json:"raw_format"`
+	Encrypted    bool       `json:"encrypted"`
+	EditVersion  int        `json:"edit_version"`
+	LibraryID    uuid.UUID  `json:"library_id"`
+	FileURL      string     `json:"file_url"`
+	ThumbnailURL string     `json:"thumbnail_url"`
+	MotionURL    string     `json:"motion_url"`
+	PreviewURL   string     `json:"preview_url"`
+	UploadedAt   time.Time  `json:"uploaded_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // TestAlbum represents an album for testing
 type TestAlbum struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	LibraryID   uuid.UUID  `json:"library_id"`
+	StartDate   *time.Time `json:"start_date"`
+	EndDate     *time.Time `json:"end_date"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TestTag represents a tag for testing
+type TestTag struct {
 	ID          uuid.UUID `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
-	LibraryID   uuid.UUID `json:"library_id"`
+	Color       string    `json:"color"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
-// TestTag represents a tag for testing
-type TestTag struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Color     string    `json:"color"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
 // setupTestEnvironment creates a fresh test environment with a new database
 func setupTestEnvironment(t *testing.T) *TestContext {
 	// Create temporary directory for test files
@@ -86,7 +147,7 @@ func setupTestEnvironment(t *testing.T) *TestContext {
 	require.NoError(t, err)
 
 	// Create test database in memory
-	sqliteDB, err := database.NewSQLiteDB(":memory:")
+	sqliteDB, err := database.NewSQLiteDB(":memory:", database.Options{SQLiteForeignKeys: true})
 	require.NoError(t, err)
 
 	// Run migrations
@@ -100,8 +161,9 @@ func setupTestEnvironment(t *testing.T) *TestContext {
 	// Setup Gin in test mode
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.MetricsMiddleware())
 	router.Use(gin.Recovery())
-	router.Use(middleware.CORSMiddleware())
 
 	// Setup test config
 	cfg := &config.Config{
@@ -113,20 +175,129 @@ func setupTestEnvironment(t *testing.T) *TestContext {
 			"image/webp",
 			"image/tiff",
 			"image/bmp",
+			"image/x-canon-cr2",
+			"image/x-nikon-nef",
+			"image/x-sony-arw",
+			"image/x-adobe-dng",
+			"video/mp4",
+			"video/quicktime",
 		},
+		URLSigningSecret:        "test-signing-secret",
+		SignedURLTTL:            time.Hour,
+		TagNormalization:        "trim,nfc,casefold",
+		ResizeCacheDir:          filepath.Join(tempDir, "resized"),
+		ResizeCacheSize:         64 * 1024 * 1024,
+		BackupDir:               filepath.Join(tempDir, "backups"),
+		Geocoder:                "offline",
+		GeocoderDataset:         filepath.Join(tempDir, "cities.txt"),
+		WatchDebounce:           50 * time.Millisecond,
+		ClassifierMinConfidence: 0.5,
+		FaceMinConfidence:       0.5,
+		FaceMatchThreshold:      0.8,
+	}
+	router.Use(middleware.CORSMiddleware(cfg))
+
+	// A tiny GeoNames dataset for reverse geocoding
+	var dataset strings.Builder
+	for _, city := range [][4]string{
+		{"Paris", "48.85341", "2.3488", "FR"},
+		{"Lyon", "45.74846", "4.84671", "FR"},
+		{"Sydney", "-33.86785", "151.20732", "AU"},
+	} {
+		columns := make([]string, 19)
+		columns[1], columns[4], columns[5], columns[8] = city[0], city[1], city[2], city[3]
+		dataset.WriteString(strings.Join(columns, "\t") + "\n")
 	}
+	require.NoError(t, os.WriteFile(cfg.GeocoderDataset, []byte(dataset.String()), 0644))
+	geocoder, err := geocode.FromConfig(cfg)
+	require.NoError(t, err)
+
+	// An inference service that sees the same things in every image
+	inference := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"labels": [
+			{"name": "Beach", "confidence": 0.93},
+			{"name": "sunset", "confidence": 0.71},
+			{"name": "dog", "confidence": 0.12}
+		]}`))
+	}))
+	t.Cleanup(inference.Close)
+	classifier, err := classify.FromConfig(&config.Config{Classifier: "http", ClassifierURL: inference.URL})
+	require.NoError(t, err)
+
+	// A face detector that finds one face in tiny images and two in larger
+	// ones, the first of them the same person as in tiny images
+	detection := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if size, _, err := image.DecodeConfig(r.Body); err == nil && size.Width < 16 {
+			w.Write([]byte(`{"faces": [{"box": {"x": 0.1, "y": 0.1, "width": 0.2, "height": 0.2}, "confidence": 0.97, "embedding": [1, 0, 0]}]}`))
+			return
+		}
+		w.Write([]byte(`{"faces": [
+			{"box": {"x": 0.1, "y": 0.1, "width": 0.3, "height": 0.3}, "confidence": 0.95, "embedding": [0.98, 0.1, 0]},
+			{"box": {"x": 0.6, "y": 0.2, "width": 0.2, "height": 0.2}, "confidence": 0.9, "embedding": [0, 1, 0]},
+			{"box": {"x": 0.4, "y": 0.7, "width": 0.1, "height": 0.1}, "confidence": 0.3, "embedding": [0, 0, 1]}
+		]}`))
+	}))
+	t.Cleanup(detection.Close)
+	faceDetector, err := faces.FromConfig(&config.Config{FaceDetector: "http", FaceDetectorURL: detection.URL})
+	require.NoError(t, err)
+
+	// Start background job workers
+	jobManager := jobs.NewManager(2, 100)
+
+	// Downloads share one bandwidth budget across all file-serving routes
+	downloadLimit := middleware.BandwidthLimitMiddleware(cfg)
+
+	// Slow or numerous uploads and renders can't exhaust memory and file handles
+	requestTimeout := middleware.TimeoutMiddleware(cfg.RequestTimeout)
+	uploadTimeout := middleware.TimeoutMiddleware(cfg.UploadTimeout)
+	uploadLimit := middleware.ConcurrencyLimitMiddleware(cfg.MaxConcurrentUploads)
+	processingLimit := middleware.ConcurrencyLimitMiddleware(cfg.MaxConcurrentProcessing)
+
+	// Sign file URLs with a test secret
+	signer := signing.NewSigner(cfg.URLSigningSecret, cfg.SignedURLTTL)
+	fileURLs := cdn.FromConfig(cfg, signer)
+	models.FileURLFunc = fileURLs.URL
 
 	// Initialize handlers
-	libraryHandler := handlers.NewLibraryHandler(sqliteDB.GetDB())
-	albumHandler := handlers.NewAlbumHandler(sqliteDB.GetDB())
-	photoHandler := handlers.NewPhotoHandler(sqliteDB.GetDB(), cfg)
-	tagHandler := handlers.NewTagHandler(sqliteDB.GetDB())
+	libraryHandler := handlers.NewLibraryHandler(sqliteDB.GetDB(), cfg, jobManager)
+	albumHandler := handlers.NewAlbumHandler(sqliteDB.GetDB(), cfg)
+	photoHandler := handlers.NewPhotoHandler(sqliteDB.GetDB(), cfg, jobManager)
+	tagHandler := handlers.NewTagHandler(sqliteDB.GetDB(), cfg)
+	jobHandler := handlers.NewJobHandler(jobManager)
+	storageHandler := handlers.NewStorageHandler(sqliteDB.GetDB(), cfg, jobManager)
+	trashHandler := handlers.NewTrashHandler(sqliteDB.GetDB(), cfg, jobManager)
+	geocodeHandler := handlers.NewGeocodeHandler(sqliteDB.GetDB(), cfg, jobManager, geocoder)
+	classifyHandler := handlers.NewClassifyHandler(sqliteDB.GetDB(), cfg, jobManager, classifier)
+	photoHandler.ClassifyUploads(classifyHandler)
+	faceHandler := handlers.NewFaceHandler(sqliteDB.GetDB(), cfg, jobManager, faceDetector)
+	photoHandler.DetectFacesInUploads(faceHandler)
+	capabilitiesHandler := handlers.NewCapabilitiesHandler(cfg)
+	downloadHandler := handlers.NewDownloadHandler(sqliteDB.GetDB(), cfg, signer)
+	batchHandler := handlers.NewBatchHandler(sqliteDB.GetDB(), cfg, router)
+	apiKeyHandler := handlers.NewAPIKeyHandler(sqliteDB.GetDB())
+	metricsHandler := handlers.NewMetricsHandler(sqliteDB.GetDB(), jobManager)
+	healthHandler := handlers.NewHealthHandler(sqliteDB.GetDB(), cfg)
+	graphqlHandler := handlers.NewGraphQLHandler(sqliteDB.GetDB(), cfg)
+	shareHandler := handlers.NewShareHandler(sqliteDB.GetDB(), cfg, photoHandler)
+	feedHandler := handlers.NewFeedHandler(sqliteDB.GetDB())
+	webdavHandler := handlers.NewWebDAVHandler(sqliteDB.GetDB(), cfg)
+	backupHandler := handlers.NewBackupHandler(sqliteDB.GetDB(), cfg, jobManager)
+	docsHandler := handlers.NewDocsHandler(router, cfg)
+
+	// Setup routes, v2 serves the same handlers with responses wrapped
+	// in a {data, meta, errors} envelope
+	apiKeyAuth := middleware.APIKeyMiddleware(sqliteDB.GetDB(), cfg)
+	v1 := router.Group("/api/v1", middleware.TenantMiddleware(cfg), apiKeyAuth)
+	v2 := router.Group("/api/v2", middleware.EnvelopeMiddleware(), middleware.TenantMiddleware(cfg), apiKeyAuth)
+	for _, api := range []*gin.RouterGroup{v1, v2} {
+		// Server capabilities
+		api.GET("/capabilities", capabilitiesHandler.GetCapabilities)
+
+		// Run many requests in one round trip
+		api.POST("/batch", batchHandler.ExecuteBatch)
 
-	// Setup routes
-	api := router.Group("/api/v1")
-	{
 		// Library routes
-		libraries := api.Group("/libraries")
+		libraries := api.Group("/libraries", requestTimeout)
 		{
 			libraries.POST("", libraryHandler.CreateLibrary)
 			libraries.GET("", libraryHandler.GetLibraries)
@@ -134,58 +305,203 @@ func setupTestEnvironment(t *testing.T) *TestContext {
 			libraries.PUT("/:id", libraryHandler.UpdateLibrary)
 			libraries.DELETE("/:id", libraryHandler.DeleteLibrary)
 			libraries.GET("/:id/stats", libraryHandler.GetLibraryStats)
+			libraries.POST("/:id/rescan", libraryHandler.RescanLibrary)
+			libraries.POST("/:id/scan", photoHandler.ScanLibrary)
+			libraries.POST("/:id/import/apple", photoHandler.ImportAppleExport)
+			libraries.GET("/:id/audit", photoHandler.AuditLibrary)
+			libraries.POST("/:id/verify", photoHandler.VerifyLibrary)
 		}
 
 		// Album routes
-		albums := api.Group("/albums")
+		albums := api.Group("/albums", requestTimeout)
 		{
 			albums.POST("", albumHandler.CreateAlbum)
 			albums.GET("", albumHandler.GetAlbums)
 			albums.GET("/:id", albumHandler.GetAlbum)
+			albums.GET("/:id/photos", albumHandler.GetAlbumPhotos)
 			albums.PUT("/:id", albumHandler.UpdateAlbum)
 			albums.DELETE("/:id", albumHandler.DeleteAlbum)
 			albums.POST("/:id/photos", albumHandler.AddPhotoToAlbum)
 			albums.DELETE("/:id/photos/:photo_id", albumHandler.RemovePhotoFromAlbum)
+			albums.POST("/:id/photos/remove", albumHandler.RemovePhotosFromAlbum)
 			albums.PUT("/:id/photos/:photo_id/order", albumHandler.UpdatePhotoOrder)
+			albums.PUT("/:id/photos/order", albumHandler.ReorderAlbumPhotos)
+			albums.PUT("/:id/cover", albumHandler.SetAlbumCover)
+			albums.POST("/:id/duplicate", albumHandler.DuplicateAlbum)
+			albums.POST("/:id/shares", shareHandler.CreateShare)
+			albums.GET("/:id/shares", shareHandler.GetShares)
+			albums.DELETE("/:id/shares/:share_id", shareHandler.DeleteShare)
 		}
+		api.GET("/albums/:id/download", downloadLimit, albumHandler.DownloadAlbum)
 
 		// Photo routes
 		photos := api.Group("/photos")
 		{
-			photos.POST("/upload", photoHandler.UploadPhoto)
-			photos.GET("", photoHandler.GetPhotos)
-			photos.GET("/:id", photoHandler.GetPhoto)
-			photos.PUT("/:id", photoHandler.UpdatePhoto)
-			photos.DELETE("/:id", photoHandler.DeletePhoto)
-			photos.GET("/:id/file", photoHandler.ServePhoto)
-			photos.POST("/:id/copy", photoHandler.CopyPhoto)
+			photos.POST("/upload", uploadLimit, uploadTimeout, photoHandler.UploadPhoto)
+			photos.POST("/upload/batch", uploadLimit, uploadTimeout, photoHandler.UploadPhotos)
+			photos.POST("/batch", requestTimeout, photoHandler.BatchPhotos)
+			photos.POST("/bulk-copy", requestTimeout, photoHandler.BulkCopyPhotos)
+			photos.POST("/export", downloadLimit, photoHandler.ExportPhotos)
+			photos.POST("/download", downloadLimit, photoHandler.DownloadPhotos)
+			photos.POST("/geocode", requestTimeout, geocodeHandler.RunGeocode)
+			photos.POST("/classify", requestTimeout, classifyHandler.RunClassify)
+			photos.POST("/detect-faces", requestTimeout, faceHandler.RunFaceDetection)
+			photos.POST("/hash", requestTimeout, photoHandler.HashPhotos)
+			photos.GET("", requestTimeout, photoHandler.GetPhotos)
+			photos.GET("/timeline", requestTimeout, photoHandler.GetTimeline)
+			photos.GET("/:id", requestTimeout, photoHandler.GetPhoto)
+			photos.PUT("/:id", requestTimeout, photoHandler.UpdatePhoto)
+			photos.DELETE("/:id", requestTimeout, photoHandler.DeletePhoto)
+			photos.GET("/:id/file", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, photoHandler.ServePhoto)
+			photos.GET("/:id/thumbnail", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, processingLimit, photoHandler.ServeThumbnail)
+			photos.GET("/:id/motion", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, photoHandler.ServeMotion)
+			photos.GET("/:id/preview", middleware.SignedURLMiddleware(signer, cfg, fileURLs.Signer()), downloadLimit, photoHandler.ServePreview)
+			photos.GET("/:id/frame", downloadLimit, processingLimit, photoHandler.ServeFrame)
+			photos.POST("/:id/copy", requestTimeout, photoHandler.CopyPhoto)
+			photos.POST("/:id/move", requestTimeout, photoHandler.MovePhoto)
+			photos.POST("/:id/download-url", requestTimeout, downloadHandler.CreateDownloadURL)
+			photos.POST("/:id/signed-url", requestTimeout, downloadHandler.CreateSignedURL)
+			photos.PUT("/:id/storage-tier", requestTimeout, storageHandler.SetPhotoTier)
+			photos.POST("/:id/rotate", requestTimeout, processingLimit, photoHandler.RotatePhoto)
+			photos.POST("/:id/edits", requestTimeout, processingLimit, photoHandler.EditPhoto)
+			photos.GET("/:id/edits", requestTimeout, photoHandler.ListPhotoVersions)
+			photos.POST("/:id/edits/restore", requestTimeout, photoHandler.RestorePhotoVersion)
+			photos.POST("/:id/verify", requestTimeout, photoHandler.VerifyPhoto)
+			photos.POST("/:id/restore", requestTimeout, trashHandler.RestorePhoto)
+			photos.POST("/:id/favorite", requestTimeout, photoHandler.ToggleFavorite)
+			photos.GET("/:id/metadata", requestTimeout, photoHandler.GetPhotoMetadata)
+			photos.PUT("/:id/metadata", requestTimeout, photoHandler.SetPhotoMetadata)
+			photos.DELETE("/:id/metadata/:key", requestTimeout, photoHandler.DeletePhotoMetadata)
+			photos.GET("/:id/suggestions", requestTimeout, classifyHandler.GetPhotoSuggestions)
+			photos.GET("/:id/faces", requestTimeout, faceHandler.GetPhotoFaces)
+			photos.GET("/:id/similar", requestTimeout, photoHandler.GetSimilarPhotos)
 		}
 
 		// Tag routes
-		tags := api.Group("/tags")
+		tags := api.Group("/tags", requestTimeout)
 		{
 			tags.POST("", tagHandler.CreateTag)
 			tags.GET("", tagHandler.GetTags)
+			tags.GET("/top", tagHandler.GetTopTags)
+			tags.GET("/suggest", tagHandler.SuggestTags)
+			tags.POST("/batch", tagHandler.BatchTags)
 			tags.GET("/:id", tagHandler.GetTag)
+			tags.GET("/:id/photos", tagHandler.GetTagPhotos)
 			tags.PUT("/:id", tagHandler.UpdateTag)
 			tags.DELETE("/:id", tagHandler.DeleteTag)
 			tags.POST("/:id/photos", tagHandler.AddTagToPhoto)
 			tags.DELETE("/:id/photos/:photo_id", tagHandler.RemoveTagFromPhoto)
+			tags.POST("/:id/albums", tagHandler.AddTagToAlbum)
+			tags.DELETE("/:id/albums/:album_id", tagHandler.RemoveTagFromAlbum)
 			tags.GET("/:id/stats", tagHandler.GetTagStats)
+			tags.GET("/:id/aliases", tagHandler.GetTagAliases)
+			tags.POST("/:id/aliases", tagHandler.CreateTagAlias)
+			tags.PUT("/:id/aliases/:alias_id", tagHandler.UpdateTagAlias)
+			tags.DELETE("/:id/aliases/:alias_id", tagHandler.DeleteTagAlias)
+		}
+
+		// Tag suggestion routes
+		suggestions := api.Group("/suggestions", requestTimeout)
+		{
+			suggestions.GET("", classifyHandler.GetSuggestions)
+			suggestions.POST("/review", classifyHandler.ReviewSuggestions)
+		}
+
+		// People and face routes
+		people := api.Group("/people", requestTimeout)
+		{
+			people.GET("", faceHandler.GetPeople)
+			people.GET("/:id", faceHandler.GetPerson)
+			people.PUT("/:id", faceHandler.UpdatePerson)
+			people.DELETE("/:id", faceHandler.DeletePerson)
+			people.POST("/:id/merge", faceHandler.MergePeople)
+			people.GET("/:id/photos", faceHandler.GetPersonPhotos)
+		}
+		api.PUT("/faces/:id", requestTimeout, faceHandler.UpdateFace)
+
+		// Job routes
+		jobRoutes := api.Group("/jobs", requestTimeout)
+		{
+			jobRoutes.GET("", jobHandler.GetJobs)
+			jobRoutes.GET("/:id", jobHandler.GetJob)
+		}
+
+		keys := api.Group("/apikeys", requestTimeout)
+		{
+			keys.POST("", apiKeyHandler.CreateAPIKey)
+			keys.GET("", apiKeyHandler.GetAPIKeys)
+			keys.DELETE("/:id", apiKeyHandler.DeleteAPIKey)
+		}
+
+		storage := api.Group("/storage", requestTimeout)
+		{
+			storage.POST("/tiering", storageHandler.RunTiering)
+			storage.GET("/usage", storageHandler.GetUsage)
+		}
+
+		trash := api.Group("/trash", requestTimeout)
+		{
+			trash.GET("", trashHandler.GetTrash)
+			trash.DELETE("", trashHandler.EmptyTrash)
+			trash.DELETE("/:id", trashHandler.PurgePhoto)
+		}
+
+		admin := api.Group("/admin", middleware.AdminKeyMiddleware(cfg))
+		{
+			admin.POST("/backup", requestTimeout, backupHandler.CreateBackup)
+			admin.GET("/backups", requestTimeout, backupHandler.GetBackups)
+			admin.GET("/backups/:name", downloadLimit, backupHandler.DownloadBackup)
+			admin.GET("/backups/:name/manifest", downloadLimit, backupHandler.DownloadBackupManifest)
 		}
 	}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "healthy",
-			"service": "photo-library-server",
-		})
-	})
+	graphql := router.Group("/graphql", middleware.TenantMiddleware(cfg), apiKeyAuth, requestTimeout)
+	{
+		graphql.GET("", graphqlHandler.Query)
+		graphql.POST("", graphqlHandler.Query)
+	}
+
+	feeds := router.Group("/feeds", middleware.TenantMiddleware(cfg), apiKeyAuth, requestTimeout)
+	{
+		feeds.GET("/library/:feed", feedHandler.GetLibraryFeed)
+		feeds.GET("/album/:feed", feedHandler.GetAlbumFeed)
+	}
+
+	dav := router.Group("/webdav", middleware.BasicAuthKeyMiddleware("Photo Library"), middleware.TenantMiddleware(cfg), apiKeyAuth)
+	{
+		dav.OPTIONS("/*path", webdavHandler.OptionsWebDAV)
+		dav.Handle(apikeys.MethodPropfind, "/*path", webdavHandler.ServeWebDAV)
+		dav.GET("/*path", downloadLimit, webdavHandler.ServeWebDAV)
+		dav.HEAD("/*path", webdavHandler.ServeWebDAV)
+	}
+
+	shared := router.Group("/shared/:token")
+	{
+		shared.GET("", requestTimeout, shareHandler.GetGallery)
+		shared.POST("", requestTimeout, shareHandler.UnlockShare)
+		shared.GET("/album", requestTimeout, shareHandler.GetSharedAlbum)
+		shared.GET("/photos/:id/file", downloadLimit, shareHandler.ServeSharedPhoto)
+		shared.GET("/photos/:id/thumbnail", downloadLimit, processingLimit, shareHandler.ServeSharedThumbnail)
+	}
+
+	// Health check endpoints
+	router.GET("/health", healthHandler.Health)
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+
+	router.GET("/metrics", metricsHandler.GetMetrics)
+
+	router.GET("/api", docsHandler.GetIndex)
+	router.GET("/api/openapi.json", docsHandler.GetOpenAPISpec)
+	router.GET("/api/docs", docsHandler.GetSwaggerUI)
 
 	return &TestContext{
 		DB:      sqliteDB,
 		Router:  router,
+		Config:  cfg,
+		Storage: storageHandler,
+		Watcher: handlers.NewLibraryWatcher(sqliteDB.GetDB(), cfg, photoHandler),
+		Trash:   trashHandler,
 		TempDir: tempDir,
 	}
 }
@@ -255,6 +571,61 @@ func (tc *TestContext) makeMultipartRequest(url string, fields map[string]string
 	return w
 }
 
+// uploadTestDocument uploads a PDF to a library and returns the raw response
+func (tc *TestContext) uploadTestDocument(libraryID uuid.UUID, data []byte) *httptest.ResponseRecorder {
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	writer.WriteField("library_id", libraryID.String())
+
+	h := make(map[string][]string)
+	h["Content-Disposition"] = []string{`form-data; name="photo"; filename="letter.pdf"`}
+	h["Content-Type"] = []string{"application/pdf"}
+	part, err := writer.CreatePart(h)
+	if err != nil {
+		panic(err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	req, err := http.NewRequest("POST", "/api/v1/photos/upload", &b)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	tc.Router.ServeHTTP(w, req)
+	return w
+}
+
+// uploadTestFile uploads a file with the given name and content type to a
+// library and returns the raw response
+func (tc *TestContext) uploadTestFile(libraryID uuid.UUID, filename, mimeType string, data []byte) *httptest.ResponseRecorder {
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	writer.WriteField("library_id", libraryID.String())
+
+	h := make(map[string][]string)
+	h["Content-Disposition"] = []string{fmt.Sprintf(`form-data; name="photo"; filename="%s"`, filename)}
+	h["Content-Type"] = []string{mimeType}
+	part, err := writer.CreatePart(h)
+	if err != nil {
+		panic(err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	req, err := http.NewRequest("POST", "/api/v1/photos/upload", &b)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	tc.Router.ServeHTTP(w, req)
+	return w
+}
+
 // createTestLibrary creates a test library and returns its details
 func (tc *TestContext) createTestLibrary(name, description string) TestLibrary {
 	imagePath := filepath.Join(tc.TempDir, "library_"+name)
@@ -325,6 +696,189 @@ func createTestImage() []byte {
 	return buf.Bytes()
 }
 
+// createTestImageOfSize creates a valid w x h JPEG image for tests that need specific dimensions
+func createTestImageOfSize(w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{0, 0, 255, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		panic("Failed to create test image: " + err.Error())
+	}
+
+	return buf.Bytes()
+}
+
+// createGradientImage creates a w x h JPEG fading from black to white, or
+// from white to black when reversed, for photos that look alike at any size
+func createGradientImage(w, h int, reversed bool) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			level := uint8(x * 255 / (w - 1))
+			if reversed {
+				level = 255 - level
+			}
+			img.Set(x, y, color.RGBA{level, level, level, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		panic("Failed to create test image: " + err.Error())
+	}
+	return buf.Bytes()
+}
+
+// createTestImageWithKeywords creates a JPEG carrying an XMP packet with dc:subject keywords
+func createTestImageWithKeywords(keywords ...string) []byte {
+	var items strings.Builder
+	for _, keyword := range keywords {
+		items.WriteString("<rdf:li>" + keyword + "</rdf:li>")
+	}
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:subject><rdf:Bag>` +
+		items.String() +
+		`</rdf:Bag></dc:subject></rdf:Description></rdf:RDF></x:xmpmeta>`
+
+	payload := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+
+	// Splice the APP1 segment in directly after the SOI marker
+	img := createTestImage()
+	result := append([]byte{}, img[:2]...)
+	result = append(result, segment...)
+	return append(result, img[2:]...)
+}
+
+// createTestImageAt creates a JPEG whose XMP records a GPS position, given
+// as XMP "DDD,MM.mmk" coordinates such as "48,51.5N"
+func createTestImageAt(latitude, longitude string) []byte {
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="` + latitude +
+		`" exif:GPSLongitude="` + longitude + `"/></rdf:RDF></x:xmpmeta>`
+
+	payload := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+
+	img := createTestImage()
+	result := append([]byte{}, img[:2]...)
+	result = append(result, segment...)
+	return append(result, img[2:]...)
+}
+
+// createTestImageTakenAt creates a test JPEG whose EXIF records a capture time
+func createTestImageTakenAt(takenAt time.Time) []byte {
+	// Little-endian TIFF with a single IFD0 DateTime entry followed by its value
+	value := append([]byte(takenAt.Format("2006:01:02 15:04:05")), 0)
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = append(tiff, 1, 0)                      // One entry
+	tiff = append(tiff, 0x32, 0x01, 2, 0)          // DateTime, ASCII
+	tiff = append(tiff, byte(len(value)), 0, 0, 0) // Count
+	tiff = append(tiff, 26, 0, 0, 0)               // Value offset
+	tiff = append(tiff, 0, 0, 0, 0)                // No next IFD
+	tiff = append(tiff, value...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+
+	img := createTestImage()
+	result := append([]byte{}, img[:2]...)
+	result = append(result, segment...)
+	return append(result, img[2:]...)
+}
+
+// createTestMotionPhoto creates a Samsung-style Motion Photo: a test JPEG
+// followed by a marker and the given MP4 clip
+func createTestMotionPhoto(clip []byte) []byte {
+	result := append(createTestImage(), "MotionPhoto_Data"...)
+	return append(result, clip...)
+}
+
+// createTestClip creates a minimal MP4 made of ftyp and mdat boxes
+func createTestClip() []byte {
+	box := func(boxType, payload string) []byte {
+		size := len(payload) + 8
+		return append([]byte{byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size)}, boxType+payload...)
+	}
+	return append(box("ftyp", "isom\x00\x00\x02\x00"), box("mdat", "motion clip frames")...)
+}
+
+// createTestPDF creates a PDF with the given number of pages whose first page
+// is a scanned JPEG, like the output of a document scanner
+func createTestPDF(pages int, scan []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	var kids []string
+	for i := 0; i < pages; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 10+i))
+	}
+	fmt.Fprintf(&b, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), pages)
+	for i := 0; i < pages; i++ {
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im0 3 0 R >> >> >>\nendobj\n", 10+i)
+	}
+
+	fmt.Fprintf(&b, "3 0 obj\n<< /Type /XObject /Subtype /Image /Filter /DCTDecode /Length %d >>\nstream\n", len(scan))
+	b.Write(scan)
+	b.WriteString("\nendstream\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+// createTestRAW creates a little-endian TIFF-structured RAW file whose IFD0
+// records the sensor size and points at an embedded JPEG preview
+func createTestRAW(width, height uint32, preview []byte) []byte {
+	const entries = 4
+	const dataStart = 8 + 2 + entries*12 + 4
+
+	b := make([]byte, dataStart)
+	copy(b, "II*\x00")
+	binary.LittleEndian.PutUint32(b[4:], 8)
+	binary.LittleEndian.PutUint16(b[8:], entries)
+	for i, entry := range [][2]uint32{{0x0100, width}, {0x0101, height}, {0x0201, dataStart}, {0x0202, uint32(len(preview))}} {
+		pos := 10 + i*12
+		binary.LittleEndian.PutUint16(b[pos:], uint16(entry[0]))
+		binary.LittleEndian.PutUint16(b[pos+2:], 4) // LONG
+		binary.LittleEndian.PutUint32(b[pos+4:], 1)
+		binary.LittleEndian.PutUint32(b[pos+8:], entry[1])
+	}
+	return append(b, preview...)
+}
+
+// createTestVideo creates an MP4 holding a 1920x1080 video track, with the
+// moov box after the media data the way cameras record them
+func createTestVideo(seconds uint32, createdAt time.Time) []byte {
+	box := func(boxType string, payload ...[]byte) []byte {
+		body := bytes.Join(payload, nil)
+		b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+		return append(append(b, boxType...), body...)
+	}
+
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(createdAt.Unix()+2082844800)) // Seconds since 1904
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], seconds*1000)
+
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[40:], 0x10000)
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16)
+	hdlr := append(make([]byte, 8), "vide\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"...)
+
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isom\x00\x00\x02\x00isommp41")),
+		box("mdat", make([]byte, 4096)),
+		box("moov", box("mvhd", mvhd), box("trak", box("tkhd", tkhd), box("mdia", box("hdlr", hdlr)))),
+	}, nil)
+}
+
 // uploadTestPhoto uploads a test photo and returns its details
 func (tc *TestContext) uploadTestPhoto(libraryID uuid.UUID, filename string, rating *int, tags string) TestPhoto {
 	fields := map[string]string{
@@ -353,6 +907,27 @@ func (tc *TestContext) uploadTestPhoto(libraryID uuid.UUID, filename string, rat
 	return photo
 }
 
+// waitForJob polls a background job until it finishes and returns its final state
+func (tc *TestContext) waitForJob(jobID string) map[string]interface{} {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp := tc.makeRequest("GET", "/api/v1/jobs/"+jobID, nil)
+		if resp.Code != http.StatusOK {
+			panic(fmt.Sprintf("Failed to fetch job: %d - %s", resp.Code, resp.Body.String()))
+		}
+
+		var job map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &job)
+		if job["status"] == "completed" || job["status"] == "failed" {
+			return job
+		}
+		if time.Now().After(deadline) {
+			panic("Timed out waiting for job " + jobID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // TestHealthEndpoint tests the health check endpoint
 func TestHealthEndpoint(t *testing.T) {
 	tc := setupTestEnvironment(t)
@@ -368,3 +943,1884 @@ func TestHealthEndpoint(t *testing.T) {
 	assert.Equal(t, "healthy", response["status"])
 	assert.Equal(t, "photo-library-server", response["service"])
 }
+
+// TestCORS tests the configurable cross-origin policy
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(cfg *config.Config) *gin.Engine {
+		if cfg.CORSAllowedMethods == nil {
+			cfg.CORSAllowedMethods = []string{"GET", "POST", "DELETE"}
+		}
+		router := gin.New()
+		router.Use(middleware.CORSMiddleware(cfg))
+		router.GET("/items", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+		return router
+	}
+	request := func(router *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/items", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	preflight := func(method, headers string) map[string]string {
+		return map[string]string{"Access-Control-Request-Method": method, "Access-Control-Request-Headers": headers}
+	}
+
+	t.Run("Any origin", func(t *testing.T) {
+		router := newRouter(&config.Config{
+			CORSAllowedOrigins: []string{"*"},
+			CORSAllowedHeaders: []string{"Content-Type", "X-API-Key"},
+			CORSExposedHeaders: []string{"X-Request-ID"},
+			CORSMaxAge:         10 * time.Minute,
+		})
+
+		resp := request(router, "GET", "https://app.example.org", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "*", resp.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Request-ID", resp.Header().Get("Access-Control-Expose-Headers"))
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Credentials"))
+
+		resp = request(router, "OPTIONS", "https://app.example.org", preflight("delete", "x-api-key, content-type"))
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		assert.Equal(t, "GET, POST, DELETE", resp.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type, X-API-Key", resp.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+
+		// Methods and headers outside the policy fail the preflight
+		resp = request(router, "OPTIONS", "https://app.example.org", preflight("PUT", ""))
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		resp = request(router, "OPTIONS", "https://app.example.org", preflight("GET", "X-Secret"))
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		// Same-origin and non-browser requests are left alone
+		resp = request(router, "GET", "", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Listed origins with credentials", func(t *testing.T) {
+		router := newRouter(&config.Config{
+			CORSAllowedOrigins:   []string{"https://photos.example.com", "https://*.family.example"},
+			CORSAllowedHeaders:   []string{"*"},
+			CORSAllowCredentials: true,
+			TenantMode:           middleware.TenantModeHeader,
+			TenantHeader:         "X-Tenant-ID",
+		})
+
+		for _, origin := range []string{"https://photos.example.com", "https://PHOTOS.example.com", "https://smith.family.example"} {
+			resp := request(router, "GET", origin, nil)
+			assert.Equal(t, origin, resp.Header().Get("Access-Control-Allow-Origin"), origin)
+			assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"), origin)
+			assert.Contains(t, resp.Header().Values("Vary"), "Origin")
+		}
+
+		for _, origin := range []string{"https://evil.example.com", "http://photos.example.com", "https://.family.example", "https://family.example"} {
+			resp := request(router, "GET", origin, nil)
+			assert.Equal(t, http.StatusOK, resp.Code, origin) // The browser withholds the response
+			assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"), origin)
+
+			resp = request(router, "OPTIONS", origin, preflight("GET", ""))
+			assert.Equal(t, http.StatusForbidden, resp.Code, origin)
+		}
+
+		// A wildcard allows whatever headers are asked for
+		resp := request(router, "OPTIONS", "https://photos.example.com", preflight("POST", "X-Custom, Content-Type"))
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		assert.Equal(t, "X-Custom, Content-Type", resp.Header().Get("Access-Control-Allow-Headers"))
+		assert.Empty(t, resp.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("Tenant header is allowed in header mode", func(t *testing.T) {
+		router := newRouter(&config.Config{
+			CORSAllowedOrigins: []string{"*"},
+			CORSAllowedHeaders: []string{"Content-Type"},
+			TenantMode:         middleware.TenantModeHeader,
+			TenantHeader:       "X-Tenant-ID",
+		})
+		resp := request(router, "OPTIONS", "https://app.example.org", preflight("GET", "X-Tenant-ID"))
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		assert.Equal(t, "Content-Type, X-Tenant-ID", resp.Header().Get("Access-Control-Allow-Headers"))
+	})
+
+	t.Run("No origins disables CORS", func(t *testing.T) {
+		router := newRouter(&config.Config{})
+		resp := request(router, "GET", "https://app.example.org", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+// TestProbeEndpoints tests the liveness and readiness probes
+func TestProbeEndpoints(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	resp := tc.makeRequest("GET", "/healthz", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var alive map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &alive))
+	assert.Equal(t, "alive", alive["status"])
+
+	type check struct {
+		Status  string   `json:"status"`
+		Error   string   `json:"error"`
+		Pending []string `json:"pending"`
+		Checked int      `json:"checked"`
+		Failed  []string `json:"failed"`
+	}
+	var ready struct {
+		Status string           `json:"status"`
+		Checks map[string]check `json:"checks"`
+	}
+	readiness := func(code int) {
+		resp := tc.makeRequest("GET", "/readyz", nil)
+		require.Equal(t, code, resp.Code)
+		ready.Checks = nil
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &ready))
+	}
+
+	library := tc.createTestLibrary("Probe Library", "Storage check")
+	readiness(http.StatusOK)
+	assert.Equal(t, "ready", ready.Status)
+	for _, name := range []string{"database", "migrations", "storage"} {
+		assert.Equal(t, "ok", ready.Checks[name].Status, name)
+	}
+	assert.Equal(t, 1, ready.Checks["storage"].Checked)
+
+	// Unwritable storage makes the server unready
+	require.NoError(t, os.RemoveAll(library.Images))
+	readiness(http.StatusServiceUnavailable)
+	assert.Equal(t, "not_ready", ready.Status)
+	assert.Equal(t, "ok", ready.Checks["database"].Status)
+	assert.Equal(t, "fail", ready.Checks["storage"].Status)
+	assert.Equal(t, []string{library.Images}, ready.Checks["storage"].Failed)
+	require.NoError(t, os.MkdirAll(library.Images, 0755))
+
+	// So do migrations that haven't been applied
+	require.NoError(t, tc.DB.GetDB().Exec("ALTER TABLE photos DROP COLUMN verified_at").Error)
+	readiness(http.StatusServiceUnavailable)
+	assert.Equal(t, "fail", ready.Checks["migrations"].Status)
+	assert.Equal(t, []string{"photos.verified_at"}, ready.Checks["migrations"].Pending)
+	assert.Equal(t, "ok", ready.Checks["storage"].Status)
+}
+
+// TestMetricsEndpoint tests the Prometheus metrics endpoint
+func TestMetricsEndpoint(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	library := tc.createTestLibrary("Metrics Library", "Storage usage")
+	photo := tc.uploadTestPhoto(library.ID, "metrics.jpg", nil, "")
+	tc.makeRequest("GET", "/api/v1/photos/"+photo.ID.String(), nil)
+
+	resp := tc.makeRequest("GET", "/metrics", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "text/plain")
+
+	body := resp.Body.String()
+	assert.Contains(t, body, "# TYPE photos_http_requests_total counter")
+	assert.Contains(t, body, `photos_http_requests_total{method="GET",route="/api/v1/photos/:id",status="200"}`)
+	assert.Contains(t, body, `photos_http_request_duration_seconds_bucket{method="POST",route="/api/v1/photos/upload",le="+Inf"}`)
+	assert.Contains(t, body, "photos_upload_bytes_total ")
+	assert.Contains(t, body, `photos_db_connections{state="in_use"}`)
+	assert.Contains(t, body, fmt.Sprintf(`photos_library_storage_bytes{library_id="%s",tenant=""} %d`, library.ID, photo.FileSize))
+	assert.Contains(t, body, fmt.Sprintf(`photos_library_photos{library_id="%s",tenant=""} 1`, library.ID))
+	assert.Contains(t, body, "photos_job_queue_depth 0")
+	assert.NotContains(t, body, photo.ID.String()) // IDs are route parameters, not labels
+}
+
+// TestRequestLogging tests request IDs and the structured request log
+func TestRequestLogging(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	t.Run("Request IDs", func(t *testing.T) {
+		resp := tc.makeRequest("GET", "/health", nil)
+		_, err := uuid.Parse(resp.Header().Get("X-Request-ID"))
+		assert.NoError(t, err)
+
+		// IDs from clients and proxies are kept, unless unsafe to log
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("X-Request-ID", "lb-4f2a.9")
+		resp = httptest.NewRecorder()
+		tc.Router.ServeHTTP(resp, req)
+		assert.Equal(t, "lb-4f2a.9", resp.Header().Get("X-Request-ID"))
+
+		req = httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("X-Request-ID", "bad\nid")
+		resp = httptest.NewRecorder()
+		tc.Router.ServeHTTP(resp, req)
+		assert.NotEqual(t, "bad\nid", resp.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("Structured log lines", func(t *testing.T) {
+		var out bytes.Buffer
+		router := gin.New()
+		router.Use(middleware.RequestIDMiddleware())
+		router.Use(middleware.LoggerMiddleware(logging.New(&out, slog.LevelInfo)))
+		router.GET("/items/:id", func(c *gin.Context) {
+			logging.FromContext(c.Request.Context()).Info("handling")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		})
+
+		// Handler logs share the request's ID through the default logger
+		previous := slog.Default()
+		slog.SetDefault(logging.New(&out, slog.LevelInfo))
+		defer slog.SetDefault(previous)
+
+		req := httptest.NewRequest("GET", "/items/42", nil)
+		req.Header.Set("X-Request-ID", "req-1")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 2)
+		var handled, request map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &handled))
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &request))
+		assert.Equal(t, "req-1", handled["request_id"])
+		assert.Equal(t, "req-1", request["request_id"])
+		assert.Equal(t, "WARN", request["level"])
+		assert.Equal(t, "/items/42", request["path"])
+		assert.Equal(t, "/items/:id", request["route"])
+		assert.Equal(t, float64(http.StatusNotFound), request["status"])
+		assert.Contains(t, request, "latency_ms")
+
+		// Records below the level are dropped
+		out.Reset()
+		router = gin.New()
+		router.Use(middleware.LoggerMiddleware(logging.New(&out, slog.LevelWarn)))
+		router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+		assert.Empty(t, out.String())
+	})
+}
+
+// TestCapabilitiesEndpoint tests the server capabilities endpoint
+func TestCapabilitiesEndpoint(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	resp := tc.makeRequest("GET", "/api/v1/capabilities", nil)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var response struct {
+		APIVersion string `json:"api_version"`
+		Uploads    struct {
+			MaxFileSize  int64    `json:"max_file_size"`
+			AllowedTypes []string `json:"allowed_types"`
+		} `json:"uploads"`
+		Features map[string]json.RawMessage `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+
+	assert.Equal(t, "v1", response.APIVersion)
+	assert.Equal(t, tc.Config.MaxFileSize, response.Uploads.MaxFileSize)
+	assert.Contains(t, response.Uploads.AllowedTypes, "image/jpeg")
+
+	var signedURLs, video, coldStorage struct {
+		Enabled bool `json:"enabled"`
+	}
+	json.Unmarshal(response.Features["signed_urls"], &signedURLs)
+	json.Unmarshal(response.Features["video"], &video)
+	json.Unmarshal(response.Features["cold_storage"], &coldStorage)
+	assert.True(t, signedURLs.Enabled)
+	assert.True(t, video.Enabled)
+	assert.False(t, coldStorage.Enabled)
+	assert.JSONEq(t, `"trim,nfc,casefold"`, string(response.Features["tag_normalization"]))
+
+	// Capabilities follow the running configuration
+	tc.Config.ColdStoragePath = filepath.Join(tc.TempDir, "cold")
+	resp = tc.makeRequest("GET", "/api/v1/capabilities", nil)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+	json.Unmarshal(response.Features["cold_storage"], &coldStorage)
+	assert.True(t, coldStorage.Enabled)
+}
+
+// TestAPIv2Envelope tests that v2 wraps v1 responses in a consistent envelope
+func TestOpenAPISpec(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	resp := tc.makeRequest("GET", "/api/openapi.json", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Tags        []string
+			Parameters  []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]interface{} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]struct {
+				Headers map[string]interface{} `json:"headers"`
+			} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string                          `json:"required"`
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+
+	t.Run("Every route is described", func(t *testing.T) {
+		for _, route := range tc.Router.Routes() {
+			if strings.HasPrefix(route.Path, "/api/v2/") || route.Method == http.MethodOptions || route.Method == apikeys.MethodPropfind {
+				continue
+			}
+			path := regexp.MustCompile(`[:*](\w+)`).ReplaceAllString(route.Path, "{$1}")
+			op, ok := spec.Paths[path][strings.ToLower(route.Method)]
+			if assert.True(t, ok, "%s %s", route.Method, route.Path) {
+				assert.NotEmpty(t, op.OperationID, "%s %s", route.Method, route.Path)
+			}
+		}
+	})
+
+	t.Run("Operations follow their handlers", func(t *testing.T) {
+		getPhoto := spec.Paths["/api/v1/photos/{id}"]["get"]
+		assert.Equal(t, "getPhoto", getPhoto.OperationID)
+		assert.Equal(t, []string{"photos"}, getPhoto.Tags)
+		require.NotEmpty(t, getPhoto.Parameters)
+		assert.Equal(t, "id", getPhoto.Parameters[0].Name)
+		assert.Equal(t, "path", getPhoto.Parameters[0].In)
+
+		create := spec.Paths["/api/v1/libraries"]["post"]
+		assert.Equal(t, "#/components/schemas/CreateLibraryRequest", create.RequestBody.Content["application/json"].Schema["$ref"])
+		assert.Contains(t, create.Responses, "201")
+		request := spec.Components.Schemas["CreateLibraryRequest"]
+		assert.ElementsMatch(t, []string{"name", "images"}, request.Required)
+		assert.Equal(t, []interface{}{"eager", "background", "lazy"}, request.Properties["thumbnail_mode"]["enum"])
+		assert.Equal(t, float64(100), request.Properties["name"]["maxLength"])
+
+		upload := spec.Paths["/api/v1/photos/upload"]["post"]
+		assert.Contains(t, upload.RequestBody.Content, "multipart/form-data")
+
+		rescan := spec.Paths["/api/v1/libraries/{id}/rescan"]["post"]
+		assert.Contains(t, rescan.Responses["202"].Headers, "Location")
+
+		assert.Contains(t, spec.Components.Schemas, "Photo")
+		assert.Equal(t, "uuid", spec.Components.Schemas["Photo"].Properties["id"]["format"])
+	})
+
+	t.Run("Routes and docs must match", func(t *testing.T) {
+		routes := append(tc.Router.Routes(), gin.RouteInfo{Method: "GET", Path: "/api/v1/undocumented"})
+		_, err := handlers.BuildOpenAPISpec(routes, tc.Config)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "GET /api/v1/undocumented")
+	})
+
+	t.Run("Index and Swagger UI", func(t *testing.T) {
+		resp := tc.makeRequest("GET", "/api", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var index map[string]interface{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &index))
+		assert.Equal(t, "/api/openapi.json", index["openapi"])
+
+		resp = tc.makeRequest("GET", "/api/docs", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, resp.Body.String(), "/api/openapi.json")
+	})
+}
+
+func TestGraphQL(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	type result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string        `json:"message"`
+			Path    []interface{} `json:"path"`
+		} `json:"errors"`
+	}
+	run := func(t *testing.T, query string, variables map[string]interface{}) (int, result) {
+		resp := tc.makeRequest("POST", "/graphql", map[string]interface{}{"query": query, "variables": variables})
+		var body result
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body), resp.Body.String())
+		return resp.Code, body
+	}
+
+	library := tc.createTestLibrary("GraphQL Library", "For GraphQL tests")
+	album := tc.createTestAlbum("Holiday", "", library.ID)
+	tc.createTestAlbum("Archive", "", library.ID)
+	first := tc.uploadTestPhoto(library.ID, "first.jpg", nil, "beach,sunset")
+	second := tc.uploadTestPhoto(library.ID, "second.jpg", nil, "beach")
+	third := tc.uploadTestPhoto(library.ID, "third.jpg", nil, "")
+	resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+		"photo_ids": []uuid.UUID{second.ID, first.ID, third.ID},
+	})
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	t.Run("Nested relations", func(t *testing.T) {
+		code, body := run(t, `query($id: ID!) {
+			album(id: $id) {
+				name
+				library { name albums { name } }
+				cover_photo { id }
+				photos { id file_url tags { name } albums { name } }
+			}
+		}`, map[string]interface{}{"id": album.ID})
+		require.Equal(t, http.StatusOK, code)
+		require.Empty(t, body.Errors)
+
+		var data struct {
+			Album struct {
+				Name    string
+				Library struct {
+					Name   string
+					Albums []struct{ Name string }
+				}
+				CoverPhoto struct{ ID uuid.UUID } `json:"cover_photo"`
+				Photos     []struct {
+					ID      uuid.UUID
+					FileURL string `json:"file_url"`
+					Tags    []struct{ Name string }
+					Albums  []struct{ Name string }
+				}
+			}
+		}
+		require.NoError(t, json.Unmarshal(body.Data, &data))
+		assert.Equal(t, "Holiday", data.Album.Name)
+		assert.Equal(t, "GraphQL Library", data.Album.Library.Name)
+		require.Len(t, data.Album.Library.Albums, 2)
+		assert.Equal(t, "Archive", data.Album.Library.Albums[0].Name)
+		assert.Equal(t, second.ID, data.Album.CoverPhoto.ID, "first photo in album order")
+
+		// Photos in album order, each with its own tags
+		require.Len(t, data.Album.Photos, 3)
+		assert.Equal(t, []uuid.UUID{second.ID, first.ID, third.ID},
+			[]uuid.UUID{data.Album.Photos[0].ID, data.Album.Photos[1].ID, data.Album.Photos[2].ID})
+		assert.True(t, strings.HasPrefix(data.Album.Photos[0].FileURL, fmt.Sprintf("/api/v1/photos/%s/file", second.ID)))
+		assert.Equal(t, []struct{ Name string }{{"beach"}}, data.Album.Photos[0].Tags)
+		assert.Equal(t, []struct{ Name string }{{"beach"}, {"sunset"}}, data.Album.Photos[1].Tags)
+		assert.Empty(t, data.Album.Photos[2].Tags)
+		assert.NotNil(t, data.Album.Photos[2].Tags, "empty relations are [] rather than null")
+		assert.Equal(t, []struct{ Name string }{{"Holiday"}}, data.Album.Photos[2].Albums)
+	})
+
+	t.Run("One query per level", func(t *testing.T) {
+		db := tc.DB.GetDB()
+		queries := 0
+		countQuery := func(*gorm.DB) { queries++ }
+		require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:count_queries", countQuery))
+		defer db.Callback().Query().Remove("test:count_queries")
+		require.NoError(t, db.Callback().Row().After("gorm:row").Register("test:count_rows", countQuery))
+		defer db.Callback().Row().Remove("test:count_rows")
+
+		count := func(query string) int {
+			queries = 0
+			code, body := run(t, query, nil)
+			require.Equal(t, http.StatusOK, code)
+			require.Empty(t, body.Errors)
+			return queries
+		}
+
+		// Tags, their photos (links and records) and those photos' tags
+		// (links and records), however many photos there are
+		nested := `{ tags { name photos { id tags { name } } } }`
+		assert.Equal(t, 5, count(nested))
+		tc.uploadTestPhoto(library.ID, "fourth.jpg", nil, "beach,sunset")
+		assert.Equal(t, 5, count(nested))
+	})
+
+	t.Run("Top-level lists and lookups", func(t *testing.T) {
+		code, body := run(t, `query($library: ID) {
+			photos(library_id: $library, tag: " sunset ", limit: 1) { id }
+			libraries { name }
+			tags { name }
+			missing: photo(id: "00000000-0000-0000-0000-000000000000") { id }
+		}`, map[string]interface{}{"library": library.ID})
+		require.Equal(t, http.StatusOK, code)
+		require.Empty(t, body.Errors)
+
+		var data struct {
+			Photos    []struct{ ID uuid.UUID }
+			Libraries []struct{ Name string }
+			Tags      []struct{ Name string }
+			Missing   *struct{ ID uuid.UUID }
+		}
+		require.NoError(t, json.Unmarshal(body.Data, &data))
+		require.Len(t, data.Photos, 1, "tag names are normalized and the page is limited")
+		assert.NotEqual(t, second.ID, data.Photos[0].ID)
+		assert.Equal(t, []struct{ Name string }{{"GraphQL Library"}}, data.Libraries)
+		assert.Equal(t, []struct{ Name string }{{"beach"}, {"sunset"}}, data.Tags)
+		assert.Nil(t, data.Missing)
+	})
+
+	t.Run("GET requests", func(t *testing.T) {
+		query := url.Values{
+			"query":     {`query($id: ID!) { photo(id: $id) { id } }`},
+			"variables": {fmt.Sprintf(`{"id": %q}`, first.ID)},
+		}
+		resp := tc.makeRequest("GET", "/graphql?"+query.Encode(), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.JSONEq(t, fmt.Sprintf(`{"data": {"photo": {"id": %q}}}`, first.ID), resp.Body.String())
+
+		resp = tc.makeRequest("GET", "/graphql", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		// Queries that can't run
+		for _, query := range []string{
+			`{ photos { id `,
+			`{ photos { secret } }`,
+			`mutation { deletePhoto(id: "x") }`,
+		} {
+			code, body := run(t, query, nil)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+			assert.NotEmpty(t, body.Errors, query)
+		}
+
+		// Failed fields leave the rest of the data
+		code, body := run(t, `{ photo(id: "not-a-uuid") { id } tags { name } }`, nil)
+		assert.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Errors, 1)
+		assert.Equal(t, "Invalid photo ID", body.Errors[0].Message)
+		assert.Contains(t, string(body.Data), `"tags"`)
+	})
+
+	t.Run("Read-only API keys", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/apikeys", map[string]interface{}{"name": "reader", "scope": "read"})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var key struct{ Key string }
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &key))
+
+		body, _ := json.Marshal(map[string]string{"query": `{ tags { name } }`})
+		req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key.Key)
+		w := httptest.NewRecorder()
+		tc.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+}
+
+func TestGRPC(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpcapi.NewServer(tc.Router, nil)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	libraries := photosv1.NewLibraryServiceClient(conn)
+	albums := photosv1.NewAlbumServiceClient(conn)
+	photos := photosv1.NewPhotoServiceClient(conn)
+	tags := photosv1.NewTagServiceClient(conn)
+	ctx := context.Background()
+
+	upload := func(ctx context.Context, info *photosv1.UploadPhotoInfo, data []byte) (*photosv1.Photo, error) {
+		stream, err := photos.UploadPhoto(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&photosv1.UploadPhotoRequest{Part: &photosv1.UploadPhotoRequest_Info{Info: info}}))
+		for len(data) > 0 {
+			chunk := data[:min(100, len(data))]
+			data = data[len(chunk):]
+			require.NoError(t, stream.Send(&photosv1.UploadPhotoRequest{Part: &photosv1.UploadPhotoRequest_Chunk{Chunk: chunk}}))
+		}
+		return stream.CloseAndRecv()
+	}
+
+	library, err := libraries.CreateLibrary(ctx, &photosv1.CreateLibraryRequest{
+		Name:       "gRPC Library",
+		Images:     filepath.Join(tc.TempDir, "library_grpc"),
+		QuotaBytes: 10 * 1024 * 1024,
+	})
+	require.NoError(t, err)
+
+	t.Run("Libraries", func(t *testing.T) {
+		assert.NotEmpty(t, library.Id)
+		assert.Equal(t, int64(10*1024*1024), library.QuotaBytes)
+		assert.False(t, library.CreatedAt.AsTime().IsZero())
+
+		name := "Renamed gRPC Library"
+		updated, err := libraries.UpdateLibrary(ctx, &photosv1.UpdateLibraryRequest{Id: library.Id, Name: &name})
+		require.NoError(t, err)
+		assert.Equal(t, name, updated.Name)
+		assert.Equal(t, int64(10*1024*1024), updated.QuotaBytes, "unset fields keep their value")
+
+		fetched, err := libraries.GetLibrary(ctx, &photosv1.GetLibraryRequest{Id: library.Id})
+		require.NoError(t, err)
+		assert.Equal(t, name, fetched.Name)
+
+		list, err := libraries.ListLibraries(ctx, &photosv1.ListLibrariesRequest{})
+		require.NoError(t, err)
+		require.Len(t, list.Libraries, 1)
+		assert.Equal(t, library.Id, list.Libraries[0].Id)
+	})
+
+	var photo *photosv1.Photo
+	t.Run("Streaming upload", func(t *testing.T) {
+		rating := int32(4)
+		data := createTestImage()
+		photo, err = upload(ctx, &photosv1.UploadPhotoInfo{
+			LibraryId: library.Id,
+			Filename:  "streamed.jpg",
+			Rating:    &rating,
+			Tags:      []string{"grpc", "streamed"},
+		}, data)
+		require.NoError(t, err)
+		assert.Equal(t, "streamed.jpg", photo.OriginalName)
+		assert.Equal(t, "image/jpeg", photo.MimeType)
+		assert.Equal(t, int64(len(data)), photo.FileSize)
+		require.NotNil(t, photo.Rating)
+		assert.Equal(t, rating, *photo.Rating)
+		assert.Len(t, photo.Tags, 2)
+		assert.Equal(t, library.Id, photo.LibraryId)
+
+		// The file can be fetched over HTTP like any other upload
+		resp := tc.makeRequest("GET", photo.FileUrl, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, data, resp.Body.Bytes())
+	})
+
+	t.Run("Photos", func(t *testing.T) {
+		list, err := photos.ListPhotos(ctx, &photosv1.ListPhotosRequest{LibraryId: library.Id, Tag: "grpc", IncludeTags: true})
+		require.NoError(t, err)
+		require.Len(t, list.Photos, 1)
+		assert.Equal(t, photo.Id, list.Photos[0].Id)
+		assert.Len(t, list.Photos[0].Tags, 2)
+		assert.Equal(t, int64(1), list.Pagination.Total)
+
+		favorite := true
+		title := "Streamed in"
+		updated, err := photos.UpdatePhoto(ctx, &photosv1.UpdatePhotoRequest{Id: photo.Id, Favorite: &favorite, Title: &title})
+		require.NoError(t, err)
+		assert.True(t, updated.Favorite)
+		assert.Equal(t, title, updated.Title)
+		require.NotNil(t, updated.Rating, "unset fields keep their value")
+
+		list, err = photos.ListPhotos(ctx, &photosv1.ListPhotosRequest{Favorite: &favorite})
+		require.NoError(t, err)
+		assert.Len(t, list.Photos, 1)
+
+		fetched, err := photos.GetPhoto(ctx, &photosv1.GetPhotoRequest{Id: photo.Id})
+		require.NoError(t, err)
+		assert.Equal(t, title, fetched.Title)
+	})
+
+	t.Run("Albums", func(t *testing.T) {
+		album, err := albums.CreateAlbum(ctx, &photosv1.CreateAlbumRequest{Name: "gRPC Album", LibraryId: library.Id})
+		require.NoError(t, err)
+
+		added, err := albums.AddAlbumPhotos(ctx, &photosv1.AddAlbumPhotosRequest{AlbumId: album.Id, PhotoIds: []string{photo.Id}})
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), added.Added)
+
+		page, err := albums.ListAlbumPhotos(ctx, &photosv1.ListAlbumPhotosRequest{AlbumId: album.Id})
+		require.NoError(t, err)
+		require.Len(t, page.Photos, 1)
+		assert.Equal(t, int64(1), page.Pagination.Total)
+
+		fetched, err := albums.GetAlbum(ctx, &photosv1.GetAlbumRequest{Id: album.Id, IncludePhotos: true})
+		require.NoError(t, err)
+		assert.Len(t, fetched.Photos, 1)
+		require.NotNil(t, fetched.CoverPhoto)
+		assert.Equal(t, photo.Id, fetched.CoverPhoto.Id)
+
+		list, err := albums.ListAlbums(ctx, &photosv1.ListAlbumsRequest{LibraryId: library.Id})
+		require.NoError(t, err)
+		assert.Len(t, list.Albums, 1)
+
+		removed, err := albums.RemoveAlbumPhotos(ctx, &photosv1.RemoveAlbumPhotosRequest{AlbumId: album.Id, PhotoIds: []string{photo.Id}})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), removed.Removed)
+
+		_, err = albums.DeleteAlbum(ctx, &photosv1.DeleteAlbumRequest{Id: album.Id})
+		require.NoError(t, err)
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		tag, err := tags.CreateTag(ctx, &photosv1.CreateTagRequest{Name: "ingested", Color: "#00FF00"})
+		require.NoError(t, err)
+		_, err = tags.TagPhoto(ctx, &photosv1.TagPhotoRequest{TagId: tag.Id, PhotoId: photo.Id})
+		require.NoError(t, err)
+
+		fetched, err := photos.GetPhoto(ctx, &photosv1.GetPhotoRequest{Id: photo.Id, IncludeTags: true})
+		require.NoError(t, err)
+		assert.Len(t, fetched.Tags, 3)
+
+		_, err = tags.UntagPhoto(ctx, &photosv1.TagPhotoRequest{TagId: tag.Id, PhotoId: photo.Id})
+		require.NoError(t, err)
+
+		list, err := tags.ListTags(ctx, &photosv1.ListTagsRequest{})
+		require.NoError(t, err)
+		assert.Len(t, list.Tags, 3)
+
+		updated, err := tags.UpdateTag(ctx, &photosv1.UpdateTagRequest{Id: tag.Id, Name: "imported", Color: "#0000FF"})
+		require.NoError(t, err)
+		assert.Equal(t, "imported", updated.Name)
+
+		_, err = tags.DeleteTag(ctx, &photosv1.DeleteTagRequest{Id: tag.Id})
+		require.NoError(t, err)
+		_, err = tags.GetTag(ctx, &photosv1.GetTagRequest{Id: tag.Id})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := libraries.GetLibrary(ctx, &photosv1.GetLibraryRequest{Id: "not-a-uuid"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, "Invalid library ID", status.Convert(err).Message())
+
+		_, err = libraries.GetLibrary(ctx, &photosv1.GetLibraryRequest{Id: uuid.New().String()})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		details := status.Convert(err).Details()
+		require.Len(t, details, 1)
+		require.IsType(t, &errdetails.ErrorInfo{}, details[0])
+		assert.Equal(t, "library_not_found", details[0].(*errdetails.ErrorInfo).Reason)
+
+		_, err = tags.CreateTag(ctx, &photosv1.CreateTagRequest{Name: "grpc"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		_, err = upload(ctx, &photosv1.UploadPhotoInfo{LibraryId: uuid.New().String(), Filename: "lost.jpg"}, createTestImage())
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		// The first message must describe the file
+		stream, err := photos.UploadPhoto(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&photosv1.UploadPhotoRequest{Part: &photosv1.UploadPhotoRequest_Chunk{Chunk: []byte("data")}}))
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("API keys", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/apikeys", map[string]interface{}{"name": "Reader", "scope": apikeys.ScopeRead})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var created struct {
+			Key string `json:"key"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+
+		tc.Config.RequireAPIKey = true
+		defer func() { tc.Config.RequireAPIKey = false }()
+
+		_, err := photos.ListPhotos(ctx, &photosv1.ListPhotosRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		keyed := metadata.AppendToOutgoingContext(ctx, strings.ToLower(apikeys.Header), created.Key)
+		_, err = photos.ListPhotos(keyed, &photosv1.ListPhotosRequest{})
+		assert.NoError(t, err)
+		_, err = tags.CreateTag(keyed, &photosv1.CreateTagRequest{Name: "read-only"})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = upload(keyed, &photosv1.UploadPhotoInfo{LibraryId: library.Id, Filename: "denied.jpg"}, createTestImage())
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		_, err := photos.DeletePhoto(ctx, &photosv1.DeletePhotoRequest{Id: photo.Id})
+		require.NoError(t, err)
+		_, err = photos.GetPhoto(ctx, &photosv1.GetPhotoRequest{Id: photo.Id})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = libraries.DeleteLibrary(ctx, &photosv1.DeleteLibraryRequest{Id: library.Id})
+		require.NoError(t, err)
+	})
+}
+
+func TestAPIv2Envelope(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	type envelope struct {
+		Data   json.RawMessage            `json:"data"`
+		Meta   map[string]json.RawMessage `json:"meta"`
+		Errors []struct {
+			Status  int                        `json:"status"`
+			Code    string                     `json:"code"`
+			Message string                     `json:"message"`
+			Details map[string]json.RawMessage `json:"details"`
+		} `json:"errors"`
+	}
+	decode := func(resp *httptest.ResponseRecorder) envelope {
+		var body envelope
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body), resp.Body.String())
+		return body
+	}
+
+	library := tc.createTestLibrary("Envelope Library", "For v2 tests")
+	photo := tc.uploadTestPhoto(library.ID, "envelope.jpg", nil, "")
+
+	t.Run("Objects", func(t *testing.T) {
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v2/libraries/%s", library.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		body := decode(resp)
+		var data TestLibrary
+		require.NoError(t, json.Unmarshal(body.Data, &data))
+		assert.Equal(t, library.ID, data.ID)
+		assert.JSONEq(t, `"v2"`, string(body.Meta["api_version"]))
+		assert.NotNil(t, body.Errors)
+		assert.Empty(t, body.Errors)
+	})
+
+	t.Run("Bare arrays", func(t *testing.T) {
+		resp := tc.makeRequest("GET", "/api/v2/libraries", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var data []TestLibrary
+		require.NoError(t, json.Unmarshal(decode(resp).Data, &data))
+		assert.Len(t, data, 1)
+	})
+
+	t.Run("Paginated lists", func(t *testing.T) {
+		resp := tc.makeRequest("GET", "/api/v2/photos?limit=10", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		body := decode(resp)
+		var data []TestPhoto
+		require.NoError(t, json.Unmarshal(body.Data, &data))
+		require.Len(t, data, 1)
+		assert.Equal(t, photo.ID, data[0].ID)
+
+		var pagination struct {
+			Limit int `json:"limit"`
+			Total int `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(body.Meta["pagination"], &pagination))
+		assert.Equal(t, 10, pagination.Limit)
+		assert.Equal(t, 1, pagination.Total)
+	})
+
+	t.Run("Created", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v2/tags", map[string]interface{}{"name": "envelope"})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		assert.Contains(t, string(decode(resp).Data), `"name":"envelope"`)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v2/photos/%s", uuid.New()), nil)
+		require.Equal(t, http.StatusNotFound, resp.Code)
+
+		body := decode(resp)
+		assert.Equal(t, "null", string(body.Data))
+		require.Len(t, body.Errors, 1)
+		assert.Equal(t, http.StatusNotFound, body.Errors[0].Status)
+		assert.Equal(t, "photo_not_found", body.Errors[0].Code)
+		assert.Equal(t, "Photo not found", body.Errors[0].Message)
+		assert.NotContains(t, body.Errors[0].Details, "code")
+
+		// Extra fields of the error body are kept as details
+		resp = tc.makeRequest("POST", "/api/v2/photos/export", map[string]interface{}{"photo_ids": []uuid.UUID{uuid.New()}})
+		require.Equal(t, http.StatusNotFound, resp.Code)
+		body = decode(resp)
+		require.Len(t, body.Errors, 1)
+		assert.Contains(t, body.Errors[0].Details, "photo_ids")
+	})
+
+	t.Run("Files are not wrapped", func(t *testing.T) {
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v2/photos/%s/file", photo.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		assert.Equal(t, createTestImage(), resp.Body.Bytes())
+	})
+
+	t.Run("v1 is unchanged", func(t *testing.T) {
+		resp := tc.makeRequest("GET", "/api/v1/libraries", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var data []TestLibrary
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &data))
+		assert.Len(t, data, 1)
+	})
+}
+
+// TestErrorCodes tests the machine-readable codes of error responses
+func TestErrorCodes(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	type errorBody struct {
+		Error  string `json:"error"`
+		Code   string `json:"code"`
+		Fields []struct {
+			Field   string `json:"field"`
+			Rule    string `json:"rule"`
+			Param   string `json:"param"`
+			Message string `json:"message"`
+		} `json:"fields"`
+	}
+	decode := func(resp *httptest.ResponseRecorder) errorBody {
+		var body errorBody
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body), resp.Body.String())
+		return body
+	}
+
+	library := tc.createTestLibrary("Codes Library", "For error code tests")
+	tc.createTestTag("coded", "")
+
+	t.Run("Resource errors", func(t *testing.T) {
+		for _, test := range []struct {
+			method, path string
+			body         interface{}
+			status       int
+			code         string
+		}{
+			{"GET", "/api/v1/libraries/not-a-uuid", nil, http.StatusBadRequest, "invalid_library_id"},
+			{"GET", fmt.Sprintf("/api/v1/libraries/%s", uuid.New()), nil, http.StatusNotFound, "library_not_found"},
+			{"GET", fmt.Sprintf("/api/v1/photos/%s", uuid.New()), nil, http.StatusNotFound, "photo_not_found"},
+			{"POST", "/api/v1/tags", map[string]interface{}{"name": "coded"}, http.StatusConflict, "duplicate_tag"},
+			{"POST", "/api/v1/libraries", map[string]interface{}{"name": "Codes Library", "images": t.TempDir()}, http.StatusConflict, "duplicate_library_name"},
+		} {
+			resp := tc.makeRequest(test.method, test.path, test.body)
+			require.Equal(t, test.status, resp.Code, test.path)
+			body := decode(resp)
+			assert.Equal(t, test.code, body.Code, test.path)
+			assert.NotEmpty(t, body.Error, test.path)
+		}
+	})
+
+	t.Run("Validation errors", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{"description": "No name"})
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		body := decode(resp)
+		assert.Equal(t, "validation_failed", body.Code)
+		assert.Equal(t, "name is required", body.Error)
+		require.Len(t, body.Fields, 2)
+		assert.Equal(t, "name", body.Fields[0].Field)
+		assert.Equal(t, "required", body.Fields[0].Rule)
+		assert.Equal(t, "images", body.Fields[1].Field)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"name": strings.Repeat("x", 101)})
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		body = decode(resp)
+		require.Len(t, body.Fields, 1)
+		assert.Equal(t, "max", body.Fields[0].Rule)
+		assert.Equal(t, "100", body.Fields[0].Param)
+		assert.Equal(t, "name must be at most 100 characters", body.Error)
+
+		resp = tc.makeRequest("POST", "/api/v1/tags", map[string]interface{}{"name": 42})
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		body = decode(resp)
+		assert.Equal(t, "validation_failed", body.Code)
+		assert.Equal(t, "name must be a string", body.Error)
+	})
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v1/tags", strings.NewReader(`{"name":`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		tc.Router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		body := decode(resp)
+		assert.Equal(t, "invalid_json", body.Code)
+		assert.Equal(t, "Request body is not valid JSON", body.Error)
+	})
+}
+
+// TestBatchEndpoint tests running many requests in one call
+func TestBatchEndpoint(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	library := tc.createTestLibrary("Batch Library", "For batch tests")
+	photo := tc.uploadTestPhoto(library.ID, "batch.jpg", nil, "")
+	album := tc.createTestAlbum("Batch Album", "", library.ID)
+
+	type batchResponse struct {
+		Atomic    bool `json:"atomic"`
+		Committed bool `json:"committed"`
+		Results   []struct {
+			Status int             `json:"status"`
+			Body   json.RawMessage `json:"body"`
+		} `json:"results"`
+	}
+	runBatch := func(payload map[string]interface{}) batchResponse {
+		resp := tc.makeRequest("POST", "/api/v1/batch", payload)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var body batchResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		return body
+	}
+	tagExists := func(name string) bool {
+		resp := tc.makeRequest("GET", "/api/v1/tags", nil)
+		return strings.Contains(resp.Body.String(), fmt.Sprintf(`"name":"%s"`, name))
+	}
+
+	t.Run("Independent Requests", func(t *testing.T) {
+		body := runBatch(map[string]interface{}{
+			"requests": []map[string]interface{}{
+				{"method": "POST", "path": "/api/v1/tags", "body": map[string]interface{}{"name": "batched"}},
+				{"method": "GET", "path": fmt.Sprintf("/api/v1/photos/%s", uuid.New())},
+				{"method": "GET", "path": fmt.Sprintf("/api/v2/libraries/%s", library.ID)},
+			},
+		})
+
+		require.Len(t, body.Results, 3)
+		assert.Equal(t, http.StatusCreated, body.Results[0].Status)
+		assert.Contains(t, string(body.Results[0].Body), `"name":"batched"`)
+		assert.Equal(t, http.StatusNotFound, body.Results[1].Status)
+		assert.Contains(t, string(body.Results[1].Body), "Photo not found")
+		assert.Equal(t, http.StatusOK, body.Results[2].Status)
+		assert.Contains(t, string(body.Results[2].Body), `"data":`)
+
+		// Failures don't stop or undo other requests
+		assert.True(t, tagExists("batched"))
+	})
+
+	t.Run("Atomic - Committed", func(t *testing.T) {
+		body := runBatch(map[string]interface{}{
+			"atomic": true,
+			"requests": []map[string]interface{}{
+				{"method": "POST", "path": fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), "body": map[string]interface{}{"photo_id": photo.ID}},
+				{"method": "PUT", "path": fmt.Sprintf("/api/v1/photos/%s", photo.ID), "body": map[string]interface{}{"rating": 4}},
+				{"method": "POST", "path": "/api/v1/tags", "body": map[string]interface{}{"name": "atomic"}},
+			},
+		})
+
+		assert.True(t, body.Committed)
+		require.Len(t, body.Results, 3)
+		for _, result := range body.Results {
+			assert.Less(t, result.Status, 300, string(result.Body))
+		}
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s?include_photos=true", album.ID), nil)
+		assert.Contains(t, resp.Body.String(), photo.ID.String())
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
+		assert.Contains(t, resp.Body.String(), `"rating":4`)
+		assert.True(t, tagExists("atomic"))
+	})
+
+	t.Run("Atomic - Rolled Back", func(t *testing.T) {
+		body := runBatch(map[string]interface{}{
+			"atomic": true,
+			"requests": []map[string]interface{}{
+				{"method": "POST", "path": "/api/v1/tags", "body": map[string]interface{}{"name": "rolled-back"}},
+				{"method": "DELETE", "path": fmt.Sprintf("/api/v1/albums/%s", album.ID)},
+				{"method": "GET", "path": fmt.Sprintf("/api/v1/albums/%s", uuid.New())},
+				{"method": "DELETE", "path": fmt.Sprintf("/api/v1/photos/%s", photo.ID)},
+			},
+		})
+
+		// Execution stops at the first failure and nothing is kept
+		assert.False(t, body.Committed)
+		require.Len(t, body.Results, 3)
+		assert.Equal(t, http.StatusNotFound, body.Results[2].Status)
+		assert.False(t, tagExists("rolled-back"))
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s", album.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Atomic - File Operations Rejected", func(t *testing.T) {
+		body := runBatch(map[string]interface{}{
+			"atomic": true,
+			"requests": []map[string]interface{}{
+				{"method": "POST", "path": "/api/v1/tags", "body": map[string]interface{}{"name": "with-purge"}},
+				{"method": "DELETE", "path": fmt.Sprintf("/api/v1/trash/%s", photo.ID)},
+			},
+		})
+
+		assert.False(t, body.Committed)
+		require.Len(t, body.Results, 2)
+		assert.Equal(t, http.StatusBadRequest, body.Results[1].Status)
+		assert.False(t, tagExists("with-purge"))
+		assert.FileExists(t, photo.FilePath)
+	})
+
+	t.Run("Atomic - Trash And Restore", func(t *testing.T) {
+		body := runBatch(map[string]interface{}{
+			"atomic": true,
+			"requests": []map[string]interface{}{
+				{"method": "DELETE", "path": fmt.Sprintf("/api/v1/photos/%s", photo.ID)},
+				{"method": "POST", "path": fmt.Sprintf("/api/v1/photos/%s/restore", photo.ID)},
+			},
+		})
+
+		assert.True(t, body.Committed)
+		require.Len(t, body.Results, 2)
+		assert.Equal(t, http.StatusOK, body.Results[1].Status)
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Invalid Batches", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/batch", map[string]interface{}{
+			"requests": []map[string]interface{}{{"method": "POST", "path": "/api/v1/batch"}},
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("POST", "/api/v1/batch", map[string]interface{}{
+			"requests": []map[string]interface{}{{"method": "GET", "path": "/health"}},
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("POST", "/api/v1/batch", map[string]interface{}{"requests": []map[string]interface{}{}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		tooMany := make([]map[string]interface{}, 51)
+		for i := range tooMany {
+			tooMany[i] = map[string]interface{}{"method": "GET", "path": "/api/v1/tags"}
+		}
+		resp = tc.makeRequest("POST", "/api/v1/batch", map[string]interface{}{"requests": tooMany})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
+
+// TestMultiTenantMode tests that tenants only see their own records
+func TestMultiTenantMode(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	tc.Config.TenantMode = "subdomain"
+	tc.Config.TenantDomain = "photos.test"
+	tc.Config.TenantHeader = "X-Tenant-ID"
+
+	const smith, jones = "http://smith.photos.test", "http://jones.photos.test"
+	createLibrary := func(base, name, dir string) *httptest.ResponseRecorder {
+		return tc.makeRequest("POST", base+"/api/v1/libraries", map[string]interface{}{
+			"name":   name,
+			"images": filepath.Join(tc.TempDir, dir),
+		})
+	}
+	decode := func(resp *httptest.ResponseRecorder, v interface{}) {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), v), resp.Body.String())
+	}
+
+	resp := createLibrary(smith, "Family", "smith_family")
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var smithLibrary TestLibrary
+	decode(resp, &smithLibrary)
+
+	resp = tc.makeMultipartRequest(smith+"/api/v1/photos/upload",
+		map[string]string{"library_id": smithLibrary.ID.String(), "tags": "beach"},
+		map[string][]byte{"photo": createTestImage()})
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var smithPhoto TestPhoto
+	decode(resp, &smithPhoto)
+
+	t.Run("Tenant Required", func(t *testing.T) {
+		resp := tc.makeRequest("GET", "/api/v1/libraries", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("GET", "http://Not_Valid.photos.test/api/v1/libraries", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		// Endpoints outside the API don't need a tenant
+		resp = tc.makeRequest("GET", "/health", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Names Unique Per Tenant", func(t *testing.T) {
+		resp := createLibrary(jones, "Family", "jones_family")
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		resp = createLibrary(smith, "Family", "smith_family_2")
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		// Directories can't be shared between tenants
+		resp = createLibrary(jones, "Borrowed", "smith_family")
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		resp = tc.makeRequest("POST", jones+"/api/v1/tags", map[string]interface{}{"name": "beach"})
+		assert.Equal(t, http.StatusCreated, resp.Code)
+	})
+
+	t.Run("Records Isolated", func(t *testing.T) {
+		resp := tc.makeRequest("GET", jones+"/api/v1/photos/"+smithPhoto.ID.String(), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeRequest("GET", jones+"/api/v1/photos/"+smithPhoto.ID.String()+"/file", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeRequest("GET", jones+"/api/v1/libraries/"+smithLibrary.ID.String(), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		var libraries []TestLibrary
+		resp = tc.makeRequest("GET", jones+"/api/v1/libraries", nil)
+		decode(resp, &libraries)
+		require.Len(t, libraries, 1)
+		assert.NotEqual(t, smithLibrary.ID, libraries[0].ID)
+
+		var tags []TestTag
+		resp = tc.makeRequest("GET", smith+"/api/v1/tags", nil)
+		decode(resp, &tags)
+		require.Len(t, tags, 1)
+		assert.Equal(t, "beach", tags[0].Name)
+
+		// Another tenant can't detach the tag
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("%s/api/v1/tags/%s/photos/%s", jones, tags[0].ID, smithPhoto.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeRequest("GET", smith+"/api/v1/photos/"+smithPhoto.ID.String(), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Jobs Isolated", func(t *testing.T) {
+		var libraries []TestLibrary
+		decode(tc.makeRequest("GET", jones+"/api/v1/libraries", nil), &libraries)
+		require.Len(t, libraries, 1)
+
+		resp := tc.makeRequest("POST", jones+"/api/v1/photos/bulk-copy", map[string]interface{}{
+			"photo_ids":  []uuid.UUID{smithPhoto.ID},
+			"library_id": libraries[0].ID,
+		})
+		require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+		var accepted map[string]interface{}
+		decode(resp, &accepted)
+		jobPath := "/api/v1/jobs/" + accepted["id"].(string)
+
+		var job map[string]interface{}
+		deadline := time.Now().Add(5 * time.Second)
+		for job["status"] != "completed" && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			decode(tc.makeRequest("GET", jones+jobPath, nil), &job)
+		}
+		require.Equal(t, "completed", job["status"])
+		result := job["results"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "Source photo not found", result["error"])
+
+		resp = tc.makeRequest("GET", smith+jobPath, nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Header Mode", func(t *testing.T) {
+		tc.Config.TenantMode = "header"
+		defer func() { tc.Config.TenantMode = "subdomain" }()
+
+		req, _ := http.NewRequest("GET", "/api/v1/photos/"+smithPhoto.ID.String(), nil)
+		req.Header.Set("X-Tenant-ID", "smith")
+		resp := httptest.NewRecorder()
+		tc.Router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		resp = tc.makeRequest("GET", smith+"/api/v1/photos/"+smithPhoto.ID.String(), nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
+
+// TestStorageCapacity tests storage usage reporting and capacity alerts
+func TestStorageCapacity(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	library := tc.createTestLibrary("Capacity Library", "For capacity tests")
+	photo := tc.uploadTestPhoto(library.ID, "capacity.jpg", nil, "")
+
+	t.Run("Usage", func(t *testing.T) {
+		tc.Config.StorageUsageLimit = 4 * photo.FileSize
+		defer func() { tc.Config.StorageUsageLimit = 0 }()
+
+		resp := tc.makeRequest("GET", "/api/v1/storage/usage", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var usage struct {
+			PhotoBytes   int64   `json:"photo_bytes"`
+			UsageLimit   int64   `json:"usage_limit"`
+			UsagePercent float64 `json:"usage_percent"`
+			Volumes      []struct {
+				Paths      []string `json:"paths"`
+				TotalBytes int64    `json:"total_bytes"`
+			} `json:"volumes"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &usage))
+		assert.Equal(t, photo.FileSize, usage.PhotoBytes)
+		assert.Equal(t, 4*photo.FileSize, usage.UsageLimit)
+		assert.Equal(t, 25.0, usage.UsagePercent)
+		if len(usage.Volumes) > 0 { // Not every platform reports free space
+			assert.Contains(t, usage.Volumes[0].Paths, library.Images)
+			assert.Greater(t, usage.Volumes[0].TotalBytes, int64(0))
+		}
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s/stats", library.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		if len(usage.Volumes) > 0 {
+			assert.Contains(t, resp.Body.String(), `"volume":`)
+		}
+	})
+
+	t.Run("Alerts", func(t *testing.T) {
+		var mu sync.Mutex
+		var received []map[string]interface{}
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var alert map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&alert)
+			mu.Lock()
+			received = append(received, alert)
+			mu.Unlock()
+		}))
+		defer webhook.Close()
+
+		tc.Config.AlertWebhookURL = webhook.URL
+		tc.Config.StorageAlertThresholds = []int{50, 90}
+		tc.Config.StorageUsageLimit = 10 * photo.FileSize
+		defer func() { tc.Config.AlertWebhookURL, tc.Config.StorageUsageLimit = "", 0 }()
+
+		usageAlerts := func() []map[string]interface{} {
+			var found []map[string]interface{}
+			for _, alert := range tc.Storage.CheckCapacity(context.Background()) {
+				if alert.Event == "storage_usage" {
+					found = append(found, alert.Details)
+				}
+			}
+			return found
+		}
+
+		// 10% of the limit is below every threshold
+		assert.Empty(t, usageAlerts())
+
+		// Crossing thresholds alerts once per threshold
+		tc.Config.StorageUsageLimit = photo.FileSize + photo.FileSize/2
+		fired := usageAlerts()
+		require.Len(t, fired, 1)
+		assert.Equal(t, 50, fired[0]["threshold"])
+		assert.Empty(t, usageAlerts())
+
+		tc.Config.StorageUsageLimit = photo.FileSize
+		fired = usageAlerts()
+		require.Len(t, fired, 1)
+		assert.Equal(t, 90, fired[0]["threshold"])
+
+		// Dropping below re-arms the thresholds
+		tc.Config.StorageUsageLimit = 10 * photo.FileSize
+		assert.Empty(t, usageAlerts())
+		tc.Config.StorageUsageLimit = photo.FileSize
+		assert.Len(t, usageAlerts(), 1)
+
+		mu.Lock()
+		defer mu.Unlock()
+		var webhookUsage int
+		for _, alert := range received {
+			if alert["event"] == "storage_usage" {
+				webhookUsage++
+			}
+		}
+		assert.Equal(t, 3, webhookUsage)
+	})
+}
+
+// TestRequestLimits tests request timeouts and concurrency limits
+func TestRequestLimits(t *testing.T) {
+	t.Run("Concurrency Limit", func(t *testing.T) {
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		router := gin.New()
+		router.POST("/upload", middleware.ConcurrencyLimitMiddleware(1), func(c *gin.Context) {
+			entered <- struct{}{}
+			<-release
+			c.JSON(http.StatusCreated, gin.H{"status": "stored"})
+		})
+
+		first := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			router.ServeHTTP(first, httptest.NewRequest("POST", "/upload", nil))
+			close(done)
+		}()
+		<-entered
+
+		busy := httptest.NewRecorder()
+		router.ServeHTTP(busy, httptest.NewRequest("POST", "/upload", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, busy.Code)
+		assert.Equal(t, "1", busy.Header().Get("Retry-After"))
+
+		close(release)
+		<-done
+		assert.Equal(t, http.StatusCreated, first.Code)
+
+		// The slot is free again
+		go func() { <-entered }()
+		again := httptest.NewRecorder()
+		router.ServeHTTP(again, httptest.NewRequest("POST", "/upload", nil))
+		assert.Equal(t, http.StatusCreated, again.Code)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		router := gin.New()
+		router.Use(middleware.TimeoutMiddleware(50 * time.Millisecond))
+		router.GET("/slow", func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photos"})
+		})
+		router.GET("/fast", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		})
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/slow")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "Request timed out", body["error"])
+
+		resp, err = http.Get(server.URL + "/fast")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// Connections are reused after a request's read deadline
+		time.Sleep(100 * time.Millisecond)
+		resp, err = http.Get(server.URL + "/fast")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+// TestAPIKeys tests API key management, scopes and required keys
+func TestAPIKeys(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	library := tc.createTestLibrary("Key Library", "For API key tests")
+	photo := tc.uploadTestPhoto(library.ID, "keyed.jpg", nil, "")
+
+	request := func(method, url, key string, body interface{}) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		req := httptest.NewRequest(method, url, reader)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(apikeys.Header, key)
+		}
+		w := httptest.NewRecorder()
+		tc.Router.ServeHTTP(w, req)
+		return w
+	}
+	upload := func(key string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		writer := multipart.NewWriter(&b)
+		writer.WriteField("library_id", library.ID.String())
+		part, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition": {`form-data; name="photo"; filename="scripted.jpg"`},
+			"Content-Type":        {"image/jpeg"},
+		})
+		part.Write(createTestImage())
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/v1/photos/upload", &b)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set(apikeys.Header, key)
+		w := httptest.NewRecorder()
+		tc.Router.ServeHTTP(w, req)
+		return w
+	}
+	createKey := func(name, scope string) (uuid.UUID, string) {
+		resp := tc.makeRequest("POST", "/api/v1/apikeys", map[string]interface{}{"name": name, "scope": scope})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var created struct {
+			ID  uuid.UUID `json:"id"`
+			Key string    `json:"key"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		require.True(t, strings.HasPrefix(created.Key, apikeys.KeyPrefix))
+		return created.ID, created.Key
+	}
+
+	_, readKey := createKey("Dashboard", apikeys.ScopeRead)
+	_, uploadKey := createKey("Import script", apikeys.ScopeUpload)
+	fullID, fullKey := createKey("Admin script", apikeys.ScopeFull)
+
+	t.Run("Manage Keys", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/apikeys", map[string]interface{}{"name": "Bad", "scope": "admin"})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("GET", "/api/v1/apikeys", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.NotContains(t, resp.Body.String(), readKey)
+		assert.NotContains(t, resp.Body.String(), apikeys.Hash(readKey))
+		var keys []struct {
+			Name   string `json:"name"`
+			Scope  string `json:"scope"`
+			Prefix string `json:"prefix"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &keys))
+		require.Len(t, keys, 3)
+		assert.Equal(t, "Dashboard", keys[0].Name)
+		assert.Equal(t, apikeys.ScopeRead, keys[0].Scope)
+		assert.Equal(t, apikeys.Prefix(readKey), keys[0].Prefix)
+	})
+
+	t.Run("Scopes", func(t *testing.T) {
+		resp := request("GET", "/api/v1/photos", readKey, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = request("POST", "/api/v1/albums", readKey, map[string]interface{}{"name": "No", "library_id": library.ID})
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.Equal(t, http.StatusForbidden, upload(readKey).Code)
+		resp = request("GET", "/api/v1/apikeys", readKey, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		assert.Equal(t, http.StatusCreated, upload(uploadKey).Code)
+		resp = request("DELETE", "/api/v1/photos/"+photo.ID.String(), uploadKey, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		resp = request("POST", "/api/v1/albums", fullKey, map[string]interface{}{"name": "Yes", "library_id": library.ID})
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		resp = request("GET", "/api/v1/photos", "plk_not-a-key", nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+		var used models.APIKey
+		require.NoError(t, tc.DB.GetDB().First(&used, fullID).Error)
+		assert.NotNil(t, used.LastUsedAt)
+	})
+
+	t.Run("Batch Sub-Requests Keep Scope", func(t *testing.T) {
+		for _, atomic := range []bool{false, true} {
+			resp := request("POST", "/api/v1/batch", readKey, map[string]interface{}{
+				"atomic": atomic,
+				"requests": []map[string]interface{}{
+					{"method": "GET", "path": "/api/v1/photos/" + photo.ID.String()},
+					{"method": "POST", "path": "/api/v1/albums", "body": map[string]interface{}{"name": "Batched", "library_id": library.ID}},
+				},
+			})
+			require.Equal(t, http.StatusOK, resp.Code)
+			var batch struct {
+				Results []struct {
+					Status int `json:"status"`
+				} `json:"results"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &batch))
+			require.Len(t, batch.Results, 2, "atomic %v", atomic)
+			assert.Equal(t, http.StatusOK, batch.Results[0].Status, "atomic %v", atomic)
+			assert.Equal(t, http.StatusForbidden, batch.Results[1].Status, "atomic %v", atomic)
+		}
+	})
+
+	t.Run("Keys Required", func(t *testing.T) {
+		tc.Config.RequireAPIKey = true
+		tc.Config.AdminAPIKey = "admin-secret"
+		defer func() {
+			tc.Config.RequireAPIKey = false
+			tc.Config.AdminAPIKey = ""
+		}()
+
+		resp := tc.makeRequest("GET", "/api/v1/photos", nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		resp = request("GET", "/api/v1/photos", readKey, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		// Signed file URLs work without a key, unsigned ones don't
+		resp = tc.makeRequest("GET", photo.FileURL, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("GET", "/api/v1/photos/"+photo.ID.String()+"/file", nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		resp = tc.makeRequest("GET", "/api/v1/photos/"+photo.ID.String()+"?signature=forged", nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+		// The admin key can manage keys for a fresh deployment
+		resp = request("GET", "/api/v1/apikeys", "admin-secret", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		// Revoked keys stop working
+		resp = request("DELETE", "/api/v1/apikeys/"+fullID.String(), "admin-secret", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = request("GET", "/api/v1/photos", fullKey, nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		resp = request("DELETE", "/api/v1/apikeys/"+fullID.String(), "admin-secret", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
+
+func TestDatabaseBackups(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	library := tc.createTestLibrary("Backed Up Library", "")
+	photo := tc.uploadTestPhoto(library.ID, "backed-up.jpg", nil, "")
+
+	var backup struct {
+		Name        string `json:"name"`
+		Size        int64  `json:"size"`
+		Manifest    bool   `json:"manifest"`
+		DownloadURL string `json:"download_url"`
+		ManifestURL string `json:"manifest_url"`
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/admin/backup", map[string]interface{}{"include_manifest": true})
+		require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+		var job struct {
+			ID string `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &job))
+
+		final := tc.waitForJob(job.ID)
+		require.Equal(t, "completed", final["status"], final["error"])
+		results := final["results"].([]interface{})
+		require.Len(t, results, 1)
+		data, _ := json.Marshal(results[0])
+		require.NoError(t, json.Unmarshal(data, &backup))
+		assert.Regexp(t, `^backup-\d{8}T\d{6}\.\d{3}Z$`, backup.Name)
+		assert.Positive(t, backup.Size)
+		assert.True(t, backup.Manifest)
+
+		// Without a body there is no manifest
+		resp = tc.makeRequest("POST", "/api/v1/admin/backup", nil)
+		require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &job))
+		require.Equal(t, "completed", tc.waitForJob(job.ID)["status"])
+	})
+
+	t.Run("List and Download", func(t *testing.T) {
+		resp := tc.makeRequest("GET", "/api/v1/admin/backups", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var backups []struct {
+			Name     string `json:"name"`
+			Manifest bool   `json:"manifest"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &backups))
+		require.Len(t, backups, 2)
+		assert.Equal(t, backup.Name, backups[1].Name, "newest first")
+		assert.False(t, backups[0].Manifest)
+
+		resp = tc.makeRequest("GET", backup.DownloadURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.True(t, strings.HasPrefix(resp.Body.String(), "SQLite format 3\x00"))
+		assert.Contains(t, resp.Header().Get("Content-Disposition"), backup.Name+".db")
+
+		resp = tc.makeRequest("GET", backup.ManifestURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var manifest struct {
+			Backup string `json:"backup"`
+			Photos []struct {
+				ID       uuid.UUID `json:"id"`
+				FilePath string    `json:"file_path"`
+				Checksum string    `json:"checksum"`
+			} `json:"photos"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &manifest), resp.Body.String())
+		assert.Equal(t, backup.Name+".db", manifest.Backup)
+		require.Len(t, manifest.Photos, 1)
+		assert.Equal(t, photo.ID, manifest.Photos[0].ID)
+		assert.Equal(t, photo.FilePath, manifest.Photos[0].FilePath)
+		assert.NotEmpty(t, manifest.Photos[0].Checksum)
+
+		resp = tc.makeRequest("GET", "/api/v1/admin/backups/"+backups[0].Name+"/manifest", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("GET", "/api/v1/admin/backups/backup-20200101T000000.000Z", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("GET", "/api/v1/admin/backups/photo_library", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Access", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/apikeys", map[string]interface{}{"name": "Viewer", "scope": "read"})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var created struct {
+			Key string `json:"key"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+
+		get := func(url, key, tenant string) int {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Header.Set(apikeys.Header, key)
+			if tenant != "" {
+				req.Header.Set("X-Tenant-ID", tenant)
+			}
+			w := httptest.NewRecorder()
+			tc.Router.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		// Read keys can't take a copy of everything
+		assert.Equal(t, http.StatusForbidden, get("/api/v1/admin/backups", created.Key, ""))
+		assert.Equal(t, http.StatusForbidden, get(backup.DownloadURL, created.Key, ""))
+
+		// Backups hold every tenant, so tenants' own keys can't reach them
+		tc.Config.TenantMode = middleware.TenantModeHeader
+		tc.Config.TenantHeader = "X-Tenant-ID"
+		tc.Config.AdminAPIKey = "admin-secret"
+		defer func() {
+			tc.Config.TenantMode = ""
+			tc.Config.AdminAPIKey = ""
+		}()
+		resp = tc.makeRequest("POST", "/api/v1/apikeys", map[string]interface{}{"name": "Tenant", "scope": "full"})
+		require.Equal(t, http.StatusBadRequest, resp.Code, "tenant required")
+		req := httptest.NewRequest("POST", "/api/v1/apikeys", strings.NewReader(`{"name": "Tenant", "scope": "full"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Tenant-ID", "smith")
+		w := httptest.NewRecorder()
+		tc.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+		assert.Equal(t, http.StatusForbidden, get("/api/v1/admin/backups", created.Key, "smith"))
+		assert.Equal(t, http.StatusOK, get("/api/v1/admin/backups", "admin-secret", "smith"))
+	})
+}
+
+func TestFaceDetection(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	type person struct {
+		ID        uuid.UUID `json:"id"`
+		Name      string    `json:"name"`
+		FaceCount int64     `json:"face_count"`
+	}
+	type face struct {
+		ID       uuid.UUID  `json:"id"`
+		PhotoID  uuid.UUID  `json:"photo_id"`
+		PersonID *uuid.UUID `json:"person_id"`
+		Person   *person    `json:"person"`
+		Width    float64    `json:"width"`
+	}
+	getPerson := func(id uuid.UUID) person {
+		resp := tc.makeRequest("GET", "/api/v1/people/"+id.String(), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var found person
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &found))
+		return found
+	}
+	listPeople := func(query string) []person {
+		resp := tc.makeRequest("GET", "/api/v1/people?"+query, nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var page struct {
+			People []person `json:"people"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		return page.People
+	}
+	photoFaces := func(photoID uuid.UUID) []face {
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/faces", photoID), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var found []face
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &found))
+		return found
+	}
+	personPhotos := func(personID uuid.UUID) int64 {
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/people/%s/photos", personID), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var page struct {
+			Pagination struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		return page.Pagination.Total
+	}
+
+	library := tc.createTestLibrary("Faces Library", "For face detection testing")
+	portrait := tc.uploadTestPhoto(library.ID, "portrait.jpg", nil, "")
+	resp := tc.uploadTestFile(library.ID, "group.jpg", "image/jpeg", createTestImageOfSize(64, 64))
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var group TestPhoto
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &group))
+
+	// The job clusters the face in both photos into one person, and the
+	// other face in the group into a second; unlikely faces are dropped
+	resp = tc.makeRequest("POST", "/api/v1/photos/detect-faces", nil)
+	require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+	var accepted map[string]interface{}
+	json.Unmarshal(resp.Body.Bytes(), &accepted)
+	job := tc.waitForJob(accepted["id"].(string))
+	require.Equal(t, "completed", job["status"])
+
+	people := listPeople("")
+	require.Len(t, people, 2)
+	alice, bob := people[0], people[1]
+	assert.Equal(t, int64(2), alice.FaceCount)
+	assert.Equal(t, int64(1), bob.FaceCount)
+	assert.Empty(t, alice.Name)
+
+	groupFaces := photoFaces(group.ID)
+	require.Len(t, groupFaces, 2)
+	assert.Equal(t, 0.3, groupFaces[0].Width, "largest face first")
+	require.NotNil(t, groupFaces[0].Person)
+	assert.Equal(t, alice.ID, groupFaces[0].Person.ID)
+	assert.Equal(t, bob.ID, *groupFaces[1].PersonID)
+	require.Len(t, photoFaces(portrait.ID), 1)
+	assert.Equal(t, alice.ID, *photoFaces(portrait.ID)[0].PersonID)
+
+	// Naming clusters, with names unique
+	resp = tc.makeRequest("PUT", "/api/v1/people/"+alice.ID.String(), map[string]string{"name": " Alice "})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "Alice", getPerson(alice.ID).Name)
+	resp = tc.makeRequest("PUT", "/api/v1/people/"+bob.ID.String(), map[string]string{"name": "Alice"})
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Contains(t, resp.Body.String(), "duplicate_person")
+	assert.Len(t, listPeople("named=true"), 1)
+	assert.Len(t, listPeople("named=false"), 1)
+	assert.Len(t, listPeople("name=ali"), 1)
+
+	assert.Equal(t, int64(2), personPhotos(alice.ID))
+	assert.Equal(t, int64(1), personPhotos(bob.ID))
+
+	// New uploads join the people they look like
+	tc.Config.DetectFacesOnUpload = true
+	defer func() { tc.Config.DetectFacesOnUpload = false }()
+	later := tc.uploadTestPhoto(library.ID, "later.jpg", nil, "")
+	require.Eventually(t, func() bool {
+		return len(photoFaces(later.ID)) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, alice.ID, *photoFaces(later.ID)[0].PersonID)
+	assert.Equal(t, int64(3), getPerson(alice.ID).FaceCount)
+
+	// Faces can be moved between people, and clusters merged
+	resp = tc.makeRequest("PUT", "/api/v1/faces/"+groupFaces[1].ID.String(), map[string]interface{}{"person_id": nil})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, int64(0), getPerson(bob.ID).FaceCount)
+	resp = tc.makeRequest("PUT", "/api/v1/faces/"+groupFaces[1].ID.String(), map[string]interface{}{"person_id": bob.ID})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, int64(1), getPerson(bob.ID).FaceCount)
+
+	resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/people/%s/merge", alice.ID), map[string]interface{}{
+		"person_ids": []uuid.UUID{bob.ID},
+	})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, int64(4), getPerson(alice.ID).FaceCount)
+	assert.Equal(t, http.StatusNotFound, tc.makeRequest("GET", "/api/v1/people/"+bob.ID.String(), nil).Code)
+
+	// Trashed photos don't count
+	resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", later.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, int64(3), getPerson(alice.ID).FaceCount)
+	assert.Equal(t, int64(2), personPhotos(alice.ID))
+
+	// Deleting a person keeps their faces
+	resp = tc.makeRequest("DELETE", "/api/v1/people/"+alice.ID.String(), nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, listPeople(""))
+	assert.Nil(t, photoFaces(portrait.ID)[0].PersonID)
+
+	// Errors
+	for _, check := range []struct {
+		method, url string
+		body        interface{}
+		status      int
+	}{
+		{"GET", "/api/v1/people/nope", nil, http.StatusBadRequest},
+		{"GET", "/api/v1/people/" + uuid.New().String(), nil, http.StatusNotFound},
+		{"GET", "/api/v1/people?named=maybe", nil, http.StatusBadRequest},
+		{"PUT", "/api/v1/people/" + uuid.New().String(), map[string]string{"name": "Carol"}, http.StatusNotFound},
+		{"PUT", "/api/v1/people/" + uuid.New().String(), map[string]string{}, http.StatusBadRequest},
+		{"POST", "/api/v1/people/" + alice.ID.String() + "/merge", map[string]interface{}{"person_ids": []uuid.UUID{alice.ID}}, http.StatusBadRequest},
+		{"GET", "/api/v1/people/" + uuid.New().String() + "/photos", nil, http.StatusNotFound},
+		{"PUT", "/api/v1/faces/" + uuid.New().String(), map[string]interface{}{"person_id": nil}, http.StatusNotFound},
+		{"PUT", "/api/v1/faces/" + groupFaces[0].ID.String(), map[string]interface{}{"person_id": uuid.New()}, http.StatusNotFound},
+	} {
+		resp := tc.makeRequest(check.method, check.url, check.body)
+		assert.Equal(t, check.status, resp.Code, check.method+" "+check.url)
+	}
+}
@@ -2,14 +2,21 @@ package main
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"photo-library-server/models"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // TestLibraryEndpoints tests all library-related endpoints
@@ -83,6 +90,31 @@ func TestLibraryEndpoints(t *testing.T) {
 		var response map[string]interface{}
 		json.Unmarshal(resp.Body.Bytes(), &response)
 		assert.Contains(t, response["error"], "images path already exists")
+
+		// Other spellings of the directory, and directories nested with it,
+		// are taken too
+		for i, images := range []string{
+			imagePath + string(filepath.Separator),
+			filepath.Join(imagePath, "..", "same_image_path"),
+			filepath.Join(imagePath, "nested"),
+			filepath.Dir(imagePath),
+		} {
+			resp = tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+				"name":   fmt.Sprintf("Overlapping Library %d", i),
+				"images": images,
+			})
+			assert.Equal(t, http.StatusConflict, resp.Code, images)
+		}
+
+		// Paths are stored clean
+		resp = tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name":   "Clean Path Library",
+			"images": filepath.Join(tc.TempDir, "clean_path", "x", "..") + string(filepath.Separator),
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var library TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &library)
+		assert.Equal(t, filepath.Join(tc.TempDir, "clean_path"), library.Images)
 	})
 
 	t.Run("Create Library - Validation Errors", func(t *testing.T) {
@@ -112,6 +144,30 @@ func TestLibraryEndpoints(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, resp.Code)
 	})
 
+	t.Run("Create Library - Thumbnail Mode", func(t *testing.T) {
+		library := tc.createTestLibrary("Default Thumbnails", "Lazy by default")
+		assert.Equal(t, "lazy", library.ThumbnailMode)
+
+		payload := map[string]interface{}{
+			"name":           "Invalid Thumbnails",
+			"images":         filepath.Join(tc.TempDir, "invalid_thumbnails"),
+			"thumbnail_mode": "sometimes",
+		}
+		resp := tc.makeRequest("POST", "/api/v1/libraries", payload)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "thumbnail_mode must be one of: eager, background, lazy", response["error"])
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"thumbnail_mode": "eager"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var updatedLibrary TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &updatedLibrary)
+		assert.Equal(t, "eager", updatedLibrary.ThumbnailMode)
+	})
+
 	t.Run("Get Libraries", func(t *testing.T) {
 		// Create test libraries
 		testLib1 := tc.createTestLibrary("Library 1", "First library")
@@ -200,15 +256,27 @@ func TestLibraryEndpoints(t *testing.T) {
 		newPath := filepath.Join(tc.TempDir, "new_path")
 
 		payload := map[string]interface{}{
-			"images": newPath,
+			"images":      newPath,
+			"description": "Moved",
 		}
 
 		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), payload)
-		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, http.StatusAccepted, resp.Code)
 
+		var response struct {
+			Library TestLibrary            `json:"library"`
+			Job     map[string]interface{} `json:"job"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+
+		// Other fields are saved immediately, the path once the files have moved
+		assert.Equal(t, "Moved", response.Library.Description)
+		job := tc.waitForJob(response.Job["id"].(string))
+		assert.Equal(t, "completed", job["status"])
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s", library.ID), nil)
 		var updatedLibrary TestLibrary
 		json.Unmarshal(resp.Body.Bytes(), &updatedLibrary)
-
 		assert.Equal(t, newPath, updatedLibrary.Images)
 
 		// Verify directory was created
@@ -216,6 +284,134 @@ func TestLibraryEndpoints(t *testing.T) {
 		assert.NoError(t, err, "New directory should be created")
 	})
 
+	t.Run("Update Library - Path Change Moves Files", func(t *testing.T) {
+		library := tc.createTestLibrary("Relocated Library", "Files move with the library")
+		photo := tc.uploadTestPhoto(library.ID, "relocated.jpg", nil, "")
+		untracked := filepath.Join(library.Images, "notes.txt")
+		os.WriteFile(untracked, []byte("kept"), 0644)
+
+		newPath := filepath.Join(tc.TempDir, "relocated", "library")
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"images": newPath})
+		assert.Equal(t, http.StatusAccepted, resp.Code)
+
+		var response struct {
+			Job map[string]interface{} `json:"job"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		job := tc.waitForJob(response.Job["id"].(string))
+		assert.Equal(t, "completed", job["status"])
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
+		var movedPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &movedPhoto)
+		assert.Equal(t, filepath.Join(newPath, photo.Filename), movedPhoto.FilePath)
+		assert.FileExists(t, movedPhoto.FilePath)
+		assert.FileExists(t, filepath.Join(newPath, "notes.txt"))
+		assert.NoDirExists(t, library.Images)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", photo.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Update Library - Path Change Dry Run", func(t *testing.T) {
+		library := tc.createTestLibrary("Dry Run Library", "Nothing moves")
+		photo := tc.uploadTestPhoto(library.ID, "stays.jpg", nil, "")
+		os.WriteFile(filepath.Join(library.Images, "notes.txt"), []byte("kept"), 0644)
+
+		newPath := filepath.Join(tc.TempDir, "dry-run", "library")
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s?dry_run=true", library.ID), map[string]interface{}{
+			"images":      newPath,
+			"description": "Would change",
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		var response struct {
+			DryRun     bool        `json:"dry_run"`
+			Library    TestLibrary `json:"library"`
+			Relocation struct {
+				OldPath       string `json:"old_path"`
+				NewPath       string `json:"new_path"`
+				Method        string `json:"method"`
+				Files         int    `json:"files"`
+				Bytes         int64  `json:"bytes"`
+				PhotosUpdated int    `json:"photos_updated"`
+				Fits          bool   `json:"fits"`
+			} `json:"relocation"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.True(t, response.DryRun)
+		assert.Equal(t, "Would change", response.Library.Description)
+		assert.Equal(t, library.Images, response.Relocation.OldPath)
+		assert.Equal(t, newPath, response.Relocation.NewPath)
+		assert.Equal(t, "rename", response.Relocation.Method)
+		assert.Equal(t, 2, response.Relocation.Files)
+		assert.Equal(t, photo.FileSize+4, response.Relocation.Bytes)
+		assert.Equal(t, 1, response.Relocation.PhotosUpdated)
+		assert.True(t, response.Relocation.Fits)
+
+		// Nothing was changed
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s", library.ID), nil)
+		var unchanged TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &unchanged)
+		assert.Equal(t, library.Images, unchanged.Images)
+		assert.Equal(t, library.Description, unchanged.Description)
+		assert.FileExists(t, photo.FilePath)
+		assert.NoDirExists(t, newPath)
+
+		// Dry runs are still validated
+		occupied := filepath.Join(tc.TempDir, "dry-run-occupied")
+		os.MkdirAll(occupied, 0755)
+		os.WriteFile(filepath.Join(occupied, "existing.jpg"), []byte("x"), 0644)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s?dry_run=true", library.ID), map[string]interface{}{"images": occupied})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+	})
+
+	t.Run("Update Library - Path Change To Non-Empty Directory", func(t *testing.T) {
+		library := tc.createTestLibrary("Blocked Move", "Target is occupied")
+		occupied := filepath.Join(tc.TempDir, "occupied")
+		os.MkdirAll(occupied, 0755)
+		os.WriteFile(filepath.Join(occupied, "existing.jpg"), []byte("x"), 0644)
+
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"images": occupied})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "New images directory must be empty", response["error"])
+	})
+
+	t.Run("Update Library - Nested Path Change", func(t *testing.T) {
+		library := tc.createTestLibrary("Nested Move", "Target overlaps the library")
+		photo := tc.uploadTestPhoto(library.ID, "nested.jpg", nil, "")
+
+		for _, target := range []string{
+			filepath.Join(library.Images, "new"),
+			filepath.Dir(library.Images),
+			library.Images + string(filepath.Separator),
+			filepath.Join(library.Images, "new", ".."),
+		} {
+			for _, query := range []string{"", "?dry_run=true"} {
+				resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s%s", library.ID, query), map[string]interface{}{"images": target})
+				if filepath.Clean(target) == library.Images {
+					// Same directory once cleaned, so nothing moves
+					assert.Equal(t, http.StatusOK, resp.Code, target)
+					continue
+				}
+				assert.Equal(t, http.StatusBadRequest, resp.Code, target)
+
+				var response map[string]interface{}
+				json.Unmarshal(resp.Body.Bytes(), &response)
+				assert.Equal(t, "nested_images_path", response["code"])
+			}
+		}
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s", library.ID), nil)
+		var unchanged TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &unchanged)
+		assert.Equal(t, library.Images, unchanged.Images)
+		assert.FileExists(t, photo.FilePath)
+	})
+
 	t.Run("Update Library - Conflicting Name", func(t *testing.T) {
 		tc.createTestLibrary("Library One", "First")
 		conflictLib := tc.createTestLibrary("Library Two", "Second")
@@ -262,6 +458,30 @@ func TestLibraryEndpoints(t *testing.T) {
 		assert.True(t, os.IsNotExist(err), "Library directory should be removed")
 	})
 
+	t.Run("Delete Library - Cold Photos", func(t *testing.T) {
+		tc.Config.ColdStoragePath = filepath.Join(tc.TempDir, "cold")
+		defer func() { tc.Config.ColdStoragePath = "" }()
+
+		library := tc.createTestLibrary("Cold Library", "Has photos in cold storage")
+		photo := tc.uploadTestPhoto(library.ID, "frozen.jpg", nil, "")
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s/storage-tier", photo.ID), map[string]interface{}{"storage_tier": "cold"})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var coldPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &coldPhoto)
+		require.FileExists(t, coldPhoto.FilePath)
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/libraries/%s", library.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.NotContains(t, response, "warning")
+		assert.NoDirExists(t, library.Images)
+		assert.NoFileExists(t, coldPhoto.FilePath)
+		assert.NoDirExists(t, filepath.Join(tc.Config.ColdStoragePath, library.ID.String()))
+		assert.DirExists(t, tc.Config.ColdStoragePath)
+	})
+
 	t.Run("Delete Library - Not Found", func(t *testing.T) {
 		nonExistentID := uuid.New()
 		resp := tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/libraries/%s", nonExistentID), nil)
@@ -285,6 +505,664 @@ func TestLibraryEndpoints(t *testing.T) {
 		assert.Equal(t, float64(0), stats["total_size_bytes"])
 	})
 
+	t.Run("Rescan Library", func(t *testing.T) {
+		library := tc.createTestLibrary("Rescan Library", "Files change behind our back")
+		unchanged := tc.uploadTestPhoto(library.ID, "unchanged.jpg", nil, "")
+		replaced := tc.uploadTestPhoto(library.ID, "replaced.jpg", nil, "")
+		removed := tc.uploadTestPhoto(library.ID, "removed.jpg", nil, "")
+		assert.Len(t, replaced.Checksum, 64, "Uploads record a SHA-256 checksum")
+
+		os.WriteFile(replaced.FilePath, createTestImageOfSize(40, 30), 0644)
+		os.Remove(removed.FilePath)
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/rescan", library.ID), nil)
+		assert.Equal(t, http.StatusAccepted, resp.Code)
+
+		var job map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &job)
+		job = tc.waitForJob(job["id"].(string))
+		assert.Equal(t, "completed", job["status"])
+
+		statuses := map[string]string{}
+		for _, r := range job["results"].([]interface{}) {
+			result := r.(map[string]interface{})
+			statuses[result["photo_id"].(string)] = result["status"].(string)
+		}
+		assert.Equal(t, "unchanged", statuses[unchanged.ID.String()])
+		assert.Equal(t, "updated", statuses[replaced.ID.String()])
+		assert.Equal(t, "missing", statuses[removed.ID.String()])
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", replaced.ID), nil)
+		var updatedPhoto map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &updatedPhoto)
+		assert.Equal(t, float64(40), updatedPhoto["width"])
+		assert.Equal(t, float64(30), updatedPhoto["height"])
+		assert.Equal(t, float64(len(createTestImageOfSize(40, 30))), updatedPhoto["file_size"])
+		assert.NotEqual(t, replaced.Checksum, updatedPhoto["checksum"])
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&missing=true", library.ID), nil)
+		var listResponse struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listResponse)
+		require.Len(t, listResponse.Photos, 1)
+		assert.Equal(t, removed.ID, listResponse.Photos[0].ID)
+
+		// A file that comes back is no longer flagged
+		os.WriteFile(removed.FilePath, createTestImage(), 0644)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/rescan", library.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &job)
+		tc.waitForJob(job["id"].(string))
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", removed.ID), nil)
+		var restoredPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &restoredPhoto)
+		assert.False(t, restoredPhoto.Missing)
+	})
+
+	t.Run("Scan Library", func(t *testing.T) {
+		library := tc.createTestLibrary("Scan Library", "Photos copied in by hand")
+		uploaded := tc.uploadTestPhoto(library.ID, "uploaded.jpg", nil, "")
+
+		takenAt := time.Date(2019, 7, 4, 18, 30, 0, 0, time.UTC)
+		require.NoError(t, os.MkdirAll(filepath.Join(library.Images, "2019", "july"), 0755))
+		os.WriteFile(filepath.Join(library.Images, "loose.jpg"), createTestImageOfSize(40, 30), 0644)
+		os.WriteFile(filepath.Join(library.Images, "2019", "july", "fireworks.jpg"), createTestImageTakenAt(takenAt), 0644)
+		os.WriteFile(filepath.Join(library.Images, "2019", "july", "fireworks.xmp"), []byte("<x:xmpmeta/>"), 0644)
+		os.WriteFile(filepath.Join(library.Images, "notes.txt"), []byte("not a photo"), 0644)
+		os.WriteFile(filepath.Join(library.Images, ".hidden.jpg"), createTestImage(), 0644)
+
+		scan := func() map[string]interface{} {
+			resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/scan", library.ID), nil)
+			require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+			var job map[string]interface{}
+			json.Unmarshal(resp.Body.Bytes(), &job)
+			job = tc.waitForJob(job["id"].(string))
+			require.Equal(t, "completed", job["status"])
+			results := job["results"].([]interface{})
+			require.Len(t, results, 1)
+			return results[0].(map[string]interface{})
+		}
+
+		summary := scan()
+		assert.Equal(t, float64(4), summary["files"])
+		assert.Equal(t, float64(2), summary["imported"])
+		assert.Equal(t, float64(1), summary["skipped"])
+		assert.Equal(t, float64(1), summary["unsupported"])
+		assert.Empty(t, summary["failed"])
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&limit=10", library.ID), nil)
+		var listResponse struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listResponse)
+		require.Len(t, listResponse.Photos, 3)
+
+		byName := map[string]TestPhoto{}
+		for _, photo := range listResponse.Photos {
+			byName[photo.OriginalName] = photo
+		}
+		assert.Equal(t, uploaded.ID, byName[uploaded.OriginalName].ID)
+		loose := byName["loose.jpg"]
+		assert.Equal(t, "image/jpeg", loose.MimeType)
+		assert.Equal(t, 40, loose.Width)
+		assert.Len(t, loose.Checksum, 64)
+		fireworks := byName["fireworks.jpg"]
+		assert.Equal(t, filepath.Join(library.Images, "2019", "july", "fireworks.jpg"), fireworks.FilePath)
+		require.NotNil(t, fireworks.TakenAt)
+		assert.True(t, takenAt.Equal(*fireworks.TakenAt))
+
+		// Imported files are served in place
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", fireworks.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, createTestImageTakenAt(takenAt), resp.Body.Bytes())
+
+		// Scanning again finds nothing new, trashed photos included
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", loose.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		summary = scan()
+		assert.Equal(t, float64(0), summary["imported"])
+		assert.Equal(t, float64(3), summary["skipped"])
+	})
+
+	t.Run("Import Apple Photos Export", func(t *testing.T) {
+		library := tc.createTestLibrary("Apple Import", "Moved over from a Mac")
+		export := filepath.Join(tc.TempDir, "apple_export")
+		sidecar := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="5">
+<dc:subject><rdf:Bag><rdf:li>sea</rdf:li><rdf:li>sand</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+
+		// A Photos app export of an album folder, loose files and an iCloud download
+		for dir, files := range map[string]map[string][]byte{
+			"Summer": {
+				"beach.jpg": createTestImageOfSize(40, 30),
+				"beach.xmp": []byte(sidecar),
+				"beach.aae": []byte("<plist/>"),
+			},
+			".": {
+				"loose.jpg": createTestImageOfSize(41, 30),
+				"notes.txt": []byte("not a photo"),
+			},
+			"Photos": {
+				"IMG_0001.jpg":      createTestImageOfSize(42, 30),
+				"Photo Details.csv": []byte("imgName,fileChecksum,favorite,hidden\nIMG_0001.jpg,abc,yes,no\nloose.jpg,def,no,no\n"),
+			},
+			"Albums": {
+				"Trip.csv": []byte("Images\nIMG_0001.jpg\nloose.jpg\n"),
+			},
+		} {
+			require.NoError(t, os.MkdirAll(filepath.Join(export, dir), 0755))
+			for name, data := range files {
+				require.NoError(t, os.WriteFile(filepath.Join(export, dir, name), data, 0644))
+			}
+		}
+
+		importExport := func() map[string]interface{} {
+			resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/import/apple", library.ID), map[string]string{"path": export})
+			require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+			var job map[string]interface{}
+			json.Unmarshal(resp.Body.Bytes(), &job)
+			assert.Equal(t, "apple_photos_import", job["type"])
+			job = tc.waitForJob(job["id"].(string))
+			require.Equal(t, "completed", job["status"])
+			results := job["results"].([]interface{})
+			require.Len(t, results, 1)
+			return results[0].(map[string]interface{})
+		}
+
+		summary := importExport()
+		assert.Equal(t, float64(4), summary["files"])
+		assert.Equal(t, float64(3), summary["imported"])
+		assert.Equal(t, float64(0), summary["existing"])
+		assert.Equal(t, float64(1), summary["unsupported"])
+		assert.Equal(t, float64(2), summary["albums_created"])
+		assert.Empty(t, summary["failed"])
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&limit=10", library.ID), nil)
+		var listResponse struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listResponse)
+		require.Len(t, listResponse.Photos, 3)
+		byName := map[string]TestPhoto{}
+		for _, photo := range listResponse.Photos {
+			byName[photo.OriginalName] = photo
+			assert.True(t, strings.HasPrefix(photo.FilePath, library.Images), "copied into the library")
+		}
+
+		// Sidecar keywords become tags, its rating is kept and marks a favorite
+		beach := byName["beach.jpg"]
+		require.NotNil(t, beach.Rating)
+		assert.Equal(t, 5, *beach.Rating)
+		assert.True(t, beach.Favorite)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s?include_tags=true", beach.ID), nil)
+		var withTags struct {
+			Tags []TestTag `json:"tags"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &withTags))
+		tagNames := []string{}
+		for _, tag := range withTags.Tags {
+			tagNames = append(tagNames, tag.Name)
+		}
+		assert.ElementsMatch(t, []string{"sea", "sand"}, tagNames)
+
+		// iCloud's details CSV marks favorites
+		assert.True(t, byName["IMG_0001.jpg"].Favorite)
+		assert.False(t, byName["loose.jpg"].Favorite)
+		assert.Nil(t, byName["loose.jpg"].Rating)
+
+		albumPhotos := func() map[string][]uuid.UUID {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums?library_id=%s", library.ID), nil)
+			var albums []TestAlbum
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &albums))
+			members := map[string][]uuid.UUID{}
+			for _, album := range albums {
+				resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+				var page struct {
+					Photos []TestPhoto `json:"photos"`
+				}
+				require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+				for _, photo := range page.Photos {
+					members[album.Name] = append(members[album.Name], photo.ID)
+				}
+			}
+			return members
+		}
+		members := albumPhotos()
+		require.Len(t, members, 2)
+		assert.Equal(t, []uuid.UUID{beach.ID}, members["Summer"])
+		assert.ElementsMatch(t, []uuid.UUID{byName["IMG_0001.jpg"].ID, byName["loose.jpg"].ID}, members["Trip"])
+
+		// Importing again finds everything already there
+		summary = importExport()
+		assert.Equal(t, float64(0), summary["imported"])
+		assert.Equal(t, float64(3), summary["existing"])
+		assert.Equal(t, float64(0), summary["albums_created"])
+		assert.Equal(t, members, albumPhotos())
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/import/apple", library.ID), map[string]string{"path": filepath.Join(export, "missing")})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "import_path_not_found")
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/import/apple", library.ID), map[string]string{"path": library.Images})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "import_path_in_library")
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/import/apple", library.ID), map[string]string{})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/import/apple", uuid.New()), map[string]string{"path": export})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Watch Library", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name": "Watched Library", "images": filepath.Join(tc.TempDir, "watched"), "watch": true,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var library TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &library)
+		unwatched := tc.createTestLibrary("Unwatched Library", "")
+
+		stop := tc.Watcher.Start()
+		defer stop()
+
+		listPhotos := func(libraryID uuid.UUID) []TestPhoto {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s", libraryID), nil)
+			var listResponse struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &listResponse)
+			return listResponse.Photos
+		}
+
+		// Dropped files are imported once they settle, wherever they land
+		require.NoError(t, os.MkdirAll(filepath.Join(library.Images, "inbox"), 0755))
+		time.Sleep(50 * time.Millisecond) // Let the new directory be watched
+		os.WriteFile(filepath.Join(library.Images, "inbox", "dropped.jpg"), createTestImage(), 0644)
+		os.WriteFile(filepath.Join(library.Images, "readme.txt"), []byte("not a photo"), 0644)
+		os.WriteFile(filepath.Join(unwatched.Images, "ignored.jpg"), createTestImage(), 0644)
+
+		require.Eventually(t, func() bool { return len(listPhotos(library.ID)) == 1 }, 3*time.Second, 50*time.Millisecond)
+		dropped := listPhotos(library.ID)[0]
+		assert.Equal(t, "dropped.jpg", dropped.OriginalName)
+		assert.Equal(t, filepath.Join(library.Images, "inbox", "dropped.jpg"), dropped.FilePath)
+
+		// Uploads aren't imported a second time
+		tc.uploadTestPhoto(library.ID, "uploaded.jpg", nil, "")
+		time.Sleep(200 * time.Millisecond)
+		assert.Len(t, listPhotos(library.ID), 2)
+		assert.Empty(t, listPhotos(unwatched.ID))
+
+		// Turning watch off takes effect on the next sync
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"watch": false})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		require.NoError(t, tc.Watcher.Sync())
+		os.WriteFile(filepath.Join(library.Images, "late.jpg"), createTestImage(), 0644)
+		time.Sleep(200 * time.Millisecond)
+		assert.Len(t, listPhotos(library.ID), 2)
+	})
+
+	t.Run("Watch Library - Encrypted", func(t *testing.T) {
+		tc.Config.EncryptionSecret = "test-encryption-secret"
+		defer func() { tc.Config.EncryptionSecret = "" }()
+
+		resp := tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name": "Watched Vault", "images": filepath.Join(tc.TempDir, "watched-vault"), "watch": true, "encrypted": true,
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Read-Only Library", func(t *testing.T) {
+		archive := tc.createTestLibrary("Archive 2019", "")
+		photo := tc.uploadTestPhoto(archive.ID, "archived.jpg", nil, "")
+		other := tc.createTestLibrary("Current Year", "")
+		incoming := tc.uploadTestPhoto(other.ID, "incoming.jpg", nil, "")
+		tag := tc.createTestTag("archived-tag", "")
+
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", archive.ID), map[string]interface{}{"read_only": true})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var updated map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &updated)
+		assert.Equal(t, true, updated["read_only"])
+
+		photoURL := fmt.Sprintf("/api/v1/photos/%s", photo.ID)
+		rejected := map[string]*httptest.ResponseRecorder{
+			"upload":         tc.uploadTestFile(archive.ID, "new.jpg", "image/jpeg", createTestImage()),
+			"update":         tc.makeRequest("PUT", photoURL, map[string]interface{}{"title": "Changed"}),
+			"favorite":       tc.makeRequest("POST", photoURL+"/favorite", nil),
+			"metadata":       tc.makeRequest("PUT", photoURL+"/metadata", map[string]interface{}{"metadata": map[string]string{"camera": "x"}}),
+			"tag":            tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/photos", tag.ID), map[string]interface{}{"photo_id": photo.ID}),
+			"rotate":         tc.makeRequest("POST", photoURL+"/rotate", map[string]interface{}{"degrees": 90}),
+			"delete":         tc.makeRequest("DELETE", photoURL, nil),
+			"move out":       tc.makeRequest("POST", photoURL+"/move", map[string]interface{}{"library_id": other.ID}),
+			"copy in":        tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", incoming.ID), map[string]interface{}{"library_id": archive.ID}),
+			"move in":        tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/move", incoming.ID), map[string]interface{}{"library_id": archive.ID}),
+			"bulk copy in":   tc.makeRequest("POST", "/api/v1/photos/bulk-copy", map[string]interface{}{"photo_ids": []uuid.UUID{incoming.ID}, "library_id": archive.ID}),
+			"scan":           tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/scan", archive.ID), nil),
+			"delete library": tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/libraries/%s", archive.ID), nil),
+		}
+		for name, resp := range rejected {
+			assert.Equal(t, http.StatusForbidden, resp.Code, "%s: %s", name, resp.Body.String())
+		}
+
+		// Batches roll back at the first read-only photo
+		resp = tc.makeRequest("POST", "/api/v1/photos/batch", map[string]interface{}{
+			"photo_ids": []uuid.UUID{incoming.ID, photo.ID}, "operation": "set_rating", "rating": 4,
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var batch struct {
+			Committed bool `json:"committed"`
+			Results   []struct {
+				Status string `json:"status"`
+				Error  string `json:"error"`
+			} `json:"results"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &batch)
+		assert.False(t, batch.Committed)
+		assert.Equal(t, "Library is read-only", batch.Results[1].Error)
+
+		// Reading and copying out still work
+		resp = tc.makeRequest("GET", photoURL+"/file", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("POST", photoURL+"/copy", map[string]interface{}{"library_id": other.ID})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		// Clearing the flag makes the library editable again
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", archive.ID), map[string]interface{}{"read_only": false})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		resp = tc.makeRequest("PUT", photoURL, map[string]interface{}{"title": "Changed"})
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	})
+
+	t.Run("Library Quota", func(t *testing.T) {
+		size := int64(len(createTestImage()))
+		resp := tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name": "Quota Library", "images": filepath.Join(tc.TempDir, "quota"), "quota_bytes": size + size/2,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var library TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &library)
+		elsewhere := tc.uploadTestPhoto(tc.createTestLibrary("Unlimited Library", "").ID, "elsewhere.jpg", nil, "")
+
+		first := tc.uploadTestPhoto(library.ID, "first.jpg", nil, "")
+
+		// The next file would go over, and the response says by how much
+		resp = tc.uploadTestFile(library.ID, "second.jpg", "image/jpeg", createTestImage())
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code, resp.Body.String())
+		var exceeded map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &exceeded)
+		assert.Equal(t, "Library quota exceeded", exceeded["error"])
+		assert.Equal(t, float64(size+size/2), exceeded["quota_bytes"])
+		assert.Equal(t, float64(size), exceeded["used_bytes"])
+		assert.Equal(t, float64(size), exceeded["requested_bytes"])
+
+		for _, action := range []string{"copy", "move"} {
+			resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/%s", elsewhere.ID, action), map[string]interface{}{"library_id": library.ID})
+			assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code, "%s: %s", action, resp.Body.String())
+		}
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s/stats", library.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var stats struct {
+			Quota struct {
+				QuotaBytes     int64   `json:"quota_bytes"`
+				UsedBytes      int64   `json:"used_bytes"`
+				AvailableBytes int64   `json:"available_bytes"`
+				UsedPercent    float64 `json:"used_percent"`
+			} `json:"quota"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &stats)
+		assert.Equal(t, size+size/2, stats.Quota.QuotaBytes)
+		assert.Equal(t, size, stats.Quota.UsedBytes)
+		assert.Equal(t, size/2, stats.Quota.AvailableBytes)
+		assert.InDelta(t, 66.7, stats.Quota.UsedPercent, 0.1)
+
+		// Trashed photos keep counting until they are purged
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", first.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.uploadTestFile(library.ID, "second.jpg", "image/jpeg", createTestImage())
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+
+		// Raising the quota makes room, and 0 removes it
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"quota_bytes": 2 * size})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", elsewhere.ID), map[string]interface{}{"library_id": library.ID})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"quota_bytes": 0})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		resp = tc.uploadTestFile(library.ID, "second.jpg", "image/jpeg", createTestImage())
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s/stats", library.ID), nil)
+		assert.NotContains(t, resp.Body.String(), `"quota"`)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", library.ID), map[string]interface{}{"quota_bytes": -1})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Audit Library", func(t *testing.T) {
+		library := tc.createTestLibrary("Audited Library", "")
+		gone := tc.uploadTestPhoto(library.ID, "gone.jpg", nil, "")
+		kept := tc.uploadTestPhoto(library.ID, "kept.jpg", nil, "")
+		album := tc.createTestAlbum("Audited Album", "", library.ID)
+		tag := tc.createTestTag("audited-tag", "")
+		db := tc.DB.GetDB()
+
+		// Break things the way outside changes and crashes do
+		require.NoError(t, os.Remove(gone.FilePath))
+		require.NoError(t, os.WriteFile(filepath.Join(library.Images, "stray.jpg"), createTestImage(), 0644))
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/photos", tag.ID), map[string]interface{}{"photo_id": kept.ID})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		strayPhotoID := uuid.New()
+		require.NoError(t, db.Connection(func(conn *gorm.DB) error {
+			// Enforced foreign keys would stop these
+			conn.Exec("PRAGMA foreign_keys = OFF")
+			defer conn.Exec("PRAGMA foreign_keys = ON")
+			if err := conn.Exec("DELETE FROM tags WHERE id = ?", tag.ID).Error; err != nil {
+				return err
+			}
+			return conn.Create(&models.AlbumPhoto{AlbumID: album.ID, PhotoID: strayPhotoID}).Error
+		}))
+
+		type auditReport struct {
+			Fixed        bool `json:"fixed"`
+			MissingFiles []struct {
+				PhotoID uuid.UUID `json:"photo_id"`
+				Fixed   bool      `json:"fixed"`
+			} `json:"missing_files"`
+			UntrackedFiles []struct {
+				Path    string     `json:"path"`
+				Fixed   bool       `json:"fixed"`
+				PhotoID *uuid.UUID `json:"photo_id"`
+			} `json:"untracked_files"`
+			DanglingPhotoTags []struct {
+				PhotoID uuid.UUID `json:"photo_id"`
+				TagID   uuid.UUID `json:"tag_id"`
+			} `json:"dangling_photo_tags"`
+			DanglingAlbumPhotos []struct {
+				AlbumID uuid.UUID `json:"album_id"`
+				PhotoID uuid.UUID `json:"photo_id"`
+			} `json:"dangling_album_photos"`
+		}
+		audit := func(query string) auditReport {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s/audit%s", library.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var report auditReport
+			json.Unmarshal(resp.Body.Bytes(), &report)
+			return report
+		}
+
+		report := audit("")
+		assert.False(t, report.Fixed)
+		require.Len(t, report.MissingFiles, 1)
+		assert.Equal(t, gone.ID, report.MissingFiles[0].PhotoID)
+		require.Len(t, report.UntrackedFiles, 1)
+		assert.Equal(t, "stray.jpg", report.UntrackedFiles[0].Path)
+		assert.Nil(t, report.UntrackedFiles[0].PhotoID)
+		require.Len(t, report.DanglingPhotoTags, 1)
+		assert.Equal(t, tag.ID, report.DanglingPhotoTags[0].TagID)
+		require.Len(t, report.DanglingAlbumPhotos, 1)
+		assert.Equal(t, strayPhotoID, report.DanglingAlbumPhotos[0].PhotoID)
+
+		// Reporting changes nothing
+		assert.Equal(t, report, audit(""))
+
+		report = audit("?fix=true")
+		assert.True(t, report.Fixed)
+		assert.True(t, report.MissingFiles[0].Fixed)
+		assert.True(t, report.UntrackedFiles[0].Fixed)
+		require.NotNil(t, report.UntrackedFiles[0].PhotoID)
+
+		// Only the record without a file is left, flagged as missing
+		report = audit("")
+		assert.Len(t, report.MissingFiles, 1)
+		assert.Empty(t, report.UntrackedFiles)
+		assert.Empty(t, report.DanglingPhotoTags)
+		assert.Empty(t, report.DanglingAlbumPhotos)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", gone.ID), nil)
+		assert.Contains(t, resp.Body.String(), `"missing":true`)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s/audit", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Library and Album Feeds", func(t *testing.T) {
+		library := tc.createTestLibrary("Feed Library", "Followed by a photo frame")
+		first := tc.uploadTestPhoto(library.ID, "first.jpg", nil, "")
+		second := tc.uploadTestPhoto(library.ID, "second.jpg", nil, "")
+		album := tc.createTestAlbum("Feed Album", "", library.ID)
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{"photo_id": second.ID})
+		require.Equal(t, http.StatusCreated, resp.Code)
+
+		type feed struct {
+			Title   string `xml:"title"`
+			Entries []struct {
+				ID    string `xml:"id"`
+				Links []struct {
+					Rel  string `xml:"rel,attr"`
+					Href string `xml:"href,attr"`
+				} `xml:"link"`
+			} `xml:"entry"`
+		}
+		getFeed := func(url string) feed {
+			resp := tc.makeRequest("GET", url, nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Contains(t, resp.Header().Get("Content-Type"), "application/atom+xml")
+			var result feed
+			require.NoError(t, xml.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		result := getFeed(fmt.Sprintf("/feeds/library/%s.atom", library.ID))
+		assert.Equal(t, "Feed Library", result.Title)
+		require.Len(t, result.Entries, 2)
+		ids := []string{result.Entries[0].ID, result.Entries[1].ID}
+		assert.ElementsMatch(t, []string{"urn:uuid:" + first.ID.String(), "urn:uuid:" + second.ID.String()}, ids)
+		for _, entry := range result.Entries {
+			var enclosure string
+			for _, link := range entry.Links {
+				if link.Rel == "enclosure" {
+					enclosure = link.Href
+				}
+			}
+			assert.True(t, strings.HasPrefix(enclosure, "http://"), enclosure)
+			assert.Contains(t, enclosure, "/thumbnail")
+			assert.Contains(t, enclosure, "size=medium")
+		}
+
+		result = getFeed(fmt.Sprintf("/feeds/library/%s.atom?limit=1", library.ID))
+		assert.Len(t, result.Entries, 1)
+
+		result = getFeed(fmt.Sprintf("/feeds/album/%s.atom", album.ID))
+		assert.Equal(t, "Feed Album", result.Title)
+		require.Len(t, result.Entries, 1)
+		assert.Equal(t, "urn:uuid:"+second.ID.String(), result.Entries[0].ID)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/feeds/library/%s", library.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("GET", "/feeds/album/not-a-uuid.atom", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/feeds/album/%s.atom", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("WebDAV Mount", func(t *testing.T) {
+		library := tc.createTestLibrary("Mounted", "Browsed from a desktop")
+		first := tc.uploadTestPhoto(library.ID, "first.jpg", nil, "")
+		second := tc.uploadTestPhoto(library.ID, "second.jpg", nil, "")
+		album := tc.createTestAlbum("Holiday", "", library.ID)
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{"photo_id": second.ID})
+		require.Equal(t, http.StatusCreated, resp.Code)
+
+		list := func(path string) string {
+			req := httptest.NewRequest("PROPFIND", path, nil)
+			req.Header.Set("Depth", "1")
+			resp := httptest.NewRecorder()
+			tc.Router.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusMultiStatus, resp.Code, path)
+			return resp.Body.String()
+		}
+
+		resp = tc.makeRequest("OPTIONS", "/webdav/", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "1", resp.Header().Get("DAV"))
+
+		assert.Contains(t, list("/webdav/"), "/webdav/Mounted/")
+		listing := list("/webdav/Mounted/")
+		assert.Contains(t, listing, "/webdav/Mounted/Albums/")
+		assert.Contains(t, listing, "/webdav/Mounted/Photos/")
+
+		// Both uploads are named test.jpg, the later one gets its ID appended
+		listing = list("/webdav/Mounted/Photos/")
+		assert.Contains(t, listing, "/webdav/Mounted/Photos/test.jpg")
+		assert.Contains(t, listing, fmt.Sprintf("/webdav/Mounted/Photos/test%%20%%28%s%%29.jpg", second.ID.String()[:8]))
+		assert.Contains(t, listing, "image/jpeg")
+
+		assert.Contains(t, list("/webdav/Mounted/Albums/"), "/webdav/Mounted/Albums/Holiday/")
+		listing = list("/webdav/Mounted/Albums/Holiday/")
+		assert.Contains(t, listing, "/webdav/Mounted/Albums/Holiday/test.jpg")
+		assert.NotContains(t, listing, "/webdav/Mounted/Albums/Holiday/test%20")
+
+		// Files are the photos' originals
+		original := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", first.ID), nil)
+		require.Equal(t, http.StatusOK, original.Code)
+		resp = tc.makeRequest("GET", "/webdav/Mounted/Photos/test.jpg", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, original.Body.Bytes(), resp.Body.Bytes())
+		resp = tc.makeRequest("GET", "/webdav/Mounted/Albums/Holiday/test.jpg", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.NotEmpty(t, resp.Header().Get("ETag"))
+
+		resp = tc.makeRequest("GET", "/webdav/Mounted/Photos/missing.jpg", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("GET", "/webdav/Elsewhere/Photos/test.jpg", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		// The mount is read-only
+		resp = tc.makeRequest("PUT", "/webdav/Mounted/Photos/new.jpg", "data")
+		assert.GreaterOrEqual(t, resp.Code, 400)
+		resp = tc.makeRequest("DELETE", "/webdav/Mounted/Photos/test.jpg", nil)
+		assert.GreaterOrEqual(t, resp.Code, 400)
+		resp = tc.makeRequest("GET", "/webdav/Mounted/Photos/test.jpg", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		// Clients send API keys as their password
+		req := httptest.NewRequest("PROPFIND", "/webdav/", nil)
+		req.SetBasicAuth("photos", "plk_invalid")
+		resp = httptest.NewRecorder()
+		tc.Router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+
+	t.Run("Scan Library - Not Found", func(t *testing.T) {
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/scan", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Rescan Library - Not Found", func(t *testing.T) {
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/rescan", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
 	t.Run("Get Library Stats - Not Found", func(t *testing.T) {
 		nonExistentID := uuid.New()
 		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s/stats", nonExistentID), nil)
@@ -1,14 +1,34 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"photo-library-server/cdn"
+	"photo-library-server/metadata"
+	"photo-library-server/models"
+	"photo-library-server/signing"
+	"photo-library-server/thumbnails"
+	"photo-library-server/video"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestPhotoEndpoints tests all photo-related endpoints
@@ -118,6 +138,196 @@ func TestPhotoEndpoints(t *testing.T) {
 		assert.Nil(t, photo.Rating, "Invalid rating should be ignored")
 	})
 
+	t.Run("Upload Photo - Import Embedded Keywords", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"name":            "Keyword Library",
+			"images":          filepath.Join(tc.TempDir, "keyword_library"),
+			"import_keywords": true,
+		}
+		resp := tc.makeRequest("POST", "/api/v1/libraries", payload)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var keywordLibrary TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &keywordLibrary)
+
+		fields := map[string]string{
+			"library_id": keywordLibrary.ID.String(),
+			"tags":       "manual",
+		}
+		files := map[string][]byte{
+			"photo": createTestImageWithKeywords("sunset", "beach &amp; sea", "manual"),
+		}
+
+		resp = tc.makeMultipartRequest("/api/v1/photos/upload", fields, files)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+
+		var tagNames []string
+		for _, tag := range response["tags"].([]interface{}) {
+			tagNames = append(tagNames, tag.(map[string]interface{})["name"].(string))
+		}
+		assert.ElementsMatch(t, []string{"manual", "sunset", "beach & sea"}, tagNames)
+	})
+
+	t.Run("Upload Photo - Keywords Ignored Without Opt-In", func(t *testing.T) {
+		fields := map[string]string{
+			"library_id": library.ID.String(),
+		}
+		files := map[string][]byte{
+			"photo": createTestImageWithKeywords("ignored-keyword"),
+		}
+
+		resp := tc.makeMultipartRequest("/api/v1/photos/upload", fields, files)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, []interface{}{}, response["tags"])
+	})
+
+	t.Run("Upload Photos - Batch", func(t *testing.T) {
+		var b bytes.Buffer
+		writer := multipart.NewWriter(&b)
+		writer.WriteField("library_id", library.ID.String())
+		writer.WriteField("rating", "4")
+		writer.WriteField("tags", "batch-import")
+		for _, file := range []struct {
+			name, mimeType string
+			data           []byte
+		}{
+			{"batch1.jpg", "image/jpeg", createTestImage()},
+			{"notes.txt", "text/plain", []byte("not a photo")},
+			{"batch2.jpg", "image/jpeg", createTestImage()},
+		} {
+			part, err := writer.CreatePart(textproto.MIMEHeader{
+				"Content-Disposition": {fmt.Sprintf(`form-data; name="photos"; filename="%s"`, file.name)},
+				"Content-Type":        {file.mimeType},
+			})
+			require.NoError(t, err)
+			part.Write(file.data)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/v1/photos/upload/batch", &b)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		tc.Router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var body struct {
+			Results []struct {
+				Filename string     `json:"filename"`
+				Status   string     `json:"status"`
+				PhotoID  *uuid.UUID `json:"photo_id"`
+				Photo    *TestPhoto `json:"photo"`
+				Error    string     `json:"error"`
+			} `json:"results"`
+			Created int `json:"created"`
+			Failed  int `json:"failed"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		assert.Equal(t, 2, body.Created)
+		assert.Equal(t, 1, body.Failed)
+		require.Len(t, body.Results, 3)
+
+		assert.Equal(t, "batch1.jpg", body.Results[0].Filename)
+		assert.Equal(t, "created", body.Results[0].Status)
+		require.NotNil(t, body.Results[0].Photo)
+		assert.Equal(t, *body.Results[0].PhotoID, body.Results[0].Photo.ID)
+		assert.Equal(t, 4, *body.Results[0].Photo.Rating)
+
+		assert.Equal(t, "notes.txt", body.Results[1].Filename)
+		assert.Equal(t, "failed", body.Results[1].Status)
+		assert.Nil(t, body.Results[1].PhotoID)
+		assert.Contains(t, body.Results[1].Error, "Invalid image type")
+
+		assert.Equal(t, "created", body.Results[2].Status)
+		var photo models.Photo
+		require.NoError(t, tc.DB.GetDB().Preload("Tags").First(&photo, *body.Results[2].PhotoID).Error)
+		require.Len(t, photo.Tags, 1)
+		assert.Equal(t, "batch-import", photo.Tags[0].Name)
+		_, err := os.Stat(photo.FilePath)
+		assert.NoError(t, err)
+
+		// Library errors fail the whole request
+		resp = tc.makeMultipartRequest("/api/v1/photos/upload/batch", map[string]string{
+			"library_id": uuid.New().String(),
+		}, map[string][]byte{"photos": createTestImage()})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.makeMultipartRequest("/api/v1/photos/upload/batch", map[string]string{
+			"library_id": library.ID.String(),
+		}, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Upload Photo - Dedupe", func(t *testing.T) {
+		dedupeLibrary := tc.createTestLibrary("Dedupe Library", "Duplicate uploads")
+		data := createTestImageOfSize(3, 5)
+		upload := func(url string, fields map[string]string) *httptest.ResponseRecorder {
+			fields["library_id"] = dedupeLibrary.ID.String()
+			files := map[string][]byte{"photo": data}
+			if url == "/api/v1/photos/upload/batch" {
+				files = map[string][]byte{"photos": data}
+			}
+			return tc.makeMultipartRequest(url, fields, files)
+		}
+
+		resp := upload("/api/v1/photos/upload", map[string]string{})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		var original TestPhoto
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &original))
+
+		// Linking returns the existing photo without storing a copy
+		resp = upload("/api/v1/photos/upload", map[string]string{"dedupe": "true"})
+		require.Equal(t, http.StatusOK, resp.Code)
+		var linked TestPhoto
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &linked))
+		assert.Equal(t, original.ID, linked.ID)
+
+		resp = upload("/api/v1/photos/upload", map[string]string{"dedupe": "reject"})
+		require.Equal(t, http.StatusConflict, resp.Code)
+		var conflict map[string]interface{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &conflict))
+		assert.Equal(t, original.ID.String(), conflict["photo_id"])
+
+		var count int64
+		tc.DB.GetDB().Model(&models.Photo{}).Where("library_id = ?", dedupeLibrary.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		// The configured default applies unless the form field overrides it
+		tc.Config.DedupeUploads = "reject"
+		defer func() { tc.Config.DedupeUploads = "" }()
+		resp = upload("/api/v1/photos/upload", map[string]string{})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		resp = upload("/api/v1/photos/upload/batch", map[string]string{"dedupe": "link"})
+		require.Equal(t, http.StatusOK, resp.Code)
+		var batch struct {
+			Results []struct {
+				Status  string     `json:"status"`
+				PhotoID *uuid.UUID `json:"photo_id"`
+			} `json:"results"`
+			Created    int `json:"created"`
+			Duplicates int `json:"duplicates"`
+			Failed     int `json:"failed"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &batch))
+		assert.Equal(t, 0, batch.Created)
+		assert.Equal(t, 1, batch.Duplicates)
+		assert.Equal(t, 0, batch.Failed)
+		require.Len(t, batch.Results, 1)
+		assert.Equal(t, "duplicate", batch.Results[0].Status)
+		assert.Equal(t, original.ID, *batch.Results[0].PhotoID)
+
+		resp = upload("/api/v1/photos/upload", map[string]string{"dedupe": "false"})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		tc.DB.GetDB().Model(&models.Photo{}).Where("library_id = ?", dedupeLibrary.ID).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
 	t.Run("Get Photos", func(t *testing.T) {
 		// Upload test photos
 		rating3 := 3
@@ -233,6 +443,71 @@ func TestPhotoEndpoints(t *testing.T) {
 		assert.Equal(t, 4, *updatedPhoto.Rating)
 	})
 
+	t.Run("Update Photo Rating - Sidecar Write-Back", func(t *testing.T) {
+		tc.Config.XMPWriteback = "sidecar"
+		defer func() { tc.Config.XMPWriteback = "" }()
+
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "sidecar.jpg", nil, "")
+
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), map[string]interface{}{"rating": 3})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		sidecar, err := os.ReadFile(metadata.SidecarPath(uploadedPhoto.FilePath))
+		assert.NoError(t, err, "Sidecar should be written")
+		assert.Equal(t, 3, *metadata.ExtractRating(sidecar))
+
+		// Purging the photo removes its sidecar too
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		_, err = os.Stat(metadata.SidecarPath(uploadedPhoto.FilePath))
+		assert.True(t, os.IsNotExist(err), "Sidecar should be deleted")
+	})
+
+	t.Run("Update Photo Rating - Embedded Write-Back", func(t *testing.T) {
+		tc.Config.XMPWriteback = "embed"
+		defer func() { tc.Config.XMPWriteback = "" }()
+
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "embed.jpg", nil, "")
+
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), map[string]interface{}{"rating": 5})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var updatedPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &updatedPhoto)
+
+		data, err := os.ReadFile(uploadedPhoto.FilePath)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, *metadata.ExtractRating(data))
+		assert.Equal(t, int64(len(data)), updatedPhoto.FileSize, "File size should reflect the embedded packet")
+
+		// The rewritten file must still be a decodable image
+		_, _, err = image.DecodeConfig(bytes.NewReader(data))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Update Photo Rating - Unchanged Rating Not Written Back", func(t *testing.T) {
+		tc.Config.XMPWriteback = "embed"
+		defer func() { tc.Config.XMPWriteback = "" }()
+
+		rating := 2
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "unchanged.jpg", &rating, "")
+		original, err := os.ReadFile(uploadedPhoto.FilePath)
+		require.NoError(t, err)
+
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), map[string]interface{}{"rating": 2, "title": "Same rating"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		data, err := os.ReadFile(uploadedPhoto.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, original, data, "File should not be rewritten")
+
+		var stored models.Photo
+		require.NoError(t, tc.DB.GetDB().First(&stored, "id = ?", uploadedPhoto.ID).Error)
+		assert.Equal(t, uploadedPhoto.Checksum, stored.Checksum)
+	})
+
 	t.Run("Update Photo - Invalid Rating", func(t *testing.T) {
 		uploadedPhoto := tc.uploadTestPhoto(library.ID, "invalid_rating.jpg", nil, "")
 
@@ -248,144 +523,2784 @@ func TestPhotoEndpoints(t *testing.T) {
 		assert.Contains(t, response["error"].(string), "rating")
 	})
 
-	t.Run("Serve Photo File", func(t *testing.T) {
-		uploadedPhoto := tc.uploadTestPhoto(library.ID, "serve.jpg", nil, "")
+	t.Run("Embed Metadata in Downloads", func(t *testing.T) {
+		rating := 4
+		photo := tc.uploadTestPhoto(library.ID, "embed.jpg", &rating, "harbor,boats")
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", photo.ID), map[string]interface{}{
+			"title": "Harbor at dawn", "caption": "Fishing boats & gulls",
+			"latitude": 43.2965, "longitude": 5.3698,
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		stored, err := os.ReadFile(photo.FilePath)
+		require.NoError(t, err)
+
+		checkEmbedded := func(data []byte) {
+			assert.ElementsMatch(t, []string{"harbor", "boats"}, metadata.ExtractKeywords(data))
+			require.NotNil(t, metadata.ExtractRating(data))
+			assert.Equal(t, 4, *metadata.ExtractRating(data))
+			loc := metadata.ExtractLocation(data)
+			require.NotNil(t, loc)
+			assert.InDelta(t, 43.2965, loc.Latitude, 1e-6)
+			assert.InDelta(t, 5.3698, loc.Longitude, 1e-6)
+			assert.Contains(t, string(data), "Harbor at dawn")
+			assert.Contains(t, string(data), "Fishing boats &amp; gulls")
+		}
 
-		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", uploadedPhoto.ID), nil)
-		assert.Equal(t, http.StatusOK, resp.Code)
+		// Single download, the stored file is left as it was
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file?embed_metadata=true", photo.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		checkEmbedded(resp.Body.Bytes())
+		_, _, err = image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+		assert.NoError(t, err)
+		etag := resp.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+		current, _ := os.ReadFile(photo.FilePath)
+		assert.Equal(t, stored, current)
+
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file?embed_metadata=true", photo.ID), nil)
+		req.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		tc.Router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", photo.ID), nil)
+		assert.Equal(t, stored, resp.Body.Bytes())
+
+		// ZIP exports embed into JPEGs and add sidecars for other formats
+		resp = tc.uploadTestFile(library.ID, "embed.mp4", "video/mp4", createTestVideo(3, time.Now()))
+		require.Equal(t, http.StatusCreated, resp.Code)
+		var clip TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &clip)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", clip.ID), map[string]interface{}{"title": "Harbor clip"})
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		resp = tc.makeRequest("POST", "/api/v1/photos/download", map[string]interface{}{
+			"photo_ids":      []uuid.UUID{photo.ID, clip.ID},
+			"embed_metadata": true,
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		body := resp.Body.Bytes()
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		require.Len(t, archive.File, 3)
+		entries := make(map[string][]byte)
+		for _, f := range archive.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			entries[f.Name], _ = io.ReadAll(rc)
+			rc.Close()
+		}
+		checkEmbedded(entries["test.jpg"])
+		assert.Contains(t, string(entries[clip.OriginalName+".xmp"]), "Harbor clip")
+		clipFile, _ := os.ReadFile(clip.FilePath)
+		assert.Equal(t, clipFile, entries[clip.OriginalName])
+	})
 
-		// Verify headers
-		assert.Equal(t, uploadedPhoto.MimeType, resp.Header().Get("Content-Type"))
-		assert.Contains(t, resp.Header().Get("Content-Disposition"), uploadedPhoto.OriginalName)
+	t.Run("Update Photo Details", func(t *testing.T) {
+		rating := 3
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "details.jpg", &rating, "")
 
-		// Verify we got actual image data
-		assert.True(t, resp.Body.Len() > 0)
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), map[string]interface{}{
+			"title":       "  Sunset at the pier ",
+			"caption":     "Last evening of the trip",
+			"description": "Taken from the end of the pier just before the storm rolled in.",
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		var updatedPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &updatedPhoto)
+		assert.Equal(t, "Sunset at the pier", updatedPhoto.Title)
+		assert.Equal(t, "Last evening of the trip", updatedPhoto.Caption)
+		assert.Contains(t, updatedPhoto.Description, "storm")
+
+		// Fields left out are unchanged, a null rating clears it
+		require.NotNil(t, updatedPhoto.Rating)
+		assert.Equal(t, 3, *updatedPhoto.Rating)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), map[string]interface{}{
+			"rating": nil,
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		json.Unmarshal(resp.Body.Bytes(), &updatedPhoto)
+		assert.Nil(t, updatedPhoto.Rating)
+		assert.Equal(t, "Sunset at the pier", updatedPhoto.Title)
+
+		// Copies keep the details
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", uploadedPhoto.ID), map[string]interface{}{
+			"library_id": library.ID,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var copied struct {
+			CopiedPhoto TestPhoto `json:"copied_photo"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &copied)
+		assert.Equal(t, "Last evening of the trip", copied.CopiedPhoto.Caption)
+
+		for field, limit := range map[string]int{"title": 200, "caption": 500, "description": 5000} {
+			resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), map[string]interface{}{
+				field: strings.Repeat("a", limit+1),
+			})
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			var response map[string]interface{}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			assert.Equal(t, fmt.Sprintf("%s must be at most %d characters", field, limit), response["error"])
+		}
 	})
 
-	t.Run("Serve Photo File - Not Found", func(t *testing.T) {
-		nonExistentID := uuid.New()
-		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", nonExistentID), nil)
-		assert.Equal(t, http.StatusNotFound, resp.Code)
+	t.Run("Untagged and Unrated Filters", func(t *testing.T) {
+		curation := tc.createTestLibrary("Curation Library", "")
+		zero, five := 0, 5
+		done := tc.uploadTestPhoto(curation.ID, "done.jpg", &five, "keeper")
+		unrated := tc.uploadTestPhoto(curation.ID, "unrated.jpg", nil, "keeper")
+		untagged := tc.uploadTestPhoto(curation.ID, "untagged.jpg", &zero, "")
+		fresh := tc.uploadTestPhoto(curation.ID, "fresh.jpg", nil, "")
+
+		list := func(filters string) []uuid.UUID {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&%s", curation.ID, filters), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var listed struct {
+				Photos     []TestPhoto `json:"photos"`
+				Pagination struct {
+					Total int64 `json:"total"`
+				} `json:"pagination"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &listed))
+			assert.Equal(t, int64(len(listed.Photos)), listed.Pagination.Total, filters)
+			ids := []uuid.UUID{}
+			for _, photo := range listed.Photos {
+				ids = append(ids, photo.ID)
+			}
+			return ids
+		}
+
+		assert.ElementsMatch(t, []uuid.UUID{untagged.ID, fresh.ID}, list("untagged=true"))
+		assert.ElementsMatch(t, []uuid.UUID{done.ID, unrated.ID}, list("untagged=false"))
+		assert.ElementsMatch(t, []uuid.UUID{unrated.ID, fresh.ID}, list("unrated=true"))
+		assert.ElementsMatch(t, []uuid.UUID{done.ID, untagged.ID}, list("unrated=false"))
+		assert.ElementsMatch(t, []uuid.UUID{fresh.ID}, list("untagged=true&unrated=true"))
+
+		// Tagging a photo takes it off the list
+		resp := tc.makeRequest("POST", "/api/v1/tags/batch", map[string]interface{}{"photo_ids": []uuid.UUID{fresh.ID}, "add": []string{"keeper"}})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.ElementsMatch(t, []uuid.UUID{untagged.ID}, list("untagged=true"))
 	})
 
-	t.Run("Copy Photo - Same Library", func(t *testing.T) {
-		originalPhoto := tc.uploadTestPhoto(library.ID, "original.jpg", nil, "original,tag")
+	t.Run("Favorite Photos", func(t *testing.T) {
+		favLibrary := tc.createTestLibrary("Favorites Library", "For favorite testing")
+		first := tc.uploadTestPhoto(favLibrary.ID, "first.jpg", nil, "")
+		second := tc.uploadTestPhoto(favLibrary.ID, "second.jpg", nil, "")
+		tc.uploadTestPhoto(favLibrary.ID, "third.jpg", nil, "")
+		assert.False(t, first.Favorite)
 
-		payload := map[string]interface{}{
-			"library_id": library.ID,
-		}
+		// Toggling flips the flag each time
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/favorite", first.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var photo TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &photo)
+		assert.True(t, photo.Favorite)
 
-		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", originalPhoto.ID), payload)
-		assert.Equal(t, http.StatusCreated, resp.Code)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/favorite", first.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &photo)
+		assert.False(t, photo.Favorite)
 
-		var response map[string]interface{}
-		json.Unmarshal(resp.Body.Bytes(), &response)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/favorite", first.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
 
-		assert.Equal(t, "Photo copied successfully", response["message"])
-		assert.Equal(t, originalPhoto.ID.String(), response["original_id"])
+		// UpdatePhoto sets it explicitly and leaves it alone otherwise
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", second.ID), map[string]interface{}{"favorite": true})
+		require.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", second.ID), map[string]interface{}{"rating": 2})
+		json.Unmarshal(resp.Body.Bytes(), &photo)
+		assert.True(t, photo.Favorite)
 
-		copiedPhotoData := response["copied_photo"].(map[string]interface{})
-		assert.NotEqual(t, originalPhoto.ID.String(), copiedPhotoData["id"])
-		assert.Equal(t, originalPhoto.OriginalName, copiedPhotoData["original_name"])
-		assert.Equal(t, originalPhoto.MimeType, copiedPhotoData["mime_type"])
-		assert.Equal(t, originalPhoto.LibraryID.String(), copiedPhotoData["library_id"])
-		assert.NotEqual(t, originalPhoto.Filename, copiedPhotoData["filename"]) // Should have unique filename
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&favorite=true", favLibrary.ID), nil)
+		var listed struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		assert.Len(t, listed.Photos, 2)
+		for _, p := range listed.Photos {
+			assert.True(t, p.Favorite)
+		}
 
-		// Verify files exist
-		_, err := os.Stat(originalPhoto.FilePath)
-		assert.NoError(t, err, "Original file should still exist")
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&favorite=false", favLibrary.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		assert.Len(t, listed.Photos, 1)
 
-		copiedFilePath := copiedPhotoData["file_path"].(string)
-		_, err = os.Stat(copiedFilePath)
-		assert.NoError(t, err, "Copied file should exist")
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/libraries/%s/stats", favLibrary.ID), nil)
+		var stats map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &stats)
+		assert.Equal(t, float64(2), stats["favorite_count"])
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/favorite", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
 	})
 
-	t.Run("Copy Photo - Different Library", func(t *testing.T) {
-		targetLibrary := tc.createTestLibrary("Target Library", "Copy destination")
-		originalPhoto := tc.uploadTestPhoto(library.ID, "cross_library.jpg", nil, "tag1,tag2")
+	t.Run("Photo Locations", func(t *testing.T) {
+		geoLibrary := tc.createTestLibrary("Geo Library", "For location testing")
+		upload := func(name string, data []byte) TestPhoto {
+			resp := tc.uploadTestFile(geoLibrary.ID, name, "image/jpeg", data)
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			return photo
+		}
 
-		payload := map[string]interface{}{
-			"library_id": targetLibrary.ID,
+		// Paris, read from the file
+		paris := upload("paris.jpg", createTestImageAt("48,51.5N", "2,21W"))
+		require.NotNil(t, paris.Latitude)
+		assert.InDelta(t, 48.858333, *paris.Latitude, 1e-6)
+		assert.InDelta(t, -2.35, *paris.Longitude, 1e-6)
+
+		// Versailles and Fiji, set by hand
+		versailles := upload("versailles.jpg", createTestImage())
+		assert.Nil(t, versailles.Latitude)
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", versailles.ID), map[string]interface{}{
+			"latitude": 48.8049, "longitude": -2.1204,
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		fiji := upload("fiji.jpg", createTestImage())
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", fiji.ID), map[string]interface{}{
+			"latitude": -17.7134, "longitude": 178.065,
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		upload("nowhere.jpg", createTestImage())
+
+		find := func(query string) []uuid.UUID {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&%s", geoLibrary.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var response struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			ids := []uuid.UUID{}
+			for _, photo := range response.Photos {
+				ids = append(ids, photo.ID)
+			}
+			return ids
 		}
 
-		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", originalPhoto.ID), payload)
-		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.ElementsMatch(t, []uuid.UUID{paris.ID, versailles.ID}, find("bbox=-3,48,-2,49"))
+		assert.Equal(t, []uuid.UUID{fiji.ID}, find("bbox=170,-20,-170,-10")) // Across the antimeridian
+		assert.Empty(t, find("bbox=10,10,20,20"))
 
-		var response map[string]interface{}
-		json.Unmarshal(resp.Body.Bytes(), &response)
+		// Versailles is about 20km from Paris
+		assert.Equal(t, []uuid.UUID{paris.ID}, find("near=48.8566,-2.3522"))
+		assert.Equal(t, []uuid.UUID{paris.ID}, find("near=48.8566,-2.3522&radius=10"))
+		assert.ElementsMatch(t, []uuid.UUID{paris.ID, versailles.ID}, find("near=48.8566,-2.3522&radius=25"))
+		assert.Equal(t, []uuid.UUID{fiji.ID}, find("near=-17.7,179.9&radius=200"))
 
-		copiedPhotoData := response["copied_photo"].(map[string]interface{})
-		assert.Equal(t, targetLibrary.ID.String(), copiedPhotoData["library_id"])
+		for _, query := range []string{"bbox=1,2,3", "bbox=0,50,10,40", "bbox=a,b,c,d", "near=95,0", "near=48.8", "near=48.8,2.3&radius=-1", "radius=5"} {
+			resp := tc.makeRequest("GET", "/api/v1/photos?"+query, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		}
 
-		// Verify files exist in different directories
-		_, err := os.Stat(originalPhoto.FilePath)
-		assert.NoError(t, err, "Original file should still exist")
+		// Positions are validated, set and cleared together
+		for _, body := range []map[string]interface{}{
+			{"latitude": 91, "longitude": 0},
+			{"latitude": 10, "longitude": 181},
+			{"latitude": 10},
+			{"latitude": 10, "longitude": nil},
+		} {
+			resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", paris.ID), body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", paris.ID), map[string]interface{}{
+			"latitude": nil, "longitude": nil,
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		var cleared TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &cleared)
+		assert.Nil(t, cleared.Latitude)
+		assert.Nil(t, cleared.Longitude)
+	})
 
-		copiedFilePath := copiedPhotoData["file_path"].(string)
-		_, err = os.Stat(copiedFilePath)
-		assert.NoError(t, err, "Copied file should exist")
+	t.Run("Reverse Geocoding", func(t *testing.T) {
+		placesLibrary := tc.createTestLibrary("Places Library", "For reverse geocoding testing")
+		locate := func(lat, lon float64) TestPhoto {
+			photo := tc.uploadTestPhoto(placesLibrary.ID, "place.jpg", nil, "")
+			resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", photo.ID), map[string]interface{}{
+				"latitude": lat, "longitude": lon,
+			})
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			return photo
+		}
+		geocode := func() {
+			resp := tc.makeRequest("POST", "/api/v1/photos/geocode", nil)
+			require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+			var accepted map[string]interface{}
+			json.Unmarshal(resp.Body.Bytes(), &accepted)
+			job := tc.waitForJob(accepted["id"].(string))
+			require.Equal(t, "completed", job["status"])
+		}
+		get := func(id uuid.UUID) TestPhoto {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", id), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			return photo
+		}
 
-		// Verify they're in different directories
-		assert.Contains(t, copiedFilePath, targetLibrary.Images)
-		assert.NotContains(t, copiedFilePath, library.Images)
+		eiffel := locate(48.8584, 2.2945)
+		fourviere := locate(45.7623, 4.8222)
+		opera := locate(-33.8568, 151.2153)
+		atSea := locate(40.0, -30.0)
+		geocode()
+
+		for _, want := range []struct {
+			photo         TestPhoto
+			country, city string
+		}{
+			{eiffel, "FR", "Paris"},
+			{fourviere, "FR", "Lyon"},
+			{opera, "AU", "Sydney"},
+			{atSea, "", ""},
+		} {
+			photo := get(want.photo.ID)
+			assert.Equal(t, want.country, photo.Country)
+			assert.Equal(t, want.city, photo.City)
+			assert.Equal(t, want.city, photo.Place)
+		}
+
+		find := func(query string) []uuid.UUID {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&%s", placesLibrary.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var response struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			ids := []uuid.UUID{}
+			for _, photo := range response.Photos {
+				ids = append(ids, photo.ID)
+			}
+			return ids
+		}
+		assert.ElementsMatch(t, []uuid.UUID{eiffel.ID, fourviere.ID}, find("country=fr"))
+		assert.Equal(t, []uuid.UUID{opera.ID}, find("city=sydney"))
+		assert.Equal(t, []uuid.UUID{fourviere.ID}, find("place=Lyon"))
+		assert.Empty(t, find("country=DE"))
+
+		// Moving a photo clears its place until the next job looks it up
+		resp := tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", eiffel.ID), map[string]interface{}{
+			"latitude": 45.75, "longitude": 4.85,
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		var moved TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &moved)
+		assert.Empty(t, moved.Country)
+		assert.Empty(t, moved.City)
+		assert.Empty(t, moved.Place)
+
+		// Changing other details keeps it
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", opera.ID), map[string]interface{}{
+			"title": "Opera House",
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "Sydney", get(opera.ID).City)
+
+		geocode()
+		assert.Equal(t, "Lyon", get(eiffel.ID).City)
 	})
 
-	t.Run("Copy Photo - Source Not Found", func(t *testing.T) {
-		nonExistentID := uuid.New()
-		payload := map[string]interface{}{
-			"library_id": library.ID,
+	t.Run("Tag Suggestions", func(t *testing.T) {
+		suggestLibrary := tc.createTestLibrary("Suggestions Library", "For tag suggestion testing")
+		type suggestion struct {
+			ID         uuid.UUID `json:"id"`
+			PhotoID    uuid.UUID `json:"photo_id"`
+			Name       string    `json:"name"`
+			Confidence float64   `json:"confidence"`
+			Status     string    `json:"status"`
+		}
+		suggestionsOf := func(photoID uuid.UUID, status string) []suggestion {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/suggestions?status=%s", photoID, status), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var suggestions []suggestion
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &suggestions))
+			return suggestions
 		}
 
-		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", nonExistentID), payload)
+		// Photos are classified by the job, leaving out their own tags and
+		// labels below the confidence threshold
+		tagged := tc.uploadTestPhoto(suggestLibrary.ID, "tagged.jpg", nil, "sunset")
+		assert.Empty(t, suggestionsOf(tagged.ID, "pending"))
+
+		resp := tc.makeRequest("POST", "/api/v1/photos/classify", nil)
+		require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+		var accepted map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &accepted)
+		job := tc.waitForJob(accepted["id"].(string))
+		require.Equal(t, "completed", job["status"])
+
+		suggestions := suggestionsOf(tagged.ID, "pending")
+		require.Len(t, suggestions, 1)
+		// Labels are normalized like tag names, case folded by default
+		assert.Equal(t, "beach", suggestions[0].Name)
+		assert.InDelta(t, 0.93, suggestions[0].Confidence, 1e-9)
+		beach := suggestions[0]
+
+		// Uploads are classified as they arrive when enabled
+		tc.Config.ClassifyOnUpload = true
+		defer func() { tc.Config.ClassifyOnUpload = false }()
+		untagged := tc.uploadTestPhoto(suggestLibrary.ID, "untagged.jpg", nil, "")
+		require.Eventually(t, func() bool {
+			return len(suggestionsOf(untagged.ID, "pending")) == 2
+		}, 5*time.Second, 20*time.Millisecond)
+		suggestions = suggestionsOf(untagged.ID, "pending")
+		assert.Equal(t, []string{"beach", "sunset"}, []string{suggestions[0].Name, suggestions[1].Name})
+		sunset := suggestions[1]
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/suggestions?photo_id=%s&min_confidence=0.8", untagged.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var page struct {
+			Suggestions []suggestion `json:"suggestions"`
+			Pagination  struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		assert.Equal(t, int64(1), page.Pagination.Total)
+		require.Len(t, page.Suggestions, 1)
+		assert.Equal(t, "beach", page.Suggestions[0].Name)
+
+		// Accepting tags the photo, creating the tag; rejecting dismisses
+		resp = tc.makeRequest("POST", "/api/v1/suggestions/review", map[string]interface{}{
+			"accept": []uuid.UUID{beach.ID},
+			"reject": []uuid.UUID{sunset.ID},
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s?include_tags=true", tagged.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var withTags struct {
+			Tags []TestTag `json:"tags"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &withTags))
+		names := []string{}
+		for _, tag := range withTags.Tags {
+			names = append(names, tag.Name)
+		}
+		assert.ElementsMatch(t, []string{"sunset", "beach"}, names)
+
+		assert.Empty(t, suggestionsOf(tagged.ID, "pending"))
+		require.Len(t, suggestionsOf(tagged.ID, "accepted"), 1)
+		rejected := suggestionsOf(untagged.ID, "rejected")
+		require.Len(t, rejected, 1)
+		assert.Equal(t, "sunset", rejected[0].Name)
+
+		// Classifying again doesn't bring rejected suggestions back
+		resp = tc.makeRequest("POST", "/api/v1/photos/classify", nil)
+		require.Equal(t, http.StatusAccepted, resp.Code)
+		json.Unmarshal(resp.Body.Bytes(), &accepted)
+		tc.waitForJob(accepted["id"].(string))
+		assert.Len(t, suggestionsOf(untagged.ID, "all"), 2)
+
+		// Unknown, conflicting and missing suggestions are refused
+		missing := uuid.New()
+		resp = tc.makeRequest("POST", "/api/v1/suggestions/review", map[string]interface{}{
+			"accept": []uuid.UUID{beach.ID, missing},
+		})
 		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Contains(t, resp.Body.String(), "suggestion_not_found")
+		assert.Contains(t, resp.Body.String(), missing.String())
 
-		var response map[string]interface{}
-		json.Unmarshal(resp.Body.Bytes(), &response)
-		assert.Equal(t, "Source photo not found", response["error"])
+		resp = tc.makeRequest("POST", "/api/v1/suggestions/review", map[string]interface{}{
+			"accept": []uuid.UUID{sunset.ID},
+			"reject": []uuid.UUID{sunset.ID},
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("POST", "/api/v1/suggestions/review", map[string]interface{}{})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		for _, query := range []string{"status=maybe", "photo_id=nope", "min_confidence=2"} {
+			resp = tc.makeRequest("GET", "/api/v1/suggestions?"+query, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		}
 	})
 
-	t.Run("Copy Photo - Target Library Not Found", func(t *testing.T) {
-		originalPhoto := tc.uploadTestPhoto(library.ID, "no_target.jpg", nil, "")
-		nonExistentID := uuid.New()
+	t.Run("Photo Timeline", func(t *testing.T) {
+		timelineLibrary := tc.createTestLibrary("Timeline Library", "For timeline testing")
+		upload := func(takenAt time.Time) TestPhoto {
+			resp := tc.uploadTestFile(timelineLibrary.ID, "dated.jpg", "image/jpeg", createTestImageTakenAt(takenAt))
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			return photo
+		}
+		may1 := upload(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC))
+		may20 := upload(time.Date(2023, 5, 20, 18, 30, 0, 0, time.UTC))
+		may20Later := upload(time.Date(2023, 5, 20, 19, 0, 0, 0, time.UTC))
+		july := upload(time.Date(2023, 7, 4, 12, 0, 0, 0, time.UTC))
+		newYear := upload(time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC))
+
+		type bucket struct {
+			Period string `json:"period"`
+			Count  int    `json:"count"`
+			Photos []struct {
+				ID           uuid.UUID `json:"id"`
+				ThumbnailURL string    `json:"thumbnail_url"`
+			} `json:"photos"`
+		}
+		timeline := func(query string) (total int, buckets []bucket) {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/timeline?library_id=%s&%s", timelineLibrary.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var response struct {
+				Total   int      `json:"total"`
+				Buckets []bucket `json:"buckets"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			return response.Total, response.Buckets
+		}
+		periods := func(buckets []bucket) (periods []string, counts []int) {
+			for _, b := range buckets {
+				periods, counts = append(periods, b.Period), append(counts, b.Count)
+			}
+			return periods, counts
+		}
 
-		payload := map[string]interface{}{
-			"library_id": nonExistentID,
+		// Months by default, newest first
+		total, buckets := timeline("")
+		assert.Equal(t, 5, total)
+		p, n := periods(buckets)
+		assert.Equal(t, []string{"2024-01", "2023-07", "2023-05"}, p)
+		assert.Equal(t, []int{1, 1, 3}, n)
+		require.Len(t, buckets[2].Photos, 3)
+		assert.Equal(t, []uuid.UUID{may20Later.ID, may20.ID, may1.ID},
+			[]uuid.UUID{buckets[2].Photos[0].ID, buckets[2].Photos[1].ID, buckets[2].Photos[2].ID})
+		assert.Contains(t, buckets[2].Photos[0].ThumbnailURL, "/thumbnail")
+
+		_, buckets = timeline("granularity=year")
+		p, n = periods(buckets)
+		assert.Equal(t, []string{"2024", "2023"}, p)
+		assert.Equal(t, []int{1, 4}, n)
+
+		_, buckets = timeline("granularity=day&thumbnails=1")
+		p, n = periods(buckets)
+		assert.Equal(t, []string{"2024-01-01", "2023-07-04", "2023-05-20", "2023-05-01"}, p)
+		assert.Equal(t, []int{1, 1, 2, 1}, n)
+		require.Len(t, buckets[2].Photos, 1)
+		assert.Equal(t, may20Later.ID, buckets[2].Photos[0].ID)
+
+		// Buckets are paged, with the photo total covering every page
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/timeline?library_id=%s&granularity=day&limit=2&page=2", timelineLibrary.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var paged struct {
+			Total      int      `json:"total"`
+			Buckets    []bucket `json:"buckets"`
+			Pagination struct {
+				Page  int `json:"page"`
+				Limit int `json:"limit"`
+				Total int `json:"total"`
+			} `json:"pagination"`
 		}
+		json.Unmarshal(resp.Body.Bytes(), &paged)
+		assert.Equal(t, 5, paged.Total)
+		assert.Equal(t, 2, paged.Pagination.Page)
+		assert.Equal(t, 2, paged.Pagination.Limit)
+		assert.Equal(t, 4, paged.Pagination.Total)
+		p, n = periods(paged.Buckets)
+		assert.Equal(t, []string{"2023-05-20", "2023-05-01"}, p)
+		assert.Equal(t, []int{2, 1}, n)
+		require.Len(t, paged.Buckets[0].Photos, 2)
+		assert.Equal(t, []uuid.UUID{may20Later.ID, may20.ID}, []uuid.UUID{paged.Buckets[0].Photos[0].ID, paged.Buckets[0].Photos[1].ID})
+		require.Len(t, paged.Buckets[1].Photos, 1)
+		assert.Equal(t, may1.ID, paged.Buckets[1].Photos[0].ID)
+
+		// Photo list filters apply, and trashed photos are left out
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", july.ID), map[string]interface{}{"favorite": true})
+		require.Equal(t, http.StatusOK, resp.Code)
+		_, buckets = timeline("favorite=true&thumbnails=0")
+		require.Len(t, buckets, 1)
+		assert.Equal(t, "2023-07", buckets[0].Period)
+		assert.Empty(t, buckets[0].Photos)
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", newYear.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		total, buckets = timeline("granularity=year")
+		assert.Equal(t, 4, total)
+		p, _ = periods(buckets)
+		assert.Equal(t, []string{"2023"}, p)
+
+		for _, query := range []string{"granularity=week", "thumbnails=11", "thumbnails=x", "library_id=bad"} {
+			resp := tc.makeRequest("GET", "/api/v1/photos/timeline?"+query, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		}
+	})
 
-		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", originalPhoto.ID), payload)
-		assert.Equal(t, http.StatusNotFound, resp.Code)
+	t.Run("Date Range Filters", func(t *testing.T) {
+		datedLibrary := tc.createTestLibrary("Dated Library", "For date range testing")
+		upload := func(data []byte) TestPhoto {
+			resp := tc.uploadTestFile(datedLibrary.ID, "dated.jpg", "image/jpeg", data)
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			return photo
+		}
+		april := upload(createTestImageTakenAt(time.Date(2023, 4, 30, 23, 0, 0, 0, time.UTC)))
+		may := upload(createTestImageTakenAt(time.Date(2023, 5, 12, 8, 0, 0, 0, time.UTC)))
+		mayEnd := upload(createTestImageTakenAt(time.Date(2023, 5, 31, 22, 0, 0, 0, time.UTC)))
+		undated := upload(createTestImage())
+
+		find := func(query string) (ids []uuid.UUID, total int) {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&%s", datedLibrary.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var response struct {
+				Photos     []TestPhoto `json:"photos"`
+				Pagination struct {
+					Total int `json:"total"`
+				} `json:"pagination"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			ids = []uuid.UUID{}
+			for _, photo := range response.Photos {
+				ids = append(ids, photo.ID)
+			}
+			return ids, response.Pagination.Total
+		}
 
-		var response map[string]interface{}
-		json.Unmarshal(resp.Body.Bytes(), &response)
-		assert.Equal(t, "Target library not found", response["error"])
+		ids, total := find("taken_after=2023-05-01&taken_before=2023-06-01")
+		assert.ElementsMatch(t, []uuid.UUID{may.ID, mayEnd.ID}, ids)
+		assert.Equal(t, 2, total)
+
+		ids, _ = find("taken_before=2023-05-01")
+		assert.Equal(t, []uuid.UUID{april.ID}, ids)
+
+		ids, total = find("taken_after=2023-05-12T08:00:00Z")
+		assert.ElementsMatch(t, []uuid.UUID{may.ID, mayEnd.ID}, ids)
+		assert.Equal(t, 2, total)
+
+		ids, _ = find("taken_after=2023-05-12T10:00:00%2B02:00&taken_before=2023-05-31T23:00:00%2B01:00")
+		assert.Equal(t, []uuid.UUID{may.ID}, ids)
+
+		// Upload dates are now
+		yesterday := time.Now().AddDate(0, 0, -1).UTC().Format("2006-01-02")
+		tomorrow := time.Now().AddDate(0, 0, 1).UTC().Format("2006-01-02")
+		ids, total = find("uploaded_after=" + yesterday + "&uploaded_before=" + tomorrow)
+		assert.ElementsMatch(t, []uuid.UUID{april.ID, may.ID, mayEnd.ID, undated.ID}, ids)
+		assert.Equal(t, 4, total)
+		ids, total = find("uploaded_after=" + tomorrow)
+		assert.Empty(t, ids)
+		assert.Equal(t, 0, total)
+
+		for _, query := range []string{"taken_after=yesterday", "uploaded_before=2023-13-01", "taken_before=2023-05-01T10:00"} {
+			resp := tc.makeRequest("GET", "/api/v1/photos?"+query, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		}
 	})
 
-	t.Run("Delete Photo", func(t *testing.T) {
-		photoToDelete := tc.uploadTestPhoto(library.ID, "delete_me.jpg", nil, "")
+	t.Run("Cursor Pagination", func(t *testing.T) {
+		cursorLibrary := tc.createTestLibrary("Cursor Library", "For cursor pagination testing")
+		var uploaded []uuid.UUID
+		for i := 0; i < 5; i++ {
+			uploaded = append(uploaded, tc.uploadTestPhoto(cursorLibrary.ID, "cursor.jpg", nil, "").ID)
+		}
 
-		// Verify file exists before deletion
-		_, err := os.Stat(photoToDelete.FilePath)
-		assert.NoError(t, err, "Photo file should exist before deletion")
+		type page struct {
+			Photos     []TestPhoto `json:"photos"`
+			Pagination struct {
+				Page       int     `json:"page"`
+				Total      int     `json:"total"`
+				NextCursor *string `json:"next_cursor"`
+			} `json:"pagination"`
+		}
+		list := func(query string) page {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&%s", cursorLibrary.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var result page
+			json.Unmarshal(resp.Body.Bytes(), &result)
+			return result
+		}
+		walk := func(query string) []uuid.UUID {
+			ids := []uuid.UUID{}
+			result := list(query)
+			for {
+				for _, photo := range result.Photos {
+					ids = append(ids, photo.ID)
+				}
+				if result.Pagination.NextCursor == nil {
+					return ids
+				}
+				// Uploads between pages don't shift the pages still to come
+				tc.uploadTestPhoto(cursorLibrary.ID, "late.jpg", nil, "")
+				result = list("limit=2&cursor=" + *result.Pagination.NextCursor)
+			}
+		}
 
-		resp := tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", photoToDelete.ID), nil)
+		// Newest first by default, starting from a page request
+		first := list("limit=2")
+		assert.Equal(t, 1, first.Pagination.Page)
+		assert.Equal(t, 5, first.Pagination.Total)
+		require.NotNil(t, first.Pagination.NextCursor)
+		newestFirst := []uuid.UUID{uploaded[4], uploaded[3], uploaded[2], uploaded[1], uploaded[0]}
+		assert.Equal(t, newestFirst, walk("limit=2"))
+
+		// Oldest first keeps its direction through the cursor
+		oldestFirst := walk("limit=3&order_by=uploaded_at&order_dir=asc")
+		require.GreaterOrEqual(t, len(oldestFirst), 5)
+		assert.Equal(t, uploaded, oldestFirst[:5])
+
+		// Lists ordered by anything else only page by number
+		assert.Nil(t, list("limit=2&order_by=rating").Pagination.NextCursor)
+		resp := tc.makeRequest("GET", "/api/v1/photos?order_by=rating&cursor="+*first.Pagination.NextCursor, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("GET", "/api/v1/photos?cursor=not-a-cursor", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		// The v2 envelope carries the cursor in its pagination meta
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v2/photos?library_id=%s&limit=1", cursorLibrary.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var envelope struct {
+			Meta struct {
+				Pagination struct {
+					NextCursor string `json:"next_cursor"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &envelope)
+		assert.NotEmpty(t, envelope.Meta.Pagination.NextCursor)
+	})
+
+	t.Run("Photo Metadata", func(t *testing.T) {
+		metaLibrary := tc.createTestLibrary("Metadata Library", "For custom metadata testing")
+		acme := tc.uploadTestPhoto(metaLibrary.ID, "acme.jpg", nil, "")
+		globex := tc.uploadTestPhoto(metaLibrary.ID, "globex.jpg", nil, "")
+		metadataPath := fmt.Sprintf("/api/v1/photos/%s/metadata", acme.ID)
+
+		type metadataResponse struct {
+			Metadata map[string]string `json:"metadata"`
+		}
+
+		resp := tc.makeRequest("GET", metadataPath, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var fields metadataResponse
+		json.Unmarshal(resp.Body.Bytes(), &fields)
+		assert.Empty(t, fields.Metadata)
+
+		resp = tc.makeRequest("PUT", metadataPath, map[string]interface{}{
+			"metadata": map[string]string{"client": "Acme", "project_code": "P-100"},
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		json.Unmarshal(resp.Body.Bytes(), &fields)
+		assert.Equal(t, map[string]string{"client": "Acme", "project_code": "P-100"}, fields.Metadata)
+
+		// Setting merges, null removes a field
+		resp = tc.makeRequest("PUT", metadataPath, map[string]interface{}{
+			"metadata": map[string]interface{}{"client": "Acme Corp", "project_code": nil, "shoot": "2024-06"},
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+		fields = metadataResponse{}
+		json.Unmarshal(resp.Body.Bytes(), &fields)
+		assert.Equal(t, map[string]string{"client": "Acme Corp", "shoot": "2024-06"}, fields.Metadata)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s/metadata", globex.ID), map[string]interface{}{
+			"metadata": map[string]string{"client": "Globex", "shoot": "2024-06"},
+		})
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		// Filter photos by metadata values
+		filter := func(query string) []uuid.UUID {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&%s", metaLibrary.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var response struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			ids := []uuid.UUID{}
+			for _, photo := range response.Photos {
+				ids = append(ids, photo.ID)
+			}
+			return ids
+		}
+		assert.Equal(t, []uuid.UUID{acme.ID}, filter("metadata[client]=Acme+Corp"))
+		assert.Len(t, filter("metadata[shoot]=2024-06"), 2)
+		assert.Equal(t, []uuid.UUID{globex.ID}, filter("metadata[shoot]=2024-06&metadata[client]=Globex"))
+		assert.Empty(t, filter("metadata[client]=Initech"))
+
+		// Copies keep the fields
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", acme.ID), map[string]interface{}{
+			"library_id": library.ID,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		var copied struct {
+			CopiedPhoto TestPhoto `json:"copied_photo"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &copied)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/metadata", copied.CopiedPhoto.ID), nil)
+		fields = metadataResponse{}
+		json.Unmarshal(resp.Body.Bytes(), &fields)
+		assert.Equal(t, "Acme Corp", fields.Metadata["client"])
+
+		// Delete a single field
+		resp = tc.makeRequest("DELETE", metadataPath+"/shoot", nil)
 		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", metadataPath+"/shoot", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Equal(t, []uuid.UUID{globex.ID}, filter("metadata[shoot]=2024-06"))
+
+		// Validation
+		for _, body := range []map[string]interface{}{
+			{},
+			{"metadata": map[string]string{}},
+			{"metadata": map[string]string{"client name": "Acme"}},
+			{"metadata": map[string]string{strings.Repeat("k", 65): "Acme"}},
+			{"metadata": map[string]string{"notes": strings.Repeat("a", 1001)}},
+		} {
+			resp = tc.makeRequest("PUT", metadataPath, body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
 
-		var response map[string]interface{}
-		json.Unmarshal(resp.Body.Bytes(), &response)
-		assert.Equal(t, "Photo deleted successfully", response["message"])
+		tooMany := map[string]string{}
+		for i := 0; i < 100; i++ {
+			tooMany[fmt.Sprintf("field_%d", i)] = "x"
+		}
+		resp = tc.makeRequest("PUT", metadataPath, map[string]interface{}{"metadata": tooMany})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "at most 100 metadata fields")
+		resp = tc.makeRequest("GET", metadataPath, nil)
+		fields = metadataResponse{}
+		json.Unmarshal(resp.Body.Bytes(), &fields)
+		assert.Equal(t, map[string]string{"client": "Acme Corp"}, fields.Metadata)
 
-		// Verify photo is gone from database
-		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photoToDelete.ID), nil)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/metadata", uuid.New()), nil)
 		assert.Equal(t, http.StatusNotFound, resp.Code)
 
-		// Verify file is removed
-		_, err = os.Stat(photoToDelete.FilePath)
-		assert.True(t, os.IsNotExist(err), "Photo file should be deleted")
+		// Purging a photo removes its fields
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", acme.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", acme.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var remaining int64
+		tc.DB.GetDB().Model(&models.PhotoMetadata{}).Where("photo_id = ?", acme.ID).Count(&remaining)
+		assert.Zero(t, remaining)
 	})
 
-	t.Run("Delete Photo - Not Found", func(t *testing.T) {
-		nonExistentID := uuid.New()
-		resp := tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", nonExistentID), nil)
-		assert.Equal(t, http.StatusNotFound, resp.Code)
+	t.Run("Search Photos", func(t *testing.T) {
+		searchLibrary := tc.createTestLibrary("Search Library", "For search testing")
+		pier := tc.uploadTestPhoto(searchLibrary.ID, "IMG_0001.jpg", nil, "")
+		tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", pier.ID), map[string]interface{}{"title": "Sunset at the Pier"})
+		storm := tc.uploadTestPhoto(searchLibrary.ID, "IMG_0002.jpg", nil, "")
+		tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s", storm.ID), map[string]interface{}{"description": "Storm over the pier, 100% rain"})
+		resp := tc.uploadTestFile(searchLibrary.ID, "beach_day.jpg", "image/jpeg", createTestImage())
+		require.Equal(t, http.StatusCreated, resp.Code)
+
+		search := func(q string) []uuid.UUID {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&q=%s",
+				searchLibrary.ID, url.QueryEscape(q)), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var response struct {
+				Photos []TestPhoto `json:"photos"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			ids := []uuid.UUID{}
+			for _, photo := range response.Photos {
+				ids = append(ids, photo.ID)
+			}
+			return ids
+		}
+
+		assert.ElementsMatch(t, []uuid.UUID{pier.ID, storm.ID}, search("PIER"))
+		assert.Equal(t, []uuid.UUID{storm.ID}, search("100%"))
+		assert.Len(t, search("beach_"), 1)
+		assert.Empty(t, search("mountain"))
+		assert.Len(t, search("  "), 3)
+	})
+
+	t.Run("Serve Photo File", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "serve.jpg", nil, "")
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		// Verify headers
+		assert.Equal(t, uploadedPhoto.MimeType, resp.Header().Get("Content-Type"))
+		assert.Contains(t, resp.Header().Get("Content-Disposition"), uploadedPhoto.OriginalName)
+
+		// Verify we got actual image data
+		assert.True(t, resp.Body.Len() > 0)
+	})
+
+	t.Run("Serve Photo File - Conditional and Range Requests", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "cached.jpg", nil, "")
+		url := fmt.Sprintf("/api/v1/photos/%s/file", uploadedPhoto.ID)
+		original := createTestImage()
+
+		serve := func(headers map[string]string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("GET", url, nil)
+			for name, value := range headers {
+				req.Header.Set(name, value)
+			}
+			resp := httptest.NewRecorder()
+			tc.Router.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := serve(nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		etag := resp.Header().Get("ETag")
+		lastModified := resp.Header().Get("Last-Modified")
+		assert.NotEmpty(t, etag)
+		assert.NotEmpty(t, lastModified)
+		assert.Equal(t, "bytes", resp.Header().Get("Accept-Ranges"))
+
+		resp = serve(map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+		assert.Zero(t, resp.Body.Len())
+		resp = serve(map[string]string{"If-None-Match": `"stale"`})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = serve(map[string]string{"If-Modified-Since": lastModified})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+
+		// Resuming a download
+		resp = serve(map[string]string{"Range": "bytes=10-19"})
+		require.Equal(t, http.StatusPartialContent, resp.Code)
+		assert.Equal(t, original[10:20], resp.Body.Bytes())
+		assert.Equal(t, fmt.Sprintf("bytes 10-19/%d", len(original)), resp.Header().Get("Content-Range"))
+		resp = serve(map[string]string{"Range": "bytes=10-19", "If-Range": `"stale"`})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, original, resp.Body.Bytes())
+
+		// Encrypted files are decrypted as they're served, with the same support
+		tc.Config.EncryptionSecret = "test-encryption-secret"
+		defer func() { tc.Config.EncryptionSecret = "" }()
+		resp = tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name": "Cached Encrypted", "images": filepath.Join(tc.TempDir, "cached-encrypted"), "encrypted": true,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var encryptedLibrary TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &encryptedLibrary)
+		url = fmt.Sprintf("/api/v1/photos/%s/file", tc.uploadTestPhoto(encryptedLibrary.ID, "sealed.jpg", nil, "").ID)
+
+		resp = serve(nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, original, resp.Body.Bytes())
+		resp = serve(map[string]string{"If-None-Match": resp.Header().Get("ETag")})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+		resp = serve(map[string]string{"Range": "bytes=10-19"})
+		require.Equal(t, http.StatusPartialContent, resp.Code)
+		assert.Equal(t, original[10:20], resp.Body.Bytes())
+	})
+
+	t.Run("Serve Photo File - Bandwidth Limited", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "throttled.jpg", nil, "")
+
+		tc.Config.DownloadRateLimit = 64 * 1024
+		defer func() { tc.Config.DownloadRateLimit = 0 }()
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		assert.Equal(t, createTestImage(), resp.Body.Bytes())
+	})
+
+	t.Run("Serve Photo File - Signed URL", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "signed.jpg", nil, "")
+		assert.Contains(t, uploadedPhoto.FileURL, fmt.Sprintf("/api/v1/photos/%s/file?", uploadedPhoto.ID))
+		assert.Contains(t, uploadedPhoto.FileURL, "signature=")
+
+		// The issued URL works
+		resp := tc.makeRequest("GET", uploadedPhoto.FileURL, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		// A signature for another photo is rejected
+		otherPhoto := tc.uploadTestPhoto(library.ID, "signed_other.jpg", nil, "")
+		forged := strings.Replace(otherPhoto.FileURL, otherPhoto.ID.String(), uploadedPhoto.ID.String(), 1)
+		resp = tc.makeRequest("GET", forged, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		// Expired URLs are rejected
+		signer := signing.NewSigner(tc.Config.URLSigningSecret, time.Hour)
+		expired := signer.SignPathUntil(fmt.Sprintf("/api/v1/photos/%s/file", uploadedPhoto.ID), time.Now().Add(-time.Minute))
+		resp = tc.makeRequest("GET", expired, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Signed URL has expired", response["error"])
+
+		// Unsigned access is only rejected once signed URLs are required
+		unsigned := fmt.Sprintf("/api/v1/photos/%s/file", uploadedPhoto.ID)
+		resp = tc.makeRequest("GET", unsigned, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		tc.Config.RequireSignedURLs = true
+		defer func() { tc.Config.RequireSignedURLs = false }()
+		resp = tc.makeRequest("GET", unsigned, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		resp = tc.makeRequest("GET", uploadedPhoto.FileURL, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Download URL", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "download.jpg", nil, "")
+
+		tc.Config.RequireSignedURLs = true
+		defer func() { tc.Config.RequireSignedURLs = false }()
+
+		type downloadURL struct {
+			URL       string    `json:"url"`
+			Path      string    `json:"path"`
+			ExpiresAt time.Time `json:"expires_at"`
+			OneTime   bool      `json:"one_time"`
+		}
+
+		// Short-lived URL, reusable until it expires
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/download-url", uploadedPhoto.ID), map[string]interface{}{"expires_in": 300})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		var issued downloadURL
+		json.Unmarshal(resp.Body.Bytes(), &issued)
+		assert.True(t, strings.HasPrefix(issued.URL, "http://"))
+		assert.True(t, strings.HasSuffix(issued.URL, issued.Path))
+		assert.WithinDuration(t, time.Now().Add(5*time.Minute), issued.ExpiresAt, 5*time.Second)
+		assert.False(t, issued.OneTime)
+
+		for i := 0; i < 2; i++ {
+			resp = tc.makeRequest("GET", issued.Path, nil)
+			assert.Equal(t, http.StatusOK, resp.Code)
+		}
+
+		// One-time URL
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/download-url", uploadedPhoto.ID), map[string]interface{}{"one_time": true})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		json.Unmarshal(resp.Body.Bytes(), &issued)
+		assert.True(t, issued.OneTime)
+
+		resp = tc.makeRequest("GET", issued.Path, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("GET", issued.Path, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Signed URL has already been used", response["error"])
+
+		// The body is optional
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/download-url", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/download-url", uploadedPhoto.ID), map[string]interface{}{"expires_in": -1})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/download-url", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Signed URL", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "embedded.jpg", nil, "")
+		signedURL := fmt.Sprintf("/api/v1/photos/%s/signed-url", uploadedPhoto.ID)
+
+		tc.Config.RequireSignedURLs = true
+		defer func() { tc.Config.RequireSignedURLs = false }()
+
+		var issued struct {
+			URL       string    `json:"url"`
+			Path      string    `json:"path"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+
+		// The file, usable until it expires
+		resp := tc.makeRequest("POST", signedURL, map[string]interface{}{"expires_in": 3600})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		json.Unmarshal(resp.Body.Bytes(), &issued)
+		assert.True(t, strings.HasSuffix(issued.URL, issued.Path))
+		assert.True(t, strings.HasPrefix(issued.Path, fmt.Sprintf("/api/v1/photos/%s/file?", uploadedPhoto.ID)))
+		assert.WithinDuration(t, time.Now().Add(time.Hour), issued.ExpiresAt, 5*time.Second)
+		for i := 0; i < 2; i++ {
+			resp = tc.makeRequest("GET", issued.Path, nil)
+			assert.Equal(t, http.StatusOK, resp.Code)
+		}
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		// A thumbnail, the signature doesn't cover the thumbnail's file
+		resp = tc.makeRequest("POST", signedURL, map[string]interface{}{"kind": "thumbnail", "size": "medium"})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		json.Unmarshal(resp.Body.Bytes(), &issued)
+		assert.Contains(t, issued.Path, "/thumbnail?")
+		assert.Contains(t, issued.Path, "size=medium")
+		resp = tc.makeRequest("GET", issued.Path, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		forged := strings.Replace(issued.Path, "/thumbnail?", "/file?", 1)
+		resp = tc.makeRequest("GET", forged, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		for _, body := range []map[string]interface{}{
+			{"expires_in": 8 * 24 * 3600},
+			{"kind": "motion"},
+			{"size": "medium"},
+			{"kind": "thumbnail", "size": "huge"},
+		} {
+			resp = tc.makeRequest("POST", signedURL, body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/signed-url", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Export Photos", func(t *testing.T) {
+		first := tc.uploadTestPhoto(library.ID, "export1.jpg", nil, "export-tag")
+		second := tc.uploadTestPhoto(library.ID, "export2.jpg", nil, "export-tag")
+
+		readZip := func(body []byte) map[string][]byte {
+			archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			require.NoError(t, err)
+			entries := make(map[string][]byte)
+			for _, f := range archive.File {
+				rc, err := f.Open()
+				require.NoError(t, err)
+				data, err := io.ReadAll(rc)
+				rc.Close()
+				require.NoError(t, err)
+				entries[f.Name] = data
+			}
+			return entries
+		}
+
+		// By ID, with colliding original names de-duplicated
+		resp := tc.makeRequest("POST", "/api/v1/photos/export", map[string]interface{}{
+			"photo_ids": []string{first.ID.String(), second.ID.String()},
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+		assert.Contains(t, resp.Header().Get("Content-Disposition"), "attachment")
+
+		entries := readZip(resp.Body.Bytes())
+		require.Len(t, entries, 2)
+		original, _ := os.ReadFile(first.FilePath)
+		assert.Equal(t, original, entries["test.jpg"])
+		assert.Contains(t, entries, "test (2).jpg")
+
+		// By filter, resized
+		resp = tc.makeRequest("POST", "/api/v1/photos/export", map[string]interface{}{
+			"filter": map[string]interface{}{"tag": "export-tag"},
+			"size":   "small",
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		entries = readZip(resp.Body.Bytes())
+		require.Len(t, entries, 2)
+		for name, data := range entries {
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+			require.NoError(t, err, name)
+			assert.Equal(t, "jpeg", format)
+			assert.LessOrEqual(t, cfg.Width, thumbnails.Sizes["small"])
+		}
+
+		// Invalid selections
+		resp = tc.makeRequest("POST", "/api/v1/photos/export", map[string]interface{}{})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", "/api/v1/photos/export", map[string]interface{}{
+			"photo_ids": []string{first.ID.String()},
+			"size":      "huge",
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", "/api/v1/photos/export", map[string]interface{}{
+			"photo_ids": []string{first.ID.String(), uuid.New().String()},
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("POST", "/api/v1/photos/export", map[string]interface{}{
+			"filter": map[string]interface{}{"tag": "no-such-tag"},
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Download Selected Photos", func(t *testing.T) {
+		var photos []TestPhoto
+		for _, name := range []string{"first.jpg", "second.jpg"} {
+			resp := tc.uploadTestFile(library.ID, name, "image/jpeg", createTestImage())
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			photos = append(photos, photo)
+		}
+
+		// Entries follow the listed order, duplicates included once
+		resp := tc.makeRequest("POST", "/api/v1/photos/download", map[string]interface{}{
+			"photo_ids": []uuid.UUID{photos[1].ID, photos[0].ID, photos[1].ID},
+		})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+		assert.Contains(t, resp.Header().Get("Content-Disposition"), "attachment")
+
+		body := resp.Body.Bytes()
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		require.Len(t, archive.File, 2)
+		assert.Equal(t, "second.jpg", archive.File[0].Name)
+		assert.Equal(t, "first.jpg", archive.File[1].Name)
+
+		resp = tc.makeRequest("POST", "/api/v1/photos/download", map[string]interface{}{"photo_ids": []uuid.UUID{}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", "/api/v1/photos/download", map[string]interface{}{
+			"photo_ids": []uuid.UUID{photos[0].ID},
+			"size":      "huge",
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", "/api/v1/photos/download", map[string]interface{}{
+			"photo_ids": []uuid.UUID{photos[0].ID, uuid.New()},
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Motion Photo", func(t *testing.T) {
+		clip := createTestClip()
+		fields := map[string]string{"library_id": library.ID.String()}
+		resp := tc.makeMultipartRequest("/api/v1/photos/upload", fields, map[string][]byte{"photo": createTestMotionPhoto(clip)})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		var motionPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &motionPhoto)
+		assert.True(t, motionPhoto.HasMotion)
+		assert.Contains(t, motionPhoto.MotionURL, fmt.Sprintf("/api/v1/photos/%s/motion", motionPhoto.ID))
+
+		resp = tc.makeRequest("GET", motionPhoto.MotionURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "video/mp4", resp.Header().Get("Content-Type"))
+		assert.Equal(t, clip, resp.Body.Bytes())
+
+		// Range requests work for seeking players
+		req, _ := http.NewRequest("GET", motionPhoto.MotionURL, nil)
+		req.Header.Set("Range", "bytes=4-7")
+		rangeResp := httptest.NewRecorder()
+		tc.Router.ServeHTTP(rangeResp, req)
+		assert.Equal(t, http.StatusPartialContent, rangeResp.Code)
+		assert.Equal(t, "ftyp", rangeResp.Body.String())
+
+		// The still is still served whole
+		resp = tc.makeRequest("GET", motionPhoto.FileURL, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		// Copies keep the flag
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", motionPhoto.ID), map[string]interface{}{"library_id": library.ID})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		var copied struct {
+			CopiedPhoto TestPhoto `json:"copied_photo"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &copied)
+		assert.True(t, copied.CopiedPhoto.HasMotion)
+
+		plain := tc.uploadTestPhoto(library.ID, "still.jpg", nil, "")
+		assert.False(t, plain.HasMotion)
+		assert.Empty(t, plain.MotionURL)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/motion", plain.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Upload RAW", func(t *testing.T) {
+		preview := createTestImageOfSize(120, 80)
+		resp := tc.uploadTestFile(library.ID, "DSC_0042.NEF", "application/octet-stream", createTestRAW(6000, 4000, preview))
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		var rawPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &rawPhoto)
+		assert.Equal(t, "NEF", rawPhoto.RawFormat)
+		assert.Equal(t, "image/x-nikon-nef", rawPhoto.MimeType)
+		assert.Equal(t, 6000, rawPhoto.Width)
+		assert.Equal(t, 4000, rawPhoto.Height)
+		assert.Contains(t, rawPhoto.PreviewURL, fmt.Sprintf("/api/v1/photos/%s/preview", rawPhoto.ID))
+
+		// The original is kept as uploaded
+		resp = tc.makeRequest("GET", rawPhoto.FileURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/x-nikon-nef", resp.Header().Get("Content-Type"))
+		assert.Equal(t, createTestRAW(6000, 4000, preview), resp.Body.Bytes())
+
+		resp = tc.makeRequest("GET", rawPhoto.PreviewURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		assert.Equal(t, preview, resp.Body.Bytes())
+
+		// Thumbnails are rendered from the embedded preview
+		resp = tc.makeRequest("GET", rawPhoto.ThumbnailURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 120, cfg.Width)
+
+		// Files with a RAW extension have to be RAW files
+		resp = tc.uploadTestFile(library.ID, "fake.cr2", "application/octet-stream", []byte("not a raw file"))
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		plain := tc.uploadTestPhoto(library.ID, "not_raw.jpg", nil, "")
+		assert.Empty(t, plain.RawFormat)
+		assert.Empty(t, plain.PreviewURL)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/preview", plain.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Upload Video", func(t *testing.T) {
+		recorded := time.Date(2024, 7, 4, 18, 30, 0, 0, time.UTC)
+		clip := createTestVideo(12, recorded)
+		resp := tc.uploadTestFile(library.ID, "IMG_0100.MOV", "video/quicktime", clip)
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		var vid struct {
+			TestPhoto
+			Duration float64 `json:"duration"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &vid)
+		assert.Equal(t, "video/quicktime", vid.MimeType)
+		assert.Equal(t, 12.0, vid.Duration)
+		assert.Equal(t, 1920, vid.Width)
+		assert.Equal(t, 1080, vid.Height)
+		require.NotNil(t, vid.TakenAt)
+		assert.True(t, recorded.Equal(*vid.TakenAt))
+
+		// Players seek with range requests
+		req, _ := http.NewRequest("GET", vid.FileURL, nil)
+		req.Header.Set("Range", "bytes=4-7")
+		rangeResp := httptest.NewRecorder()
+		tc.Router.ServeHTTP(rangeResp, req)
+		assert.Equal(t, http.StatusPartialContent, rangeResp.Code)
+		assert.Equal(t, "video/quicktime", rangeResp.Header().Get("Content-Type"))
+		assert.Equal(t, "ftyp", rangeResp.Body.String())
+
+		// Thumbnails show a poster frame, which needs ffmpeg
+		if !video.PostersAvailable() {
+			resp = tc.makeRequest("GET", vid.ThumbnailURL, nil)
+			assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+		}
+
+		resp = tc.uploadTestFile(library.ID, "broken.mp4", "video/mp4", []byte("not a video"))
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Video Frame", func(t *testing.T) {
+		resp := tc.uploadTestFile(library.ID, "scrub.mp4", "video/mp4", createTestVideo(12, time.Now()))
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var clip TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &clip)
+		frameURL := func(query string) string {
+			return fmt.Sprintf("/api/v1/photos/%s/frame?%s", clip.ID, query)
+		}
+
+		// Without ffmpeg there are no frames
+		defer func(path string) { video.FFmpegPath = path }(video.FFmpegPath)
+		video.FFmpegPath = filepath.Join(tc.TempDir, "no-ffmpeg")
+		resp = tc.makeRequest("GET", frameURL("t=3"), nil)
+		assert.Equal(t, http.StatusNotImplemented, resp.Code)
+
+		// A stand-in ffmpeg records its calls and prints a frame
+		frame := filepath.Join(tc.TempDir, "frame.jpg")
+		require.NoError(t, os.WriteFile(frame, createTestImageOfSize(320, 180), 0644))
+		calls := filepath.Join(tc.TempDir, "ffmpeg-calls")
+		video.FFmpegPath = filepath.Join(tc.TempDir, "ffmpeg")
+		script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\ncat %s\n", calls, frame)
+		require.NoError(t, os.WriteFile(video.FFmpegPath, []byte(script), 0755))
+		ffmpegCalls := func() []string {
+			data, _ := os.ReadFile(calls)
+			return strings.Fields(strings.ReplaceAll(string(data), "\n", " | "))
+		}
+
+		resp = tc.makeRequest("GET", frameURL("t=3.5&w=160"), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, 160, cfg.Width)
+		assert.Contains(t, ffmpegCalls(), "3.500")
+
+		// Frames are cached per timestamp
+		before := len(ffmpegCalls())
+		resp = tc.makeRequest("GET", frameURL("t=3.5&w=160"), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Len(t, ffmpegCalls(), before)
+		resp = tc.makeRequest("GET", frameURL("t=4&w=160"), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Greater(t, len(ffmpegCalls()), before)
+		assert.Contains(t, ffmpegCalls(), "4.000")
+
+		for _, query := range []string{"", "t=abc", "t=-1", "t=12", "t=NaN"} {
+			resp = tc.makeRequest("GET", frameURL(query), nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		}
+
+		still := tc.uploadTestPhoto(library.ID, "still.jpg", nil, "")
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/frame?t=0", still.ID), nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Upload Document", func(t *testing.T) {
+		pdf := createTestPDF(3, createTestImageOfSize(600, 800))
+
+		// Libraries don't accept documents unless they opt in
+		resp := tc.uploadTestDocument(library.ID, pdf)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		payload := map[string]interface{}{
+			"name":             "Family Archive",
+			"images":           filepath.Join(tc.TempDir, "family_archive"),
+			"accept_documents": true,
+		}
+		resp = tc.makeRequest("POST", "/api/v1/libraries", payload)
+		require.Equal(t, http.StatusCreated, resp.Code)
+		var archive TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &archive)
+
+		resp = tc.uploadTestDocument(archive.ID, pdf)
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		var document TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &document)
+		assert.Equal(t, "application/pdf", document.MimeType)
+		assert.Equal(t, 3, document.PageCount)
+		assert.Equal(t, 600, document.Width)
+		assert.Equal(t, 800, document.Height)
+
+		// The thumbnail shows the scanned first page
+		resp = tc.makeRequest("GET", document.ThumbnailURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, thumbnails.Sizes["small"], cfg.Height)
+
+		// Documents can't be copied into libraries that don't accept them
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", document.ID), map[string]interface{}{"library_id": library.ID})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.uploadTestDocument(archive.ID, []byte("not a pdf"))
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Encrypted Library", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"name":      "Private",
+			"images":    filepath.Join(tc.TempDir, "private"),
+			"encrypted": true,
+		}
+
+		// Encrypted libraries need a master secret
+		resp := tc.makeRequest("POST", "/api/v1/libraries", payload)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		tc.Config.EncryptionSecret = "test-encryption-secret"
+		defer func() { tc.Config.EncryptionSecret = "" }()
+
+		resp = tc.makeRequest("POST", "/api/v1/libraries", payload)
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var private TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &private)
+
+		original := createTestImageOfSize(400, 300)
+		resp = tc.makeMultipartRequest("/api/v1/photos/upload", map[string]string{"library_id": private.ID.String()}, map[string][]byte{"photo": original})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var photo TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &photo)
+		assert.True(t, photo.Encrypted)
+		assert.Equal(t, int64(len(original)), photo.FileSize)
+		assert.Equal(t, 400, photo.Width)
+
+		// Only ciphertext is stored
+		stored, err := os.ReadFile(photo.FilePath)
+		require.NoError(t, err)
+		assert.NotEqual(t, original, stored)
+		assert.False(t, bytes.Contains(stored, original[:64]))
+
+		resp = tc.makeRequest("GET", photo.FileURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, original, resp.Body.Bytes())
+
+		req := httptest.NewRequest("GET", photo.FileURL, nil)
+		req.Header.Set("Range", "bytes=10-19")
+		rangeResp := httptest.NewRecorder()
+		tc.Router.ServeHTTP(rangeResp, req)
+		assert.Equal(t, http.StatusPartialContent, rangeResp.Code)
+		assert.Equal(t, original[10:20], rangeResp.Body.Bytes())
+
+		// Renditions are rendered on request and never written to disk
+		resp = tc.makeRequest("GET", photo.ThumbnailURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, thumbnails.Sizes["small"], cfg.Width)
+		assert.NoFileExists(t, thumbnails.Path(private.Images, photo.FilePath, "small"))
+
+		// Copies into a plain library are decrypted
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", photo.ID), map[string]interface{}{"library_id": library.ID})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var copied struct {
+			CopiedPhoto TestPhoto `json:"copied_photo"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &copied)
+		assert.False(t, copied.CopiedPhoto.Encrypted)
+		plain, err := os.ReadFile(copied.CopiedPhoto.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, original, plain)
+
+		// Without the secret the files can't be read
+		tc.Config.EncryptionSecret = ""
+		resp = tc.makeRequest("GET", photo.FileURL, nil)
+		assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	})
+
+	t.Run("Insufficient Disk Space", func(t *testing.T) {
+		photo := tc.uploadTestPhoto(library.ID, "space.jpg", nil, "")
+		entries, _ := os.ReadDir(library.Images)
+
+		// A reserve larger than any disk leaves no room for new files
+		tc.Config.DiskSpaceReserve = math.MaxInt64 / 2
+		defer func() { tc.Config.DiskSpaceReserve = 0 }()
+
+		resp := tc.makeMultipartRequest("/api/v1/photos/upload", map[string]string{"library_id": library.ID.String()}, map[string][]byte{"photo": createTestImage()})
+		assert.Equal(t, http.StatusInsufficientStorage, resp.Code)
+		assert.Contains(t, resp.Body.String(), "disk space")
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", photo.ID), map[string]interface{}{"library_id": library.ID})
+		assert.Equal(t, http.StatusInsufficientStorage, resp.Code)
+
+		// Nothing was written
+		after, _ := os.ReadDir(library.Images)
+		assert.Len(t, after, len(entries))
+	})
+
+	t.Run("Serve Photo File - Offloaded", func(t *testing.T) {
+		photo := tc.uploadTestPhoto(library.ID, "offload.jpg", nil, "")
+		defer func() { tc.Config.FileOffload, tc.Config.FileOffloadMap = "", "" }()
+
+		tc.Config.FileOffload = "x-sendfile"
+		resp := tc.makeRequest("GET", photo.FileURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		absPath, _ := filepath.Abs(photo.FilePath)
+		assert.Equal(t, absPath, resp.Header().Get("X-Sendfile"))
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		assert.Empty(t, resp.Body.Bytes())
+
+		// nginx gets a URI in the internal location mapped to the library directory
+		tc.Config.FileOffload = "x-accel-redirect"
+		tc.Config.FileOffloadMap = tc.TempDir + "=/protected/, /elsewhere=/other"
+		resp = tc.makeRequest("GET", photo.FileURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		rel, _ := filepath.Rel(tc.TempDir, photo.FilePath)
+		assert.Equal(t, "/protected/"+strings.ReplaceAll(filepath.ToSlash(rel), " ", "%20"), resp.Header().Get("X-Accel-Redirect"))
+		assert.Empty(t, resp.Body.Bytes())
+
+		resp = tc.makeRequest("GET", photo.ThumbnailURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Header().Get("X-Accel-Redirect"), "/protected/")
+		assert.Contains(t, resp.Header().Get("X-Accel-Redirect"), ".thumbnails")
+
+		// Files outside the mapped directories are served directly
+		tc.Config.FileOffloadMap = "/elsewhere=/other"
+		resp = tc.makeRequest("GET", photo.FileURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("X-Accel-Redirect"))
+		assert.Equal(t, createTestImage(), resp.Body.Bytes())
+	})
+
+	t.Run("Serve Photo File - CDN URLs", func(t *testing.T) {
+		photo := tc.uploadTestPhoto(library.ID, "cdn.jpg", nil, "")
+
+		cdnSigner := signing.NewSigner(tc.Config.URLSigningSecret, 24*time.Hour)
+		previous := models.FileURLFunc
+		models.FileURLFunc = cdn.NewURLBuilder("https://cdn.example.com", cdnSigner).URL
+		defer func() { models.FileURLFunc = previous }()
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var fetched TestPhoto
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &fetched))
+
+		// URLs point at the CDN, keyed by the file's contents
+		fileURL, err := url.Parse(fetched.FileURL)
+		require.NoError(t, err)
+		assert.Equal(t, "cdn.example.com", fileURL.Host)
+		assert.Equal(t, fmt.Sprintf("/api/v1/photos/%s/file", photo.ID), fileURL.Path)
+		assert.NotEmpty(t, fileURL.Query().Get(signing.SignatureParam))
+		assert.Equal(t, fetched.Checksum[:16], fileURL.Query().Get(cdn.VersionParam))
+		assert.True(t, strings.HasPrefix(fetched.ThumbnailURL, "https://cdn.example.com/"))
+
+		// The origin serves CDN cache misses with the same signature
+		resp = tc.makeRequest("GET", fileURL.RequestURI(), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, createTestImage(), resp.Body.Bytes())
+
+		tampered := fileURL.Query()
+		tampered.Set(signing.ExpiresParam, "9999999999")
+		resp = tc.makeRequest("GET", fileURL.Path+"?"+tampered.Encode(), nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	})
+
+	t.Run("Serve Photo File - Resized", func(t *testing.T) {
+		resp := tc.uploadTestFile(library.ID, "wide.jpg", "image/jpeg", createTestImageOfSize(800, 600))
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var uploadedPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &uploadedPhoto)
+
+		for _, tt := range []struct {
+			query         string
+			width, height int
+		}{
+			{"w=200", 200, 150},
+			{"h=300", 400, 300},
+			{"w=200&h=200", 200, 150},
+			{"w=100&h=100&fit=cover", 100, 100},
+			{"w=2000", 800, 600}, // Never enlarged
+		} {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file?%s", uploadedPhoto.ID, tt.query), nil)
+			require.Equal(t, http.StatusOK, resp.Code, tt.query)
+			assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, tt.width, cfg.Width, tt.query)
+			assert.Equal(t, tt.height, cfg.Height, tt.query)
+		}
+
+		// Results are cached on disk
+		cached, err := filepath.Glob(filepath.Join(tc.Config.ResizeCacheDir, uploadedPhoto.ID.String()+"_*"))
+		require.NoError(t, err)
+		assert.Len(t, cached, 5)
+
+		// Signed URLs take the size parameters too
+		resp = tc.makeRequest("GET", uploadedPhoto.FileURL+"&w=200", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		for _, query := range []string{"w=0", "w=abc", "h=99999", "w=100&fit=cover", "w=100&fit=stretch"} {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file?%s", uploadedPhoto.ID, query), nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		}
+	})
+
+	t.Run("Verify Photo", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "verified.jpg", nil, "")
+		original, err := os.ReadFile(uploadedPhoto.FilePath)
+		require.NoError(t, err)
+		assert.NotEmpty(t, uploadedPhoto.Checksum)
+		assert.Nil(t, uploadedPhoto.VerifiedAt)
+
+		type verifyResult struct {
+			Status   string `json:"status"`
+			Expected string `json:"expected"`
+			Actual   string `json:"actual"`
+		}
+		verify := func(id uuid.UUID) (verifyResult, TestPhoto) {
+			resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/verify", id), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var result verifyResult
+			json.Unmarshal(resp.Body.Bytes(), &result)
+			resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", id), nil)
+			var photo TestPhoto
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			return result, photo
+		}
+
+		result, photo := verify(uploadedPhoto.ID)
+		assert.Equal(t, "ok", result.Status)
+		assert.Equal(t, uploadedPhoto.Checksum, result.Actual)
+		assert.False(t, photo.Corrupt)
+		assert.NotNil(t, photo.VerifiedAt)
+
+		// A flipped bit is caught and the recorded checksum kept
+		damaged := append([]byte(nil), original...)
+		damaged[len(damaged)/2] ^= 0x01
+		require.NoError(t, os.WriteFile(uploadedPhoto.FilePath, damaged, 0644))
+		result, photo = verify(uploadedPhoto.ID)
+		assert.Equal(t, "corrupt", result.Status)
+		assert.Equal(t, uploadedPhoto.Checksum, result.Expected)
+		assert.NotEqual(t, result.Expected, result.Actual)
+		assert.True(t, photo.Corrupt)
+		assert.Equal(t, uploadedPhoto.Checksum, photo.Checksum)
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&corrupt=true", library.ID), nil)
+		var listResponse struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listResponse)
+		require.Len(t, listResponse.Photos, 1)
+		assert.Equal(t, uploadedPhoto.ID, listResponse.Photos[0].ID)
+
+		// Restoring the file from a backup clears the flag
+		require.NoError(t, os.WriteFile(uploadedPhoto.FilePath, original, 0644))
+		result, photo = verify(uploadedPhoto.ID)
+		assert.Equal(t, "ok", result.Status)
+		assert.False(t, photo.Corrupt)
+
+		// Encrypted files fail decryption once changed
+		tc.Config.EncryptionSecret = "test-encryption-secret"
+		defer func() { tc.Config.EncryptionSecret = "" }()
+		resp = tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name": "Verified Vault", "images": filepath.Join(tc.TempDir, "verified-vault"), "encrypted": true,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var vault TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &vault)
+		sealed := tc.uploadTestPhoto(vault.ID, "sealed.jpg", nil, "")
+		result, _ = verify(sealed.ID)
+		assert.Equal(t, "ok", result.Status)
+
+		ciphertext, err := os.ReadFile(sealed.FilePath)
+		require.NoError(t, err)
+		ciphertext[len(ciphertext)-1] ^= 0x01
+		require.NoError(t, os.WriteFile(sealed.FilePath, ciphertext, 0644))
+		result, photo = verify(sealed.ID)
+		assert.Equal(t, "corrupt", result.Status)
+		assert.True(t, photo.Corrupt)
+
+		// The library job checks every photo
+		require.NoError(t, os.Remove(sealed.FilePath))
+		tc.uploadTestPhoto(vault.ID, "intact.jpg", nil, "")
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/libraries/%s/verify", vault.ID), nil)
+		require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+		var job map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &job)
+		job = tc.waitForJob(job["id"].(string))
+		assert.Equal(t, "completed", job["status"])
+		statuses := map[string]int{}
+		for _, r := range job["results"].([]interface{}) {
+			statuses[r.(map[string]interface{})["status"].(string)]++
+		}
+		assert.Equal(t, map[string]int{"ok": 1, "missing": 1}, statuses)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/verify", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Rotate Photo", func(t *testing.T) {
+		resp := tc.uploadTestFile(library.ID, "sideways.jpg", "image/jpeg", createTestImageOfSize(80, 60))
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var uploadedPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &uploadedPhoto)
+
+		// Render a thumbnail so there is something stale to replace
+		resp = tc.makeRequest("GET", uploadedPhoto.ThumbnailURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/rotate", uploadedPhoto.ID), map[string]interface{}{"degrees": 90})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var rotated TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &rotated)
+		assert.Equal(t, 60, rotated.Width)
+		assert.Equal(t, 80, rotated.Height)
+		assert.NotEqual(t, uploadedPhoto.Checksum, rotated.Checksum)
+
+		// The file and its thumbnail are both turned
+		for _, url := range []string{rotated.FileURL, rotated.ThumbnailURL} {
+			resp = tc.makeRequest("GET", url, nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, 60, cfg.Width, url)
+			assert.Equal(t, 80, cfg.Height, url)
+		}
+
+		// Flipping keeps the size
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/rotate", uploadedPhoto.ID), map[string]interface{}{"flip": "horizontal"})
+		require.Equal(t, http.StatusOK, resp.Code)
+		json.Unmarshal(resp.Body.Bytes(), &rotated)
+		assert.Equal(t, 60, rotated.Width)
+
+		for _, payload := range []map[string]interface{}{{}, {"degrees": 45}, {"flip": "diagonal"}} {
+			resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/rotate", uploadedPhoto.ID), payload)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, payload)
+		}
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/rotate", uuid.New()), map[string]interface{}{"degrees": 90})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		// Only JPEG and PNG files are rewritten
+		resp = tc.uploadTestFile(library.ID, "clip.mp4", "video/mp4", createTestVideo(3, time.Now()))
+		require.Equal(t, http.StatusCreated, resp.Code)
+		var clip TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &clip)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/rotate", clip.ID), map[string]interface{}{"degrees": 90})
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+	})
+
+	t.Run("Edit Photo Versions", func(t *testing.T) {
+		resp := tc.uploadTestFile(library.ID, "landscape.jpg", "image/jpeg", createTestImageOfSize(200, 100))
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var photo TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &photo)
+		stored, err := os.ReadFile(photo.FilePath)
+		require.NoError(t, err)
+
+		imageSize := func(url string) (int, int) {
+			resp := tc.makeRequest("GET", url, nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(resp.Body.Bytes()))
+			require.NoError(t, err)
+			return cfg.Width, cfg.Height
+		}
+		edit := func(body map[string]interface{}) models.PhotoVersion {
+			resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/edits", photo.ID), body)
+			require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+			var version models.PhotoVersion
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &version))
+			return version
+		}
+		fileURL := fmt.Sprintf("/api/v1/photos/%s/file", photo.ID)
+
+		// Crop the left quarter and stand it up
+		first := edit(map[string]interface{}{"operations": []map[string]interface{}{
+			{"type": "crop", "x": 0, "y": 0, "width": 0.25, "height": 1},
+			{"type": "rotate", "degrees": 90},
+		}})
+		assert.Equal(t, 1, first.Number)
+		w, h := imageSize(fileURL)
+		assert.Equal(t, 100, w)
+		assert.Equal(t, 50, h)
+
+		// The original is still there, untouched
+		resp = tc.makeRequest("GET", fileURL+"?version=original", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, stored, resp.Body.Bytes())
+		current, _ := os.ReadFile(photo.FilePath)
+		assert.Equal(t, stored, current)
+
+		// The photo points clients at the edited version
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
+		var edited TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &edited)
+		assert.Equal(t, 1, edited.EditVersion)
+		resp = tc.makeRequest("GET", fileURL, nil)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		assert.NotEqual(t, fmt.Sprintf("%q", photo.Checksum[:16]), resp.Header().Get("ETag"))
+		w, h = imageSize(edited.ThumbnailURL)
+		assert.Equal(t, 100, w)
+		assert.Equal(t, 50, h)
+		w, h = imageSize(fileURL + "?w=50")
+		assert.Equal(t, 50, w)
+		assert.Equal(t, 25, h)
+
+		// Later edits stack on the served version unless started over
+		second := edit(map[string]interface{}{"operations": []map[string]interface{}{{"type": "exposure", "stops": 0.5}}})
+		assert.Equal(t, 2, second.Number)
+		assert.Len(t, second.Operations, 3)
+		third := edit(map[string]interface{}{
+			"operations":    []map[string]interface{}{{"type": "filter", "filter": "grayscale"}},
+			"from_original": true,
+		})
+		assert.Equal(t, 3, third.Number)
+		assert.Len(t, third.Operations, 1)
+		w, h = imageSize(fileURL)
+		assert.Equal(t, 200, w)
+		assert.Equal(t, 100, h)
+		w, _ = imageSize(fileURL + "?version=1")
+		assert.Equal(t, 100, w)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/edits", photo.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var history struct {
+			Current  int                   `json:"current"`
+			Versions []models.PhotoVersion `json:"versions"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &history)
+		assert.Equal(t, 3, history.Current)
+		require.Len(t, history.Versions, 3)
+		assert.Equal(t, "crop", history.Versions[0].Operations[0].Type)
+
+		// Going back to the original keeps the versions, and numbers aren't reused
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/edits/restore", photo.ID), map[string]interface{}{"version": 0})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		json.Unmarshal(resp.Body.Bytes(), &edited)
+		assert.Equal(t, 0, edited.EditVersion)
+		resp = tc.makeRequest("GET", fileURL, nil)
+		assert.Equal(t, stored, resp.Body.Bytes())
+		assert.Equal(t, 4, edit(map[string]interface{}{"operations": []map[string]interface{}{{"type": "rotate", "flip": "horizontal"}}}).Number)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/edits/restore", photo.ID), map[string]interface{}{"version": 1})
+		require.Equal(t, http.StatusOK, resp.Code)
+		w, _ = imageSize(fileURL)
+		assert.Equal(t, 100, w)
+
+		// Errors
+		for _, body := range []map[string]interface{}{
+			{},
+			{"operations": []map[string]interface{}{}},
+			{"operations": []map[string]interface{}{{"type": "blur"}}},
+			{"operations": []map[string]interface{}{{"type": "crop", "x": 0.5, "width": 0.75, "height": 1}}},
+			{"operations": []map[string]interface{}{{"type": "exposure", "stops": 10}}},
+		} {
+			resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/edits", photo.ID), body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/edits/restore", photo.ID), map[string]interface{}{"version": 9})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("GET", fileURL+"?version=9", nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("GET", fileURL+"?version=latest", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/edits", uuid.New()), map[string]interface{}{
+			"operations": []map[string]interface{}{{"type": "rotate", "degrees": 90}},
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		resp = tc.uploadTestFile(library.ID, "clip.mp4", "video/mp4", createTestVideo(3, time.Now()))
+		require.Equal(t, http.StatusCreated, resp.Code)
+		var clip TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &clip)
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/edits", clip.ID), map[string]interface{}{
+			"operations": []map[string]interface{}{{"type": "rotate", "degrees": 90}},
+		})
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+	})
+
+	t.Run("Serve Photo File - Not Found", func(t *testing.T) {
+		nonExistentID := uuid.New()
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/file", nonExistentID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Serve Thumbnail - Lazy", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "lazy.jpg", nil, "")
+		thumbnailPath := thumbnails.Path(filepath.Dir(uploadedPhoto.FilePath), uploadedPhoto.FilePath, "small")
+
+		// Lazy libraries (the default) don't render anything at upload
+		assert.NoFileExists(t, thumbnailPath)
+		assert.Contains(t, uploadedPhoto.ThumbnailURL, fmt.Sprintf("/api/v1/photos/%s/thumbnail", uploadedPhoto.ID))
+
+		resp := tc.makeRequest("GET", uploadedPhoto.ThumbnailURL, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+		assert.FileExists(t, thumbnailPath)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/thumbnail?size=medium", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.FileExists(t, thumbnails.Path(filepath.Dir(uploadedPhoto.FilePath), uploadedPhoto.FilePath, "medium"))
+
+		// Purging the photo removes its renditions
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.NoFileExists(t, thumbnailPath)
+	})
+
+	t.Run("Serve Thumbnail - Eager and Background", func(t *testing.T) {
+		for _, mode := range []string{"eager", "background"} {
+			payload := map[string]interface{}{
+				"name":           "Thumbnails " + mode,
+				"images":         filepath.Join(tc.TempDir, "thumbnails_"+mode),
+				"thumbnail_mode": mode,
+			}
+			resp := tc.makeRequest("POST", "/api/v1/libraries", payload)
+			require.Equal(t, http.StatusCreated, resp.Code)
+
+			var thumbLibrary TestLibrary
+			json.Unmarshal(resp.Body.Bytes(), &thumbLibrary)
+			assert.Equal(t, mode, thumbLibrary.ThumbnailMode)
+
+			uploadedPhoto := tc.uploadTestPhoto(thumbLibrary.ID, mode+".jpg", nil, "")
+			if mode == "background" {
+				assert.Eventually(t, func() bool {
+					_, err := os.Stat(thumbnails.Path(filepath.Dir(uploadedPhoto.FilePath), uploadedPhoto.FilePath, "medium"))
+					return err == nil
+				}, 5*time.Second, 10*time.Millisecond)
+			}
+
+			for size := range thumbnails.Sizes {
+				assert.FileExists(t, thumbnails.Path(filepath.Dir(uploadedPhoto.FilePath), uploadedPhoto.FilePath, size), "mode %s", mode)
+			}
+		}
+	})
+
+	t.Run("Serve Thumbnail - Errors", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "sizes.jpg", nil, "")
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/thumbnail?size=huge", uploadedPhoto.ID), nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/thumbnail", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Copy Photo - Same Library", func(t *testing.T) {
+		originalPhoto := tc.uploadTestPhoto(library.ID, "original.jpg", nil, "original,tag")
+
+		payload := map[string]interface{}{
+			"library_id": library.ID,
+		}
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", originalPhoto.ID), payload)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+
+		assert.Equal(t, "Photo copied successfully", response["message"])
+		assert.Equal(t, originalPhoto.ID.String(), response["original_id"])
+
+		copiedPhotoData := response["copied_photo"].(map[string]interface{})
+		assert.NotEqual(t, originalPhoto.ID.String(), copiedPhotoData["id"])
+		assert.Equal(t, originalPhoto.OriginalName, copiedPhotoData["original_name"])
+		assert.Equal(t, originalPhoto.MimeType, copiedPhotoData["mime_type"])
+		assert.Equal(t, originalPhoto.LibraryID.String(), copiedPhotoData["library_id"])
+		assert.NotEqual(t, originalPhoto.Filename, copiedPhotoData["filename"]) // Should have unique filename
+
+		// Verify files exist
+		_, err := os.Stat(originalPhoto.FilePath)
+		assert.NoError(t, err, "Original file should still exist")
+
+		copiedFilePath := copiedPhotoData["file_path"].(string)
+		_, err = os.Stat(copiedFilePath)
+		assert.NoError(t, err, "Copied file should exist")
+	})
+
+	t.Run("Copy Photo - Different Library", func(t *testing.T) {
+		targetLibrary := tc.createTestLibrary("Target Library", "Copy destination")
+		originalPhoto := tc.uploadTestPhoto(library.ID, "cross_library.jpg", nil, "tag1,tag2")
+
+		payload := map[string]interface{}{
+			"library_id": targetLibrary.ID,
+		}
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", originalPhoto.ID), payload)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+
+		copiedPhotoData := response["copied_photo"].(map[string]interface{})
+		assert.Equal(t, targetLibrary.ID.String(), copiedPhotoData["library_id"])
+
+		// Verify files exist in different directories
+		_, err := os.Stat(originalPhoto.FilePath)
+		assert.NoError(t, err, "Original file should still exist")
+
+		copiedFilePath := copiedPhotoData["file_path"].(string)
+		_, err = os.Stat(copiedFilePath)
+		assert.NoError(t, err, "Copied file should exist")
+
+		// Verify they're in different directories
+		assert.Contains(t, copiedFilePath, targetLibrary.Images)
+		assert.NotContains(t, copiedFilePath, library.Images)
+	})
+
+	t.Run("Copy Photo - Source Not Found", func(t *testing.T) {
+		nonExistentID := uuid.New()
+		payload := map[string]interface{}{
+			"library_id": library.ID,
+		}
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", nonExistentID), payload)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Source photo not found", response["error"])
+	})
+
+	t.Run("Copy Photo - Target Library Not Found", func(t *testing.T) {
+		originalPhoto := tc.uploadTestPhoto(library.ID, "no_target.jpg", nil, "")
+		nonExistentID := uuid.New()
+
+		payload := map[string]interface{}{
+			"library_id": nonExistentID,
+		}
+
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/copy", originalPhoto.ID), payload)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Target library not found", response["error"])
+	})
+
+	t.Run("Bulk Copy Photos", func(t *testing.T) {
+		targetLibrary := tc.createTestLibrary("Bulk Target", "Bulk copy destination")
+		photo1 := tc.uploadTestPhoto(library.ID, "bulk1.jpg", nil, "bulk")
+		photo2 := tc.uploadTestPhoto(library.ID, "bulk2.jpg", nil, "")
+		missingID := uuid.New()
+
+		payload := map[string]interface{}{
+			"photo_ids":  []uuid.UUID{photo1.ID, missingID, photo2.ID},
+			"library_id": targetLibrary.ID,
+		}
+
+		resp := tc.makeRequest("POST", "/api/v1/photos/bulk-copy", payload)
+		assert.Equal(t, http.StatusAccepted, resp.Code)
+
+		var accepted map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &accepted)
+		assert.Equal(t, "/api/v1/jobs/"+accepted["id"].(string), resp.Header().Get("Location"))
+
+		job := tc.waitForJob(accepted["id"].(string))
+		assert.Equal(t, "completed", job["status"])
+		assert.Equal(t, float64(3), job["processed"])
+
+		results := job["results"].([]interface{})
+		assert.Len(t, results, 3)
+		assert.Equal(t, "copied", results[0].(map[string]interface{})["status"])
+		assert.Equal(t, "failed", results[1].(map[string]interface{})["status"])
+		assert.Equal(t, "Source photo not found", results[1].(map[string]interface{})["error"])
+		assert.Equal(t, "copied", results[2].(map[string]interface{})["status"])
+
+		// The copies live in the target library and keep their tags
+		copiedID := results[0].(map[string]interface{})["copied_photo_id"].(string)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s?include_tags=true", copiedID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var copied map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &copied)
+		assert.Equal(t, targetLibrary.ID.String(), copied["library_id"])
+		assert.Len(t, copied["tags"], 1)
+	})
+
+	t.Run("Bulk Copy Photos - Validation", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/photos/bulk-copy", map[string]interface{}{
+			"photo_ids":  []uuid.UUID{},
+			"library_id": library.ID,
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("POST", "/api/v1/photos/bulk-copy", map[string]interface{}{
+			"photo_ids":  []uuid.UUID{uuid.New()},
+			"library_id": uuid.New(),
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Target library not found", response["error"])
+	})
+
+	t.Run("Move Photo", func(t *testing.T) {
+		sourceLibrary := tc.createTestLibrary("Move Source", "Move origin")
+		targetLibrary := tc.createTestLibrary("Move Target", "Move destination")
+		photo := tc.uploadTestPhoto(sourceLibrary.ID, "moving.jpg", nil, "travel")
+		other := tc.uploadTestPhoto(sourceLibrary.ID, "staying.jpg", nil, "")
+		original, err := os.ReadFile(photo.FilePath)
+		require.NoError(t, err)
+
+		album := tc.createTestAlbum("Move Album", "", sourceLibrary.ID)
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{photo.ID, other.ID},
+		})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/albums/%s/cover", album.ID), map[string]interface{}{"photo_id": photo.ID})
+		require.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/photos/%s/metadata", photo.ID), map[string]interface{}{"metadata": map[string]string{"client": "Acme"}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.NoError(t, os.WriteFile(metadata.SidecarPath(photo.FilePath), []byte("<x:xmpmeta/>"), 0644))
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/move", photo.ID), map[string]interface{}{"library_id": targetLibrary.ID})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var moved models.Photo
+		json.Unmarshal(resp.Body.Bytes(), &moved)
+
+		// Same photo, new home
+		assert.Equal(t, photo.ID, moved.ID)
+		assert.Equal(t, targetLibrary.ID, moved.LibraryID)
+		assert.Equal(t, filepath.Join(targetLibrary.Images, photo.Filename), moved.FilePath)
+		assert.NoFileExists(t, photo.FilePath)
+		assert.NoFileExists(t, metadata.SidecarPath(photo.FilePath))
+		assert.FileExists(t, metadata.SidecarPath(moved.FilePath))
+		stored, err := os.ReadFile(moved.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, original, stored)
+		require.Len(t, moved.Tags, 1)
+		assert.Equal(t, "travel", moved.Tags[0].Name)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/metadata", photo.ID), nil)
+		assert.Contains(t, resp.Body.String(), "Acme")
+		resp = tc.makeRequest("GET", moved.FileURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, original, resp.Body.Bytes())
+
+		// It leaves the old library's album, whose cover falls back
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s", album.ID), nil)
+		var gotAlbum models.Album
+		json.Unmarshal(resp.Body.Bytes(), &gotAlbum)
+		assert.Nil(t, gotAlbum.CoverPhotoID)
+		require.NotNil(t, gotAlbum.CoverPhoto)
+		assert.Equal(t, other.ID, gotAlbum.CoverPhoto.ID)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+		var listed struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		require.Len(t, listed.Photos, 1)
+		assert.Equal(t, other.ID, listed.Photos[0].ID)
+
+		// Into an encrypted library the file is encrypted with that library's key
+		tc.Config.EncryptionSecret = "test-encryption-secret"
+		defer func() { tc.Config.EncryptionSecret = "" }()
+		resp = tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name":      "Move Vault",
+			"images":    filepath.Join(tc.TempDir, "move_vault"),
+			"encrypted": true,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var vault TestLibrary
+		json.Unmarshal(resp.Body.Bytes(), &vault)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/move", photo.ID), map[string]interface{}{"library_id": vault.ID})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		json.Unmarshal(resp.Body.Bytes(), &moved)
+		assert.True(t, moved.Encrypted)
+		assert.NoFileExists(t, filepath.Join(targetLibrary.Images, photo.Filename))
+		stored, err = os.ReadFile(moved.FilePath)
+		require.NoError(t, err)
+		assert.NotEqual(t, original, stored)
+		resp = tc.makeRequest("GET", moved.FileURL, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, original, resp.Body.Bytes())
+
+		// And back out again decrypted
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/move", photo.ID), map[string]interface{}{"library_id": sourceLibrary.ID})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		json.Unmarshal(resp.Body.Bytes(), &moved)
+		assert.False(t, moved.Encrypted)
+		stored, err = os.ReadFile(moved.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, original, stored)
+	})
+
+	t.Run("Move Photo - Errors", func(t *testing.T) {
+		photo := tc.uploadTestPhoto(library.ID, "unmoved.jpg", nil, "")
+
+		for _, tt := range []struct {
+			photoID uuid.UUID
+			body    map[string]interface{}
+			status  int
+			message string
+		}{
+			{photo.ID, map[string]interface{}{"library_id": library.ID}, http.StatusBadRequest, "Photo is already in the target library"},
+			{photo.ID, map[string]interface{}{"library_id": uuid.New()}, http.StatusNotFound, "Target library not found"},
+			{uuid.New(), map[string]interface{}{"library_id": library.ID}, http.StatusNotFound, "Photo not found"},
+			{photo.ID, map[string]interface{}{}, http.StatusBadRequest, ""},
+		} {
+			resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/move", tt.photoID), tt.body)
+			assert.Equal(t, tt.status, resp.Code, resp.Body.String())
+			if tt.message != "" {
+				assert.Contains(t, resp.Body.String(), tt.message)
+			}
+		}
+		assert.FileExists(t, photo.FilePath)
+	})
+
+	t.Run("Photo Batch Operations", func(t *testing.T) {
+		batchLibrary := tc.createTestLibrary("Batch Ops Library", "For photo batch testing")
+		otherLibrary := tc.createTestLibrary("Batch Ops Other", "Batch destination")
+		first := tc.uploadTestPhoto(batchLibrary.ID, "first.jpg", nil, "")
+		second := tc.uploadTestPhoto(batchLibrary.ID, "second.jpg", nil, "")
+		outsider := tc.uploadTestPhoto(otherLibrary.ID, "outsider.jpg", nil, "")
+
+		type result struct {
+			PhotoID       uuid.UUID  `json:"photo_id"`
+			Status        string     `json:"status"`
+			CopiedPhotoID *uuid.UUID `json:"copied_photo_id"`
+			Error         string     `json:"error"`
+		}
+		batch := func(body map[string]interface{}) (committed bool, results []result) {
+			resp := tc.makeRequest("POST", "/api/v1/photos/batch", body)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var response struct {
+				Committed bool     `json:"committed"`
+				Results   []result `json:"results"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			return response.Committed, response.Results
+		}
+		statuses := func(results []result) []string {
+			var s []string
+			for _, r := range results {
+				s = append(s, r.Status)
+			}
+			return s
+		}
+		get := func(id uuid.UUID) models.Photo {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s?include_tags=true", id), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var photo models.Photo
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			return photo
+		}
+		both := []uuid.UUID{first.ID, second.ID}
+
+		// Ratings, set and cleared
+		committed, results := batch(map[string]interface{}{"operation": "set_rating", "photo_ids": both, "rating": 4})
+		assert.True(t, committed)
+		assert.Equal(t, []string{"ok", "ok"}, statuses(results))
+		require.NotNil(t, get(second.ID).Rating)
+		assert.Equal(t, 4, *get(second.ID).Rating)
+		committed, _ = batch(map[string]interface{}{"operation": "set_rating", "photo_ids": both, "rating": nil})
+		assert.True(t, committed)
+		assert.Nil(t, get(first.ID).Rating)
+
+		// Tags, created as needed
+		committed, _ = batch(map[string]interface{}{"operation": "add_tags", "photo_ids": both, "tags": []string{"batch-beach", "batch-sunset"}})
+		assert.True(t, committed)
+		assert.Len(t, get(first.ID).Tags, 2)
+		committed, _ = batch(map[string]interface{}{"operation": "add_tags", "photo_ids": both, "tags": []string{"batch-beach"}})
+		assert.True(t, committed)
+		committed, _ = batch(map[string]interface{}{"operation": "remove_tags", "photo_ids": both, "tags": []string{"batch-beach", "batch-unknown"}})
+		assert.True(t, committed)
+		tags := get(second.ID).Tags
+		require.Len(t, tags, 1)
+		assert.Equal(t, "batch-sunset", tags[0].Name)
+
+		// One failure rolls back the whole batch
+		album := tc.createTestAlbum("Batch Ops Album", "", batchLibrary.ID)
+		committed, results = batch(map[string]interface{}{
+			"operation": "add_to_album", "album_id": album.ID,
+			"photo_ids": []uuid.UUID{first.ID, outsider.ID, second.ID},
+		})
+		assert.False(t, committed)
+		assert.Equal(t, []string{"rolled_back", "failed", "skipped"}, statuses(results))
+		assert.Equal(t, "Photo and album must be in the same library", results[1].Error)
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+		var listed struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		assert.Empty(t, listed.Photos)
+
+		committed, _ = batch(map[string]interface{}{"operation": "add_to_album", "album_id": album.ID, "photo_ids": []uuid.UUID{second.ID, first.ID, second.ID}})
+		assert.True(t, committed)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		require.Len(t, listed.Photos, 2)
+		assert.Equal(t, second.ID, listed.Photos[0].ID)
+
+		// Moved files are put back when a later photo fails
+		committed, results = batch(map[string]interface{}{
+			"operation": "move", "library_id": otherLibrary.ID,
+			"photo_ids": []uuid.UUID{first.ID, uuid.New()},
+		})
+		assert.False(t, committed)
+		assert.Equal(t, []string{"rolled_back", "failed"}, statuses(results))
+		assert.Equal(t, "Photo not found", results[1].Error)
+		assert.FileExists(t, first.FilePath)
+		assert.Equal(t, batchLibrary.ID, get(first.ID).LibraryID)
+
+		// Copies report their new IDs
+		committed, results = batch(map[string]interface{}{"operation": "copy", "library_id": otherLibrary.ID, "photo_ids": both})
+		assert.True(t, committed)
+		require.NotNil(t, results[0].CopiedPhotoID)
+		copied := get(*results[0].CopiedPhotoID)
+		assert.Equal(t, otherLibrary.ID, copied.LibraryID)
+		assert.FileExists(t, copied.FilePath)
+		assert.Len(t, copied.Tags, 1)
+
+		committed, _ = batch(map[string]interface{}{"operation": "move", "library_id": otherLibrary.ID, "photo_ids": []uuid.UUID{first.ID}})
+		assert.True(t, committed)
+		moved := get(first.ID)
+		assert.Equal(t, otherLibrary.ID, moved.LibraryID)
+		assert.FileExists(t, moved.FilePath)
+		assert.NoFileExists(t, first.FilePath)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		require.Len(t, listed.Photos, 1)
+
+		committed, _ = batch(map[string]interface{}{"operation": "delete", "photo_ids": []uuid.UUID{first.ID, second.ID}})
+		assert.True(t, committed)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", second.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		for _, body := range []map[string]interface{}{
+			{"operation": "explode", "photo_ids": both},
+			{"operation": "delete"},
+			{"operation": "move", "photo_ids": both},
+			{"operation": "set_rating", "photo_ids": both},
+			{"operation": "set_rating", "photo_ids": both, "rating": 6},
+			{"operation": "add_tags", "photo_ids": both},
+			{"operation": "add_to_album", "photo_ids": both},
+		} {
+			resp := tc.makeRequest("POST", "/api/v1/photos/batch", body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		}
+		resp = tc.makeRequest("POST", "/api/v1/photos/batch", map[string]interface{}{"operation": "copy", "photo_ids": both, "library_id": uuid.New()})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Storage Tier - Manual Move", func(t *testing.T) {
+		uploadedPhoto := tc.uploadTestPhoto(library.ID, "tiered.jpg", nil, "")
+		assert.Equal(t, "hot", uploadedPhoto.StorageTier)
+		tierURL := fmt.Sprintf("/api/v1/photos/%s/storage-tier", uploadedPhoto.ID)
+
+		// Cold storage must be configured first
+		resp := tc.makeRequest("PUT", tierURL, map[string]interface{}{"storage_tier": "cold"})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		tc.Config.ColdStoragePath = filepath.Join(tc.TempDir, "cold")
+		defer func() { tc.Config.ColdStoragePath = "" }()
+
+		resp = tc.makeRequest("PUT", tierURL, map[string]interface{}{"storage_tier": "frozen"})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("PUT", tierURL, map[string]interface{}{"storage_tier": "cold"})
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var coldPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &coldPhoto)
+		assert.Equal(t, "cold", coldPhoto.StorageTier)
+		assert.Equal(t, filepath.Join(tc.TempDir, "cold", library.ID.String(), uploadedPhoto.Filename), coldPhoto.FilePath)
+		assert.FileExists(t, coldPhoto.FilePath)
+		assert.NoFileExists(t, uploadedPhoto.FilePath)
+
+		// Thumbnails stay in the library directory
+		assert.FileExists(t, thumbnails.Path(library.Images, uploadedPhoto.FilePath, "small"))
+
+		// The original is still served transparently
+		resp = tc.makeRequest("GET", coldPhoto.FileURL, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, createTestImage(), resp.Body.Bytes())
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s&storage_tier=cold", library.ID), nil)
+		var listResponse struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listResponse)
+		require.Len(t, listResponse.Photos, 1)
+		assert.Equal(t, uploadedPhoto.ID, listResponse.Photos[0].ID)
+
+		// Bring it back
+		resp = tc.makeRequest("PUT", tierURL, map[string]interface{}{"storage_tier": "hot"})
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var hotPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &hotPhoto)
+		assert.Equal(t, "hot", hotPhoto.StorageTier)
+		assert.Equal(t, uploadedPhoto.FilePath, hotPhoto.FilePath)
+		assert.FileExists(t, hotPhoto.FilePath)
+	})
+
+	t.Run("Storage Tier - Automatic Tiering", func(t *testing.T) {
+		resp := tc.makeRequest("POST", "/api/v1/storage/tiering", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		tierLibrary := tc.createTestLibrary("Tiering Library", "For tiering tests")
+		oldPhoto := tc.uploadTestPhoto(tierLibrary.ID, "old.jpg", nil, "")
+		newPhoto := tc.uploadTestPhoto(tierLibrary.ID, "new.jpg", nil, "")
+		tc.DB.GetDB().Model(&models.Photo{}).Where("id = ?", oldPhoto.ID).Update("uploaded_at", time.Now().AddDate(-1, 0, 0))
+
+		tc.Config.ColdStoragePath = filepath.Join(tc.TempDir, "cold")
+		tc.Config.ColdStorageAfterMonths = 6
+		defer func() {
+			tc.Config.ColdStoragePath = ""
+			tc.Config.ColdStorageAfterMonths = 0
+		}()
+
+		resp = tc.makeRequest("POST", "/api/v1/storage/tiering", nil)
+		require.Equal(t, http.StatusAccepted, resp.Code)
+
+		var job map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &job)
+		job = tc.waitForJob(job["id"].(string))
+		assert.Equal(t, "completed", job["status"])
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", oldPhoto.ID), nil)
+		var movedPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &movedPhoto)
+		assert.Equal(t, "cold", movedPhoto.StorageTier)
+		assert.FileExists(t, movedPhoto.FilePath)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", newPhoto.ID), nil)
+		var keptPhoto TestPhoto
+		json.Unmarshal(resp.Body.Bytes(), &keptPhoto)
+		assert.Equal(t, "hot", keptPhoto.StorageTier)
+
+		// Purging a cold photo removes the cold original
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", oldPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", oldPhoto.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.NoFileExists(t, movedPhoto.FilePath)
+	})
+
+	t.Run("Delete Photo", func(t *testing.T) {
+		photoToDelete := tc.uploadTestPhoto(library.ID, "delete_me.jpg", nil, "")
+
+		// Verify file exists before deletion
+		_, err := os.Stat(photoToDelete.FilePath)
+		assert.NoError(t, err, "Photo file should exist before deletion")
+
+		resp := tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", photoToDelete.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Photo moved to trash", response["message"])
+
+		// Verify photo is gone from the library but its file is kept
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photoToDelete.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.FileExists(t, photoToDelete.FilePath)
+
+		// Purging it removes the file
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", photoToDelete.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		_, err = os.Stat(photoToDelete.FilePath)
+		assert.True(t, os.IsNotExist(err), "Photo file should be deleted")
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", photoToDelete.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Trash", func(t *testing.T) {
+		trashLibrary := tc.createTestLibrary("Trash Library", "For trash testing")
+		kept := tc.uploadTestPhoto(trashLibrary.ID, "kept.jpg", nil, "")
+		trashed := tc.uploadTestPhoto(trashLibrary.ID, "trashed.jpg", nil, "beach")
+		album := tc.createTestAlbum("Trash Album", "", trashLibrary.ID)
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), map[string]interface{}{
+			"photo_ids": []uuid.UUID{trashed.ID, kept.ID},
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", trashed.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		// Trashed photos drop out of listings, albums and covers
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?library_id=%s", trashLibrary.ID), nil)
+		var listed struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		require.Len(t, listed.Photos, 1)
+		assert.Equal(t, kept.ID, listed.Photos[0].ID)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		assert.Len(t, listed.Photos, 1)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s", album.ID), nil)
+		var cover struct {
+			CoverPhoto *TestPhoto `json:"cover_photo"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &cover)
+		require.NotNil(t, cover.CoverPhoto)
+		assert.Equal(t, kept.ID, cover.CoverPhoto.ID)
+
+		// The trash lists them with their deletion time
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/trash?library_id=%s", trashLibrary.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var trash struct {
+			Photos []struct {
+				TestPhoto
+				DeletedAt *time.Time `json:"deleted_at"`
+			} `json:"photos"`
+			Pagination struct {
+				Total int `json:"total"`
+			} `json:"pagination"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &trash)
+		require.Len(t, trash.Photos, 1)
+		assert.Equal(t, trashed.ID, trash.Photos[0].ID)
+		assert.NotNil(t, trash.Photos[0].DeletedAt)
+		assert.Equal(t, 1, trash.Pagination.Total)
+
+		// Restoring brings back the album membership and tags
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/restore", trashed.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos?tag=beach&library_id=%s", trashLibrary.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		assert.Len(t, listed.Photos, 1)
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/albums/%s/photos", album.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &listed)
+		assert.Len(t, listed.Photos, 2)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/photos/%s/restore", trashed.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		// Emptying the trash purges everything in it as a job
+		for _, photo := range []TestPhoto{kept, trashed} {
+			resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+		}
+		resp = tc.makeRequest("DELETE", "/api/v1/trash", nil)
+		require.Equal(t, http.StatusAccepted, resp.Code)
+		var job map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &job)
+		job = tc.waitForJob(job["id"].(string))
+		assert.Equal(t, "completed", job["status"])
+
+		for _, photo := range []TestPhoto{kept, trashed} {
+			assert.NoFileExists(t, photo.FilePath)
+		}
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/trash?library_id=%s", trashLibrary.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &trash)
+		assert.Empty(t, trash.Photos)
+	})
+
+	t.Run("Trash - Per-Library Retention", func(t *testing.T) {
+		tc.Config.TrashRetentionDays = 30
+		defer func() { tc.Config.TrashRetentionDays = 0 }()
+
+		resp := tc.makeRequest("POST", "/api/v1/libraries", map[string]interface{}{
+			"name": "Short Retention", "images": filepath.Join(tc.TempDir, "short_retention"), "trash_retention_days": 7,
+		})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var short struct {
+			ID                 uuid.UUID `json:"id"`
+			TrashRetentionDays *int      `json:"trash_retention_days"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &short))
+		require.NotNil(t, short.TrashRetentionDays)
+		assert.Equal(t, 7, *short.TrashRetentionDays)
+		defaulted := tc.createTestLibrary("Default Retention", "")
+
+		shortPhoto := tc.uploadTestPhoto(short.ID, "short.jpg", nil, "")
+		defaultPhoto := tc.uploadTestPhoto(defaulted.ID, "default.jpg", nil, "")
+		for _, photo := range []TestPhoto{shortPhoto, defaultPhoto} {
+			resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+		}
+
+		// Both were deleted 10 days ago, past the override but within the default
+		deletedAt := time.Now().AddDate(0, 0, -10).UTC().Truncate(time.Second)
+		require.NoError(t, tc.DB.GetDB().Unscoped().Model(&models.Photo{}).
+			Where("id IN ?", []uuid.UUID{shortPhoto.ID, defaultPhoto.ID}).
+			Update("deleted_at", deletedAt).Error)
+
+		type trashPage struct {
+			Photos []struct {
+				ID      uuid.UUID  `json:"id"`
+				PurgeAt *time.Time `json:"purge_at"`
+			} `json:"photos"`
+			NextPurgeAt *time.Time `json:"next_purge_at"`
+		}
+		getTrash := func(libraryID uuid.UUID) trashPage {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/trash?library_id=%s", libraryID), nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var page trashPage
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+			return page
+		}
+
+		// Each photo is due after its library's retention period
+		page := getTrash(short.ID)
+		require.Len(t, page.Photos, 1)
+		require.NotNil(t, page.Photos[0].PurgeAt)
+		assert.WithinDuration(t, deletedAt.AddDate(0, 0, 7), *page.Photos[0].PurgeAt, time.Second)
+		require.NotNil(t, page.NextPurgeAt)
+		assert.WithinDuration(t, deletedAt.AddDate(0, 0, 7), *page.NextPurgeAt, time.Second)
+
+		page = getTrash(defaulted.ID)
+		require.Len(t, page.Photos, 1)
+		require.NotNil(t, page.Photos[0].PurgeAt)
+		assert.WithinDuration(t, deletedAt.AddDate(0, 0, 30), *page.Photos[0].PurgeAt, time.Second)
+
+		// The scheduled purge only takes the photo past its library's period
+		job, err := tc.Trash.SubmitPurge("", true)
+		require.NoError(t, err)
+		assert.Equal(t, "completed", tc.waitForJob(job.ID().String())["status"])
+		assert.Empty(t, getTrash(short.ID).Photos)
+		assert.NoFileExists(t, shortPhoto.FilePath)
+		assert.Len(t, getTrash(defaulted.ID).Photos, 1)
+
+		// A library keeping its trash until purged by hand has nothing due
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", defaulted.ID), map[string]interface{}{"trash_retention_days": 0})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		page = getTrash(defaulted.ID)
+		require.Len(t, page.Photos, 1)
+		assert.Nil(t, page.Photos[0].PurgeAt)
+		assert.Nil(t, page.NextPurgeAt)
+		job, err = tc.Trash.SubmitPurge("", true)
+		require.NoError(t, err)
+		tc.waitForJob(job.ID().String())
+		assert.Len(t, getTrash(defaulted.ID).Photos, 1)
+
+		// Clearing the override goes back to the server's default
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", defaulted.ID), map[string]interface{}{"trash_retention_days": nil})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Contains(t, resp.Body.String(), `"trash_retention_days":null`)
+		page = getTrash(defaulted.ID)
+		require.NotNil(t, page.NextPurgeAt)
+		assert.WithinDuration(t, deletedAt.AddDate(0, 0, 30), *page.NextPurgeAt, time.Second)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", defaulted.ID), map[string]interface{}{"trash_retention_days": -1})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Delete Photo - Not Found", func(t *testing.T) {
+		nonExistentID := uuid.New()
+		resp := tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", nonExistentID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
+
+// TestSimilarPhotos tests finding photos that look alike by perceptual hash
+func TestSimilarPhotos(t *testing.T) {
+	tc := setupTestEnvironment(t)
+	defer tc.cleanup()
+
+	type similar struct {
+		ID        uuid.UUID `json:"id"`
+		LibraryID uuid.UUID `json:"library_id"`
+		Distance  int       `json:"distance"`
+	}
+	upload := func(libraryID uuid.UUID, name string, data []byte) TestPhoto {
+		resp := tc.uploadTestFile(libraryID, name, "image/jpeg", data)
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var photo TestPhoto
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &photo))
+		return photo
+	}
+	findSimilar := func(id uuid.UUID, query string) []similar {
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/similar?%s", id, query), nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var page struct {
+			Photos     []similar `json:"photos"`
+			Pagination struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		assert.Equal(t, int64(len(page.Photos)), page.Pagination.Total)
+		return page.Photos
+	}
+
+	// A burst of the same scene at different sizes, in two libraries, and a
+	// photo of something else
+	first := tc.createTestLibrary("burst", "")
+	second := tc.createTestLibrary("backup", "")
+	shot := upload(first.ID, "shot1.jpg", createGradientImage(64, 48, false))
+	burst := upload(first.ID, "shot2.jpg", createGradientImage(96, 72, false))
+	backup := upload(second.ID, "shot3.jpg", createGradientImage(40, 30, false))
+	other := upload(first.ID, "other.jpg", createGradientImage(64, 48, true))
+
+	t.Run("Across Libraries", func(t *testing.T) {
+		found := findSimilar(shot.ID, "")
+		require.Len(t, found, 2)
+		ids := []uuid.UUID{found[0].ID, found[1].ID}
+		assert.ElementsMatch(t, []uuid.UUID{burst.ID, backup.ID}, ids)
+		assert.LessOrEqual(t, found[0].Distance, found[1].Distance)
+		assert.LessOrEqual(t, found[1].Distance, 10)
+
+		// The opposite gradient differs in every bit
+		found = findSimilar(other.ID, "threshold=63")
+		assert.Empty(t, found)
+		found = findSimilar(other.ID, "threshold=64")
+		assert.Len(t, found, 3)
+	})
+
+	t.Run("Within Library", func(t *testing.T) {
+		found := findSimilar(shot.ID, "library_id="+first.ID.String())
+		require.Len(t, found, 1)
+		assert.Equal(t, burst.ID, found[0].ID)
+		assert.Equal(t, first.ID, found[0].LibraryID)
+	})
+
+	t.Run("Backfill", func(t *testing.T) {
+		// Photos uploaded before hashing have none until the job runs
+		require.NoError(t, tc.DB.GetDB().Model(&models.Photo{}).
+			Where("id = ?", backup.ID).Update("perceptual_hash", "").Error)
+		assert.Len(t, findSimilar(shot.ID, ""), 1)
+
+		resp := tc.makeRequest("POST", "/api/v1/photos/hash", nil)
+		require.Equal(t, http.StatusAccepted, resp.Code, resp.Body.String())
+		var accepted map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &accepted)
+		job := tc.waitForJob(accepted["id"].(string))
+		require.Equal(t, "completed", job["status"])
+		assert.EqualValues(t, 1, job["total"])
+		assert.Len(t, findSimilar(shot.ID, ""), 2)
+
+		// The photo searched from is hashed on demand
+		require.NoError(t, tc.DB.GetDB().Model(&models.Photo{}).
+			Where("id = ?", backup.ID).Update("perceptual_hash", "").Error)
+		found := findSimilar(backup.ID, "")
+		assert.Len(t, found, 2)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, threshold := range []string{"-1", "65", "many"} {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/similar?threshold=%s", shot.ID, threshold), nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, threshold)
+		}
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s/similar", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		resp = tc.makeRequest("GET", "/api/v1/photos/not-a-uuid/similar", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
 	})
 }
@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"photo-library-server/config"
+	"photo-library-server/models"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestTagEndpoints tests all tag-related endpoints
@@ -94,6 +100,63 @@ func TestTagEndpoints(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, resp.Code)
 	})
 
+	t.Run("Create Tag - Whitespace Is Normalized", func(t *testing.T) {
+		tag := tc.createTestTag("  golden \t hour ", "")
+		assert.Equal(t, "golden hour", tag.Name)
+
+		resp := tc.makeRequest("POST", "/api/v1/tags", map[string]interface{}{"name": "golden hour"})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		resp = tc.makeRequest("POST", "/api/v1/tags", map[string]interface{}{"name": "   "})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Create Tag - Case Is Folded By Default", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", "")
+		defaults, err := config.LoadConfig("")
+		require.NoError(t, err)
+		tc.Config.TagNormalization = defaults.TagNormalization
+
+		tag := tc.createTestTag("Deja Vu", "")
+		assert.Equal(t, "deja vu", tag.Name)
+
+		for _, variant := range []string{"deja vu", "DEJA VU "} {
+			resp := tc.makeRequest("POST", "/api/v1/tags", map[string]interface{}{"name": variant})
+			assert.Equal(t, http.StatusConflict, resp.Code, variant)
+		}
+
+		resp := tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/tags/%s", tag.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Create Tag - Configurable Normalization", func(t *testing.T) {
+		tc.Config.TagNormalization = "trim,nfc,casefold,strip_accents"
+		defer func() { tc.Config.TagNormalization = "trim,nfc,casefold" }()
+
+		tag := tc.createTestTag("Déjà vu", "")
+		assert.Equal(t, "deja vu", tag.Name)
+
+		for _, variant := range []string{"deja vu", "DEJA VU "} {
+			resp := tc.makeRequest("POST", "/api/v1/tags", map[string]interface{}{"name": variant})
+			assert.Equal(t, http.StatusConflict, resp.Code, variant)
+		}
+
+		// Tags given at upload reuse the normalized tag
+		photo := tc.uploadTestPhoto(library.ID, "deja.jpg", nil, "DÉJÀ VU")
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s?include_tags=true", photo.ID), nil)
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		tags := response["tags"].([]interface{})
+		assert.Len(t, tags, 1)
+		assert.Equal(t, tag.ID.String(), tags[0].(map[string]interface{})["id"])
+
+		// Filtering by tag accepts any variant
+		resp = tc.makeRequest("GET", "/api/v1/photos?tag=Deja%20Vu", nil)
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Len(t, response["photos"], 1)
+		assert.Equal(t, float64(1), response["pagination"].(map[string]interface{})["total"])
+	})
+
 	t.Run("Get Tags", func(t *testing.T) {
 		// Create test tags
 		tag1 := tc.createTestTag("landscape", "#00FF00")
@@ -125,6 +188,190 @@ func TestTagEndpoints(t *testing.T) {
 		assert.True(t, found2, "Tag 2 not found")
 	})
 
+	t.Run("Get Top Tags", func(t *testing.T) {
+		tc.uploadTestPhoto(library.ID, "trend1.jpg", nil, "trend-popular,trend-old")
+		tc.uploadTestPhoto(library.ID, "trend2.jpg", nil, "trend-popular,trend-old")
+		tc.uploadTestPhoto(library.ID, "trend3.jpg", nil, "trend-popular,trend-recent")
+
+		// trend-old was applied long ago
+		tc.DB.GetDB().Model(&models.PhotoTag{}).
+			Where("tag_id = (SELECT id FROM tags WHERE name = ?)", "trend-old").
+			Update("created_at", time.Now().AddDate(0, -3, 0))
+
+		type topTags struct {
+			Window string `json:"window"`
+			Tags   []struct {
+				Name       string `json:"name"`
+				PhotoCount int64  `json:"photo_count"`
+			} `json:"tags"`
+		}
+		rank := func(url string) map[string]int64 {
+			resp := tc.makeRequest("GET", url, nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+			var result topTags
+			json.Unmarshal(resp.Body.Bytes(), &result)
+			counts := make(map[string]int64)
+			for _, tag := range result.Tags {
+				counts[tag.Name] = tag.PhotoCount
+			}
+			return counts
+		}
+
+		counts := rank("/api/v1/tags/top")
+		assert.Equal(t, int64(3), counts["trend-popular"])
+		assert.Equal(t, int64(1), counts["trend-recent"])
+		assert.NotContains(t, counts, "trend-old")
+
+		counts = rank("/api/v1/tags/top?window=all")
+		assert.Equal(t, int64(2), counts["trend-old"])
+
+		counts = rank("/api/v1/tags/top?window=all&limit=1")
+		assert.Len(t, counts, 1)
+		assert.Equal(t, int64(3), counts["trend-popular"])
+
+		for _, window := range []string{"soon", "-5d", "0h", ""} {
+			resp := tc.makeRequest("GET", "/api/v1/tags/top?window="+window, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, window)
+		}
+	})
+
+	t.Run("Suggest Tags", func(t *testing.T) {
+		tc.uploadTestPhoto(library.ID, "suggest1.jpg", nil, "zebra-crossing,zebra")
+		tc.uploadTestPhoto(library.ID, "suggest2.jpg", nil, "zebra-crossing")
+		tc.createTestTag("zebu", "")
+		airship := tc.createTestTag("airship", "")
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/aliases", airship.ID), map[string]interface{}{"name": "zeppelin"})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		type completion struct {
+			Name       string `json:"name"`
+			PhotoCount int64  `json:"photo_count"`
+			Alias      string `json:"alias"`
+			Match      string `json:"match"`
+		}
+		suggest := func(query string) []completion {
+			resp := tc.makeRequest("GET", "/api/v1/tags/suggest?"+query, nil)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var result struct {
+				Tags []completion `json:"tags"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result.Tags
+		}
+
+		// Prefix matches of names and aliases, most used first
+		assert.Equal(t, []completion{
+			{Name: "zebra-crossing", PhotoCount: 2, Match: "prefix"},
+			{Name: "zebra", PhotoCount: 1, Match: "prefix"},
+			{Name: "airship", Alias: "zeppelin", Match: "prefix"},
+			{Name: "zebu", Match: "prefix"},
+		}, suggest("q=ZE"))
+		assert.Equal(t, []completion{{Name: "zebra-crossing", PhotoCount: 2, Match: "prefix"}}, suggest("q=ze&limit=1"))
+
+		// Typos and words within names
+		assert.Equal(t, []completion{
+			{Name: "zebra-crossing", PhotoCount: 2, Match: "fuzzy"},
+			{Name: "zebra", PhotoCount: 1, Match: "fuzzy"},
+		}, suggest("q=zebrq"))
+		assert.Equal(t, []completion{{Name: "zebra-crossing", PhotoCount: 2, Match: "fuzzy"}}, suggest("q=crossing"))
+		assert.Empty(t, suggest("q=zq"))
+
+		resp = tc.makeRequest("GET", "/api/v1/tags/suggest?q=%20", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Batch Tags", func(t *testing.T) {
+		shoot := tc.createTestLibrary("shoot", "")
+		var photoIDs []uuid.UUID
+		for i := 0; i < 3; i++ {
+			photo := tc.uploadTestPhoto(shoot.ID, fmt.Sprintf("shoot%d.jpg", i), nil, "")
+			photoIDs = append(photoIDs, photo.ID)
+		}
+		tc.uploadTestPhoto(shoot.ID, "shoot-draft.jpg", nil, "")
+		resp := tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/photos", tc.createTestTag("shoot-draft", "").ID),
+			map[string]interface{}{"photo_id": photoIDs[0].String()})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		photoTags := func(photoID uuid.UUID) []string {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s?include_tags=true", photoID), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var photo struct {
+				Tags []TestTag `json:"tags"`
+			}
+			json.Unmarshal(resp.Body.Bytes(), &photo)
+			names := []string{}
+			for _, tag := range photo.Tags {
+				names = append(names, tag.Name)
+			}
+			return names
+		}
+
+		type batchResult struct {
+			PhotoCount  int       `json:"photo_count"`
+			Added       int64     `json:"added"`
+			Removed     int64     `json:"removed"`
+			CreatedTags []TestTag `json:"created_tags"`
+		}
+		batch := func(body map[string]interface{}) batchResult {
+			resp := tc.makeRequest("POST", "/api/v1/tags/batch", body)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			var result batchResult
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		// Missing tags are created, duplicates ignored
+		result := batch(map[string]interface{}{
+			"photo_ids": append(photoIDs, photoIDs[0]),
+			"add":       []string{"shoot-2024", " shoot-client ", "shoot-2024"},
+			"remove":    []string{"shoot-draft", "shoot-unknown"},
+		})
+		assert.Equal(t, 3, result.PhotoCount)
+		assert.Equal(t, int64(6), result.Added)
+		assert.Equal(t, int64(1), result.Removed)
+		require.Len(t, result.CreatedTags, 2)
+		for _, photoID := range photoIDs {
+			assert.ElementsMatch(t, []string{"shoot-2024", "shoot-client"}, photoTags(photoID))
+		}
+
+		// Photos that already have a tag are skipped
+		result = batch(map[string]interface{}{"photo_ids": photoIDs, "add": []string{"shoot-2024"}})
+		assert.Equal(t, int64(0), result.Added)
+		assert.Empty(t, result.CreatedTags)
+
+		result = batch(map[string]interface{}{"photo_ids": photoIDs[:2], "remove": []string{"shoot-client"}})
+		assert.Equal(t, int64(2), result.Removed)
+		assert.ElementsMatch(t, []string{"shoot-2024"}, photoTags(photoIDs[0]))
+		assert.ElementsMatch(t, []string{"shoot-2024", "shoot-client"}, photoTags(photoIDs[2]))
+
+		// One unknown photo changes none
+		unknown := uuid.New()
+		resp = tc.makeRequest("POST", "/api/v1/tags/batch", map[string]interface{}{
+			"photo_ids": []uuid.UUID{photoIDs[0], unknown},
+			"add":       []string{"shoot-never"},
+		})
+		require.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Contains(t, resp.Body.String(), unknown.String())
+		assert.NotContains(t, photoTags(photoIDs[0]), "shoot-never")
+
+		for _, body := range []map[string]interface{}{
+			{"photo_ids": photoIDs},
+			{"photo_ids": []uuid.UUID{}, "add": []string{"shoot-2024"}},
+			{"photo_ids": photoIDs, "add": []string{" "}},
+			{"photo_ids": photoIDs, "add": []string{"shoot-2024"}, "remove": []string{"shoot-2024"}},
+		} {
+			resp := tc.makeRequest("POST", "/api/v1/tags/batch", body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+		}
+		assert.Len(t, photoTags(photoIDs[2]), 2)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/libraries/%s", shoot.ID), map[string]interface{}{"read_only": true})
+		require.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("POST", "/api/v1/tags/batch", map[string]interface{}{"photo_ids": photoIDs, "remove": []string{"shoot-2024"}})
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+	})
+
 	t.Run("Get Tag by ID", func(t *testing.T) {
 		createdTag := tc.createTestTag("architecture", "#0000FF")
 
@@ -168,6 +415,49 @@ func TestTagEndpoints(t *testing.T) {
 		assert.Equal(t, "#000000", updatedTag.Color)
 	})
 
+	t.Run("Tag Description", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"name":        "film-scan",
+			"description": "Digitized from negatives, not digital captures",
+		}
+
+		resp := tc.makeRequest("POST", "/api/v1/tags", payload)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var tag TestTag
+		json.Unmarshal(resp.Body.Bytes(), &tag)
+		assert.Equal(t, "Digitized from negatives, not digital captures", tag.Description)
+
+		// Omitting the description keeps it
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/tags/%s", tag.ID), map[string]interface{}{"name": "film-scans"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		json.Unmarshal(resp.Body.Bytes(), &tag)
+		assert.Equal(t, "film-scans", tag.Name)
+		assert.Equal(t, "Digitized from negatives, not digital captures", tag.Description)
+
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/tags/%s", tag.ID), map[string]interface{}{
+			"name":        "film-scans",
+			"description": "Scanned film",
+		})
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/tags/%s", tag.ID), nil)
+		json.Unmarshal(resp.Body.Bytes(), &tag)
+		assert.Equal(t, "Scanned film", tag.Description)
+
+		// Descriptions are limited to 500 characters
+		payload = map[string]interface{}{
+			"name":        "too-long",
+			"description": strings.Repeat("x", 501),
+		}
+		resp = tc.makeRequest("POST", "/api/v1/tags", payload)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "description must be at most 500 characters", response["error"])
+	})
+
 	t.Run("Update Tag - Duplicate Name", func(t *testing.T) {
 		tc.createTestTag("first-tag", "#FF0000")
 		tag2 := tc.createTestTag("second-tag", "#00FF00")
@@ -433,6 +723,61 @@ func TestTagEndpoints(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, resp.Code)
 	})
 
+	t.Run("Get Tag Photos - Paginated", func(t *testing.T) {
+		otherLibrary := tc.createTestLibrary("Tag Photos Library", "Second library for tag photos")
+		tag := tc.createTestTag("paged-tag", "#777777")
+
+		var ids []uuid.UUID
+		for i := 0; i < 3; i++ {
+			photo := tc.uploadTestPhoto(library.ID, fmt.Sprintf("tag_paged_%d.jpg", i), nil, "paged-tag")
+			ids = append(ids, photo.ID)
+			time.Sleep(10 * time.Millisecond) // Distinct upload times
+		}
+		rating := 5
+		other := tc.uploadTestPhoto(otherLibrary.ID, "tag_paged_other.jpg", &rating, "paged-tag,second-tag")
+		tc.uploadTestPhoto(library.ID, "untagged_paged.jpg", nil, "")
+
+		type page struct {
+			Photos []struct {
+				ID uuid.UUID `json:"id"`
+			} `json:"photos"`
+			Pagination struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		get := func(query string) page {
+			resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/tags/%s/photos?%s", tag.ID, query), nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var body page
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			return body
+		}
+
+		first := get("limit=2")
+		assert.Equal(t, int64(4), first.Pagination.Total)
+		require.Len(t, first.Photos, 2)
+		assert.Equal(t, other.ID, first.Photos[0].ID)
+		assert.Equal(t, ids[2], first.Photos[1].ID)
+
+		inLibrary := get(fmt.Sprintf("library_id=%s&order_by=uploaded_at&order_dir=asc", library.ID))
+		assert.Equal(t, int64(3), inLibrary.Pagination.Total)
+		require.Len(t, inLibrary.Photos, 3)
+		assert.Equal(t, ids[0], inLibrary.Photos[0].ID)
+
+		rated := get("rating=5")
+		require.Len(t, rated.Photos, 1)
+		assert.Equal(t, other.ID, rated.Photos[0].ID)
+
+		both := get("tag=second-tag")
+		assert.Equal(t, int64(1), both.Pagination.Total)
+
+		resp := tc.makeRequest("GET", fmt.Sprintf("/api/v1/tags/%s/photos?library_id=bad", tag.ID), nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/tags/%s/photos", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
 	t.Run("Tag Photo Integration", func(t *testing.T) {
 		// Test the full workflow: create tag, upload photo with tags, verify relationships
 		photo := tc.uploadTestPhoto(library.ID, "integration_photo.jpg", nil, "sunset,golden-hour")
@@ -476,4 +821,80 @@ func TestTagEndpoints(t *testing.T) {
 		assert.True(t, tagNames["sunset"])
 		assert.True(t, tagNames["golden-hour"])
 	})
+	t.Run("Tag Aliases", func(t *testing.T) {
+		tag := tc.createTestTag("new-york", "")
+		aliasesPath := fmt.Sprintf("/api/v1/tags/%s/aliases", tag.ID)
+
+		resp := tc.makeRequest("POST", aliasesPath, map[string]interface{}{"name": "  nyc "})
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+		var alias models.TagAlias
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &alias))
+		assert.Equal(t, "nyc", alias.Name)
+		assert.Equal(t, tag.ID, alias.TagID)
+
+		// Names are shared between tags and aliases
+		resp = tc.makeRequest("POST", aliasesPath, map[string]interface{}{"name": "nyc"})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+		assert.Contains(t, resp.Body.String(), "duplicate_tag_alias")
+		resp = tc.makeRequest("POST", aliasesPath, map[string]interface{}{"name": "sunset"})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+		assert.Contains(t, resp.Body.String(), "duplicate_tag")
+		resp = tc.makeRequest("POST", "/api/v1/tags", map[string]interface{}{"name": "nyc"})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+		resp = tc.makeRequest("PUT", fmt.Sprintf("/api/v1/tags/%s", tag.ID), map[string]interface{}{"name": "nyc"})
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		resp = tc.makeRequest("POST", fmt.Sprintf("/api/v1/tags/%s/aliases", uuid.New()), map[string]interface{}{"name": "big-apple"})
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		// Uploads tagged with the alias get the tag
+		photo := tc.uploadTestPhoto(library.ID, "alias_photo.jpg", nil, "nyc")
+		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s?include_tags=true", photo.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var tagged struct {
+			Tags []TestTag `json:"tags"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tagged))
+		require.Len(t, tagged.Tags, 1)
+		assert.Equal(t, tag.ID, tagged.Tags[0].ID)
+
+		var aliasTags int64
+		tc.DB.GetDB().Model(&models.Tag{}).Where("name = ?", "nyc").Count(&aliasTags)
+		assert.Zero(t, aliasTags, "no tag should be created for the alias")
+
+		// Filters by the alias find the tag's photos
+		resp = tc.makeRequest("GET", "/api/v1/photos?tag=nyc", nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var list struct {
+			Photos []TestPhoto `json:"photos"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &list))
+		require.Len(t, list.Photos, 1)
+		assert.Equal(t, photo.ID, list.Photos[0].ID)
+
+		// Rename, list and delete
+		resp = tc.makeRequest("PUT", fmt.Sprintf("%s/%s", aliasesPath, alias.ID), map[string]interface{}{"name": "big-apple"})
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		tc.makeRequest("POST", aliasesPath, map[string]interface{}{"name": "manhattan"})
+
+		resp = tc.makeRequest("GET", aliasesPath, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var aliases []models.TagAlias
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &aliases))
+		require.Len(t, aliases, 2)
+		assert.Equal(t, "big-apple", aliases[0].Name)
+		assert.Equal(t, "manhattan", aliases[1].Name)
+
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("%s/%s", aliasesPath, alias.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("%s/%s", aliasesPath, alias.ID), nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		// Deleting the tag takes its aliases with it
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/tags/%s", tag.ID), nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var remaining int64
+		tc.DB.GetDB().Model(&models.TagAlias{}).Where("tag_id = ?", tag.ID).Count(&remaining)
+		assert.Zero(t, remaining)
+	})
 }
@@ -132,10 +132,12 @@ func TestIntegrationWorkflows(t *testing.T) {
 		albumPhotos = albumWithPhotos["photos"].([]interface{})
 		assert.Equal(t, 1, len(albumPhotos))
 
-		// Step 12: Delete a photo and verify cleanup
+		// Step 12: Delete a photo, purge it from the trash and verify cleanup
 		filePath := photo2.FilePath
 		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", photo2.ID), nil)
 		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", photo2.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
 
 		// Verify file is removed
 		_, err := os.Stat(filePath)
@@ -332,10 +334,12 @@ func TestIntegrationWorkflows(t *testing.T) {
 		photoTags := photoData["tags"].([]interface{})
 		assert.GreaterOrEqual(t, len(photoTags), 1)
 
-		// Delete photo and verify all relationships are cleaned up
+		// Delete and purge the photo and verify all relationships are cleaned up
 		filePath := photo.FilePath
 		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
 		assert.Equal(t, http.StatusOK, resp.Code)
+		resp = tc.makeRequest("DELETE", fmt.Sprintf("/api/v1/trash/%s", photo.ID), nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
 
 		// Verify photo is gone
 		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/photos/%s", photo.ID), nil)
@@ -353,17 +357,8 @@ func TestIntegrationWorkflows(t *testing.T) {
 		var freshAlbumData map[string]interface{}
 		json.Unmarshal(resp.Body.Bytes(), &freshAlbumData)
 
-		// When there are no photos, the API omits the "photos" field entirely
-		// This is expected behavior (empty slices get omitted in JSON)
-		photosField, exists := freshAlbumData["photos"]
-
-		if exists {
-			albumPhotos = photosField.([]interface{})
-			assert.Equal(t, 0, len(albumPhotos))
-		} else {
-			// Photos field doesn't exist = no photos, which is correct
-			assert.False(t, exists)
-		}
+		// Requested relations are always present, as [] when empty
+		assert.Equal(t, []interface{}{}, freshAlbumData["photos"])
 
 		// Verify tag still exists but has no photos
 		resp = tc.makeRequest("GET", fmt.Sprintf("/api/v1/tags/%s/stats", tag.ID), nil)
@@ -0,0 +1,122 @@
+package throttle
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// ChunkSize is the largest write passed through a throttled writer at once,
+// keeping pacing smooth and bounding how far a bucket can go into debt
+const ChunkSize = 32 * 1024
+
+// Bucket is a token bucket measured in bytes. It is safe for concurrent use,
+// so a single bucket can be shared to enforce a global limit.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a bucket refilling at bytesPerSecond. It returns nil when
+// bytesPerSecond is not positive; a nil bucket never throttles.
+func NewBucket(bytesPerSecond int64) *Bucket {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := float64(bytesPerSecond)
+	if burst < ChunkSize {
+		burst = ChunkSize
+	}
+
+	return &Bucket{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes may be sent or ctx is done
+func (b *Bucket) WaitN(ctx context.Context, n int) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	// Take the tokens up front; a negative balance is the time this caller
+	// (and anyone queued behind it) has to wait
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Writer paces writes to an underlying writer through one or more buckets
+type Writer struct {
+	w       io.Writer
+	ctx     context.Context
+	buckets []*Bucket
+}
+
+// NewWriter wraps w so that every write waits on all non-nil buckets
+func NewWriter(ctx context.Context, w io.Writer, buckets ...*Bucket) *Writer {
+	active := make([]*Bucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		if bucket != nil {
+			active = append(active, bucket)
+		}
+	}
+	return &Writer{w: w, ctx: ctx, buckets: active}
+}
+
+// Write implements io.Writer
+func (tw *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > ChunkSize {
+			chunk = chunk[:ChunkSize]
+		}
+
+		for _, bucket := range tw.buckets {
+			if err := bucket.WaitN(tw.ctx, len(chunk)); err != nil {
+				return written, err
+			}
+		}
+
+		n, err := tw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,67 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucket(t *testing.T) {
+	t.Run("Disabled bucket never waits", func(t *testing.T) {
+		bucket := NewBucket(0)
+		assert.Nil(t, bucket)
+		assert.NoError(t, bucket.WaitN(context.Background(), 1<<30))
+	})
+
+	t.Run("Writes beyond the burst are paced", func(t *testing.T) {
+		// 1 MB/s with a 1 MB burst: 1.2 MB needs roughly 200ms
+		bucket := NewBucket(1024 * 1024)
+		var out bytes.Buffer
+		w := NewWriter(context.Background(), &out, bucket)
+
+		start := time.Now()
+		n, err := w.Write(make([]byte, 1200*1024))
+		elapsed := time.Since(start)
+
+		require.NoError(t, err)
+		assert.Equal(t, 1200*1024, n)
+		assert.Equal(t, 1200*1024, out.Len())
+		assert.GreaterOrEqual(t, elapsed, 150*time.Millisecond)
+		assert.Less(t, elapsed, 2*time.Second)
+	})
+
+	t.Run("Shared bucket limits concurrent writers together", func(t *testing.T) {
+		global := NewBucket(ChunkSize * 10)
+		global.WaitN(context.Background(), ChunkSize*10) // drain the burst
+
+		start := time.Now()
+		done := make(chan struct{})
+		for i := 0; i < 2; i++ {
+			go func() {
+				NewWriter(context.Background(), &bytes.Buffer{}, nil, global).Write(make([]byte, ChunkSize))
+				done <- struct{}{}
+			}()
+		}
+		<-done
+		<-done
+
+		// Two chunks at ten chunks per second
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	})
+
+	t.Run("Cancelled context stops waiting", func(t *testing.T) {
+		bucket := NewBucket(1)
+		bucket.WaitN(context.Background(), ChunkSize)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		n, err := NewWriter(ctx, &bytes.Buffer{}, bucket).Write([]byte("blocked"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 0, n)
+	})
+}
@@ -0,0 +1,78 @@
+package thumbnails
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// Hash is a perceptual hash of an image: visually similar images, such as
+// the shots of a burst or a resized copy, have hashes that differ in few bits
+type Hash uint64
+
+// MaxHashDistance is the distance between the hashes of the least similar
+// images
+const MaxHashDistance = 64
+
+// HashImage computes the difference hash (dHash) of an image. The image is
+// shrunk to 9x8 gray pixels, and each bit tells whether a pixel is brighter
+// than its right neighbour.
+func HashImage(img image.Image) Hash {
+	small := scale(img, img.Bounds(), 9, 8).(*image.RGBA)
+
+	var hash Hash
+	for y := 0; y < 8; y++ {
+		row := small.Pix[y*small.Stride:]
+		for x := 0; x < 8; x++ {
+			if luma(row[x*4:]) > luma(row[(x+1)*4:]) {
+				hash |= 1 << (y*8 + x)
+			}
+		}
+	}
+	return hash
+}
+
+// HashFile computes the hash of the image at path, or of the poster frame
+// of a video
+func HashFile(path string) (Hash, error) {
+	src, err := load(path)
+	if err != nil {
+		return 0, err
+	}
+	return HashImage(src), nil
+}
+
+// HashData is HashFile for an image already in memory
+func HashData(data []byte) (Hash, error) {
+	src, err := Decode(data)
+	if err != nil {
+		return 0, err
+	}
+	return HashImage(src), nil
+}
+
+// Distance returns how many bits two hashes differ in, from 0 for images
+// that look the same to MaxHashDistance
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+// String returns the hash as 16 hex digits, as it is stored
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// ParseHash parses a hash formatted by String
+func ParseHash(s string) (Hash, error) {
+	value, err := strconv.ParseUint(s, 16, 64)
+	if err != nil || len(s) != 16 {
+		return 0, fmt.Errorf("invalid perceptual hash %q", s)
+	}
+	return Hash(value), nil
+}
+
+// luma returns the brightness of an RGBA pixel
+func luma(p []uint8) int {
+	return (299*int(p[0]) + 587*int(p[1]) + 114*int(p[2])) / 1000
+}
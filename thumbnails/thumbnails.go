@@ -0,0 +1,362 @@
+package thumbnails
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"photo-library-server/documents"
+	"photo-library-server/raw"
+	"photo-library-server/video"
+	"strings"
+)
+
+// DirName is the directory, inside a library's images path, that holds renditions
+const DirName = ".thumbnails"
+
+// DefaultSize is the rendition served when no size is requested
+const DefaultSize = "small"
+
+// Sizes maps rendition names to the maximum width/height in pixels
+var Sizes = map[string]int{
+	"small":  256,
+	"medium": 1024,
+}
+
+// jpegQuality is used for all renditions
+const jpegQuality = 85
+
+// Fit modes for resized images
+const (
+	FitContain = "contain" // Whole image within the box
+	FitCover   = "cover"   // Box filled, overflow cropped
+)
+
+// MaxResizeDimension is the largest width or height images are resized to
+const MaxResizeDimension = 4096
+
+// Flip directions for Rotate
+const (
+	FlipHorizontal = "horizontal" // Mirrored left to right
+	FlipVertical   = "vertical"   // Mirrored top to bottom
+)
+
+// ErrUnsupported is returned for images the server cannot decode
+var ErrUnsupported = errors.New("thumbnails are not supported for this image type")
+
+// ErrUnknownSize is returned for rendition names not listed in Sizes
+var ErrUnknownSize = errors.New("unknown thumbnail size")
+
+// Path returns where the named rendition of an image is cached. Renditions
+// live under the library's images directory even when the original has been
+// moved elsewhere (e.g. to cold storage).
+func Path(libraryDir, imagePath, size string) string {
+	base := strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+	return filepath.Join(libraryDir, DirName, fmt.Sprintf("%s_%s.jpg", base, size))
+}
+
+// Ensure returns the cached rendition of an image, generating it first if it
+// is missing or older than the image
+func Ensure(libraryDir, imagePath, size string) (string, error) {
+	if _, ok := Sizes[size]; !ok {
+		return "", ErrUnknownSize
+	}
+
+	path := Path(libraryDir, imagePath, size)
+	if cached, err := os.Stat(path); err == nil {
+		if original, err := os.Stat(imagePath); err == nil && !cached.ModTime().Before(original.ModTime()) {
+			return path, nil
+		}
+	}
+
+	if err := generate(libraryDir, imagePath, map[string]int{size: Sizes[size]}); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// GenerateAll renders every size for an image, decoding it only once
+func GenerateAll(libraryDir, imagePath string) error {
+	return generate(libraryDir, imagePath, Sizes)
+}
+
+// Remove deletes all cached renditions of an image
+func Remove(libraryDir, imagePath string) {
+	for size := range Sizes {
+		os.Remove(Path(libraryDir, imagePath, size))
+	}
+}
+
+// Render returns the named rendition of an image without caching it, for
+// originals whose renditions must not be stored (e.g. encrypted files)
+func Render(data []byte, size string) ([]byte, error) {
+	maxDimension, ok := Sizes[size]
+	if !ok {
+		return nil, ErrUnknownSize
+	}
+
+	src, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resize(src, maxDimension), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ResizeFile returns a JPEG of the image at path scaled to the given box, see
+// Fit for how. Videos use their poster frame.
+func ResizeFile(path string, width, height int, fit string) ([]byte, error) {
+	src, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return encodeFitted(src, width, height, fit)
+}
+
+// ResizeData is ResizeFile for an image already in memory
+func ResizeData(data []byte, width, height int, fit string) ([]byte, error) {
+	src, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeFitted(src, width, height, fit)
+}
+
+func encodeFitted(src image.Image, width, height int, fit string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Fit(src, width, height, fit), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fit scales img to a width x height box. FitContain keeps the whole image
+// within the box, and either side may be 0 to leave it unconstrained.
+// FitCover fills the box and crops the overflow evenly from both sides,
+// which needs both sides. Images are never enlarged, with FitCover a smaller
+// image is only cropped to the box's aspect ratio.
+func Fit(img image.Image, width, height int, fit string) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	if fit == FitCover && width > 0 && height > 0 {
+		crop := bounds
+		if srcW*height > srcH*width {
+			cropW := max(1, srcH*width/height)
+			crop.Min.X += (srcW - cropW) / 2
+			crop.Max.X = crop.Min.X + cropW
+		} else {
+			cropH := max(1, srcW*height/width)
+			crop.Min.Y += (srcH - cropH) / 2
+			crop.Max.Y = crop.Min.Y + cropH
+		}
+
+		if crop.Dx() > width {
+			return scale(img, crop, width, height)
+		}
+		return scale(img, crop, crop.Dx(), crop.Dy())
+	}
+
+	dstW, dstH := srcW, srcH
+	if width > 0 && dstW > width {
+		dstW, dstH = width, max(1, dstH*width/dstW)
+	}
+	if height > 0 && dstH > height {
+		dstW, dstH = max(1, dstW*height/dstH), height
+	}
+	return scale(img, bounds, dstW, dstH)
+}
+
+// Rotate turns img clockwise by degrees (0, 90, 180 or 270) and then mirrors
+// it in the flip direction, if any. Transparency is kept.
+func Rotate(img image.Image, degrees int, flip string) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Copy into an NRGBA image whose pixels can be moved directly
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dstW, dstH := w, h
+	if degrees%180 != 0 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x, y
+			switch degrees {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			case 270:
+				dx, dy = y, w-1-x
+			}
+			switch flip {
+			case FlipHorizontal:
+				dx = dstW - 1 - dx
+			case FlipVertical:
+				dy = dstH - 1 - dy
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+func generate(libraryDir, imagePath string, sizes map[string]int) error {
+	src, err := load(imagePath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(libraryDir, DirName), 0755); err != nil {
+		return err
+	}
+
+	for size, maxDimension := range sizes {
+		if err := writeJPEG(Path(libraryDir, imagePath, size), resize(src, maxDimension)); err != nil {
+			return fmt.Errorf("failed to write %s thumbnail: %w", size, err)
+		}
+	}
+	return nil
+}
+
+// load decodes the image at path, or the poster frame of a video. Videos
+// have no renditions when ffmpeg isn't installed.
+func load(path string) (image.Image, error) {
+	if video.IsVideoFile(path) {
+		poster, err := video.Poster(path)
+		if err == video.ErrNoFFmpeg {
+			return nil, ErrUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+		return Decode(poster)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// Decode decodes an image, the scanned first page of a PDF document or the
+// embedded preview of a RAW file. It returns ErrUnsupported for other files.
+func Decode(data []byte) (image.Image, error) {
+	if documents.IsPDF(data) {
+		if data = documents.Inspect(data).Cover; data == nil {
+			return nil, ErrUnsupported
+		}
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		if preview := raw.Preview(data); preview != nil {
+			src, _, err = image.Decode(bytes.NewReader(preview))
+		}
+	}
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupported
+		}
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return src, nil
+}
+
+// resize scales img to fit within maxDimension. Images that already fit are
+// not enlarged.
+func resize(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if srcW > maxDimension || srcH > maxDimension {
+		if srcW >= srcH {
+			dstW, dstH = maxDimension, max(1, srcH*maxDimension/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*maxDimension/srcH), maxDimension
+		}
+	}
+	return scale(img, bounds, dstW, dstH)
+}
+
+// scale scales the crop region of img to dstW x dstH by averaging the source
+// pixels covered by each output pixel
+func scale(img image.Image, crop image.Rectangle, dstW, dstH int) image.Image {
+	srcW, srcH := crop.Dx(), crop.Dy()
+
+	// Flatten onto white (JPEG has no alpha) into an RGBA image whose pixels
+	// can be read directly
+	src := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, crop.Min, draw.Over)
+	if dstW == srcW && dstH == srcH {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, max((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 0xFF
+		}
+	}
+	return dst
+}
+
+// writeJPEG encodes img to a temporary file and renames it into place so
+// concurrent readers never see a partial thumbnail
+func writeJPEG(path string, img image.Image) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if err := jpeg.Encode(tmp, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	os.Chmod(tmpPath, 0644)
+
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,254 @@
+package thumbnails
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePNG writes a solid w x h PNG and returns its path
+func writePNG(t *testing.T, dir string, w, h int, c color.Color) string {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	path := filepath.Join(dir, "photo.png")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, png.Encode(file, img))
+	return path
+}
+
+// decodeSize returns the dimensions of an image file
+func decodeSize(t *testing.T, path string) (int, int) {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	cfg, format, err := image.DecodeConfig(file)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	return cfg.Width, cfg.Height
+}
+
+func TestThumbnails(t *testing.T) {
+	t.Run("Renditions fit within their size and keep aspect ratio", func(t *testing.T) {
+		imagePath := writePNG(t, t.TempDir(), 2000, 1000, color.RGBA{0, 128, 255, 255})
+
+		require.NoError(t, GenerateAll(filepath.Dir(imagePath), imagePath))
+
+		w, h := decodeSize(t, Path(filepath.Dir(imagePath), imagePath, "small"))
+		assert.Equal(t, 256, w)
+		assert.Equal(t, 128, h)
+
+		w, h = decodeSize(t, Path(filepath.Dir(imagePath), imagePath, "medium"))
+		assert.Equal(t, 1024, w)
+		assert.Equal(t, 512, h)
+	})
+
+	t.Run("Small images are not enlarged", func(t *testing.T) {
+		imagePath := writePNG(t, t.TempDir(), 40, 60, color.White)
+
+		path, err := Ensure(filepath.Dir(imagePath), imagePath, "medium")
+		require.NoError(t, err)
+
+		w, h := decodeSize(t, path)
+		assert.Equal(t, 40, w)
+		assert.Equal(t, 60, h)
+	})
+
+	t.Run("Ensure reuses fresh renditions and replaces stale ones", func(t *testing.T) {
+		imagePath := writePNG(t, t.TempDir(), 300, 300, color.Black)
+
+		path, err := Ensure(filepath.Dir(imagePath), imagePath, "small")
+		require.NoError(t, err)
+		first, err := os.Stat(path)
+		require.NoError(t, err)
+
+		_, err = Ensure(filepath.Dir(imagePath), imagePath, "small")
+		require.NoError(t, err)
+		second, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, first.ModTime(), second.ModTime())
+
+		// Backdate the rendition so it is older than the original
+		past := time.Now().Add(-time.Hour)
+		require.NoError(t, os.Chtimes(path, past, past))
+		_, err = Ensure(filepath.Dir(imagePath), imagePath, "small")
+		require.NoError(t, err)
+		third, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.True(t, third.ModTime().After(past))
+	})
+
+	t.Run("Renditions are cached in the library directory", func(t *testing.T) {
+		libraryDir := t.TempDir()
+		imagePath := writePNG(t, t.TempDir(), 10, 10, color.White)
+
+		path, err := Ensure(libraryDir, imagePath, "small")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(libraryDir, DirName, "photo_small.jpg"), path)
+		assert.FileExists(t, path)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		dir := t.TempDir()
+		imagePath := filepath.Join(dir, "photo.webp")
+		require.NoError(t, os.WriteFile(imagePath, []byte("RIFF....WEBP"), 0644))
+
+		_, err := Ensure(filepath.Dir(imagePath), imagePath, "small")
+		assert.ErrorIs(t, err, ErrUnsupported)
+
+		_, err = Ensure(filepath.Dir(imagePath), imagePath, "huge")
+		assert.ErrorIs(t, err, ErrUnknownSize)
+	})
+
+	t.Run("Remove deletes all renditions", func(t *testing.T) {
+		imagePath := writePNG(t, t.TempDir(), 10, 10, color.White)
+		require.NoError(t, GenerateAll(filepath.Dir(imagePath), imagePath))
+
+		Remove(filepath.Dir(imagePath), imagePath)
+		for size := range Sizes {
+			assert.NoFileExists(t, Path(filepath.Dir(imagePath), imagePath, size))
+		}
+	})
+	t.Run("Render without caching", func(t *testing.T) {
+		dir := t.TempDir()
+		data, err := os.ReadFile(writePNG(t, dir, 600, 300, color.White))
+		require.NoError(t, err)
+
+		rendered, err := Render(data, "small")
+		require.NoError(t, err)
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(rendered))
+		require.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 256, cfg.Width)
+		assert.NoDirExists(t, filepath.Join(dir, DirName))
+
+		_, err = Render([]byte("not an image"), "small")
+		assert.ErrorIs(t, err, ErrUnsupported)
+		_, err = Render(data, "huge")
+		assert.ErrorIs(t, err, ErrUnknownSize)
+	})
+}
+
+func TestFit(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+
+	for _, tc := range []struct {
+		name          string
+		width, height int
+		fit           string
+		wantW, wantH  int
+	}{
+		{"Contain by width", 100, 0, FitContain, 100, 50},
+		{"Contain by height", 0, 50, FitContain, 100, 50},
+		{"Contain within both", 100, 100, FitContain, 100, 50},
+		{"Contain does not enlarge", 1000, 1000, FitContain, 400, 200},
+		{"Cover crops to the box", 100, 100, FitCover, 100, 100},
+		{"Cover portrait box", 50, 100, FitCover, 50, 100},
+		{"Cover only crops small images", 1000, 1000, FitCover, 200, 200},
+		{"Cover needs both sides", 100, 0, FitCover, 100, 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bounds := Fit(src, tc.width, tc.height, tc.fit).Bounds()
+			assert.Equal(t, tc.wantW, bounds.Dx())
+			assert.Equal(t, tc.wantH, bounds.Dy())
+		})
+	}
+
+	t.Run("Resize data", func(t *testing.T) {
+		data, err := os.ReadFile(writePNG(t, t.TempDir(), 600, 300, color.White))
+		require.NoError(t, err)
+
+		resized, err := ResizeData(data, 120, 120, FitCover)
+		require.NoError(t, err)
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(resized))
+		require.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 120, cfg.Width)
+		assert.Equal(t, 120, cfg.Height)
+
+		_, err = ResizeData([]byte("not an image"), 120, 120, FitCover)
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+}
+
+func TestRotate(t *testing.T) {
+	// A 2x1 image, red on the left and blue on the right
+	red, blue := color.NRGBA{R: 0xFF, A: 0xFF}, color.NRGBA{B: 0xFF, A: 0x80}
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	for _, tc := range []struct {
+		name          string
+		degrees       int
+		flip          string
+		width, height int
+		first         color.NRGBA // Top left pixel
+	}{
+		{"None", 0, "", 2, 1, red},
+		{"90", 90, "", 1, 2, red},
+		{"180", 180, "", 2, 1, blue},
+		{"270", 270, "", 1, 2, blue},
+		{"Flip horizontal", 0, FlipHorizontal, 2, 1, blue},
+		{"Flip vertical", 0, FlipVertical, 2, 1, red},
+		{"90 then flip vertical", 90, FlipVertical, 1, 2, blue},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rotated := Rotate(src, tc.degrees, tc.flip).(*image.NRGBA)
+			assert.Equal(t, tc.width, rotated.Bounds().Dx())
+			assert.Equal(t, tc.height, rotated.Bounds().Dy())
+			assert.Equal(t, tc.first, rotated.NRGBAAt(0, 0))
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	// A pattern of diagonal bands, with brightness offset and at a size
+	pattern := func(w, h int, offset uint8) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := uint8((x*7/w+y*3/h)%4*50) + offset
+				img.Set(x, y, color.RGBA{v, v, v, 0xFF})
+			}
+		}
+		return img
+	}
+
+	original := HashImage(pattern(180, 160, 0))
+	assert.LessOrEqual(t, original.Distance(HashImage(pattern(90, 80, 0))), 4, "resized")
+	assert.LessOrEqual(t, original.Distance(HashImage(pattern(180, 160, 40))), 4, "brightened")
+	assert.Greater(t, original.Distance(HashImage(Rotate(pattern(180, 160, 0), 0, FlipHorizontal))), 20, "mirrored")
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, pattern(180, 160, 0)))
+	fromData, err := HashData(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, original, fromData)
+
+	_, err = HashData([]byte("not an image"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	parsed, err := ParseHash(original.String())
+	require.NoError(t, err)
+	assert.Equal(t, original, parsed)
+	assert.Len(t, original.String(), 16)
+	_, err = ParseHash("xyz")
+	assert.Error(t, err)
+	assert.Equal(t, MaxHashDistance, Hash(0).Distance(^Hash(0)))
+}
@@ -0,0 +1,152 @@
+package tlsserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"photo-library-server/config"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Setup is how the server terminates TLS: with a certificate and key from
+// files, or with certificates obtained from Let's Encrypt
+type Setup struct {
+	Config  *tls.Config
+	manager *autocert.Manager // Let's Encrypt, nil with certificate files
+}
+
+// New sets up TLS from the configuration. It returns nil when neither
+// certificate files nor autocert domains are configured, and the server
+// speaks plain HTTP.
+func New(cfg *config.Config) (*Setup, error) {
+	files := cfg.TLSCertFile != "" || cfg.TLSKeyFile != ""
+	auto := len(cfg.TLSAutocertDomains) > 0
+
+	switch {
+	case files && auto:
+		return nil, errors.New("set either TLS_CERT_FILE and TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS, not both")
+	case files:
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		certs := &certReloader{certFile: cfg.TLSCertFile, keyFile: cfg.TLSKeyFile}
+		if err := certs.reload(); err != nil {
+			return nil, err
+		}
+		return &Setup{Config: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		}}, nil
+	case auto:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig() // Answers TLS-ALPN-01 challenges
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return &Setup{Config: tlsConfig, manager: manager}, nil
+	}
+	return nil, nil
+}
+
+// Autocert reports whether certificates come from Let's Encrypt
+func (s *Setup) Autocert() bool {
+	return s.manager != nil
+}
+
+// RedirectHandler redirects plain HTTP requests to the same URL over HTTPS
+// on httpsPort. With Let's Encrypt it answers HTTP-01 challenges first.
+func (s *Setup) RedirectHandler(httpsPort string) http.Handler {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			http.Error(w, "Host header required", http.StatusBadRequest)
+			return
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 literal
+		}
+
+		// 308 keeps the method and body of uploads and other writes
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+
+	if s.manager != nil {
+		return s.manager.HTTPHandler(redirect)
+	}
+	return redirect
+}
+
+// certReloader serves a certificate from files, loading it again when the
+// files change, so renewed certificates are picked up without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // Newest modification time of the loaded files
+	lastErr string    // Last reload failure, warned about once
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload() // On failure the last good certificate is kept
+	return r.cert, nil
+}
+
+// reload loads the certificate if the files changed since it was last loaded.
+// The caller must hold mu once the reloader is in use.
+func (r *certReloader) reload() error {
+	var modTime time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return r.failed(fmt.Errorf("failed to read TLS certificate: %w", err))
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if r.cert != nil && modTime.Equal(r.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return r.failed(fmt.Errorf("failed to load TLS certificate: %w", err))
+	}
+	r.cert, r.modTime, r.lastErr = &cert, modTime, ""
+	return nil
+}
+
+// failed warns about a certificate that couldn't be reloaded, once until it
+// loads again
+func (r *certReloader) failed(err error) error {
+	if r.cert != nil && err.Error() != r.lastErr {
+		r.lastErr = err.Error()
+		slog.Warn("Keeping the previous TLS certificate", "cert_file", r.certFile, "error", err)
+	}
+	return err
+}
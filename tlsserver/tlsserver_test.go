@@ -0,0 +1,148 @@
+package tlsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"photo-library-server/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its key
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+// servedName returns the common name of the certificate setup serves
+func servedName(t *testing.T, setup *Setup) string {
+	cert, err := setup.Config.GetCertificate(&tls.ClientHelloInfo{ServerName: "photos.example.com"})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestNew(t *testing.T) {
+	t.Run("Plain HTTP", func(t *testing.T) {
+		setup, err := New(&config.Config{})
+		require.NoError(t, err)
+		assert.Nil(t, setup)
+	})
+
+	t.Run("Certificate files", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeCertificate(t, certFile, keyFile, "first.example.com")
+
+		setup, err := New(&config.Config{TLSCertFile: certFile, TLSKeyFile: keyFile})
+		require.NoError(t, err)
+		require.NotNil(t, setup)
+		assert.False(t, setup.Autocert())
+		assert.Equal(t, uint16(tls.VersionTLS12), setup.Config.MinVersion)
+		assert.Equal(t, "first.example.com", servedName(t, setup))
+
+		// Renewed certificates are served without a restart
+		writeCertificate(t, certFile, keyFile, "second.example.com")
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(certFile, later, later))
+		assert.Equal(t, "second.example.com", servedName(t, setup))
+
+		// Broken files keep the last good certificate
+		require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+		later = later.Add(time.Minute)
+		require.NoError(t, os.Chtimes(keyFile, later, later))
+		assert.Equal(t, "second.example.com", servedName(t, setup))
+	})
+
+	t.Run("Let's Encrypt", func(t *testing.T) {
+		setup, err := New(&config.Config{
+			TLSAutocertDomains:  []string{"photos.example.com"},
+			TLSAutocertCacheDir: t.TempDir(),
+		})
+		require.NoError(t, err)
+		require.NotNil(t, setup)
+		assert.True(t, setup.Autocert())
+		assert.Contains(t, setup.Config.NextProtos, "acme-tls/1")
+		assert.NotNil(t, setup.Config.GetCertificate)
+	})
+
+	t.Run("Invalid configurations", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeCertificate(t, certFile, keyFile, "photos.example.com")
+
+		for name, cfg := range map[string]*config.Config{
+			"Certificate without key": {TLSCertFile: certFile},
+			"Both modes":              {TLSCertFile: certFile, TLSKeyFile: keyFile, TLSAutocertDomains: []string{"photos.example.com"}},
+			"Missing files":           {TLSCertFile: filepath.Join(dir, "missing.pem"), TLSKeyFile: keyFile},
+		} {
+			_, err := New(cfg)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestRedirectHandler(t *testing.T) {
+	setup := &Setup{}
+	for _, tc := range []struct {
+		name      string
+		method    string
+		host      string
+		target    string
+		httpsPort string
+		status    int
+		location  string
+	}{
+		{"Default port", http.MethodGet, "photos.example.com", "/api/v1/photos?page=2", "443", http.StatusMovedPermanently, "https://photos.example.com/api/v1/photos?page=2"},
+		{"HTTP port is dropped", http.MethodHead, "photos.example.com:80", "/", "443", http.StatusMovedPermanently, "https://photos.example.com/"},
+		{"Other HTTPS port", http.MethodGet, "photos.example.com:8080", "/health", "8443", http.StatusMovedPermanently, "https://photos.example.com:8443/health"},
+		{"Writes keep their method", http.MethodPost, "photos.example.com", "/api/v1/photos", "443", http.StatusPermanentRedirect, "https://photos.example.com/api/v1/photos"},
+		{"IPv6", http.MethodGet, "[::1]:80", "/", "443", http.StatusMovedPermanently, "https://[::1]/"},
+		{"IPv6 other port", http.MethodGet, "[::1]", "/", "8443", http.StatusMovedPermanently, "https://[::1]:8443/"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, nil)
+			req.Host = tc.host
+			w := httptest.NewRecorder()
+			setup.RedirectHandler(tc.httpsPort).ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.location, w.Header().Get("Location"))
+		})
+	}
+
+	t.Run("Missing host", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = ""
+		w := httptest.NewRecorder()
+		setup.RedirectHandler("443").ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,308 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MimeTypes are the video content types the server accepts
+var MimeTypes = []string{"video/mp4", "video/quicktime"}
+
+// FFmpegPath is the ffmpeg binary frames are extracted with, set from
+// the configuration at startup
+var FFmpegPath = "ffmpeg"
+
+// ErrNoFFmpeg is returned by Poster when ffmpeg isn't installed
+var ErrNoFFmpeg = errors.New("ffmpeg is not available")
+
+// ErrInvalid is returned for files that aren't MP4/QuickTime videos
+var ErrInvalid = errors.New("not an MP4 or QuickTime video")
+
+const (
+	// maxMoovSize caps how much metadata is read, real moov boxes are well below it
+	maxMoovSize = 64 << 20
+
+	// posterTimeout bounds a single ffmpeg run
+	posterTimeout = 30 * time.Second
+)
+
+// mp4Epoch is where MP4 timestamps count from
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Info is what the server records about a video
+type Info struct {
+	Duration      float64    // Length in seconds
+	Width, Height int        // Display size, rotation applied
+	CreatedAt     *time.Time // Recording time, nil if the file doesn't say
+}
+
+// box is an MP4 box: its type and payload
+type box struct {
+	boxType string
+	data    []byte
+}
+
+// IsVideoType reports whether mimeType is an accepted video type
+func IsVideoType(mimeType string) bool {
+	for _, t := range MimeTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsVideo reports whether data starts like an MP4 or QuickTime file
+func IsVideo(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	switch string(data[4:8]) {
+	case "ftyp", "moov", "mdat", "wide":
+		return true
+	}
+	return false
+}
+
+// IsVideoFile reports whether the file at path is an MP4 or QuickTime video
+func IsVideoFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return IsVideo(header)
+}
+
+// Inspect returns the duration, size and recording time of a video. Only the
+// moov box is read, so large files aren't loaded into memory.
+func Inspect(r io.ReaderAt, size int64) (*Info, error) {
+	moov, err := findMoov(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	found := false
+	for _, b := range boxes(moov) {
+		switch b.boxType {
+		case "mvhd":
+			info.Duration, info.CreatedAt = parseMvhd(b.data)
+		case "trak":
+			if !found && isVideoTrack(b.data) {
+				info.Width, info.Height = trackSize(b.data)
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil, ErrInvalid
+	}
+	return info, nil
+}
+
+// ReadInfo reads a video's metadata from disk
+func ReadInfo(path string) (*Info, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Inspect(file, stat.Size())
+}
+
+// PostersAvailable reports whether ffmpeg can be found to extract poster frames
+func PostersAvailable() bool {
+	_, err := exec.LookPath(FFmpegPath)
+	return err == nil
+}
+
+// Poster extracts a frame of the video at path as a PNG. It is taken a second
+// in, or halfway through shorter clips, to skip black lead-in frames.
+func Poster(path string) ([]byte, error) {
+	if !PostersAvailable() {
+		return nil, ErrNoFFmpeg
+	}
+
+	offset := 1.0
+	if info, err := ReadInfo(path); err == nil && info.Duration < 2 {
+		offset = info.Duration / 2
+	}
+	return Frame(path, offset)
+}
+
+// Frame extracts the frame of the video at path shown offset seconds in, as
+// a PNG
+func Frame(path string, offset float64) ([]byte, error) {
+	if !PostersAvailable() {
+		return nil, ErrNoFFmpeg
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), posterTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, FFmpegPath, "-v", "error",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64), "-i", path,
+		"-frames:v", "1", "-f", "image2pipe", "-c:v", "png", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	frame, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if len(frame) == 0 {
+		return nil, errors.New("ffmpeg produced no frame")
+	}
+	return frame, nil
+}
+
+// findMoov reads the moov box's payload from the top level of a file
+func findMoov(r io.ReaderAt, size int64) ([]byte, error) {
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, ErrInvalid
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header)), int64(8)
+		boxType := string(header[4:8])
+
+		switch boxSize {
+		case 0: // Box runs to the end of the file
+			boxSize = size - offset
+		case 1: // 64-bit size follows the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, ErrInvalid
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if boxSize < headerSize || offset+boxSize > size {
+			return nil, ErrInvalid
+		}
+
+		if boxType == "moov" {
+			if boxSize-headerSize > maxMoovSize {
+				return nil, ErrInvalid
+			}
+			moov := make([]byte, boxSize-headerSize)
+			if _, err := r.ReadAt(moov, offset+headerSize); err != nil {
+				return nil, ErrInvalid
+			}
+			return moov, nil
+		}
+		offset += boxSize
+	}
+	return nil, ErrInvalid
+}
+
+// boxes splits a payload into its child boxes, stopping at the first
+// malformed one
+func boxes(data []byte) []box {
+	var children []box
+	for len(data) >= 8 {
+		size, headerSize := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return children
+			}
+			size, headerSize = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return children
+		}
+		children = append(children, box{string(data[4:8]), data[headerSize:size]})
+		data = data[size:]
+	}
+	return children
+}
+
+// child returns the payload of the first child box of the given type
+func child(data []byte, boxType string) []byte {
+	for _, b := range boxes(data) {
+		if b.boxType == boxType {
+			return b.data
+		}
+	}
+	return nil
+}
+
+// parseMvhd reads the duration and creation time from a movie header
+func parseMvhd(data []byte) (float64, *time.Time) {
+	var created, timescale, duration uint64
+	switch {
+	case len(data) >= 20 && data[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(data[4:]))
+		timescale = uint64(binary.BigEndian.Uint32(data[12:]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:]))
+	case len(data) >= 32 && data[0] == 1:
+		created = binary.BigEndian.Uint64(data[4:])
+		timescale = uint64(binary.BigEndian.Uint32(data[20:]))
+		duration = binary.BigEndian.Uint64(data[24:])
+	default:
+		return 0, nil
+	}
+
+	var seconds float64
+	if timescale > 0 {
+		seconds = float64(duration) / float64(timescale)
+	}
+
+	// Unset creation times are written as zero
+	if created == 0 {
+		return seconds, nil
+	}
+	createdAt := mp4Epoch.Add(time.Duration(created) * time.Second)
+	return seconds, &createdAt
+}
+
+// isVideoTrack reports whether a trak box holds a video track
+func isVideoTrack(trak []byte) bool {
+	hdlr := child(child(trak, "mdia"), "hdlr")
+	return len(hdlr) >= 12 && string(hdlr[8:12]) == "vide"
+}
+
+// trackSize reads a track's display size from its header, swapping width
+// and height for tracks rotated by 90 or 270 degrees
+func trackSize(trak []byte) (int, int) {
+	tkhd := child(trak, "tkhd")
+
+	// The matrix and size follow fields whose width depends on the version
+	matrix := 40
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		matrix = 52
+	}
+	if len(tkhd) < matrix+44 {
+		return 0, 0
+	}
+
+	width := int(binary.BigEndian.Uint32(tkhd[matrix+36:]) >> 16)
+	height := int(binary.BigEndian.Uint32(tkhd[matrix+40:]) >> 16)
+
+	a, b := int32(binary.BigEndian.Uint32(tkhd[matrix:])), int32(binary.BigEndian.Uint32(tkhd[matrix+4:]))
+	if a == 0 && b != 0 {
+		width, height = height, width
+	}
+	return width, height
+}
@@ -0,0 +1,114 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mp4Box builds an MP4 box with the given type and payload
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], boxType)
+	return append(b, body...)
+}
+
+// mvhd builds a version 0 movie header
+func mvhd(created, timescale, duration uint32) []byte {
+	b := make([]byte, 100)
+	binary.BigEndian.PutUint32(b[4:], created)
+	binary.BigEndian.PutUint32(b[12:], timescale)
+	binary.BigEndian.PutUint32(b[16:], duration)
+	return mp4Box("mvhd", b)
+}
+
+// trak builds a track of the given handler type, rotated by 90 degrees if asked
+func trak(handler string, width, height int, rotated bool) []byte {
+	tkhd := make([]byte, 84)
+	a, b := uint32(0x10000), uint32(0)
+	if rotated {
+		a, b = 0, 0x10000
+	}
+	binary.BigEndian.PutUint32(tkhd[40:], a)
+	binary.BigEndian.PutUint32(tkhd[44:], b)
+	binary.BigEndian.PutUint32(tkhd[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], uint32(height)<<16)
+
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], handler)
+	return mp4Box("trak", mp4Box("tkhd", tkhd), mp4Box("mdia", mp4Box("hdlr", hdlr)))
+}
+
+// buildMP4 lays out a video with its moov box after the media data, the way
+// cameras record them
+func buildMP4(tracks ...[]byte) []byte {
+	created := uint32(time.Date(2024, 7, 4, 18, 30, 0, 0, time.UTC).Sub(mp4Epoch) / time.Second)
+	moov := mp4Box("moov", append([][]byte{mvhd(created, 600, 4500)}, tracks...)...)
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isommp41")),
+		mp4Box("mdat", make([]byte, 64)),
+		moov,
+	}, nil)
+}
+
+func TestInspect(t *testing.T) {
+	t.Run("Duration, size and recording time", func(t *testing.T) {
+		data := buildMP4(trak("soun", 0, 0, false), trak("vide", 1920, 1080, false))
+		info, err := Inspect(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		assert.Equal(t, 7.5, info.Duration)
+		assert.Equal(t, 1920, info.Width)
+		assert.Equal(t, 1080, info.Height)
+		require.NotNil(t, info.CreatedAt)
+		assert.Equal(t, time.Date(2024, 7, 4, 18, 30, 0, 0, time.UTC), *info.CreatedAt)
+	})
+
+	t.Run("Rotated phone video", func(t *testing.T) {
+		data := buildMP4(trak("vide", 1920, 1080, true))
+		info, err := Inspect(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		assert.Equal(t, 1080, info.Width)
+		assert.Equal(t, 1920, info.Height)
+	})
+
+	t.Run("64-bit box size", func(t *testing.T) {
+		mdat := make([]byte, 16+32)
+		binary.BigEndian.PutUint32(mdat, 1)
+		copy(mdat[4:], "mdat")
+		binary.BigEndian.PutUint64(mdat[8:], uint64(len(mdat)))
+		data := append(mdat, mp4Box("moov", mvhd(0, 1000, 2000), trak("vide", 640, 480, false))...)
+
+		info, err := Inspect(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, info.Duration)
+		assert.Equal(t, 640, info.Width)
+		assert.Nil(t, info.CreatedAt)
+	})
+
+	t.Run("Not a video", func(t *testing.T) {
+		for _, data := range [][]byte{
+			buildMP4(trak("soun", 0, 0, false)),
+			mp4Box("ftyp", []byte("isom")),
+			[]byte("\xFF\xD8\xFF\xE0 a JPEG"),
+		} {
+			_, err := Inspect(bytes.NewReader(data), int64(len(data)))
+			assert.ErrorIs(t, err, ErrInvalid)
+		}
+	})
+}
+
+func TestIsVideo(t *testing.T) {
+	assert.True(t, IsVideo(buildMP4(trak("vide", 640, 480, false))))
+	assert.True(t, IsVideo(mp4Box("wide")))
+	assert.False(t, IsVideo([]byte("\x89PNG\r\n\x1a\n")))
+	assert.False(t, IsVideo([]byte("ftyp")))
+
+	assert.True(t, IsVideoType("video/quicktime"))
+	assert.False(t, IsVideoType("image/jpeg"))
+}
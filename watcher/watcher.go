@@ -0,0 +1,216 @@
+package watcher
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher reports files created or written under a set of directory trees
+// once they have gone quiet for the debounce period, so a file still being
+// copied in is reported once, after the copy finishes. Hidden files and
+// directories are ignored.
+type Watcher struct {
+	fs       *fsnotify.Watcher
+	debounce time.Duration
+	onFile   func(path string)
+
+	mu      sync.Mutex
+	roots   map[string]bool
+	pending map[string]*time.Timer
+	closed  bool
+	done    chan struct{}
+}
+
+// New starts a watcher that calls onFile, from its own goroutine, for each
+// settled file. Nothing is watched until roots are added.
+func New(debounce time.Duration, onFile func(path string)) (*Watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		fs:       fsWatcher,
+		debounce: debounce,
+		onFile:   onFile,
+		roots:    make(map[string]bool),
+		pending:  make(map[string]*time.Timer),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Add watches root and every directory below it. Files already there are
+// not reported.
+func (w *Watcher) Add(root string) error {
+	root = filepath.Clean(root)
+	w.mu.Lock()
+	w.roots[root] = true
+	w.mu.Unlock()
+	return w.addTree(root, false)
+}
+
+// Remove stops watching root and the directories below it
+func (w *Watcher) Remove(root string) {
+	root = filepath.Clean(root)
+	w.mu.Lock()
+	delete(w.roots, root)
+	for path, timer := range w.pending {
+		if within(root, path) {
+			timer.Stop()
+			delete(w.pending, path)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, dir := range w.fs.WatchList() {
+		if within(root, dir) {
+			w.fs.Remove(dir)
+		}
+	}
+}
+
+// Roots returns the watched directory trees
+func (w *Watcher) Roots() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	roots := make([]string, 0, len(w.roots))
+	for root := range w.roots {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// Close stops watching everything and drops files that haven't settled yet
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	for path, timer := range w.pending {
+		timer.Stop()
+		delete(w.pending, path)
+	}
+	w.mu.Unlock()
+
+	close(w.done)
+	return w.fs.Close()
+}
+
+func (w *Watcher) run() {
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("File watcher error", "error", err)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) handle(event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+	if hidden(path) {
+		return
+	}
+
+	switch {
+	case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		if info.IsDir() {
+			// Directories moved in arrive whole, so their files are reported too
+			if err := w.addTree(path, true); err != nil {
+				slog.Warn("Failed to watch directory", "path", path, "error", err)
+			}
+			return
+		}
+		if info.Mode().IsRegular() {
+			w.settle(path)
+		}
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		w.mu.Lock()
+		if timer, ok := w.pending[path]; ok {
+			timer.Stop()
+			delete(w.pending, path)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// settle (re)starts the quiet period of a file
+func (w *Watcher) settle(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+
+	if timer, ok := w.pending[path]; ok {
+		timer.Reset(w.debounce)
+		return
+	}
+	w.pending[path] = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		delete(w.pending, path)
+		closed := w.closed
+		w.mu.Unlock()
+		if !closed {
+			w.onFile(path)
+		}
+	})
+}
+
+// addTree watches dir and the directories below it, optionally reporting the
+// files found along the way
+func (w *Watcher) addTree(dir string, report bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return w.fs.Add(path)
+		}
+		if report && d.Type().IsRegular() {
+			w.settle(path)
+		}
+		return nil
+	})
+}
+
+// hidden reports whether a file or directory name starts with a dot
+func hidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// within reports whether path is root or below it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
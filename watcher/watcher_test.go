@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects reported files
+type recorder struct {
+	mu    sync.Mutex
+	files []string
+}
+
+func (r *recorder) add(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = append(r.files, path)
+}
+
+func (r *recorder) reported() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+func TestWatcher(t *testing.T) {
+	const debounce = 50 * time.Millisecond
+
+	setup := func(t *testing.T) (string, *Watcher, *recorder) {
+		root := t.TempDir()
+		rec := &recorder{}
+		w, err := New(debounce, rec.add)
+		require.NoError(t, err)
+		t.Cleanup(func() { w.Close() })
+		require.NoError(t, w.Add(root))
+		return root, w, rec
+	}
+
+	t.Run("Reports a file once it stops changing", func(t *testing.T) {
+		root, _, rec := setup(t)
+		path := filepath.Join(root, "photo.jpg")
+
+		file, err := os.Create(path)
+		require.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			file.Write([]byte("chunk"))
+			time.Sleep(debounce / 3)
+		}
+		file.Close()
+
+		assert.Eventually(t, func() bool { return len(rec.reported()) > 0 }, time.Second, 10*time.Millisecond)
+		time.Sleep(2 * debounce)
+		assert.Equal(t, []string{path}, rec.reported())
+	})
+
+	t.Run("Watches new subdirectories and reports their files", func(t *testing.T) {
+		root, _, rec := setup(t)
+
+		// Built elsewhere and moved in whole
+		staging := filepath.Join(t.TempDir(), "trip")
+		require.NoError(t, os.MkdirAll(staging, 0755))
+		os.WriteFile(filepath.Join(staging, "beach.jpg"), []byte("x"), 0644)
+		require.NoError(t, os.Rename(staging, filepath.Join(root, "trip")))
+
+		moved := filepath.Join(root, "trip", "beach.jpg")
+		assert.Eventually(t, func() bool { return len(rec.reported()) == 1 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []string{moved}, rec.reported())
+
+		// Files written into the new directory later are seen as well
+		later := filepath.Join(root, "trip", "dunes.jpg")
+		os.WriteFile(later, []byte("x"), 0644)
+		assert.Eventually(t, func() bool { return len(rec.reported()) == 2 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Ignores hidden files and removed files", func(t *testing.T) {
+		root, _, rec := setup(t)
+
+		os.WriteFile(filepath.Join(root, ".partial.jpg"), []byte("x"), 0644)
+		require.NoError(t, os.MkdirAll(filepath.Join(root, ".thumbnails"), 0755))
+		os.WriteFile(filepath.Join(root, ".thumbnails", "small.jpg"), []byte("x"), 0644)
+
+		gone := filepath.Join(root, "gone.jpg")
+		os.WriteFile(gone, []byte("x"), 0644)
+		os.Remove(gone)
+
+		time.Sleep(4 * debounce)
+		assert.Empty(t, rec.reported())
+	})
+
+	t.Run("Stops reporting removed roots", func(t *testing.T) {
+		root, w, rec := setup(t)
+		assert.Equal(t, []string{filepath.Clean(root)}, w.Roots())
+
+		w.Remove(root)
+		assert.Empty(t, w.Roots())
+		os.WriteFile(filepath.Join(root, "photo.jpg"), []byte("x"), 0644)
+
+		time.Sleep(4 * debounce)
+		assert.Empty(t, rec.reported())
+	})
+}